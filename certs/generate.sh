@@ -11,4 +11,4 @@ openssl req -x509 -newkey rsa:4096 -nodes \
   -out "$CERT_FILE" \
   -days 365 \
   -subj "/C=RU/ST=Moscow/L=Moscow/O=MedSoft Labs/OU=HL7 System/CN=localhost" \
-  -addext "subjectAltName=DNS:localhost,DNS:reception-api,DNS:hospital-srv,IP:127.0.0.1"
+  -addext "subjectAltName=DNS:localhost,DNS:reception-api,DNS:doctor-api,DNS:hospital-srv,IP:127.0.0.1"
@@ -3,18 +3,24 @@ package config
 import "os"
 
 type Config struct {
-	ServerPort     string
-	HISHTTPAddress string
-	TLSCertPath    string
-	TLSKeyPath     string
+	ServerPort           string
+	HISHTTPAddress       string
+	TLSCertPath          string
+	TLSKeyPath           string
+	PublicURL            string
+	SubscriptionCriteria string
+	NotificationSecret   string
 }
 
 func Load() *Config {
 	return &Config{
-		ServerPort:     getEnv("DOCTOR_API_PORT", "8081"),
-		HISHTTPAddress: getEnv("HIS_HTTP_ADDRESS", "https://hospital-srv:9090"),
-		TLSCertPath:    getEnv("TLS_CERT_PATH", "/app/certs/server.crt"),
-		TLSKeyPath:     getEnv("TLS_KEY_PATH", "/app/certs/server.key"),
+		ServerPort:           getEnv("DOCTOR_API_PORT", "8081"),
+		HISHTTPAddress:       getEnv("HIS_HTTP_ADDRESS", "https://hospital-srv:9090"),
+		TLSCertPath:          getEnv("TLS_CERT_PATH", "/app/certs/server.crt"),
+		TLSKeyPath:           getEnv("TLS_KEY_PATH", "/app/certs/server.key"),
+		PublicURL:            getEnv("DOCTOR_API_PUBLIC_URL", "https://doctor-api:8081"),
+		SubscriptionCriteria: getEnv("FHIR_SUBSCRIPTION_CRITERIA", "Encounter"),
+		NotificationSecret:   getEnv("NOTIFICATION_SIGNING_SECRET", "default-notification-secret-to-change"),
 	}
 }
 
@@ -1,243 +1,235 @@
 package fhir
 
 import (
-	"bytes"
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"doctor-api/models"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
-	"strings"
+	"net/url"
 	"time"
+
+	fhirclient "fhir-client"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	comppb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/composition_go_proto"
+	condpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/condition_go_proto"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	mrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/medication_request_go_proto"
+	patientpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+	subpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/subscription_go_proto"
 )
 
+// ErrVersionConflict is returned when HIS rejects an update because the resource version has changed.
+var ErrVersionConflict = fhirclient.ErrVersionConflict
+
+// ErrNotFound is returned when HIS does not know the requested resource.
+var ErrNotFound = fhirclient.ErrNotFound
+
+// ErrConflict is returned when HIS refuses a change that conflicts with existing data, e.g. a second active
+// prescription of the same drug.
+var ErrConflict = fhirclient.ErrConflict
+
+// ErrStatusTransition is returned when HIS refuses an encounter status change its workflow does not allow,
+// e.g. reopening a completed encounter.
+var ErrStatusTransition = fhirclient.ErrStatusTransition
+
 // FHIRClient provides communication with FHIR server.
 type FHIRClient struct {
-	baseURL    string
-	httpClient *http.Client
+	client *fhirclient.Client
 }
 
-// NewFHIRClient creates a new FHIR client with TLS configuration.
+// NewFHIRClient creates a new FHIR client for the HIS at baseURL, trusting the certificate at certPath.
 func NewFHIRClient(baseURL string, certPath string) (*FHIRClient, error) {
-	cert, err := os.ReadFile(certPath)
+	client, err := fhirclient.New(fhirclient.Config{
+		BaseURL:  baseURL + "/fhir",
+		CertPath: certPath,
+		Timeout:  30 * time.Second,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read certificate: %w", err)
-	}
-
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(cert) {
-		return nil, fmt.Errorf("failed to append certificate")
-	}
-
-	tlsConfig := &tls.Config{
-		RootCAs: certPool,
+		return nil, err
 	}
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
-	}
-
-	return &FHIRClient{
-		baseURL:    baseURL,
-		httpClient: httpClient,
-	}, nil
+	return &FHIRClient{client: client}, nil
 }
 
-func (c *FHIRClient) GetEncountersByPractitioner(practitionerID string) ([]models.EncounterDTO, error) {
-	url := fmt.Sprintf("%s/fhir/Encounter", c.baseURL)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+func (c *FHIRClient) GetEncountersByPractitioner(ctx context.Context, practitionerID string) ([]models.EncounterDTO, error) {
+	query := url.Values{
+		"practitioner": {"Practitioner/" + practitionerID},
+		"_include":     {"Encounter:subject", "Encounter:participant"},
 	}
-
-	resp, err := c.httpClient.Do(req)
+	bundle, err := c.client.SearchAll(ctx, "Encounter", query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HIS returned status %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var bundle map[string]interface{}
-	if err := json.Unmarshal(respBody, &bundle); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	entries, ok := bundle["entry"].([]interface{})
-	if !ok {
-		return []models.EncounterDTO{}, nil
+		return nil, err
 	}
 
-	var encounters []models.EncounterDTO
-	for _, entry := range entries {
-		entryMap, ok := entry.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		resource, ok := entryMap["resource"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		if !matchesPractitioner(resource, practitionerID) {
-			continue
-		}
+	included := fhirclient.Index(bundle.Entry)
 
-		dto, err := MapFHIRToEncounterDTO(resource)
-		if err != nil {
-			log.Printf("Failed to map FHIR to DTO: %v", err)
+	encounters := []models.EncounterDTO{}
+	for _, entry := range bundle.Matches() {
+		var encounter encpb.Encounter
+		if err := entry.Decode(&encounter); err != nil {
+			log.Printf("Failed to parse FHIR Encounter: %v", err)
 			continue
 		}
 
-		encounters = append(encounters, *dto)
+		encounters = append(encounters, *fhirclient.SummarizeEncounter(&encounter, included))
 	}
 
 	log.Printf("Returning %d encounters for practitioner %s", len(encounters), practitionerID)
 	return encounters, nil
 }
 
-func (c *FHIRClient) UpdateEncounterStatus(encounterID string, status string) error {
-	reqBody := map[string]string{
-		"status": status,
-	}
-
-	jsonBytes, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	log.Printf("Sending FHIR status update to HIS: encounter=%s, status=%s", encounterID, status)
-
-	url := fmt.Sprintf("%s/fhir/Encounter/%s", c.baseURL, encounterID)
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
+// UpdateEncounterStatus changes the encounter status in HIS. When version is set it is sent as If-Match and
+// ErrVersionConflict is returned if the encounter has changed since. actor is recorded by HIS in the
+// encounter status history. The new version id is returned on success.
+func (c *FHIRClient) UpdateEncounterStatus(ctx context.Context, encounterID string, status string, version string, actor string) (string, error) {
+	log.Printf("Sending FHIR status patch to HIS: encounter=%s, status=%s", encounterID, status)
 
-	resp, err := c.httpClient.Do(req)
+	result, err := c.client.UpdateEncounterStatus(ctx, encounterID, status, fhirclient.IfMatch(version), fhirclient.Actor(actor))
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HIS returned status %d: %s", resp.StatusCode, string(respBody))
+		return "", err
 	}
 
 	log.Printf("Successfully updated encounter status: encounter=%s, status=%s", encounterID, status)
-	return nil
-}
-
-func getPractitionerReference(participant map[string]interface{}) string {
-	individual, ok := participant["individual"].(map[string]interface{})
-	if !ok {
-		return ""
-	}
-
-	reference, ok := individual["reference"].(map[string]interface{})
-	if !ok {
-		return ""
-	}
-
-	refValue, ok := reference["value"].(string)
-	if !ok {
-		return ""
-	}
-
-	return refValue
+	return result.VersionID, nil
 }
 
-func matchesPractitioner(resource map[string]interface{}, practitionerID string) bool {
-	participants, ok := resource["participant"].([]interface{})
-	if !ok || len(participants) == 0 {
-		return false
+// RegisterSubscription makes sure HIS has a rest-hook Subscription with the given criteria that delivers
+// to endpoint, creating one if none exists yet. The subscription id is returned.
+func (c *FHIRClient) RegisterSubscription(ctx context.Context, criteria string, endpoint string) (string, error) {
+	bundle, err := c.client.SearchAll(ctx, "Subscription", url.Values{"url": {endpoint}, "criteria": {criteria}})
+	if err != nil {
+		return "", err
 	}
 
-	for _, p := range participants {
-		participant, ok := p.(map[string]interface{})
-		if !ok {
+	for _, entry := range bundle.Entry {
+		var existing subpb.Subscription
+		if err := entry.Decode(&existing); err != nil {
 			continue
 		}
-
-		refValue := getPractitionerReference(participant)
-		if refValue != "" && strings.HasSuffix(refValue, practitionerID) {
-			return true
+		if existing.GetStatus().GetValue() != codespb.SubscriptionStatusCode_OFF && existing.GetId() != nil {
+			return existing.GetId().GetValue(), nil
 		}
 	}
 
-	return false
-}
-
-func (c *FHIRClient) GetPractitioners() ([]models.PractitionerDTO, error) {
-	url := fmt.Sprintf("%s/fhir/Practitioner", c.baseURL)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	subscription := &subpb.Subscription{
+		Status:   &subpb.Subscription_StatusCode{Value: codespb.SubscriptionStatusCode_REQUESTED},
+		Reason:   &dtpb.String{Value: "Doctor workplace encounter updates"},
+		Criteria: &dtpb.String{Value: criteria},
+		Channel: &subpb.Subscription_Channel{
+			Type:     &subpb.Subscription_Channel_TypeCode{Value: codespb.SubscriptionChannelTypeCode_REST_HOOK},
+			Endpoint: &dtpb.Url{Value: endpoint},
+			Payload:  &subpb.Subscription_Channel_PayloadCode{Value: "application/json"},
+		},
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	var created subpb.Subscription
+	if _, err := c.client.Create(ctx, "Subscription", subscription, &created); err != nil {
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	return created.GetId().GetValue(), nil
+}
+
+func (c *FHIRClient) GetPractitioners(ctx context.Context) ([]models.PractitionerDTO, error) {
+	bundle, err := c.client.SearchAll(ctx, "Practitioner", nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	log.Printf("Received FHIR Practitioner response from HIS")
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HIS returned status %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var bundle map[string]interface{}
-	if err := json.Unmarshal(respBody, &bundle); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
+	practitioners := []models.PractitionerDTO{}
+	for _, entry := range bundle.Matches() {
+		var practitioner practpb.Practitioner
+		if err := entry.Decode(&practitioner); err != nil {
+			log.Printf("Failed to parse FHIR Practitioner: %v", err)
+			continue
+		}
 
-	entries, ok := bundle["entry"].([]interface{})
-	if !ok {
-		return []models.PractitionerDTO{}, nil
+		practitioners = append(practitioners, *MapFHIRToPractitionerDTO(&practitioner))
 	}
 
-	var practitioners []models.PractitionerDTO
-	for _, entry := range entries {
-		entryMap, ok := entry.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		resource, ok := entryMap["resource"].(map[string]interface{})
-		if !ok {
-			continue
-		}
+	return practitioners, nil
+}
 
-		dto, err := MapFHIRToPractitionerDTO(resource)
-		if err != nil {
-			log.Printf("Failed to map FHIR Practitioner to DTO: %v", err)
-			continue
+// GetPatientChart loads the patient's $everything Bundle from HIS, optionally limited to encounters between
+// start and end (FHIR dates such as 2024-01-01), and groups its entries by resource type.
+func (c *FHIRClient) GetPatientChart(ctx context.Context, patientID string, start string, end string) (*models.PatientChartDTO, error) {
+	query := url.Values{}
+	if start != "" {
+		query.Set("start", start)
+	}
+	if end != "" {
+		query.Set("end", end)
+	}
+
+	var bundle fhirclient.Bundle
+	if _, err := c.client.Operation(ctx, "Patient/"+url.PathEscape(patientID)+"/$everything", query, &bundle); err != nil {
+		return nil, err
+	}
+
+	chart := &models.PatientChartDTO{
+		Encounters:    []models.EncounterDTO{},
+		Practitioners: []models.PractitionerDTO{},
+		Diagnoses:     []models.DiagnosisDTO{},
+		Notes:         []models.NoteDTO{},
+		Prescriptions: []models.PrescriptionDTO{},
+	}
+
+	included := fhirclient.Index(bundle.Entry)
+	for _, entry := range bundle.Entry {
+		switch entry.ResourceType() {
+		case "Patient":
+			var patient patientpb.Patient
+			if err := entry.Decode(&patient); err != nil {
+				log.Printf("Failed to parse FHIR Patient: %v", err)
+				continue
+			}
+			chart.Patient = *MapFHIRToPatientDTO(&patient)
+		case "Encounter":
+			var encounter encpb.Encounter
+			if err := entry.Decode(&encounter); err != nil {
+				log.Printf("Failed to parse FHIR Encounter: %v", err)
+				continue
+			}
+			chart.Encounters = append(chart.Encounters, *fhirclient.SummarizeEncounter(&encounter, included))
+		case "Practitioner":
+			var practitioner practpb.Practitioner
+			if err := entry.Decode(&practitioner); err != nil {
+				log.Printf("Failed to parse FHIR Practitioner: %v", err)
+				continue
+			}
+			chart.Practitioners = append(chart.Practitioners, *MapFHIRToPractitionerDTO(&practitioner))
+		case "Condition":
+			var condition condpb.Condition
+			if err := entry.Decode(&condition); err != nil {
+				log.Printf("Failed to parse FHIR Condition: %v", err)
+				continue
+			}
+			chart.Diagnoses = append(chart.Diagnoses, *MapFHIRToDiagnosisDTO(&condition))
+		case "Composition":
+			var composition comppb.Composition
+			if err := entry.Decode(&composition); err != nil {
+				log.Printf("Failed to parse FHIR Composition: %v", err)
+				continue
+			}
+			chart.Notes = append(chart.Notes, *MapFHIRToNoteDTO(&composition))
+		case "MedicationRequest":
+			var request mrpb.MedicationRequest
+			if err := entry.Decode(&request); err != nil {
+				log.Printf("Failed to parse FHIR MedicationRequest: %v", err)
+				continue
+			}
+			chart.Prescriptions = append(chart.Prescriptions, *MapFHIRToPrescriptionDTO(&request))
 		}
+	}
 
-		practitioners = append(practitioners, *dto)
+	if chart.Patient.ID == "" {
+		return nil, fmt.Errorf("HIS response did not include Patient %s", patientID)
 	}
 
-	return practitioners, nil
+	return chart, nil
 }
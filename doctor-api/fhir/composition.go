@@ -0,0 +1,159 @@
+package fhir
+
+import (
+	"context"
+	"doctor-api/models"
+	"errors"
+	"html"
+	"log"
+	"net/url"
+
+	fhirclient "fhir-client"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	comppb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/composition_go_proto"
+)
+
+// ErrInvalidNote is returned when HIS rejects a clinical note, e.g. an edit of a note that is already signed.
+var ErrInvalidNote = errors.New("invalid clinical note")
+
+const (
+	systemLOINC = "http://loinc.org"
+
+	loincProgressNote = "11506-3"
+	loincComplaints   = "10154-3"
+	loincAnamnesis    = "10164-2"
+	loincExamination  = "29545-1"
+	loincPlan         = "18776-5"
+)
+
+// Composition statuses of a draft, a signed note and a note amended after signing.
+const (
+	noteStatusDraft   = codespb.CompositionStatusCode_PRELIMINARY
+	noteStatusSigned  = codespb.CompositionStatusCode_FINAL
+	noteStatusAmended = codespb.CompositionStatusCode_AMENDED
+)
+
+// NoteInput holds the text of a clinical note.
+type NoteInput struct {
+	Title       string
+	Complaints  string
+	Anamnesis   string
+	Examination string
+	Plan        string
+}
+
+// GetNote loads a single clinical note from HIS.
+func (c *FHIRClient) GetNote(ctx context.Context, noteID string) (*models.NoteDTO, error) {
+	var composition comppb.Composition
+	if _, err := c.client.Read(ctx, "Composition", noteID, &composition); err != nil {
+		return nil, err
+	}
+	return MapFHIRToNoteDTO(&composition), nil
+}
+
+// GetEncounterNotes returns the clinical notes written for an encounter, newest first.
+func (c *FHIRClient) GetEncounterNotes(ctx context.Context, encounterID string) ([]models.NoteDTO, error) {
+	entries, err := c.searchResources(ctx, "Composition", url.Values{"encounter": {"Encounter/" + encounterID}}, ErrInvalidNote)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := []models.NoteDTO{}
+	for _, entry := range entries {
+		var composition comppb.Composition
+		if err := entry.Decode(&composition); err != nil {
+			log.Printf("Failed to parse FHIR Composition: %v", err)
+			continue
+		}
+		notes = append(notes, *MapFHIRToNoteDTO(&composition))
+	}
+
+	return notes, nil
+}
+
+// CreateNote writes a clinical note by practitionerID for an encounter, as a draft or, if sign is set,
+// signed right away.
+func (c *FHIRClient) CreateNote(ctx context.Context, encounterID string, practitionerID string, input NoteInput, sign bool) (*models.NoteDTO, error) {
+	status := noteStatusDraft
+	if sign {
+		status = noteStatusSigned
+	}
+
+	composition := &comppb.Composition{
+		Status:    &comppb.Composition_StatusCode{Value: status},
+		Type:      fhirclient.NewConcept(systemLOINC, loincProgressNote),
+		Encounter: fhirclient.Reference("Encounter", encounterID),
+		Author:    []*dtpb.Reference{fhirclient.Reference("Practitioner", practitionerID)},
+	}
+	applyNoteInput(composition, input)
+
+	log.Printf("Sending FHIR Composition to HIS: encounter=%s, status=%s", encounterID, status)
+
+	var created comppb.Composition
+	if err := c.createResource(ctx, "Composition", composition, &created, ErrInvalidNote); err != nil {
+		return nil, err
+	}
+
+	return MapFHIRToNoteDTO(&created), nil
+}
+
+// UpdateNote replaces the text of a draft note. When version is set it is sent as If-Match and
+// ErrVersionConflict is returned if the note has changed since.
+func (c *FHIRClient) UpdateNote(ctx context.Context, noteID string, input NoteInput, version string) (*models.NoteDTO, error) {
+	return c.modifyNote(ctx, noteID, version, noteStatusDraft, &input)
+}
+
+// SignNote signs a draft note, after which it can only be amended.
+func (c *FHIRClient) SignNote(ctx context.Context, noteID string, version string) (*models.NoteDTO, error) {
+	return c.modifyNote(ctx, noteID, version, noteStatusSigned, nil)
+}
+
+// AmendNote replaces the text of a signed note. HIS keeps the signed text in the note history.
+func (c *FHIRClient) AmendNote(ctx context.Context, noteID string, input NoteInput, version string) (*models.NoteDTO, error) {
+	return c.modifyNote(ctx, noteID, version, noteStatusAmended, &input)
+}
+
+func (c *FHIRClient) modifyNote(ctx context.Context, noteID string, version string, status codespb.CompositionStatusCode_Value, input *NoteInput) (*models.NoteDTO, error) {
+	var composition comppb.Composition
+	err := c.modifyResource(ctx, "Composition", noteID, version, &composition, ErrInvalidNote, func() {
+		composition.Status = &comppb.Composition_StatusCode{Value: status}
+		if input != nil {
+			applyNoteInput(&composition, *input)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return MapFHIRToNoteDTO(&composition), nil
+}
+
+// applyNoteInput sets the title and sections of a Composition; empty parts of the note get no section.
+func applyNoteInput(composition *comppb.Composition, input NoteInput) {
+	if input.Title != "" {
+		composition.Title = &dtpb.String{Value: input.Title}
+	}
+
+	composition.Section = nil
+	for _, part := range []struct {
+		code string
+		text string
+	}{
+		{loincComplaints, input.Complaints},
+		{loincAnamnesis, input.Anamnesis},
+		{loincExamination, input.Examination},
+		{loincPlan, input.Plan},
+	} {
+		if part.text == "" {
+			continue
+		}
+		composition.Section = append(composition.Section, &comppb.Composition_Section{
+			Code: fhirclient.NewConcept(systemLOINC, part.code),
+			Text: &dtpb.Narrative{
+				Status: &dtpb.Narrative_StatusCode{Value: codespb.NarrativeStatusCode_ADDITIONAL},
+				Div:    &dtpb.Xhtml{Value: `<div xmlns="http://www.w3.org/1999/xhtml">` + html.EscapeString(part.text) + `</div>`},
+			},
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package fhir
+
+import (
+	"context"
+	"doctor-api/models"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	fhirclient "fhir-client"
+
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	condpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/condition_go_proto"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+)
+
+// ErrInvalidDiagnosis is returned when HIS rejects a diagnosis, e.g. for a code missing from its ICD-10 table.
+var ErrInvalidDiagnosis = errors.New("invalid diagnosis")
+
+const (
+	systemICD10              = "http://hl7.org/fhir/sid/icd-10"
+	systemConditionClinical  = "http://terminology.hl7.org/CodeSystem/condition-clinical"
+	systemConditionVerStatus = "http://terminology.hl7.org/CodeSystem/condition-ver-status"
+
+	verificationConfirmed      = "confirmed"
+	verificationProvisional    = "provisional"
+	verificationEnteredInError = "entered-in-error"
+)
+
+// DiagnosisInput holds the fields of a diagnosis a doctor can set.
+type DiagnosisInput struct {
+	Code  string
+	Note  string
+	Final bool
+}
+
+// GetEncounter loads a single encounter from HIS.
+func (c *FHIRClient) GetEncounter(ctx context.Context, encounterID string) (*models.EncounterDTO, error) {
+	var encounter encpb.Encounter
+	if _, err := c.client.Read(ctx, "Encounter", encounterID, &encounter); err != nil {
+		return nil, err
+	}
+	return fhirclient.SummarizeEncounter(&encounter, nil), nil
+}
+
+// GetDiagnosis loads a single diagnosis from HIS.
+func (c *FHIRClient) GetDiagnosis(ctx context.Context, diagnosisID string) (*models.DiagnosisDTO, error) {
+	var condition condpb.Condition
+	if _, err := c.client.Read(ctx, "Condition", diagnosisID, &condition); err != nil {
+		return nil, err
+	}
+	return MapFHIRToDiagnosisDTO(&condition), nil
+}
+
+// GetEncounterDiagnoses returns the diagnoses recorded in an encounter, newest first.
+func (c *FHIRClient) GetEncounterDiagnoses(ctx context.Context, encounterID string) ([]models.DiagnosisDTO, error) {
+	entries, err := c.searchResources(ctx, "Condition", url.Values{"encounter": {"Encounter/" + encounterID}}, ErrInvalidDiagnosis)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnoses := []models.DiagnosisDTO{}
+	for _, entry := range entries {
+		var condition condpb.Condition
+		if err := entry.Decode(&condition); err != nil {
+			log.Printf("Failed to parse FHIR Condition: %v", err)
+			continue
+		}
+		diagnoses = append(diagnoses, *MapFHIRToDiagnosisDTO(&condition))
+	}
+
+	return diagnoses, nil
+}
+
+// CreateDiagnosis records a diagnosis made by practitionerID in the encounter of patientID. A final diagnosis
+// is recorded as confirmed, any other as provisional.
+func (c *FHIRClient) CreateDiagnosis(ctx context.Context, patientID string, encounterID string, practitionerID string, input DiagnosisInput) (*models.DiagnosisDTO, error) {
+	condition := &condpb.Condition{
+		ClinicalStatus: fhirclient.NewConcept(systemConditionClinical, "active"),
+		Subject:        fhirclient.Reference("Patient", patientID),
+		Encounter:      fhirclient.Reference("Encounter", encounterID),
+		Recorder:       fhirclient.Reference("Practitioner", practitionerID),
+	}
+	applyDiagnosisInput(condition, input)
+
+	log.Printf("Sending FHIR Condition to HIS: encounter=%s, code=%s", encounterID, input.Code)
+
+	var created condpb.Condition
+	if err := c.createResource(ctx, "Condition", condition, &created, ErrInvalidDiagnosis); err != nil {
+		return nil, err
+	}
+
+	return MapFHIRToDiagnosisDTO(&created), nil
+}
+
+// UpdateDiagnosis changes the code, note and finality of a diagnosis. When version is set it is sent as
+// If-Match and ErrVersionConflict is returned if the diagnosis has changed since.
+func (c *FHIRClient) UpdateDiagnosis(ctx context.Context, diagnosisID string, input DiagnosisInput, version string) (*models.DiagnosisDTO, error) {
+	var condition condpb.Condition
+	err := c.modifyResource(ctx, "Condition", diagnosisID, version, &condition, ErrInvalidDiagnosis, func() {
+		applyDiagnosisInput(&condition, input)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return MapFHIRToDiagnosisDTO(&condition), nil
+}
+
+// ResolveDiagnosis marks a diagnosis resolved; HIS records the current time as its abatement.
+func (c *FHIRClient) ResolveDiagnosis(ctx context.Context, diagnosisID string, version string) (*models.DiagnosisDTO, error) {
+	var condition condpb.Condition
+	err := c.modifyResource(ctx, "Condition", diagnosisID, version, &condition, ErrInvalidDiagnosis, func() {
+		condition.ClinicalStatus = fhirclient.NewConcept(systemConditionClinical, "resolved")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return MapFHIRToDiagnosisDTO(&condition), nil
+}
+
+// DiscardDiagnosis marks a diagnosis as entered in error, for one recorded as part of a change that failed.
+func (c *FHIRClient) DiscardDiagnosis(ctx context.Context, diagnosisID string) error {
+	var condition condpb.Condition
+	return c.modifyResource(ctx, "Condition", diagnosisID, "", &condition, ErrInvalidDiagnosis, func() {
+		condition.VerificationStatus = fhirclient.NewConcept(systemConditionVerStatus, verificationEnteredInError)
+	})
+}
+
+// SearchCodes looks up ICD-10 codes in HIS by code prefix or display text.
+func (c *FHIRClient) SearchCodes(ctx context.Context, text string, count int) ([]models.CodeDTO, error) {
+	return c.expandCodes(ctx, systemICD10, text, count, ErrInvalidDiagnosis)
+}
+
+// applyDiagnosisInput sets the doctor-editable fields on a Condition resource.
+func applyDiagnosisInput(condition *condpb.Condition, input DiagnosisInput) {
+	condition.Code = fhirclient.NewConcept(systemICD10, input.Code)
+
+	verification := verificationProvisional
+	if input.Final {
+		verification = verificationConfirmed
+	}
+	condition.VerificationStatus = fhirclient.NewConcept(systemConditionVerStatus, verification)
+
+	condition.Note = nil
+	if input.Note != "" {
+		condition.Note = []*dtpb.Annotation{{Text: &dtpb.Markdown{Value: input.Note}}}
+	}
+
+	if condition.Onset == nil {
+		condition.Onset = &condpb.Condition_OnsetX{
+			Choice: &condpb.Condition_OnsetX_DateTime{DateTime: fhirclient.NewDateTime(time.Now())},
+		}
+	}
+}
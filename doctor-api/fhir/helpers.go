@@ -2,209 +2,184 @@ package fhir
 
 import (
 	"doctor-api/models"
-	"encoding/json"
-	"fmt"
-	"log"
+	"html"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	fhirclient "fhir-client"
+
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	comppb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/composition_go_proto"
+	condpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/condition_go_proto"
+	mrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/medication_request_go_proto"
+	patientpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
 )
 
-// GetStringValue extracts string value from FHIR field which may be a string or map with "value" key.
-func GetStringValue(field interface{}) string {
-	if field == nil {
-		return ""
-	}
-	if s, ok := field.(string); ok {
-		return s
-	}
-	if m, ok := field.(map[string]interface{}); ok {
-		if val, ok := m["value"].(string); ok {
-			return val
-		}
+// MapFHIRToPractitionerDTO converts FHIR Practitioner resource to PractitionerDTO.
+func MapFHIRToPractitionerDTO(practitioner *practpb.Practitioner) *models.PractitionerDTO {
+	dto := &models.PractitionerDTO{
+		ID: practitioner.GetId().GetValue(),
 	}
-	return ""
-}
 
-// GetInt64Value extracts int64 value from FHIR field, handling multiple formats.
-func GetInt64Value(field interface{}) int64 {
-	if field == nil {
-		return 0
-	}
-	if i, ok := field.(int64); ok {
-		return i
-	}
-	if f, ok := field.(float64); ok {
-		return int64(f)
-	}
-	if s, ok := field.(string); ok {
-		var val int64
-		fmt.Sscanf(s, "%d", &val)
-		return val
-	}
-	if m, ok := field.(map[string]interface{}); ok {
-		if val, ok := m["value"].(int64); ok {
-			return val
-		}
-		if val, ok := m["value"].(float64); ok {
-			return int64(val)
-		}
-		if val, ok := m["value"].(string); ok {
-			var i int64
-			fmt.Sscanf(val, "%d", &i)
-			return i
+	if names := practitioner.GetName(); len(names) > 0 {
+		dto.LastName = names[0].GetFamily().GetValue()
+		if given := names[0].GetGiven(); len(given) > 0 {
+			dto.FirstName = given[0].GetValue()
+			if len(given) > 1 {
+				dto.MiddleName = given[1].GetValue()
+			}
 		}
 	}
-	return 0
-}
 
-func ExtractGenderFromDisplay(display string) string {
-	re := regexp.MustCompile(`\[(male|female)\]$`)
-	matches := re.FindStringSubmatch(display)
-	if len(matches) > 1 {
-		return strings.ToLower(matches[1])
+	if qualifications := practitioner.GetQualification(); len(qualifications) > 0 {
+		dto.Specialization = fhirclient.ConceptText(qualifications[0].GetCode())
 	}
-	return ""
-}
 
-func RemoveGenderFromDisplay(display string) string {
-	re := regexp.MustCompile(`\s*\[(male|female)\]$`)
-	return re.ReplaceAllString(display, "")
+	return dto
 }
 
-func ExtractIDFromReference(reference string) string {
-	parts := strings.Split(reference, "/")
-	if len(parts) == 2 {
-		return parts[1]
+// MapFHIRToPatientDTO converts FHIR Patient resource to PatientDTO.
+func MapFHIRToPatientDTO(patient *patientpb.Patient) *models.PatientDTO {
+	dto := &models.PatientDTO{
+		ID:     patient.GetId().GetValue(),
+		Gender: fhirclient.EnumCode(patient.GetGender().GetValue()),
 	}
-	return reference
-}
 
-func ParsePractitionerDisplay(display string) (string, string) {
-	idx := strings.Index(display, " - ")
-	if idx != -1 {
-		name := display[:idx]
-		specialization := display[idx+3:]
-		return name, specialization
+	if names := patient.GetName(); len(names) > 0 {
+		dto.LastName = names[0].GetFamily().GetValue()
+		if given := names[0].GetGiven(); len(given) > 0 {
+			dto.FirstName = given[0].GetValue()
+			if len(given) > 1 {
+				dto.MiddleName = given[1].GetValue()
+			}
+		}
 	}
-	return display, ""
-}
 
-func NormalizeStatus(status string) string {
-	status = strings.ToLower(status)
-	status = strings.ReplaceAll(status, "_", "-")
-	if status == "finished" {
-		return "completed"
+	if valueUs := patient.GetBirthDate().GetValueUs(); valueUs != 0 {
+		dto.BirthDate = time.UnixMicro(valueUs).UTC().Format("2006-01-02")
 	}
-	return status
+
+	return dto
 }
 
-// MapFHIRToEncounterDTO converts FHIR Encounter resource to EncounterDTO.
-func MapFHIRToEncounterDTO(fhirData interface{}) (*models.EncounterDTO, error) {
-	data, ok := fhirData.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid FHIR data format")
+// MapFHIRToDiagnosisDTO converts FHIR Condition resource to DiagnosisDTO.
+func MapFHIRToDiagnosisDTO(condition *condpb.Condition) *models.DiagnosisDTO {
+	dto := &models.DiagnosisDTO{
+		ID:                 condition.GetId().GetValue(),
+		VersionID:          condition.GetMeta().GetVersionId().GetValue(),
+		Code:               fhirclient.ConceptCode(condition.GetCode()),
+		Display:            fhirclient.ConceptText(condition.GetCode()),
+		ClinicalStatus:     fhirclient.ConceptCode(condition.GetClinicalStatus()),
+		VerificationStatus: fhirclient.ConceptCode(condition.GetVerificationStatus()),
+		PatientID:          fhirclient.ReferenceID(condition.GetSubject()),
+		EncounterID:        fhirclient.ReferenceID(condition.GetEncounter()),
+		RecorderID:         fhirclient.ReferenceID(condition.GetRecorder()),
+		RecordedAt:         fhirclient.FormatDateTime(condition.GetRecordedDate()),
+		ResolvedAt:         fhirclient.FormatDateTime(condition.GetAbatement().GetDateTime()),
 	}
+	dto.Final = dto.VerificationStatus == verificationConfirmed
 
-	dto := &models.EncounterDTO{}
-
-	if id, ok := data["id"].(map[string]interface{}); ok {
-		dto.ID = GetStringValue(id)
+	if notes := condition.GetNote(); len(notes) > 0 {
+		dto.Note = notes[0].GetText().GetValue()
 	}
 
-	if status, ok := data["status"].(map[string]interface{}); ok {
-		statusStr := GetStringValue(status)
-		dto.Status = NormalizeStatus(statusStr)
-	}
+	return dto
+}
 
-	if subject, ok := data["subject"].(map[string]interface{}); ok {
-		if display, ok := subject["display"].(map[string]interface{}); ok {
-			fullDisplay := GetStringValue(display)
-			dto.PatientGender = ExtractGenderFromDisplay(fullDisplay)
-			dto.PatientName = RemoveGenderFromDisplay(fullDisplay)
-		}
-		if reference, ok := subject["reference"].(map[string]interface{}); ok {
-			ref := GetStringValue(reference)
-			dto.PatientID = ExtractIDFromReference(ref)
-		}
-	}
+var markupPattern = regexp.MustCompile(`<[^>]*>`)
 
-	if participants, ok := data["participant"].([]interface{}); ok && len(participants) > 0 {
-		if participant, ok := participants[0].(map[string]interface{}); ok {
-			if individual, ok := participant["individual"].(map[string]interface{}); ok {
-				if display, ok := individual["display"].(map[string]interface{}); ok {
-					fullDisplay := GetStringValue(display)
-					dto.PractitionerName, dto.PractitionerSpecialization = ParsePractitionerDisplay(fullDisplay)
-				}
-				if reference, ok := individual["reference"].(map[string]interface{}); ok {
-					ref := GetStringValue(reference)
-					dto.PractitionerID = ExtractIDFromReference(ref)
-				}
-			}
-		}
-	}
+// narrativeText returns the plain text of a FHIR Narrative, dropping its XHTML markup.
+func narrativeText(narrative *dtpb.Narrative) string {
+	div := narrative.GetDiv().GetValue()
+	return strings.TrimSpace(html.UnescapeString(markupPattern.ReplaceAllString(div, "")))
+}
 
-	if period, ok := data["period"].(map[string]interface{}); ok {
-		if start, ok := period["start"].(map[string]interface{}); ok {
-			valueUs := GetInt64Value(start["valueUs"])
-			if valueUs > 0 {
-				millis := valueUs / 1000
-				t := time.UnixMilli(millis)
-				dto.CreatedAt = t.Format(time.RFC3339)
-			}
+// MapFHIRToNoteDTO converts FHIR Composition resource to NoteDTO. Sections are matched to the note fields by
+// their LOINC code.
+func MapFHIRToNoteDTO(composition *comppb.Composition) *models.NoteDTO {
+	dto := &models.NoteDTO{
+		ID:          composition.GetId().GetValue(),
+		VersionID:   composition.GetMeta().GetVersionId().GetValue(),
+		Status:      fhirclient.EnumCode(composition.GetStatus().GetValue()),
+		Title:       composition.GetTitle().GetValue(),
+		PatientID:   fhirclient.ReferenceID(composition.GetSubject()),
+		EncounterID: fhirclient.ReferenceID(composition.GetEncounter()),
+		UpdatedAt:   fhirclient.FormatDateTime(composition.GetDate()),
+	}
+
+	if authors := composition.GetAuthor(); len(authors) > 0 {
+		dto.AuthorID = fhirclient.ReferenceID(authors[0])
+	}
+
+	if attesters := composition.GetAttester(); len(attesters) > 0 {
+		dto.SignedAt = fhirclient.FormatDateTime(attesters[0].GetTime())
+	}
+
+	for _, section := range composition.GetSection() {
+		text := narrativeText(section.GetText())
+		switch fhirclient.ConceptCode(section.GetCode()) {
+		case loincComplaints:
+			dto.Complaints = text
+		case loincAnamnesis:
+			dto.Anamnesis = text
+		case loincExamination:
+			dto.Examination = text
+		case loincPlan:
+			dto.Plan = text
 		}
 	}
 
-	if dto.CreatedAt == "" {
-		dto.CreatedAt = time.Now().Format(time.RFC3339)
-	}
-
-	jsonBytes, _ := json.Marshal(dto)
-	log.Printf("Mapped FHIR to DTO: %s", string(jsonBytes))
-
-	return dto, nil
+	return dto
 }
 
-// MapFHIRToPractitionerDTO converts FHIR Practitioner resource to PractitionerDTO.
-func MapFHIRToPractitionerDTO(fhirData interface{}) (*models.PractitionerDTO, error) {
-	data, ok := fhirData.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid FHIR data format")
-	}
+// MapFHIRToPrescriptionDTO converts FHIR MedicationRequest resource to PrescriptionDTO, reading the dosage
+// from its first dosage instruction.
+func MapFHIRToPrescriptionDTO(request *mrpb.MedicationRequest) *models.PrescriptionDTO {
+	medication := request.GetMedication().GetCodeableConcept()
+	dto := &models.PrescriptionDTO{
+		ID:             request.GetId().GetValue(),
+		VersionID:      request.GetMeta().GetVersionId().GetValue(),
+		Status:         fhirclient.EnumCode(request.GetStatus().GetValue()),
+		PatientID:      fhirclient.ReferenceID(request.GetSubject()),
+		EncounterID:    fhirclient.ReferenceID(request.GetEncounter()),
+		RequesterID:    fhirclient.ReferenceID(request.GetRequester()),
+		MedicationCode: fhirclient.ConceptCode(medication),
+		MedicationName: fhirclient.ConceptText(medication),
+		AuthoredOn:     fhirclient.FormatDateTime(request.GetAuthoredOn()),
+	}
+
+	if dosages := request.GetDosageInstruction(); len(dosages) > 0 {
+		dosage := dosages[0]
+		dto.Dosage = dosage.GetText().GetValue()
+
+		if doses := dosage.GetDoseAndRate(); len(doses) > 0 {
+			quantity := doses[0].GetDose().GetQuantity()
+			dto.Dose = decimalValue(quantity.GetValue())
+			dto.DoseUnit = quantity.GetUnit().GetValue()
+		}
 
-	dto := &models.PractitionerDTO{
-		ID: GetStringValue(data["id"]),
-	}
+		repeat := dosage.GetTiming().GetRepeat()
+		dto.Frequency = int(repeat.GetFrequency().GetValue())
+		dto.Period = decimalValue(repeat.GetPeriod())
+		dto.PeriodUnit = fhirclient.EnumCode(repeat.GetPeriodUnit().GetValue())
 
-	if names, ok := data["name"].([]interface{}); ok && len(names) > 0 {
-		if name, ok := names[0].(map[string]interface{}); ok {
-			if family, ok := name["family"].(map[string]interface{}); ok {
-				dto.LastName = GetStringValue(family)
-			}
-			if given, ok := name["given"].([]interface{}); ok {
-				if len(given) > 0 {
-					if g, ok := given[0].(map[string]interface{}); ok {
-						dto.FirstName = GetStringValue(g)
-					}
-				}
-				if len(given) > 1 {
-					if g, ok := given[1].(map[string]interface{}); ok {
-						dto.MiddleName = GetStringValue(g)
-					}
-				}
-			}
-		}
+		duration := repeat.GetBounds().GetDuration()
+		dto.Duration = decimalValue(duration.GetValue())
+		dto.DurationUnit = duration.GetCode().GetValue()
 	}
 
-	if qualifications, ok := data["qualification"].([]interface{}); ok && len(qualifications) > 0 {
-		if q, ok := qualifications[0].(map[string]interface{}); ok {
-			if code, ok := q["code"].(map[string]interface{}); ok {
-				if text, ok := code["text"].(map[string]interface{}); ok {
-					dto.Specialization = GetStringValue(text)
-				}
-			}
-		}
+	if notes := request.GetNote(); len(notes) > 0 {
+		dto.Note = notes[0].GetText().GetValue()
 	}
 
-	return dto, nil
+	return dto
+}
+
+// decimalValue returns a FHIR decimal as a number, or 0 when it is absent.
+func decimalValue(value *dtpb.Decimal) float64 {
+	f, _ := strconv.ParseFloat(value.GetValue(), 64)
+	return f
 }
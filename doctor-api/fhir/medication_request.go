@@ -0,0 +1,173 @@
+package fhir
+
+import (
+	"context"
+	"doctor-api/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+
+	fhirclient "fhir-client"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	mrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/medication_request_go_proto"
+	vspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/valuesets_go_proto"
+)
+
+// ErrInvalidPrescription is returned when HIS rejects a prescription, e.g. for a medication missing from its
+// dictionary or a change to a prescription that was already stopped.
+var ErrInvalidPrescription = errors.New("invalid prescription")
+
+const (
+	systemMedication = "urn:hospital-srv:fhir:CodeSystem/medication"
+	systemUCUM       = "http://unitsofmeasure.org"
+)
+
+// PrescriptionInput holds what a doctor prescribes: Dose DoseUnit of a medication, taken Frequency times per
+// Period PeriodUnit, for Duration DurationUnit unless Duration is zero.
+type PrescriptionInput struct {
+	MedicationCode string
+	Dose           float64
+	DoseUnit       string
+	Frequency      int
+	Period         float64
+	PeriodUnit     string
+	Duration       float64
+	DurationUnit   string
+	Note           string
+}
+
+// GetPrescription loads a single prescription from HIS.
+func (c *FHIRClient) GetPrescription(ctx context.Context, prescriptionID string) (*models.PrescriptionDTO, error) {
+	var request mrpb.MedicationRequest
+	if _, err := c.client.Read(ctx, "MedicationRequest", prescriptionID, &request); err != nil {
+		return nil, err
+	}
+	return MapFHIRToPrescriptionDTO(&request), nil
+}
+
+// GetEncounterPrescriptions returns the prescriptions made in an encounter, newest first.
+func (c *FHIRClient) GetEncounterPrescriptions(ctx context.Context, encounterID string) ([]models.PrescriptionDTO, error) {
+	return c.searchPrescriptions(ctx, url.Values{"encounter": {"Encounter/" + encounterID}})
+}
+
+// GetPatientPrescriptions returns the prescriptions of a patient, newest first. When status is set only
+// prescriptions with that status are returned.
+func (c *FHIRClient) GetPatientPrescriptions(ctx context.Context, patientID string, status string) ([]models.PrescriptionDTO, error) {
+	query := url.Values{"patient": {"Patient/" + patientID}}
+	if status != "" {
+		query.Set("status", status)
+	}
+	return c.searchPrescriptions(ctx, query)
+}
+
+func (c *FHIRClient) searchPrescriptions(ctx context.Context, query url.Values) ([]models.PrescriptionDTO, error) {
+	entries, err := c.searchResources(ctx, "MedicationRequest", query, ErrInvalidPrescription)
+	if err != nil {
+		return nil, err
+	}
+
+	prescriptions := []models.PrescriptionDTO{}
+	for _, entry := range entries {
+		var request mrpb.MedicationRequest
+		if err := entry.Decode(&request); err != nil {
+			log.Printf("Failed to parse FHIR MedicationRequest: %v", err)
+			continue
+		}
+		prescriptions = append(prescriptions, *MapFHIRToPrescriptionDTO(&request))
+	}
+
+	return prescriptions, nil
+}
+
+// Prescribe records a prescription by practitionerID for patientID in an encounter. HIS passes it on to the
+// pharmacy; ErrConflict is returned if the patient already has an active prescription for the same drug.
+func (c *FHIRClient) Prescribe(ctx context.Context, patientID string, encounterID string, practitionerID string, input PrescriptionInput) (*models.PrescriptionDTO, error) {
+	periodUnit, ok := vspb.UnitsOfTimeValueSet_Value_value[strings.ToUpper(input.PeriodUnit)]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown period unit %q", ErrInvalidPrescription, input.PeriodUnit)
+	}
+
+	repeat := &dtpb.Timing_Repeat{
+		Frequency:  &dtpb.PositiveInt{Value: uint32(input.Frequency)},
+		Period:     decimal(input.Period),
+		PeriodUnit: &dtpb.Timing_Repeat_PeriodUnitCode{Value: vspb.UnitsOfTimeValueSet_Value(periodUnit)},
+	}
+	if input.Duration > 0 {
+		repeat.Bounds = &dtpb.Timing_Repeat_BoundsX{
+			Choice: &dtpb.Timing_Repeat_BoundsX_Duration{Duration: &dtpb.Duration{
+				Value:  decimal(input.Duration),
+				Unit:   &dtpb.String{Value: input.DurationUnit},
+				System: &dtpb.Uri{Value: systemUCUM},
+				Code:   &dtpb.Code{Value: input.DurationUnit},
+			}},
+		}
+	}
+
+	request := &mrpb.MedicationRequest{
+		Status: &mrpb.MedicationRequest_StatusCode{Value: codespb.MedicationrequestStatusCode_ACTIVE},
+		Intent: &mrpb.MedicationRequest_IntentCode{Value: codespb.MedicationRequestIntentCode_ORDER},
+		Medication: &mrpb.MedicationRequest_MedicationX{
+			Choice: &mrpb.MedicationRequest_MedicationX_CodeableConcept{
+				CodeableConcept: fhirclient.NewConcept(systemMedication, input.MedicationCode),
+			},
+		},
+		Subject:   fhirclient.Reference("Patient", patientID),
+		Encounter: fhirclient.Reference("Encounter", encounterID),
+		Requester: fhirclient.Reference("Practitioner", practitionerID),
+		DosageInstruction: []*dtpb.Dosage{
+			{
+				Timing: &dtpb.Timing{Repeat: repeat},
+				DoseAndRate: []*dtpb.Dosage_DoseAndRate{
+					{
+						Dose: &dtpb.Dosage_DoseAndRate_DoseX{
+							Choice: &dtpb.Dosage_DoseAndRate_DoseX_Quantity{Quantity: &dtpb.SimpleQuantity{
+								Value: decimal(input.Dose),
+								Unit:  &dtpb.String{Value: input.DoseUnit},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+	if input.Note != "" {
+		request.Note = []*dtpb.Annotation{{Text: &dtpb.Markdown{Value: input.Note}}}
+	}
+
+	log.Printf("Sending FHIR MedicationRequest to HIS: encounter=%s, medication=%s", encounterID, input.MedicationCode)
+
+	var created mrpb.MedicationRequest
+	if err := c.createResource(ctx, "MedicationRequest", request, &created, ErrInvalidPrescription); err != nil {
+		return nil, err
+	}
+
+	return MapFHIRToPrescriptionDTO(&created), nil
+}
+
+// StopPrescription stops an active prescription. When version is set it is sent as If-Match and
+// ErrVersionConflict is returned if the prescription has changed since.
+func (c *FHIRClient) StopPrescription(ctx context.Context, prescriptionID string, version string) (*models.PrescriptionDTO, error) {
+	var request mrpb.MedicationRequest
+	err := c.modifyResource(ctx, "MedicationRequest", prescriptionID, version, &request, ErrInvalidPrescription, func() {
+		request.Status = &mrpb.MedicationRequest_StatusCode{Value: codespb.MedicationrequestStatusCode_STOPPED}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return MapFHIRToPrescriptionDTO(&request), nil
+}
+
+// SearchMedications looks up medications in the HIS dictionary by code, ATC code or name.
+func (c *FHIRClient) SearchMedications(ctx context.Context, text string, count int) ([]models.CodeDTO, error) {
+	return c.expandCodes(ctx, systemMedication, text, count, ErrInvalidPrescription)
+}
+
+// decimal formats a number as a FHIR decimal, which HIS expects as a string.
+func decimal(v float64) *dtpb.Decimal {
+	return &dtpb.Decimal{Value: strconv.FormatFloat(v, 'f', -1, 64)}
+}
@@ -0,0 +1,95 @@
+package fhir
+
+import (
+	"context"
+	"doctor-api/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+
+	fhirclient "fhir-client"
+
+	vspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/value_set_go_proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// createResource posts a new resource to HIS and loads the created resource into created. A rejection by
+// HIS is reported as errInvalid.
+func (c *FHIRClient) createResource(ctx context.Context, resourceType string, resource proto.Message, created proto.Message, errInvalid error) error {
+	if _, err := c.client.Create(ctx, resourceType, resource, created); err != nil {
+		return rejected(err, errInvalid)
+	}
+	return nil
+}
+
+// modifyResource loads a resource into resource, lets change edit it and saves it back to HIS, leaving the
+// saved resource in resource. When version is set it is sent as If-Match, otherwise the version that was
+// loaded is; either way ErrVersionConflict is returned if the resource has changed in between.
+func (c *FHIRClient) modifyResource(ctx context.Context, resourceType string, id string, version string, resource proto.Message, errInvalid error, change func()) error {
+	result, err := c.client.Read(ctx, resourceType, id, resource)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		version = result.VersionID
+	}
+
+	change()
+
+	message := resource.ProtoReflect()
+	if meta := message.Descriptor().Fields().ByName("meta"); meta != nil {
+		message.Clear(meta)
+	}
+
+	if _, err := c.client.Update(ctx, resourceType, id, resource, resource, fhirclient.IfMatch(version)); err != nil {
+		return rejected(err, errInvalid)
+	}
+
+	log.Printf("Successfully updated %s %s", resourceType, id)
+	return nil
+}
+
+// searchResources returns the resources of resourceType matching query, leaving out those added by
+// _include. A search HIS rejects as invalid is reported as errInvalid.
+func (c *FHIRClient) searchResources(ctx context.Context, resourceType string, query url.Values, errInvalid error) ([]fhirclient.BundleEntry, error) {
+	bundle, err := c.client.SearchAll(ctx, resourceType, query)
+	if err != nil {
+		return nil, rejected(err, errInvalid)
+	}
+	return bundle.Matches(), nil
+}
+
+// rejected reports a request HIS refused as invalid as errRejected, keeping the reason HIS gave.
+func rejected(err error, errRejected error) error {
+	if errRejected != nil && errors.Is(err, fhirclient.ErrInvalid) {
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+	return err
+}
+
+// expandCodes looks up the codes of the code system at system whose code or display matches text, using the
+// ValueSet $expand operation of HIS.
+func (c *FHIRClient) expandCodes(ctx context.Context, system string, text string, count int, errInvalid error) ([]models.CodeDTO, error) {
+	query := url.Values{
+		"url":    {system},
+		"filter": {text},
+		"count":  {strconv.Itoa(count)},
+	}
+
+	var valueSet vspb.ValueSet
+	if _, err := c.client.Operation(ctx, "ValueSet/$expand", query, &valueSet); err != nil {
+		return nil, rejected(err, errInvalid)
+	}
+
+	codes := []models.CodeDTO{}
+	for _, contains := range valueSet.GetExpansion().GetContains() {
+		codes = append(codes, models.CodeDTO{
+			Code:    contains.GetCode().GetValue(),
+			Display: contains.GetDisplay().GetValue(),
+		})
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"doctor-api/fhir"
+	"doctor-api/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	fhirclient "fhir-client"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNotOwnEncounter is returned when a doctor tries to change the diagnoses of another doctor's encounter.
+var errNotOwnEncounter = errors.New("encounter belongs to another practitioner")
+
+type DiagnosisHandler struct {
+	fhirClient *fhir.FHIRClient
+}
+
+func NewDiagnosisHandler(fhirClient *fhir.FHIRClient) *DiagnosisHandler {
+	return &DiagnosisHandler{fhirClient: fhirClient}
+}
+
+type diagnosisRequest struct {
+	Code  string `json:"code" binding:"required"`
+	Note  string `json:"note"`
+	Final bool   `json:"final"`
+}
+
+func (r diagnosisRequest) input() fhir.DiagnosisInput {
+	return fhir.DiagnosisInput{
+		Code:  strings.ToUpper(strings.TrimSpace(r.Code)),
+		Note:  r.Note,
+		Final: r.Final,
+	}
+}
+
+// GetDiagnoses returns the diagnoses recorded in the encounter given by the encounter_id query parameter.
+func (h *DiagnosisHandler) GetDiagnoses(c *gin.Context) {
+	encounterID := c.Query("encounter_id")
+	if encounterID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "encounter_id is required"})
+		return
+	}
+
+	diagnoses, err := h.fhirClient.GetEncounterDiagnoses(c.Request.Context(), encounterID)
+	if err != nil {
+		writeDiagnosisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnoses)
+}
+
+// CreateDiagnosis adds a diagnosis to one of the practitioner's encounters.
+func (h *DiagnosisHandler) CreateDiagnosis(c *gin.Context) {
+	var req struct {
+		diagnosisRequest
+		EncounterID    string `json:"encounter_id" binding:"required"`
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	encounter, err := ownEncounter(c.Request.Context(), h.fhirClient, req.EncounterID, req.PractitionerID)
+	if err != nil {
+		writeDiagnosisError(c, err)
+		return
+	}
+
+	diagnosis, err := h.fhirClient.CreateDiagnosis(c.Request.Context(), encounter.PatientID, encounter.ID, req.PractitionerID, req.input())
+	if err != nil {
+		writeDiagnosisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, diagnosis)
+}
+
+// UpdateDiagnosis changes the code, note or finality of a diagnosis. If-Match guards against lost updates.
+func (h *DiagnosisHandler) UpdateDiagnosis(c *gin.Context) {
+	var req struct {
+		diagnosisRequest
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.checkDiagnosisOwner(c.Request.Context(), c.Param("id"), req.PractitionerID); err != nil {
+		writeDiagnosisError(c, err)
+		return
+	}
+
+	version := fhirclient.VersionFromETag(c.GetHeader("If-Match"))
+	diagnosis, err := h.fhirClient.UpdateDiagnosis(c.Request.Context(), c.Param("id"), req.input(), version)
+	if err != nil {
+		writeDiagnosisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnosis)
+}
+
+// ResolveDiagnosis marks a diagnosis resolved.
+func (h *DiagnosisHandler) ResolveDiagnosis(c *gin.Context) {
+	var req struct {
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.checkDiagnosisOwner(c.Request.Context(), c.Param("id"), req.PractitionerID); err != nil {
+		writeDiagnosisError(c, err)
+		return
+	}
+
+	version := fhirclient.VersionFromETag(c.GetHeader("If-Match"))
+	diagnosis, err := h.fhirClient.ResolveDiagnosis(c.Request.Context(), c.Param("id"), version)
+	if err != nil {
+		writeDiagnosisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnosis)
+}
+
+// SearchCodes looks up ICD-10 codes matching the q query parameter, for the diagnosis code picker.
+func (h *DiagnosisHandler) SearchCodes(c *gin.Context) {
+	count := 20
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count must be a positive number"})
+			return
+		}
+		count = n
+	}
+
+	codes, err := h.fhirClient.SearchCodes(c.Request.Context(), c.Query("q"), count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+func (h *DiagnosisHandler) checkDiagnosisOwner(ctx context.Context, diagnosisID string, practitionerID string) error {
+	diagnosis, err := h.fhirClient.GetDiagnosis(ctx, diagnosisID)
+	if err != nil {
+		return err
+	}
+	if diagnosis.EncounterID == "" {
+		return errNotOwnEncounter
+	}
+
+	_, err = ownEncounter(ctx, h.fhirClient, diagnosis.EncounterID, practitionerID)
+	return err
+}
+
+// ownEncounter loads the encounter and checks that practitionerID is its practitioner.
+func ownEncounter(ctx context.Context, fhirClient *fhir.FHIRClient, encounterID string, practitionerID string) (*models.EncounterDTO, error) {
+	encounter, err := fhirClient.GetEncounter(ctx, encounterID)
+	if err != nil {
+		return nil, err
+	}
+	if encounter.PractitionerID != practitionerID {
+		return nil, errNotOwnEncounter
+	}
+	return encounter, nil
+}
+
+func writeDiagnosisError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, fhir.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errNotOwnEncounter):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, fhir.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, fhir.ErrInvalidDiagnosis):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
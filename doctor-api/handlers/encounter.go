@@ -2,9 +2,14 @@ package handlers
 
 import (
 	"doctor-api/fhir"
+	"doctor-api/models"
 	"doctor-api/websocket"
+	"errors"
+	"log"
 	"net/http"
 
+	fhirclient "fhir-client"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -27,7 +32,7 @@ func (h *EncounterHandler) GetEncountersByPractitioner(c *gin.Context) {
 		return
 	}
 
-	encounters, err := h.fhirClient.GetEncountersByPractitioner(practitionerID)
+	encounters, err := h.fhirClient.GetEncountersByPractitioner(c.Request.Context(), practitionerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -40,7 +45,9 @@ func (h *EncounterHandler) UpdateEncounterStatus(c *gin.Context) {
 	encounterID := c.Param("id")
 
 	var req struct {
-		Status string `json:"status" binding:"required"`
+		Status         string            `json:"status" binding:"required"`
+		PractitionerID string            `json:"practitioner_id"`
+		FinalDiagnosis *diagnosisRequest `json:"final_diagnosis"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -48,10 +55,61 @@ func (h *EncounterHandler) UpdateEncounterStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.fhirClient.UpdateEncounterStatus(encounterID, req.Status); err != nil {
+	version := fhirclient.VersionFromETag(c.GetHeader("If-Match"))
+
+	// The doctor UI works on behalf of one practitioner; without it the change is attributed to doctor-api.
+	actor := "doctor-api"
+	if req.PractitionerID != "" {
+		actor = "Practitioner/" + req.PractitionerID
+	}
+
+	// A final diagnosis can be given when completing the encounter; it is recorded before the status changes,
+	// so a rejected diagnosis leaves the encounter open. If the status change then fails, the diagnosis is
+	// discarded again, so a retry does not leave two final diagnoses behind.
+	var diagnosis *models.DiagnosisDTO
+	if req.FinalDiagnosis != nil {
+		if fhirclient.EncounterStatusCode(req.Status) != "finished" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "final_diagnosis is only allowed when completing an encounter"})
+			return
+		}
+		if req.PractitionerID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "practitioner_id is required with final_diagnosis"})
+			return
+		}
+
+		encounter, err := ownEncounter(c.Request.Context(), h.fhirClient, encounterID, req.PractitionerID)
+		if err != nil {
+			writeDiagnosisError(c, err)
+			return
+		}
+
+		input := req.FinalDiagnosis.input()
+		input.Final = true
+		diagnosis, err = h.fhirClient.CreateDiagnosis(c.Request.Context(), encounter.PatientID, encounterID, req.PractitionerID, input)
+		if err != nil {
+			writeDiagnosisError(c, err)
+			return
+		}
+	}
+
+	newVersion, err := h.fhirClient.UpdateEncounterStatus(c.Request.Context(), encounterID, req.Status, version, actor)
+	if err != nil {
+		if diagnosis != nil {
+			if discardErr := h.fhirClient.DiscardDiagnosis(c.Request.Context(), diagnosis.ID); discardErr != nil {
+				log.Printf("Failed to discard final diagnosis %s of encounter %s: %v", diagnosis.ID, encounterID, discardErr)
+			}
+		}
+		if errors.Is(err, fhir.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, fhir.ErrStatusTransition) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully", "versionId": newVersion})
 }
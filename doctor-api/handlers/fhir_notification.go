@@ -1,24 +1,27 @@
 package handlers
 
 import (
-	"doctor-api/fhir"
 	"doctor-api/websocket"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
+	"signature"
+
+	fhirclient "fhir-client"
 
 	"github.com/gin-gonic/gin"
 )
 
 // FHIRNotificationHandler handles FHIR notifications from HIS.
 type FHIRNotificationHandler struct {
-	hub *websocket.Hub
+	hub      *websocket.Hub
+	verifier *signature.Verifier
 }
 
 // NewFHIRNotificationHandler creates a new FHIR notification handler.
-func NewFHIRNotificationHandler(hub *websocket.Hub) *FHIRNotificationHandler {
-	return &FHIRNotificationHandler{hub: hub}
+func NewFHIRNotificationHandler(hub *websocket.Hub, verifier *signature.Verifier) *FHIRNotificationHandler {
+	return &FHIRNotificationHandler{hub: hub, verifier: verifier}
 }
 
 // HandleEncounterNotification processes encounter notifications and broadcasts to connected clients.
@@ -30,35 +33,45 @@ func (h *FHIRNotificationHandler) HandleEncounterNotification(c *gin.Context) {
 		return
 	}
 
+	if err := h.verifier.Verify(c.Request.Header, body); err != nil {
+		log.Printf("Rejected FHIR notification: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
 	log.Printf("Received FHIR Encounter notification from HIS: %s", string(body))
 
-	var notification map[string]interface{}
+	var notification struct {
+		Type     string                   `json:"type"`
+		Data     json.RawMessage          `json:"data"`
+		Included []fhirclient.BundleEntry `json:"included"`
+	}
 	if err := json.Unmarshal(body, &notification); err != nil {
 		log.Printf("Error parsing FHIR notification: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
 		return
 	}
 
-	eventType, ok := notification["type"].(string)
-	if !ok {
+	eventType := notification.Type
+	if eventType == "" {
 		log.Printf("Missing or invalid notification type")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing notification type"})
 		return
 	}
 
-	encounterData, ok := notification["data"]
-	if !ok {
+	if notification.Data == nil {
 		log.Printf("Missing notification data")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing notification data"})
 		return
 	}
 
-	dto, err := fhir.MapFHIRToEncounterDTO(encounterData)
+	encounter, err := fhirclient.ParseEncounter(notification.Data)
 	if err != nil {
 		log.Printf("Error mapping FHIR to DTO: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to map FHIR data"})
 		return
 	}
+	dto := fhirclient.SummarizeEncounter(encounter, fhirclient.Index(notification.Included))
 
 	switch eventType {
 	case "encounter_created":
@@ -75,6 +88,13 @@ func (h *FHIRNotificationHandler) HandleEncounterNotification(c *gin.Context) {
 		})
 		log.Printf("Broadcasted encounter_status_updated event to Doctor.UI clients")
 
+	case "encounter_updated":
+		h.hub.Broadcast(websocket.Message{
+			Type: "encounter_updated",
+			Data: dto,
+		})
+		log.Printf("Broadcasted encounter_updated event to Doctor.UI clients")
+
 	default:
 		log.Printf("Unknown notification type: %s", eventType)
 	}
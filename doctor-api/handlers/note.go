@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"doctor-api/fhir"
+	"doctor-api/models"
+	"doctor-api/websocket"
+	"errors"
+	"net/http"
+
+	fhirclient "fhir-client"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNotAuthor is returned when a doctor tries to change a note written by someone else.
+var errNotAuthor = errors.New("note was written by another practitioner")
+
+type NoteHandler struct {
+	fhirClient *fhir.FHIRClient
+	hub        *websocket.Hub
+}
+
+func NewNoteHandler(fhirClient *fhir.FHIRClient, hub *websocket.Hub) *NoteHandler {
+	return &NoteHandler{
+		fhirClient: fhirClient,
+		hub:        hub,
+	}
+}
+
+type noteRequest struct {
+	Title       string `json:"title"`
+	Complaints  string `json:"complaints"`
+	Anamnesis   string `json:"anamnesis"`
+	Examination string `json:"examination"`
+	Plan        string `json:"plan"`
+}
+
+func (r noteRequest) input() fhir.NoteInput {
+	return fhir.NoteInput{
+		Title:       r.Title,
+		Complaints:  r.Complaints,
+		Anamnesis:   r.Anamnesis,
+		Examination: r.Examination,
+		Plan:        r.Plan,
+	}
+}
+
+// GetNotes returns the notes written for the encounter given by the encounter_id query parameter.
+func (h *NoteHandler) GetNotes(c *gin.Context) {
+	encounterID := c.Query("encounter_id")
+	if encounterID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "encounter_id is required"})
+		return
+	}
+
+	notes, err := h.fhirClient.GetEncounterNotes(c.Request.Context(), encounterID)
+	if err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
+
+// CreateNote writes a note for one of the practitioner's encounters, as a draft unless sign is set.
+func (h *NoteHandler) CreateNote(c *gin.Context) {
+	var req struct {
+		noteRequest
+		EncounterID    string `json:"encounter_id" binding:"required"`
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+		Sign           bool   `json:"sign"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := ownEncounter(c.Request.Context(), h.fhirClient, req.EncounterID, req.PractitionerID); err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	note, err := h.fhirClient.CreateNote(c.Request.Context(), req.EncounterID, req.PractitionerID, req.input(), req.Sign)
+	if err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	h.broadcast("note_created", note)
+	c.JSON(http.StatusCreated, note)
+}
+
+// UpdateNote replaces the text of a draft. If-Match guards against lost updates.
+func (h *NoteHandler) UpdateNote(c *gin.Context) {
+	var req struct {
+		noteRequest
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.checkAuthor(c.Request.Context(), c.Param("id"), req.PractitionerID); err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	note, err := h.fhirClient.UpdateNote(c.Request.Context(), c.Param("id"), req.input(), fhirclient.VersionFromETag(c.GetHeader("If-Match")))
+	if err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	h.broadcast("note_updated", note)
+	c.JSON(http.StatusOK, note)
+}
+
+// SignNote signs a draft.
+func (h *NoteHandler) SignNote(c *gin.Context) {
+	var req struct {
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.checkAuthor(c.Request.Context(), c.Param("id"), req.PractitionerID); err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	note, err := h.fhirClient.SignNote(c.Request.Context(), c.Param("id"), fhirclient.VersionFromETag(c.GetHeader("If-Match")))
+	if err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	h.broadcast("note_signed", note)
+	c.JSON(http.StatusOK, note)
+}
+
+// AmendNote replaces the text of a signed note.
+func (h *NoteHandler) AmendNote(c *gin.Context) {
+	var req struct {
+		noteRequest
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.checkAuthor(c.Request.Context(), c.Param("id"), req.PractitionerID); err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	note, err := h.fhirClient.AmendNote(c.Request.Context(), c.Param("id"), req.input(), fhirclient.VersionFromETag(c.GetHeader("If-Match")))
+	if err != nil {
+		writeNoteError(c, err)
+		return
+	}
+
+	h.broadcast("note_amended", note)
+	c.JSON(http.StatusOK, note)
+}
+
+func (h *NoteHandler) checkAuthor(ctx context.Context, noteID string, practitionerID string) error {
+	note, err := h.fhirClient.GetNote(ctx, noteID)
+	if err != nil {
+		return err
+	}
+	if note.AuthorID != practitionerID {
+		return errNotAuthor
+	}
+	return nil
+}
+
+// broadcast pushes a note change to the connected Doctor.UI clients.
+func (h *NoteHandler) broadcast(eventType string, note *models.NoteDTO) {
+	h.hub.Broadcast(websocket.Message{
+		Type: eventType,
+		Data: note,
+	})
+}
+
+func writeNoteError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, fhir.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errNotOwnEncounter), errors.Is(err, errNotAuthor):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, fhir.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, fhir.ErrInvalidNote):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"doctor-api/fhir"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PatientHandler struct {
+	fhirClient *fhir.FHIRClient
+}
+
+func NewPatientHandler(fhirClient *fhir.FHIRClient) *PatientHandler {
+	return &PatientHandler{fhirClient: fhirClient}
+}
+
+// GetPatientChart returns the patient together with their encounters, practitioners, diagnoses and notes.
+// Optional start and end query parameters limit the encounters to a period.
+func (h *PatientHandler) GetPatientChart(c *gin.Context) {
+	chart, err := h.fhirClient.GetPatientChart(c.Request.Context(), c.Param("id"), c.Query("start"), c.Query("end"))
+	if err != nil {
+		if errors.Is(err, fhir.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, chart)
+}
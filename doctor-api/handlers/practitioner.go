@@ -16,7 +16,7 @@ func NewPractitionerHandler(fhirClient *fhir.FHIRClient) *PractitionerHandler {
 }
 
 func (h *PractitionerHandler) GetAllPractitioners(c *gin.Context) {
-	practitioners, err := h.fhirClient.GetPractitioners()
+	practitioners, err := h.fhirClient.GetPractitioners(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"doctor-api/fhir"
+	"doctor-api/models"
+	"doctor-api/websocket"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	fhirclient "fhir-client"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errNotPrescriber is returned when a doctor tries to stop a prescription made by someone else.
+var errNotPrescriber = errors.New("prescription was made by another practitioner")
+
+type PrescriptionHandler struct {
+	fhirClient *fhir.FHIRClient
+	hub        *websocket.Hub
+}
+
+func NewPrescriptionHandler(fhirClient *fhir.FHIRClient, hub *websocket.Hub) *PrescriptionHandler {
+	return &PrescriptionHandler{
+		fhirClient: fhirClient,
+		hub:        hub,
+	}
+}
+
+// GetPrescriptions returns the prescriptions made in the encounter given by the encounter_id query parameter,
+// or those of the patient given by patient_id, optionally filtered by status.
+func (h *PrescriptionHandler) GetPrescriptions(c *gin.Context) {
+	var prescriptions []models.PrescriptionDTO
+	var err error
+
+	switch {
+	case c.Query("encounter_id") != "":
+		prescriptions, err = h.fhirClient.GetEncounterPrescriptions(c.Request.Context(), c.Query("encounter_id"))
+	case c.Query("patient_id") != "":
+		prescriptions, err = h.fhirClient.GetPatientPrescriptions(c.Request.Context(), c.Query("patient_id"), c.Query("status"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "encounter_id or patient_id is required"})
+		return
+	}
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, prescriptions)
+}
+
+// Prescribe prescribes a medication in one of the practitioner's encounters.
+func (h *PrescriptionHandler) Prescribe(c *gin.Context) {
+	var req struct {
+		EncounterID    string  `json:"encounter_id" binding:"required"`
+		PractitionerID string  `json:"practitioner_id" binding:"required"`
+		MedicationCode string  `json:"medication_code" binding:"required"`
+		Dose           float64 `json:"dose" binding:"required,gt=0"`
+		DoseUnit       string  `json:"dose_unit" binding:"required"`
+		Frequency      int     `json:"frequency" binding:"required,min=1"`
+		Period         float64 `json:"period" binding:"required,gt=0"`
+		PeriodUnit     string  `json:"period_unit" binding:"required,oneof=h d wk"`
+		Duration       float64 `json:"duration" binding:"omitempty,gt=0"`
+		DurationUnit   string  `json:"duration_unit" binding:"required_with=Duration,omitempty,oneof=d wk mo"`
+		Note           string  `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	encounter, err := ownEncounter(c.Request.Context(), h.fhirClient, req.EncounterID, req.PractitionerID)
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+
+	prescription, err := h.fhirClient.Prescribe(c.Request.Context(), encounter.PatientID, encounter.ID, req.PractitionerID, fhir.PrescriptionInput{
+		MedicationCode: strings.ToUpper(strings.TrimSpace(req.MedicationCode)),
+		Dose:           req.Dose,
+		DoseUnit:       req.DoseUnit,
+		Frequency:      req.Frequency,
+		Period:         req.Period,
+		PeriodUnit:     req.PeriodUnit,
+		Duration:       req.Duration,
+		DurationUnit:   req.DurationUnit,
+		Note:           req.Note,
+	})
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+
+	h.broadcast("prescription_created", prescription)
+	c.JSON(http.StatusCreated, prescription)
+}
+
+// StopPrescription stops one of the practitioner's prescriptions. If-Match guards against lost updates.
+func (h *PrescriptionHandler) StopPrescription(c *gin.Context) {
+	var req struct {
+		PractitionerID string `json:"practitioner_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, err := h.fhirClient.GetPrescription(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+	if current.RequesterID != req.PractitionerID {
+		writePrescriptionError(c, errNotPrescriber)
+		return
+	}
+
+	prescription, err := h.fhirClient.StopPrescription(c.Request.Context(), c.Param("id"), fhirclient.VersionFromETag(c.GetHeader("If-Match")))
+	if err != nil {
+		writePrescriptionError(c, err)
+		return
+	}
+
+	h.broadcast("prescription_stopped", prescription)
+	c.JSON(http.StatusOK, prescription)
+}
+
+// SearchMedications looks up medications matching the q query parameter, for the medication picker.
+func (h *PrescriptionHandler) SearchMedications(c *gin.Context) {
+	count := 20
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "count must be a positive number"})
+			return
+		}
+		count = n
+	}
+
+	medications, err := h.fhirClient.SearchMedications(c.Request.Context(), c.Query("q"), count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, medications)
+}
+
+// broadcast pushes a prescription change to the connected Doctor.UI clients.
+func (h *PrescriptionHandler) broadcast(eventType string, prescription *models.PrescriptionDTO) {
+	h.hub.Broadcast(websocket.Message{
+		Type: eventType,
+		Data: prescription,
+	})
+}
+
+func writePrescriptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, fhir.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errNotOwnEncounter), errors.Is(err, errNotPrescriber):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, fhir.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, fhir.ErrVersionConflict):
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+	case errors.Is(err, fhir.ErrInvalidPrescription):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"doctor-api/config"
 	"doctor-api/fhir"
 	"doctor-api/handlers"
@@ -8,6 +9,8 @@ import (
 	"doctor-api/websocket"
 	"fmt"
 	"log"
+	"signature"
+	"time"
 )
 
 func main() {
@@ -23,9 +26,15 @@ func main() {
 
 	encounterHandler := handlers.NewEncounterHandler(fhirClient, hub)
 	practitionerHandler := handlers.NewPractitionerHandler(fhirClient)
-	fhirNotificationHandler := handlers.NewFHIRNotificationHandler(hub)
+	patientHandler := handlers.NewPatientHandler(fhirClient)
+	diagnosisHandler := handlers.NewDiagnosisHandler(fhirClient)
+	noteHandler := handlers.NewNoteHandler(fhirClient, hub)
+	prescriptionHandler := handlers.NewPrescriptionHandler(fhirClient, hub)
+	fhirNotificationHandler := handlers.NewFHIRNotificationHandler(hub, signature.NewVerifier(cfg.NotificationSecret, 5*time.Minute))
 
-	r := router.Setup(encounterHandler, practitionerHandler, fhirNotificationHandler, hub)
+	go registerSubscription(fhirClient, cfg.SubscriptionCriteria, cfg.PublicURL+"/fhir/notifications/encounter")
+
+	r := router.Setup(encounterHandler, practitionerHandler, patientHandler, diagnosisHandler, noteHandler, prescriptionHandler, fhirNotificationHandler, hub)
 
 	serverAddr := fmt.Sprintf(":%s", cfg.ServerPort)
 	log.Printf("Starting Doctor API server on %s", serverAddr)
@@ -33,3 +42,21 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// registerSubscription keeps retrying until HIS accepts the subscription, since HIS may still be starting.
+func registerSubscription(fhirClient *fhir.FHIRClient, criteria string, endpoint string) {
+	delay := time.Second
+	for {
+		id, err := fhirClient.RegisterSubscription(context.Background(), criteria, endpoint)
+		if err == nil {
+			log.Printf("Registered FHIR subscription %s: criteria=%s, endpoint=%s", id, criteria, endpoint)
+			return
+		}
+
+		log.Printf("Failed to register FHIR subscription, retrying in %s: %v", delay, err)
+		time.Sleep(delay)
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
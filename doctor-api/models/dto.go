@@ -1,17 +1,9 @@
 package models
 
+import fhirclient "fhir-client"
+
 // EncounterDTO represents encounter data for client applications.
-type EncounterDTO struct {
-	ID                         string `json:"id"`
-	PatientID                  string `json:"patientId"`
-	PatientName                string `json:"patientName"`
-	PatientGender              string `json:"patientGender"`
-	PractitionerID             string `json:"practitionerId"`
-	PractitionerName           string `json:"practitionerName"`
-	PractitionerSpecialization string `json:"practitionerSpecialization"`
-	Status                     string `json:"status"`
-	CreatedAt                  string `json:"createdAt"`
-}
+type EncounterDTO = fhirclient.EncounterSummary
 
 // PractitionerDTO represents practitioner data for client applications.
 type PractitionerDTO struct {
@@ -21,3 +13,89 @@ type PractitionerDTO struct {
 	LastName       string `json:"lastName"`
 	Specialization string `json:"specialization"`
 }
+
+// PatientDTO represents patient data for client applications.
+type PatientDTO struct {
+	ID         string `json:"id"`
+	FirstName  string `json:"firstName"`
+	MiddleName string `json:"middleName,omitempty"`
+	LastName   string `json:"lastName"`
+	Gender     string `json:"gender,omitempty"`
+	BirthDate  string `json:"birthDate,omitempty"`
+}
+
+// DiagnosisDTO represents a diagnosis (FHIR Condition) for client applications. A final diagnosis is one whose
+// verification status is confirmed.
+type DiagnosisDTO struct {
+	ID                 string `json:"id"`
+	PatientID          string `json:"patientId"`
+	EncounterID        string `json:"encounterId,omitempty"`
+	RecorderID         string `json:"recorderId,omitempty"`
+	Code               string `json:"code"`
+	Display            string `json:"display"`
+	Note               string `json:"note,omitempty"`
+	ClinicalStatus     string `json:"clinicalStatus"`
+	VerificationStatus string `json:"verificationStatus"`
+	Final              bool   `json:"final"`
+	RecordedAt         string `json:"recordedAt,omitempty"`
+	ResolvedAt         string `json:"resolvedAt,omitempty"`
+	VersionID          string `json:"versionId"`
+}
+
+// CodeDTO represents an ICD-10 or medication code for client applications.
+type CodeDTO struct {
+	Code    string `json:"code"`
+	Display string `json:"display"`
+}
+
+// PrescriptionDTO represents a prescription (FHIR MedicationRequest) for client applications: Dose DoseUnit
+// taken Frequency times per Period PeriodUnit, for Duration DurationUnit when one is set. Units are UCUM
+// codes (h, d, wk, mo).
+type PrescriptionDTO struct {
+	ID             string  `json:"id"`
+	PatientID      string  `json:"patientId"`
+	EncounterID    string  `json:"encounterId,omitempty"`
+	RequesterID    string  `json:"requesterId"`
+	MedicationCode string  `json:"medicationCode"`
+	MedicationName string  `json:"medicationName"`
+	Status         string  `json:"status"`
+	Dose           float64 `json:"dose"`
+	DoseUnit       string  `json:"doseUnit"`
+	Frequency      int     `json:"frequency"`
+	Period         float64 `json:"period"`
+	PeriodUnit     string  `json:"periodUnit"`
+	Duration       float64 `json:"duration,omitempty"`
+	DurationUnit   string  `json:"durationUnit,omitempty"`
+	Dosage         string  `json:"dosage"`
+	Note           string  `json:"note,omitempty"`
+	AuthoredOn     string  `json:"authoredOn,omitempty"`
+	VersionID      string  `json:"versionId"`
+}
+
+// NoteDTO represents a clinical visit note (FHIR Composition) for client applications. Status is preliminary
+// for a draft, final once signed and amended after an amendment.
+type NoteDTO struct {
+	ID          string `json:"id"`
+	EncounterID string `json:"encounterId"`
+	PatientID   string `json:"patientId"`
+	AuthorID    string `json:"authorId"`
+	Status      string `json:"status"`
+	Title       string `json:"title"`
+	Complaints  string `json:"complaints"`
+	Anamnesis   string `json:"anamnesis"`
+	Examination string `json:"examination"`
+	Plan        string `json:"plan"`
+	SignedAt    string `json:"signedAt,omitempty"`
+	UpdatedAt   string `json:"updatedAt,omitempty"`
+	VersionID   string `json:"versionId"`
+}
+
+// PatientChartDTO collects everything HIS knows about a patient.
+type PatientChartDTO struct {
+	Patient       PatientDTO        `json:"patient"`
+	Encounters    []EncounterDTO    `json:"encounters"`
+	Practitioners []PractitionerDTO `json:"practitioners"`
+	Diagnoses     []DiagnosisDTO    `json:"diagnoses"`
+	Notes         []NoteDTO         `json:"notes"`
+	Prescriptions []PrescriptionDTO `json:"prescriptions"`
+}
@@ -7,13 +7,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func Setup(encounterHandler *handlers.EncounterHandler, practitionerHandler *handlers.PractitionerHandler, fhirNotificationHandler *handlers.FHIRNotificationHandler, hub *websocket.Hub) *gin.Engine {
+func Setup(encounterHandler *handlers.EncounterHandler, practitionerHandler *handlers.PractitionerHandler, patientHandler *handlers.PatientHandler, diagnosisHandler *handlers.DiagnosisHandler, noteHandler *handlers.NoteHandler, prescriptionHandler *handlers.PrescriptionHandler, fhirNotificationHandler *handlers.FHIRNotificationHandler, hub *websocket.Hub) *gin.Engine {
 	router := gin.Default()
 
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 
 		if c.Request.Method == "OPTIONS" {
@@ -36,8 +36,23 @@ func Setup(encounterHandler *handlers.EncounterHandler, practitionerHandler *han
 	api := router.Group("/api")
 	{
 		api.GET("/practitioners", practitionerHandler.GetAllPractitioners)
+		api.GET("/patients/:id/chart", patientHandler.GetPatientChart)
 		api.GET("/encounters/:practitioner_id", encounterHandler.GetEncountersByPractitioner)
 		api.PATCH("/encounters/:id", encounterHandler.UpdateEncounterStatus)
+		api.GET("/diagnoses", diagnosisHandler.GetDiagnoses)
+		api.POST("/diagnoses", diagnosisHandler.CreateDiagnosis)
+		api.PUT("/diagnoses/:id", diagnosisHandler.UpdateDiagnosis)
+		api.POST("/diagnoses/:id/resolve", diagnosisHandler.ResolveDiagnosis)
+		api.GET("/icd10", diagnosisHandler.SearchCodes)
+		api.GET("/notes", noteHandler.GetNotes)
+		api.POST("/notes", noteHandler.CreateNote)
+		api.PUT("/notes/:id", noteHandler.UpdateNote)
+		api.POST("/notes/:id/sign", noteHandler.SignNote)
+		api.POST("/notes/:id/amend", noteHandler.AmendNote)
+		api.GET("/prescriptions", prescriptionHandler.GetPrescriptions)
+		api.POST("/prescriptions", prescriptionHandler.Prescribe)
+		api.POST("/prescriptions/:id/stop", prescriptionHandler.StopPrescription)
+		api.GET("/medications", prescriptionHandler.SearchMedications)
 	}
 
 	return router
@@ -27,9 +27,10 @@ export async function getEncountersByPractitioner(practitionerId) {
   return request(`/encounters/${practitionerId}`);
 }
 
-export async function updateEncounterStatus(encounterId, status) {
+export async function updateEncounterStatus(encounterId, status, versionId, practitionerId) {
   return request(`/encounters/${encounterId}`, {
     method: 'PATCH',
-    body: JSON.stringify({ status })
+    headers: versionId ? { 'If-Match': `W/"${versionId}"` } : {},
+    body: JSON.stringify({ status, practitioner_id: practitionerId })
   });
 }
@@ -0,0 +1,147 @@
+package fhirclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Bundle is a FHIR Bundle. Its entries carry their resources in protojson form until Decode is called,
+// since a resource's type is only known from the entry's fullUrl.
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        *int          `json:"total,omitempty"`
+	Links        []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullURL  string          `json:"fullUrl,omitempty"`
+	Resource json.RawMessage `json:"resource,omitempty"`
+	Search   *EntrySearch    `json:"search,omitempty"`
+	Request  *EntryRequest   `json:"request,omitempty"`
+	Response *EntryResponse  `json:"response,omitempty"`
+}
+
+// EntrySearch tells whether a searchset entry is a match or was added by _include.
+type EntrySearch struct {
+	Mode string `json:"mode,omitempty"`
+}
+
+type EntryRequest struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	IfMatch     string `json:"ifMatch,omitempty"`
+	IfNoneExist string `json:"ifNoneExist,omitempty"`
+}
+
+// EntryResponse is the outcome of one entry of a transaction or batch. Location is of the form
+// "Encounter/123/_history/1".
+type EntryResponse struct {
+	Status       string            `json:"status"`
+	Location     string            `json:"location,omitempty"`
+	Etag         string            `json:"etag,omitempty"`
+	LastModified string            `json:"lastModified,omitempty"`
+	Outcome      *OperationOutcome `json:"outcome,omitempty"`
+}
+
+// NewTransaction returns an empty transaction Bundle, whose entries either all succeed or all fail.
+func NewTransaction() *Bundle {
+	return &Bundle{ResourceType: "Bundle", Type: "transaction"}
+}
+
+// AddRequest appends an entry that sends resource with method to url, e.g. POST to "Encounter".
+func (b *Bundle) AddRequest(method string, url string, resource proto.Message) error {
+	entry := BundleEntry{Request: &EntryRequest{Method: method, URL: url}}
+	if resource != nil {
+		body, err := Marshal(resource)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", url, err)
+		}
+		entry.Resource = body
+	}
+
+	b.Entry = append(b.Entry, entry)
+	return nil
+}
+
+// AddConditionalCreate appends an entry that creates resource at url unless a resource matches criteria, as
+// IfNoneExist does for a single create. The matching resource is returned in its place.
+func (b *Bundle) AddConditionalCreate(url string, resource proto.Message, criteria string) error {
+	if err := b.AddRequest(http.MethodPost, url, resource); err != nil {
+		return err
+	}
+	b.Entry[len(b.Entry)-1].Request.IfNoneExist = criteria
+	return nil
+}
+
+// Link returns the URL of the link with relation, e.g. "next", or "" when there is none.
+func (b *Bundle) Link(relation string) string {
+	for _, l := range b.Links {
+		if l.Relation == relation {
+			return l.URL
+		}
+	}
+	return ""
+}
+
+// Matches returns the entries that matched a search, leaving out the resources added by _include.
+func (b *Bundle) Matches() []BundleEntry {
+	var matches []BundleEntry
+	for _, e := range b.Entry {
+		if e.Search == nil || e.Search.Mode != "include" {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
+// Index indexes entries by their fullUrl ("Patient/123") so that references can be resolved to the
+// resources returned alongside them by _include.
+func Index(entries []BundleEntry) map[string]BundleEntry {
+	index := make(map[string]BundleEntry, len(entries))
+	for _, e := range entries {
+		if e.FullURL != "" && e.Resource != nil {
+			index[e.FullURL] = e
+		}
+	}
+	return index
+}
+
+// ResourceType returns the type of the entry's resource, read from its fullUrl or response location.
+func (e BundleEntry) ResourceType() string {
+	resourceType, _ := SplitReference(e.reference())
+	return resourceType
+}
+
+// ID returns the id of the entry's resource, read from its fullUrl or response location.
+func (e BundleEntry) ID() string {
+	_, id := SplitReference(e.reference())
+	return id
+}
+
+func (e BundleEntry) reference() string {
+	if e.FullURL != "" {
+		return e.FullURL
+	}
+	if e.Response != nil {
+		return e.Response.Location
+	}
+	return ""
+}
+
+// Decode unmarshals the entry's resource into resource.
+func (e BundleEntry) Decode(resource proto.Message) error {
+	if e.Resource == nil {
+		return fmt.Errorf("bundle entry %s has no resource", e.FullURL)
+	}
+	return Unmarshal(e.Resource, resource)
+}
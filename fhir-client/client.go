@@ -0,0 +1,366 @@
+// Package fhirclient is a typed client for the FHIR R4 REST API of HIS. Resources are exchanged as the
+// google/fhir protos in their protojson form, the format HIS reads and writes.
+package fhirclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	paramspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// contentTypeJSON is the protojson the server reads and writes, as opposed to the FHIR JSON it serves
+	// as application/fhir+json.
+	contentTypeJSON      = "application/json"
+	contentTypeJSONPatch = "application/json-patch+json"
+
+	headerActor = "X-HIS-Actor"
+
+	defaultTimeout = 30 * time.Second
+)
+
+// Config configures a Client.
+type Config struct {
+	// BaseURL is the FHIR base of the server, e.g. https://hospital-srv:9090/fhir.
+	BaseURL string
+
+	// CertPath is a PEM certificate trusted for the server's TLS certificate. The system roots are used when
+	// it is empty.
+	CertPath string
+
+	// Timeout bounds every request including reading its response, 30 seconds when zero. A deadline on the
+	// request context applies as well.
+	Timeout time.Duration
+}
+
+// Client calls a FHIR server.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// New creates a client for the server described by cfg.
+func New(cfg Config) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(cfg.BaseURL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CertPath != "" {
+		cert, err := os.ReadFile(cfg.CertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate: %w", err)
+		}
+
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("failed to append certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Client{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+	}, nil
+}
+
+// RequestOption sets headers on a request.
+type RequestOption func(http.Header)
+
+// IfMatch makes an update conditional on the resource still having version; the server answers with
+// ErrVersionConflict otherwise. An empty version leaves the update unconditional.
+func IfMatch(version string) RequestOption {
+	return func(h http.Header) {
+		if version != "" {
+			h.Set("If-Match", fmt.Sprintf(`W/"%s"`, version))
+		}
+	}
+}
+
+// IfNoneExist makes a create conditional: when a resource matches the search criteria, e.g.
+// "identifier=urn:reception:visit|42", it is returned instead of creating another one.
+func IfNoneExist(criteria string) RequestOption {
+	return func(h http.Header) {
+		if criteria != "" {
+			h.Set("If-None-Exist", criteria)
+		}
+	}
+}
+
+// WithHeader sets a header the server needs beyond the FHIR ones.
+func WithHeader(name string, value string) RequestOption {
+	return func(h http.Header) {
+		if value != "" {
+			h.Set(name, value)
+		}
+	}
+}
+
+// Actor names who makes a change; the server records it, e.g. in the encounter status history.
+func Actor(actor string) RequestOption {
+	return WithHeader(headerActor, actor)
+}
+
+// Result describes the response to a successful interaction.
+type Result struct {
+	StatusCode int
+
+	// ID and VersionID identify the resource that was read or written, taken from the Location and ETag
+	// headers. They are empty when the server did not send them.
+	ID        string
+	VersionID string
+
+	Header http.Header
+}
+
+// Read loads resourceType/id into resource.
+func (c *Client) Read(ctx context.Context, resourceType string, id string, resource proto.Message, opts ...RequestOption) (*Result, error) {
+	result, err := c.do(ctx, http.MethodGet, resourcePath(resourceType, id), nil, nil, "", resource, opts)
+	if err != nil {
+		return nil, err
+	}
+	if result.ID == "" {
+		result.ID = id
+	}
+	return result, nil
+}
+
+// Create posts a new resource. When created is set it receives the resource as stored by the server.
+func (c *Client) Create(ctx context.Context, resourceType string, resource proto.Message, created proto.Message, opts ...RequestOption) (*Result, error) {
+	body, err := Marshal(resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", resourceType, err)
+	}
+	return c.do(ctx, http.MethodPost, resourceType, nil, body, contentTypeJSON, created, opts)
+}
+
+// Update replaces resourceType/id with resource. When updated is set it receives the resource as stored by
+// the server.
+func (c *Client) Update(ctx context.Context, resourceType string, id string, resource proto.Message, updated proto.Message, opts ...RequestOption) (*Result, error) {
+	body, err := Marshal(resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", resourceType, err)
+	}
+	return c.do(ctx, http.MethodPut, resourcePath(resourceType, id), nil, body, contentTypeJSON, updated, opts)
+}
+
+// Patch changes resourceType/id with a FHIRPath Patch, see PatchOperation. When patched is set it receives
+// the resource as stored by the server.
+func (c *Client) Patch(ctx context.Context, resourceType string, id string, patch *paramspb.Parameters, patched proto.Message, opts ...RequestOption) (*Result, error) {
+	body, err := Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal patch: %w", err)
+	}
+	return c.do(ctx, http.MethodPatch, resourcePath(resourceType, id), nil, body, contentTypeJSON, patched, opts)
+}
+
+// JSONPatchOperation is one operation of an RFC 6902 JSON Patch. Paths and values address the FHIR JSON form
+// of the resource, e.g. "/status" with "finished", not the protojson the other requests exchange.
+type JSONPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// JSONPatch changes resourceType/id with a JSON Patch. When patched is set it receives the resource as
+// stored by the server.
+func (c *Client) JSONPatch(ctx context.Context, resourceType string, id string, patch []JSONPatchOperation, patched proto.Message, opts ...RequestOption) (*Result, error) {
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal patch: %w", err)
+	}
+	return c.do(ctx, http.MethodPatch, resourcePath(resourceType, id), nil, body, contentTypeJSONPatch, patched, opts)
+}
+
+// Search returns the first page of resourceType matching query; Next loads the pages after it.
+func (c *Client) Search(ctx context.Context, resourceType string, query url.Values, opts ...RequestOption) (*Bundle, error) {
+	var bundle Bundle
+	if _, err := c.do(ctx, http.MethodGet, resourceType, query, nil, "", &bundle, opts); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// Next loads the page following bundle, or returns nil when bundle is the last page.
+func (c *Client) Next(ctx context.Context, bundle *Bundle, opts ...RequestOption) (*Bundle, error) {
+	next := bundle.Link("next")
+	if next == "" {
+		return nil, nil
+	}
+
+	var page Bundle
+	if _, err := c.do(ctx, http.MethodGet, next, nil, nil, "", &page, opts); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// SearchAll returns every resourceType matching query, following the next links of all pages. The entries
+// of all pages are returned in a single Bundle.
+func (c *Client) SearchAll(ctx context.Context, resourceType string, query url.Values, opts ...RequestOption) (*Bundle, error) {
+	bundle, err := c.Search(ctx, resourceType, query, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := bundle
+	for {
+		page, err = c.Next(ctx, page, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if page == nil {
+			break
+		}
+		bundle.Entry = append(bundle.Entry, page.Entry...)
+	}
+
+	bundle.Links = nil
+	return bundle, nil
+}
+
+// Transaction posts a transaction or batch Bundle and returns the server's response Bundle.
+func (c *Client) Transaction(ctx context.Context, bundle *Bundle, opts ...RequestOption) (*Bundle, error) {
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle: %w", err)
+	}
+
+	var response Bundle
+	if _, err := c.do(ctx, http.MethodPost, "", nil, body, contentTypeJSON, &response, opts); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Operation invokes a GET operation such as "Patient/123/$everything" with its parameters in query. out
+// receives the result, either a resource proto or a *Bundle.
+func (c *Client) Operation(ctx context.Context, path string, query url.Values, out interface{}, opts ...RequestOption) (*Result, error) {
+	return c.do(ctx, http.MethodGet, path, query, nil, "", out, opts)
+}
+
+func resourcePath(resourceType string, id string) string {
+	return resourceType + "/" + url.PathEscape(id)
+}
+
+// do sends a request to path, relative to the base URL, and decodes a successful response into out unless
+// it is nil. Error statuses are returned as *Error.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body []byte, contentType string, out interface{}, opts []RequestOption) (*Result, error) {
+	target, err := c.baseURL.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request path %s: %w", path, err)
+	}
+	if len(query) > 0 {
+		target.RawQuery = query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", contentTypeJSON)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, opt := range opts {
+		opt(req.Header)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newError(resp.StatusCode, respBody)
+	}
+
+	result := &Result{
+		StatusCode: resp.StatusCode,
+		VersionID:  VersionFromETag(resp.Header.Get("ETag")),
+		Header:     resp.Header,
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		_, result.ID = SplitReference(location)
+	} else {
+		result.ID = idFromBody(respBody)
+	}
+
+	if out != nil && len(bytes.TrimSpace(respBody)) > 0 && !isIDOnly(respBody) {
+		if err := decode(respBody, out); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+func decode(body []byte, out interface{}) error {
+	if resource, ok := out.(proto.Message); ok {
+		return Unmarshal(body, resource)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// isIDOnly reports whether body is the {"id": ...} some HIS creates answer with instead of the resource.
+func isIDOnly(body []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return false
+	}
+	_, ok := fields["id"]
+	return ok && len(fields) == 1
+}
+
+// idFromBody reads the id of a resource, or of an {"id": ...} answer, from a response body.
+func idFromBody(body []byte) string {
+	var created struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil || created.ID == nil {
+		return ""
+	}
+
+	var id string
+	if err := json.Unmarshal(created.ID, &id); err == nil {
+		return id
+	}
+	var element struct {
+		Value string `json:"value"`
+	}
+	json.Unmarshal(created.ID, &element)
+	return element.Value
+}
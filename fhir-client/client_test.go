@@ -0,0 +1,187 @@
+package fhirclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := New(Config{BaseURL: server.URL + "/fhir"})
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return client
+}
+
+func TestCreate(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/fhir/Encounter" {
+			t.Errorf("request = %s %s, want POST /fhir/Encounter", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Content-Type"); got != contentTypeJSON {
+			t.Errorf("Content-Type = %q, want %q", got, contentTypeJSON)
+		}
+		if got := r.Header.Get("If-None-Exist"); got != "identifier=urn:reception:visit|42" {
+			t.Errorf("If-None-Exist = %q", got)
+		}
+		w.Header().Set("Location", "Encounter/e1/_history/1")
+		w.Header().Set("ETag", `W/"1"`)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"e1"}`))
+	})
+
+	encounter := &encpb.Encounter{Status: &encpb.Encounter_StatusCode{Value: codespb.EncounterStatusCode_PLANNED}}
+	var created encpb.Encounter
+	result, err := client.Create(context.Background(), "Encounter", encounter, &created, IfNoneExist("identifier=urn:reception:visit|42"))
+	if err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if result.StatusCode != http.StatusCreated || result.ID != "e1" || result.VersionID != "1" {
+		t.Errorf("Create() = %+v, want e1 version 1", result)
+	}
+	if created.Status != nil {
+		t.Errorf("created = %v, want it untouched by an id-only answer", &created)
+	}
+}
+
+func TestAddConditionalCreate(t *testing.T) {
+	bundle := NewTransaction()
+	encounter := &encpb.Encounter{Status: &encpb.Encounter_StatusCode{Value: codespb.EncounterStatusCode_PLANNED}}
+	if err := bundle.AddConditionalCreate("Encounter", encounter, "identifier=urn:reception:visit|42"); err != nil {
+		t.Fatalf("AddConditionalCreate() = %v", err)
+	}
+
+	request := bundle.Entry[0].Request
+	if request.Method != http.MethodPost || request.URL != "Encounter" || request.IfNoneExist != "identifier=urn:reception:visit|42" {
+		t.Errorf("request = %+v, want a conditional POST to Encounter", request)
+	}
+}
+
+func TestReadNotFound(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Encounter not found"}`))
+	})
+
+	var encounter encpb.Encounter
+	_, err := client.Read(context.Background(), "Encounter", "e1", &encounter)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read() error = %v, want ErrNotFound", err)
+	}
+	var fhirErr *Error
+	if !errors.As(err, &fhirErr) || fhirErr.Message != "Encounter not found" {
+		t.Errorf("Read() error = %#v, want the server's message", err)
+	}
+}
+
+func TestSearchAll(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.Write([]byte(`{"resourceType":"Bundle","type":"searchset","entry":[{"fullUrl":"Encounter/e2"}]}`))
+			return
+		}
+		if got := r.URL.Query().Get("patient"); got != "p1" {
+			t.Errorf("patient = %q, want p1", got)
+		}
+		w.Write([]byte(`{"resourceType":"Bundle","type":"searchset",` +
+			`"link":[{"relation":"next","url":"Encounter?patient=p1&page=2"}],"entry":[{"fullUrl":"Encounter/e1"}]}`))
+	})
+
+	bundle, err := client.SearchAll(context.Background(), "Encounter", url.Values{"patient": {"p1"}})
+	if err != nil {
+		t.Fatalf("SearchAll() = %v", err)
+	}
+	if len(bundle.Entry) != 2 || bundle.Entry[0].ID() != "e1" || bundle.Entry[1].ID() != "e2" || bundle.Links != nil {
+		t.Errorf("SearchAll() = %+v, want e1 and e2 without links", bundle)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusGone, ErrNotFound},
+		{http.StatusPreconditionFailed, ErrVersionConflict},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusBadRequest, ErrInvalid},
+		{http.StatusUnprocessableEntity, ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		err := newError(tt.status, nil)
+		if !errors.Is(err, tt.target) {
+			t.Errorf("errors.Is(%d, %v) = false, want true", tt.status, tt.target)
+		}
+	}
+
+	if errors.Is(newError(http.StatusInternalServerError, nil), ErrInvalid) {
+		t.Error("errors.Is(500, ErrInvalid) = true, want false")
+	}
+}
+
+func TestNewErrorOutcome(t *testing.T) {
+	err := newError(http.StatusUnprocessableEntity, []byte(`{"resourceType":"OperationOutcome","issue":[`+
+		`{"severity":"error","code":"required","diagnostics":"Encounter.status is required","expression":["Encounter.status"]}]}`))
+	if err.Outcome == nil {
+		t.Fatalf("newError() = %+v, want an outcome", err)
+	}
+	want := "FHIR server returned status 422: Encounter.status: Encounter.status is required"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	if err := newError(http.StatusBadGateway, []byte("upstream down\n")); err.Message != "upstream down" {
+		t.Errorf("newError() message = %q, want the plain body", err.Message)
+	}
+}
+
+func TestSplitReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		wantType  string
+		wantID    string
+	}{
+		{"Patient/123", "Patient", "123"},
+		{"Encounter/e1/_history/2", "Encounter", "e1"},
+		{"https://his:9090/fhir/Practitioner/d1", "Practitioner", "d1"},
+		{"123", "", "123"},
+	}
+
+	for _, tt := range tests {
+		resourceType, id := SplitReference(tt.reference)
+		if resourceType != tt.wantType || id != tt.wantID {
+			t.Errorf("SplitReference(%q) = %q, %q, want %q, %q", tt.reference, resourceType, id, tt.wantType, tt.wantID)
+		}
+	}
+}
+
+func TestIDFromBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"id":"e1"}`, "e1"},
+		{`{"id":{"value":"e1"},"status":{"value":"PLANNED"}}`, "e1"},
+		{`{"status":{"value":"PLANNED"}}`, ""},
+		{`not json`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := idFromBody([]byte(tt.body)); got != tt.want {
+			t.Errorf("idFromBody(%s) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package fhirclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	patientpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+)
+
+// ErrStatusTransition is returned when the server refuses an encounter status change its workflow does not
+// allow, e.g. reopening a finished encounter.
+var ErrStatusTransition = errors.New("encounter status change not allowed")
+
+// EncounterSummary is an encounter flattened for client applications, with the names of its patient and
+// practitioner when the server included them.
+type EncounterSummary struct {
+	ID                         string `json:"id"`
+	PatientID                  string `json:"patientId"`
+	PatientName                string `json:"patientName"`
+	PatientGender              string `json:"patientGender"`
+	PractitionerID             string `json:"practitionerId"`
+	PractitionerName           string `json:"practitionerName"`
+	PractitionerSpecialization string `json:"practitionerSpecialization"`
+	Status                     string `json:"status"`
+	Class                      string `json:"class,omitempty"`
+	Type                       string `json:"type,omitempty"`
+	ServiceType                string `json:"serviceType,omitempty"`
+	Priority                   string `json:"priority,omitempty"`
+	ReasonText                 string `json:"reasonText,omitempty"`
+	ReasonCode                 string `json:"reasonCode,omitempty"`
+	LocationID                 string `json:"locationId,omitempty"`
+	LocationName               string `json:"locationName,omitempty"`
+	VersionID                  string `json:"versionId"`
+	CreatedAt                  string `json:"createdAt"`
+	EndTime                    string `json:"endTime,omitempty"`
+}
+
+// EncounterStatus converts an Encounter status code to the status used by client applications, which call
+// finished encounters completed.
+func EncounterStatus(code string) string {
+	if code == "finished" {
+		return "completed"
+	}
+	return code
+}
+
+// EncounterStatusCode converts a client status such as "completed" or "IN_PROGRESS" to the FHIR Encounter
+// status code, e.g. "finished" or "in-progress".
+func EncounterStatusCode(status string) string {
+	status = strings.ReplaceAll(strings.ToLower(status), "_", "-")
+	if status == "completed" {
+		return "finished"
+	}
+	return status
+}
+
+// ParseEncounter decodes a FHIR Encounter as sent by the server in notifications.
+func ParseEncounter(data []byte) (*encpb.Encounter, error) {
+	var encounter encpb.Encounter
+	if err := Unmarshal(data, &encounter); err != nil {
+		return nil, fmt.Errorf("invalid FHIR Encounter: %w", err)
+	}
+	return &encounter, nil
+}
+
+// SummarizeEncounter flattens encounter. Patient and practitioner details are read from included, keyed by
+// reference; they are left empty when the resource was not included.
+func SummarizeEncounter(encounter *encpb.Encounter, included map[string]BundleEntry) *EncounterSummary {
+	summary := &EncounterSummary{
+		ID:          encounter.GetId().GetValue(),
+		Status:      EncounterStatus(EnumCode(encounter.GetStatus().GetValue())),
+		VersionID:   encounter.GetMeta().GetVersionId().GetValue(),
+		Class:       encounter.GetClassValue().GetCode().GetValue(),
+		ServiceType: ConceptText(encounter.GetServiceType()),
+		Priority:    ConceptCode(encounter.GetPriority()),
+		CreatedAt:   FormatDateTime(encounter.GetPeriod().GetStart()),
+		EndTime:     FormatDateTime(encounter.GetPeriod().GetEnd()),
+	}
+
+	if types := encounter.GetType(); len(types) > 0 {
+		summary.Type = ConceptText(types[0])
+	}
+
+	if reasons := encounter.GetReasonCode(); len(reasons) > 0 {
+		summary.ReasonText = ConceptText(reasons[0])
+		summary.ReasonCode = ConceptCode(reasons[0])
+	}
+
+	if subject := encounter.GetSubject(); subject != nil {
+		summary.PatientID = ReferenceID(subject)
+		var patient patientpb.Patient
+		if entry, ok := included[subject.GetUri().GetValue()]; ok && entry.Decode(&patient) == nil {
+			summary.PatientName = FormatName(patient.GetName())
+			summary.PatientGender = EnumCode(patient.GetGender().GetValue())
+		}
+	}
+
+	if participants := encounter.GetParticipant(); len(participants) > 0 {
+		individual := participants[0].GetIndividual()
+		summary.PractitionerID = ReferenceID(individual)
+		var practitioner practpb.Practitioner
+		if entry, ok := included[individual.GetUri().GetValue()]; ok && entry.Decode(&practitioner) == nil {
+			summary.PractitionerName = FormatName(practitioner.GetName())
+			if qualifications := practitioner.GetQualification(); len(qualifications) > 0 {
+				summary.PractitionerSpecialization = ConceptText(qualifications[0].GetCode())
+			}
+		}
+	}
+
+	if locations := encounter.GetLocation(); len(locations) > 0 {
+		location := locations[0].GetLocation()
+		summary.LocationID = ReferenceID(location)
+		summary.LocationName = location.GetDisplay().GetValue()
+	}
+
+	if summary.CreatedAt == "" {
+		summary.CreatedAt = time.Now().Format(time.RFC3339)
+	}
+
+	jsonBytes, _ := json.Marshal(summary)
+	log.Printf("Mapped FHIR to DTO: %s", string(jsonBytes))
+
+	return summary
+}
+
+// UpdateEncounterStatus changes the status of Encounter/id with a FHIRPath Patch; status may be given as a
+// client status, see EncounterStatusCode. A change the server rejects as invalid is reported as
+// ErrStatusTransition.
+func (c *Client) UpdateEncounterStatus(ctx context.Context, id string, status string, opts ...RequestOption) (*Result, error) {
+	patch := NewPatch(PatchOperation("replace", "Encounter.status", CodeValue(EncounterStatusCode(status))))
+
+	result, err := c.Patch(ctx, "Encounter", id, patch, nil, opts...)
+	if errors.Is(err, ErrInvalid) {
+		return nil, fmt.Errorf("%w: %w", ErrStatusTransition, err)
+	}
+	return result, err
+}
@@ -0,0 +1,42 @@
+package fhirclient
+
+import "testing"
+
+func TestEncounterStatusCode(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"completed", "finished"},
+		{"COMPLETED", "finished"},
+		{"finished", "finished"},
+		{"in-progress", "in-progress"},
+		{"IN_PROGRESS", "in-progress"},
+		{"planned", "planned"},
+		{"cancelled", "cancelled"},
+	}
+
+	for _, tt := range tests {
+		if got := EncounterStatusCode(tt.status); got != tt.want {
+			t.Errorf("EncounterStatusCode(%q) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestEncounterStatus(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"finished", "completed"},
+		{"in-progress", "in-progress"},
+		{"arrived", "arrived"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := EncounterStatus(tt.code); got != tt.want {
+			t.Errorf("EncounterStatus(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package fhirclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound matches an *Error for a resource the server does not know.
+	ErrNotFound = errors.New("resource not found")
+
+	// ErrVersionConflict matches an *Error for an update whose If-Match version is no longer current.
+	ErrVersionConflict = errors.New("resource was modified by another user")
+
+	// ErrConflict matches an *Error for a change that conflicts with existing data.
+	ErrConflict = errors.New("conflicts with existing data")
+
+	// ErrInvalid matches an *Error for a request the server rejected as invalid, e.g. a resource that fails
+	// validation or a status change its workflow does not allow.
+	ErrInvalid = errors.New("request rejected by server")
+)
+
+// Error is returned when the server answers with an error status. Outcome holds the issues the server
+// reported, if it sent an OperationOutcome; Message otherwise holds its error text.
+type Error struct {
+	StatusCode int
+	Outcome    *OperationOutcome
+	Message    string
+}
+
+// OperationOutcome is a FHIR OperationOutcome. HIS writes it in plain FHIR JSON rather than protojson.
+type OperationOutcome struct {
+	ResourceType string  `json:"resourceType"`
+	Issue        []Issue `json:"issue"`
+}
+
+type Issue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+func newError(statusCode int, body []byte) *Error {
+	e := &Error{StatusCode: statusCode}
+
+	var response struct {
+		ResourceType string          `json:"resourceType"`
+		Issue        json.RawMessage `json:"issue"`
+		Error        string          `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		e.Message = strings.TrimSpace(string(body))
+		return e
+	}
+
+	if response.ResourceType == "OperationOutcome" {
+		var outcome OperationOutcome
+		if err := json.Unmarshal(body, &outcome); err == nil {
+			e.Outcome = &outcome
+			return e
+		}
+	}
+
+	e.Message = response.Error
+	if e.Message == "" {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	detail := e.Message
+	if e.Outcome != nil {
+		detail = e.Outcome.String()
+	}
+	if detail == "" {
+		detail = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("FHIR server returned status %d: %s", e.StatusCode, detail)
+}
+
+// Is lets errors.Is match an *Error against ErrNotFound, ErrVersionConflict, ErrConflict and ErrInvalid by
+// its status.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+	case ErrVersionConflict:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrInvalid:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// String joins the diagnostics of the outcome's issues, prefixed with the element they concern.
+func (o *OperationOutcome) String() string {
+	messages := make([]string, 0, len(o.Issue))
+	for _, issue := range o.Issue {
+		message := issue.Diagnostics
+		if message == "" {
+			message = issue.Code
+		}
+		if len(issue.Expression) > 0 {
+			message = fmt.Sprintf("%s: %s", strings.Join(issue.Expression, ", "), message)
+		}
+		messages = append(messages, message)
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,10 @@
+module fhir-client
+
+go 1.24.3
+
+require (
+	github.com/google/fhir/go v0.7.4
+	google.golang.org/protobuf v1.36.9
+)
+
+require github.com/golang/protobuf v1.5.4 // indirect
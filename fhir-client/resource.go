@@ -0,0 +1,153 @@
+package fhirclient
+
+import (
+	"strings"
+	"time"
+
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	paramspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Marshal encodes a resource in the protojson form HIS reads.
+func Marshal(resource proto.Message) ([]byte, error) {
+	return protojson.Marshal(resource)
+}
+
+// Unmarshal decodes a resource from protojson. Unknown fields are skipped, so that a server adding fields
+// does not break its clients.
+func Unmarshal(data []byte, resource proto.Message) error {
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, resource)
+}
+
+// Reference returns a reference to resourceType/id.
+func Reference(resourceType string, id string) *dtpb.Reference {
+	return &dtpb.Reference{
+		Reference: &dtpb.Reference_Uri{Uri: &dtpb.String{Value: resourceType + "/" + id}},
+	}
+}
+
+// ReferenceID returns the id a reference such as "Patient/123" points to, or "" when ref is nil.
+func ReferenceID(ref *dtpb.Reference) string {
+	_, id := SplitReference(ref.GetUri().GetValue())
+	return id
+}
+
+// SplitReference splits "Patient/123", "Patient/123/_history/2" or an absolute URL ending in either into
+// its type and id. A bare id is returned with an empty type.
+func SplitReference(reference string) (resourceType string, id string) {
+	reference, _, _ = strings.Cut(reference, "/_history/")
+	parts := strings.Split(strings.TrimSuffix(reference, "/"), "/")
+	if len(parts) < 2 {
+		return "", reference
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
+
+// VersionFromETag extracts the version id from a weak ETag such as W/"3".
+func VersionFromETag(etag string) string {
+	return strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+}
+
+// EnumCode returns the FHIR code of a code element's enum value, e.g. "in-progress" for IN_PROGRESS, or ""
+// when the value is unset.
+func EnumCode(value protoreflect.Enum) string {
+	if value.Number() == 0 {
+		return ""
+	}
+	name := value.Descriptor().Values().ByNumber(value.Number()).Name()
+	return strings.ReplaceAll(strings.ToLower(string(name)), "_", "-")
+}
+
+// NewCoding returns a coding of code from system.
+func NewCoding(system string, code string) *dtpb.Coding {
+	return &dtpb.Coding{
+		System: &dtpb.Uri{Value: system},
+		Code:   &dtpb.Code{Value: code},
+	}
+}
+
+// NewConcept returns a CodeableConcept with a single coding of code from system.
+func NewConcept(system string, code string) *dtpb.CodeableConcept {
+	return &dtpb.CodeableConcept{Coding: []*dtpb.Coding{NewCoding(system, code)}}
+}
+
+// ConceptCode returns the code of the first coding of a CodeableConcept.
+func ConceptCode(concept *dtpb.CodeableConcept) string {
+	if len(concept.GetCoding()) == 0 {
+		return ""
+	}
+	return concept.GetCoding()[0].GetCode().GetValue()
+}
+
+// ConceptText returns the text of a CodeableConcept.
+func ConceptText(concept *dtpb.CodeableConcept) string {
+	return concept.GetText().GetValue()
+}
+
+// FormatName formats the first of names as "Last First Middle".
+func FormatName(names []*dtpb.HumanName) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	parts := []string{names[0].GetFamily().GetValue()}
+	for _, given := range names[0].GetGiven() {
+		parts = append(parts, given.GetValue())
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// NewDateTime returns t as a dateTime with second precision.
+func NewDateTime(t time.Time) *dtpb.DateTime {
+	return &dtpb.DateTime{ValueUs: t.UnixMicro(), Precision: dtpb.DateTime_SECOND}
+}
+
+// timeValue is implemented by the date, dateTime and instant elements.
+type timeValue interface {
+	GetValueUs() int64
+}
+
+// FormatDateTime formats a date, dateTime or instant as RFC 3339, or returns "" when it is absent.
+func FormatDateTime(value timeValue) string {
+	valueUs := value.GetValueUs()
+	if valueUs == 0 {
+		return ""
+	}
+	return time.UnixMicro(valueUs).Format(time.RFC3339)
+}
+
+// NewPatch returns a FHIRPath Patch made of operations, see PatchOperation.
+func NewPatch(operations ...*paramspb.Parameters_Parameter) *paramspb.Parameters {
+	return &paramspb.Parameters{Parameter: operations}
+}
+
+// PatchOperation returns one operation of a FHIRPath Patch, e.g. a "replace" of "Encounter.status".
+func PatchOperation(opType string, path string, value *paramspb.Parameters_Parameter_ValueX) *paramspb.Parameters_Parameter {
+	return &paramspb.Parameters_Parameter{
+		Name: &dtpb.String{Value: "operation"},
+		Part: []*paramspb.Parameters_Parameter{
+			{
+				Name:  &dtpb.String{Value: "type"},
+				Value: &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_Code{Code: &dtpb.Code{Value: opType}}},
+			},
+			{
+				Name:  &dtpb.String{Value: "path"},
+				Value: &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_StringValue{StringValue: &dtpb.String{Value: path}}},
+			},
+			{
+				Name:  &dtpb.String{Value: "value"},
+				Value: value,
+			},
+		},
+	}
+}
+
+// CodeValue returns code as the value of a Parameters parameter.
+func CodeValue(code string) *paramspb.Parameters_Parameter_ValueX {
+	return &paramspb.Parameters_Parameter_ValueX{
+		Choice: &paramspb.Parameters_Parameter_ValueX_Code{Code: &dtpb.Code{Value: code}},
+	}
+}
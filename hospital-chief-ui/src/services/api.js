@@ -114,3 +114,15 @@ export async function createPractitioner(firstName, lastName, middleName, specia
     specialization
   };
 }
+
+export async function getDepartmentOccupancy() {
+  return request('/departments/occupancy');
+}
+
+export async function getBeds() {
+  return request('/beds');
+}
+
+export async function getBedOccupancy() {
+  return request('/beds/occupancy');
+}
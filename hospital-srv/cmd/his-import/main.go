@@ -0,0 +1,179 @@
+// Command his-import loads patients and practitioners from NDJSON or
+// Bundle files into hospital-srv through its $import operation and prints
+// the outcome of every record.
+//
+// Usage:
+//
+//	his-import [-server URL] [-ca FILE] [-dry-run] [-report FILE] FILE...
+//
+// Files ending in .ndjson or .jsonl are sent as they are as NDJSON, one
+// FHIR JSON resource per line as $export writes them; anything else is
+// sent as a FHIR JSON Bundle. The exit status is 1 if any record was
+// invalid or failed.
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type result struct {
+	Record       int    `json:"record"`
+	ResourceType string `json:"resourceType"`
+	Status       string `json:"status"`
+	ID           string `json:"id"`
+	Message      string `json:"message"`
+}
+
+type report struct {
+	DryRun     bool     `json:"dryRun"`
+	Total      int      `json:"total"`
+	Created    int      `json:"created"`
+	Valid      int      `json:"valid"`
+	Duplicates int      `json:"duplicates"`
+	Invalid    int      `json:"invalid"`
+	Failed     int      `json:"failed"`
+	Results    []result `json:"results"`
+}
+
+type fileReport struct {
+	File string `json:"file"`
+	report
+}
+
+func main() {
+	server := flag.String("server", "https://localhost:9090", "hospital-srv base URL")
+	caPath := flag.String("ca", "certs/server.crt", "CA certificate to trust for the server")
+	dryRun := flag.Bool("dry-run", false, "validate and check for duplicates without creating anything")
+	reportPath := flag.String("report", "", "write the full report as JSON to this file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FILE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client, err := newClient(*caPath)
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+
+	endpoint := strings.TrimRight(*server, "/") + "/fhir/$import?" + url.Values{"_dryRun": {fmt.Sprint(*dryRun)}}.Encode()
+
+	var reports []fileReport
+	ok := true
+	for _, path := range flag.Args() {
+		r, err := importFile(client, endpoint, path)
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			ok = false
+			continue
+		}
+
+		printReport(path, r)
+		reports = append(reports, fileReport{File: path, report: *r})
+		if r.Invalid > 0 || r.Failed > 0 {
+			ok = false
+		}
+	}
+
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportPath, data, 0o644)
+		}
+		if err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func newClient(caPath string) (*http.Client, error) {
+	cert, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(cert) {
+		return nil, fmt.Errorf("failed to append certificate")
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Minute,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: certPool},
+		},
+	}, nil
+}
+
+func importFile(client *http.Client, endpoint string, path string) (*report, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := "application/fhir+json"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl":
+		contentType = "application/fhir+ndjson"
+	}
+
+	resp, err := client.Post(endpoint, contentType, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	var r report
+	if err := json.Unmarshal(respBody, &r); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	return &r, nil
+}
+
+func printReport(path string, r *report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RECORD\tTYPE\tSTATUS\tID\tMESSAGE")
+	for _, res := range r.Results {
+		fmt.Fprintf(w, "%s:%d\t%s\t%s\t%s\t%s\n", path, res.Record, res.ResourceType, res.Status, res.ID, res.Message)
+	}
+	w.Flush()
+
+	if r.DryRun {
+		fmt.Printf("%s: %d records, %d valid, %d duplicates, %d invalid, %d failed (dry run)\n\n",
+			path, r.Total, r.Valid, r.Duplicates, r.Invalid, r.Failed)
+		return
+	}
+	fmt.Printf("%s: %d records, %d created, %d duplicates, %d invalid, %d failed\n\n",
+		path, r.Total, r.Created, r.Duplicates, r.Invalid, r.Failed)
+}
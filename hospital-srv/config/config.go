@@ -3,32 +3,44 @@ package config
 import "os"
 
 type Config struct {
-	DBHost          string
-	DBPort          string
-	DBUser          string
-	DBPassword      string
-	DBName          string
-	ServerPort      string
-	MLLPPort        string
-	TLSCertPath     string
-	TLSKeyPath      string
-	DoctorAPIURL    string
-	ReceptionAPIURL string
+	DBHost             string
+	DBPort             string
+	DBUser             string
+	DBPassword         string
+	DBName             string
+	ServerPort         string
+	MLLPPort           string
+	TLSCertPath        string
+	TLSKeyPath         string
+	NotificationCAPath string
+	NotificationSecret string
+	ClinicTimezone     string
+	ICD10CodesPath     string
+	MedicationsPath    string
+	PharmacyAddress    string
+	PharmacyCAPath     string
+	ExportPath         string
 }
 
 func Load() *Config {
 	return &Config{
-		DBHost:          getEnv("DB_HOST", "localhost"),
-		DBPort:          getEnv("DB_PORT", "5432"),
-		DBUser:          getEnv("DB_USER", "postgres"),
-		DBPassword:      getEnv("DB_PASSWORD", "postgres"),
-		DBName:          getEnv("DB_NAME", "hospital_db"),
-		ServerPort:      getEnv("SERVER_PORT", "9090"),
-		MLLPPort:        getEnv("MLLP_PORT", "2575"),
-		TLSCertPath:     getEnv("TLS_CERT_PATH", "/app/certs/server.crt"),
-		TLSKeyPath:      getEnv("TLS_KEY_PATH", "/app/certs/server.key"),
-		DoctorAPIURL:    getEnv("DOCTOR_API_URL", "https://doctor-api:8081"),
-		ReceptionAPIURL: getEnv("RECEPTION_API_URL", "https://reception-api:8080"),
+		DBHost:             getEnv("DB_HOST", "localhost"),
+		DBPort:             getEnv("DB_PORT", "5432"),
+		DBUser:             getEnv("DB_USER", "postgres"),
+		DBPassword:         getEnv("DB_PASSWORD", "postgres"),
+		DBName:             getEnv("DB_NAME", "hospital_db"),
+		ServerPort:         getEnv("SERVER_PORT", "9090"),
+		MLLPPort:           getEnv("MLLP_PORT", "2575"),
+		TLSCertPath:        getEnv("TLS_CERT_PATH", "/app/certs/server.crt"),
+		TLSKeyPath:         getEnv("TLS_KEY_PATH", "/app/certs/server.key"),
+		NotificationCAPath: getEnv("NOTIFICATION_CA_PATH", "/app/certs/server.crt"),
+		NotificationSecret: getEnv("NOTIFICATION_SIGNING_SECRET", "default-notification-secret-to-change"),
+		ClinicTimezone:     getEnv("CLINIC_TIMEZONE", "UTC"),
+		ICD10CodesPath:     getEnv("ICD10_CODES_PATH", "data/icd10.csv"),
+		MedicationsPath:    getEnv("MEDICATIONS_PATH", "data/medications.csv"),
+		PharmacyAddress:    getEnv("PHARMACY_MLLP_ADDRESS", ""),
+		PharmacyCAPath:     getEnv("PHARMACY_CA_PATH", "/app/certs/server.crt"),
+		ExportPath:         getEnv("EXPORT_PATH", "exports"),
 	}
 }
 
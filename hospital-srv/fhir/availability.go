@@ -0,0 +1,74 @@
+package fhir
+
+import (
+	"errors"
+	"hospital-srv/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	paramspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
+)
+
+// defaultAvailabilityRange is the period $availability covers when no end
+// is given.
+const defaultAvailabilityRange = 7 * 24 * time.Hour
+
+// PractitionerAvailability implements Practitioner/:id/$availability. It
+// returns a Parameters resource with one "free" period per stretch of time
+// between start (default now) and end (default a week later) in which the
+// practitioner works and has nothing booked.
+func (s *FHIRServer) PractitionerAvailability(c *gin.Context) {
+	id := c.Param("id")
+
+	start := time.Now()
+	if value := c.Query("start"); value != "" {
+		from, _, err := parseDateRange(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		start = from
+	}
+
+	end := start.Add(defaultAvailabilityRange)
+	if value := c.Query("end"); value != "" {
+		_, to, err := parseDateRange(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		end = to
+	}
+
+	free, err := s.calendarService.GetAvailability(id, start, end)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrReferenceNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Practitioner not found"})
+		case errors.Is(err, services.ErrInvalidCalendar):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	params := &paramspb.Parameters{}
+	for _, interval := range free {
+		params.Parameter = append(params.Parameter, &paramspb.Parameters_Parameter{
+			Name: &dtpb.String{Value: "free"},
+			Value: &paramspb.Parameters_Parameter_ValueX{
+				Choice: &paramspb.Parameters_Parameter_ValueX_Period{
+					Period: &dtpb.Period{
+						Start: &dtpb.DateTime{ValueUs: interval.Start.UnixMicro(), Timezone: "UTC", Precision: dtpb.DateTime_SECOND},
+						End:   &dtpb.DateTime{ValueUs: interval.End.UnixMicro(), Timezone: "UTC", Precision: dtpb.DateTime_SECOND},
+					},
+				},
+			},
+		})
+	}
+
+	writeResource(c, params)
+}
@@ -0,0 +1,489 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hospital-srv/repository"
+	"hospital-srv/services"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const urnUUIDPrefix = "urn:uuid:"
+
+type bundleRequest struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Entry        []bundleEntry `json:"entry"`
+}
+
+type bundleEntry struct {
+	FullURL  string          `json:"fullUrl"`
+	Resource json.RawMessage `json:"resource"`
+	Request  struct {
+		Method      string `json:"method"`
+		URL         string `json:"url"`
+		IfMatch     string `json:"ifMatch"`
+		IfNoneExist string `json:"ifNoneExist"`
+	} `json:"request"`
+}
+
+// entryError is a failed Bundle entry together with the HTTP status it
+// would have produced as a standalone request. Entries rejected by the
+// validator keep its issues for the outcome.
+type entryError struct {
+	status  int
+	message string
+	issues  []validationIssue
+}
+
+func (e *entryError) Error() string {
+	return e.message
+}
+
+func entryErrorf(status int, format string, args ...interface{}) *entryError {
+	return &entryError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// validateEntry checks resource like validate does for standalone
+// requests. References are resolved inside tx so that resources created
+// earlier in a transaction are found.
+func (s *FHIRServer) validateEntry(tx *services.Transaction, resourceType string, resource proto.Message) *entryError {
+	lookup := func(targetType string, id string) error {
+		var err error
+		switch targetType {
+		case "Patient":
+			_, err = tx.GetPatientByID(id)
+		case "Practitioner":
+			_, err = tx.GetPractitionerByID(id)
+		default:
+			err = s.lookupReference(targetType, id)
+		}
+		return err
+	}
+
+	issues := validateResource(resourceType, resource, lookup)
+	if !hasErrors(issues) {
+		return nil
+	}
+	return &entryError{status: http.StatusUnprocessableEntity, message: issuesMessage(issues), issues: issues}
+}
+
+func updateEntryError(resourceType string, err error) *entryError {
+	status, message := updateErrorStatus(resourceType, err)
+	return &entryError{status: status, message: message}
+}
+
+type entryResult struct {
+	status    int
+	location  string
+	resource  map[string]interface{}
+	versionID int
+	updatedAt time.Time
+	err       *entryError
+}
+
+// ProcessBundle handles transaction and batch Bundles posted to the base URL.
+func (s *FHIRServer) ProcessBundle(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	log.Printf("Received FHIR Bundle: %s", strings.ReplaceAll(string(body), "\n", " "))
+
+	var bundle bundleRequest
+	if err := json.Unmarshal(body, &bundle); err != nil || bundle.ResourceType != "Bundle" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Bundle format"})
+		return
+	}
+
+	switch bundle.Type {
+	case "transaction":
+		s.processTransaction(c, bundle)
+	case "batch":
+		s.processBatch(c, bundle)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported Bundle type: %s", bundle.Type)})
+	}
+}
+
+func (s *FHIRServer) processTransaction(c *gin.Context, bundle bundleRequest) {
+	results := make([]entryResult, len(bundle.Entry))
+	references := map[string]string{}
+
+	err := s.transactionService.Run(requestActor(c), func(tx *services.Transaction) error {
+		for _, i := range transactionOrder(bundle.Entry) {
+			entry := bundle.Entry[i]
+			result := s.processEntry(tx, entry, references)
+			if result.err != nil {
+				return &entryError{status: result.err.status, message: fmt.Sprintf("entry %d: %s", i, result.err.message), issues: result.err.issues}
+			}
+
+			if strings.HasPrefix(entry.FullURL, urnUUIDPrefix) && result.location != "" {
+				references[entry.FullURL] = strings.SplitN(result.location, "/_history/", 2)[0]
+			}
+			results[i] = result
+		}
+		return nil
+	})
+	if err != nil {
+		var entryErr *entryError
+		if !errors.As(err, &entryErr) {
+			entryErr = entryErrorf(http.StatusInternalServerError, "%s", err.Error())
+		}
+		log.Printf("FHIR transaction rolled back: %v", err)
+		if len(entryErr.issues) > 0 {
+			c.JSON(entryErr.status, operationOutcome(entryErr.issues))
+			return
+		}
+		c.JSON(entryErr.status, gin.H{"error": entryErr.message})
+		return
+	}
+
+	writeBundleResponse(c, "transaction-response", results)
+}
+
+func (s *FHIRServer) processBatch(c *gin.Context, bundle bundleRequest) {
+	results := make([]entryResult, len(bundle.Entry))
+
+	for i, entry := range bundle.Entry {
+		err := s.transactionService.Run(requestActor(c), func(tx *services.Transaction) error {
+			results[i] = s.processEntry(tx, entry, nil)
+			if results[i].err != nil {
+				return results[i].err
+			}
+			return nil
+		})
+		if err != nil && results[i].err == nil {
+			results[i] = entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}
+		}
+	}
+
+	writeBundleResponse(c, "batch-response", results)
+}
+
+// transactionOrder returns entry indexes in the order FHIR requires them
+// to be processed: creates, then updates, then reads. Creates of resources
+// that others commonly reference run first so urn:uuid references resolve.
+func transactionOrder(entries []bundleEntry) []int {
+	methodRank := map[string]int{http.MethodPost: 0, http.MethodPut: 1, http.MethodGet: 2}
+	createRank := map[string]int{"Encounter": 1}
+
+	rank := func(e bundleEntry) int {
+		resourceType, _ := parseEntryURL(e.Request.URL)
+		return methodRank[strings.ToUpper(e.Request.Method)]*10 + createRank[resourceType]
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return rank(entries[order[a]]) < rank(entries[order[b]])
+	})
+
+	return order
+}
+
+func parseEntryURL(url string) (string, string) {
+	url = strings.Trim(url, "/")
+	if _, rest, ok := strings.Cut(url, fhirBasePath+"/"); ok {
+		url = rest
+	}
+
+	parts := strings.SplitN(url, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func (s *FHIRServer) processEntry(tx *services.Transaction, entry bundleEntry, references map[string]string) entryResult {
+	method := strings.ToUpper(entry.Request.Method)
+	resourceType, id := parseEntryURL(entry.Request.URL)
+
+	resource := []byte(entry.Resource)
+	// Bundles sent as FHIR XML name the resourceType of their entries.
+	if _, rest, err := splitResourceType(entry.Resource); err == nil {
+		resource = rest
+	}
+	for urn, reference := range references {
+		resource = bytes.ReplaceAll(resource, []byte(`"`+urn+`"`), []byte(`"`+reference+`"`))
+	}
+	if bytes.Contains(resource, []byte(urnUUIDPrefix)) {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "unresolved %s reference in %s", urnUUIDPrefix, resourceType)}
+	}
+
+	expectedVersion, err := parseETag(entry.Request.IfMatch)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "%s", err.Error())}
+	}
+
+	if method == http.MethodPost && id == "" && entry.Request.IfNoneExist != "" {
+		if result, ok := existingEntry(tx, resourceType, entry.Request.IfNoneExist); ok {
+			return result
+		}
+	}
+
+	switch {
+	case method == http.MethodGet && id != "":
+		return s.readEntry(tx, resourceType, id)
+	case method == http.MethodPost && id == "" && resourceType == "Encounter":
+		return s.createEncounterEntry(tx, resource)
+	case method == http.MethodPost && id == "" && resourceType == "Practitioner":
+		return s.createPractitionerEntry(tx, resource)
+	case method == http.MethodPut && id != "" && resourceType == "Encounter":
+		return s.updateEncounterEntry(tx, id, resource, expectedVersion)
+	case method == http.MethodPut && id != "" && resourceType == "Practitioner":
+		return s.updatePractitionerEntry(tx, id, resource, expectedVersion)
+	}
+
+	return entryResult{err: entryErrorf(http.StatusBadRequest, "unsupported operation %s %s", entry.Request.Method, entry.Request.URL)}
+}
+
+// existingEntry answers a create entry whose ifNoneExist criteria match an
+// existing resource, as ifNoneExist does for a standalone create, and
+// reports whether it did. The search runs inside tx, so a resource created
+// earlier in the Bundle counts.
+func existingEntry(tx *services.Transaction, resourceType string, criteria string) (entryResult, bool) {
+	if !conditionalCreates[resourceType] {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "conditional create is not supported for %s", resourceType)}, true
+	}
+
+	matches, err := searchMatches(tx, resourceType, criteria)
+	switch {
+	case errors.Is(err, errInvalidCriteria):
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "%s", err.Error())}, true
+	case err != nil:
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}, true
+	case len(matches) > 1:
+		return entryResult{err: entryErrorf(http.StatusPreconditionFailed, "criteria match %d %s resources", len(matches), resourceType)}, true
+	case len(matches) == 0:
+		return entryResult{}, false
+	}
+
+	log.Printf("%s %s already exists, create skipped", resourceType, matches[0].id)
+	return newEntryResult(http.StatusOK, resourceType, matches[0].id, matches[0].versionedResource), true
+}
+
+func (s *FHIRServer) readEntry(tx *services.Transaction, resourceType string, id string) entryResult {
+	var v versionedResource
+	switch resourceType {
+	case "Patient":
+		patient, err := tx.GetPatientByID(id)
+		if err != nil {
+			return entryResult{err: entryErrorf(http.StatusNotFound, "Patient not found")}
+		}
+		v = versionedResource{resource: PatientToFHIR(*patient), versionID: patient.VersionID, updatedAt: patient.UpdatedAt}
+	case "Practitioner":
+		practitioner, err := tx.GetPractitionerByID(id)
+		if err != nil {
+			return entryResult{err: entryErrorf(http.StatusNotFound, "Practitioner not found")}
+		}
+		v = versionedResource{resource: PractitionerToFHIR(*practitioner), versionID: practitioner.VersionID, updatedAt: practitioner.UpdatedAt}
+	case "Encounter":
+		encounter, err := tx.GetEncounterByID(id)
+		if err != nil {
+			return entryResult{err: entryErrorf(http.StatusNotFound, "Encounter not found")}
+		}
+		v = versionedResource{resource: EncounterToFHIR(*encounter), versionID: encounter.VersionID, updatedAt: encounter.UpdatedAt}
+	default:
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "unsupported resource type: %s", resourceType)}
+	}
+
+	return newEntryResult(http.StatusOK, resourceType, id, v)
+}
+
+func (s *FHIRServer) createEncounterEntry(tx *services.Transaction, resource []byte) entryResult {
+	var fhirEncounter encpb.Encounter
+	if err := protojson.Unmarshal(resource, &fhirEncounter); err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "Invalid FHIR Encounter format")}
+	}
+
+	if err := s.validateEntry(tx, "Encounter", &fhirEncounter); err != nil {
+		return entryResult{err: err}
+	}
+
+	encounter, err := FHIRToEncounter(&fhirEncounter)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "%s", err.Error())}
+	}
+
+	id, err := tx.CreateEncounter(encounter)
+	if errors.Is(err, services.ErrInvalidStatusTransition) || errors.Is(err, services.ErrOutsideWorkingHours) || errors.Is(err, services.ErrInactivePractitioner) || errors.Is(err, services.ErrInactiveLocation) || errors.Is(err, services.ErrReferenceNotFound) {
+		return entryResult{err: entryErrorf(http.StatusUnprocessableEntity, "%s", err.Error())}
+	}
+	if errors.Is(err, repository.ErrDuplicateIdentifier) || errors.Is(err, services.ErrInvalidBedAssignment) {
+		return entryResult{err: entryErrorf(http.StatusConflict, "%s", err.Error())}
+	}
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}
+	}
+
+	created, err := tx.GetEncounterByID(id)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}
+	}
+
+	return newEntryResult(http.StatusCreated, "Encounter", id, versionedResource{resource: EncounterToFHIR(*created), versionID: created.VersionID, updatedAt: created.UpdatedAt})
+}
+
+func (s *FHIRServer) updateEncounterEntry(tx *services.Transaction, id string, resource []byte, expectedVersion int) entryResult {
+	var fhirEncounter encpb.Encounter
+	if err := protojson.Unmarshal(resource, &fhirEncounter); err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "Invalid FHIR Encounter format")}
+	}
+
+	if fhirEncounter.Id != nil && fhirEncounter.Id.Value != id {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "Resource id does not match URL")}
+	}
+
+	if err := s.validateEntry(tx, "Encounter", &fhirEncounter); err != nil {
+		return entryResult{err: err}
+	}
+
+	encounter, err := FHIRToEncounter(&fhirEncounter)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "%s", err.Error())}
+	}
+	encounter.ID = id
+
+	if err := tx.UpdateEncounter(encounter, expectedVersion); err != nil {
+		return entryResult{err: updateEntryError("Encounter", err)}
+	}
+
+	updated, err := tx.GetEncounterByID(id)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}
+	}
+
+	return newEntryResult(http.StatusOK, "Encounter", id, versionedResource{resource: EncounterToFHIR(*updated), versionID: updated.VersionID, updatedAt: updated.UpdatedAt})
+}
+
+func (s *FHIRServer) createPractitionerEntry(tx *services.Transaction, resource []byte) entryResult {
+	var fhirPractitioner practpb.Practitioner
+	if err := protojson.Unmarshal(resource, &fhirPractitioner); err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "Invalid FHIR Practitioner format")}
+	}
+
+	if err := s.validateEntry(tx, "Practitioner", &fhirPractitioner); err != nil {
+		return entryResult{err: err}
+	}
+
+	practitioner, err := FHIRToPractitioner(&fhirPractitioner)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "%s", err.Error())}
+	}
+
+	id, err := tx.CreatePractitioner(practitioner)
+	if errors.Is(err, repository.ErrDuplicateIdentifier) {
+		return entryResult{err: entryErrorf(http.StatusConflict, "%s", err.Error())}
+	}
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}
+	}
+
+	created, err := tx.GetPractitionerByID(id)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}
+	}
+
+	return newEntryResult(http.StatusCreated, "Practitioner", id, versionedResource{resource: PractitionerToFHIR(*created), versionID: created.VersionID, updatedAt: created.UpdatedAt})
+}
+
+func (s *FHIRServer) updatePractitionerEntry(tx *services.Transaction, id string, resource []byte, expectedVersion int) entryResult {
+	var fhirPractitioner practpb.Practitioner
+	if err := protojson.Unmarshal(resource, &fhirPractitioner); err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "Invalid FHIR Practitioner format")}
+	}
+
+	if fhirPractitioner.Id != nil && fhirPractitioner.Id.Value != id {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "Resource id does not match URL")}
+	}
+
+	if err := s.validateEntry(tx, "Practitioner", &fhirPractitioner); err != nil {
+		return entryResult{err: err}
+	}
+
+	practitioner, err := FHIRToPractitioner(&fhirPractitioner)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusBadRequest, "%s", err.Error())}
+	}
+	practitioner.ID = id
+
+	if err := tx.UpdatePractitioner(practitioner, expectedVersion); err != nil {
+		return entryResult{err: updateEntryError("Practitioner", err)}
+	}
+
+	updated, err := tx.GetPractitionerByID(id)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "%s", err.Error())}
+	}
+
+	return newEntryResult(http.StatusOK, "Practitioner", id, versionedResource{resource: PractitionerToFHIR(*updated), versionID: updated.VersionID, updatedAt: updated.UpdatedAt})
+}
+
+func newEntryResult(status int, resourceType string, id string, v versionedResource) entryResult {
+	resourceMap, err := protoToMap(v.resource)
+	if err != nil {
+		return entryResult{err: entryErrorf(http.StatusInternalServerError, "Failed to convert %s", resourceType)}
+	}
+
+	return entryResult{
+		status:    status,
+		location:  fmt.Sprintf("%s/%s/_history/%d", resourceType, id, v.versionID),
+		resource:  resourceMap,
+		versionID: v.versionID,
+		updatedAt: v.updatedAt,
+	}
+}
+
+func writeBundleResponse(c *gin.Context, bundleType string, results []entryResult) {
+	entries := make([]map[string]interface{}, 0, len(results))
+	for _, r := range results {
+		if r.err != nil {
+			issues := r.err.issues
+			if len(issues) == 0 {
+				issues = []validationIssue{{severity: severityError, code: "processing", diagnostics: r.err.message}}
+			}
+			entries = append(entries, map[string]interface{}{
+				"response": map[string]interface{}{
+					"status":  fmt.Sprintf("%d %s", r.err.status, http.StatusText(r.err.status)),
+					"outcome": operationOutcome(issues),
+				},
+			})
+			continue
+		}
+
+		entries = append(entries, map[string]interface{}{
+			"fullUrl":  strings.SplitN(r.location, "/_history/", 2)[0],
+			"resource": r.resource,
+			"response": map[string]interface{}{
+				"status":       fmt.Sprintf("%d %s", r.status, http.StatusText(r.status)),
+				"location":     r.location,
+				"etag":         etag(r.versionID),
+				"lastModified": r.updatedAt.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resourceType": "Bundle",
+		"type":         bundleType,
+		"entry":        entries,
+	})
+}
@@ -0,0 +1,182 @@
+package fhir
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func bundleEntryFor(method string, url string) bundleEntry {
+	var e bundleEntry
+	e.Request.Method = method
+	e.Request.URL = url
+	return e
+}
+
+func TestTransactionOrder(t *testing.T) {
+	entries := []bundleEntry{
+		bundleEntryFor(http.MethodGet, "Practitioner/1"),
+		bundleEntryFor(http.MethodPut, "Encounter/2"),
+		bundleEntryFor(http.MethodPost, "Encounter"),
+		bundleEntryFor(http.MethodPost, "Practitioner"),
+		bundleEntryFor("put", "Practitioner/3"),
+	}
+
+	got := transactionOrder(entries)
+	want := []int{3, 2, 4, 1, 0}
+	if len(got) != len(want) {
+		t.Fatalf("transactionOrder() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("transactionOrder() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestParseEntryURL(t *testing.T) {
+	tests := []struct {
+		url              string
+		wantType, wantID string
+	}{
+		{url: "Encounter", wantType: "Encounter"},
+		{url: "Encounter/123", wantType: "Encounter", wantID: "123"},
+		{url: "/Encounter/123/", wantType: "Encounter", wantID: "123"},
+		{url: "http://localhost:8080/fhir/Practitioner/7", wantType: "Practitioner", wantID: "7"},
+	}
+
+	for _, tt := range tests {
+		resourceType, id := parseEntryURL(tt.url)
+		if resourceType != tt.wantType || id != tt.wantID {
+			t.Errorf("parseEntryURL(%q) = %q, %q, want %q, %q", tt.url, resourceType, id, tt.wantType, tt.wantID)
+		}
+	}
+}
+
+func TestProcessEntryRejectsInvalidEntries(t *testing.T) {
+	s := &FHIRServer{}
+
+	unresolved := bundleEntryFor(http.MethodPost, "Encounter")
+	unresolved.Resource = json.RawMessage(`{"subject":{"reference":{"value":"urn:uuid:61ebe359-bfdc-4613-8bf2-c5e300945f0a"}}}`)
+
+	badETag := bundleEntryFor(http.MethodPut, "Encounter/1")
+	badETag.Request.IfMatch = `W/"x"`
+
+	badCriteria := bundleEntryFor(http.MethodPost, "Encounter")
+	badCriteria.Request.IfNoneExist = "identifer=urn:reception:visit|42"
+
+	unconditional := bundleEntryFor(http.MethodPost, "Observation")
+	unconditional.Request.IfNoneExist = "identifier=42"
+
+	tests := []struct {
+		name  string
+		entry bundleEntry
+	}{
+		{name: "unresolved urn reference", entry: unresolved},
+		{name: "invalid ifMatch", entry: badETag},
+		{name: "invalid ifNoneExist", entry: badCriteria},
+		{name: "ifNoneExist of an unsupported resource", entry: unconditional},
+		{name: "unsupported resource", entry: bundleEntryFor(http.MethodPost, "Observation")},
+		{name: "delete", entry: bundleEntryFor(http.MethodDelete, "Encounter/1")},
+		{name: "update without id", entry: bundleEntryFor(http.MethodPut, "Encounter")},
+	}
+
+	for _, tt := range tests {
+		result := s.processEntry(nil, tt.entry, map[string]string{})
+		if result.err == nil || result.err.status != http.StatusBadRequest {
+			t.Errorf("%s: processEntry() error = %v, want a 400 entry error", tt.name, result.err)
+		}
+	}
+}
+
+func TestProcessBundleRejectsInvalidBundles(t *testing.T) {
+	s := &FHIRServer{}
+
+	for _, body := range []string{
+		`not json`,
+		`{"resourceType":"Encounter"}`,
+		`{"resourceType":"Bundle","type":"collection"}`,
+	} {
+		c, w := testContext(http.MethodPost, "/fhir", nil)
+		c.Request.Body = io.NopCloser(strings.NewReader(body))
+		s.ProcessBundle(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ProcessBundle(%s) status = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestWriteBundleResponse(t *testing.T) {
+	updated := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	results := []entryResult{
+		{
+			status:    http.StatusCreated,
+			location:  "Encounter/1/_history/1",
+			resource:  map[string]interface{}{"id": map[string]interface{}{"value": "1"}},
+			versionID: 1,
+			updatedAt: updated,
+		},
+		{err: entryErrorf(http.StatusNotFound, "Practitioner not found")},
+		{err: &entryError{
+			status:  http.StatusUnprocessableEntity,
+			message: "Encounter.status is required",
+			issues: []validationIssue{
+				{severity: severityError, code: "required", expression: "Encounter.status", diagnostics: "Encounter.status is required"},
+				{severity: severityWarning, code: "invariant", expression: "Encounter.participant", diagnostics: "his-enc-3: only the first participant is recorded"},
+			},
+		}},
+	}
+
+	c, w := testContext(http.MethodPost, "/fhir", nil)
+	writeBundleResponse(c, "batch-response", results)
+
+	var bundle struct {
+		ResourceType string `json:"resourceType"`
+		Type         string `json:"type"`
+		Entry        []struct {
+			FullURL  string `json:"fullUrl"`
+			Response struct {
+				Status       string `json:"status"`
+				Location     string `json:"location"`
+				ETag         string `json:"etag"`
+				LastModified string `json:"lastModified"`
+				Outcome      struct {
+					Issue []struct {
+						Code        string `json:"code"`
+						Diagnostics string `json:"diagnostics"`
+					} `json:"issue"`
+				} `json:"outcome"`
+			} `json:"response"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+
+	if bundle.ResourceType != "Bundle" || bundle.Type != "batch-response" || len(bundle.Entry) != 3 {
+		t.Fatalf("response = %s, want a batch-response Bundle with 3 entries", w.Body.String())
+	}
+
+	created := bundle.Entry[0]
+	if created.FullURL != "Encounter/1" || created.Response.Status != "201 Created" ||
+		created.Response.Location != "Encounter/1/_history/1" || created.Response.ETag != `W/"1"` ||
+		created.Response.LastModified != "2024-01-01T10:00:00Z" {
+		t.Errorf("created entry = %+v", created)
+	}
+
+	failed := bundle.Entry[1]
+	if failed.Response.Status != "404 Not Found" || len(failed.Response.Outcome.Issue) != 1 ||
+		failed.Response.Outcome.Issue[0].Code != "processing" ||
+		failed.Response.Outcome.Issue[0].Diagnostics != "Practitioner not found" {
+		t.Errorf("failed entry = %+v", failed)
+	}
+
+	invalid := bundle.Entry[2]
+	if invalid.Response.Status != "422 Unprocessable Entity" || len(invalid.Response.Outcome.Issue) != 2 ||
+		invalid.Response.Outcome.Issue[0].Code != "required" || invalid.Response.Outcome.Issue[1].Code != "invariant" {
+		t.Errorf("invalid entry = %+v, want the validator's issues", invalid)
+	}
+}
@@ -0,0 +1,243 @@
+package fhir
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	cspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/capability_statement_go_proto"
+	vspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/valuesets_go_proto"
+)
+
+const fhirBasePath = "/fhir"
+
+type resourceInteraction = vspb.TypeRestfulInteractionValueSet_Value
+
+// capabilityBuilder collects what the registered routes expose per
+// resource type before it is turned into a CapabilityStatement.
+type capabilityBuilder struct {
+	resources          map[string]*resourceCapability
+	systemInteractions []vspb.SystemRestfulInteractionValueSet_Value
+	systemOperations   []string
+}
+
+type resourceCapability struct {
+	interactions      map[resourceInteraction]bool
+	operations        []string
+	conditionalUpdate bool
+}
+
+func (b *capabilityBuilder) resource(resourceType string) *resourceCapability {
+	r, ok := b.resources[resourceType]
+	if !ok {
+		r = &resourceCapability{interactions: map[resourceInteraction]bool{}}
+		b.resources[resourceType] = r
+	}
+	return r
+}
+
+// SetRoutes builds the CapabilityStatement served at /fhir/metadata from
+// the routes registered on the engine, so the statement can never
+// advertise something the server does not actually handle.
+func (s *FHIRServer) SetRoutes(routes gin.RoutesInfo) {
+	b := &capabilityBuilder{resources: map[string]*resourceCapability{}}
+	for _, route := range routes {
+		if path, ok := strings.CutPrefix(route.Path, fhirBasePath); ok {
+			b.addRoute(route.Method, strings.Trim(path, "/"))
+		}
+	}
+	s.capabilityStatement = b.build(time.Now())
+}
+
+func (b *capabilityBuilder) addRoute(method string, path string) {
+	if path == "" {
+		if method == http.MethodPost {
+			b.systemInteractions = append(b.systemInteractions,
+				vspb.SystemRestfulInteractionValueSet_TRANSACTION,
+				vspb.SystemRestfulInteractionValueSet_BATCH,
+			)
+		}
+		return
+	}
+
+	segments := strings.Split(path, "/")
+	if strings.HasPrefix(segments[0], "$") {
+		b.systemOperations = append(b.systemOperations, strings.TrimPrefix(segments[0], "$"))
+		return
+	}
+
+	resourceType := segments[0]
+	if _, ok := resourceTypeCode(resourceType); !ok {
+		return
+	}
+
+	r := b.resource(resourceType)
+	last := segments[len(segments)-1]
+	if strings.HasPrefix(last, "$") {
+		r.operations = append(r.operations, strings.TrimPrefix(last, "$"))
+		return
+	}
+
+	switch {
+	case len(segments) == 1 && method == http.MethodGet:
+		r.interactions[vspb.TypeRestfulInteractionValueSet_SEARCH_TYPE] = true
+	case len(segments) == 1 && method == http.MethodPost:
+		r.interactions[vspb.TypeRestfulInteractionValueSet_CREATE] = true
+	case len(segments) == 1 && method == http.MethodPut:
+		r.interactions[vspb.TypeRestfulInteractionValueSet_UPDATE] = true
+		r.conditionalUpdate = true
+	case len(segments) == 2 && last == "_history":
+		r.interactions[vspb.TypeRestfulInteractionValueSet_HISTORY_TYPE] = true
+	case len(segments) == 2 && method == http.MethodGet:
+		r.interactions[vspb.TypeRestfulInteractionValueSet_READ] = true
+	case len(segments) == 2 && method == http.MethodPut:
+		r.interactions[vspb.TypeRestfulInteractionValueSet_UPDATE] = true
+	case len(segments) == 2 && method == http.MethodPatch:
+		r.interactions[vspb.TypeRestfulInteractionValueSet_PATCH] = true
+	case len(segments) == 2 && method == http.MethodDelete:
+		r.interactions[vspb.TypeRestfulInteractionValueSet_DELETE] = true
+	case len(segments) == 3 && last == "_history":
+		r.interactions[vspb.TypeRestfulInteractionValueSet_HISTORY_INSTANCE] = true
+	case len(segments) == 4 && segments[2] == "_history":
+		r.interactions[vspb.TypeRestfulInteractionValueSet_VREAD] = true
+	}
+}
+
+func (b *capabilityBuilder) build(now time.Time) *cspb.CapabilityStatement {
+	rest := &cspb.CapabilityStatement_Rest{
+		Mode: &cspb.CapabilityStatement_Rest_ModeCode{Value: codespb.RestfulCapabilityModeCode_SERVER},
+	}
+
+	resourceTypes := make([]string, 0, len(b.resources))
+	for resourceType := range b.resources {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+
+	for _, resourceType := range resourceTypes {
+		rest.Resource = append(rest.Resource, buildResourceCapability(resourceType, b.resources[resourceType]))
+	}
+
+	for _, code := range b.systemInteractions {
+		rest.Interaction = append(rest.Interaction, &cspb.CapabilityStatement_Rest_SystemInteraction{
+			Code: &cspb.CapabilityStatement_Rest_SystemInteraction_CodeType{Value: code},
+		})
+	}
+
+	for _, name := range b.systemOperations {
+		rest.Operation = append(rest.Operation, operationCapability(name, name))
+	}
+
+	return &cspb.CapabilityStatement{
+		Status: &cspb.CapabilityStatement_StatusCode{Value: codespb.PublicationStatusCode_ACTIVE},
+		Date: &dtpb.DateTime{
+			ValueUs:   now.UnixMicro(),
+			Timezone:  "UTC",
+			Precision: dtpb.DateTime_SECOND,
+		},
+		Kind: &cspb.CapabilityStatement_KindCode{Value: codespb.CapabilityStatementKindCode_INSTANCE},
+		Software: &cspb.CapabilityStatement_Software{
+			Name: &dtpb.String{Value: "hospital-srv"},
+		},
+		FhirVersion: &cspb.CapabilityStatement_FhirVersionCode{Value: codespb.FHIRVersionCode_V_4_0_1},
+		Format: []*cspb.CapabilityStatement_FormatCode{
+			{Value: "json"},
+			{Value: "xml"},
+		},
+		PatchFormat: []*cspb.CapabilityStatement_PatchFormatCode{
+			{Value: contentTypeJSONPatch},
+			{Value: contentTypeFHIRJSON},
+		},
+		Rest: []*cspb.CapabilityStatement_Rest{rest},
+	}
+}
+
+func buildResourceCapability(resourceType string, r *resourceCapability) *cspb.CapabilityStatement_Rest_Resource {
+	typeCode, _ := resourceTypeCode(resourceType)
+	resource := &cspb.CapabilityStatement_Rest_Resource{
+		Type: &cspb.CapabilityStatement_Rest_Resource_TypeCode{Value: typeCode},
+	}
+
+	interactions := make([]resourceInteraction, 0, len(r.interactions))
+	for code := range r.interactions {
+		interactions = append(interactions, code)
+	}
+	sort.Slice(interactions, func(i, j int) bool { return interactions[i] < interactions[j] })
+
+	for _, code := range interactions {
+		resource.Interaction = append(resource.Interaction, &cspb.CapabilityStatement_Rest_Resource_ResourceInteraction{
+			Code: &cspb.CapabilityStatement_Rest_Resource_ResourceInteraction_CodeType{Value: code},
+		})
+	}
+
+	if r.interactions[vspb.TypeRestfulInteractionValueSet_CREATE] && conditionalCreates[resourceType] {
+		resource.ConditionalCreate = &dtpb.Boolean{Value: true}
+	}
+	if r.conditionalUpdate {
+		resource.ConditionalUpdate = &dtpb.Boolean{Value: true}
+	}
+
+	if r.interactions[vspb.TypeRestfulInteractionValueSet_VREAD] {
+		resource.Versioning = &cspb.CapabilityStatement_Rest_Resource_VersioningCode{Value: codespb.ResourceVersionPolicyCode_VERSIONED}
+		resource.ReadHistory = &dtpb.Boolean{Value: true}
+	}
+
+	if r.interactions[vspb.TypeRestfulInteractionValueSet_SEARCH_TYPE] {
+		for _, p := range searchParams[resourceType] {
+			resource.SearchParam = append(resource.SearchParam, &cspb.CapabilityStatement_Rest_Resource_SearchParam{
+				Name:          &dtpb.String{Value: p.name},
+				Type:          &cspb.CapabilityStatement_Rest_Resource_SearchParam_TypeCode{Value: p.paramType},
+				Documentation: &dtpb.Markdown{Value: p.documentation},
+			})
+		}
+		for _, include := range searchIncludes[resourceType] {
+			resource.SearchInclude = append(resource.SearchInclude, &dtpb.String{Value: include})
+		}
+		for _, include := range searchRevIncludes[resourceType] {
+			resource.SearchRevInclude = append(resource.SearchRevInclude, &dtpb.String{Value: include})
+		}
+	}
+
+	for _, name := range r.operations {
+		resource.Operation = append(resource.Operation, operationCapability(name, resourceType+"-"+name))
+	}
+
+	return resource
+}
+
+func operationCapability(name string, definition string) *cspb.CapabilityStatement_Rest_Resource_Operation {
+	return &cspb.CapabilityStatement_Rest_Resource_Operation{
+		Name:       &dtpb.String{Value: name},
+		Definition: &dtpb.Canonical{Value: "http://hl7.org/fhir/OperationDefinition/" + definition},
+	}
+}
+
+// resourceTypeCode maps a resource name such as "PractitionerRole" to its
+// ResourceTypeCode enum value (PRACTITIONER_ROLE).
+func resourceTypeCode(resourceType string) (codespb.ResourceTypeCode_Value, bool) {
+	var name strings.Builder
+	for i, r := range resourceType {
+		if i > 0 && unicode.IsUpper(r) {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+
+	value, ok := codespb.ResourceTypeCode_Value_value[name.String()]
+	return codespb.ResourceTypeCode_Value(value), ok
+}
+
+func (s *FHIRServer) Metadata(c *gin.Context) {
+	resourceMap, err := protoToMap(s.capabilityStatement)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert capability statement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resourceMap)
+}
@@ -0,0 +1,100 @@
+package fhir
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	vspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/valuesets_go_proto"
+)
+
+func TestResourceTypeCode(t *testing.T) {
+	tests := []struct {
+		resourceType string
+		want         codespb.ResourceTypeCode_Value
+		wantOK       bool
+	}{
+		{resourceType: "Encounter", want: codespb.ResourceTypeCode_ENCOUNTER, wantOK: true},
+		{resourceType: "PractitionerRole", want: codespb.ResourceTypeCode_PRACTITIONER_ROLE, wantOK: true},
+		{resourceType: "MedicationRequest", want: codespb.ResourceTypeCode_MEDICATION_REQUEST, wantOK: true},
+		{resourceType: "Ward", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := resourceTypeCode(tt.resourceType)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("resourceTypeCode(%q) = %v, %v, want %v, %v", tt.resourceType, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCapabilityFromRoutes(t *testing.T) {
+	s := &FHIRServer{}
+	s.SetRoutes(gin.RoutesInfo{
+		{Method: http.MethodPost, Path: "/fhir"},
+		{Method: http.MethodGet, Path: "/fhir/metadata"},
+		{Method: http.MethodGet, Path: "/fhir/Encounter"},
+		{Method: http.MethodPost, Path: "/fhir/Encounter"},
+		{Method: http.MethodGet, Path: "/fhir/Encounter/:id"},
+		{Method: http.MethodPatch, Path: "/fhir/Encounter/:id"},
+		{Method: http.MethodGet, Path: "/fhir/Encounter/:id/_history"},
+		{Method: http.MethodGet, Path: "/fhir/Encounter/:id/_history/:vid"},
+		{Method: http.MethodGet, Path: "/fhir/Patient/:id/$everything"},
+		{Method: http.MethodGet, Path: "/fhir/Ward/:id"},
+		{Method: http.MethodGet, Path: "/api/encounters"},
+	})
+
+	rest := s.capabilityStatement.GetRest()[0]
+	if got := len(rest.GetInteraction()); got != 2 {
+		t.Errorf("system interactions = %d, want transaction and batch", got)
+	}
+
+	resources := map[codespb.ResourceTypeCode_Value][]resourceInteraction{}
+	for _, r := range rest.GetResource() {
+		for _, i := range r.GetInteraction() {
+			resources[r.GetType().GetValue()] = append(resources[r.GetType().GetValue()], i.GetCode().GetValue())
+		}
+	}
+	if len(resources) != 1 {
+		t.Fatalf("resources = %v, want only Encounter with interactions", resources)
+	}
+
+	want := []resourceInteraction{
+		vspb.TypeRestfulInteractionValueSet_READ,
+		vspb.TypeRestfulInteractionValueSet_VREAD,
+		vspb.TypeRestfulInteractionValueSet_PATCH,
+		vspb.TypeRestfulInteractionValueSet_HISTORY_INSTANCE,
+		vspb.TypeRestfulInteractionValueSet_CREATE,
+		vspb.TypeRestfulInteractionValueSet_SEARCH_TYPE,
+	}
+	got := resources[codespb.ResourceTypeCode_ENCOUNTER]
+	for _, code := range want {
+		found := false
+		for _, g := range got {
+			found = found || g == code
+		}
+		if !found {
+			t.Errorf("Encounter interactions %v lack %v", got, code)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("Encounter interactions = %v, want %v", got, want)
+	}
+
+	for _, r := range rest.GetResource() {
+		switch r.GetType().GetValue() {
+		case codespb.ResourceTypeCode_ENCOUNTER:
+			if len(r.GetSearchParam()) != len(searchParams["Encounter"]) {
+				t.Errorf("Encounter search params = %d, want %d", len(r.GetSearchParam()), len(searchParams["Encounter"]))
+			}
+			if !r.GetReadHistory().GetValue() {
+				t.Errorf("Encounter readHistory = false, want true")
+			}
+		case codespb.ResourceTypeCode_PATIENT:
+			if ops := r.GetOperation(); len(ops) != 1 || ops[0].GetName().GetValue() != "everything" {
+				t.Errorf("Patient operations = %v, want everything", ops)
+			}
+		}
+	}
+}
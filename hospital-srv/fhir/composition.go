@@ -0,0 +1,38 @@
+package fhir
+
+import (
+	"fmt"
+	"hospital-srv/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	comppb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/composition_go_proto"
+)
+
+func (s *FHIRServer) compositions() resourceHandler[models.ClinicalNote, models.ClinicalNoteFilter, *comppb.Composition] {
+	return resourceHandler[models.ClinicalNote, models.ClinicalNoteFilter, *comppb.Composition]{
+		resourceType: "Composition",
+		toFHIR:       ClinicalNoteToFHIR,
+		fromFHIR:     FHIRToClinicalNote,
+		parseSearch:  parseCompositionSearch,
+		meta: func(note models.ClinicalNote) (string, int, time.Time) {
+			return note.ID, note.VersionID, note.UpdatedAt
+		},
+		describe: func(note models.ClinicalNote) string {
+			return fmt.Sprintf("(%s) for encounter %s", note.Status, note.EncounterID)
+		},
+		create:  s.noteService.CreateClinicalNote,
+		get:     s.noteService.GetClinicalNoteByID,
+		search:  s.noteService.SearchClinicalNotes,
+		update:  s.noteService.UpdateClinicalNote,
+		history: s.noteService.GetClinicalNoteHistory,
+		version: s.noteService.GetClinicalNoteVersion,
+	}
+}
+
+func (s *FHIRServer) CreateComposition(c *gin.Context)     { s.compositions().handleCreate(c) }
+func (s *FHIRServer) GetCompositions(c *gin.Context)       { s.compositions().handleSearch(c) }
+func (s *FHIRServer) GetComposition(c *gin.Context)        { s.compositions().handleRead(c) }
+func (s *FHIRServer) UpdateComposition(c *gin.Context)     { s.compositions().handleUpdate(c) }
+func (s *FHIRServer) GetCompositionHistory(c *gin.Context) { s.compositions().handleHistory(c) }
+func (s *FHIRServer) GetCompositionVersion(c *gin.Context) { s.compositions().handleVersion(c) }
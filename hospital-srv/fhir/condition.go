@@ -0,0 +1,38 @@
+package fhir
+
+import (
+	"fmt"
+	"hospital-srv/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	condpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/condition_go_proto"
+)
+
+func (s *FHIRServer) conditions() resourceHandler[models.Condition, models.ConditionFilter, *condpb.Condition] {
+	return resourceHandler[models.Condition, models.ConditionFilter, *condpb.Condition]{
+		resourceType: "Condition",
+		toFHIR:       ConditionToFHIR,
+		fromFHIR:     FHIRToCondition,
+		parseSearch:  parseConditionSearch,
+		meta: func(condition models.Condition) (string, int, time.Time) {
+			return condition.ID, condition.VersionID, condition.UpdatedAt
+		},
+		describe: func(condition models.Condition) string {
+			return fmt.Sprintf("(%s) for patient %s", condition.Code, condition.PatientID)
+		},
+		create:  s.conditionService.CreateCondition,
+		get:     s.conditionService.GetConditionByID,
+		search:  s.conditionService.SearchConditions,
+		update:  s.conditionService.UpdateCondition,
+		history: s.conditionService.GetConditionHistory,
+		version: s.conditionService.GetConditionVersion,
+	}
+}
+
+func (s *FHIRServer) CreateCondition(c *gin.Context)     { s.conditions().handleCreate(c) }
+func (s *FHIRServer) GetConditions(c *gin.Context)       { s.conditions().handleSearch(c) }
+func (s *FHIRServer) GetCondition(c *gin.Context)        { s.conditions().handleRead(c) }
+func (s *FHIRServer) UpdateCondition(c *gin.Context)     { s.conditions().handleUpdate(c) }
+func (s *FHIRServer) GetConditionHistory(c *gin.Context) { s.conditions().handleHistory(c) }
+func (s *FHIRServer) GetConditionVersion(c *gin.Context) { s.conditions().handleVersion(c) }
@@ -0,0 +1,240 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/services"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// headerIfNoneExist carries the search criteria of a conditional create,
+// e.g. "identifier=urn:reception:visit|42".
+const headerIfNoneExist = "If-None-Exist"
+
+// conditionalCreates lists the resource types whose create honors
+// If-None-Exist.
+var conditionalCreates = map[string]bool{"Encounter": true, "Practitioner": true}
+
+var errInvalidCriteria = errors.New("invalid search criteria")
+
+type conditionalMatch struct {
+	id string
+	versionedResource
+}
+
+// resourceSearcher runs the searches of conditional interactions: the
+// services for a standalone request, the services.Transaction for a Bundle
+// entry, so that resources created earlier in the Bundle are found.
+type resourceSearcher interface {
+	SearchEncounters(filter models.EncounterFilter) ([]models.EncounterWithDetails, error)
+	SearchPractitioners(filter models.PractitionerFilter) ([]models.Practitioner, error)
+}
+
+// serviceSearcher searches outside any transaction.
+type serviceSearcher struct {
+	*services.EncounterService
+	*services.PractitionerService
+}
+
+// parseCriteria parses the search criteria of a conditional interaction.
+// Unlike a search, criteria must be given and every parameter must be
+// supported, so that a mistyped parameter cannot match everything.
+func parseCriteria(resourceType string, criteria string) (url.Values, error) {
+	if _, rest, ok := strings.Cut(criteria, "?"); ok {
+		criteria = rest
+	}
+
+	query, err := url.ParseQuery(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidCriteria, err)
+	}
+	if len(query) == 0 {
+		return nil, fmt.Errorf("%w: no search parameters given", errInvalidCriteria)
+	}
+
+	for name := range query {
+		supported := false
+		for _, p := range searchParams[resourceType] {
+			supported = supported || p.name == name
+		}
+		if !supported {
+			return nil, fmt.Errorf("%w: unsupported search parameter %s", errInvalidCriteria, name)
+		}
+	}
+
+	return query, nil
+}
+
+// criteriaFromQuery returns the search criteria in the query of a
+// conditional update, without the parameters such as _format that only
+// shape the response.
+func criteriaFromQuery(resourceType string, query url.Values) string {
+	criteria := url.Values{}
+	for name, values := range query {
+		if strings.HasPrefix(name, "_") && !slices.ContainsFunc(searchParams[resourceType], func(p searchParam) bool { return p.name == name }) {
+			continue
+		}
+		criteria[name] = values
+	}
+	return criteria.Encode()
+}
+
+// conditionalMatches returns the resources matching the criteria of a
+// conditional interaction.
+func (s *FHIRServer) conditionalMatches(resourceType string, criteria string) ([]conditionalMatch, error) {
+	return searchMatches(serviceSearcher{s.encounterService, s.practitionerService}, resourceType, criteria)
+}
+
+// searchMatches returns the resources searcher finds for the criteria of a
+// conditional interaction.
+func searchMatches(searcher resourceSearcher, resourceType string, criteria string) ([]conditionalMatch, error) {
+	query, err := parseCriteria(resourceType, criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []conditionalMatch
+	switch resourceType {
+	case "Encounter":
+		filter, err := parseEncounterSearch(query)
+		if errors.Is(err, errNoMatch) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidCriteria, err)
+		}
+
+		encounters, err := searcher.SearchEncounters(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range encounters {
+			matches = append(matches, conditionalMatch{id: e.ID, versionedResource: versionedResource{resource: EncounterToFHIR(e), versionID: e.VersionID, updatedAt: e.UpdatedAt}})
+		}
+	case "Practitioner":
+		filter, err := parsePractitionerSearch(query)
+		if errors.Is(err, errNoMatch) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidCriteria, err)
+		}
+
+		practitioners, err := searcher.SearchPractitioners(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range practitioners {
+			matches = append(matches, conditionalMatch{id: p.ID, versionedResource: versionedResource{resource: PractitionerToFHIR(p), versionID: p.VersionID, updatedAt: p.UpdatedAt}})
+		}
+	default:
+		return nil, fmt.Errorf("%w: conditional interactions are not supported for %s", errInvalidCriteria, resourceType)
+	}
+
+	return matches, nil
+}
+
+// writeConditionalError answers a conditional interaction whose search
+// failed or matched more than one resource, and reports whether it did.
+func writeConditionalError(c *gin.Context, resourceType string, matches []conditionalMatch, err error) bool {
+	switch {
+	case errors.Is(err, errInvalidCriteria):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case len(matches) > 1:
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": fmt.Sprintf("criteria match %d %s resources", len(matches), resourceType)})
+	default:
+		return false
+	}
+	return true
+}
+
+// ifNoneExist answers a create whose If-None-Exist criteria match an
+// existing resource, which write sends back, and reports whether it did.
+// Without the header, or without a match, the create goes ahead.
+func (s *FHIRServer) ifNoneExist(c *gin.Context, resourceType string, write func(*gin.Context, conditionalMatch)) bool {
+	criteria := c.GetHeader(headerIfNoneExist)
+	if criteria == "" {
+		return false
+	}
+
+	matches, err := s.conditionalMatches(resourceType, criteria)
+	if writeConditionalError(c, resourceType, matches, err) {
+		return true
+	}
+	if len(matches) == 0 {
+		return false
+	}
+
+	log.Printf("%s %s already exists, create skipped", resourceType, matches[0].id)
+	write(c, matches[0])
+	return true
+}
+
+// writeEncounterMatch answers like a create of the encounter, but with 200.
+func writeEncounterMatch(c *gin.Context, match conditionalMatch) {
+	setVersionHeaders(c, match.versionID, match.updatedAt)
+	c.JSON(http.StatusOK, gin.H{"id": match.id})
+}
+
+func writePractitionerMatch(c *gin.Context, match conditionalMatch) {
+	writeVersionedResource(c, match.versionedResource)
+}
+
+// ConditionalUpdateEncounter implements PUT /Encounter?criteria. A single
+// match is updated. Without a match the encounter is created, unless the
+// body names an id, which cannot be assigned by clients.
+func (s *FHIRServer) ConditionalUpdateEncounter(c *gin.Context) {
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	log.Printf("Received FHIR Encounter conditional update (%s): %s", c.Request.URL.RawQuery, strings.ReplaceAll(string(body), "\n", " "))
+
+	var fhirEncounter encpb.Encounter
+	if err := protojson.Unmarshal(body, &fhirEncounter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Encounter format"})
+		return
+	}
+
+	matches, err := s.conditionalMatches("Encounter", criteriaFromQuery("Encounter", c.Request.URL.Query()))
+	if writeConditionalError(c, "Encounter", matches, err) {
+		return
+	}
+
+	if len(matches) == 0 {
+		if fhirEncounter.Id != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Encounter not found"})
+			return
+		}
+		s.createEncounter(c, &fhirEncounter)
+		return
+	}
+
+	id := matches[0].id
+	if fhirEncounter.Id != nil && fhirEncounter.Id.Value != id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Resource id does not match the matched Encounter"})
+		return
+	}
+
+	s.saveEncounter(c, id, &fhirEncounter, expectedVersion)
+}
@@ -0,0 +1,119 @@
+package fhir
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseCriteria(t *testing.T) {
+	tests := []struct {
+		resourceType string
+		criteria     string
+		wantErr      bool
+	}{
+		{resourceType: "Encounter", criteria: "identifier=urn:reception:visit|42"},
+		{resourceType: "Encounter", criteria: "Encounter?identifier=urn:reception:visit|42&status=planned"},
+		{resourceType: "Practitioner", criteria: "identifier=123"},
+		{resourceType: "Encounter", criteria: "", wantErr: true},
+		{resourceType: "Encounter", criteria: "Encounter?", wantErr: true},
+		{resourceType: "Encounter", criteria: "identifer=42", wantErr: true},
+		{resourceType: "Encounter", criteria: "identifier=%zz", wantErr: true},
+		{resourceType: "Practitioner", criteria: "status=planned", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		query, err := parseCriteria(tt.resourceType, tt.criteria)
+		if tt.wantErr {
+			if !errors.Is(err, errInvalidCriteria) {
+				t.Errorf("parseCriteria(%s, %q) error = %v, want errInvalidCriteria", tt.resourceType, tt.criteria, err)
+			}
+			continue
+		}
+		if err != nil || len(query) == 0 {
+			t.Errorf("parseCriteria(%s, %q) = %v, %v, want parameters", tt.resourceType, tt.criteria, query, err)
+		}
+	}
+}
+
+func TestCriteriaFromQuery(t *testing.T) {
+	tests := []struct {
+		resourceType string
+		query        string
+		want         string
+	}{
+		{resourceType: "Encounter", query: "identifier=urn:reception:visit|42", want: "identifier=urn%3Areception%3Avisit%7C42"},
+		{resourceType: "Encounter", query: "identifier=42&_format=json&_pretty=true", want: "identifier=42"},
+		{resourceType: "Encounter", query: "_format=xml", want: ""},
+		{resourceType: "Patient", query: "_id=p1&_format=json", want: "_id=p1"},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		if got := criteriaFromQuery(tt.resourceType, query); got != tt.want {
+			t.Errorf("criteriaFromQuery(%s, %q) = %q, want %q", tt.resourceType, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestWriteConditionalError(t *testing.T) {
+	tests := []struct {
+		name       string
+		matches    []conditionalMatch
+		err        error
+		wantStatus int
+	}{
+		{name: "no match", wantStatus: 0},
+		{name: "one match", matches: []conditionalMatch{{id: "e1"}}, wantStatus: 0},
+		{name: "several matches", matches: []conditionalMatch{{id: "e1"}, {id: "e2"}}, wantStatus: http.StatusPreconditionFailed},
+		{name: "invalid criteria", err: errInvalidCriteria, wantStatus: http.StatusBadRequest},
+		{name: "search failed", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		c, w := testContext(http.MethodPost, "/fhir/Encounter", nil)
+		written := writeConditionalError(c, "Encounter", tt.matches, tt.err)
+		if written != (tt.wantStatus != 0) {
+			t.Errorf("%s: writeConditionalError() = %v, want %v", tt.name, written, tt.wantStatus != 0)
+			continue
+		}
+		if written && w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestIfNoneExist(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantWritten bool
+		wantStatus  int
+	}{
+		{name: "no header"},
+		{name: "unsupported parameter", header: "identifer=42", wantWritten: true, wantStatus: http.StatusBadRequest},
+		{name: "unsupported type", header: "_id=42", wantWritten: true, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.header != "" {
+			header.Set(headerIfNoneExist, tt.header)
+		}
+		c, w := testContext(http.MethodPost, "/fhir/Patient", header)
+
+		written := (&FHIRServer{}).ifNoneExist(c, "Patient", func(*gin.Context, conditionalMatch) {
+			t.Errorf("%s: write called without a match", tt.name)
+		})
+		if written != tt.wantWritten {
+			t.Errorf("%s: ifNoneExist() = %v, want %v", tt.name, written, tt.wantWritten)
+			continue
+		}
+		if written && w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package fhir
+
+import (
+	"hospital-srv/models"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseEverythingPeriod reads the start and end parameters of $everything.
+// Each covers its whole precision, so end=2024-03 includes all of March.
+func parseEverythingPeriod(query url.Values) (models.EncounterFilter, error) {
+	var filter models.EncounterFilter
+
+	if value := query.Get("start"); value != "" {
+		start, _, err := parseDateRange(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.StartFrom = &start
+	}
+
+	if value := query.Get("end"); value != "" {
+		_, end, err := parseDateRange(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.StartBefore = &end
+	}
+
+	return filter, nil
+}
+
+// PatientEverything implements Patient/:id/$everything: the patient, their
+// encounters within the optional start/end period, every practitioner
+// those encounters reference, the visit notes written for those encounters,
+// and the patient's conditions and prescriptions, except those made in an
+// encounter outside the period.
+func (s *FHIRServer) PatientEverything(c *gin.Context) {
+	id := c.Param("id")
+
+	filter, err := parseEverythingPeriod(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patient, err := s.patientService.GetPatientByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+
+	filter.PatientID = id
+	encounters, err := s.encounterService.SearchEncounters(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	conditions, err := s.conditionService.SearchConditions(models.ConditionFilter{PatientID: id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	notes, err := s.noteService.SearchClinicalNotes(models.ClinicalNoteFilter{PatientID: id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	prescriptions, err := s.medicationService.SearchMedicationRequests(models.MedicationRequestFilter{PatientID: id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle := newSearchset()
+	bundle.addMatch("Patient", patient.ID, PatientToFHIR(*patient))
+
+	inPeriod := make(map[string]bool, len(encounters))
+	for _, e := range encounters {
+		bundle.addMatch("Encounter", e.ID, EncounterToFHIR(e))
+		inPeriod[e.ID] = true
+	}
+	for _, e := range encounters {
+		bundle.addMatch("Practitioner", e.Practitioner.ID, PractitionerToFHIR(e.Practitioner))
+	}
+	for _, condition := range conditions {
+		if condition.EncounterID == nil || inPeriod[*condition.EncounterID] {
+			bundle.addMatch("Condition", condition.ID, ConditionToFHIR(condition))
+		}
+	}
+	for _, note := range notes {
+		if inPeriod[note.EncounterID] {
+			bundle.addMatch("Composition", note.ID, ClinicalNoteToFHIR(note))
+		}
+	}
+	for _, prescription := range prescriptions {
+		if prescription.EncounterID == nil || inPeriod[*prescription.EncounterID] {
+			bundle.addMatch("MedicationRequest", prescription.ID, MedicationRequestToFHIR(prescription))
+		}
+	}
+
+	bundle.write(c)
+}
@@ -0,0 +1,46 @@
+package fhir
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseEverythingPeriod(t *testing.T) {
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	newYear := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query      string
+		wantFrom   *time.Time
+		wantBefore *time.Time
+		wantErr    bool
+	}{
+		{query: ""},
+		{query: "start=2024-03", wantFrom: &march},
+		{query: "end=2024-03", wantBefore: &april},
+		{query: "start=2024&end=2024-03", wantFrom: &newYear, wantBefore: &april},
+		{query: "start=march", wantErr: true},
+		{query: "end=2024-13", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter, err := parseEverythingPeriod(query)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseEverythingPeriod(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !sameTime(filter.StartFrom, tt.wantFrom) || !sameTime(filter.StartBefore, tt.wantBefore) {
+			t.Errorf("parseEverythingPeriod(%q) = [%v, %v), want [%v, %v)", tt.query, filter.StartFrom, filter.StartBefore, tt.wantFrom, tt.wantBefore)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package fhir
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/services"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+)
+
+// exportTypes lists the resource types $export can write, in the order
+// their files are written.
+var exportTypes = []string{"Patient", "Practitioner", "Encounter"}
+
+// exportFormats are the accepted values of _outputFormat, all meaning
+// NDJSON.
+var exportFormats = []string{"application/fhir+ndjson", "application/ndjson", "ndjson"}
+
+// ResourceExporter writes patients, practitioners and encounters as NDJSON
+// for bulk data exports.
+type ResourceExporter struct {
+	patientService      *services.PatientService
+	practitionerService *services.PractitionerService
+	encounterService    *services.EncounterService
+}
+
+func NewResourceExporter(patientService *services.PatientService, practitionerService *services.PractitionerService, encounterService *services.EncounterService) *ResourceExporter {
+	return &ResourceExporter{
+		patientService:      patientService,
+		practitionerService: practitionerService,
+		encounterService:    encounterService,
+	}
+}
+
+// ExportResources writes one resource per line in FHIR JSON, as the bulk
+// data format requires, whichever JSON the REST API serves by default.
+func (e *ResourceExporter) ExportResources(resourceType string, since *time.Time, w io.Writer) (int, error) {
+	var resources []proto.Message
+	switch resourceType {
+	case "Patient":
+		patients, err := e.patientService.SearchPatients(models.PatientFilter{UpdatedSince: since})
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range patients {
+			resources = append(resources, PatientToFHIR(p))
+		}
+	case "Practitioner":
+		practitioners, err := e.practitionerService.SearchPractitioners(models.PractitionerFilter{UpdatedSince: since})
+		if err != nil {
+			return 0, err
+		}
+		for _, p := range practitioners {
+			resources = append(resources, PractitionerToFHIR(p))
+		}
+	case "Encounter":
+		encounters, err := e.encounterService.SearchEncounters(models.EncounterFilter{UpdatedSince: since})
+		if err != nil {
+			return 0, err
+		}
+		for _, encounter := range encounters {
+			resources = append(resources, EncounterToFHIR(encounter))
+		}
+	default:
+		return 0, fmt.Errorf("unsupported export type: %s", resourceType)
+	}
+
+	if err := writeNDJSON(w, resources); err != nil {
+		return 0, err
+	}
+	return len(resources), nil
+}
+
+// writeNDJSON writes resources to w as FHIR JSON, one per line.
+func writeNDJSON(w io.Writer, resources []proto.Message) error {
+	for _, resource := range resources {
+		line, err := marshalFHIRJSON(resource)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseExportRequest reads the _type, _since and _outputFormat parameters
+// of $export. Without _type every type in exportTypes is exported.
+func parseExportRequest(c *gin.Context) ([]string, *time.Time, error) {
+	if !strings.Contains(c.GetHeader("Prefer"), "respond-async") {
+		return nil, nil, errors.New("$export requires the Prefer: respond-async header")
+	}
+
+	query := c.Request.URL.Query()
+	if value := query.Get("_outputFormat"); value != "" && !slices.Contains(exportFormats, value) {
+		return nil, nil, fmt.Errorf("unsupported _outputFormat: %s", value)
+	}
+
+	types := exportTypes
+	if value := query.Get("_type"); value != "" {
+		types = nil
+		for _, resourceType := range strings.Split(value, ",") {
+			resourceType = strings.TrimSpace(resourceType)
+			if !slices.Contains(exportTypes, resourceType) {
+				return nil, nil, fmt.Errorf("unsupported _type for $export: %s", resourceType)
+			}
+			if !slices.Contains(types, resourceType) {
+				types = append(types, resourceType)
+			}
+		}
+	}
+
+	var since *time.Time
+	if value := query.Get("_since"); value != "" {
+		start, _, err := parseDateRange(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid _since: %s", value)
+		}
+		since = &start
+	}
+
+	return types, since, nil
+}
+
+// requestBaseURL returns the scheme and host the request was made to, as
+// bulk data manifests need absolute URLs.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// Export implements the $export kick-off: it starts an export in the
+// background and points the client at its status endpoint.
+func (s *FHIRServer) Export(c *gin.Context) {
+	types, since, err := parseExportRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	base := requestBaseURL(c)
+	id, err := s.exportService.StartExport(types, since, base+c.Request.URL.RequestURI())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Location", fmt.Sprintf("%s%s/bulkstatus/%s", base, fhirBasePath, id))
+	c.Status(http.StatusAccepted)
+}
+
+// ExportStatus reports an export's progress: 202 while it runs, its
+// manifest once complete, or an OperationOutcome if it failed.
+func (s *FHIRServer) ExportStatus(c *gin.Context) {
+	job, err := s.exportService.GetExportJob(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch job.Status {
+	case models.ExportStatusInProgress:
+		c.Header("X-Progress", "in progress")
+		c.Header("Retry-After", "5")
+		c.Status(http.StatusAccepted)
+	case models.ExportStatusFailed:
+		var message string
+		if job.Error != nil {
+			message = *job.Error
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"resourceType": "OperationOutcome",
+			"issue": []gin.H{
+				{"severity": "error", "code": "exception", "diagnostics": message},
+			},
+		})
+	default:
+		base := requestBaseURL(c)
+		output := make([]gin.H, 0, len(job.Output))
+		for _, file := range job.Output {
+			output = append(output, gin.H{
+				"type":  file.Type,
+				"url":   fmt.Sprintf("%s%s/bulkfiles/%s/%s", base, fhirBasePath, job.ID, file.Name),
+				"count": file.Count,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"transactionTime":     job.TransactionTime.UTC().Format(time.RFC3339),
+			"request":             job.Request,
+			"requiresAccessToken": false,
+			"output":              output,
+			"error":               []gin.H{},
+		})
+	}
+}
+
+// DeleteExport cancels a running export or removes a finished one and its
+// files.
+func (s *FHIRServer) DeleteExport(c *gin.Context) {
+	if err := s.exportService.DeleteExport(c.Param("id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// ExportFile serves one NDJSON file of a completed export.
+func (s *FHIRServer) ExportFile(c *gin.Context) {
+	path, err := s.exportService.ExportFilePath(c.Param("id"), c.Param("file"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentTypeFHIRNDJSON)
+	c.File(path)
+}
@@ -0,0 +1,115 @@
+package fhir
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"hospital-srv/models"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	patpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseExportRequest(t *testing.T) {
+	async := http.Header{"Prefer": {"respond-async"}}
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		target    string
+		header    http.Header
+		wantTypes []string
+		wantSince *time.Time
+		wantErr   bool
+	}{
+		{name: "all types", target: "/$export", header: async, wantTypes: exportTypes},
+		{name: "some types", target: "/$export?_type=Encounter,Patient,Encounter", header: async, wantTypes: []string{"Encounter", "Patient"}},
+		{name: "since", target: "/$export?_since=2024-03-01&_outputFormat=ndjson", header: async, wantTypes: exportTypes, wantSince: &since},
+		{name: "synchronous request", target: "/$export", wantErr: true},
+		{name: "unsupported type", target: "/$export?_type=Condition", header: async, wantErr: true},
+		{name: "unsupported format", target: "/$export?_outputFormat=text/csv", header: async, wantErr: true},
+		{name: "invalid since", target: "/$export?_since=yesterday", header: async, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := testContext(http.MethodGet, tt.target, tt.header)
+			types, since, err := parseExportRequest(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseExportRequest() = %v, %v, want an error", types, since)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExportRequest() = %v", err)
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("types = %v, want %v", types, tt.wantTypes)
+			}
+			if (since == nil) != (tt.wantSince == nil) || (since != nil && !since.Equal(*tt.wantSince)) {
+				t.Errorf("since = %v, want %v", since, tt.wantSince)
+			}
+		})
+	}
+}
+
+func TestRequestBaseURL(t *testing.T) {
+	c, _ := testContext(http.MethodGet, "http://his.local:8443/fhir/$export", nil)
+	if got := requestBaseURL(c); got != "http://his.local:8443" {
+		t.Errorf("requestBaseURL() = %q, want http://his.local:8443", got)
+	}
+
+	c.Request.TLS = &tls.ConnectionState{}
+	if got := requestBaseURL(c); got != "https://his.local:8443" {
+		t.Errorf("requestBaseURL() over TLS = %q, want https://his.local:8443", got)
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	patients := []models.Patient{
+		{ID: "p1", FirstName: "Ivan", LastName: "Ivanov", DateOfBirth: "1980-05-17", Gender: "male"},
+		{ID: "p2", FirstName: "Anna", LastName: "Petrova", DateOfBirth: "1992-11-03", Gender: "female"},
+	}
+	var resources []proto.Message
+	for _, p := range patients {
+		resources = append(resources, PatientToFHIR(p))
+	}
+
+	var buf bytes.Buffer
+	if err := writeNDJSON(&buf, resources); err != nil {
+		t.Fatalf("writeNDJSON() = %v", err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != len(resources) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(resources))
+	}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, `{"resourceType":"Patient","id":"`) {
+			t.Errorf("line %d = %s, want FHIR JSON", i+1, line)
+		}
+		parsed, err := parseFHIRJSON([]byte(line))
+		if err != nil {
+			t.Fatalf("line %d is not FHIR JSON: %v", i+1, err)
+		}
+		patient, err := FHIRToPatient(parsed.Interface().(*patpb.Patient))
+		if err != nil {
+			t.Fatalf("line %d: FHIRToPatient() = %v", i+1, err)
+		}
+		want := patients[i]
+		if patient.ID != want.ID || patient.FirstName != want.FirstName || patient.LastName != want.LastName || patient.DateOfBirth != want.DateOfBirth || patient.Gender != want.Gender {
+			t.Errorf("line %d = %+v, want %+v", i+1, patient, want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// FHIR JSON is written by walking the descriptors of the google/fhir protos
+// the same way FHIR XML is, see xml.go. Primitives become plain JSON values;
+// their id and extensions go into a property named after the element with a
+// leading underscore. It is read back through jsonElements.
+
+// jsonMember is a property of a jsonObject.
+type jsonMember struct {
+	name  string
+	value interface{}
+}
+
+// jsonObject is a JSON object that keeps its properties in the order they
+// were added, as FHIR JSON lists resourceType first and the elements in
+// the order FHIR defines.
+type jsonObject []jsonMember
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(member.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// marshalFHIRJSON writes a resource as FHIR JSON.
+func marshalFHIRJSON(resource proto.Message) ([]byte, error) {
+	object, err := resourceObject(resource.ProtoReflect())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(object)
+}
+
+func resourceObject(m protoreflect.Message) (jsonObject, error) {
+	return appendFields(jsonObject{{name: "resourceType", value: string(m.Descriptor().Name())}}, m)
+}
+
+// appendFields adds the fields of m in the order of its descriptor.
+func appendFields(object jsonObject, m protoreflect.Message) (jsonObject, error) {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		var err error
+		if object, err = appendField(object, m, fields.Get(i)); err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
+
+func appendField(object jsonObject, m protoreflect.Message, fd protoreflect.FieldDescriptor) (jsonObject, error) {
+	if !m.Has(fd) {
+		return object, nil
+	}
+	if fd.Kind() != protoreflect.MessageKind {
+		return nil, fmt.Errorf("unexpected field %s", fd.FullName())
+	}
+
+	if !fd.IsList() {
+		name, value, extra, err := jsonValue(fd.JSONName(), m.Get(fd).Message())
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			object = append(object, jsonMember{name: name, value: value})
+		}
+		if extra != nil {
+			object = append(object, jsonMember{name: "_" + name, value: extra})
+		}
+		return object, nil
+	}
+
+	// The ids and extensions of repeated primitives are listed in an array
+	// parallel to the values, with null for the values that have none.
+	list := m.Get(fd).List()
+	name := fd.JSONName()
+	values := make([]interface{}, list.Len())
+	extras := make([]interface{}, list.Len())
+	hasValues, hasExtras := false, false
+	for i := 0; i < list.Len(); i++ {
+		var value interface{}
+		var extra jsonObject
+		var err error
+		if name, value, extra, err = jsonValue(fd.JSONName(), list.Get(i).Message()); err != nil {
+			return nil, err
+		}
+		values[i] = value
+		hasValues = hasValues || value != nil
+		if extra != nil {
+			extras[i] = extra
+			hasExtras = true
+		}
+	}
+	if hasValues {
+		object = append(object, jsonMember{name: name, value: values})
+	}
+	if hasExtras {
+		object = append(object, jsonMember{name: "_" + name, value: extras})
+	}
+	return object, nil
+}
+
+// jsonValue returns the JSON value of m, an element named name. A choice
+// element is renamed after its type, e.g. valueString. For a primitive the
+// value is nil when it has none, and extra holds its id and extensions.
+func jsonValue(name string, m protoreflect.Message) (string, interface{}, jsonObject, error) {
+	md := m.Descriptor()
+	switch {
+	case md.FullName() == xhtmlMessage:
+		return name, m.Get(md.Fields().ByName("value")).String(), nil, nil
+	case md.FullName() == referenceMessage:
+		object, err := referenceObject(m)
+		return name, object, nil, err
+	case isChoice(md):
+		fd := m.WhichOneof(md.Oneofs().ByName(choiceOneof))
+		if fd == nil {
+			return name, nil, nil, nil
+		}
+		return jsonValue(name+upperFirst(fd.JSONName()), m.Get(fd).Message())
+	case md.Oneofs().ByName(resourceOneof) != nil:
+		resource, err := containedResource(m)
+		if err != nil {
+			return name, nil, nil, err
+		}
+		object, err := resourceObject(resource)
+		return name, object, nil, err
+	case md.FullName() == (&anypb.Any{}).ProtoReflect().Descriptor().FullName():
+		resource, err := unpackResource(m.Interface().(*anypb.Any))
+		if err != nil {
+			return name, nil, nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		object, err := resourceObject(resource)
+		return name, object, nil, err
+	case isPrimitive(md):
+		value, err := primitiveJSON(m)
+		if err != nil {
+			return name, nil, nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		var extra jsonObject
+		for _, field := range []string{"id", "extension"} {
+			if fd := md.Fields().ByName(protoreflect.Name(field)); fd != nil {
+				if extra, err = appendField(extra, m, fd); err != nil {
+					return name, nil, nil, err
+				}
+			}
+		}
+		return name, value, extra, nil
+	}
+
+	object, err := appendFields(jsonObject{}, m)
+	return name, object, nil, err
+}
+
+// primitiveJSON returns the value of a primitive as a JSON value: booleans
+// and numbers as such, everything else as a string. Decimals are written
+// as they were given, keeping their precision.
+func primitiveJSON(m protoreflect.Message) (interface{}, error) {
+	value, ok, err := primitiveValue(m)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	if m.Descriptor().Name() == "Decimal" {
+		return json.Number(value), nil
+	}
+	fd := m.Descriptor().Fields().ByName("value")
+	if fd == nil {
+		return value, nil
+	}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return m.Get(fd).Bool(), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return json.Number(value), nil
+	}
+	return value, nil
+}
+
+// referenceObject returns a Reference with the reference element
+// referenceValue gives.
+func referenceObject(m protoreflect.Message) (jsonObject, error) {
+	md := m.Descriptor()
+	fields := md.Fields()
+
+	object := jsonObject{}
+	var err error
+	for _, field := range []string{"id", "extension"} {
+		if object, err = appendField(object, m, fields.ByName(protoreflect.Name(field))); err != nil {
+			return nil, err
+		}
+	}
+	if value, ok := referenceValue(m); ok {
+		object = append(object, jsonMember{name: "reference", value: value})
+	}
+
+	oneof := md.Oneofs().ByName(referenceOneof)
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Name() == "id" || fd.Name() == "extension" || fd.ContainingOneof() == oneof {
+			continue
+		}
+		if object, err = appendField(object, m, fd); err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
@@ -0,0 +1,522 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	bcrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/bundle_and_contained_resource_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	contentTypeJSON       = "application/json"
+	contentTypeFHIRXML    = "application/fhir+xml"
+	contentTypeFHIRNDJSON = "application/fhir+ndjson"
+)
+
+// mediaTypeFormats maps the media types, and the short _format values,
+// the FHIR endpoints understand to the format they stand for. Plain JSON
+// is the protojson the handlers write, which is what clients get unless
+// they ask for FHIR JSON or XML.
+var mediaTypeFormats = map[string]string{
+	"json":              contentTypeFHIRJSON,
+	contentTypeJSON:     contentTypeJSON,
+	contentTypeFHIRJSON: contentTypeFHIRJSON,
+	"xml":               contentTypeFHIRXML,
+	"text/xml":          contentTypeFHIRXML,
+	"application/xml":   contentTypeFHIRXML,
+	contentTypeFHIRXML:  contentTypeFHIRXML,
+	"*/*":               contentTypeJSON,
+	"application/*":     contentTypeJSON,
+	// Bulk data files are NDJSON and are served as they are.
+	"ndjson":               contentTypeFHIRNDJSON,
+	"application/ndjson":   contentTypeFHIRNDJSON,
+	"application/x-ndjson": contentTypeFHIRNDJSON,
+	contentTypeFHIRNDJSON:  contentTypeFHIRNDJSON,
+}
+
+// resourceParsers read request bodies sent in the formats, other than plain
+// JSON, that the FHIR endpoints accept.
+var resourceParsers = map[string]func([]byte) (protoreflect.Message, error){
+	contentTypeFHIRJSON: parseFHIRJSON,
+	contentTypeFHIRXML:  parseXMLResource,
+}
+
+// resourceMarshalers write responses in the formats, other than plain JSON,
+// that the FHIR endpoints serve.
+var resourceMarshalers = map[string]func(proto.Message) ([]byte, error){
+	contentTypeFHIRJSON: marshalFHIRJSON,
+	contentTypeFHIRXML:  marshalXML,
+}
+
+// operationResults names the resource type returned by operations whose
+// result is not the resource type of their path.
+var operationResults = map[string]string{
+	"metadata":      "CapabilityStatement",
+	"$availability": "Parameters",
+	"$expand":       "ValueSet",
+}
+
+// mediaTypeFormat returns the format of a media type, ignoring parameters
+// such as charset or fhirVersion.
+func mediaTypeFormat(value string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(value))
+	}
+	format, ok := mediaTypeFormats[mediaType]
+	return format, ok
+}
+
+// responseFormat picks the format of the response: _format if given,
+// otherwise the most preferred type of the Accept header. Plain JSON is
+// the default.
+func responseFormat(c *gin.Context) (string, bool) {
+	if value := c.Query("_format"); value != "" {
+		// An unescaped "+" in the query string arrives as a space.
+		return mediaTypeFormat(strings.ReplaceAll(value, " ", "+"))
+	}
+
+	accept := c.GetHeader("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeJSON, true
+	}
+
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if format, ok := mediaTypeFormats[mediaType]; ok && quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best, best != ""
+}
+
+// NegotiateFormat lets the FHIR endpoints read and write FHIR JSON and XML
+// as well as the protojson the handlers use. Request bodies sent as FHIR
+// JSON or XML are converted to the JSON the handlers read, and resources
+// in responses are converted when _format or Accept asks for either;
+// responses that are no resource, such as bulk data status manifests, stay
+// plain JSON. Clients asking for NDJSON, such as bulk data downloads, get
+// the response as it is written.
+func NegotiateFormat(c *gin.Context) {
+	format, ok := responseFormat(c)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotAcceptable, operationOutcome([]validationIssue{{
+			severity:    severityError,
+			code:        "not-supported",
+			diagnostics: fmt.Sprintf("None of the requested formats is supported, use %s, %s or %s", contentTypeJSON, contentTypeFHIRJSON, contentTypeFHIRXML),
+		}}))
+		return
+	}
+
+	if marshal, ok := resourceMarshalers[format]; ok {
+		writer := &formatResponseWriter{ResponseWriter: c.Writer, status: http.StatusOK, format: format, marshal: marshal}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			writer.flush(responseResourceType(c))
+		}()
+	}
+
+	requestFormat, _ := mediaTypeFormat(c.ContentType())
+	if parse, ok := resourceParsers[requestFormat]; ok && c.Request.Body != nil {
+		if err := readResourceBody(c, parse); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s body: %v", requestFormat, err)})
+			return
+		}
+	}
+
+	c.Next()
+}
+
+// readResourceBody replaces a request body holding a FHIR JSON or XML
+// resource with its JSON form.
+func readResourceBody(c *gin.Context, parse func([]byte) (protoreflect.Message, error)) error {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return errors.New("failed to read request body")
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
+	}
+
+	resource, err := parse(body)
+	if err != nil {
+		return err
+	}
+	converted, err := handlerJSON(resource)
+	if err != nil {
+		return err
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(converted))
+	c.Request.ContentLength = int64(len(converted))
+	c.Request.Header.Set("Content-Type", contentTypeJSON)
+	return nil
+}
+
+func parseXMLResource(data []byte) (protoreflect.Message, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalResource(root)
+}
+
+// parseFHIRJSON reads a FHIR JSON resource.
+func parseFHIRJSON(data []byte) (protoreflect.Message, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	resourceType, ok := fields["resourceType"].(string)
+	if !ok {
+		return nil, errors.New("resourceType is missing")
+	}
+
+	children, err := jsonElements(fields, resourceType)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalResource(&xmlElement{name: resourceType, children: children})
+}
+
+// handlerJSON returns a resource as the JSON the handlers read: protojson
+// for a resource, and for a Bundle the Bundle JSON that ProcessBundle and
+// Import read, with protojson entry resources naming their resourceType.
+func handlerJSON(resource protoreflect.Message) ([]byte, error) {
+	bundle, ok := resource.Interface().(*bcrpb.Bundle)
+	if !ok {
+		return protojson.Marshal(resource.Interface())
+	}
+
+	entries := []map[string]interface{}{}
+	for i, e := range bundle.GetEntry() {
+		entry := map[string]interface{}{}
+		if fullURL := e.GetFullUrl().GetValue(); fullURL != "" {
+			entry["fullUrl"] = fullURL
+		}
+		if e.GetResource() != nil {
+			entryResource, err := containedResource(e.GetResource().ProtoReflect())
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %w", i, err)
+			}
+			resourceMap, err := protoToMap(entryResource.Interface())
+			if err != nil {
+				return nil, err
+			}
+			resourceMap["resourceType"] = string(entryResource.Descriptor().Name())
+			entry["resource"] = resourceMap
+		}
+		if r := e.GetRequest(); r != nil {
+			request := map[string]interface{}{
+				"method": messageCode(r.GetMethod()),
+				"url":    r.GetUrl().GetValue(),
+			}
+			if r.GetIfMatch() != nil {
+				request["ifMatch"] = r.GetIfMatch().GetValue()
+			}
+			if r.GetIfNoneExist() != nil {
+				request["ifNoneExist"] = r.GetIfNoneExist().GetValue()
+			}
+			entry["request"] = request
+		}
+		entries = append(entries, entry)
+	}
+
+	return json.Marshal(gin.H{
+		"resourceType": "Bundle",
+		"type":         messageCode(bundle.GetType()),
+		"entry":        entries,
+	})
+}
+
+// messageCode returns the code of a code element.
+func messageCode(code proto.Message) string {
+	if code == nil || !code.ProtoReflect().IsValid() {
+		return ""
+	}
+	value, _, _ := primitiveValue(code.ProtoReflect())
+	return value
+}
+
+// responseResourceType returns the resource type a handler answers with
+// as protojson, read from the route.
+func responseResourceType(c *gin.Context) string {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(c.FullPath(), fhirBasePath), "/"), "/")
+	if resourceType, ok := operationResults[segments[len(segments)-1]]; ok {
+		return resourceType
+	}
+	return segments[0]
+}
+
+// formatResponseWriter holds back the response of a handler so that it
+// can be converted to format once the handler is done.
+type formatResponseWriter struct {
+	gin.ResponseWriter
+	status  int
+	body    bytes.Buffer
+	format  string
+	marshal func(proto.Message) ([]byte, error)
+}
+
+func (w *formatResponseWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *formatResponseWriter) WriteHeaderNow() {}
+
+func (w *formatResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *formatResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *formatResponseWriter) Status() int {
+	return w.status
+}
+
+// flush writes the held back response, converted to the requested format
+// if it is a resource. Anything else, such as NDJSON export files, is
+// written unchanged.
+func (w *formatResponseWriter) flush(resourceType string) {
+	body := w.body.Bytes()
+	if format, _ := mediaTypeFormat(w.Header().Get("Content-Type")); format == contentTypeJSON && len(body) > 0 {
+		converted, err := w.convert(body, resourceType)
+		if errors.Is(err, errNotResource) {
+			// Bulk data status manifests and import reports are plain JSON.
+		} else if err != nil {
+			log.Printf("Failed to convert %s response to %s: %v", resourceType, w.format, err)
+		} else {
+			body = converted
+			w.Header().Set("Content-Type", w.format+"; charset=utf-8")
+			w.Header().Del("Content-Length")
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(body) == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+	if _, err := w.ResponseWriter.Write(body); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+func (w *formatResponseWriter) convert(body []byte, resourceType string) ([]byte, error) {
+	resource, err := responseResource(body, resourceType, w.status)
+	if err != nil {
+		return nil, err
+	}
+	return w.marshal(resource.Interface())
+}
+
+// errNotResource is returned by responseResource for JSON responses that
+// are not FHIR resources.
+var errNotResource = errors.New("response is not a FHIR resource")
+
+// responseResource decodes a response of the FHIR handlers. Bundles and
+// OperationOutcomes are FHIR JSON with protojson entry resources, other
+// resources are protojson of resourceType; {"error": ...} bodies become an
+// OperationOutcome and {"id": ...} bodies a resource with just its id.
+func responseResource(body []byte, resourceType string, status int) (protoreflect.Message, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil || fields == nil {
+		return nil, errNotResource
+	}
+
+	if message, ok := fields["error"].(string); ok && len(fields) == 1 {
+		outcome, err := json.Marshal(operationOutcome([]validationIssue{{severity: severityError, code: issueTypeForStatus(status), diagnostics: message}}))
+		if err != nil {
+			return nil, err
+		}
+		return responseResource(outcome, resourceType, status)
+	}
+
+	if id, ok := fields["id"].(string); ok && len(fields) == 1 {
+		fields = map[string]interface{}{"resourceType": resourceType, "id": id}
+	}
+
+	if bodyType, ok := fields["resourceType"].(string); ok {
+		children, err := jsonElements(fields, resourceType)
+		if err != nil {
+			return nil, err
+		}
+		return unmarshalResource(&xmlElement{name: bodyType, children: children})
+	}
+
+	if _, ok := resourceFields[resourceType]; !ok {
+		return nil, errNotResource
+	}
+	resource, err := newResource(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	if err := protojson.Unmarshal(body, resource.Interface()); err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+func issueTypeForStatus(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "not-found"
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return "conflict"
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return "invalid"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "security"
+	}
+	if status >= http.StatusInternalServerError {
+		return "exception"
+	}
+	return "processing"
+}
+
+// jsonElements turns the fields of a FHIR JSON object into elements. The
+// id and extensions of a primitive, given in the property named after it
+// with a leading underscore, become children of its element. Entry
+// resources without a resourceType are protojson; their type is taken from
+// the fullUrl of the entry, or is defaultType.
+func jsonElements(fields map[string]interface{}, defaultType string) ([]*xmlElement, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if name == "resourceType" {
+			continue
+		}
+		if base, ok := strings.CutPrefix(name, "_"); ok {
+			if _, hasValue := fields[base]; hasValue {
+				continue
+			}
+			name = base
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var elements []*xmlElement
+	for _, name := range names {
+		if object, ok := fields[name].(map[string]interface{}); ok && name == "resource" && object["resourceType"] == nil {
+			resourceType := defaultType
+			if fullURL, ok := fields["fullUrl"].(string); ok {
+				resourceType, _ = parseEntryURL(fullURL)
+			}
+			resource, err := protojsonResource(object, resourceType)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, &xmlElement{name: name, resource: resource})
+			continue
+		}
+
+		values, extras := jsonList(fields, name), jsonList(fields, "_"+name)
+		for i := 0; i < len(values) || i < len(extras); i++ {
+			var element *xmlElement
+			var err error
+			if i < len(values) {
+				if element, err = jsonElement(name, values[i], defaultType); err != nil {
+					return nil, err
+				}
+			}
+			if i < len(extras) {
+				if extra, ok := extras[i].(map[string]interface{}); ok {
+					children, err := jsonElements(extra, defaultType)
+					if err != nil {
+						return nil, err
+					}
+					if element == nil {
+						element = &xmlElement{name: name}
+					}
+					element.children = append(element.children, children...)
+				}
+			}
+			if element != nil {
+				elements = append(elements, element)
+			}
+		}
+	}
+	return elements, nil
+}
+
+// jsonList returns the values of a property, which is an array for a
+// repeated element.
+func jsonList(fields map[string]interface{}, name string) []interface{} {
+	value, ok := fields[name]
+	if !ok {
+		return nil
+	}
+	if values, ok := value.([]interface{}); ok {
+		return values
+	}
+	return []interface{}{value}
+}
+
+func jsonElement(name string, value interface{}, defaultType string) (*xmlElement, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &xmlElement{name: name, value: v}, nil
+	case json.Number:
+		return &xmlElement{name: name, value: v.String()}, nil
+	case bool:
+		return &xmlElement{name: name, value: strconv.FormatBool(v)}, nil
+	case map[string]interface{}:
+		children, err := jsonElements(v, defaultType)
+		if err != nil {
+			return nil, err
+		}
+		if resourceType, ok := v["resourceType"].(string); ok {
+			children = []*xmlElement{{name: resourceType, children: children}}
+		}
+		return &xmlElement{name: name, children: children}, nil
+	}
+	return nil, fmt.Errorf("unexpected value of %s", name)
+}
+
+func protojsonResource(object map[string]interface{}, resourceType string) (protoreflect.Message, error) {
+	resource, err := newResource(resourceType)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	if err := protojson.Unmarshal(data, resource.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", resourceType, err)
+	}
+	return resource, nil
+}
@@ -0,0 +1,322 @@
+package fhir
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestResponseFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   string
+		wantOK bool
+	}{
+		{name: "no Accept", target: "/Patient", want: contentTypeJSON, wantOK: true},
+		{name: "plain JSON", target: "/Patient", accept: "application/json", want: contentTypeJSON, wantOK: true},
+		{name: "FHIR JSON", target: "/Patient", accept: "application/fhir+json", want: contentTypeFHIRJSON, wantOK: true},
+		{name: "FHIR XML", target: "/Patient", accept: "application/fhir+xml", want: contentTypeFHIRXML, wantOK: true},
+		{name: "any type", target: "/Patient", accept: "*/*", want: contentTypeJSON, wantOK: true},
+		{name: "highest quality wins", target: "/Patient", accept: "application/fhir+json;q=0.5, application/xml", want: contentTypeFHIRXML, wantOK: true},
+		{name: "unsupported types skipped", target: "/Patient", accept: "text/html, application/fhir+json;q=0.1", want: contentTypeFHIRJSON, wantOK: true},
+		{name: "parameters ignored", target: "/Patient", accept: "application/fhir+xml; fhirVersion=4.0", want: contentTypeFHIRXML, wantOK: true},
+		{name: "FHIR NDJSON", target: "/bulkfiles/j1/Patient.ndjson", accept: "application/fhir+ndjson", want: contentTypeFHIRNDJSON, wantOK: true},
+		{name: "NDJSON", target: "/bulkfiles/j1/Patient.ndjson", accept: "application/ndjson", want: contentTypeFHIRNDJSON, wantOK: true},
+		{name: "nothing supported", target: "/Patient", accept: "text/html", wantOK: false},
+		{name: "_format over Accept", target: "/Patient?_format=xml", accept: "application/fhir+json", want: contentTypeFHIRXML, wantOK: true},
+		{name: "_format json is FHIR JSON", target: "/Patient?_format=json", accept: "application/json", want: contentTypeFHIRJSON, wantOK: true},
+		{name: "_format with unescaped plus", target: "/Patient?_format=application/fhir+xml", want: contentTypeFHIRXML, wantOK: true},
+		{name: "unknown _format", target: "/Patient?_format=html", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+
+			got, ok := responseFormat(c)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("responseFormat() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNegotiateFormatPassesNDJSONThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(NegotiateFormat)
+	router.GET("/bulkfiles/:id/:file", func(c *gin.Context) {
+		c.Header("Content-Type", contentTypeFHIRNDJSON)
+		c.String(http.StatusOK, "{\"id\":{\"value\":\"p1\"}}\n")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/bulkfiles/j1/Patient.ndjson", nil)
+	req.Header.Set("Accept", "application/fhir+ndjson")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != contentTypeFHIRNDJSON {
+		t.Errorf("Content-Type = %q, want %q", got, contentTypeFHIRNDJSON)
+	}
+	if got := w.Body.String(); got != "{\"id\":{\"value\":\"p1\"}}\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+const encounterProtojson = `{"id":{"value":"e1"},"status":{"value":"FINISHED"},"subject":{"reference":{"value":"Patient/p1"}}}`
+
+func TestNegotiateFormatResponses(t *testing.T) {
+	tests := []struct {
+		name            string
+		path            string
+		accept          string
+		body            string
+		status          int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "plain JSON by default",
+			body:            encounterProtojson,
+			status:          http.StatusOK,
+			wantContentType: contentTypeJSON,
+			wantBody:        encounterProtojson,
+		},
+		{
+			name:            "FHIR JSON",
+			accept:          contentTypeFHIRJSON,
+			body:            encounterProtojson,
+			status:          http.StatusOK,
+			wantContentType: contentTypeFHIRJSON,
+			wantBody:        `{"resourceType":"Encounter","id":"e1","status":"finished","subject":{"reference":"Patient/p1"}}`,
+		},
+		{
+			name:            "FHIR XML",
+			accept:          contentTypeFHIRXML,
+			body:            encounterProtojson,
+			status:          http.StatusOK,
+			wantContentType: contentTypeFHIRXML,
+			wantBody:        xml.Header + `<Encounter xmlns="http://hl7.org/fhir"><id value="e1"/><status value="finished"/><subject><reference value="Patient/p1"/></subject></Encounter>`,
+		},
+		{
+			name:            "error as FHIR JSON",
+			accept:          contentTypeFHIRJSON,
+			body:            `{"error":"Encounter not found"}`,
+			status:          http.StatusNotFound,
+			wantContentType: contentTypeFHIRJSON,
+			wantBody:        `{"resourceType":"OperationOutcome","issue":[{"severity":"error","code":"not-found","diagnostics":"Encounter not found"}]}`,
+		},
+		{
+			name:            "no resource stays plain JSON",
+			path:            "/bulkstatus/j1",
+			accept:          contentTypeFHIRJSON,
+			body:            `{"transactionTime":"2024-01-02T10:00:00Z","output":[]}`,
+			status:          http.StatusOK,
+			wantContentType: contentTypeJSON,
+			wantBody:        `{"transactionTime":"2024-01-02T10:00:00Z","output":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(NegotiateFormat)
+			handler := func(c *gin.Context) {
+				c.Data(tt.status, "application/json; charset=utf-8", []byte(tt.body))
+			}
+			router.GET(fhirBasePath+"/Encounter/:id", handler)
+			router.GET(fhirBasePath+"/bulkstatus/:id", handler)
+
+			path := tt.path
+			if path == "" {
+				path = "/Encounter/e1"
+			}
+			req := httptest.NewRequest(http.MethodGet, fhirBasePath+path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got, _ := mediaTypeFormat(w.Header().Get("Content-Type")); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", w.Header().Get("Content-Type"), tt.wantContentType)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %s, want %s", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestNegotiateFormatRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{
+			name:        "plain JSON",
+			contentType: contentTypeJSON,
+			body:        encounterProtojson,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "FHIR JSON",
+			contentType: contentTypeFHIRJSON,
+			body:        `{"resourceType":"Encounter","id":"e1","status":"finished","subject":{"reference":"Patient/p1"}}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "FHIR XML",
+			contentType: contentTypeFHIRXML,
+			body:        `<Encounter xmlns="http://hl7.org/fhir"><id value="e1"/><status value="finished"/><subject><reference value="Patient/p1"/></subject></Encounter>`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "protojson sent as FHIR JSON",
+			contentType: contentTypeFHIRJSON,
+			body:        encounterProtojson,
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(NegotiateFormat)
+			router.PUT(fhirBasePath+"/Encounter/:id", func(c *gin.Context) {
+				if got, _ := mediaTypeFormat(c.ContentType()); got != contentTypeJSON {
+					t.Errorf("handler Content-Type = %q, want %q", c.ContentType(), contentTypeJSON)
+				}
+				body, _ := io.ReadAll(c.Request.Body)
+				var got, want encpb.Encounter
+				if err := protojson.Unmarshal(body, &got); err != nil {
+					t.Fatalf("handler body %s: %v", body, err)
+				}
+				if err := protojson.Unmarshal([]byte(encounterProtojson), &want); err != nil {
+					t.Fatal(err)
+				}
+				if !proto.Equal(&got, &want) {
+					t.Errorf("handler body = %s, want %s", body, encounterProtojson)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPut, fhirBasePath+"/Encounter/e1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestFHIRJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{
+			name: "primitive id and extensions",
+			json: `{"resourceType":"Encounter","id":"e1","status":"finished","_status":{"id":"s1","extension":[{"url":"http://example.org/reason","valueBoolean":true}]}}`,
+		},
+		{
+			name: "numbers and choice types",
+			json: `{"resourceType":"Encounter","extension":[{"url":"http://example.org/cost","valueDecimal":1.50}],"length":{"value":30,"unit":"min"}}`,
+		},
+		{
+			name: "repeated primitives with extensions",
+			json: `{"resourceType":"Patient","name":[{"given":["Ivan","Ivanovich"],"_given":[null,{"extension":[{"url":"http://example.org/patronymic","valueBoolean":true}]}]}]}`,
+		},
+		{
+			name: "contained resource and dates",
+			json: `{"resourceType":"Encounter","contained":[{"resourceType":"Location","id":"l1","name":"Ward 3"}],"period":{"start":"2024-01-02T10:00:00+03:00"},"location":[{"location":{"reference":"#l1"}}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := parseFHIRJSON([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("parseFHIRJSON() = %v", err)
+			}
+			got, err := marshalFHIRJSON(resource.Interface())
+			if err != nil {
+				t.Fatalf("marshalFHIRJSON() = %v", err)
+			}
+			if string(got) != tt.json {
+				t.Errorf("marshalFHIRJSON() = %s, want %s", got, tt.json)
+			}
+		})
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+	}{
+		{
+			name: "primitive with id and extension",
+			xml:  `<Encounter xmlns="http://hl7.org/fhir"><id value="e1"/><status id="s1" value="finished"><extension url="http://example.org/reason"><valueBoolean value="true"/></extension></status></Encounter>`,
+		},
+		{
+			name: "dates keep precision and offset",
+			xml:  `<Patient xmlns="http://hl7.org/fhir"><birthDate value="1980-05"/><deceasedDateTime value="2024-01-02T10:00:00.250+03:00"/></Patient>`,
+		},
+		{
+			name: "contained resource",
+			xml:  `<Encounter xmlns="http://hl7.org/fhir"><contained><Location><id value="l1"/><name value="Ward 3"/></Location></contained><location><location><reference value="#l1"/></location></location></Encounter>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := parseXMLResource([]byte(tt.xml))
+			if err != nil {
+				t.Fatalf("parseXMLResource() = %v", err)
+			}
+			got, err := marshalXML(resource.Interface())
+			if err != nil {
+				t.Fatalf("marshalXML() = %v", err)
+			}
+			if want := xml.Header + tt.xml; string(got) != want {
+				t.Errorf("marshalXML() = %s, want %s", got, want)
+			}
+		})
+	}
+
+	if _, err := parseXMLResource([]byte(`<Encounter xmlns="http://hl7.org/fhir"><status value="done"/></Encounter>`)); err == nil {
+		t.Error("parseXMLResource() with an unknown status = nil, want an error")
+	}
+	if _, err := parseXMLResource([]byte(`<Unknown xmlns="http://hl7.org/fhir"/>`)); err == nil {
+		t.Error("parseXMLResource() of an unknown resource type = nil, want an error")
+	}
+}
@@ -0,0 +1,206 @@
+package fhir
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+)
+
+type versionedResource struct {
+	resource  proto.Message
+	versionID int
+	updatedAt time.Time
+}
+
+func etag(versionID int) string {
+	return fmt.Sprintf(`W/"%d"`, versionID)
+}
+
+func setVersionHeaders(c *gin.Context, versionID int, updatedAt time.Time) {
+	c.Header("ETag", etag(versionID))
+	c.Header("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
+}
+
+// parseIfMatch returns the version requested via If-Match, or 0 when the
+// header is absent.
+func parseIfMatch(c *gin.Context) (int, error) {
+	return parseETag(c.GetHeader("If-Match"))
+}
+
+func parseETag(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, nil
+	}
+
+	value := strings.TrimPrefix(header, "W/")
+	value = strings.Trim(value, `"`)
+
+	versionID, err := strconv.Atoi(value)
+	if err != nil || versionID < 1 {
+		return 0, fmt.Errorf("invalid If-Match header: %s", header)
+	}
+
+	return versionID, nil
+}
+
+func parseVersionParam(c *gin.Context) (int, error) {
+	versionID, err := strconv.Atoi(c.Param("vid"))
+	if err != nil || versionID < 1 {
+		return 0, fmt.Errorf("invalid version id: %s", c.Param("vid"))
+	}
+	return versionID, nil
+}
+
+func writeHistoryBundle(c *gin.Context, resourceType string, id string, versions []versionedResource) {
+	var entries []map[string]interface{}
+	for _, v := range versions {
+		resourceMap, err := protoToMap(v.resource)
+		if err != nil {
+			log.Printf("Failed to convert %s version %d to map: %v", resourceType, v.versionID, err)
+			continue
+		}
+
+		method := http.MethodPut
+		if v.versionID == 1 {
+			method = http.MethodPost
+		}
+
+		entries = append(entries, map[string]interface{}{
+			"fullUrl":  fmt.Sprintf("%s/%s/_history/%d", resourceType, id, v.versionID),
+			"resource": resourceMap,
+			"request": map[string]interface{}{
+				"method": method,
+				"url":    fmt.Sprintf("%s/%s", resourceType, id),
+			},
+			"response": map[string]interface{}{
+				"status":       "200",
+				"etag":         etag(v.versionID),
+				"lastModified": v.updatedAt.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resourceType": "Bundle",
+		"type":         "history",
+		"total":        len(entries),
+		"entry":        entries,
+	})
+}
+
+func writeVersionedResource(c *gin.Context, v versionedResource) {
+	resourceMap, err := protoToMap(v.resource)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert resource"})
+		return
+	}
+
+	setVersionHeaders(c, v.versionID, v.updatedAt)
+	c.JSON(http.StatusOK, resourceMap)
+}
+
+func (s *FHIRServer) GetPatientHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	patients, err := s.patientService.GetPatientHistory(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+
+	versions := make([]versionedResource, 0, len(patients))
+	for _, p := range patients {
+		versions = append(versions, versionedResource{resource: PatientToFHIR(p), versionID: p.VersionID, updatedAt: p.UpdatedAt})
+	}
+
+	writeHistoryBundle(c, "Patient", id, versions)
+}
+
+func (s *FHIRServer) GetPatientVersion(c *gin.Context) {
+	versionID, err := parseVersionParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patient, err := s.patientService.GetPatientVersion(c.Param("id"), versionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient version not found"})
+		return
+	}
+
+	writeVersionedResource(c, versionedResource{resource: PatientToFHIR(*patient), versionID: patient.VersionID, updatedAt: patient.UpdatedAt})
+}
+
+func (s *FHIRServer) GetPractitionerHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	practitioners, err := s.practitionerService.GetPractitionerHistory(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Practitioner not found"})
+		return
+	}
+
+	versions := make([]versionedResource, 0, len(practitioners))
+	for _, p := range practitioners {
+		versions = append(versions, versionedResource{resource: PractitionerToFHIR(p), versionID: p.VersionID, updatedAt: p.UpdatedAt})
+	}
+
+	writeHistoryBundle(c, "Practitioner", id, versions)
+}
+
+func (s *FHIRServer) GetPractitionerVersion(c *gin.Context) {
+	versionID, err := parseVersionParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	practitioner, err := s.practitionerService.GetPractitionerVersion(c.Param("id"), versionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Practitioner version not found"})
+		return
+	}
+
+	writeVersionedResource(c, versionedResource{resource: PractitionerToFHIR(*practitioner), versionID: practitioner.VersionID, updatedAt: practitioner.UpdatedAt})
+}
+
+func (s *FHIRServer) GetEncounterHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	encounters, err := s.encounterService.GetEncounterHistory(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Encounter not found"})
+		return
+	}
+
+	versions := make([]versionedResource, 0, len(encounters))
+	for _, e := range encounters {
+		versions = append(versions, versionedResource{resource: EncounterToFHIR(e), versionID: e.VersionID, updatedAt: e.UpdatedAt})
+	}
+
+	writeHistoryBundle(c, "Encounter", id, versions)
+}
+
+func (s *FHIRServer) GetEncounterVersion(c *gin.Context) {
+	versionID, err := parseVersionParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	encounter, err := s.encounterService.GetEncounterVersion(c.Param("id"), versionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Encounter version not found"})
+		return
+	}
+
+	writeVersionedResource(c, versionedResource{resource: EncounterToFHIR(*encounter), versionID: encounter.VersionID, updatedAt: encounter.UpdatedAt})
+}
@@ -0,0 +1,149 @@
+package fhir
+
+import (
+	"encoding/json"
+	"hospital-srv/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testContext(method string, target string, header http.Header) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		c.Request.Header[name] = values
+	}
+	return c, w
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int
+		wantErr bool
+	}{
+		{header: "", want: 0},
+		{header: `W/"3"`, want: 3},
+		{header: `"3"`, want: 3},
+		{header: "3", want: 3},
+		{header: ` W/"12" `, want: 12},
+		{header: `W/"0"`, wantErr: true},
+		{header: `W/"-1"`, wantErr: true},
+		{header: `W/"abc"`, wantErr: true},
+		{header: "*", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.header != "" {
+			header.Set("If-Match", tt.header)
+		}
+		c, _ := testContext(http.MethodPut, "/Patient/p1", header)
+
+		got, err := parseIfMatch(c)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseIfMatch(%q) = %d, %v, want %d, error %v", tt.header, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseVersionParam(t *testing.T) {
+	tests := []struct {
+		vid     string
+		want    int
+		wantErr bool
+	}{
+		{vid: "1", want: 1},
+		{vid: "42", want: 42},
+		{vid: "0", wantErr: true},
+		{vid: "W/1", wantErr: true},
+		{vid: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		c, _ := testContext(http.MethodGet, "/Patient/p1/_history/"+tt.vid, nil)
+		c.Params = gin.Params{{Key: "vid", Value: tt.vid}}
+
+		got, err := parseVersionParam(c)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseVersionParam(%q) = %d, %v, want %d, error %v", tt.vid, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteHistoryBundle(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC)
+	versions := []versionedResource{
+		{resource: PatientToFHIR(models.Patient{ID: "p1", FirstName: "Ivan", VersionID: 2, UpdatedAt: updatedAt}), versionID: 2, updatedAt: updatedAt},
+		{resource: PatientToFHIR(models.Patient{ID: "p1", FirstName: "Ivan", VersionID: 1, UpdatedAt: updatedAt}), versionID: 1, updatedAt: updatedAt},
+	}
+
+	c, w := testContext(http.MethodGet, "/Patient/p1/_history", nil)
+	writeHistoryBundle(c, "Patient", "p1", versions)
+
+	var bundle struct {
+		Type  string `json:"type"`
+		Total int    `json:"total"`
+		Entry []struct {
+			FullURL string `json:"fullUrl"`
+			Request struct {
+				Method string `json:"method"`
+				URL    string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Etag         string `json:"etag"`
+				LastModified string `json:"lastModified"`
+			} `json:"response"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &bundle); err != nil {
+		t.Fatalf("invalid bundle %s: %v", w.Body.String(), err)
+	}
+
+	if bundle.Type != "history" || bundle.Total != 2 || len(bundle.Entry) != 2 {
+		t.Fatalf("bundle = %s, want a history of 2 entries", w.Body.String())
+	}
+	wants := []struct{ fullURL, method, etag string }{
+		{"Patient/p1/_history/2", http.MethodPut, `W/"2"`},
+		{"Patient/p1/_history/1", http.MethodPost, `W/"1"`},
+	}
+	for i, want := range wants {
+		entry := bundle.Entry[i]
+		if entry.FullURL != want.fullURL || entry.Request.Method != want.method || entry.Request.URL != "Patient/p1" || entry.Response.Etag != want.etag {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want)
+		}
+		if entry.Response.LastModified != "2024-03-10T09:30:00Z" {
+			t.Errorf("entry %d lastModified = %q", i, entry.Response.LastModified)
+		}
+	}
+}
+
+func TestWriteVersionedResourceHeaders(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC)
+	c, w := testContext(http.MethodGet, "/Patient/p1", nil)
+
+	writeVersionedResource(c, versionedResource{resource: PatientToFHIR(models.Patient{ID: "p1", VersionID: 5, UpdatedAt: updatedAt}), versionID: 5, updatedAt: updatedAt})
+
+	if got := w.Header().Get("ETag"); got != `W/"5"` {
+		t.Errorf("ETag = %q, want %q", got, `W/"5"`)
+	}
+	if got := w.Header().Get("Last-Modified"); got != "Sun, 10 Mar 2024 09:30:00 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+	var resource struct {
+		Meta struct {
+			VersionID struct {
+				Value string `json:"value"`
+			} `json:"versionId"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resource); err != nil || resource.Meta.VersionID.Value != "5" {
+		t.Errorf("body = %s, want meta.versionId 5", w.Body.String())
+	}
+}
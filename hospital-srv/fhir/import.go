@@ -0,0 +1,336 @@
+package fhir
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	patpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Outcomes of an imported record. A dry run reports valid records instead
+// of creating them.
+const (
+	importCreated   = "created"
+	importValid     = "valid"
+	importDuplicate = "duplicate"
+	importInvalid   = "invalid"
+	importFailed    = "failed"
+)
+
+// ndjsonTypes are the content types read as one resource per line; any
+// other body is read as a Bundle.
+var ndjsonTypes = []string{"application/fhir+ndjson", "application/ndjson", "application/x-ndjson"}
+
+// importRecord is a resource to import with its line number in an NDJSON
+// body or, for a Bundle, its position among the entries. NDJSON lines are
+// FHIR JSON, as $export writes them; Bundle entries hold the JSON the
+// handlers read, which NegotiateFormat makes of a FHIR JSON or XML Bundle.
+type importRecord struct {
+	number   int
+	resource json.RawMessage
+	fhirJSON bool
+}
+
+type importResult struct {
+	Record       int    `json:"record"`
+	ResourceType string `json:"resourceType,omitempty"`
+	Status       string `json:"status"`
+	ID           string `json:"id,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+type importReport struct {
+	DryRun     bool           `json:"dryRun"`
+	Total      int            `json:"total"`
+	Created    int            `json:"created"`
+	Valid      int            `json:"valid"`
+	Duplicates int            `json:"duplicates"`
+	Invalid    int            `json:"invalid"`
+	Failed     int            `json:"failed"`
+	Results    []importResult `json:"results"`
+}
+
+func (r *importReport) add(result importResult) {
+	r.Total++
+	switch result.Status {
+	case importCreated:
+		r.Created++
+	case importValid:
+		r.Valid++
+	case importDuplicate:
+		r.Duplicates++
+	case importInvalid:
+		r.Invalid++
+	case importFailed:
+		r.Failed++
+	}
+	r.Results = append(r.Results, result)
+}
+
+// readImportRecords splits an NDJSON body into lines, skipping blank ones,
+// or a Bundle into the resources of its entries.
+func readImportRecords(contentType string, body []byte) ([]importRecord, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range ndjsonTypes {
+		if mediaType != t {
+			continue
+		}
+
+		var records []importRecord
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for number := 1; scanner.Scan(); number++ {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			records = append(records, importRecord{number: number, resource: append(json.RawMessage(nil), line...), fhirJSON: true})
+		}
+		return records, scanner.Err()
+	}
+
+	var bundle bundleRequest
+	if err := json.Unmarshal(body, &bundle); err != nil || bundle.ResourceType != "Bundle" {
+		return nil, errors.New("body must be NDJSON or a FHIR Bundle")
+	}
+
+	records := make([]importRecord, 0, len(bundle.Entry))
+	for i, entry := range bundle.Entry {
+		records = append(records, importRecord{number: i + 1, resource: entry.Resource})
+	}
+	return records, nil
+}
+
+// splitResourceType returns the resourceType of a resource and the
+// resource without it, as the protos have no such field.
+func splitResourceType(resource json.RawMessage) (string, []byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(resource, &fields); err != nil || fields == nil {
+		return "", nil, errors.New("record is not a JSON object")
+	}
+
+	var resourceType string
+	if err := json.Unmarshal(fields["resourceType"], &resourceType); err != nil || resourceType == "" {
+		return "", nil, errors.New("record has no resourceType")
+	}
+	delete(fields, "resourceType")
+
+	body, err := json.Marshal(fields)
+	return resourceType, body, err
+}
+
+// parseImportRecord returns the resourceType of a record and the resource
+// it holds, read as FHIR JSON or as the JSON the handlers read depending on
+// where the record came from. The type is returned even if the resource is
+// invalid, so that the report can name it.
+func parseImportRecord(record importRecord) (string, proto.Message, error) {
+	resourceType, body, err := splitResourceType(record.resource)
+	if err != nil {
+		return "", nil, err
+	}
+	if resourceType != "Patient" && resourceType != "Practitioner" {
+		return resourceType, nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+	}
+
+	if record.fhirJSON {
+		resource, err := parseFHIRJSON(record.resource)
+		if err != nil {
+			return resourceType, nil, fmt.Errorf("invalid FHIR %s: %w", resourceType, err)
+		}
+		return resourceType, resource.Interface(), nil
+	}
+
+	resource, err := newResource(resourceType)
+	if err != nil {
+		return resourceType, nil, err
+	}
+	if err := protojson.Unmarshal(body, resource.Interface()); err != nil {
+		return resourceType, nil, fmt.Errorf("invalid FHIR %s: %w", resourceType, err)
+	}
+	return resourceType, resource.Interface(), nil
+}
+
+// Import implements $import for patients and practitioners, read from an
+// NDJSON body or a Bundle. Each record is validated and checked for
+// duplicates, among existing resources and earlier records, on its own;
+// with _dryRun=true nothing is created. The response reports the outcome
+// of every record.
+func (s *FHIRServer) Import(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("_dryRun", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "_dryRun must be true or false"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	records, err := readImportRecords(c.ContentType(), body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Importing %d FHIR records (dry run: %t)", len(records), dryRun)
+
+	report := importReport{DryRun: dryRun, Results: []importResult{}}
+	seen := map[string]importResult{}
+	for _, record := range records {
+		report.add(s.importRecord(record, dryRun, seen))
+	}
+
+	log.Printf("FHIR import done: %d created, %d valid, %d duplicates, %d invalid, %d failed",
+		report.Created, report.Valid, report.Duplicates, report.Invalid, report.Failed)
+	c.JSON(http.StatusOK, report)
+}
+
+// importRecord validates and, unless dryRun, creates one record. seen
+// holds the earlier records of the import by duplicate key.
+func (s *FHIRServer) importRecord(record importRecord, dryRun bool, seen map[string]importResult) importResult {
+	result := importResult{Record: record.number}
+
+	resourceType, resource, err := parseImportRecord(record)
+	result.ResourceType = resourceType
+	if err != nil {
+		result.Status, result.Message = importInvalid, err.Error()
+		return result
+	}
+
+	switch resource := resource.(type) {
+	case *patpb.Patient:
+		s.importPatient(&result, resource, dryRun, seen)
+	case *practpb.Practitioner:
+		s.importPractitioner(&result, resource, dryRun, seen)
+	}
+	return result
+}
+
+func (s *FHIRServer) importPatient(result *importResult, fhirPatient *patpb.Patient, dryRun bool, seen map[string]importResult) {
+	if issues := validateResource("Patient", fhirPatient, s.lookupReference); hasErrors(issues) {
+		result.Status, result.Message = importInvalid, issuesMessage(issues)
+		return
+	}
+
+	patient, err := FHIRToPatient(fhirPatient)
+	if err != nil {
+		result.Status, result.Message = importInvalid, err.Error()
+		return
+	}
+
+	if idPattern.MatchString(patient.ID) {
+		if _, err := s.patientService.GetPatientByID(patient.ID); err == nil {
+			result.Status, result.ID, result.Message = importDuplicate, patient.ID, "a patient with this id already exists"
+			return
+		}
+	}
+
+	key := strings.ToLower("Patient|" + patient.FirstName + "|" + patient.LastName + "|" + patient.DateOfBirth)
+	if earlier, ok := seen[key]; ok {
+		result.Status, result.ID, result.Message = importDuplicate, earlier.ID, fmt.Sprintf("same patient as record %d", earlier.Record)
+		return
+	}
+
+	existing, err := s.patientService.FindPatientByDemographics(patient.FirstName, patient.LastName, patient.DateOfBirth)
+	if err == nil {
+		result.Status, result.ID, result.Message = importDuplicate, existing.ID, "a patient with the same name and birth date exists"
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		result.Status, result.Message = importFailed, err.Error()
+		return
+	}
+
+	result.Status = importValid
+	if !dryRun {
+		id, err := s.patientService.CreatePatient(patient)
+		if err != nil {
+			result.Status, result.Message = importFailed, err.Error()
+			return
+		}
+		result.Status, result.ID = importCreated, id
+	}
+	seen[key] = *result
+}
+
+func (s *FHIRServer) importPractitioner(result *importResult, fhirPractitioner *practpb.Practitioner, dryRun bool, seen map[string]importResult) {
+	if issues := validateResource("Practitioner", fhirPractitioner, s.lookupReference); hasErrors(issues) {
+		result.Status, result.Message = importInvalid, issuesMessage(issues)
+		return
+	}
+
+	practitioner, err := FHIRToPractitioner(fhirPractitioner)
+	if err != nil {
+		result.Status, result.Message = importInvalid, err.Error()
+		return
+	}
+
+	if idPattern.MatchString(practitioner.ID) {
+		if _, err := s.practitionerService.GetPractitionerByID(practitioner.ID); err == nil {
+			result.Status, result.ID, result.Message = importDuplicate, practitioner.ID, "a practitioner with this id already exists"
+			return
+		}
+	}
+
+	for _, identifier := range practitioner.Identifiers {
+		system := identifier.System
+		matches, err := s.practitionerService.SearchPractitioners(models.PractitionerFilter{Identifier: &models.IdentifierFilter{System: &system, Value: identifier.Value}})
+		if err != nil {
+			result.Status, result.Message = importFailed, err.Error()
+			return
+		}
+		if len(matches) > 0 {
+			result.Status, result.ID, result.Message = importDuplicate, matches[0].ID, "a practitioner with the same identifier exists"
+			return
+		}
+	}
+
+	key := strings.ToLower("Practitioner|" + practitioner.FirstName + "|" + practitioner.LastName + "|" + practitioner.Specialization)
+	if earlier, ok := seen[key]; ok {
+		result.Status, result.ID, result.Message = importDuplicate, earlier.ID, fmt.Sprintf("same practitioner as record %d", earlier.Record)
+		return
+	}
+
+	existing, err := s.practitionerService.FindPractitionerByName(practitioner.FirstName, practitioner.LastName, practitioner.Specialization)
+	if err == nil {
+		result.Status, result.ID, result.Message = importDuplicate, existing.ID, "a practitioner with the same name and qualification exists"
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		result.Status, result.Message = importFailed, err.Error()
+		return
+	}
+
+	result.Status = importValid
+	if !dryRun {
+		id, err := s.practitionerService.CreatePractitioner(practitioner)
+		if errors.Is(err, repository.ErrDuplicateIdentifier) {
+			result.Status, result.Message = importDuplicate, "a practitioner with the same identifier exists"
+			return
+		}
+		if err != nil {
+			result.Status, result.Message = importFailed, err.Error()
+			return
+		}
+		result.Status, result.ID = importCreated, id
+	}
+	seen[key] = *result
+}
@@ -0,0 +1,227 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"hospital-srv/models"
+	"testing"
+
+	patpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReadImportRecords(t *testing.T) {
+	ndjson := "{\"resourceType\":\"Patient\"}\n\n  \n{\"resourceType\":\"Practitioner\"}\n"
+
+	for _, contentType := range []string{"application/fhir+ndjson", "application/x-ndjson; charset=utf-8"} {
+		records, err := readImportRecords(contentType, []byte(ndjson))
+		if err != nil {
+			t.Fatalf("readImportRecords(%s) = %v", contentType, err)
+		}
+		if len(records) != 2 || records[0].number != 1 || records[1].number != 4 {
+			t.Fatalf("readImportRecords(%s) = %+v, want lines 1 and 4", contentType, records)
+		}
+		if string(records[1].resource) != `{"resourceType":"Practitioner"}` {
+			t.Errorf("line 4 = %s", records[1].resource)
+		}
+	}
+
+	bundle := `{"resourceType":"Bundle","type":"collection","entry":[{"resource":{"resourceType":"Patient"}},{"resource":{"resourceType":"Practitioner"}}]}`
+	records, err := readImportRecords("application/fhir+json", []byte(bundle))
+	if err != nil {
+		t.Fatalf("readImportRecords(Bundle) = %v", err)
+	}
+	if len(records) != 2 || records[0].number != 1 || records[1].number != 2 {
+		t.Fatalf("readImportRecords(Bundle) = %+v, want entries 1 and 2", records)
+	}
+
+	for _, body := range []string{`{"resourceType":"Patient"}`, "not json"} {
+		if _, err := readImportRecords("application/json", []byte(body)); err == nil {
+			t.Errorf("readImportRecords(%s) = nil, want an error", body)
+		}
+	}
+}
+
+func TestSplitResourceType(t *testing.T) {
+	resourceType, body, err := splitResourceType(json.RawMessage(`{"resourceType":"Patient","id":{"value":"p1"}}`))
+	if err != nil {
+		t.Fatalf("splitResourceType() = %v", err)
+	}
+	if resourceType != "Patient" || string(body) != `{"id":{"value":"p1"}}` {
+		t.Errorf("splitResourceType() = %s, %s", resourceType, body)
+	}
+
+	for _, resource := range []string{`[]`, `null`, `{"id":{"value":"p1"}}`, `{"resourceType":""}`, `{"resourceType":1}`} {
+		if _, _, err := splitResourceType(json.RawMessage(resource)); err == nil {
+			t.Errorf("splitResourceType(%s) = nil, want an error", resource)
+		}
+	}
+}
+
+func TestParseImportRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   importRecord
+		wantType string
+		wantErr  bool
+	}{
+		{
+			name:     "FHIR JSON line",
+			record:   importRecord{resource: json.RawMessage(`{"resourceType":"Patient","id":"p1","name":[{"family":"Ivanov","given":["Ivan"]}],"gender":"male","birthDate":"1980-05-17"}`), fhirJSON: true},
+			wantType: "Patient",
+		},
+		{
+			name:     "Bundle entry",
+			record:   importRecord{resource: json.RawMessage(`{"resourceType":"Patient","id":{"value":"p1"},"gender":{"value":"MALE"}}`)},
+			wantType: "Patient",
+		},
+		{
+			name:     "protojson line",
+			record:   importRecord{resource: json.RawMessage(`{"resourceType":"Patient","id":{"value":"p1"}}`), fhirJSON: true},
+			wantType: "Patient",
+			wantErr:  true,
+		},
+		{
+			name:     "FHIR JSON entry",
+			record:   importRecord{resource: json.RawMessage(`{"resourceType":"Patient","id":"p1"}`)},
+			wantType: "Patient",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid code",
+			record:   importRecord{resource: json.RawMessage(`{"resourceType":"Practitioner","gender":"unknown-gender"}`), fhirJSON: true},
+			wantType: "Practitioner",
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported type",
+			record:   importRecord{resource: json.RawMessage(`{"resourceType":"Encounter","status":"planned"}`), fhirJSON: true},
+			wantType: "Encounter",
+			wantErr:  true,
+		},
+		{name: "no resourceType", record: importRecord{resource: json.RawMessage(`{"id":"p1"}`), fhirJSON: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		resourceType, resource, err := parseImportRecord(tt.record)
+		if resourceType != tt.wantType {
+			t.Errorf("%s: resourceType = %q, want %q", tt.name, resourceType, tt.wantType)
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: parseImportRecord() = %v, want an error", tt.name, resource)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseImportRecord() = %v", tt.name, err)
+			continue
+		}
+		if patient, ok := resource.(*patpb.Patient); !ok || patient.GetId().GetValue() != "p1" {
+			t.Errorf("%s: parseImportRecord() = %v, want Patient p1", tt.name, resource)
+		}
+	}
+}
+
+func TestImportNDJSONInvalidLine(t *testing.T) {
+	s := &FHIRServer{}
+	ndjson := `{"resourceType":"Patient","name":[{"family":"Ivanov","given":["Ivan"]}],"birthDate":"1980-05-17"}` + "\n" +
+		`{"resourceType":"Patient","birthDate":"17.05.1980"}` + "\n"
+
+	records, err := readImportRecords(contentTypeFHIRNDJSON, []byte(ndjson))
+	if err != nil {
+		t.Fatalf("readImportRecords() = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("readImportRecords() = %d records, want 2", len(records))
+	}
+
+	if _, _, err := parseImportRecord(records[0]); err != nil {
+		t.Errorf("line 1: parseImportRecord() = %v", err)
+	}
+
+	result := s.importRecord(records[1], true, map[string]importResult{})
+	if result.Record != 2 || result.Status != importInvalid || result.ResourceType != "Patient" || result.Message == "" {
+		t.Errorf("line 2: importRecord() = %+v, want an invalid Patient on line 2", result)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	middleName := "Petrovich"
+	patient := models.Patient{ID: patientID, FirstName: "Ivan", LastName: "Ivanov", MiddleName: &middleName, DateOfBirth: "1980-05-17", Gender: "male"}
+	practitioner := models.Practitioner{ID: practitionerID, FirstName: "Anna", LastName: "Smirnova", Specialization: "Cardiology", Active: true}
+
+	var buf bytes.Buffer
+	if err := writeNDJSON(&buf, []proto.Message{PatientToFHIR(patient), PractitionerToFHIR(practitioner)}); err != nil {
+		t.Fatalf("writeNDJSON() = %v", err)
+	}
+
+	records, err := readImportRecords(contentTypeFHIRNDJSON, buf.Bytes())
+	if err != nil {
+		t.Fatalf("readImportRecords() = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("readImportRecords() = %d records, want 2", len(records))
+	}
+
+	_, resource, err := parseImportRecord(records[0])
+	if err != nil {
+		t.Fatalf("patient: parseImportRecord() = %v", err)
+	}
+	gotPatient, err := FHIRToPatient(resource.(*patpb.Patient))
+	if err != nil {
+		t.Fatalf("FHIRToPatient() = %v", err)
+	}
+	if gotPatient.ID != patient.ID || gotPatient.FirstName != patient.FirstName || gotPatient.LastName != patient.LastName ||
+		gotPatient.MiddleName == nil || *gotPatient.MiddleName != middleName || gotPatient.DateOfBirth != patient.DateOfBirth || gotPatient.Gender != patient.Gender {
+		t.Errorf("imported patient = %+v, want %+v", gotPatient, patient)
+	}
+
+	_, resource, err = parseImportRecord(records[1])
+	if err != nil {
+		t.Fatalf("practitioner: parseImportRecord() = %v", err)
+	}
+	gotPractitioner, err := FHIRToPractitioner(resource.(*practpb.Practitioner))
+	if err != nil {
+		t.Fatalf("FHIRToPractitioner() = %v", err)
+	}
+	if gotPractitioner.ID != practitioner.ID || gotPractitioner.FirstName != practitioner.FirstName || gotPractitioner.LastName != practitioner.LastName ||
+		gotPractitioner.Specialization != practitioner.Specialization || !gotPractitioner.Active {
+		t.Errorf("imported practitioner = %+v, want %+v", gotPractitioner, practitioner)
+	}
+}
+
+func TestImportRecordInvalid(t *testing.T) {
+	s := &FHIRServer{}
+
+	tests := []struct {
+		name     string
+		resource string
+		wantType string
+	}{
+		{name: "not an object", resource: `"Patient"`},
+		{name: "unsupported type", resource: `{"resourceType":"Encounter"}`, wantType: "Encounter"},
+		{name: "invalid patient", resource: `{"resourceType":"Patient","name":"Ivan"}`, wantType: "Patient"},
+		{name: "patient without a birth date", resource: `{"resourceType":"Patient","name":[{"family":{"value":"Ivanov"},"given":[{"value":"Ivan"}]}]}`, wantType: "Patient"},
+		{name: "practitioner without a qualification", resource: `{"resourceType":"Practitioner","name":[{"family":{"value":"Smirnova"},"given":[{"value":"Anna"}]}]}`, wantType: "Practitioner"},
+	}
+
+	for _, tt := range tests {
+		result := s.importRecord(importRecord{number: 3, resource: json.RawMessage(tt.resource)}, true, map[string]importResult{})
+		if result.Record != 3 || result.Status != importInvalid || result.ResourceType != tt.wantType || result.Message == "" {
+			t.Errorf("%s: importRecord() = %+v, want an invalid %s record", tt.name, result, tt.wantType)
+		}
+	}
+}
+
+func TestImportReportAdd(t *testing.T) {
+	var report importReport
+	for _, status := range []string{importCreated, importCreated, importValid, importDuplicate, importInvalid, importFailed} {
+		report.add(importResult{Status: status})
+	}
+
+	if report.Total != 6 || report.Created != 2 || report.Valid != 1 || report.Duplicates != 1 || report.Invalid != 1 || report.Failed != 1 || len(report.Results) != 6 {
+		t.Errorf("report = %+v", report)
+	}
+}
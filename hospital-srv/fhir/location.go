@@ -0,0 +1,38 @@
+package fhir
+
+import (
+	"fmt"
+	"hospital-srv/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	locpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/location_go_proto"
+)
+
+func (s *FHIRServer) locations() resourceHandler[models.Location, models.LocationFilter, *locpb.Location] {
+	return resourceHandler[models.Location, models.LocationFilter, *locpb.Location]{
+		resourceType: "Location",
+		toFHIR:       LocationToFHIR,
+		fromFHIR:     FHIRToLocation,
+		parseSearch:  parseLocationSearch,
+		meta: func(location models.Location) (string, int, time.Time) {
+			return location.ID, location.VersionID, location.UpdatedAt
+		},
+		describe: func(location models.Location) string {
+			return fmt.Sprintf("(%s, %s)", location.Name, location.PhysicalType)
+		},
+		create:  s.organizationService.CreateLocation,
+		get:     s.organizationService.GetLocationByID,
+		search:  s.organizationService.SearchLocations,
+		update:  s.organizationService.UpdateLocation,
+		history: s.organizationService.GetLocationHistory,
+		version: s.organizationService.GetLocationVersion,
+	}
+}
+
+func (s *FHIRServer) CreateLocation(c *gin.Context)     { s.locations().handleCreate(c) }
+func (s *FHIRServer) GetLocations(c *gin.Context)       { s.locations().handleSearch(c) }
+func (s *FHIRServer) GetLocation(c *gin.Context)        { s.locations().handleRead(c) }
+func (s *FHIRServer) UpdateLocation(c *gin.Context)     { s.locations().handleUpdate(c) }
+func (s *FHIRServer) GetLocationHistory(c *gin.Context) { s.locations().handleHistory(c) }
+func (s *FHIRServer) GetLocationVersion(c *gin.Context) { s.locations().handleVersion(c) }
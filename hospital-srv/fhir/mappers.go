@@ -1,17 +1,137 @@
 package fhir
 
 import (
+	"errors"
 	"fmt"
 	"hospital-srv/models"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
 	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	apptpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/appointment_go_proto"
+	comppb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/composition_go_proto"
+	condpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/condition_go_proto"
 	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	locpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/location_go_proto"
+	mrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/medication_request_go_proto"
+	orgpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/organization_go_proto"
+	patpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
 	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+	prrolepb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_role_go_proto"
+	schedpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/schedule_go_proto"
+	slotpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/slot_go_proto"
+	subpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/subscription_go_proto"
+	vspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/valuesets_go_proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+func resourceMeta(versionID int, updatedAt time.Time) *dtpb.Meta {
+	return &dtpb.Meta{
+		VersionId: &dtpb.Id{Value: strconv.Itoa(versionID)},
+		LastUpdated: &dtpb.Instant{
+			ValueUs:   updatedAt.UnixMicro(),
+			Precision: dtpb.Instant_MICROSECOND,
+		},
+	}
+}
+
+func PatientToFHIR(p models.Patient) *patpb.Patient {
+	given := []*dtpb.String{{Value: p.FirstName}}
+	if p.MiddleName != nil && *p.MiddleName != "" {
+		given = append(given, &dtpb.String{Value: *p.MiddleName})
+	}
+
+	resource := &patpb.Patient{
+		Id:   &dtpb.Id{Value: p.ID},
+		Meta: resourceMeta(p.VersionID, p.UpdatedAt),
+		Name: []*dtpb.HumanName{
+			{
+				Family: &dtpb.String{Value: p.LastName},
+				Given:  given,
+			},
+		},
+	}
+
+	switch p.Gender {
+	case "male":
+		resource.Gender = &patpb.Patient_GenderCode{Value: codespb.AdministrativeGenderCode_MALE}
+	case "female":
+		resource.Gender = &patpb.Patient_GenderCode{Value: codespb.AdministrativeGenderCode_FEMALE}
+	}
+
+	if len(p.DateOfBirth) >= 10 {
+		if birthDate, err := time.Parse("2006-01-02", p.DateOfBirth[:10]); err == nil {
+			resource.BirthDate = &dtpb.Date{
+				ValueUs:   birthDate.UnixMicro(),
+				Timezone:  "UTC",
+				Precision: dtpb.Date_DAY,
+			}
+		}
+	}
+
+	return resource
+}
+
+// FHIRToPatient reads a patient. A name with a family and a given name and
+// a birth date are required; the gender defaults to unknown.
+func FHIRToPatient(fhirPat *patpb.Patient) (models.Patient, error) {
+	patient := models.Patient{Gender: "unknown"}
+
+	if fhirPat.Id != nil {
+		patient.ID = fhirPat.Id.Value
+	}
+
+	if len(fhirPat.Name) > 0 {
+		name := fhirPat.Name[0]
+		if name.Family != nil {
+			patient.LastName = strings.TrimSpace(name.Family.Value)
+		}
+		if len(name.Given) > 0 && name.Given[0] != nil {
+			patient.FirstName = strings.TrimSpace(name.Given[0].Value)
+		}
+		if len(name.Given) > 1 && name.Given[1] != nil {
+			middleName := name.Given[1].Value
+			patient.MiddleName = &middleName
+		}
+	}
+	if patient.FirstName == "" || patient.LastName == "" {
+		return patient, errors.New("patient must have a family and a given name")
+	}
+
+	if fhirPat.BirthDate == nil {
+		return patient, errors.New("patient must have a birthDate")
+	}
+	patient.DateOfBirth = dateString(fhirPat.BirthDate)
+
+	if fhirPat.Gender != nil {
+		switch fhirPat.Gender.Value {
+		case codespb.AdministrativeGenderCode_MALE:
+			patient.Gender = "male"
+		case codespb.AdministrativeGenderCode_FEMALE:
+			patient.Gender = "female"
+		case codespb.AdministrativeGenderCode_OTHER:
+			patient.Gender = "other"
+		}
+	}
+
+	return patient, nil
+}
+
+// dateString formats a FHIR date as YYYY-MM-DD in its own timezone.
+func dateString(d *dtpb.Date) string {
+	loc := time.UTC
+	if l, err := time.LoadLocation(d.Timezone); err == nil {
+		loc = l
+	} else if t, err := time.Parse("-07:00", d.Timezone); err == nil {
+		loc = t.Location()
+	}
+	return time.UnixMicro(d.ValueUs).In(loc).Format("2006-01-02")
+}
+
 func PractitionerToFHIR(p models.Practitioner) *practpb.Practitioner {
 	given := []*dtpb.String{{Value: p.FirstName}}
 	if p.MiddleName != nil && *p.MiddleName != "" {
@@ -19,7 +139,10 @@ func PractitionerToFHIR(p models.Practitioner) *practpb.Practitioner {
 	}
 
 	resource := &practpb.Practitioner{
-		Id: &dtpb.Id{Value: p.ID},
+		Id:         &dtpb.Id{Value: p.ID},
+		Meta:       resourceMeta(p.VersionID, p.UpdatedAt),
+		Identifier: identifiersToFHIR(p.Identifiers),
+		Active:     &dtpb.Boolean{Value: p.Active},
 		Name: []*dtpb.HumanName{
 			{
 				Family: &dtpb.String{Value: p.LastName},
@@ -38,13 +161,21 @@ func PractitionerToFHIR(p models.Practitioner) *practpb.Practitioner {
 	return resource
 }
 
+// FHIRToPractitioner reads a practitioner, who is active unless active is
+// set to false.
 func FHIRToPractitioner(fhirPrac *practpb.Practitioner) (models.Practitioner, error) {
-	practitioner := models.Practitioner{}
+	practitioner := models.Practitioner{Active: true}
+
+	if fhirPrac.Active != nil {
+		practitioner.Active = fhirPrac.Active.Value
+	}
 
 	if fhirPrac.Id != nil {
 		practitioner.ID = fhirPrac.Id.Value
 	}
 
+	practitioner.Identifiers = identifiersFromFHIR(fhirPrac.Identifier)
+
 	if len(fhirPrac.Name) > 0 {
 		name := fhirPrac.Name[0]
 		if name.Family != nil {
@@ -66,6 +197,108 @@ func FHIRToPractitioner(fhirPrac *practpb.Practitioner) (models.Practitioner, er
 	return practitioner, nil
 }
 
+// extensionStatusActor is the statusHistory extension naming who moved the
+// encounter into that status.
+const extensionStatusActor = "urn:hospital-srv:fhir:StructureDefinition/encounter-status-actor"
+
+var encounterStatusCodes = map[string]codespb.EncounterStatusCode_Value{
+	models.EncounterStatusPlanned:    codespb.EncounterStatusCode_PLANNED,
+	models.EncounterStatusArrived:    codespb.EncounterStatusCode_ARRIVED,
+	models.EncounterStatusInProgress: codespb.EncounterStatusCode_IN_PROGRESS,
+	models.EncounterStatusCompleted:  codespb.EncounterStatusCode_FINISHED,
+	models.EncounterStatusCancelled:  codespb.EncounterStatusCode_CANCELLED,
+}
+
+const (
+	systemActCode     = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	systemActPriority = "http://terminology.hl7.org/CodeSystem/v3-ActPriority"
+	systemICD10       = "http://hl7.org/fhir/sid/icd-10"
+)
+
+// encounterClassDisplays lists the supported encounter classes with their
+// v3-ActCode display names.
+var encounterClassDisplays = map[string]string{
+	models.EncounterClassAmbulatory: "ambulatory",
+	models.EncounterClassEmergency:  "emergency",
+	models.EncounterClassHomeHealth: "home health",
+	models.EncounterClassInpatient:  "inpatient encounter",
+	models.EncounterClassVirtual:    "virtual",
+}
+
+// encounterPriorityDisplays lists the supported encounter priorities with
+// their v3-ActPriority display names.
+var encounterPriorityDisplays = map[string]string{
+	models.EncounterPriorityRoutine:   "routine",
+	models.EncounterPriorityUrgent:    "urgent",
+	models.EncounterPriorityEmergency: "emergency",
+	models.EncounterPriorityElective:  "elective",
+}
+
+// icd10Pattern matches an ICD-10 code such as "J06.9": a category of a
+// letter and two characters, optionally followed by a dotted subdivision.
+var icd10Pattern = regexp.MustCompile(`^[A-Z][0-9][0-9A-Z](\.[0-9A-Z]{1,4})?$`)
+
+func coding(system string, code string, display string) *dtpb.Coding {
+	c := &dtpb.Coding{
+		System: &dtpb.Uri{Value: system},
+		Code:   &dtpb.Code{Value: code},
+	}
+	if display != "" {
+		c.Display = &dtpb.String{Value: display}
+	}
+	return c
+}
+
+// conceptCode returns the code of the first coding from system.
+func conceptCode(concept *dtpb.CodeableConcept, system string) (string, bool) {
+	if concept == nil {
+		return "", false
+	}
+	for _, c := range concept.Coding {
+		if c.System != nil && c.System.Value == system && c.Code != nil {
+			return c.Code.Value, true
+		}
+	}
+	return "", false
+}
+
+// conceptText returns the text of concept, or nil when it has none.
+func conceptText(concept *dtpb.CodeableConcept) *string {
+	if concept == nil || concept.Text == nil || concept.Text.Value == "" {
+		return nil
+	}
+	text := concept.Text.Value
+	return &text
+}
+
+// encounterStatusHistory turns the recorded status changes into
+// statusHistory entries. Each status lasts until the next change; the
+// current status has an open period.
+func encounterStatusHistory(changes []models.EncounterStatusChange) []*encpb.Encounter_StatusHistory {
+	history := make([]*encpb.Encounter_StatusHistory, 0, len(changes))
+	for i, change := range changes {
+		entry := &encpb.Encounter_StatusHistory{
+			Status: &encpb.Encounter_StatusHistory_StatusCode{Value: encounterStatusCodes[change.Status]},
+			Period: &dtpb.Period{
+				Start: &dtpb.DateTime{ValueUs: change.ChangedAt.UnixMicro(), Precision: dtpb.DateTime_SECOND},
+			},
+		}
+		if i+1 < len(changes) {
+			entry.Period.End = &dtpb.DateTime{ValueUs: changes[i+1].ChangedAt.UnixMicro(), Precision: dtpb.DateTime_SECOND}
+		}
+		if change.Actor != nil {
+			entry.Extension = []*dtpb.Extension{{
+				Url: &dtpb.Uri{Value: extensionStatusActor},
+				Value: &dtpb.Extension_ValueX{
+					Choice: &dtpb.Extension_ValueX_StringValue{StringValue: &dtpb.String{Value: *change.Actor}},
+				},
+			}}
+		}
+		history = append(history, entry)
+	}
+	return history
+}
+
 func EncounterToFHIR(e models.EncounterWithDetails) *encpb.Encounter {
 	startTime := timestamppb.New(e.StartTime)
 
@@ -73,32 +306,21 @@ func EncounterToFHIR(e models.EncounterWithDetails) *encpb.Encounter {
 	if e.Patient.MiddleName != nil && *e.Patient.MiddleName != "" {
 		patientDisplay = fmt.Sprintf("%s %s %s", e.Patient.LastName, e.Patient.FirstName, *e.Patient.MiddleName)
 	}
-	if e.Patient.Gender != "" {
-		patientDisplay = fmt.Sprintf("%s [%s]", patientDisplay, e.Patient.Gender)
-	}
 
 	practitionerDisplay := fmt.Sprintf("%s %s", e.Practitioner.LastName, e.Practitioner.FirstName)
 	if e.Practitioner.MiddleName != nil && *e.Practitioner.MiddleName != "" {
 		practitionerDisplay = fmt.Sprintf("%s %s %s", e.Practitioner.LastName, e.Practitioner.FirstName, *e.Practitioner.MiddleName)
 	}
-	practitionerDisplay = fmt.Sprintf("%s - %s", practitionerDisplay, e.Practitioner.Specialization)
 
-	statusCode := codespb.EncounterStatusCode_ARRIVED
-	switch e.Status {
-	case "planned":
-		statusCode = codespb.EncounterStatusCode_PLANNED
-	case "arrived":
+	statusCode, ok := encounterStatusCodes[e.Status]
+	if !ok {
 		statusCode = codespb.EncounterStatusCode_ARRIVED
-	case "in-progress":
-		statusCode = codespb.EncounterStatusCode_IN_PROGRESS
-	case "completed":
-		statusCode = codespb.EncounterStatusCode_FINISHED
-	case "cancelled":
-		statusCode = codespb.EncounterStatusCode_CANCELLED
 	}
 
 	resource := &encpb.Encounter{
-		Id: &dtpb.Id{Value: e.ID},
+		Id:         &dtpb.Id{Value: e.ID},
+		Meta:       resourceMeta(e.VersionID, e.UpdatedAt),
+		Identifier: identifiersToFHIR(e.Identifiers),
 		Status: &encpb.Encounter_StatusCode{
 			Value: statusCode,
 		},
@@ -126,45 +348,134 @@ func EncounterToFHIR(e models.EncounterWithDetails) *encpb.Encounter {
 		},
 	}
 
+	if display, ok := encounterClassDisplays[e.Class]; ok {
+		resource.ClassValue = coding(systemActCode, e.Class, display)
+	}
+
+	if e.Type != nil {
+		resource.Type = []*dtpb.CodeableConcept{{Text: &dtpb.String{Value: *e.Type}}}
+	}
+
+	if e.ServiceType != nil {
+		resource.ServiceType = &dtpb.CodeableConcept{Text: &dtpb.String{Value: *e.ServiceType}}
+	}
+
+	if e.Priority != nil {
+		resource.Priority = &dtpb.CodeableConcept{
+			Coding: []*dtpb.Coding{coding(systemActPriority, *e.Priority, encounterPriorityDisplays[*e.Priority])},
+		}
+	}
+
+	if e.ReasonText != nil || e.ReasonCode != nil {
+		reason := &dtpb.CodeableConcept{}
+		if e.ReasonCode != nil {
+			reason.Coding = []*dtpb.Coding{coding(systemICD10, *e.ReasonCode, "")}
+		}
+		if e.ReasonText != nil {
+			reason.Text = &dtpb.String{Value: *e.ReasonText}
+		}
+		resource.ReasonCode = []*dtpb.CodeableConcept{reason}
+	}
+
+	if e.EndTime != nil {
+		resource.Period.End = &dtpb.DateTime{
+			ValueUs:   e.EndTime.UnixMicro(),
+			Precision: dtpb.DateTime_SECOND,
+		}
+	}
+
+	if len(e.StatusHistory) > 0 {
+		resource.StatusHistory = encounterStatusHistory(e.StatusHistory)
+	}
+
+	if e.AppointmentID != nil {
+		resource.Appointment = []*dtpb.Reference{reference("Appointment", *e.AppointmentID)}
+	}
+
+	if e.LocationID != nil {
+		location := reference("Location", *e.LocationID)
+		if e.LocationName != nil {
+			location.Display = &dtpb.String{Value: *e.LocationName}
+		}
+		resource.Location = []*encpb.Encounter_Location{{Location: location}}
+	}
+
 	return resource
 }
 
 func FHIRToEncounter(fhirEnc *encpb.Encounter) (models.Encounter, error) {
 	encounter := models.Encounter{
-		Status: "arrived",
+		Status: models.EncounterStatusArrived,
+		Class:  models.EncounterClassAmbulatory,
 	}
 
 	if fhirEnc.Id != nil {
 		encounter.ID = fhirEnc.Id.Value
 	}
 
+	encounter.Identifiers = identifiersFromFHIR(fhirEnc.Identifier)
+
 	if fhirEnc.Status != nil {
-		switch fhirEnc.Status.Value {
-		case codespb.EncounterStatusCode_PLANNED:
-			encounter.Status = "planned"
-		case codespb.EncounterStatusCode_ARRIVED:
-			encounter.Status = "arrived"
-		case codespb.EncounterStatusCode_IN_PROGRESS:
-			encounter.Status = "in-progress"
-		case codespb.EncounterStatusCode_FINISHED:
-			encounter.Status = "completed"
-		case codespb.EncounterStatusCode_CANCELLED:
-			encounter.Status = "cancelled"
+		for status, code := range encounterStatusCodes {
+			if code == fhirEnc.Status.Value {
+				encounter.Status = status
+			}
+		}
+	}
+
+	if fhirEnc.ClassValue != nil && fhirEnc.ClassValue.Code != nil {
+		if _, ok := encounterClassDisplays[fhirEnc.ClassValue.Code.Value]; !ok {
+			return encounter, fmt.Errorf("unsupported encounter class: %s", fhirEnc.ClassValue.Code.Value)
+		}
+		encounter.Class = fhirEnc.ClassValue.Code.Value
+	}
+
+	if len(fhirEnc.Type) > 0 {
+		encounter.Type = conceptText(fhirEnc.Type[0])
+	}
+
+	encounter.ServiceType = conceptText(fhirEnc.ServiceType)
+
+	if priority, ok := conceptCode(fhirEnc.Priority, systemActPriority); ok {
+		if _, ok := encounterPriorityDisplays[priority]; !ok {
+			return encounter, fmt.Errorf("unsupported encounter priority: %s", priority)
+		}
+		encounter.Priority = &priority
+	}
+
+	if len(fhirEnc.ReasonCode) > 0 {
+		reason := fhirEnc.ReasonCode[0]
+		encounter.ReasonText = conceptText(reason)
+		if code, ok := conceptCode(reason, systemICD10); ok {
+			code = strings.ToUpper(code)
+			if !icd10Pattern.MatchString(code) {
+				return encounter, fmt.Errorf("invalid ICD-10 code: %s", code)
+			}
+			encounter.ReasonCode = &code
 		}
 	}
 
-	if fhirEnc.Subject != nil && fhirEnc.Subject.GetUri() != nil {
-		var patientID string
-		fmt.Sscanf(fhirEnc.Subject.GetUri().Value, "Patient/%s", &patientID)
-		encounter.PatientID = patientID
+	patientID, ok := referencedID(fhirEnc.Subject, "Patient")
+	if !ok {
+		return encounter, errors.New("encounter subject must reference a Patient")
+	}
+	encounter.PatientID = patientID
+
+	if len(fhirEnc.Participant) == 0 {
+		return encounter, errors.New("encounter must have a participant")
 	}
+	practitionerID, ok := referencedID(fhirEnc.Participant[0].Individual, "Practitioner")
+	if !ok {
+		return encounter, errors.New("encounter participant must reference a Practitioner")
+	}
+	encounter.PractitionerID = practitionerID
 
-	if len(fhirEnc.Participant) > 0 && fhirEnc.Participant[0].Individual != nil {
-		if uri := fhirEnc.Participant[0].Individual.GetUri(); uri != nil {
-			var practitionerID string
-			fmt.Sscanf(uri.Value, "Practitioner/%s", &practitionerID)
-			encounter.PractitionerID = practitionerID
+	if len(fhirEnc.Location) > 0 {
+		locationID, ok := referencedID(fhirEnc.Location[0].Location, "Location")
+		if !ok {
+			return encounter, errors.New("encounter location must reference a Location")
 		}
+		encounter.LocationID = &locationID
 	}
 
 	if fhirEnc.Period != nil && fhirEnc.Period.Start != nil {
@@ -173,5 +484,1189 @@ func FHIRToEncounter(fhirEnc *encpb.Encounter) (models.Encounter, error) {
 		encounter.StartTime = time.Now()
 	}
 
+	if fhirEnc.Period != nil && fhirEnc.Period.End != nil {
+		endTime := time.UnixMicro(fhirEnc.Period.End.ValueUs)
+		encounter.EndTime = &endTime
+	}
+
 	return encounter, nil
 }
+
+var subscriptionStatusCodes = map[string]codespb.SubscriptionStatusCode_Value{
+	models.SubscriptionStatusRequested: codespb.SubscriptionStatusCode_REQUESTED,
+	models.SubscriptionStatusActive:    codespb.SubscriptionStatusCode_ACTIVE,
+	models.SubscriptionStatusError:     codespb.SubscriptionStatusCode_ERROR,
+	models.SubscriptionStatusOff:       codespb.SubscriptionStatusCode_OFF,
+}
+
+func SubscriptionToFHIR(s models.Subscription) *subpb.Subscription {
+	resource := &subpb.Subscription{
+		Id:       &dtpb.Id{Value: s.ID},
+		Status:   &subpb.Subscription_StatusCode{Value: subscriptionStatusCodes[s.Status]},
+		Reason:   &dtpb.String{Value: s.Reason},
+		Criteria: &dtpb.String{Value: s.Criteria},
+		Channel: &subpb.Subscription_Channel{
+			Type:     &subpb.Subscription_Channel_TypeCode{Value: codespb.SubscriptionChannelTypeCode_REST_HOOK},
+			Endpoint: &dtpb.Url{Value: s.Endpoint},
+		},
+	}
+
+	if s.Payload != nil {
+		resource.Channel.Payload = &subpb.Subscription_Channel_PayloadCode{Value: *s.Payload}
+	}
+	for _, header := range s.Headers {
+		resource.Channel.Header = append(resource.Channel.Header, &dtpb.String{Value: header})
+	}
+	if s.Error != nil {
+		resource.Error = &dtpb.String{Value: *s.Error}
+	}
+	if s.End != nil {
+		resource.End = &dtpb.Instant{
+			ValueUs:   s.End.UnixMicro(),
+			Precision: dtpb.Instant_SECOND,
+		}
+	}
+
+	return resource
+}
+
+func FHIRToSubscription(fhirSub *subpb.Subscription) (models.Subscription, error) {
+	subscription := models.Subscription{
+		Status:      models.SubscriptionStatusActive,
+		ChannelType: models.SubscriptionChannelRestHook,
+		Headers:     []string{},
+	}
+
+	if fhirSub.Id != nil {
+		subscription.ID = fhirSub.Id.Value
+	}
+
+	if fhirSub.Status != nil && fhirSub.Status.Value == codespb.SubscriptionStatusCode_OFF {
+		subscription.Status = models.SubscriptionStatusOff
+	}
+
+	if fhirSub.Reason == nil || fhirSub.Reason.Value == "" {
+		return subscription, errors.New("subscription reason is required")
+	}
+	subscription.Reason = fhirSub.Reason.Value
+
+	if fhirSub.Criteria == nil || fhirSub.Criteria.Value == "" {
+		return subscription, errors.New("subscription criteria is required")
+	}
+	subscription.Criteria = fhirSub.Criteria.Value
+
+	channel := fhirSub.Channel
+	if channel == nil || channel.Type == nil || channel.Type.Value != codespb.SubscriptionChannelTypeCode_REST_HOOK {
+		return subscription, errors.New("only rest-hook subscription channels are supported")
+	}
+	if channel.Endpoint == nil || channel.Endpoint.Value == "" {
+		return subscription, errors.New("subscription channel endpoint is required")
+	}
+	subscription.Endpoint = channel.Endpoint.Value
+
+	if channel.Payload != nil && channel.Payload.Value != "" {
+		payload := channel.Payload.Value
+		subscription.Payload = &payload
+	}
+	for _, header := range channel.Header {
+		subscription.Headers = append(subscription.Headers, header.Value)
+	}
+
+	if fhirSub.End != nil {
+		end := time.UnixMicro(fhirSub.End.ValueUs).UTC()
+		subscription.End = &end
+	}
+
+	return subscription, nil
+}
+
+func reference(resourceType string, id string) *dtpb.Reference {
+	return &dtpb.Reference{
+		Reference: &dtpb.Reference_Uri{
+			Uri: &dtpb.String{Value: fmt.Sprintf("%s/%s", resourceType, id)},
+		},
+	}
+}
+
+func identifiersToFHIR(identifiers []models.Identifier) []*dtpb.Identifier {
+	var result []*dtpb.Identifier
+	for _, i := range identifiers {
+		identifier := &dtpb.Identifier{Value: &dtpb.String{Value: i.Value}}
+		if i.System != "" {
+			identifier.System = &dtpb.Uri{Value: i.System}
+		}
+		result = append(result, identifier)
+	}
+	return result
+}
+
+// identifiersFromFHIR never returns nil, so that an update without
+// identifiers removes the stored ones.
+func identifiersFromFHIR(identifiers []*dtpb.Identifier) []models.Identifier {
+	result := []models.Identifier{}
+	for _, i := range identifiers {
+		var identifier models.Identifier
+		if i.System != nil {
+			identifier.System = i.System.Value
+		}
+		if i.Value != nil {
+			identifier.Value = i.Value.Value
+		}
+		result = append(result, identifier)
+	}
+	return result
+}
+
+// referencedID returns the id of a "Type/id" reference to resourceType.
+func referencedID(ref *dtpb.Reference, resourceType string) (string, bool) {
+	if ref == nil || ref.GetUri() == nil {
+		return "", false
+	}
+	id, ok := strings.CutPrefix(ref.GetUri().Value, resourceType+"/")
+	return id, ok && id != ""
+}
+
+func toInstant(t time.Time) *dtpb.Instant {
+	return &dtpb.Instant{
+		ValueUs:   t.UnixMicro(),
+		Precision: dtpb.Instant_SECOND,
+	}
+}
+
+func toDateTime(t time.Time) *dtpb.DateTime {
+	return &dtpb.DateTime{
+		ValueUs:   t.UnixMicro(),
+		Precision: dtpb.DateTime_SECOND,
+	}
+}
+
+func ScheduleToFHIR(s models.Schedule) *schedpb.Schedule {
+	resource := &schedpb.Schedule{
+		Id:     &dtpb.Id{Value: s.ID},
+		Active: &dtpb.Boolean{Value: s.Active},
+		Actor:  []*dtpb.Reference{reference("Practitioner", s.PractitionerID)},
+	}
+
+	if s.PlanningStart != nil || s.PlanningEnd != nil {
+		resource.PlanningHorizon = &dtpb.Period{}
+		if s.PlanningStart != nil {
+			resource.PlanningHorizon.Start = &dtpb.DateTime{ValueUs: s.PlanningStart.UnixMicro(), Precision: dtpb.DateTime_SECOND}
+		}
+		if s.PlanningEnd != nil {
+			resource.PlanningHorizon.End = &dtpb.DateTime{ValueUs: s.PlanningEnd.UnixMicro(), Precision: dtpb.DateTime_SECOND}
+		}
+	}
+	if s.Comment != nil {
+		resource.Comment = &dtpb.String{Value: *s.Comment}
+	}
+
+	return resource
+}
+
+func FHIRToSchedule(fhirSched *schedpb.Schedule) (models.Schedule, error) {
+	schedule := models.Schedule{Active: true}
+
+	if fhirSched.Id != nil {
+		schedule.ID = fhirSched.Id.Value
+	}
+	if fhirSched.Active != nil {
+		schedule.Active = fhirSched.Active.Value
+	}
+
+	for _, actor := range fhirSched.Actor {
+		if id, ok := referencedID(actor, "Practitioner"); ok {
+			schedule.PractitionerID = id
+			break
+		}
+	}
+	if schedule.PractitionerID == "" {
+		return schedule, errors.New("schedule actor must reference a Practitioner")
+	}
+
+	if horizon := fhirSched.PlanningHorizon; horizon != nil {
+		if horizon.Start != nil {
+			start := time.UnixMicro(horizon.Start.ValueUs).UTC()
+			schedule.PlanningStart = &start
+		}
+		if horizon.End != nil {
+			end := time.UnixMicro(horizon.End.ValueUs).UTC()
+			schedule.PlanningEnd = &end
+		}
+	}
+	if fhirSched.Comment != nil && fhirSched.Comment.Value != "" {
+		comment := fhirSched.Comment.Value
+		schedule.Comment = &comment
+	}
+
+	return schedule, nil
+}
+
+var slotStatusCodes = map[string]codespb.SlotStatusCode_Value{
+	models.SlotStatusFree:            codespb.SlotStatusCode_FREE,
+	models.SlotStatusBusy:            codespb.SlotStatusCode_BUSY,
+	models.SlotStatusBusyUnavailable: codespb.SlotStatusCode_BUSY_UNAVAILABLE,
+}
+
+func SlotToFHIR(s models.Slot) *slotpb.Slot {
+	resource := &slotpb.Slot{
+		Id:       &dtpb.Id{Value: s.ID},
+		Schedule: reference("Schedule", s.ScheduleID),
+		Status:   &slotpb.Slot_StatusCode{Value: slotStatusCodes[s.Status]},
+		Start:    toInstant(s.StartTime),
+		End:      toInstant(s.EndTime),
+	}
+
+	if s.Comment != nil {
+		resource.Comment = &dtpb.String{Value: *s.Comment}
+	}
+
+	return resource
+}
+
+func FHIRToSlot(fhirSlot *slotpb.Slot) (models.Slot, error) {
+	slot := models.Slot{Status: models.SlotStatusFree}
+
+	if fhirSlot.Id != nil {
+		slot.ID = fhirSlot.Id.Value
+	}
+
+	scheduleID, ok := referencedID(fhirSlot.Schedule, "Schedule")
+	if !ok {
+		return slot, errors.New("slot schedule reference is required")
+	}
+	slot.ScheduleID = scheduleID
+
+	if fhirSlot.Status != nil {
+		found := false
+		for status, code := range slotStatusCodes {
+			if code == fhirSlot.Status.Value {
+				slot.Status, found = status, true
+			}
+		}
+		if !found {
+			return slot, fmt.Errorf("unsupported slot status: %s", fhirSlot.Status.Value)
+		}
+	}
+
+	if fhirSlot.Start == nil || fhirSlot.End == nil {
+		return slot, errors.New("slot start and end are required")
+	}
+	slot.StartTime = time.UnixMicro(fhirSlot.Start.ValueUs).UTC()
+	slot.EndTime = time.UnixMicro(fhirSlot.End.ValueUs).UTC()
+
+	if fhirSlot.Comment != nil && fhirSlot.Comment.Value != "" {
+		comment := fhirSlot.Comment.Value
+		slot.Comment = &comment
+	}
+
+	return slot, nil
+}
+
+var appointmentStatusCodes = map[string]codespb.AppointmentStatusCode_Value{
+	models.AppointmentStatusBooked:    codespb.AppointmentStatusCode_BOOKED,
+	models.AppointmentStatusArrived:   codespb.AppointmentStatusCode_ARRIVED,
+	models.AppointmentStatusFulfilled: codespb.AppointmentStatusCode_FULFILLED,
+	models.AppointmentStatusCancelled: codespb.AppointmentStatusCode_CANCELLED,
+	models.AppointmentStatusNoShow:    codespb.AppointmentStatusCode_NOSHOW,
+}
+
+func appointmentParticipant(resourceType string, id string) *apptpb.Appointment_Participant {
+	return &apptpb.Appointment_Participant{
+		Actor:    reference(resourceType, id),
+		Required: &apptpb.Appointment_Participant_RequiredCode{Value: codespb.ParticipantRequiredCode_REQUIRED},
+		Status:   &apptpb.Appointment_Participant_StatusCode{Value: codespb.ParticipationStatusCode_ACCEPTED},
+	}
+}
+
+func AppointmentToFHIR(a models.Appointment) *apptpb.Appointment {
+	resource := &apptpb.Appointment{
+		Id:     &dtpb.Id{Value: a.ID},
+		Status: &apptpb.Appointment_StatusCode{Value: appointmentStatusCodes[a.Status]},
+		Start:  toInstant(a.StartTime),
+		End:    toInstant(a.EndTime),
+		Slot:   []*dtpb.Reference{reference("Slot", a.SlotID)},
+		Created: &dtpb.DateTime{
+			ValueUs:   a.CreatedAt.UnixMicro(),
+			Precision: dtpb.DateTime_SECOND,
+		},
+		Participant: []*apptpb.Appointment_Participant{
+			appointmentParticipant("Patient", a.PatientID),
+			appointmentParticipant("Practitioner", a.PractitionerID),
+		},
+	}
+
+	if a.Description != nil {
+		resource.Description = &dtpb.String{Value: *a.Description}
+	}
+
+	return resource
+}
+
+// FHIRToAppointment reads the slot, patient, status and description of an
+// appointment. Practitioner and times always come from the booked slot.
+func FHIRToAppointment(fhirAppt *apptpb.Appointment) (models.Appointment, error) {
+	appointment := models.Appointment{Status: models.AppointmentStatusBooked}
+
+	if fhirAppt.Id != nil {
+		appointment.ID = fhirAppt.Id.Value
+	}
+
+	if fhirAppt.Status != nil {
+		found := false
+		for status, code := range appointmentStatusCodes {
+			if code == fhirAppt.Status.Value {
+				appointment.Status, found = status, true
+			}
+		}
+		if !found {
+			return appointment, fmt.Errorf("unsupported appointment status: %s", fhirAppt.Status.Value)
+		}
+	}
+
+	if len(fhirAppt.Slot) != 1 {
+		return appointment, errors.New("appointment must reference exactly one slot")
+	}
+	slotID, ok := referencedID(fhirAppt.Slot[0], "Slot")
+	if !ok {
+		return appointment, errors.New("appointment slot reference is invalid")
+	}
+	appointment.SlotID = slotID
+
+	for _, p := range fhirAppt.Participant {
+		if id, ok := referencedID(p.Actor, "Patient"); ok {
+			appointment.PatientID = id
+		}
+	}
+	if appointment.PatientID == "" {
+		return appointment, errors.New("appointment must have a Patient participant")
+	}
+
+	if fhirAppt.Description != nil && fhirAppt.Description.Value != "" {
+		description := fhirAppt.Description.Value
+		appointment.Description = &description
+	}
+
+	return appointment, nil
+}
+
+const (
+	systemConditionClinical  = "http://terminology.hl7.org/CodeSystem/condition-clinical"
+	systemConditionVerStatus = "http://terminology.hl7.org/CodeSystem/condition-ver-status"
+	systemConditionCategory  = "http://terminology.hl7.org/CodeSystem/condition-category"
+)
+
+var conditionClinicalStatuses = map[string]bool{
+	models.ConditionClinicalStatusActive:     true,
+	models.ConditionClinicalStatusRecurrence: true,
+	models.ConditionClinicalStatusRelapse:    true,
+	models.ConditionClinicalStatusInactive:   true,
+	models.ConditionClinicalStatusRemission:  true,
+	models.ConditionClinicalStatusResolved:   true,
+}
+
+var conditionVerificationStatuses = map[string]bool{
+	models.ConditionVerificationProvisional:    true,
+	models.ConditionVerificationDifferential:   true,
+	models.ConditionVerificationConfirmed:      true,
+	models.ConditionVerificationRefuted:        true,
+	models.ConditionVerificationEnteredInError: true,
+}
+
+// ConditionToFHIR maps a diagnosis to a Condition. Diagnoses made in an
+// encounter are categorised as encounter-diagnosis, others as
+// problem-list-item.
+func ConditionToFHIR(c models.Condition) *condpb.Condition {
+	category := "problem-list-item"
+	if c.EncounterID != nil {
+		category = "encounter-diagnosis"
+	}
+
+	resource := &condpb.Condition{
+		Id:   &dtpb.Id{Value: c.ID},
+		Meta: resourceMeta(c.VersionID, c.UpdatedAt),
+		ClinicalStatus: &dtpb.CodeableConcept{
+			Coding: []*dtpb.Coding{coding(systemConditionClinical, c.ClinicalStatus, "")},
+		},
+		VerificationStatus: &dtpb.CodeableConcept{
+			Coding: []*dtpb.Coding{coding(systemConditionVerStatus, c.VerificationStatus, "")},
+		},
+		Category: []*dtpb.CodeableConcept{
+			{Coding: []*dtpb.Coding{coding(systemConditionCategory, category, "")}},
+		},
+		Code: &dtpb.CodeableConcept{
+			Coding: []*dtpb.Coding{coding(systemICD10, c.Code, c.CodeDisplay)},
+			Text:   &dtpb.String{Value: c.CodeDisplay},
+		},
+		Subject:      reference("Patient", c.PatientID),
+		RecordedDate: toDateTime(c.CreatedAt),
+	}
+
+	if c.EncounterID != nil {
+		resource.Encounter = reference("Encounter", *c.EncounterID)
+	}
+
+	if c.RecorderID != nil {
+		resource.Recorder = reference("Practitioner", *c.RecorderID)
+	}
+
+	if c.OnsetTime != nil {
+		resource.Onset = &condpb.Condition_OnsetX{
+			Choice: &condpb.Condition_OnsetX_DateTime{DateTime: toDateTime(*c.OnsetTime)},
+		}
+	}
+
+	if c.AbatementTime != nil {
+		resource.Abatement = &condpb.Condition_AbatementX{
+			Choice: &condpb.Condition_AbatementX_DateTime{DateTime: toDateTime(*c.AbatementTime)},
+		}
+	}
+
+	if c.Note != nil {
+		resource.Note = []*dtpb.Annotation{{Text: &dtpb.Markdown{Value: *c.Note}}}
+	}
+
+	return resource
+}
+
+// FHIRToCondition reads a Condition coded with ICD-10. Clinical status
+// defaults to active and verification status to provisional.
+func FHIRToCondition(fhirCond *condpb.Condition) (models.Condition, error) {
+	condition := models.Condition{
+		ClinicalStatus:     models.ConditionClinicalStatusActive,
+		VerificationStatus: models.ConditionVerificationProvisional,
+	}
+
+	if fhirCond.Id != nil {
+		condition.ID = fhirCond.Id.Value
+	}
+
+	patientID, ok := referencedID(fhirCond.Subject, "Patient")
+	if !ok {
+		return condition, errors.New("condition subject must reference a Patient")
+	}
+	condition.PatientID = patientID
+
+	if fhirCond.Encounter != nil {
+		encounterID, ok := referencedID(fhirCond.Encounter, "Encounter")
+		if !ok {
+			return condition, errors.New("condition encounter reference is invalid")
+		}
+		condition.EncounterID = &encounterID
+	}
+
+	if fhirCond.Recorder != nil {
+		recorderID, ok := referencedID(fhirCond.Recorder, "Practitioner")
+		if !ok {
+			return condition, errors.New("condition recorder must reference a Practitioner")
+		}
+		condition.RecorderID = &recorderID
+	}
+
+	code, ok := conceptCode(fhirCond.Code, systemICD10)
+	if !ok {
+		return condition, errors.New("condition code must have an ICD-10 coding")
+	}
+	code = strings.ToUpper(code)
+	if !icd10Pattern.MatchString(code) {
+		return condition, fmt.Errorf("invalid ICD-10 code: %s", code)
+	}
+	condition.Code = code
+
+	if status, ok := conceptCode(fhirCond.ClinicalStatus, systemConditionClinical); ok {
+		if !conditionClinicalStatuses[status] {
+			return condition, fmt.Errorf("unsupported condition clinical status: %s", status)
+		}
+		condition.ClinicalStatus = status
+	}
+
+	if status, ok := conceptCode(fhirCond.VerificationStatus, systemConditionVerStatus); ok {
+		if !conditionVerificationStatuses[status] {
+			return condition, fmt.Errorf("unsupported condition verification status: %s", status)
+		}
+		condition.VerificationStatus = status
+	}
+
+	if onset := fhirCond.Onset.GetDateTime(); onset != nil {
+		onsetTime := time.UnixMicro(onset.ValueUs).UTC()
+		condition.OnsetTime = &onsetTime
+	}
+
+	if abatement := fhirCond.Abatement.GetDateTime(); abatement != nil {
+		abatementTime := time.UnixMicro(abatement.ValueUs).UTC()
+		condition.AbatementTime = &abatementTime
+	}
+
+	if len(fhirCond.Note) > 0 && fhirCond.Note[0].Text != nil {
+		note := fhirCond.Note[0].Text.Value
+		condition.Note = &note
+	}
+
+	return condition, nil
+}
+
+const systemLOINC = "http://loinc.org"
+
+// loincProgressNote is the document type of visit notes.
+const loincProgressNote = "11506-3"
+
+var clinicalNoteStatusCodes = map[string]codespb.CompositionStatusCode_Value{
+	models.ClinicalNoteStatusPreliminary:    codespb.CompositionStatusCode_PRELIMINARY,
+	models.ClinicalNoteStatusFinal:          codespb.CompositionStatusCode_FINAL,
+	models.ClinicalNoteStatusAmended:        codespb.CompositionStatusCode_AMENDED,
+	models.ClinicalNoteStatusEnteredInError: codespb.CompositionStatusCode_ENTERED_IN_ERROR,
+}
+
+// noteSection is a section of a visit note, identified by its LOINC code.
+type noteSection struct {
+	code  string
+	title string
+	field func(n *models.ClinicalNote) **string
+}
+
+var noteSections = []noteSection{
+	{"10154-3", "Chief complaint", func(n *models.ClinicalNote) **string { return &n.Complaints }},
+	{"10164-2", "History of present illness", func(n *models.ClinicalNote) **string { return &n.Anamnesis }},
+	{"29545-1", "Physical findings", func(n *models.ClinicalNote) **string { return &n.Examination }},
+	{"18776-5", "Plan of care", func(n *models.ClinicalNote) **string { return &n.Plan }},
+}
+
+// narrative wraps plain text in an XHTML narrative.
+func narrative(text string) *dtpb.Narrative {
+	return &dtpb.Narrative{
+		Status: &dtpb.Narrative_StatusCode{Value: codespb.NarrativeStatusCode_ADDITIONAL},
+		Div:    &dtpb.Xhtml{Value: `<div xmlns="http://www.w3.org/1999/xhtml">` + html.EscapeString(text) + `</div>`},
+	}
+}
+
+var markupPattern = regexp.MustCompile(`<[^>]*>`)
+
+// narrativeText returns the plain text of a narrative, dropping its markup.
+func narrativeText(n *dtpb.Narrative) string {
+	if n == nil || n.Div == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(markupPattern.ReplaceAllString(n.Div.Value, "")))
+}
+
+// ClinicalNoteToFHIR maps a visit note to a progress note Composition with
+// one section per filled-in part of the note. A signed note is attested by
+// its author.
+func ClinicalNoteToFHIR(n models.ClinicalNote) *comppb.Composition {
+	resource := &comppb.Composition{
+		Id:     &dtpb.Id{Value: n.ID},
+		Meta:   resourceMeta(n.VersionID, n.UpdatedAt),
+		Status: &comppb.Composition_StatusCode{Value: clinicalNoteStatusCodes[n.Status]},
+		Type: &dtpb.CodeableConcept{
+			Coding: []*dtpb.Coding{coding(systemLOINC, loincProgressNote, "Progress note")},
+		},
+		Subject:   reference("Patient", n.PatientID),
+		Encounter: reference("Encounter", n.EncounterID),
+		Date:      toDateTime(n.UpdatedAt),
+		Author:    []*dtpb.Reference{reference("Practitioner", n.AuthorID)},
+		Title:     &dtpb.String{Value: n.Title},
+	}
+
+	if n.SignedAt != nil {
+		resource.Attester = []*comppb.Composition_Attester{{
+			Mode:  &comppb.Composition_Attester_ModeCode{Value: codespb.CompositionAttestationModeCode_LEGAL},
+			Time:  toDateTime(*n.SignedAt),
+			Party: reference("Practitioner", n.AuthorID),
+		}}
+	}
+
+	for _, section := range noteSections {
+		text := *section.field(&n)
+		if text == nil {
+			continue
+		}
+		resource.Section = append(resource.Section, &comppb.Composition_Section{
+			Title: &dtpb.String{Value: section.title},
+			Code: &dtpb.CodeableConcept{
+				Coding: []*dtpb.Coding{coding(systemLOINC, section.code, section.title)},
+			},
+			Text: narrative(*text),
+		})
+	}
+
+	return resource
+}
+
+// FHIRToClinicalNote reads a visit note from a Composition. Sections are
+// matched by their LOINC code; other sections are ignored. Status defaults
+// to preliminary.
+func FHIRToClinicalNote(fhirComp *comppb.Composition) (models.ClinicalNote, error) {
+	note := models.ClinicalNote{
+		Status: models.ClinicalNoteStatusPreliminary,
+		Title:  "Visit note",
+	}
+
+	if fhirComp.Id != nil {
+		note.ID = fhirComp.Id.Value
+	}
+
+	encounterID, ok := referencedID(fhirComp.Encounter, "Encounter")
+	if !ok {
+		return note, errors.New("composition must reference an Encounter")
+	}
+	note.EncounterID = encounterID
+
+	if fhirComp.Subject != nil {
+		patientID, ok := referencedID(fhirComp.Subject, "Patient")
+		if !ok {
+			return note, errors.New("composition subject must reference a Patient")
+		}
+		note.PatientID = patientID
+	}
+
+	if len(fhirComp.Author) != 1 {
+		return note, errors.New("composition must have exactly one author")
+	}
+	authorID, ok := referencedID(fhirComp.Author[0], "Practitioner")
+	if !ok {
+		return note, errors.New("composition author must reference a Practitioner")
+	}
+	note.AuthorID = authorID
+
+	if fhirComp.Status != nil {
+		found := false
+		for status, code := range clinicalNoteStatusCodes {
+			if code == fhirComp.Status.Value {
+				note.Status = status
+				found = true
+				break
+			}
+		}
+		if !found {
+			return note, fmt.Errorf("unsupported composition status: %s", fhirComp.Status.Value)
+		}
+	}
+
+	if fhirComp.Title != nil && strings.TrimSpace(fhirComp.Title.Value) != "" {
+		note.Title = strings.TrimSpace(fhirComp.Title.Value)
+	}
+
+	for _, fhirSection := range fhirComp.Section {
+		code, ok := conceptCode(fhirSection.Code, systemLOINC)
+		if !ok {
+			continue
+		}
+		for _, section := range noteSections {
+			if section.code != code {
+				continue
+			}
+			if text := narrativeText(fhirSection.Text); text != "" {
+				*section.field(&note) = &text
+			}
+		}
+	}
+
+	return note, nil
+}
+
+const (
+	systemMedication = "urn:hospital-srv:fhir:CodeSystem/medication"
+	systemATC        = "http://www.whocc.no/atc"
+	systemUCUM       = "http://unitsofmeasure.org"
+)
+
+var medicationRequestStatusCodes = map[string]codespb.MedicationrequestStatusCode_Value{
+	models.MedicationRequestStatusActive:    codespb.MedicationrequestStatusCode_ACTIVE,
+	models.MedicationRequestStatusStopped:   codespb.MedicationrequestStatusCode_STOPPED,
+	models.MedicationRequestStatusCompleted: codespb.MedicationrequestStatusCode_COMPLETED,
+}
+
+var periodUnitCodes = map[string]vspb.UnitsOfTimeValueSet_Value{
+	models.TimeUnitHour: vspb.UnitsOfTimeValueSet_H,
+	models.TimeUnitDay:  vspb.UnitsOfTimeValueSet_D,
+	models.TimeUnitWeek: vspb.UnitsOfTimeValueSet_WK,
+}
+
+var durationUnits = map[string]bool{
+	models.TimeUnitDay:   true,
+	models.TimeUnitWeek:  true,
+	models.TimeUnitMonth: true,
+}
+
+func toDecimal(v float64) *dtpb.Decimal {
+	return &dtpb.Decimal{Value: strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+// MedicationRequestToFHIR maps a prescription to a MedicationRequest order
+// with a single dosage instruction: the dose, how often it is taken and, if
+// set, for how long.
+func MedicationRequestToFHIR(mr models.MedicationRequest) *mrpb.MedicationRequest {
+	repeat := &dtpb.Timing_Repeat{
+		Frequency:  &dtpb.PositiveInt{Value: uint32(mr.Frequency)},
+		Period:     toDecimal(mr.Period),
+		PeriodUnit: &dtpb.Timing_Repeat_PeriodUnitCode{Value: periodUnitCodes[mr.PeriodUnit]},
+	}
+	if mr.Duration != nil && mr.DurationUnit != nil {
+		repeat.Bounds = &dtpb.Timing_Repeat_BoundsX{
+			Choice: &dtpb.Timing_Repeat_BoundsX_Duration{Duration: &dtpb.Duration{
+				Value:  toDecimal(*mr.Duration),
+				Unit:   &dtpb.String{Value: *mr.DurationUnit},
+				System: &dtpb.Uri{Value: systemUCUM},
+				Code:   &dtpb.Code{Value: *mr.DurationUnit},
+			}},
+		}
+	}
+
+	dosage := &dtpb.Dosage{
+		Text:   &dtpb.String{Value: dosageText(mr)},
+		Timing: &dtpb.Timing{Repeat: repeat},
+		DoseAndRate: []*dtpb.Dosage_DoseAndRate{{
+			Dose: &dtpb.Dosage_DoseAndRate_DoseX{
+				Choice: &dtpb.Dosage_DoseAndRate_DoseX_Quantity{Quantity: &dtpb.SimpleQuantity{
+					Value: toDecimal(mr.DoseValue),
+					Unit:  &dtpb.String{Value: mr.DoseUnit},
+				}},
+			},
+		}},
+	}
+
+	resource := &mrpb.MedicationRequest{
+		Id:     &dtpb.Id{Value: mr.ID},
+		Meta:   resourceMeta(mr.VersionID, mr.UpdatedAt),
+		Status: &mrpb.MedicationRequest_StatusCode{Value: medicationRequestStatusCodes[mr.Status]},
+		Intent: &mrpb.MedicationRequest_IntentCode{Value: codespb.MedicationRequestIntentCode_ORDER},
+		Medication: &mrpb.MedicationRequest_MedicationX{
+			Choice: &mrpb.MedicationRequest_MedicationX_CodeableConcept{CodeableConcept: &dtpb.CodeableConcept{
+				Coding: []*dtpb.Coding{
+					coding(systemMedication, mr.Medication.Code, mr.Medication.Display),
+					coding(systemATC, mr.Medication.ATCCode, ""),
+				},
+				Text: &dtpb.String{Value: mr.Medication.Display},
+			}},
+		},
+		Subject:           reference("Patient", mr.PatientID),
+		AuthoredOn:        toDateTime(mr.AuthoredOn),
+		Requester:         reference("Practitioner", mr.RequesterID),
+		DosageInstruction: []*dtpb.Dosage{dosage},
+	}
+
+	if mr.EncounterID != nil {
+		resource.Encounter = reference("Encounter", *mr.EncounterID)
+	}
+
+	if mr.Note != nil {
+		resource.Note = []*dtpb.Annotation{{Text: &dtpb.Markdown{Value: *mr.Note}}}
+	}
+
+	return resource
+}
+
+// dosageText describes a dosage in words, e.g. "500 mg 3 times per 1 d for 5 d".
+func dosageText(mr models.MedicationRequest) string {
+	text := fmt.Sprintf("%s %s %d times per %s %s",
+		strconv.FormatFloat(mr.DoseValue, 'f', -1, 64), mr.DoseUnit, mr.Frequency,
+		strconv.FormatFloat(mr.Period, 'f', -1, 64), mr.PeriodUnit)
+	if mr.Duration != nil && mr.DurationUnit != nil {
+		text += fmt.Sprintf(" for %s %s", strconv.FormatFloat(*mr.Duration, 'f', -1, 64), *mr.DurationUnit)
+	}
+	return text
+}
+
+// parsePositiveDecimal parses a FHIR decimal that must be greater than zero.
+func parsePositiveDecimal(d *dtpb.Decimal, name string) (float64, error) {
+	if d == nil {
+		return 0, fmt.Errorf("%s is required", name)
+	}
+	v, err := strconv.ParseFloat(d.Value, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return v, nil
+}
+
+// FHIRToMedicationRequest reads a prescription of a medication from the
+// local dictionary. The single dosage instruction must give a dose and how
+// often it is taken; status defaults to active.
+func FHIRToMedicationRequest(fhirMR *mrpb.MedicationRequest) (models.MedicationRequest, error) {
+	request := models.MedicationRequest{Status: models.MedicationRequestStatusActive}
+
+	if fhirMR.Id != nil {
+		request.ID = fhirMR.Id.Value
+	}
+
+	patientID, ok := referencedID(fhirMR.Subject, "Patient")
+	if !ok {
+		return request, errors.New("medication request subject must reference a Patient")
+	}
+	request.PatientID = patientID
+
+	if fhirMR.Encounter != nil {
+		encounterID, ok := referencedID(fhirMR.Encounter, "Encounter")
+		if !ok {
+			return request, errors.New("medication request encounter reference is invalid")
+		}
+		request.EncounterID = &encounterID
+	}
+
+	requesterID, ok := referencedID(fhirMR.Requester, "Practitioner")
+	if !ok {
+		return request, errors.New("medication request requester must reference a Practitioner")
+	}
+	request.RequesterID = requesterID
+
+	code, ok := conceptCode(fhirMR.Medication.GetCodeableConcept(), systemMedication)
+	if !ok {
+		return request, fmt.Errorf("medication must be coded with %s", systemMedication)
+	}
+	request.Medication.Code = strings.ToUpper(code)
+
+	if fhirMR.Status != nil {
+		found := false
+		for status, statusCode := range medicationRequestStatusCodes {
+			if statusCode == fhirMR.Status.Value {
+				request.Status = status
+				found = true
+				break
+			}
+		}
+		if !found {
+			return request, fmt.Errorf("unsupported medication request status: %s", fhirMR.Status.Value)
+		}
+	}
+
+	if len(fhirMR.DosageInstruction) != 1 {
+		return request, errors.New("medication request must have exactly one dosage instruction")
+	}
+	dosage := fhirMR.DosageInstruction[0]
+
+	if len(dosage.DoseAndRate) == 0 || dosage.DoseAndRate[0].Dose.GetQuantity() == nil {
+		return request, errors.New("dosage must give a dose quantity")
+	}
+	dose := dosage.DoseAndRate[0].Dose.GetQuantity()
+	doseValue, err := parsePositiveDecimal(dose.Value, "dose")
+	if err != nil {
+		return request, err
+	}
+	request.DoseValue = doseValue
+	if dose.Unit == nil || dose.Unit.Value == "" {
+		return request, errors.New("dose unit is required")
+	}
+	request.DoseUnit = dose.Unit.Value
+
+	repeat := dosage.GetTiming().GetRepeat()
+	if repeat == nil || repeat.Frequency == nil || repeat.Frequency.Value == 0 {
+		return request, errors.New("dosage timing must give a frequency")
+	}
+	request.Frequency = int(repeat.Frequency.Value)
+
+	period, err := parsePositiveDecimal(repeat.Period, "dosage period")
+	if err != nil {
+		return request, err
+	}
+	request.Period = period
+
+	for unit, unitCode := range periodUnitCodes {
+		if repeat.PeriodUnit != nil && repeat.PeriodUnit.Value == unitCode {
+			request.PeriodUnit = unit
+		}
+	}
+	if request.PeriodUnit == "" {
+		return request, errors.New("dosage period unit must be h, d or wk")
+	}
+
+	if duration := repeat.GetBounds().GetDuration(); duration != nil {
+		value, err := parsePositiveDecimal(duration.Value, "duration")
+		if err != nil {
+			return request, err
+		}
+		unit := ""
+		if duration.Code != nil {
+			unit = duration.Code.Value
+		} else if duration.Unit != nil {
+			unit = duration.Unit.Value
+		}
+		if !durationUnits[unit] {
+			return request, errors.New("duration unit must be d, wk or mo")
+		}
+		request.Duration = &value
+		request.DurationUnit = &unit
+	}
+
+	if len(fhirMR.Note) > 0 && fhirMR.Note[0].Text != nil {
+		note := fhirMR.Note[0].Text.Value
+		request.Note = &note
+	}
+
+	return request, nil
+}
+
+const systemPractitionerRole = "http://terminology.hl7.org/CodeSystem/practitioner-role"
+
+var practitionerRoleCodes = map[string]bool{
+	models.PractitionerRoleDoctor:     true,
+	models.PractitionerRoleNurse:      true,
+	models.PractitionerRolePharmacist: true,
+	models.PractitionerRoleResearcher: true,
+	models.PractitionerRoleTeacher:    true,
+	models.PractitionerRoleICT:        true,
+}
+
+// PractitionerRoleToFHIR maps a role to a PractitionerRole. The department
+// is its organization.
+func PractitionerRoleToFHIR(pr models.PractitionerRole) *prrolepb.PractitionerRole {
+	resource := &prrolepb.PractitionerRole{
+		Id:           &dtpb.Id{Value: pr.ID},
+		Meta:         resourceMeta(pr.VersionID, pr.UpdatedAt),
+		Active:       &dtpb.Boolean{Value: pr.Active},
+		Practitioner: reference("Practitioner", pr.PractitionerID),
+		Code: []*dtpb.CodeableConcept{
+			{Coding: []*dtpb.Coding{coding(systemPractitionerRole, pr.Role, "")}},
+		},
+	}
+
+	if pr.OrganizationID != nil {
+		resource.Organization = reference("Organization", *pr.OrganizationID)
+	}
+
+	for _, specialty := range pr.Specialties {
+		resource.Specialty = append(resource.Specialty, &dtpb.CodeableConcept{Text: &dtpb.String{Value: specialty}})
+	}
+
+	for _, locationID := range pr.LocationIDs {
+		resource.Location = append(resource.Location, reference("Location", locationID))
+	}
+
+	return resource
+}
+
+// FHIRToPractitionerRole reads a role of a practitioner. Its code must come
+// from the practitioner-role code system; active defaults to true.
+func FHIRToPractitionerRole(fhirRole *prrolepb.PractitionerRole) (models.PractitionerRole, error) {
+	role := models.PractitionerRole{
+		Active:      true,
+		Specialties: []string{},
+		LocationIDs: []string{},
+	}
+
+	if fhirRole.Id != nil {
+		role.ID = fhirRole.Id.Value
+	}
+
+	if fhirRole.Active != nil {
+		role.Active = fhirRole.Active.Value
+	}
+
+	practitionerID, ok := referencedID(fhirRole.Practitioner, "Practitioner")
+	if !ok {
+		return role, errors.New("practitioner role must reference a Practitioner")
+	}
+	role.PractitionerID = practitionerID
+
+	if len(fhirRole.Code) != 1 {
+		return role, errors.New("practitioner role must have exactly one code")
+	}
+	code, ok := conceptCode(fhirRole.Code[0], systemPractitionerRole)
+	if !ok || !practitionerRoleCodes[code] {
+		return role, fmt.Errorf("practitioner role code must be one of %s", systemPractitionerRole)
+	}
+	role.Role = code
+
+	if fhirRole.Organization != nil {
+		organizationID, ok := referencedID(fhirRole.Organization, "Organization")
+		if !ok {
+			return role, errors.New("practitioner role organization must reference an Organization")
+		}
+		role.OrganizationID = &organizationID
+	}
+
+	for _, specialty := range fhirRole.Specialty {
+		text := conceptText(specialty)
+		if text == nil {
+			return role, errors.New("practitioner role specialty must have a text")
+		}
+		role.Specialties = append(role.Specialties, *text)
+	}
+
+	for _, location := range fhirRole.Location {
+		locationID, ok := referencedID(location, "Location")
+		if !ok {
+			return role, errors.New("practitioner role location must reference a Location")
+		}
+		role.LocationIDs = append(role.LocationIDs, locationID)
+	}
+
+	return role, nil
+}
+
+const (
+	systemOrganizationType     = "http://terminology.hl7.org/CodeSystem/organization-type"
+	systemLocationPhysicalType = "http://terminology.hl7.org/CodeSystem/location-physical-type"
+	systemBedStatus            = "http://terminology.hl7.org/CodeSystem/v2-0116"
+)
+
+// organizationTypeDisplays lists the supported organization types with
+// their display names.
+var organizationTypeDisplays = map[string]string{
+	models.OrganizationTypeProvider:   "Healthcare Provider",
+	models.OrganizationTypeDepartment: "Hospital Department",
+}
+
+// locationTypeDisplays lists the supported location physical types with
+// their display names.
+var locationTypeDisplays = map[string]string{
+	models.LocationTypeBuilding: "Building",
+	models.LocationTypeWing:     "Wing",
+	models.LocationTypeLevel:    "Level",
+	models.LocationTypeWard:     "Ward",
+	models.LocationTypeRoom:     "Room",
+	models.LocationTypeBed:      "Bed",
+}
+
+// bedStatusCodings maps bed statuses to HL7 v2 table 0116 bed statuses,
+// used as Location.operationalStatus.
+var bedStatusCodings = map[string]struct{ code, display string }{
+	models.BedStatusFree:     {"U", "Unoccupied"},
+	models.BedStatusOccupied: {"O", "Occupied"},
+	models.BedStatusCleaning: {"H", "Housekeeping"},
+	models.BedStatusBlocked:  {"C", "Closed"},
+}
+
+var locationStatusCodes = map[string]codespb.LocationStatusCode_Value{
+	models.LocationStatusActive:    codespb.LocationStatusCode_ACTIVE,
+	models.LocationStatusSuspended: codespb.LocationStatusCode_SUSPENDED,
+	models.LocationStatusInactive:  codespb.LocationStatusCode_INACTIVE,
+}
+
+func OrganizationToFHIR(o models.Organization) *orgpb.Organization {
+	resource := &orgpb.Organization{
+		Id:     &dtpb.Id{Value: o.ID},
+		Meta:   resourceMeta(o.VersionID, o.UpdatedAt),
+		Active: &dtpb.Boolean{Value: o.Active},
+		Type: []*dtpb.CodeableConcept{
+			{Coding: []*dtpb.Coding{coding(systemOrganizationType, o.Type, organizationTypeDisplays[o.Type])}},
+		},
+		Name: &dtpb.String{Value: o.Name},
+	}
+
+	if o.PartOf != nil {
+		resource.PartOf = reference("Organization", *o.PartOf)
+	}
+
+	return resource
+}
+
+// FHIRToOrganization reads the hospital or one of its departments. The
+// type defaults to a department and active to true.
+func FHIRToOrganization(fhirOrg *orgpb.Organization) (models.Organization, error) {
+	organization := models.Organization{
+		Active: true,
+		Type:   models.OrganizationTypeDepartment,
+	}
+
+	if fhirOrg.Id != nil {
+		organization.ID = fhirOrg.Id.Value
+	}
+
+	if fhirOrg.Active != nil {
+		organization.Active = fhirOrg.Active.Value
+	}
+
+	if fhirOrg.Name == nil || strings.TrimSpace(fhirOrg.Name.Value) == "" {
+		return organization, errors.New("organization must have a name")
+	}
+	organization.Name = strings.TrimSpace(fhirOrg.Name.Value)
+
+	if len(fhirOrg.Type) > 0 {
+		code, ok := conceptCode(fhirOrg.Type[0], systemOrganizationType)
+		if _, supported := organizationTypeDisplays[code]; !ok || !supported {
+			return organization, fmt.Errorf("organization type must be prov or dept from %s", systemOrganizationType)
+		}
+		organization.Type = code
+	}
+
+	if fhirOrg.PartOf != nil {
+		partOf, ok := referencedID(fhirOrg.PartOf, "Organization")
+		if !ok {
+			return organization, errors.New("organization partOf must reference an Organization")
+		}
+		organization.PartOf = &partOf
+	}
+
+	return organization, nil
+}
+
+func LocationToFHIR(l models.Location) *locpb.Location {
+	resource := &locpb.Location{
+		Id:           &dtpb.Id{Value: l.ID},
+		Meta:         resourceMeta(l.VersionID, l.UpdatedAt),
+		Status:       &locpb.Location_StatusCode{Value: locationStatusCodes[l.Status]},
+		Name:         &dtpb.String{Value: l.Name},
+		Mode:         &locpb.Location_ModeCode{Value: codespb.LocationModeCode_INSTANCE},
+		PhysicalType: &dtpb.CodeableConcept{Coding: []*dtpb.Coding{coding(systemLocationPhysicalType, l.PhysicalType, locationTypeDisplays[l.PhysicalType])}},
+	}
+
+	if l.OrganizationID != nil {
+		resource.ManagingOrganization = reference("Organization", *l.OrganizationID)
+	}
+
+	if l.PartOf != nil {
+		resource.PartOf = reference("Location", *l.PartOf)
+	}
+
+	if l.BedStatus != nil {
+		status := bedStatusCodings[*l.BedStatus]
+		resource.OperationalStatus = coding(systemBedStatus, status.code, status.display)
+	}
+
+	return resource
+}
+
+// FHIRToLocation reads a ward, room, bed or other place in the hospital. Its
+// physical type is required; the status defaults to active. The
+// operationalStatus of a bed is kept by the server and ignored here.
+func FHIRToLocation(fhirLoc *locpb.Location) (models.Location, error) {
+	location := models.Location{
+		Status: models.LocationStatusActive,
+	}
+
+	if fhirLoc.Id != nil {
+		location.ID = fhirLoc.Id.Value
+	}
+
+	if fhirLoc.Status != nil {
+		found := false
+		for status, statusCode := range locationStatusCodes {
+			if statusCode == fhirLoc.Status.Value {
+				location.Status = status
+				found = true
+				break
+			}
+		}
+		if !found {
+			return location, fmt.Errorf("unsupported location status: %s", fhirLoc.Status.Value)
+		}
+	}
+
+	if fhirLoc.Name == nil || strings.TrimSpace(fhirLoc.Name.Value) == "" {
+		return location, errors.New("location must have a name")
+	}
+	location.Name = strings.TrimSpace(fhirLoc.Name.Value)
+
+	code, ok := conceptCode(fhirLoc.PhysicalType, systemLocationPhysicalType)
+	if _, supported := locationTypeDisplays[code]; !ok || !supported {
+		return location, fmt.Errorf("location physicalType must be one of bu, wi, lvl, wa, ro or bd from %s", systemLocationPhysicalType)
+	}
+	location.PhysicalType = code
+
+	if fhirLoc.ManagingOrganization != nil {
+		organizationID, ok := referencedID(fhirLoc.ManagingOrganization, "Organization")
+		if !ok {
+			return location, errors.New("location managingOrganization must reference an Organization")
+		}
+		location.OrganizationID = &organizationID
+	}
+
+	if fhirLoc.PartOf != nil {
+		partOf, ok := referencedID(fhirLoc.PartOf, "Location")
+		if !ok {
+			return location, errors.New("location partOf must reference a Location")
+		}
+		location.PartOf = &partOf
+	}
+
+	return location, nil
+}
@@ -0,0 +1,785 @@
+package fhir
+
+import (
+	"hospital-srv/models"
+	"reflect"
+	"testing"
+	"time"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	comppb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/composition_go_proto"
+	condpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/condition_go_proto"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	locpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/location_go_proto"
+	mrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/medication_request_go_proto"
+	orgpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/organization_go_proto"
+	patientpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	prrolepb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_role_go_proto"
+)
+
+// withDetails adds the patient and practitioner the encounter refers to,
+// as the service does when reading it.
+func withDetails(encounter models.Encounter) models.EncounterWithDetails {
+	return models.EncounterWithDetails{
+		Encounter:    encounter,
+		Patient:      models.Patient{ID: encounter.PatientID},
+		Practitioner: models.Practitioner{ID: encounter.PractitionerID},
+	}
+}
+
+func TestEncounterStatusRoundTrip(t *testing.T) {
+	start := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+	end := start.Add(45 * time.Minute)
+
+	for status, code := range encounterStatusCodes {
+		encounter := withDetails(models.Encounter{
+			ID:             "e1",
+			PatientID:      patientID,
+			PractitionerID: practitionerID,
+			Status:         status,
+			StartTime:      start,
+			EndTime:        &end,
+		})
+
+		resource := EncounterToFHIR(encounter)
+		if got := resource.GetStatus().GetValue(); got != code {
+			t.Errorf("EncounterToFHIR(%s) status = %v, want %v", status, got, code)
+		}
+
+		got, err := FHIRToEncounter(resource)
+		if err != nil {
+			t.Fatalf("FHIRToEncounter(%s) = %v", status, err)
+		}
+		if got.Status != status {
+			t.Errorf("FHIRToEncounter() status = %s, want %s", got.Status, status)
+		}
+		if got.EndTime == nil || !got.EndTime.Equal(end) {
+			t.Errorf("FHIRToEncounter() end = %v, want %v", got.EndTime, end)
+		}
+	}
+}
+
+func TestEncounterStatusHistory(t *testing.T) {
+	arrived := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+	started := arrived.Add(10 * time.Minute)
+	receptionist := "reception"
+
+	history := encounterStatusHistory([]models.EncounterStatusChange{
+		{Status: models.EncounterStatusArrived, Actor: &receptionist, ChangedAt: arrived},
+		{Status: models.EncounterStatusInProgress, ChangedAt: started},
+	})
+	if len(history) != 2 {
+		t.Fatalf("history = %v, want 2 entries", history)
+	}
+
+	first, current := history[0], history[1]
+	if first.GetStatus().GetValue() != codespb.EncounterStatusCode_ARRIVED ||
+		first.GetPeriod().GetStart().GetValueUs() != arrived.UnixMicro() ||
+		first.GetPeriod().GetEnd().GetValueUs() != started.UnixMicro() {
+		t.Errorf("first entry = %v, want arrived from %v to %v", first, arrived, started)
+	}
+	if len(first.GetExtension()) != 1 ||
+		first.GetExtension()[0].GetUrl().GetValue() != extensionStatusActor ||
+		first.GetExtension()[0].GetValue().GetStringValue().GetValue() != receptionist {
+		t.Errorf("first entry extension = %v, want actor %q", first.GetExtension(), receptionist)
+	}
+
+	if current.GetStatus().GetValue() != codespb.EncounterStatusCode_IN_PROGRESS ||
+		current.GetPeriod().GetEnd() != nil || len(current.GetExtension()) != 0 {
+		t.Errorf("current entry = %v, want an open in-progress period without actor", current)
+	}
+}
+
+func TestEncounterClassificationRoundTrip(t *testing.T) {
+	encounterType := "Consultation"
+	serviceType := "Cardiology"
+	priority := models.EncounterPriorityUrgent
+	reasonText := "Chest pain"
+	reasonCode := "R07.4"
+
+	encounter := withDetails(models.Encounter{
+		ID:             "e1",
+		PatientID:      patientID,
+		PractitionerID: practitionerID,
+		Status:         models.EncounterStatusArrived,
+		StartTime:      time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC),
+		Class:          models.EncounterClassEmergency,
+		Type:           &encounterType,
+		ServiceType:    &serviceType,
+		Priority:       &priority,
+		ReasonText:     &reasonText,
+		ReasonCode:     &reasonCode,
+	})
+
+	resource := EncounterToFHIR(encounter)
+	if resource.GetClassValue().GetDisplay().GetValue() != "emergency" {
+		t.Errorf("class display = %q, want emergency", resource.GetClassValue().GetDisplay().GetValue())
+	}
+
+	got, err := FHIRToEncounter(resource)
+	if err != nil {
+		t.Fatalf("FHIRToEncounter() = %v", err)
+	}
+	if got.Class != models.EncounterClassEmergency ||
+		got.Type == nil || *got.Type != encounterType ||
+		got.ServiceType == nil || *got.ServiceType != serviceType ||
+		got.Priority == nil || *got.Priority != priority ||
+		got.ReasonText == nil || *got.ReasonText != reasonText ||
+		got.ReasonCode == nil || *got.ReasonCode != reasonCode {
+		t.Errorf("FHIRToEncounter() = %+v, want the classification of %+v", got, encounter.Encounter)
+	}
+}
+
+func TestFHIRToEncounterClassification(t *testing.T) {
+	reason := func(code string) *dtpb.CodeableConcept {
+		return &dtpb.CodeableConcept{Coding: []*dtpb.Coding{coding(systemICD10, code, "")}}
+	}
+
+	encounter := func(e *encpb.Encounter) *encpb.Encounter {
+		e.Subject = reference("Patient", patientID)
+		e.Participant = []*encpb.Encounter_Participant{{Individual: reference("Practitioner", practitionerID)}}
+		return e
+	}
+
+	got, err := FHIRToEncounter(encounter(&encpb.Encounter{ReasonCode: []*dtpb.CodeableConcept{reason("j06.9")}}))
+	if err != nil {
+		t.Fatalf("FHIRToEncounter() = %v", err)
+	}
+	if got.Class != models.EncounterClassAmbulatory {
+		t.Errorf("default class = %s, want %s", got.Class, models.EncounterClassAmbulatory)
+	}
+	if got.ReasonCode == nil || *got.ReasonCode != "J06.9" {
+		t.Errorf("reason code = %v, want J06.9", got.ReasonCode)
+	}
+
+	tests := []struct {
+		name      string
+		encounter *encpb.Encounter
+	}{
+		{name: "unsupported class", encounter: encounter(&encpb.Encounter{ClassValue: coding(systemActCode, "FLD", "")})},
+		{
+			name:      "unsupported priority",
+			encounter: encounter(&encpb.Encounter{Priority: &dtpb.CodeableConcept{Coding: []*dtpb.Coding{coding(systemActPriority, "ASAP", "")}}}),
+		},
+		{name: "invalid ICD-10 code", encounter: encounter(&encpb.Encounter{ReasonCode: []*dtpb.CodeableConcept{reason("chest pain")}})},
+		{name: "ICD-10 code with a long subdivision", encounter: encounter(&encpb.Encounter{ReasonCode: []*dtpb.CodeableConcept{reason("J06.91234")}})},
+		{name: "no subject", encounter: &encpb.Encounter{Participant: []*encpb.Encounter_Participant{{Individual: reference("Practitioner", practitionerID)}}}},
+		{name: "subject is not a Patient", encounter: &encpb.Encounter{
+			Subject:     reference("Practitioner", practitionerID),
+			Participant: []*encpb.Encounter_Participant{{Individual: reference("Practitioner", practitionerID)}},
+		}},
+		{name: "no participant", encounter: &encpb.Encounter{Subject: reference("Patient", patientID)}},
+		{name: "participant is not a Practitioner", encounter: &encpb.Encounter{
+			Subject:     reference("Patient", patientID),
+			Participant: []*encpb.Encounter_Participant{{Individual: reference("Patient", patientID)}},
+		}},
+	}
+
+	for _, tt := range tests {
+		if _, err := FHIRToEncounter(tt.encounter); err == nil {
+			t.Errorf("%s: FHIRToEncounter() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestConditionRoundTrip(t *testing.T) {
+	encounterID := "5d2a7c1e-3b4f-4e6a-9c8d-1f2e3a4b5c01"
+	recorderID := practitionerID
+	note := "after a cold"
+	onset := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+
+	condition := models.Condition{
+		ID:                 "c1",
+		PatientID:          patientID,
+		EncounterID:        &encounterID,
+		RecorderID:         &recorderID,
+		Code:               "J20.9",
+		CodeDisplay:        "Acute bronchitis, unspecified",
+		ClinicalStatus:     models.ConditionClinicalStatusRecurrence,
+		VerificationStatus: models.ConditionVerificationConfirmed,
+		Note:               &note,
+		OnsetTime:          &onset,
+	}
+
+	resource := ConditionToFHIR(condition)
+	if got := resource.Category[0].Coding[0].Code.Value; got != "encounter-diagnosis" {
+		t.Errorf("category = %s, want encounter-diagnosis", got)
+	}
+
+	got, err := FHIRToCondition(resource)
+	if err != nil {
+		t.Fatalf("FHIRToCondition() = %v", err)
+	}
+	if got.ID != condition.ID || got.PatientID != patientID ||
+		got.EncounterID == nil || *got.EncounterID != encounterID ||
+		got.RecorderID == nil || *got.RecorderID != recorderID ||
+		got.Code != condition.Code ||
+		got.ClinicalStatus != condition.ClinicalStatus ||
+		got.VerificationStatus != condition.VerificationStatus ||
+		got.Note == nil || *got.Note != note ||
+		got.OnsetTime == nil || !got.OnsetTime.Equal(onset) ||
+		got.AbatementTime != nil {
+		t.Errorf("FHIRToCondition() = %+v, want %+v", got, condition)
+	}
+
+	condition.EncounterID = nil
+	if got := ConditionToFHIR(condition).Category[0].Coding[0].Code.Value; got != "problem-list-item" {
+		t.Errorf("category without an encounter = %s, want problem-list-item", got)
+	}
+}
+
+func TestFHIRToConditionErrors(t *testing.T) {
+	valid := func() *condpb.Condition {
+		return ConditionToFHIR(models.Condition{
+			PatientID:          patientID,
+			Code:               "J06.9",
+			ClinicalStatus:     models.ConditionClinicalStatusActive,
+			VerificationStatus: models.ConditionVerificationProvisional,
+		})
+	}
+	concept := func(system, code string) *dtpb.CodeableConcept {
+		return &dtpb.CodeableConcept{Coding: []*dtpb.Coding{coding(system, code, "")}}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*condpb.Condition)
+	}{
+		{name: "no subject", modify: func(c *condpb.Condition) { c.Subject = nil }},
+		{name: "subject is not a Patient", modify: func(c *condpb.Condition) { c.Subject = reference("Group", "g1") }},
+		{name: "recorder is not a Practitioner", modify: func(c *condpb.Condition) { c.Recorder = reference("Patient", patientID) }},
+		{name: "no ICD-10 coding", modify: func(c *condpb.Condition) { c.Code = concept("http://snomed.info/sct", "195967001") }},
+		{name: "invalid ICD-10 code", modify: func(c *condpb.Condition) { c.Code = concept(systemICD10, "bronchitis") }},
+		{name: "unknown clinical status", modify: func(c *condpb.Condition) { c.ClinicalStatus = concept(systemConditionClinical, "cured") }},
+		{name: "unknown verification status", modify: func(c *condpb.Condition) { c.VerificationStatus = concept(systemConditionVerStatus, "likely") }},
+	}
+
+	for _, tt := range tests {
+		resource := valid()
+		tt.modify(resource)
+		if _, err := FHIRToCondition(resource); err == nil {
+			t.Errorf("%s: FHIRToCondition() = nil, want an error", tt.name)
+		}
+	}
+
+	got, err := FHIRToCondition(&condpb.Condition{Subject: reference("Patient", patientID), Code: concept(systemICD10, "j06.9")})
+	if err != nil {
+		t.Fatalf("FHIRToCondition() = %v", err)
+	}
+	if got.Code != "J06.9" || got.ClinicalStatus != models.ConditionClinicalStatusActive || got.VerificationStatus != models.ConditionVerificationProvisional {
+		t.Errorf("FHIRToCondition() = %+v, want an active provisional J06.9", got)
+	}
+}
+
+func TestClinicalNoteRoundTrip(t *testing.T) {
+	encounterID := "5d2a7c1e-3b4f-4e6a-9c8d-1f2e3a4b5c01"
+	complaints := "Cough for <3> days & fever"
+	plan := "Rest, fluids"
+	signedAt := time.Date(2024, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	note := models.ClinicalNote{
+		ID:          "n1",
+		EncounterID: encounterID,
+		PatientID:   patientID,
+		AuthorID:    practitionerID,
+		Status:      models.ClinicalNoteStatusFinal,
+		Title:       "Follow-up",
+		Complaints:  &complaints,
+		Plan:        &plan,
+		SignedAt:    &signedAt,
+	}
+
+	resource := ClinicalNoteToFHIR(note)
+	if len(resource.Section) != 2 {
+		t.Fatalf("sections = %d, want one per filled-in part", len(resource.Section))
+	}
+	if len(resource.Attester) != 1 || resource.Attester[0].Party.GetUri().GetValue() != "Practitioner/"+practitionerID {
+		t.Errorf("attester = %v, want the author", resource.Attester)
+	}
+	if got := resource.Section[0].Text.Div.Value; got != `<div xmlns="http://www.w3.org/1999/xhtml">Cough for &lt;3&gt; days &amp; fever</div>` {
+		t.Errorf("narrative = %s, want escaped text", got)
+	}
+
+	got, err := FHIRToClinicalNote(resource)
+	if err != nil {
+		t.Fatalf("FHIRToClinicalNote() = %v", err)
+	}
+	if got.ID != note.ID || got.EncounterID != encounterID || got.PatientID != patientID || got.AuthorID != practitionerID ||
+		got.Status != note.Status || got.Title != note.Title ||
+		got.Complaints == nil || *got.Complaints != complaints ||
+		got.Plan == nil || *got.Plan != plan ||
+		got.Anamnesis != nil || got.Examination != nil {
+		t.Errorf("FHIRToClinicalNote() = %+v, want %+v", got, note)
+	}
+
+	note.SignedAt = nil
+	if resource := ClinicalNoteToFHIR(note); len(resource.Attester) != 0 {
+		t.Errorf("attester of an unsigned note = %v, want none", resource.Attester)
+	}
+}
+
+func TestFHIRToClinicalNote(t *testing.T) {
+	encounterID := "5d2a7c1e-3b4f-4e6a-9c8d-1f2e3a4b5c01"
+	valid := func() *comppb.Composition {
+		return &comppb.Composition{
+			Encounter: reference("Encounter", encounterID),
+			Author:    []*dtpb.Reference{reference("Practitioner", practitionerID)},
+		}
+	}
+
+	got, err := FHIRToClinicalNote(valid())
+	if err != nil {
+		t.Fatalf("FHIRToClinicalNote() = %v", err)
+	}
+	if got.Status != models.ClinicalNoteStatusPreliminary || got.Title != "Visit note" || got.PatientID != "" {
+		t.Errorf("FHIRToClinicalNote() = %+v, want a preliminary Visit note", got)
+	}
+
+	resource := valid()
+	resource.Section = []*comppb.Composition_Section{
+		{Code: &dtpb.CodeableConcept{Coding: []*dtpb.Coding{coding(systemLOINC, "29545-1", "")}}, Text: narrative("Clear lungs")},
+		{Code: &dtpb.CodeableConcept{Coding: []*dtpb.Coding{coding(systemLOINC, "8716-3", "")}}, Text: narrative("BP 120/80")},
+		{Code: &dtpb.CodeableConcept{Coding: []*dtpb.Coding{coding(systemLOINC, "18776-5", "")}}, Text: narrative(" ")},
+	}
+	got, err = FHIRToClinicalNote(resource)
+	if err != nil {
+		t.Fatalf("FHIRToClinicalNote() = %v", err)
+	}
+	if got.Examination == nil || *got.Examination != "Clear lungs" || got.Plan != nil {
+		t.Errorf("sections = %+v, want only the examination", got)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*comppb.Composition)
+	}{
+		{name: "no encounter", modify: func(c *comppb.Composition) { c.Encounter = nil }},
+		{name: "subject is not a Patient", modify: func(c *comppb.Composition) { c.Subject = reference("Group", "g1") }},
+		{name: "no author", modify: func(c *comppb.Composition) { c.Author = nil }},
+		{name: "two authors", modify: func(c *comppb.Composition) {
+			c.Author = append(c.Author, reference("Practitioner", otherPractitionerID))
+		}},
+		{name: "author is not a Practitioner", modify: func(c *comppb.Composition) { c.Author[0] = reference("Patient", patientID) }},
+		{
+			name: "unsupported status",
+			modify: func(c *comppb.Composition) {
+				c.Status = &comppb.Composition_StatusCode{Value: codespb.CompositionStatusCode_INVALID_UNINITIALIZED}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		resource := valid()
+		tt.modify(resource)
+		if _, err := FHIRToClinicalNote(resource); err == nil {
+			t.Errorf("%s: FHIRToClinicalNote() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestMedicationRequestRoundTrip(t *testing.T) {
+	encounterID := "5d2a7c1e-3b4f-4e6a-9c8d-1f2e3a4b5c01"
+	duration := 7.0
+	durationUnit := models.TimeUnitDay
+	note := "after meals"
+
+	request := models.MedicationRequest{
+		ID:           "mr1",
+		PatientID:    patientID,
+		EncounterID:  &encounterID,
+		RequesterID:  practitionerID,
+		Medication:   models.Medication{Code: "AMOX500", Display: "Amoxicillin 500 mg", ATCCode: "J01CA04"},
+		Status:       models.MedicationRequestStatusActive,
+		DoseValue:    0.5,
+		DoseUnit:     "g",
+		Frequency:    3,
+		Period:       1,
+		PeriodUnit:   models.TimeUnitDay,
+		Duration:     &duration,
+		DurationUnit: &durationUnit,
+		Note:         &note,
+	}
+
+	resource := MedicationRequestToFHIR(request)
+	if got := resource.DosageInstruction[0].Text.Value; got != "0.5 g 3 times per 1 d for 7 d" {
+		t.Errorf("dosage text = %q", got)
+	}
+
+	got, err := FHIRToMedicationRequest(resource)
+	if err != nil {
+		t.Fatalf("FHIRToMedicationRequest() = %v", err)
+	}
+	if got.ID != request.ID || got.PatientID != patientID || got.RequesterID != practitionerID ||
+		got.EncounterID == nil || *got.EncounterID != encounterID ||
+		got.Medication.Code != request.Medication.Code || got.Status != request.Status ||
+		got.DoseValue != request.DoseValue || got.DoseUnit != request.DoseUnit ||
+		got.Frequency != request.Frequency || got.Period != request.Period || got.PeriodUnit != request.PeriodUnit ||
+		got.Duration == nil || *got.Duration != duration || got.DurationUnit == nil || *got.DurationUnit != durationUnit ||
+		got.Note == nil || *got.Note != note {
+		t.Errorf("FHIRToMedicationRequest() = %+v, want %+v", got, request)
+	}
+}
+
+func TestFHIRToMedicationRequestErrors(t *testing.T) {
+	valid := func() *mrpb.MedicationRequest {
+		duration := 1.0
+		durationUnit := models.TimeUnitWeek
+		return MedicationRequestToFHIR(models.MedicationRequest{
+			PatientID:    patientID,
+			RequesterID:  practitionerID,
+			Medication:   models.Medication{Code: "AMOX500"},
+			Status:       models.MedicationRequestStatusActive,
+			DoseValue:    500,
+			DoseUnit:     "mg",
+			Frequency:    1,
+			Period:       8,
+			PeriodUnit:   models.TimeUnitHour,
+			Duration:     &duration,
+			DurationUnit: &durationUnit,
+		})
+	}
+	if _, err := FHIRToMedicationRequest(valid()); err != nil {
+		t.Fatalf("FHIRToMedicationRequest() = %v", err)
+	}
+
+	repeat := func(r *mrpb.MedicationRequest) *dtpb.Timing_Repeat { return r.DosageInstruction[0].Timing.Repeat }
+	dose := func(r *mrpb.MedicationRequest) *dtpb.SimpleQuantity {
+		return r.DosageInstruction[0].DoseAndRate[0].Dose.GetQuantity()
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*mrpb.MedicationRequest)
+	}{
+		{name: "no subject", modify: func(r *mrpb.MedicationRequest) { r.Subject = nil }},
+		{name: "no requester", modify: func(r *mrpb.MedicationRequest) { r.Requester = nil }},
+		{name: "encounter is not an Encounter", modify: func(r *mrpb.MedicationRequest) { r.Encounter = reference("Patient", patientID) }},
+		{name: "no medication code", modify: func(r *mrpb.MedicationRequest) { r.Medication = nil }},
+		{
+			name:   "unsupported status",
+			modify: func(r *mrpb.MedicationRequest) { r.Status.Value = codespb.MedicationrequestStatusCode_ON_HOLD },
+		},
+		{name: "no dosage", modify: func(r *mrpb.MedicationRequest) { r.DosageInstruction = nil }},
+		{name: "no dose", modify: func(r *mrpb.MedicationRequest) { r.DosageInstruction[0].DoseAndRate = nil }},
+		{name: "zero dose", modify: func(r *mrpb.MedicationRequest) { dose(r).Value.Value = "0" }},
+		{name: "no dose unit", modify: func(r *mrpb.MedicationRequest) { dose(r).Unit = nil }},
+		{name: "no frequency", modify: func(r *mrpb.MedicationRequest) { repeat(r).Frequency = nil }},
+		{name: "no period", modify: func(r *mrpb.MedicationRequest) { repeat(r).Period = nil }},
+		{name: "no period unit", modify: func(r *mrpb.MedicationRequest) { repeat(r).PeriodUnit = nil }},
+		{name: "unsupported duration unit", modify: func(r *mrpb.MedicationRequest) { repeat(r).Bounds.GetDuration().Code.Value = "h" }},
+	}
+
+	for _, tt := range tests {
+		resource := valid()
+		tt.modify(resource)
+		if _, err := FHIRToMedicationRequest(resource); err == nil {
+			t.Errorf("%s: FHIRToMedicationRequest() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestFHIRToPractitionerActive(t *testing.T) {
+	for _, active := range []bool{true, false} {
+		got, err := FHIRToPractitioner(PractitionerToFHIR(models.Practitioner{ID: "d1", FirstName: "Anna", LastName: "Smirnova", Active: active}))
+		if err != nil {
+			t.Fatalf("FHIRToPractitioner() = %v", err)
+		}
+		if got.Active != active {
+			t.Errorf("active = %v, want %v", got.Active, active)
+		}
+	}
+
+	resource := PractitionerToFHIR(models.Practitioner{ID: "d1", FirstName: "Anna", LastName: "Smirnova"})
+	resource.Active = nil
+	if got, err := FHIRToPractitioner(resource); err != nil || !got.Active {
+		t.Errorf("FHIRToPractitioner() without active = %+v, %v, want an active practitioner", got, err)
+	}
+}
+
+func TestPractitionerRoleRoundTrip(t *testing.T) {
+	organization := organizationID
+	role := models.PractitionerRole{
+		ID:             "r1",
+		PractitionerID: practitionerID,
+		Active:         true,
+		Role:           models.PractitionerRoleDoctor,
+		OrganizationID: &organization,
+		Specialties:    []string{"Cardiology", "Internal medicine"},
+		LocationIDs:    []string{locationID},
+	}
+
+	got, err := FHIRToPractitionerRole(PractitionerRoleToFHIR(role))
+	if err != nil {
+		t.Fatalf("FHIRToPractitionerRole() = %v", err)
+	}
+	if !reflect.DeepEqual(got, role) {
+		t.Errorf("FHIRToPractitionerRole() = %+v, want %+v", got, role)
+	}
+}
+
+func TestFHIRToPractitionerRoleErrors(t *testing.T) {
+	valid := func() *prrolepb.PractitionerRole {
+		return PractitionerRoleToFHIR(models.PractitionerRole{PractitionerID: practitionerID, Active: true, Role: models.PractitionerRoleNurse})
+	}
+
+	got, err := FHIRToPractitionerRole(&prrolepb.PractitionerRole{
+		Practitioner: reference("Practitioner", practitionerID),
+		Code:         []*dtpb.CodeableConcept{{Coding: []*dtpb.Coding{coding(systemPractitionerRole, models.PractitionerRoleNurse, "")}}},
+	})
+	if err != nil {
+		t.Fatalf("FHIRToPractitionerRole() = %v", err)
+	}
+	if !got.Active || got.OrganizationID != nil || got.Specialties == nil || got.LocationIDs == nil {
+		t.Errorf("FHIRToPractitionerRole() = %+v, want an active role with empty lists", got)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*prrolepb.PractitionerRole)
+	}{
+		{name: "no practitioner", modify: func(r *prrolepb.PractitionerRole) { r.Practitioner = nil }},
+		{name: "no code", modify: func(r *prrolepb.PractitionerRole) { r.Code = nil }},
+		{name: "two codes", modify: func(r *prrolepb.PractitionerRole) { r.Code = append(r.Code, r.Code[0]) }},
+		{name: "unknown code", modify: func(r *prrolepb.PractitionerRole) { r.Code[0].Coding[0].Code.Value = "surgeon" }},
+		{name: "other code system", modify: func(r *prrolepb.PractitionerRole) { r.Code[0].Coding[0].System.Value = "http://snomed.info/sct" }},
+		{name: "specialty without text", modify: func(r *prrolepb.PractitionerRole) { r.Specialty = []*dtpb.CodeableConcept{{}} }},
+		{name: "organization is not an Organization", modify: func(r *prrolepb.PractitionerRole) { r.Organization = reference("Location", "l1") }},
+		{name: "location is not a Location", modify: func(r *prrolepb.PractitionerRole) { r.Location = []*dtpb.Reference{reference("Organization", "o1")} }},
+	}
+
+	for _, tt := range tests {
+		resource := valid()
+		tt.modify(resource)
+		if _, err := FHIRToPractitionerRole(resource); err == nil {
+			t.Errorf("%s: FHIRToPractitionerRole() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestOrganizationRoundTrip(t *testing.T) {
+	hospitalID := "9e4b1a2c-7d3f-4c5e-8a6b-0c1d2e3f4a00"
+	organization := models.Organization{
+		ID:     organizationID,
+		Active: false,
+		Type:   models.OrganizationTypeDepartment,
+		Name:   "Cardiology",
+		PartOf: &hospitalID,
+	}
+
+	got, err := FHIRToOrganization(OrganizationToFHIR(organization))
+	if err != nil {
+		t.Fatalf("FHIRToOrganization() = %v", err)
+	}
+	if !reflect.DeepEqual(got, organization) {
+		t.Errorf("FHIRToOrganization() = %+v, want %+v", got, organization)
+	}
+
+	got, err = FHIRToOrganization(&orgpb.Organization{Name: &dtpb.String{Value: " Surgery "}})
+	if err != nil {
+		t.Fatalf("FHIRToOrganization() = %v", err)
+	}
+	if !got.Active || got.Type != models.OrganizationTypeDepartment || got.Name != "Surgery" {
+		t.Errorf("FHIRToOrganization() = %+v, want an active department named Surgery", got)
+	}
+
+	tests := []struct {
+		name         string
+		organization *orgpb.Organization
+	}{
+		{name: "no name", organization: &orgpb.Organization{}},
+		{name: "blank name", organization: &orgpb.Organization{Name: &dtpb.String{Value: " "}}},
+		{
+			name: "unsupported type",
+			organization: &orgpb.Organization{
+				Name: &dtpb.String{Value: "Surgery"},
+				Type: []*dtpb.CodeableConcept{{Coding: []*dtpb.Coding{coding(systemOrganizationType, "team", "")}}},
+			},
+		},
+		{
+			name:         "partOf is not an Organization",
+			organization: &orgpb.Organization{Name: &dtpb.String{Value: "Surgery"}, PartOf: reference("Location", locationID)},
+		},
+	}
+
+	for _, tt := range tests {
+		if _, err := FHIRToOrganization(tt.organization); err == nil {
+			t.Errorf("%s: FHIRToOrganization() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestLocationRoundTrip(t *testing.T) {
+	wardID := "6a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c00"
+	organization := organizationID
+	location := models.Location{
+		ID:             locationID,
+		Status:         models.LocationStatusSuspended,
+		Name:           "Room 101",
+		PhysicalType:   models.LocationTypeRoom,
+		OrganizationID: &organization,
+		PartOf:         &wardID,
+	}
+
+	got, err := FHIRToLocation(LocationToFHIR(location))
+	if err != nil {
+		t.Fatalf("FHIRToLocation() = %v", err)
+	}
+	if !reflect.DeepEqual(got, location) {
+		t.Errorf("FHIRToLocation() = %+v, want %+v", got, location)
+	}
+
+	valid := func() *locpb.Location {
+		return LocationToFHIR(models.Location{Status: models.LocationStatusActive, Name: "Bed 1", PhysicalType: models.LocationTypeBed})
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*locpb.Location)
+	}{
+		{name: "no name", modify: func(l *locpb.Location) { l.Name = nil }},
+		{name: "no physical type", modify: func(l *locpb.Location) { l.PhysicalType = nil }},
+		{name: "unsupported physical type", modify: func(l *locpb.Location) { l.PhysicalType.Coding[0].Code.Value = "ve" }},
+		{name: "unsupported status", modify: func(l *locpb.Location) { l.Status.Value = codespb.LocationStatusCode_INVALID_UNINITIALIZED }},
+		{name: "managed by a Location", modify: func(l *locpb.Location) { l.ManagingOrganization = reference("Location", wardID) }},
+		{name: "part of an Organization", modify: func(l *locpb.Location) { l.PartOf = reference("Organization", organizationID) }},
+	}
+
+	for _, tt := range tests {
+		resource := valid()
+		tt.modify(resource)
+		if _, err := FHIRToLocation(resource); err == nil {
+			t.Errorf("%s: FHIRToLocation() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestEncounterLocationRoundTrip(t *testing.T) {
+	id := locationID
+	name := "Room 101"
+	encounter := withDetails(models.Encounter{
+		ID:             "e1",
+		PatientID:      patientID,
+		PractitionerID: practitionerID,
+		Status:         "planned",
+		StartTime:      time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC),
+		LocationID:     &id,
+	})
+	encounter.LocationName = &name
+
+	resource := EncounterToFHIR(encounter)
+	if len(resource.Location) != 1 || resource.Location[0].Location.Display.GetValue() != name {
+		t.Fatalf("location = %v, want %s", resource.Location, name)
+	}
+
+	got, err := FHIRToEncounter(resource)
+	if err != nil {
+		t.Fatalf("FHIRToEncounter() = %v", err)
+	}
+	if got.LocationID == nil || *got.LocationID != locationID {
+		t.Errorf("LocationID = %v, want %s", got.LocationID, locationID)
+	}
+
+	resource.Location[0].Location = reference("Organization", organizationID)
+	if _, err := FHIRToEncounter(resource); err == nil {
+		t.Error("FHIRToEncounter() with a non-Location location = nil, want an error")
+	}
+}
+
+func TestLocationBedStatus(t *testing.T) {
+	for status, want := range bedStatusCodings {
+		bedStatus := status
+		resource := LocationToFHIR(models.Location{Status: models.LocationStatusActive, Name: "Bed 1", PhysicalType: models.LocationTypeBed, BedStatus: &bedStatus})
+		if resource.OperationalStatus.GetCode().GetValue() != want.code || resource.OperationalStatus.GetSystem().GetValue() != systemBedStatus {
+			t.Errorf("operationalStatus of a %s bed = %v, want %s", status, resource.OperationalStatus, want.code)
+		}
+
+		got, err := FHIRToLocation(resource)
+		if err != nil {
+			t.Fatalf("FHIRToLocation() = %v", err)
+		}
+		if got.BedStatus != nil {
+			t.Errorf("BedStatus = %s, want it kept by the server", *got.BedStatus)
+		}
+	}
+
+	if resource := LocationToFHIR(models.Location{Status: models.LocationStatusActive, Name: "Room 1", PhysicalType: models.LocationTypeRoom}); resource.OperationalStatus != nil {
+		t.Errorf("operationalStatus of a room = %v, want none", resource.OperationalStatus)
+	}
+}
+
+func TestFHIRToPatient(t *testing.T) {
+	middleName := "Petrovich"
+	patient := models.Patient{ID: "p1", FirstName: "Ivan", LastName: "Ivanov", MiddleName: &middleName, DateOfBirth: "1980-05-17", Gender: "male"}
+
+	got, err := FHIRToPatient(PatientToFHIR(patient))
+	if err != nil {
+		t.Fatalf("FHIRToPatient() = %v", err)
+	}
+	if !reflect.DeepEqual(got, patient) {
+		t.Errorf("FHIRToPatient() = %+v, want %+v", got, patient)
+	}
+
+	resource := PatientToFHIR(models.Patient{FirstName: "Anna", LastName: "Petrova", DateOfBirth: "1990-01-01"})
+	resource.BirthDate.Timezone = "+03:00"
+	resource.BirthDate.ValueUs = time.Date(1990, 1, 1, 0, 0, 0, 0, time.FixedZone("", 3*3600)).UnixMicro()
+	got, err = FHIRToPatient(resource)
+	if err != nil {
+		t.Fatalf("FHIRToPatient() = %v", err)
+	}
+	if got.DateOfBirth != "1990-01-01" || got.Gender != "unknown" {
+		t.Errorf("FHIRToPatient() = %+v, want born 1990-01-01 of unknown gender", got)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*patientpb.Patient)
+	}{
+		{name: "no name", modify: func(p *patientpb.Patient) { p.Name = nil }},
+		{name: "no given name", modify: func(p *patientpb.Patient) { p.Name[0].Given = nil }},
+		{name: "blank family name", modify: func(p *patientpb.Patient) { p.Name[0].Family.Value = " " }},
+		{name: "no birth date", modify: func(p *patientpb.Patient) { p.BirthDate = nil }},
+	}
+
+	for _, tt := range tests {
+		resource := PatientToFHIR(patient)
+		tt.modify(resource)
+		if _, err := FHIRToPatient(resource); err == nil {
+			t.Errorf("%s: FHIRToPatient() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestIdentifierRoundTrip(t *testing.T) {
+	identifiers := []models.Identifier{
+		{System: "urn:reception:visit", Value: "42"},
+		{Value: "A-7"},
+	}
+
+	encounter := withDetails(models.Encounter{
+		ID:             "e1",
+		PatientID:      patientID,
+		PractitionerID: practitionerID,
+		Status:         models.EncounterStatusPlanned,
+		StartTime:      time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC),
+		Identifiers:    identifiers,
+	})
+
+	resource := EncounterToFHIR(encounter)
+	if len(resource.Identifier) != 2 || resource.Identifier[1].System != nil {
+		t.Fatalf("identifier = %v, want two, the second without a system", resource.Identifier)
+	}
+
+	got, err := FHIRToEncounter(resource)
+	if err != nil {
+		t.Fatalf("FHIRToEncounter() = %v", err)
+	}
+	if !reflect.DeepEqual(got.Identifiers, identifiers) {
+		t.Errorf("identifiers = %+v, want %+v", got.Identifiers, identifiers)
+	}
+
+	resource.Identifier = nil
+	if got, err := FHIRToEncounter(resource); err != nil || got.Identifiers == nil || len(got.Identifiers) != 0 {
+		t.Errorf("FHIRToEncounter() identifiers = %#v, %v, want an empty slice", got.Identifiers, err)
+	}
+}
@@ -0,0 +1,42 @@
+package fhir
+
+import (
+	"fmt"
+	"hospital-srv/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/medication_request_go_proto"
+)
+
+func (s *FHIRServer) medicationRequests() resourceHandler[models.MedicationRequest, models.MedicationRequestFilter, *mrpb.MedicationRequest] {
+	return resourceHandler[models.MedicationRequest, models.MedicationRequestFilter, *mrpb.MedicationRequest]{
+		resourceType: "MedicationRequest",
+		toFHIR:       MedicationRequestToFHIR,
+		fromFHIR:     FHIRToMedicationRequest,
+		parseSearch:  parseMedicationRequestSearch,
+		meta: func(request models.MedicationRequest) (string, int, time.Time) {
+			return request.ID, request.VersionID, request.UpdatedAt
+		},
+		describe: func(request models.MedicationRequest) string {
+			return fmt.Sprintf("(%s) for patient %s", request.Medication.Code, request.PatientID)
+		},
+		create:  s.medicationService.CreateMedicationRequest,
+		get:     s.medicationService.GetMedicationRequestByID,
+		search:  s.medicationService.SearchMedicationRequests,
+		update:  s.medicationService.UpdateMedicationRequest,
+		history: s.medicationService.GetMedicationRequestHistory,
+		version: s.medicationService.GetMedicationRequestVersion,
+	}
+}
+
+func (s *FHIRServer) CreateMedicationRequest(c *gin.Context) { s.medicationRequests().handleCreate(c) }
+func (s *FHIRServer) GetMedicationRequests(c *gin.Context)   { s.medicationRequests().handleSearch(c) }
+func (s *FHIRServer) GetMedicationRequest(c *gin.Context)    { s.medicationRequests().handleRead(c) }
+func (s *FHIRServer) UpdateMedicationRequest(c *gin.Context) { s.medicationRequests().handleUpdate(c) }
+func (s *FHIRServer) GetMedicationRequestHistory(c *gin.Context) {
+	s.medicationRequests().handleHistory(c)
+}
+func (s *FHIRServer) GetMedicationRequestVersion(c *gin.Context) {
+	s.medicationRequests().handleVersion(c)
+}
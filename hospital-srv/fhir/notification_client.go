@@ -2,96 +2,265 @@ package fhir
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"hospital-srv/services"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"signature"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	dispatchInterval    = time.Second
+	dispatchBatchSize   = 20
+	deliveryLease       = time.Minute
+	maxDeliveryAttempts = 8
+	initialRetryDelay   = 5 * time.Second
+	maxRetryDelay       = time.Hour
+)
+
+// NotificationClient queues resource events for matching Subscriptions in
+// the notification outbox and delivers them to their rest-hook endpoints.
 type NotificationClient struct {
-	doctorAPIURL    string
-	receptionAPIURL string
-	httpClient      *http.Client
+	subscriptionService *services.SubscriptionService
+	notificationService *services.NotificationService
+	signingSecret       []byte
+	httpClient          *http.Client
+}
+
+// subscriptionNotification is the rest-hook body sent to subscribers. Data
+// carries the resource, and Included the resources it references as Bundle
+// entries, only when the subscription asked for a payload.
+type subscriptionNotification struct {
+	Type         string                   `json:"type"`
+	Subscription string                   `json:"subscription"`
+	Data         map[string]interface{}   `json:"data,omitempty"`
+	Included     []map[string]interface{} `json:"included,omitempty"`
 }
 
-func NewNotificationClient(doctorAPIURL string, receptionAPIURL string) *NotificationClient {
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
+// NewNotificationClient creates a client that verifies subscriber
+// certificates against the CA bundle at caPath and signs every payload with
+// signingSecret.
+func NewNotificationClient(subscriptionService *services.SubscriptionService, notificationService *services.NotificationService, caPath string, signingSecret string) (*NotificationClient, error) {
+	caCert, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to append CA certificate")
 	}
 
 	httpClient := &http.Client{
 		Timeout: 10 * time.Second,
 		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
+			TLSClientConfig: &tls.Config{
+				RootCAs: certPool,
+			},
 		},
 	}
 
 	return &NotificationClient{
-		doctorAPIURL:    doctorAPIURL,
-		receptionAPIURL: receptionAPIURL,
-		httpClient:      httpClient,
-	}
+		subscriptionService: subscriptionService,
+		notificationService: notificationService,
+		signingSecret:       []byte(signingSecret),
+		httpClient:          httpClient,
+	}, nil
 }
 
-func (c *NotificationClient) NotifyEncounterCreated(encounterData interface{}) error {
-	notification := map[string]interface{}{
-		"type": "encounter_created",
-		"data": encounterData,
+// EnqueueEncounterEvent writes one outbox entry per subscription whose
+// criteria match the encounter, using the caller's transaction.
+func (c *NotificationClient) EnqueueEncounterEvent(tx *repository.Repository, eventType string, encounter models.EncounterWithDetails) error {
+	subscriptions, err := tx.GetActiveSubscriptions("Encounter")
+	if err != nil {
+		return fmt.Errorf("failed to load subscriptions: %w", err)
 	}
 
-	c.sendNotificationToAll(notification)
-	return nil
-}
+	resourceMap, err := protoToMap(EncounterToFHIR(encounter))
+	if err != nil {
+		return fmt.Errorf("failed to convert encounter: %w", err)
+	}
 
-func (c *NotificationClient) NotifyEncounterStatusUpdated(encounterData interface{}) error {
-	notification := map[string]interface{}{
-		"type": "encounter_status_updated",
-		"data": encounterData,
+	// The subject and participant travel with the encounter, as a search
+	// with _include=Encounter:subject&_include=Encounter:participant would.
+	patientMap, err := protoToMap(PatientToFHIR(encounter.Patient))
+	if err != nil {
+		return fmt.Errorf("failed to convert patient: %w", err)
+	}
+	practitionerMap, err := protoToMap(PractitionerToFHIR(encounter.Practitioner))
+	if err != nil {
+		return fmt.Errorf("failed to convert practitioner: %w", err)
+	}
+
+	for _, sub := range subscriptions {
+		filter, err := parseSubscriptionCriteria(sub.Criteria)
+		if err != nil || !encounterMatches(filter, encounter) {
+			continue
+		}
+
+		notification := subscriptionNotification{
+			Type:         eventType,
+			Subscription: sub.ID,
+		}
+		if sub.Payload != nil {
+			notification.Data = resourceMap
+			notification.Included = []map[string]interface{}{
+				{"fullUrl": "Patient/" + encounter.Patient.ID, "resource": patientMap},
+				{"fullUrl": "Practitioner/" + encounter.Practitioner.ID, "resource": practitionerMap},
+			}
+		}
+
+		payload, err := json.Marshal(notification)
+		if err != nil {
+			return fmt.Errorf("failed to marshal notification: %w", err)
+		}
+
+		if err := tx.EnqueueNotification(sub.ID, eventType, payload); err != nil {
+			return fmt.Errorf("failed to enqueue notification: %w", err)
+		}
 	}
 
-	c.sendNotificationToAll(notification)
 	return nil
 }
 
-func (c *NotificationClient) sendNotificationToAll(notification map[string]interface{}) {
-	go c.sendNotification(c.doctorAPIURL, notification)
-	go c.sendNotification(c.receptionAPIURL, notification)
+// Run delivers due outbox entries until ctx is cancelled.
+func (c *NotificationClient) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.dispatchDue()
+		}
+	}
+}
+
+func (c *NotificationClient) dispatchDue() {
+	notifications, err := c.notificationService.ClaimDueNotifications(dispatchBatchSize, deliveryLease)
+	if err != nil {
+		log.Printf("Failed to claim due notifications: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, n := range notifications {
+		wg.Add(1)
+		go func(n models.Notification) {
+			defer wg.Done()
+			c.deliver(n)
+		}(n)
+	}
+	wg.Wait()
 }
 
-func (c *NotificationClient) sendNotification(targetAPIURL string, notification map[string]interface{}) error {
-	jsonBytes, err := json.Marshal(notification)
+func (c *NotificationClient) deliver(n models.Notification) {
+	sub, err := c.subscriptionService.GetSubscriptionByID(n.SubscriptionID)
+	if err != nil {
+		c.recordFailure(n, fmt.Errorf("failed to load subscription: %w", err))
+		return
+	}
+
+	if sub.Status == models.SubscriptionStatusOff {
+		c.recordFailure(n, fmt.Errorf("subscription %s is off", sub.ID))
+		return
+	}
+
+	err = c.sendNotification(*sub, n)
 	if err != nil {
-		log.Printf("Failed to marshal notification: %v", err)
-		return fmt.Errorf("failed to marshal notification: %w", err)
+		c.recordFailure(n, err)
+	} else if err := c.notificationService.MarkNotificationDelivered(n.ID); err != nil {
+		log.Printf("Failed to mark notification %s delivered: %v", n.ID, err)
 	}
 
-	url := fmt.Sprintf("%s/fhir/notifications/encounter", targetAPIURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBytes))
+	var deliveryError *string
+	if err != nil {
+		message := err.Error()
+		deliveryError = &message
+	}
+
+	if err := c.subscriptionService.SetSubscriptionError(sub.ID, deliveryError); err != nil {
+		log.Printf("Failed to record delivery status of subscription %s: %v", sub.ID, err)
+	}
+}
+
+// recordFailure schedules the next attempt with exponential backoff, or
+// dead-letters the notification once its attempts are used up.
+func (c *NotificationClient) recordFailure(n models.Notification, deliveryErr error) {
+	var nextAttempt *time.Time
+	if n.Attempts < maxDeliveryAttempts {
+		next := time.Now().Add(retryDelay(n.Attempts))
+		nextAttempt = &next
+	}
+
+	if nextAttempt == nil {
+		log.Printf("Notification %s dead-lettered after %d attempts: %v", n.ID, n.Attempts, deliveryErr)
+	}
+
+	if err := c.notificationService.MarkNotificationFailed(n.ID, deliveryErr.Error(), nextAttempt); err != nil {
+		log.Printf("Failed to record failed delivery of notification %s: %v", n.ID, err)
+	}
+}
+
+// retryDelay doubles the wait after every failed attempt, starting at
+// initialRetryDelay and capped at maxRetryDelay.
+func retryDelay(attempts int) time.Duration {
+	delay := initialRetryDelay << (attempts - 1)
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+func (c *NotificationClient) sendNotification(sub models.Subscription, n models.Notification) error {
+	req, err := http.NewRequest("POST", sub.Endpoint, bytes.NewBuffer(n.Payload))
 	if err != nil {
-		log.Printf("Failed to create request: %v", err)
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	// The notification wraps the resources in an envelope of its own, so it
+	// is plain JSON whichever payload type the subscription names.
+	req.Header.Set("Content-Type", contentTypeJSON)
+
+	for _, header := range sub.Headers {
+		name, value, ok := strings.Cut(header, ":")
+		if ok {
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	if err := signature.Sign(req.Header, c.signingSecret, n.Payload); err != nil {
+		return fmt.Errorf("failed to sign notification: %w", err)
+	}
 
-	log.Printf("Sending FHIR notification: type=%s, url=%s", notification["type"], url)
+	log.Printf("Sending FHIR notification: type=%s, subscription=%s, attempt=%d, url=%s", n.EventType, sub.ID, n.Attempts, sub.Endpoint)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		log.Printf("Failed to send notification to %s: %v", targetAPIURL, err)
+		log.Printf("Failed to send notification to %s: %v", sub.Endpoint, err)
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		log.Printf("API %s returned error: status=%d, body=%s", targetAPIURL, resp.StatusCode, string(respBody))
+		log.Printf("Subscriber %s returned error: status=%d, body=%s", sub.Endpoint, resp.StatusCode, string(respBody))
 		return fmt.Errorf("notification failed with status %d", resp.StatusCode)
 	}
 
-	log.Printf("Successfully sent FHIR notification to %s: type=%s", targetAPIURL, notification["type"])
+	log.Printf("Successfully sent FHIR notification to %s: type=%s", sub.Endpoint, n.EventType)
 	return nil
 }
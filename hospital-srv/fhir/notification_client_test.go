@@ -0,0 +1,73 @@
+package fhir
+
+import (
+	"hospital-srv/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 5 * time.Second},
+		{attempts: 2, want: 10 * time.Second},
+		{attempts: 4, want: 40 * time.Second},
+		{attempts: 10, want: 5 * time.Second << 9},
+		{attempts: 12, want: maxRetryDelay},
+		{attempts: 80, want: maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempts); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSendNotification(t *testing.T) {
+	var gotContentType, gotAuthorization, gotBody string
+	status := http.StatusOK
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotContentType = r.Header.Get("Content-Type")
+		gotAuthorization = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	c := &NotificationClient{httpClient: server.Client()}
+	payload := "application/fhir+json"
+	sub := models.Subscription{
+		ID:       "s1",
+		Endpoint: server.URL,
+		Payload:  &payload,
+		Headers:  []string{"Authorization: Bearer secret", "malformed"},
+	}
+	n := models.Notification{ID: "n1", EventType: "encounter_created", Attempts: 1, Payload: []byte(`{"type":"encounter_created"}`)}
+
+	if err := c.sendNotification(sub, n); err != nil {
+		t.Fatalf("sendNotification() = %v", err)
+	}
+	if gotContentType != "application/json" || gotAuthorization != "Bearer secret" || gotBody != string(n.Payload) {
+		t.Errorf("request = %q, %q, %q", gotContentType, gotAuthorization, gotBody)
+	}
+
+	sub.Payload = nil
+	if err := c.sendNotification(sub, n); err != nil {
+		t.Fatalf("sendNotification() = %v", err)
+	}
+	if gotContentType != "application/json" {
+		t.Errorf("Content-Type without payload = %q, want application/json", gotContentType)
+	}
+
+	status = http.StatusInternalServerError
+	if err := c.sendNotification(sub, n); err == nil {
+		t.Errorf("sendNotification() to a failing subscriber = nil, want an error")
+	}
+}
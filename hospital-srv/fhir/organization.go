@@ -0,0 +1,38 @@
+package fhir
+
+import (
+	"fmt"
+	"hospital-srv/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	orgpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/organization_go_proto"
+)
+
+func (s *FHIRServer) organizations() resourceHandler[models.Organization, models.OrganizationFilter, *orgpb.Organization] {
+	return resourceHandler[models.Organization, models.OrganizationFilter, *orgpb.Organization]{
+		resourceType: "Organization",
+		toFHIR:       OrganizationToFHIR,
+		fromFHIR:     FHIRToOrganization,
+		parseSearch:  parseOrganizationSearch,
+		meta: func(organization models.Organization) (string, int, time.Time) {
+			return organization.ID, organization.VersionID, organization.UpdatedAt
+		},
+		describe: func(organization models.Organization) string {
+			return fmt.Sprintf("(%s)", organization.Name)
+		},
+		create:  s.organizationService.CreateOrganization,
+		get:     s.organizationService.GetOrganizationByID,
+		search:  s.organizationService.SearchOrganizations,
+		update:  s.organizationService.UpdateOrganization,
+		history: s.organizationService.GetOrganizationHistory,
+		version: s.organizationService.GetOrganizationVersion,
+	}
+}
+
+func (s *FHIRServer) CreateOrganization(c *gin.Context)     { s.organizations().handleCreate(c) }
+func (s *FHIRServer) GetOrganizations(c *gin.Context)       { s.organizations().handleSearch(c) }
+func (s *FHIRServer) GetOrganization(c *gin.Context)        { s.organizations().handleRead(c) }
+func (s *FHIRServer) UpdateOrganization(c *gin.Context)     { s.organizations().handleUpdate(c) }
+func (s *FHIRServer) GetOrganizationHistory(c *gin.Context) { s.organizations().handleHistory(c) }
+func (s *FHIRServer) GetOrganizationVersion(c *gin.Context) { s.organizations().handleVersion(c) }
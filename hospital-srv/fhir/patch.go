@@ -0,0 +1,645 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	paramspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	contentTypeJSONPatch = "application/json-patch+json"
+	contentTypeFHIRJSON  = "application/fhir+json"
+)
+
+var errUnsupportedPatchFormat = errors.New("unsupported patch format: use application/json-patch+json or a FHIRPath Patch Parameters resource")
+
+// applyPatch dispatches on the request content type: JSON Patch documents or
+// FHIRPath Patch Parameters resources, which NegotiateFormat hands over as
+// protojson whether they were sent as such or as FHIR JSON or XML.
+func applyPatch(contentType string, resource proto.Message, resourceType string, body []byte) error {
+	switch contentType {
+	case contentTypeJSONPatch:
+		return applyJSONPatch(resource, body)
+	case contentTypeJSON, contentTypeFHIRJSON:
+		return applyFHIRPathPatch(resource, resourceType, body)
+	default:
+		return errUnsupportedPatchFormat
+	}
+}
+
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from"`
+	Value interface{} `json:"value"`
+}
+
+// applyJSONPatch applies an RFC 6902 document to resource. Paths address the
+// FHIR JSON form of the resource, e.g. /status or /subject/reference, so the
+// patch is applied to that form and the result read back into resource.
+func applyJSONPatch(resource proto.Message, patch []byte) error {
+	var operations []jsonPatchOperation
+	if err := decodeJSON(patch, &operations); err != nil {
+		return fmt.Errorf("invalid JSON Patch document: %w", err)
+	}
+
+	data, err := marshalFHIRJSON(resource)
+	if err != nil {
+		return err
+	}
+
+	var root interface{}
+	if err := decodeJSON(data, &root); err != nil {
+		return err
+	}
+
+	for i, op := range operations {
+		root, err = applyJSONPatchOperation(root, op)
+		if err != nil {
+			return fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	patched, err := json.Marshal(root)
+	if err != nil {
+		return err
+	}
+
+	result, err := parseFHIRJSON(patched)
+	if err != nil {
+		return fmt.Errorf("patched resource is invalid: %w", err)
+	}
+	if result.Descriptor() != resource.ProtoReflect().Descriptor() {
+		return errors.New("patched resource is invalid: resourceType cannot be changed")
+	}
+
+	proto.Reset(resource)
+	proto.Merge(resource, result.Interface())
+	return nil
+}
+
+// decodeJSON unmarshals data keeping numbers as json.Number, so that FHIR
+// decimals keep their precision through a patch.
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func applyJSONPatchOperation(root interface{}, op jsonPatchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return mutateJSON(root, path, func(container interface{}, key string) (interface{}, error) {
+			return jsonInsert(container, key, op.Value)
+		})
+	case "remove":
+		return mutateJSON(root, path, jsonRemove)
+	case "replace":
+		return mutateJSON(root, path, func(container interface{}, key string) (interface{}, error) {
+			return jsonReplace(container, key, op.Value)
+		})
+	case "test":
+		current, err := getJSON(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, normalizeJSON(op.Value)) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return root, nil
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getJSON(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if root, err = mutateJSON(root, from, jsonRemove); err != nil {
+				return nil, err
+			}
+		} else {
+			value = normalizeJSON(value)
+		}
+		return mutateJSON(root, path, func(container interface{}, key string) (interface{}, error) {
+			return jsonInsert(container, key, value)
+		})
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+}
+
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" || !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// normalizeJSON round-trips a value through encoding/json so that deep
+// comparisons and copies see the same types as an unmarshalled document.
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var result interface{}
+	if err := decodeJSON(data, &result); err != nil {
+		return value
+	}
+
+	return result
+}
+
+func getJSON(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found")
+			}
+			node = child
+		case []interface{}:
+			idx, err := arrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("path not found")
+		}
+	}
+
+	return node, nil
+}
+
+// mutateJSON walks to the parent of path and calls fn with the parent
+// container and the final key, storing whatever container fn returns.
+func mutateJSON(node interface{}, path []string, fn func(container interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("path not found")
+		}
+		updated, err := mutateJSON(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = updated
+		return n, nil
+	case []interface{}:
+		idx, err := arrayIndex(path[0], len(n))
+		if err != nil {
+			return nil, err
+		}
+		updated, err := mutateJSON(n[idx], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("path not found")
+	}
+}
+
+func jsonInsert(container interface{}, key string, value interface{}) (interface{}, error) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		c[key] = normalizeJSON(value)
+		return c, nil
+	case []interface{}:
+		if key == "-" {
+			return append(c, normalizeJSON(value)), nil
+		}
+		idx, err := arrayIndex(key, len(c)+1)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, nil)
+		copy(c[idx+1:], c[idx:])
+		c[idx] = normalizeJSON(value)
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path not found")
+	}
+}
+
+func jsonRemove(container interface{}, key string) (interface{}, error) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if _, ok := c[key]; !ok {
+			return nil, fmt.Errorf("path not found")
+		}
+		delete(c, key)
+		return c, nil
+	case []interface{}:
+		idx, err := arrayIndex(key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		return append(c[:idx], c[idx+1:]...), nil
+	default:
+		return nil, fmt.Errorf("path not found")
+	}
+}
+
+func jsonReplace(container interface{}, key string, value interface{}) (interface{}, error) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		if _, ok := c[key]; !ok {
+			return nil, fmt.Errorf("path not found")
+		}
+		c[key] = normalizeJSON(value)
+		return c, nil
+	case []interface{}:
+		idx, err := arrayIndex(key, len(c))
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = normalizeJSON(value)
+		return c, nil
+	default:
+		return nil, fmt.Errorf("path not found")
+	}
+}
+
+func arrayIndex(token string, length int) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx >= length {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return idx, nil
+}
+
+type fhirPathSegment struct {
+	name  string
+	index int
+}
+
+type fhirPathOperation struct {
+	opType      string
+	path        string
+	name        string
+	index       int
+	source      int
+	destination int
+	value       *paramspb.Parameters_Parameter_ValueX
+}
+
+// applyFHIRPathPatch applies a FHIRPath Patch Parameters resource. Only simple
+// paths such as Encounter.participant[0].individual are supported.
+func applyFHIRPathPatch(resource proto.Message, resourceType string, body []byte) error {
+	var params paramspb.Parameters
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, &params); err != nil {
+		return fmt.Errorf("invalid FHIRPath Patch Parameters: %w", err)
+	}
+
+	if len(params.Parameter) == 0 {
+		return fmt.Errorf("FHIRPath Patch contains no operations")
+	}
+
+	for i, p := range params.Parameter {
+		if p.Name == nil || p.Name.Value != "operation" {
+			return fmt.Errorf("parameter %d: expected name 'operation'", i)
+		}
+
+		op, err := parseFHIRPathOperation(p)
+		if err != nil {
+			return fmt.Errorf("parameter %d: %w", i, err)
+		}
+
+		if err := applyFHIRPathOperation(resource.ProtoReflect(), resourceType, op); err != nil {
+			return fmt.Errorf("operation %d (%s %s): %w", i, op.opType, op.path, err)
+		}
+	}
+
+	return nil
+}
+
+func parseFHIRPathOperation(p *paramspb.Parameters_Parameter) (fhirPathOperation, error) {
+	op := fhirPathOperation{index: -1, source: -1, destination: -1}
+
+	for _, part := range p.Part {
+		if part.Name == nil {
+			continue
+		}
+		switch part.Name.Value {
+		case "type":
+			op.opType = part.GetValue().GetCode().GetValue()
+		case "path":
+			op.path = part.GetValue().GetStringValue().GetValue()
+		case "name":
+			op.name = part.GetValue().GetStringValue().GetValue()
+		case "value":
+			op.value = part.GetValue()
+		case "index":
+			op.index = int(part.GetValue().GetInteger().GetValue())
+		case "source":
+			op.source = int(part.GetValue().GetInteger().GetValue())
+		case "destination":
+			op.destination = int(part.GetValue().GetInteger().GetValue())
+		}
+	}
+
+	if op.opType == "" || op.path == "" {
+		return op, fmt.Errorf("operation requires type and path")
+	}
+
+	return op, nil
+}
+
+func parseFHIRPath(path string, resourceType string) ([]fhirPathSegment, error) {
+	parts := strings.Split(path, ".")
+	if parts[0] != resourceType {
+		return nil, fmt.Errorf("path must start with %s", resourceType)
+	}
+
+	segments := make([]fhirPathSegment, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		segment := fhirPathSegment{name: part, index: -1}
+		if open := strings.Index(part, "["); open != -1 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("invalid path element %q", part)
+			}
+			idx, err := strconv.Atoi(part[open+1 : len(part)-1])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid index in %q", part)
+			}
+			segment.name = part[:open]
+			segment.index = idx
+		}
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+func fieldByJSONName(msg protoreflect.Message, name string) (protoreflect.FieldDescriptor, error) {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.JSONName() == name || string(fd.Name()) == name {
+			return fd, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown element %q", name)
+}
+
+// resolveElement walks segments and returns the message holding the last
+// segment together with its field descriptor.
+func resolveElement(msg protoreflect.Message, segments []fhirPathSegment) (protoreflect.Message, protoreflect.FieldDescriptor, int, error) {
+	for i, segment := range segments {
+		fd, err := fieldByJSONName(msg, segment.name)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+
+		if i == len(segments)-1 {
+			return msg, fd, segment.index, nil
+		}
+
+		if fd.Message() == nil || !msg.Has(fd) {
+			return nil, nil, 0, fmt.Errorf("element %q not found", segment.name)
+		}
+
+		if fd.IsList() {
+			list := msg.Mutable(fd).List()
+			idx := segment.index
+			if idx == -1 && list.Len() == 1 {
+				idx = 0
+			}
+			if idx < 0 || idx >= list.Len() {
+				return nil, nil, 0, fmt.Errorf("element %q has no item at index %d", segment.name, segment.index)
+			}
+			msg = list.Get(idx).Message()
+			continue
+		}
+
+		msg = msg.Mutable(fd).Message()
+	}
+
+	return nil, nil, 0, fmt.Errorf("empty path")
+}
+
+func applyFHIRPathOperation(root protoreflect.Message, resourceType string, op fhirPathOperation) error {
+	segments, err := parseFHIRPath(op.path, resourceType)
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		if op.opType != "add" {
+			return fmt.Errorf("only add may target the resource root")
+		}
+		child, err := fieldByJSONName(root, op.name)
+		if err != nil {
+			return err
+		}
+		return setFieldValue(root, child, -1, op.value, true)
+	}
+
+	parent, fd, index, err := resolveElement(root, segments)
+	if err != nil {
+		return err
+	}
+
+	switch op.opType {
+	case "add":
+		target, err := addTarget(parent, fd, index)
+		if err != nil {
+			return err
+		}
+		child, err := fieldByJSONName(target, op.name)
+		if err != nil {
+			return err
+		}
+		return setFieldValue(target, child, -1, op.value, true)
+
+	case "insert":
+		if !fd.IsList() || op.index < 0 {
+			return fmt.Errorf("insert requires a repeating element and an index")
+		}
+		return setFieldValue(parent, fd, op.index, op.value, true)
+
+	case "replace":
+		if !parent.Has(fd) {
+			return fmt.Errorf("element %q not found", fd.JSONName())
+		}
+		return setFieldValue(parent, fd, index, op.value, false)
+
+	case "delete":
+		if !parent.Has(fd) {
+			return nil
+		}
+		if fd.IsList() && index != -1 {
+			list := parent.Mutable(fd).List()
+			if index >= list.Len() {
+				return nil
+			}
+			removeListItem(list, index)
+			return nil
+		}
+		parent.Clear(fd)
+		return nil
+
+	case "move":
+		if !fd.IsList() {
+			return fmt.Errorf("move requires a repeating element")
+		}
+		list := parent.Mutable(fd).List()
+		if op.source < 0 || op.source >= list.Len() || op.destination < 0 || op.destination >= list.Len() {
+			return fmt.Errorf("move source or destination out of range")
+		}
+		item := list.Get(op.source)
+		removeListItem(list, op.source)
+		insertListItem(list, op.destination, item)
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported operation type %q", op.opType)
+	}
+}
+
+// addTarget returns the existing element that an add operation appends a
+// child to.
+func addTarget(parent protoreflect.Message, fd protoreflect.FieldDescriptor, index int) (protoreflect.Message, error) {
+	if fd.Message() == nil || !parent.Has(fd) {
+		return nil, fmt.Errorf("add requires a path to an existing element")
+	}
+
+	if !fd.IsList() {
+		return parent.Mutable(fd).Message(), nil
+	}
+
+	list := parent.Mutable(fd).List()
+	if index == -1 && list.Len() == 1 {
+		index = 0
+	}
+	if index < 0 || index >= list.Len() {
+		return nil, fmt.Errorf("add path must select a single element")
+	}
+
+	return list.Get(index).Message(), nil
+}
+
+func setFieldValue(parent protoreflect.Message, fd protoreflect.FieldDescriptor, index int, value *paramspb.Parameters_Parameter_ValueX, insert bool) error {
+	if value == nil {
+		return fmt.Errorf("operation requires a value")
+	}
+
+	if fd.Message() == nil {
+		return fmt.Errorf("element %q cannot be patched", fd.JSONName())
+	}
+
+	if !fd.IsList() {
+		element := parent.NewField(fd)
+		if err := convertPatchValue(value, element.Message()); err != nil {
+			return err
+		}
+		parent.Set(fd, element)
+		return nil
+	}
+
+	list := parent.Mutable(fd).List()
+	element := list.NewElement()
+	if err := convertPatchValue(value, element.Message()); err != nil {
+		return err
+	}
+
+	switch {
+	case index == -1 && insert:
+		list.Append(element)
+	case index == -1 && list.Len() == 1:
+		list.Set(0, element)
+	case insert && index <= list.Len():
+		insertListItem(list, index, element)
+	case !insert && index >= 0 && index < list.Len():
+		list.Set(index, element)
+	default:
+		return fmt.Errorf("index %d out of range for %q", index, fd.JSONName())
+	}
+
+	return nil
+}
+
+// convertPatchValue copies a Parameters value[x] into target. Values of the
+// generic code type are mapped onto resource-specific code enums, so
+// "finished" becomes FINISHED.
+func convertPatchValue(value *paramspb.Parameters_Parameter_ValueX, target protoreflect.Message) error {
+	valueMsg := value.ProtoReflect()
+	oneof := valueMsg.Descriptor().Oneofs().Get(0)
+	set := valueMsg.WhichOneof(oneof)
+	if set == nil {
+		return fmt.Errorf("operation value is empty")
+	}
+
+	data, err := protojson.Marshal(valueMsg.Get(set).Message().Interface())
+	if err != nil {
+		return err
+	}
+
+	if valueField := target.Descriptor().Fields().ByName("value"); valueField != nil && valueField.Kind() == protoreflect.EnumKind {
+		var code map[string]interface{}
+		if err := json.Unmarshal(data, &code); err != nil {
+			return err
+		}
+		if s, ok := code["value"].(string); ok {
+			code["value"] = strings.ToUpper(strings.ReplaceAll(s, "-", "_"))
+		}
+		if data, err = json.Marshal(code); err != nil {
+			return err
+		}
+	}
+
+	if err := protojson.Unmarshal(data, target.Interface()); err != nil {
+		return fmt.Errorf("value does not fit element %s: %w", target.Descriptor().Name(), err)
+	}
+
+	return nil
+}
+
+func removeListItem(list protoreflect.List, index int) {
+	for i := index; i < list.Len()-1; i++ {
+		list.Set(i, list.Get(i+1))
+	}
+	list.Truncate(list.Len() - 1)
+}
+
+func insertListItem(list protoreflect.List, index int, item protoreflect.Value) {
+	list.Append(item)
+	for i := list.Len() - 1; i > index; i-- {
+		list.Set(i, list.Get(i-1))
+	}
+	list.Set(index, item)
+}
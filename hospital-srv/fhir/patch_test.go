@@ -0,0 +1,306 @@
+package fhir
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	paramspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const patchEncounter = `{
+	"id": {"value": "e1"},
+	"status": {"value": "IN_PROGRESS"},
+	"subject": {"patientId": {"value": "p1"}},
+	"participant": [
+		{"individual": {"practitionerId": {"value": "d1"}}},
+		{"individual": {"practitionerId": {"value": "d2"}}}
+	]
+}`
+
+func parseEncounter(t *testing.T, data string) *encpb.Encounter {
+	t.Helper()
+	var encounter encpb.Encounter
+	if err := protojson.Unmarshal([]byte(data), &encounter); err != nil {
+		t.Fatalf("invalid encounter %s: %v", data, err)
+	}
+	return &encounter
+}
+
+// jsonPatchEncounter is patchEncounter in the FHIR JSON form JSON Patch
+// paths address.
+const jsonPatchEncounter = `{"resourceType":"Encounter","id":"e1","status":"in-progress","subject":{"reference":"Patient/p1"},` +
+	`"participant":[{"individual":{"reference":"Practitioner/d1"}},{"individual":{"reference":"Practitioner/d2"}}]}`
+
+func TestApplyJSONPatch(t *testing.T) {
+	participants := func(ids ...string) string {
+		var items []string
+		for _, id := range ids {
+			items = append(items, `{"individual":{"reference":"Practitioner/`+id+`"}}`)
+		}
+		return `"participant":[` + strings.Join(items, ",") + `]`
+	}
+	encounter := func(status string, rest string) string {
+		return `{"resourceType":"Encounter","id":"e1","status":"` + status + `","subject":{"reference":"Patient/p1"},` + rest + `}`
+	}
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "replace a code",
+			patch: `[{"op":"replace","path":"/status","value":"finished"}]`,
+			want:  encounter("finished", participants("d1", "d2")),
+		},
+		{
+			name:  "replace a reference",
+			patch: `[{"op":"replace","path":"/participant/1/individual/reference","value":"Practitioner/d3"}]`,
+			want:  encounter("in-progress", participants("d1", "d3")),
+		},
+		{
+			name:  "add an element",
+			patch: `[{"op":"add","path":"/period","value":{"start":"2024-01-02T10:00:00+03:00"}}]`,
+			want:  encounter("in-progress", participants("d1", "d2")+`,"period":{"start":"2024-01-02T10:00:00+03:00"}`),
+		},
+		{
+			name:  "add to the end of a list",
+			patch: `[{"op":"add","path":"/participant/-","value":{"individual":{"reference":"Practitioner/d3"}}}]`,
+			want:  encounter("in-progress", participants("d1", "d2", "d3")),
+		},
+		{
+			name:  "add keeps decimal precision",
+			patch: `[{"op":"add","path":"/length","value":{"value":1.50,"unit":"h"}},{"op":"test","path":"/length/value","value":1.50}]`,
+			want:  encounter("in-progress", participants("d1", "d2")+`,"length":{"value":1.50,"unit":"h"}`),
+		},
+		{
+			name:  "remove a list item",
+			patch: `[{"op":"remove","path":"/participant/0"}]`,
+			want:  encounter("in-progress", participants("d2")),
+		},
+		{
+			name:  "test then replace",
+			patch: `[{"op":"test","path":"/status","value":"in-progress"},{"op":"replace","path":"/status","value":"finished"}]`,
+			want:  encounter("finished", participants("d1", "d2")),
+		},
+		{
+			name:  "move",
+			patch: `[{"op":"move","from":"/participant/1","path":"/participant/0"}]`,
+			want:  encounter("in-progress", participants("d2", "d1")),
+		},
+		{
+			name:  "copy",
+			patch: `[{"op":"copy","from":"/participant/0","path":"/participant/-"}]`,
+			want:  encounter("in-progress", participants("d1", "d2", "d1")),
+		},
+		{name: "failed test", patch: `[{"op":"test","path":"/status","value":"planned"}]`, wantErr: true},
+		{name: "protojson path", patch: `[{"op":"replace","path":"/status/value","value":"FINISHED"}]`, wantErr: true},
+		{name: "replace a missing element", patch: `[{"op":"replace","path":"/period","value":{}}]`, wantErr: true},
+		{name: "remove out of range", patch: `[{"op":"remove","path":"/participant/5"}]`, wantErr: true},
+		{name: "unknown op", patch: `[{"op":"merge","path":"/status"}]`, wantErr: true},
+		{name: "invalid pointer", patch: `[{"op":"remove","path":"status"}]`, wantErr: true},
+		{name: "unknown status code", patch: `[{"op":"replace","path":"/status","value":"done"}]`, wantErr: true},
+		{name: "result is not an Encounter", patch: `[{"op":"add","path":"/colour","value":"red"}]`, wantErr: true},
+		{name: "resourceType changed", patch: `[{"op":"replace","path":"/resourceType","value":"Patient"}]`, wantErr: true},
+		{name: "not a patch document", patch: `{"op":"remove"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := parseFHIRJSON([]byte(jsonPatchEncounter))
+			if err != nil {
+				t.Fatal(err)
+			}
+			encounter := resource.Interface().(*encpb.Encounter)
+
+			err = applyPatch(contentTypeJSONPatch, encounter, "Encounter", []byte(tt.patch))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyPatch() = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPatch() = %v", err)
+			}
+
+			got, err := marshalFHIRJSON(encounter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("patched = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func patchOperation(opType string, path string, parts ...*paramspb.Parameters_Parameter) *paramspb.Parameters_Parameter {
+	return &paramspb.Parameters_Parameter{
+		Name: &dtpb.String{Value: "operation"},
+		Part: append([]*paramspb.Parameters_Parameter{
+			patchPart("type", &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_Code{Code: &dtpb.Code{Value: opType}}}),
+			patchPart("path", &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_StringValue{StringValue: &dtpb.String{Value: path}}}),
+		}, parts...),
+	}
+}
+
+func patchPart(name string, value *paramspb.Parameters_Parameter_ValueX) *paramspb.Parameters_Parameter {
+	return &paramspb.Parameters_Parameter{Name: &dtpb.String{Value: name}, Value: value}
+}
+
+func patchName(name string) *paramspb.Parameters_Parameter {
+	return patchPart("name", &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_StringValue{StringValue: &dtpb.String{Value: name}}})
+}
+
+func patchIndex(name string, index int32) *paramspb.Parameters_Parameter {
+	return patchPart(name, &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_Integer{Integer: &dtpb.Integer{Value: index}}})
+}
+
+func patchCode(code string) *paramspb.Parameters_Parameter {
+	return patchPart("value", &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_Code{Code: &dtpb.Code{Value: code}}})
+}
+
+func patchReference(reference string) *paramspb.Parameters_Parameter {
+	return patchPart("value", &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_Reference{Reference: &dtpb.Reference{
+		Reference: &dtpb.Reference_Uri{Uri: &dtpb.String{Value: reference}},
+	}}})
+}
+
+func TestApplyFHIRPathPatch(t *testing.T) {
+	participant := func(id string) string {
+		return `{"individual":{"reference":{"value":"Practitioner/` + id + `"}}}`
+	}
+
+	tests := []struct {
+		name       string
+		operations []*paramspb.Parameters_Parameter
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "replace a code",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("replace", "Encounter.status", patchCode("finished"))},
+			want:       `{"id":{"value":"e1"},"status":{"value":"FINISHED"},"subject":{"patientId":{"value":"p1"}},"participant":[{"individual":{"practitionerId":{"value":"d1"}}},{"individual":{"practitionerId":{"value":"d2"}}}]}`,
+		},
+		{
+			name:       "replace a list item",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("replace", "Encounter.participant[1].individual", patchReference("Practitioner/d3"))},
+			want:       `{"id":{"value":"e1"},"status":{"value":"IN_PROGRESS"},"subject":{"patientId":{"value":"p1"}},"participant":[{"individual":{"practitionerId":{"value":"d1"}}},` + participant("d3") + `]}`,
+		},
+		{
+			name:       "add to the root",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("add", "Encounter", patchName("partOf"), patchReference("Encounter/e0"))},
+			want:       `{"id":{"value":"e1"},"status":{"value":"IN_PROGRESS"},"subject":{"patientId":{"value":"p1"}},"participant":[{"individual":{"practitionerId":{"value":"d1"}}},{"individual":{"practitionerId":{"value":"d2"}}}],"partOf":{"reference":{"value":"Encounter/e0"}}}`,
+		},
+		{
+			name:       "add to an element",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("add", "Encounter.participant[0]", patchName("period"), patchPart("value", &paramspb.Parameters_Parameter_ValueX{Choice: &paramspb.Parameters_Parameter_ValueX_Period{Period: &dtpb.Period{}}}))},
+			want:       `{"id":{"value":"e1"},"status":{"value":"IN_PROGRESS"},"subject":{"patientId":{"value":"p1"}},"participant":[{"individual":{"practitionerId":{"value":"d1"}},"period":{}},{"individual":{"practitionerId":{"value":"d2"}}}]}`,
+		},
+		{
+			name: "insert",
+			operations: []*paramspb.Parameters_Parameter{
+				patchOperation("insert", "Encounter.reasonReference", patchIndex("index", 0), patchReference("Condition/c1")),
+				patchOperation("insert", "Encounter.reasonReference", patchIndex("index", 0), patchReference("Condition/c2")),
+			},
+			want: `{"id":{"value":"e1"},"status":{"value":"IN_PROGRESS"},"subject":{"patientId":{"value":"p1"}},"participant":[{"individual":{"practitionerId":{"value":"d1"}}},{"individual":{"practitionerId":{"value":"d2"}}}],"reasonReference":[{"reference":{"value":"Condition/c2"}},{"reference":{"value":"Condition/c1"}}]}`,
+		},
+		{
+			name:       "insert out of range",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("insert", "Encounter.reasonReference", patchIndex("index", 2), patchReference("Condition/c1"))},
+			wantErr:    true,
+		},
+		{
+			name:       "insert without a value",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("insert", "Encounter.reasonReference", patchIndex("index", 0), patchPart("value", &paramspb.Parameters_Parameter_ValueX{}))},
+			wantErr:    true,
+		},
+		{
+			name:       "delete a list item",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("delete", "Encounter.participant[0]")},
+			want:       `{"id":{"value":"e1"},"status":{"value":"IN_PROGRESS"},"subject":{"patientId":{"value":"p1"}},"participant":[{"individual":{"practitionerId":{"value":"d2"}}}]}`,
+		},
+		{
+			name:       "delete a missing element",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("delete", "Encounter.period")},
+			want:       patchEncounter,
+		},
+		{
+			name:       "move",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("move", "Encounter.participant", patchIndex("source", 1), patchIndex("destination", 0))},
+			want:       `{"id":{"value":"e1"},"status":{"value":"IN_PROGRESS"},"subject":{"patientId":{"value":"p1"}},"participant":[{"individual":{"practitionerId":{"value":"d2"}}},{"individual":{"practitionerId":{"value":"d1"}}}]}`,
+		},
+		{
+			name:       "replace a missing element",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("replace", "Encounter.period", patchCode("x"))},
+			wantErr:    true,
+		},
+		{
+			name:       "path of another resource type",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("replace", "Patient.gender", patchCode("male"))},
+			wantErr:    true,
+		},
+		{
+			name:       "unknown element",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("replace", "Encounter.colour", patchCode("red"))},
+			wantErr:    true,
+		},
+		{
+			name:       "unknown status code",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("replace", "Encounter.status", patchCode("done"))},
+			wantErr:    true,
+		},
+		{
+			name:       "move out of range",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("move", "Encounter.participant", patchIndex("source", 3), patchIndex("destination", 0))},
+			wantErr:    true,
+		},
+		{
+			name:       "unsupported type",
+			operations: []*paramspb.Parameters_Parameter{patchOperation("merge", "Encounter.status", patchCode("finished"))},
+			wantErr:    true,
+		},
+		{
+			name:    "no operations",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := protojson.Marshal(&paramspb.Parameters{Parameter: tt.operations})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encounter := parseEncounter(t, patchEncounter)
+			err = applyPatch(contentTypeFHIRJSON, encounter, "Encounter", body)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyPatch() = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPatch() = %v", err)
+			}
+			if want := parseEncounter(t, tt.want); !proto.Equal(encounter, want) {
+				t.Errorf("patched = %s, want %s", protojson.Format(encounter), tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPatchUnsupportedFormat(t *testing.T) {
+	encounter := parseEncounter(t, patchEncounter)
+	if err := applyPatch("text/plain", encounter, "Encounter", []byte(`status=finished`)); !errors.Is(err, errUnsupportedPatchFormat) {
+		t.Errorf("applyPatch() = %v, want %v", err, errUnsupportedPatchFormat)
+	}
+}
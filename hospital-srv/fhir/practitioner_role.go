@@ -0,0 +1,42 @@
+package fhir
+
+import (
+	"fmt"
+	"hospital-srv/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	prrolepb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_role_go_proto"
+)
+
+func (s *FHIRServer) practitionerRoles() resourceHandler[models.PractitionerRole, models.PractitionerRoleFilter, *prrolepb.PractitionerRole] {
+	return resourceHandler[models.PractitionerRole, models.PractitionerRoleFilter, *prrolepb.PractitionerRole]{
+		resourceType: "PractitionerRole",
+		toFHIR:       PractitionerRoleToFHIR,
+		fromFHIR:     FHIRToPractitionerRole,
+		parseSearch:  parsePractitionerRoleSearch,
+		meta: func(role models.PractitionerRole) (string, int, time.Time) {
+			return role.ID, role.VersionID, role.UpdatedAt
+		},
+		describe: func(role models.PractitionerRole) string {
+			return fmt.Sprintf("(%s) for practitioner %s", role.Role, role.PractitionerID)
+		},
+		create:  s.practitionerService.CreatePractitionerRole,
+		get:     s.practitionerService.GetPractitionerRoleByID,
+		search:  s.practitionerService.SearchPractitionerRoles,
+		update:  s.practitionerService.UpdatePractitionerRole,
+		history: s.practitionerService.GetPractitionerRoleHistory,
+		version: s.practitionerService.GetPractitionerRoleVersion,
+	}
+}
+
+func (s *FHIRServer) CreatePractitionerRole(c *gin.Context) { s.practitionerRoles().handleCreate(c) }
+func (s *FHIRServer) GetPractitionerRoles(c *gin.Context)   { s.practitionerRoles().handleSearch(c) }
+func (s *FHIRServer) GetPractitionerRole(c *gin.Context)    { s.practitionerRoles().handleRead(c) }
+func (s *FHIRServer) UpdatePractitionerRole(c *gin.Context) { s.practitionerRoles().handleUpdate(c) }
+func (s *FHIRServer) GetPractitionerRoleHistory(c *gin.Context) {
+	s.practitionerRoles().handleHistory(c)
+}
+func (s *FHIRServer) GetPractitionerRoleVersion(c *gin.Context) {
+	s.practitionerRoles().handleVersion(c)
+}
@@ -0,0 +1,214 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// resourceHandler serves the create, search, read, update and history
+// interactions of a resource type that a service keeps versioned. M is the
+// model, F its search filter and R the FHIR resource it maps to; the
+// funcs connect them to the mappers and the service.
+type resourceHandler[M any, F any, R proto.Message] struct {
+	resourceType string
+
+	toFHIR      func(M) R
+	fromFHIR    func(R) (M, error)
+	parseSearch func(url.Values) (F, error)
+	// meta returns the id, version and last update time of a model.
+	meta func(M) (string, int, time.Time)
+	// describe summarises a created model for the log.
+	describe func(M) string
+
+	create  func(M) (string, error)
+	get     func(string) (*M, error)
+	search  func(F) ([]M, error)
+	update  func(M, int) error
+	history func(string) ([]M, error)
+	version func(string, int) (*M, error)
+}
+
+func (h resourceHandler[M, F, R]) versioned(m M) versionedResource {
+	_, versionID, updatedAt := h.meta(m)
+	return versionedResource{resource: h.toFHIR(m), versionID: versionID, updatedAt: updatedAt}
+}
+
+// readResource decodes the request body into a new R.
+func (h resourceHandler[M, F, R]) readResource(c *gin.Context, logPrefix string) (R, bool) {
+	var resource R
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return resource, false
+	}
+
+	log.Printf("%s: %s", logPrefix, strings.ReplaceAll(string(body), "\n", " "))
+
+	resource = resource.ProtoReflect().New().Interface().(R)
+	if err := protojson.Unmarshal(body, resource); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid FHIR %s format", h.resourceType)})
+		return resource, false
+	}
+	return resource, true
+}
+
+func (h resourceHandler[M, F, R]) handleCreate(c *gin.Context) {
+	resource, ok := h.readResource(c, "Received FHIR "+h.resourceType)
+	if !ok {
+		return
+	}
+
+	model, err := h.fromFHIR(resource)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := h.create(model)
+	if err != nil {
+		writeUpdateError(c, h.resourceType, err)
+		return
+	}
+
+	created, err := h.get(id)
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+
+	log.Printf("Created FHIR %s %s %s", h.resourceType, id, h.describe(*created))
+	v := h.versioned(*created)
+	setVersionHeaders(c, v.versionID, v.updatedAt)
+	writeCreated(c, h.resourceType, id, v.resource)
+}
+
+func (h resourceHandler[M, F, R]) handleSearch(c *gin.Context) {
+	filter, err := h.parseSearch(c.Request.URL.Query())
+	if errors.Is(err, errNoMatch) {
+		newSearchset().write(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := h.search(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle := newSearchset()
+	for _, m := range found {
+		id, _, _ := h.meta(m)
+		bundle.addMatch(h.resourceType, id, h.toFHIR(m))
+	}
+	bundle.write(c)
+}
+
+func (h resourceHandler[M, F, R]) handleRead(c *gin.Context) {
+	m, err := h.get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": h.resourceType + " not found"})
+		return
+	}
+
+	writeVersionedResource(c, h.versioned(*m))
+}
+
+func (h resourceHandler[M, F, R]) handleUpdate(c *gin.Context) {
+	id := c.Param("id")
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resource, ok := h.readResource(c, "Received FHIR "+h.resourceType+" update")
+	if !ok {
+		return
+	}
+
+	if !setResourceID(resource, id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Resource id does not match URL"})
+		return
+	}
+
+	model, err := h.fromFHIR(resource)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.update(model, expectedVersion); err != nil {
+		writeUpdateError(c, h.resourceType, err)
+		return
+	}
+
+	updated, err := h.get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeVersionedResource(c, h.versioned(*updated))
+}
+
+func (h resourceHandler[M, F, R]) handleHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	found, err := h.history(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": h.resourceType + " not found"})
+		return
+	}
+
+	versions := make([]versionedResource, 0, len(found))
+	for _, m := range found {
+		versions = append(versions, h.versioned(m))
+	}
+
+	writeHistoryBundle(c, h.resourceType, id, versions)
+}
+
+func (h resourceHandler[M, F, R]) handleVersion(c *gin.Context) {
+	versionID, err := parseVersionParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := h.version(c.Param("id"), versionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": h.resourceType + " version not found"})
+		return
+	}
+
+	writeVersionedResource(c, h.versioned(*m))
+}
+
+// setResourceID gives resource the id from the URL of an update. It
+// reports false when the resource already carries a different id.
+func setResourceID(resource proto.Message, id string) bool {
+	m := resource.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName("id")
+	if m.Has(fd) {
+		return m.Get(fd).Message().Interface().(*dtpb.Id).GetValue() == id
+	}
+	m.Set(fd, protoreflect.ValueOfMessage((&dtpb.Id{Value: id}).ProtoReflect()))
+	return true
+}
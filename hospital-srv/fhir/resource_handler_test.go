@@ -0,0 +1,201 @@
+package fhir
+
+import (
+	"database/sql"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	condpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/condition_go_proto"
+)
+
+const conditionID = "3f1d2c4b-6a8e-4f0a-b2c4-d6e8f0a2b401"
+
+// conditionStore keeps conditions in memory in place of the service.
+type conditionStore struct {
+	conditions map[string]models.Condition
+	updated    *models.Condition
+	version    int
+}
+
+func (s *conditionStore) get(id string) (*models.Condition, error) {
+	condition, ok := s.conditions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &condition, nil
+}
+
+func (s *conditionStore) update(condition models.Condition, expectedVersion int) error {
+	current, ok := s.conditions[condition.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if expectedVersion != 0 && expectedVersion != current.VersionID {
+		return repository.ErrVersionConflict
+	}
+	s.version = expectedVersion
+	condition.VersionID = current.VersionID + 1
+	s.conditions[condition.ID] = condition
+	s.updated = &condition
+	return nil
+}
+
+func (s *conditionStore) handler() resourceHandler[models.Condition, models.ConditionFilter, *condpb.Condition] {
+	h := (&FHIRServer{}).conditions()
+	h.create = func(condition models.Condition) (string, error) {
+		condition.ID = "new"
+		condition.VersionID = 1
+		s.conditions[condition.ID] = condition
+		return condition.ID, nil
+	}
+	h.get = s.get
+	h.update = s.update
+	return h
+}
+
+func serve(handler gin.HandlerFunc, method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Handle(method, "/Condition", handler)
+	router.Handle(method, "/Condition/:id", handler)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// conditionBody is a Condition of the patient coded with the given ICD-10
+// code, with extra fields such as an id prepended.
+func conditionBody(extra string, code string) string {
+	return `{` + extra + `"subject":{"uri":{"value":"Patient/` + patientID + `"}},` +
+		`"code":{"coding":[{"system":{"value":"` + systemICD10 + `"},"code":{"value":"` + code + `"}}]}}`
+}
+
+func TestResourceHandlerUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		ifMatch     string
+		wantStatus  int
+		wantVersion int
+	}{
+		{
+			name:       "id taken from the URL",
+			target:     "/Condition/" + conditionID,
+			body:       conditionBody("", "J06.9"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "matching id",
+			target:     "/Condition/" + conditionID,
+			body:       conditionBody(`"id":{"value":"`+conditionID+`"},`, "J06.9"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "id does not match URL",
+			target:     "/Condition/" + conditionID,
+			body:       conditionBody(`"id":{"value":"c2"},`, "J06.9"),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid body",
+			target:     "/Condition/" + conditionID,
+			body:       `{"code":"J06.9"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "rejected by the mapper",
+			target:     "/Condition/" + conditionID,
+			body:       conditionBody("", "not a code"),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "current version",
+			target:      "/Condition/" + conditionID,
+			body:        conditionBody("", "J06.9"),
+			ifMatch:     `W/"3"`,
+			wantStatus:  http.StatusOK,
+			wantVersion: 3,
+		},
+		{
+			name:       "stale version",
+			target:     "/Condition/" + conditionID,
+			body:       conditionBody("", "J06.9"),
+			ifMatch:    `W/"2"`,
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "unknown condition",
+			target:     "/Condition/c9",
+			body:       conditionBody("", "J06.9"),
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &conditionStore{conditions: map[string]models.Condition{
+				conditionID: {
+					ID:                 conditionID,
+					PatientID:          patientID,
+					Code:               "J20.9",
+					ClinicalStatus:     models.ConditionClinicalStatusActive,
+					VerificationStatus: models.ConditionVerificationProvisional,
+					VersionID:          3,
+					UpdatedAt:          time.Now(),
+				},
+			}}
+			header := http.Header{}
+			if tt.ifMatch != "" {
+				header.Set("If-Match", tt.ifMatch)
+			}
+
+			w := serve(store.handler().handleUpdate, http.MethodPut, tt.target, tt.body, header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if store.updated == nil || store.updated.ID != conditionID || store.updated.Code != "J06.9" {
+				t.Errorf("updated = %+v, want %s coded J06.9", store.updated, conditionID)
+			}
+			if store.version != tt.wantVersion {
+				t.Errorf("expected version = %d, want %d", store.version, tt.wantVersion)
+			}
+			if got := w.Header().Get("ETag"); got != `W/"4"` {
+				t.Errorf("ETag = %q, want %q", got, `W/"4"`)
+			}
+		})
+	}
+}
+
+func TestResourceHandlerCreate(t *testing.T) {
+	store := &conditionStore{conditions: map[string]models.Condition{}}
+
+	w := serve(store.handler().handleCreate, http.MethodPost, "/Condition", conditionBody("", "j06.9"), nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	if got := w.Header().Get("Location"); got != "Condition/new" {
+		t.Errorf("Location = %q, want %q", got, "Condition/new")
+	}
+	if got := w.Header().Get("ETag"); got != `W/"1"` {
+		t.Errorf("ETag = %q, want %q", got, `W/"1"`)
+	}
+	if got := store.conditions["new"]; got.Code != "J06.9" || got.VerificationStatus != models.ConditionVerificationProvisional {
+		t.Errorf("created = %+v, want a provisional J06.9", got)
+	}
+}
@@ -0,0 +1,331 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/repository"
+	"hospital-srv/services"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	apptpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/appointment_go_proto"
+	schedpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/schedule_go_proto"
+	slotpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/slot_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// schedulingErrorStatus maps scheduling service errors to HTTP statuses.
+func schedulingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSlotUnavailable), errors.Is(err, repository.ErrSlotOverlap):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidSlot):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidAppointmentTransition), errors.Is(err, services.ErrReferenceNotFound), errors.Is(err, services.ErrInactivePractitioner):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeCreated(c *gin.Context, resourceType string, id string, resource proto.Message) {
+	resourceMap, err := protoToMap(resource)
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("%s/%s", resourceType, id))
+	c.JSON(http.StatusCreated, resourceMap)
+}
+
+func writeResource(c *gin.Context, resource proto.Message) {
+	resourceMap, err := protoToMap(resource)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert resource"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resourceMap)
+}
+
+func (s *FHIRServer) CreateSchedule(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	log.Printf("Received FHIR Schedule: %s", strings.ReplaceAll(string(body), "\n", " "))
+
+	var fhirSchedule schedpb.Schedule
+	if err := protojson.Unmarshal(body, &fhirSchedule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Schedule format"})
+		return
+	}
+
+	schedule, err := FHIRToSchedule(&fhirSchedule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := s.schedulingService.CreateSchedule(schedule)
+	if err != nil {
+		c.JSON(schedulingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.schedulingService.GetScheduleByID(id)
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+
+	log.Printf("Created FHIR Schedule %s for practitioner %s", id, created.PractitionerID)
+	writeCreated(c, "Schedule", id, ScheduleToFHIR(*created))
+}
+
+func (s *FHIRServer) GetSchedules(c *gin.Context) {
+	filter, err := parseScheduleSearch(c.Request.URL.Query())
+	if errors.Is(err, errNoMatch) {
+		newSearchset().write(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedules, err := s.schedulingService.SearchSchedules(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle := newSearchset()
+	for _, schedule := range schedules {
+		bundle.addMatch("Schedule", schedule.ID, ScheduleToFHIR(schedule))
+	}
+	bundle.write(c)
+}
+
+func (s *FHIRServer) GetSchedule(c *gin.Context) {
+	schedule, err := s.schedulingService.GetScheduleByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	writeResource(c, ScheduleToFHIR(*schedule))
+}
+
+func (s *FHIRServer) CreateSlot(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var fhirSlot slotpb.Slot
+	if err := protojson.Unmarshal(body, &fhirSlot); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Slot format"})
+		return
+	}
+
+	slot, err := FHIRToSlot(&fhirSlot)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := s.schedulingService.CreateSlot(slot)
+	if err != nil {
+		c.JSON(schedulingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.schedulingService.GetSlotByID(id)
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+
+	writeCreated(c, "Slot", id, SlotToFHIR(*created))
+}
+
+func (s *FHIRServer) GetSlots(c *gin.Context) {
+	filter, err := parseSlotSearch(c.Request.URL.Query())
+	if errors.Is(err, errNoMatch) {
+		newSearchset().write(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slots, err := s.schedulingService.SearchSlots(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle := newSearchset()
+	for _, slot := range slots {
+		bundle.addMatch("Slot", slot.ID, SlotToFHIR(slot))
+	}
+	bundle.write(c)
+}
+
+func (s *FHIRServer) GetSlot(c *gin.Context) {
+	slot, err := s.schedulingService.GetSlotByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slot not found"})
+		return
+	}
+
+	writeResource(c, SlotToFHIR(*slot))
+}
+
+// CreateAppointment books the referenced slot for the patient participant.
+// A slot that is already taken yields 409 Conflict.
+func (s *FHIRServer) CreateAppointment(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	log.Printf("Received FHIR Appointment: %s", strings.ReplaceAll(string(body), "\n", " "))
+
+	var fhirAppointment apptpb.Appointment
+	if err := protojson.Unmarshal(body, &fhirAppointment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Appointment format"})
+		return
+	}
+
+	appointment, err := FHIRToAppointment(&fhirAppointment)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if appointment.Status != "booked" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New appointments must have status booked"})
+		return
+	}
+
+	id, err := s.schedulingService.BookAppointment(appointment)
+	if err != nil {
+		c.JSON(schedulingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.schedulingService.GetAppointmentByID(id)
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+
+	log.Printf("Booked FHIR Appointment %s: slot=%s, patient=%s", id, created.SlotID, created.PatientID)
+	writeCreated(c, "Appointment", id, AppointmentToFHIR(*created))
+}
+
+func (s *FHIRServer) GetAppointments(c *gin.Context) {
+	filter, err := parseAppointmentSearch(c.Request.URL.Query())
+	if errors.Is(err, errNoMatch) {
+		newSearchset().write(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	appointments, err := s.schedulingService.SearchAppointments(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle := newSearchset()
+	for _, appointment := range appointments {
+		bundle.addMatch("Appointment", appointment.ID, AppointmentToFHIR(appointment))
+	}
+	bundle.write(c)
+}
+
+func (s *FHIRServer) GetAppointment(c *gin.Context) {
+	appointment, err := s.schedulingService.GetAppointmentByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	writeResource(c, AppointmentToFHIR(*appointment))
+}
+
+// PatchAppointment applies a JSON Patch or FHIRPath Patch to an appointment.
+// Only the status may change; moving to arrived creates the encounter, which
+// is returned in the Encounter-Location header.
+func (s *FHIRServer) PatchAppointment(c *gin.Context) {
+	id := c.Param("id")
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	current, err := s.schedulingService.GetAppointmentByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	fhirAppointment := AppointmentToFHIR(*current)
+	if err := applyPatch(c.ContentType(), fhirAppointment, "Appointment", body); err != nil {
+		if errors.Is(err, errUnsupportedPatchFormat) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	patched, err := FHIRToAppointment(fhirAppointment)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	unchanged := AppointmentToFHIR(*current)
+	unchanged.Status = fhirAppointment.Status
+	if !proto.Equal(fhirAppointment, unchanged) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Only the appointment status can be changed"})
+		return
+	}
+
+	encounterID, err := s.schedulingService.UpdateAppointmentStatus(id, patched.Status, requestActor(c))
+	if err != nil {
+		c.JSON(schedulingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := s.schedulingService.GetAppointmentByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if encounterID != "" {
+		log.Printf("Patient arrived for appointment %s, created encounter %s", id, encounterID)
+		c.Header("Encounter-Location", fmt.Sprintf("Encounter/%s", encounterID))
+	}
+
+	writeResource(c, AppointmentToFHIR(*updated))
+}
@@ -0,0 +1,262 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"hospital-srv/services"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	apptpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/appointment_go_proto"
+	schedpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/schedule_go_proto"
+	slotpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/slot_go_proto"
+)
+
+const (
+	scheduleID      = "3d0c5e7a-8b1f-4c2d-9e3a-4b5c6d7e8f01"
+	otherScheduleID = "3d0c5e7a-8b1f-4c2d-9e3a-4b5c6d7e8f02"
+)
+
+func TestScheduleRoundTrip(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	comment := "Outpatient visits"
+	schedule := models.Schedule{
+		ID:             scheduleID,
+		PractitionerID: practitionerID,
+		Active:         true,
+		PlanningStart:  &start,
+		PlanningEnd:    &end,
+		Comment:        &comment,
+	}
+
+	got, err := FHIRToSchedule(ScheduleToFHIR(schedule))
+	if err != nil {
+		t.Fatalf("FHIRToSchedule() = %v", err)
+	}
+	if !reflect.DeepEqual(got, schedule) {
+		t.Errorf("round trip = %+v, want %+v", got, schedule)
+	}
+}
+
+func TestFHIRToSchedule(t *testing.T) {
+	got, err := FHIRToSchedule(&schedpb.Schedule{Actor: []*dtpb.Reference{
+		reference("Location", "f4a1b2c3-d4e5-4f60-8a9b-0c1d2e3f4a01"),
+		reference("Practitioner", practitionerID),
+	}})
+	if err != nil {
+		t.Fatalf("FHIRToSchedule() = %v", err)
+	}
+	if got.PractitionerID != practitionerID || !got.Active {
+		t.Errorf("FHIRToSchedule() = %+v, want an active schedule of %s", got, practitionerID)
+	}
+
+	if _, err := FHIRToSchedule(&schedpb.Schedule{Actor: []*dtpb.Reference{reference("Location", "f4a1b2c3-d4e5-4f60-8a9b-0c1d2e3f4a01")}}); err == nil {
+		t.Errorf("FHIRToSchedule() without a Practitioner actor = nil, want an error")
+	}
+}
+
+func TestSlotRoundTrip(t *testing.T) {
+	comment := "First visit"
+	slot := models.Slot{
+		ID:         "s1",
+		ScheduleID: scheduleID,
+		Status:     models.SlotStatusBusyUnavailable,
+		StartTime:  time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC),
+		EndTime:    time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC),
+		Comment:    &comment,
+	}
+
+	got, err := FHIRToSlot(SlotToFHIR(slot))
+	if err != nil {
+		t.Fatalf("FHIRToSlot() = %v", err)
+	}
+	if !reflect.DeepEqual(got, slot) {
+		t.Errorf("round trip = %+v, want %+v", got, slot)
+	}
+}
+
+func TestFHIRToSlotErrors(t *testing.T) {
+	start := toInstant(time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC))
+	end := toInstant(time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC))
+
+	tests := []struct {
+		name string
+		slot *slotpb.Slot
+	}{
+		{name: "no schedule", slot: &slotpb.Slot{Start: start, End: end}},
+		{name: "schedule of another type", slot: &slotpb.Slot{Schedule: reference("Practitioner", practitionerID), Start: start, End: end}},
+		{name: "no end", slot: &slotpb.Slot{Schedule: reference("Schedule", scheduleID), Start: start}},
+		{
+			name: "unsupported status",
+			slot: &slotpb.Slot{
+				Schedule: reference("Schedule", scheduleID),
+				Status:   &slotpb.Slot_StatusCode{Value: codespb.SlotStatusCode_ENTERED_IN_ERROR},
+				Start:    start,
+				End:      end,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if _, err := FHIRToSlot(tt.slot); err == nil {
+			t.Errorf("%s: FHIRToSlot() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestFHIRToAppointment(t *testing.T) {
+	description := "Follow-up"
+	appointment := models.Appointment{
+		ID:             "a1",
+		SlotID:         "s1",
+		PatientID:      patientID,
+		PractitionerID: practitionerID,
+		Status:         models.AppointmentStatusArrived,
+		StartTime:      time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC),
+		EndTime:        time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC),
+		Description:    &description,
+	}
+
+	got, err := FHIRToAppointment(AppointmentToFHIR(appointment))
+	if err != nil {
+		t.Fatalf("FHIRToAppointment() = %v", err)
+	}
+
+	want := models.Appointment{
+		ID:          "a1",
+		SlotID:      "s1",
+		PatientID:   patientID,
+		Status:      models.AppointmentStatusArrived,
+		Description: &description,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FHIRToAppointment() = %+v, want %+v", got, want)
+	}
+
+	patient := appointmentParticipant("Patient", patientID)
+	tests := []struct {
+		name        string
+		appointment *apptpb.Appointment
+	}{
+		{name: "no slot", appointment: &apptpb.Appointment{Participant: []*apptpb.Appointment_Participant{patient}}},
+		{
+			name: "two slots",
+			appointment: &apptpb.Appointment{
+				Slot:        []*dtpb.Reference{reference("Slot", "s1"), reference("Slot", "s2")},
+				Participant: []*apptpb.Appointment_Participant{patient},
+			},
+		},
+		{
+			name:        "no patient",
+			appointment: &apptpb.Appointment{Slot: []*dtpb.Reference{reference("Slot", "s1")}},
+		},
+		{
+			name: "unsupported status",
+			appointment: &apptpb.Appointment{
+				Status:      &apptpb.Appointment_StatusCode{Value: codespb.AppointmentStatusCode_WAITLIST},
+				Slot:        []*dtpb.Reference{reference("Slot", "s1")},
+				Participant: []*apptpb.Appointment_Participant{patient},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if _, err := FHIRToAppointment(tt.appointment); err == nil {
+			t.Errorf("%s: FHIRToAppointment() = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestParseSlotSearch(t *testing.T) {
+	from := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query   string
+		want    models.SlotFilter
+		wantErr error
+	}{
+		{
+			query: "schedule=Schedule/" + scheduleID + "," + otherScheduleID + ",Schedule/x",
+			want:  models.SlotFilter{ScheduleIDs: []string{scheduleID, otherScheduleID}},
+		},
+		{
+			query: "schedule.actor=Practitioner/" + practitionerID + "&status=free&start=ge2024-03-10",
+			want:  models.SlotFilter{PractitionerID: practitionerID, Status: models.SlotStatusFree, StartFrom: &from},
+		},
+		{query: "schedule=Schedule/x", wantErr: errNoMatch},
+		{query: "schedule.actor=Practitioner/x", wantErr: errNoMatch},
+		{query: "status=taken", wantErr: errors.New("unknown slot status")},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := parseSlotSearch(query)
+		if tt.wantErr != nil {
+			if err == nil || (errors.Is(tt.wantErr, errNoMatch) && !errors.Is(err, errNoMatch)) {
+				t.Errorf("parseSlotSearch(%q) = %v, want %v", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSlotSearch(%q) = %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSlotSearch(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleAndAppointmentSearch(t *testing.T) {
+	active := false
+	schedule, err := parseScheduleSearch(url.Values{"actor": {"Practitioner/" + practitionerID}, "active": {"false"}})
+	if err != nil || schedule.PractitionerID != practitionerID || schedule.Active == nil || *schedule.Active != active {
+		t.Errorf("parseScheduleSearch() = %+v, %v", schedule, err)
+	}
+	if _, err := parseScheduleSearch(url.Values{"active": {"sometimes"}}); err == nil {
+		t.Errorf("parseScheduleSearch() of an invalid active value = nil, want an error")
+	}
+
+	appointment, err := parseAppointmentSearch(url.Values{"patient": {patientID}, "status": {"noshow"}})
+	if err != nil || appointment.PatientID != patientID || appointment.Status != models.AppointmentStatusNoShow {
+		t.Errorf("parseAppointmentSearch() = %+v, %v", appointment, err)
+	}
+	if _, err := parseAppointmentSearch(url.Values{"status": {"late"}}); err == nil {
+		t.Errorf("parseAppointmentSearch() of an unknown status = nil, want an error")
+	}
+	if _, err := parseAppointmentSearch(url.Values{"practitioner": {"d1"}}); !errors.Is(err, errNoMatch) {
+		t.Errorf("parseAppointmentSearch() of a malformed practitioner = %v, want %v", err, errNoMatch)
+	}
+}
+
+func TestSchedulingErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{services.ErrSlotUnavailable, http.StatusConflict},
+		{fmt.Errorf("create slot: %w", repository.ErrSlotOverlap), http.StatusConflict},
+		{fmt.Errorf("%w: end must be after start", services.ErrInvalidSlot), http.StatusBadRequest},
+		{fmt.Errorf("%w: booked to fulfilled", services.ErrInvalidAppointmentTransition), http.StatusUnprocessableEntity},
+		{fmt.Errorf("%w: Patient/p1", services.ErrReferenceNotFound), http.StatusUnprocessableEntity},
+		{errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := schedulingErrorStatus(tt.err); got != tt.want {
+			t.Errorf("schedulingErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,728 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	"google.golang.org/protobuf/proto"
+)
+
+type searchParam struct {
+	name          string
+	paramType     codespb.SearchParamTypeCode_Value
+	documentation string
+}
+
+// searchParams lists the search parameters each resource type supports.
+// It is used both to parse search requests and to build the
+// CapabilityStatement, so a parameter only exists once it is listed here.
+var searchParams = map[string][]searchParam{
+	"Encounter": {
+		{name: "patient", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient present at the encounter"},
+		{name: "subject", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient present at the encounter"},
+		{name: "practitioner", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "Practitioner involved in the encounter"},
+		{name: "participant", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "Practitioner involved in the encounter"},
+		{name: "location", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The location the encounter takes place in"},
+		{name: "status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "planned | arrived | in-progress | finished | cancelled"},
+		{name: "date", paramType: codespb.SearchParamTypeCode_DATE, documentation: "Encounter start time, supports eq, ge, gt, le and lt prefixes"},
+		{name: "identifier", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Business identifier as system|value, |value or value"},
+	},
+	"Patient": {
+		{name: "_id", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Logical id of the patient, comma separated for several"},
+	},
+	"Practitioner": {
+		{name: "active", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Whether the practitioner is still working here"},
+		{name: "identifier", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Business identifier as system|value, |value or value"},
+	},
+	"PractitionerRole": {
+		{name: "practitioner", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The practitioner holding the role"},
+		{name: "organization", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The department the role is in"},
+		{name: "location", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "A location worked at in the role"},
+		{name: "active", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Whether the role is in active use"},
+		{name: "role", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "doctor | nurse | pharmacist | researcher | teacher | ict"},
+		{name: "specialty", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "A specialty practised in the role, by name"},
+	},
+	"Organization": {
+		{name: "name", paramType: codespb.SearchParamTypeCode_STRING, documentation: "Start of the organization's name, ignoring case"},
+		{name: "type", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "prov | dept"},
+		{name: "partof", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The organization this one is part of"},
+		{name: "active", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Whether the organization is in active use"},
+	},
+	"Location": {
+		{name: "name", paramType: codespb.SearchParamTypeCode_STRING, documentation: "Start of the location's name, ignoring case"},
+		{name: "status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "active | suspended | inactive"},
+		{name: "type", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Physical type: bu | wi | lvl | wa | ro | bd"},
+		{name: "organization", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The department managing the location"},
+		{name: "partof", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The location this one is part of"},
+		{name: "operational-status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Bed status: U | O | H | C"},
+	},
+	"Schedule": {
+		{name: "actor", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The practitioner the schedule belongs to"},
+		{name: "active", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Whether the schedule is in active use"},
+	},
+	"Slot": {
+		{name: "schedule", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The schedule the slot belongs to, comma separated for several"},
+		{name: "schedule.actor", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The practitioner whose schedule the slot belongs to"},
+		{name: "status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "free | busy | busy-unavailable"},
+		{name: "start", paramType: codespb.SearchParamTypeCode_DATE, documentation: "Slot start time, supports eq, ge, gt, le and lt prefixes"},
+	},
+	"Appointment": {
+		{name: "patient", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient the appointment is booked for"},
+		{name: "practitioner", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The practitioner the appointment is booked with"},
+		{name: "status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "booked | arrived | fulfilled | cancelled | noshow"},
+		{name: "date", paramType: codespb.SearchParamTypeCode_DATE, documentation: "Appointment start time, supports eq, ge, gt, le and lt prefixes"},
+	},
+	"Condition": {
+		{name: "patient", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient the condition is about"},
+		{name: "subject", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient the condition is about"},
+		{name: "encounter", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The encounter the condition was diagnosed in"},
+		{name: "clinical-status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "active | recurrence | relapse | inactive | remission | resolved"},
+		{name: "verification-status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "provisional | differential | confirmed | refuted | entered-in-error"},
+		{name: "code", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "ICD-10 code, optionally as http://hl7.org/fhir/sid/icd-10|code"},
+	},
+	"Composition": {
+		{name: "patient", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient the note is about"},
+		{name: "subject", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient the note is about"},
+		{name: "encounter", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The encounter the note was written for"},
+		{name: "author", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The practitioner who wrote the note"},
+		{name: "status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "preliminary | final | amended | entered-in-error"},
+	},
+	"MedicationRequest": {
+		{name: "patient", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient the prescription is for"},
+		{name: "subject", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The patient the prescription is for"},
+		{name: "encounter", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The encounter the prescription was made in"},
+		{name: "requester", paramType: codespb.SearchParamTypeCode_REFERENCE, documentation: "The practitioner who prescribed"},
+		{name: "status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "active | stopped | completed"},
+		{name: "code", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "Medication code, optionally as urn:hospital-srv:fhir:CodeSystem/medication|code"},
+	},
+	"Subscription": {
+		{name: "url", paramType: codespb.SearchParamTypeCode_URI, documentation: "The uri that will receive the notifications"},
+		{name: "criteria", paramType: codespb.SearchParamTypeCode_STRING, documentation: "The search rules used to determine when to send a notification"},
+		{name: "status", paramType: codespb.SearchParamTypeCode_TOKEN, documentation: "requested | active | error | off"},
+	},
+}
+
+// searchIncludes and searchRevIncludes list the _include and _revinclude
+// values each resource type accepts.
+var searchIncludes = map[string][]string{
+	"Encounter": {"Encounter:subject", "Encounter:participant"},
+}
+
+var searchRevIncludes = map[string][]string{
+	"Patient": {"Encounter:subject"},
+}
+
+var idPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// errNoMatch signals a search that is well formed but cannot match
+// anything, e.g. a reference to an id that is not a valid UUID.
+var errNoMatch = errors.New("search cannot match any resource")
+
+func referenceID(value string, resourceType string) (string, error) {
+	id := strings.TrimPrefix(value, resourceType+"/")
+	if !idPattern.MatchString(id) {
+		return "", errNoMatch
+	}
+	return id, nil
+}
+
+var encounterSearchStatuses = map[string]string{
+	"planned":     "planned",
+	"arrived":     "arrived",
+	"in-progress": "in-progress",
+	"finished":    "completed",
+	"cancelled":   "cancelled",
+}
+
+func parseEncounterSearch(query url.Values) (models.EncounterFilter, error) {
+	var filter models.EncounterFilter
+	var err error
+
+	if value := firstQuery(query, "patient", "subject"); value != "" {
+		if filter.PatientID, err = referenceID(value, "Patient"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := firstQuery(query, "practitioner", "participant"); value != "" {
+		if filter.PractitionerID, err = referenceID(value, "Practitioner"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("location"); value != "" {
+		if filter.LocationID, err = referenceID(value, "Location"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("status"); value != "" {
+		status, ok := encounterSearchStatuses[value]
+		if !ok {
+			return filter, fmt.Errorf("unknown encounter status: %s", value)
+		}
+		filter.Status = status
+	}
+
+	for _, value := range query["date"] {
+		if err := applyDateParam(value, &filter.StartFrom, &filter.StartBefore); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("identifier"); value != "" {
+		if filter.Identifier, err = parseIdentifierParam(value); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+// parseIdentifierParam parses an identifier token: value in any system,
+// system|value, |value for identifiers without a system, or system| for
+// any value in system.
+func parseIdentifierParam(value string) (*models.IdentifierFilter, error) {
+	system, code, found := strings.Cut(value, "|")
+	if !found {
+		return &models.IdentifierFilter{Value: system}, nil
+	}
+	if system == "" && code == "" {
+		return nil, fmt.Errorf("invalid identifier: %s", value)
+	}
+	return &models.IdentifierFilter{System: &system, Value: code}, nil
+}
+
+func firstQuery(query url.Values, names ...string) string {
+	for _, name := range names {
+		if value := query.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// applyDateParam narrows the half-open range [from, before) using a FHIR
+// date search value such as "ge2024-01-01" or "2024-01-01T10:00:00Z".
+func applyDateParam(value string, from **time.Time, before **time.Time) error {
+	prefix := "eq"
+	if len(value) > 2 && value[0] >= 'a' && value[0] <= 'z' {
+		prefix, value = value[:2], value[2:]
+	}
+
+	start, end, err := parseDateRange(value)
+	if err != nil {
+		return err
+	}
+
+	switch prefix {
+	case "eq":
+		*from, *before = &start, &end
+	case "ge":
+		*from = &start
+	case "gt":
+		*from = &end
+	case "le":
+		*before = &end
+	case "lt":
+		*before = &start
+	default:
+		return fmt.Errorf("unsupported date prefix: %s", prefix)
+	}
+
+	return nil
+}
+
+// parseDateRange returns the interval covered by a date value at its own
+// precision, so "2024-01-01" covers the whole day.
+func parseDateRange(value string) (time.Time, time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t.Add(time.Second), nil
+	}
+
+	layouts := []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l.layout, value, time.UTC); err == nil {
+			return t, l.next(t), nil
+		}
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date: %s", value)
+}
+
+func parsePatientSearch(query url.Values) (models.PatientFilter, error) {
+	var filter models.PatientFilter
+
+	if value := query.Get("_id"); value != "" {
+		for _, id := range strings.Split(value, ",") {
+			if !idPattern.MatchString(id) {
+				continue
+			}
+			filter.IDs = append(filter.IDs, id)
+		}
+		if len(filter.IDs) == 0 {
+			return filter, errNoMatch
+		}
+	}
+
+	return filter, nil
+}
+
+// parseIncludes returns the values of the _include or _revinclude parameter
+// name, rejecting any that allowed does not list.
+func parseIncludes(query url.Values, name string, allowed []string) (map[string]bool, error) {
+	includes := make(map[string]bool)
+	for _, value := range query[name] {
+		if !slices.Contains(allowed, value) {
+			return nil, fmt.Errorf("unsupported %s: %s", name, value)
+		}
+		includes[value] = true
+	}
+	return includes, nil
+}
+
+func parseScheduleSearch(query url.Values) (models.ScheduleFilter, error) {
+	var filter models.ScheduleFilter
+	var err error
+
+	if value := query.Get("actor"); value != "" {
+		if filter.PractitionerID, err = referenceID(value, "Practitioner"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid active value: %s", value)
+		}
+		filter.Active = &active
+	}
+
+	return filter, nil
+}
+
+func parseSlotSearch(query url.Values) (models.SlotFilter, error) {
+	var filter models.SlotFilter
+	var err error
+
+	if value := query.Get("schedule"); value != "" {
+		for _, ref := range strings.Split(value, ",") {
+			id, err := referenceID(ref, "Schedule")
+			if err != nil {
+				continue
+			}
+			filter.ScheduleIDs = append(filter.ScheduleIDs, id)
+		}
+		if len(filter.ScheduleIDs) == 0 {
+			return filter, errNoMatch
+		}
+	}
+
+	if value := query.Get("schedule.actor"); value != "" {
+		if filter.PractitionerID, err = referenceID(value, "Practitioner"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("status"); value != "" {
+		if _, ok := slotStatusCodes[value]; !ok {
+			return filter, fmt.Errorf("unknown slot status: %s", value)
+		}
+		filter.Status = value
+	}
+
+	for _, value := range query["start"] {
+		if err := applyDateParam(value, &filter.StartFrom, &filter.StartBefore); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+func parseAppointmentSearch(query url.Values) (models.AppointmentFilter, error) {
+	var filter models.AppointmentFilter
+	var err error
+
+	if value := query.Get("patient"); value != "" {
+		if filter.PatientID, err = referenceID(value, "Patient"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("practitioner"); value != "" {
+		if filter.PractitionerID, err = referenceID(value, "Practitioner"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("status"); value != "" {
+		if _, ok := appointmentStatusCodes[value]; !ok {
+			return filter, fmt.Errorf("unknown appointment status: %s", value)
+		}
+		filter.Status = value
+	}
+
+	for _, value := range query["date"] {
+		if err := applyDateParam(value, &filter.StartFrom, &filter.StartBefore); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+func parseConditionSearch(query url.Values) (models.ConditionFilter, error) {
+	var filter models.ConditionFilter
+	var err error
+
+	if value := firstQuery(query, "patient", "subject"); value != "" {
+		if filter.PatientID, err = referenceID(value, "Patient"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("encounter"); value != "" {
+		if filter.EncounterID, err = referenceID(value, "Encounter"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("clinical-status"); value != "" {
+		if !conditionClinicalStatuses[value] {
+			return filter, fmt.Errorf("unknown condition clinical status: %s", value)
+		}
+		filter.ClinicalStatus = value
+	}
+
+	if value := query.Get("verification-status"); value != "" {
+		if !conditionVerificationStatuses[value] {
+			return filter, fmt.Errorf("unknown condition verification status: %s", value)
+		}
+		filter.VerificationStatus = value
+	}
+
+	if value := query.Get("code"); value != "" {
+		system, code, found := strings.Cut(value, "|")
+		if !found {
+			code = system
+		} else if system != "" && system != systemICD10 {
+			return filter, errNoMatch
+		}
+		filter.Code = strings.ToUpper(code)
+	}
+
+	return filter, nil
+}
+
+func parseCompositionSearch(query url.Values) (models.ClinicalNoteFilter, error) {
+	var filter models.ClinicalNoteFilter
+	var err error
+
+	if value := firstQuery(query, "patient", "subject"); value != "" {
+		if filter.PatientID, err = referenceID(value, "Patient"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("encounter"); value != "" {
+		if filter.EncounterID, err = referenceID(value, "Encounter"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("author"); value != "" {
+		if filter.AuthorID, err = referenceID(value, "Practitioner"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("status"); value != "" {
+		if _, ok := clinicalNoteStatusCodes[value]; !ok {
+			return filter, fmt.Errorf("unknown composition status: %s", value)
+		}
+		filter.Status = value
+	}
+
+	return filter, nil
+}
+
+func parseMedicationRequestSearch(query url.Values) (models.MedicationRequestFilter, error) {
+	var filter models.MedicationRequestFilter
+	var err error
+
+	if value := firstQuery(query, "patient", "subject"); value != "" {
+		if filter.PatientID, err = referenceID(value, "Patient"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("encounter"); value != "" {
+		if filter.EncounterID, err = referenceID(value, "Encounter"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("requester"); value != "" {
+		if filter.RequesterID, err = referenceID(value, "Practitioner"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("status"); value != "" {
+		if _, ok := medicationRequestStatusCodes[value]; !ok {
+			return filter, fmt.Errorf("unknown medication request status: %s", value)
+		}
+		filter.Status = value
+	}
+
+	if value := query.Get("code"); value != "" {
+		system, code, found := strings.Cut(value, "|")
+		if !found {
+			code = system
+		} else if system != "" && system != systemMedication {
+			return filter, errNoMatch
+		}
+		filter.MedicationCode = strings.ToUpper(code)
+	}
+
+	return filter, nil
+}
+
+func parsePractitionerSearch(query url.Values) (models.PractitionerFilter, error) {
+	var filter models.PractitionerFilter
+	var err error
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid active value: %s", value)
+		}
+		filter.Active = &active
+	}
+
+	if value := query.Get("identifier"); value != "" {
+		if filter.Identifier, err = parseIdentifierParam(value); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+func parsePractitionerRoleSearch(query url.Values) (models.PractitionerRoleFilter, error) {
+	var filter models.PractitionerRoleFilter
+	var err error
+
+	if value := query.Get("practitioner"); value != "" {
+		if filter.PractitionerID, err = referenceID(value, "Practitioner"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("organization"); value != "" {
+		if filter.OrganizationID, err = referenceID(value, "Organization"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("location"); value != "" {
+		if filter.LocationID, err = referenceID(value, "Location"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid active value: %s", value)
+		}
+		filter.Active = &active
+	}
+
+	if value := query.Get("role"); value != "" {
+		system, code, found := strings.Cut(value, "|")
+		if !found {
+			code = system
+		} else if system != "" && system != systemPractitionerRole {
+			return filter, errNoMatch
+		}
+		if !practitionerRoleCodes[code] {
+			return filter, fmt.Errorf("unknown practitioner role: %s", code)
+		}
+		filter.Role = code
+	}
+
+	filter.Specialty = query.Get("specialty")
+
+	return filter, nil
+}
+
+func parseOrganizationSearch(query url.Values) (models.OrganizationFilter, error) {
+	filter := models.OrganizationFilter{Name: query.Get("name")}
+	var err error
+
+	if value := query.Get("type"); value != "" {
+		system, code, found := strings.Cut(value, "|")
+		if !found {
+			code = system
+		} else if system != "" && system != systemOrganizationType {
+			return filter, errNoMatch
+		}
+		if _, ok := organizationTypeDisplays[code]; !ok {
+			return filter, fmt.Errorf("unknown organization type: %s", code)
+		}
+		filter.Type = code
+	}
+
+	if value := query.Get("partof"); value != "" {
+		if filter.PartOf, err = referenceID(value, "Organization"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid active value: %s", value)
+		}
+		filter.Active = &active
+	}
+
+	return filter, nil
+}
+
+func parseLocationSearch(query url.Values) (models.LocationFilter, error) {
+	filter := models.LocationFilter{Name: query.Get("name")}
+	var err error
+
+	if value := query.Get("status"); value != "" {
+		if _, ok := locationStatusCodes[value]; !ok {
+			return filter, fmt.Errorf("unknown location status: %s", value)
+		}
+		filter.Status = value
+	}
+
+	if value := query.Get("type"); value != "" {
+		system, code, found := strings.Cut(value, "|")
+		if !found {
+			code = system
+		} else if system != "" && system != systemLocationPhysicalType {
+			return filter, errNoMatch
+		}
+		if _, ok := locationTypeDisplays[code]; !ok {
+			return filter, fmt.Errorf("unknown location type: %s", code)
+		}
+		filter.PhysicalType = code
+	}
+
+	if value := query.Get("organization"); value != "" {
+		if filter.OrganizationID, err = referenceID(value, "Organization"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("partof"); value != "" {
+		if filter.PartOf, err = referenceID(value, "Location"); err != nil {
+			return filter, err
+		}
+	}
+
+	if value := query.Get("operational-status"); value != "" {
+		system, code, found := strings.Cut(value, "|")
+		if !found {
+			code = system
+		} else if system != "" && system != systemBedStatus {
+			return filter, errNoMatch
+		}
+		for status, coding := range bedStatusCodings {
+			if coding.code == code {
+				filter.BedStatus = status
+			}
+		}
+		if filter.BedStatus == "" {
+			return filter, fmt.Errorf("unknown bed status: %s", code)
+		}
+	}
+
+	return filter, nil
+}
+
+func parseSubscriptionSearch(query url.Values) models.SubscriptionFilter {
+	return models.SubscriptionFilter{
+		Endpoint: query.Get("url"),
+		Criteria: query.Get("criteria"),
+		Status:   query.Get("status"),
+	}
+}
+
+// searchset builds a searchset Bundle. Included resources are added once
+// however many matches reference them, and total counts matches only.
+type searchset struct {
+	entries []map[string]interface{}
+	seen    map[string]bool
+	matches int
+}
+
+func newSearchset() *searchset {
+	return &searchset{seen: make(map[string]bool)}
+}
+
+func (b *searchset) addMatch(resourceType string, id string, resource proto.Message) {
+	if b.add(resourceType, id, resource, "match") {
+		b.matches++
+	}
+}
+
+func (b *searchset) addInclude(resourceType string, id string, resource proto.Message) {
+	b.add(resourceType, id, resource, "include")
+}
+
+func (b *searchset) add(resourceType string, id string, resource proto.Message, mode string) bool {
+	fullURL := fmt.Sprintf("%s/%s", resourceType, id)
+	if b.seen[fullURL] {
+		return false
+	}
+
+	resourceMap, err := protoToMap(resource)
+	if err != nil {
+		log.Printf("Failed to convert %s to map: %v", fullURL, err)
+		return false
+	}
+
+	b.seen[fullURL] = true
+	b.entries = append(b.entries, map[string]interface{}{
+		"fullUrl":  fullURL,
+		"resource": resourceMap,
+		"search":   map[string]interface{}{"mode": mode},
+	})
+	return true
+}
+
+func (b *searchset) write(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"resourceType": "Bundle",
+		"type":         "searchset",
+		"total":        b.matches,
+		"entry":        b.entries,
+	})
+}
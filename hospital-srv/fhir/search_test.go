@@ -0,0 +1,490 @@
+package fhir
+
+import (
+	"encoding/json"
+	"errors"
+	"hospital-srv/models"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	patientpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+)
+
+func TestApplyDateParam(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	nextDay := day.AddDate(0, 0, 1)
+	instant := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value      string
+		wantFrom   *time.Time
+		wantBefore *time.Time
+		wantErr    bool
+	}{
+		{value: "2024-01-01", wantFrom: &day, wantBefore: &nextDay},
+		{value: "eq2024-01-01", wantFrom: &day, wantBefore: &nextDay},
+		{value: "ge2024-01-01", wantFrom: &day},
+		{value: "gt2024-01-01", wantFrom: &nextDay},
+		{value: "le2024-01-01", wantBefore: &nextDay},
+		{value: "lt2024-01-01", wantBefore: &day},
+		{value: "ge2024-01-01T10:00:00Z", wantFrom: &instant},
+		{value: "ge2024", wantFrom: &day},
+		{value: "ne2024-01-01", wantErr: true},
+		{value: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var from, before *time.Time
+		err := applyDateParam(tt.value, &from, &before)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("applyDateParam(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !sameTime(from, tt.wantFrom) || !sameTime(before, tt.wantBefore) {
+			t.Errorf("applyDateParam(%q) = [%v, %v), want [%v, %v)", tt.value, from, before, tt.wantFrom, tt.wantBefore)
+		}
+	}
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func TestParseEncounterSearch(t *testing.T) {
+	const patientID = "0b8f0c4e-4a3c-4a59-9d6e-3f2f4b1c6a10"
+
+	tests := []struct {
+		query   string
+		check   func(t *testing.T, filter models.EncounterFilter)
+		wantErr error
+	}{
+		{
+			query: "patient=Patient/" + patientID + "&status=finished",
+			check: func(t *testing.T, filter models.EncounterFilter) {
+				if filter.PatientID != patientID || filter.Status != "completed" {
+					t.Errorf("filter = %+v, want patient %s and status completed", filter, patientID)
+				}
+			},
+		},
+		{
+			query: "subject=" + patientID,
+			check: func(t *testing.T, filter models.EncounterFilter) {
+				if filter.PatientID != patientID {
+					t.Errorf("filter.PatientID = %q, want %q", filter.PatientID, patientID)
+				}
+			},
+		},
+		{
+			query: "location=Location/" + locationID,
+			check: func(t *testing.T, filter models.EncounterFilter) {
+				if filter.LocationID != locationID {
+					t.Errorf("filter.LocationID = %q, want %q", filter.LocationID, locationID)
+				}
+			},
+		},
+		{
+			query: "identifier=urn:reception:visit|42",
+			check: func(t *testing.T, filter models.EncounterFilter) {
+				if filter.Identifier == nil || filter.Identifier.System == nil ||
+					*filter.Identifier.System != "urn:reception:visit" || filter.Identifier.Value != "42" {
+					t.Errorf("filter.Identifier = %+v, want urn:reception:visit|42", filter.Identifier)
+				}
+			},
+		},
+		{query: "patient=Patient/123", wantErr: errNoMatch},
+		{query: "location=Organization/" + organizationID, wantErr: errNoMatch},
+		{query: "identifier=|"},
+		{query: "status=done"},
+		{query: "date=ne2024"},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter, err := parseEncounterSearch(query)
+		switch {
+		case tt.check != nil:
+			if err != nil {
+				t.Errorf("parseEncounterSearch(%q) = %v", tt.query, err)
+				continue
+			}
+			tt.check(t, filter)
+		case tt.wantErr != nil:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("parseEncounterSearch(%q) = %v, want %v", tt.query, err, tt.wantErr)
+			}
+		default:
+			if err == nil {
+				t.Errorf("parseEncounterSearch(%q) = nil, want an error", tt.query)
+			}
+		}
+	}
+}
+
+func TestParsePatientSearch(t *testing.T) {
+	const (
+		first  = "0b8f0c4e-4a3c-4a59-9d6e-3f2f4b1c6a10"
+		second = "0b8f0c4e-4a3c-4a59-9d6e-3f2f4b1c6a11"
+	)
+
+	filter, err := parsePatientSearch(url.Values{"_id": {first + ",p1," + second}})
+	if err != nil {
+		t.Fatalf("parsePatientSearch() = %v", err)
+	}
+	if len(filter.IDs) != 2 || filter.IDs[0] != first || filter.IDs[1] != second {
+		t.Errorf("filter.IDs = %v, want [%s %s]", filter.IDs, first, second)
+	}
+
+	if _, err := parsePatientSearch(url.Values{"_id": {"p1,p2"}}); !errors.Is(err, errNoMatch) {
+		t.Errorf("parsePatientSearch() of malformed ids = %v, want %v", err, errNoMatch)
+	}
+
+	if filter, err := parsePatientSearch(url.Values{}); err != nil || filter.IDs != nil {
+		t.Errorf("parsePatientSearch() without _id = %+v, %v, want an empty filter", filter, err)
+	}
+}
+
+func TestParseIncludes(t *testing.T) {
+	allowed := searchIncludes["Encounter"]
+
+	includes, err := parseIncludes(url.Values{"_include": {"Encounter:subject", "Encounter:participant", "Encounter:subject"}}, "_include", allowed)
+	if err != nil {
+		t.Fatalf("parseIncludes() = %v", err)
+	}
+	if len(includes) != 2 || !includes["Encounter:subject"] || !includes["Encounter:participant"] {
+		t.Errorf("parseIncludes() = %v, want subject and participant", includes)
+	}
+
+	if _, err := parseIncludes(url.Values{"_include": {"Encounter:location"}}, "_include", allowed); err == nil {
+		t.Errorf("parseIncludes() of an unsupported include = nil, want an error")
+	}
+
+	if includes, err := parseIncludes(url.Values{}, "_revinclude", searchRevIncludes["Patient"]); err != nil || len(includes) != 0 {
+		t.Errorf("parseIncludes() without the parameter = %v, %v, want none", includes, err)
+	}
+}
+
+func TestSearchsetDeduplicatesIncludes(t *testing.T) {
+	patient := func(id string) *patientpb.Patient {
+		return &patientpb.Patient{Id: &dtpb.Id{Value: id}}
+	}
+
+	bundle := newSearchset()
+	bundle.addMatch("Patient", "p1", patient("p1"))
+	bundle.addMatch("Patient", "p2", patient("p2"))
+	bundle.addInclude("Patient", "p1", patient("p1"))
+	bundle.addInclude("Patient", "p3", patient("p3"))
+	bundle.addInclude("Patient", "p3", patient("p3"))
+
+	c, w := testContext(http.MethodGet, "/fhir/Patient", nil)
+	bundle.write(c)
+
+	var response struct {
+		Total int `json:"total"`
+		Entry []struct {
+			FullURL string `json:"fullUrl"`
+			Search  struct {
+				Mode string `json:"mode"`
+			} `json:"search"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+
+	if response.Total != 2 {
+		t.Errorf("total = %d, want 2 matches", response.Total)
+	}
+
+	want := []struct{ fullURL, mode string }{
+		{"Patient/p1", "match"},
+		{"Patient/p2", "match"},
+		{"Patient/p3", "include"},
+	}
+	if len(response.Entry) != len(want) {
+		t.Fatalf("entries = %+v, want %v", response.Entry, want)
+	}
+	for i, w := range want {
+		if response.Entry[i].FullURL != w.fullURL || response.Entry[i].Search.Mode != w.mode {
+			t.Errorf("entry %d = %+v, want %v", i, response.Entry[i], w)
+		}
+	}
+}
+
+func TestParseConditionSearch(t *testing.T) {
+	encounterID := "5d2a7c1e-3b4f-4e6a-9c8d-1f2e3a4b5c01"
+
+	tests := []struct {
+		query   string
+		want    models.ConditionFilter
+		wantErr error
+	}{
+		{query: "", want: models.ConditionFilter{}},
+		{query: "subject=Patient/" + patientID, want: models.ConditionFilter{PatientID: patientID}},
+		{query: "encounter=" + encounterID, want: models.ConditionFilter{EncounterID: encounterID}},
+		{query: "clinical-status=resolved&verification-status=confirmed", want: models.ConditionFilter{ClinicalStatus: "resolved", VerificationStatus: "confirmed"}},
+		{query: "code=j06.9", want: models.ConditionFilter{Code: "J06.9"}},
+		{query: "code=" + url.QueryEscape(systemICD10+"|J06.9"), want: models.ConditionFilter{Code: "J06.9"}},
+		{query: "code=" + url.QueryEscape("|J06.9"), want: models.ConditionFilter{Code: "J06.9"}},
+		{query: "code=" + url.QueryEscape("http://snomed.info/sct|195967001"), wantErr: errNoMatch},
+		{query: "patient=p1", wantErr: errNoMatch},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseConditionSearch(query)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("parseConditionSearch(%q) = %+v, %v, want %+v, %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	for _, query := range []string{"clinical-status=cured", "verification-status=likely"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parseConditionSearch(values); err == nil || errors.Is(err, errNoMatch) {
+			t.Errorf("parseConditionSearch(%q) = %v, want a validation error", query, err)
+		}
+	}
+}
+
+func TestParseCompositionSearch(t *testing.T) {
+	encounterID := "5d2a7c1e-3b4f-4e6a-9c8d-1f2e3a4b5c01"
+
+	tests := []struct {
+		query   string
+		want    models.ClinicalNoteFilter
+		wantErr error
+	}{
+		{query: "", want: models.ClinicalNoteFilter{}},
+		{query: "patient=" + patientID, want: models.ClinicalNoteFilter{PatientID: patientID}},
+		{query: "encounter=Encounter/" + encounterID, want: models.ClinicalNoteFilter{EncounterID: encounterID}},
+		{query: "author=Practitioner/" + practitionerID + "&status=final", want: models.ClinicalNoteFilter{AuthorID: practitionerID, Status: "final"}},
+		{query: "author=Patient/" + patientID, wantErr: errNoMatch},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseCompositionSearch(query)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("parseCompositionSearch(%q) = %+v, %v, want %+v, %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, err := parseCompositionSearch(url.Values{"status": {"draft"}}); err == nil || errors.Is(err, errNoMatch) {
+		t.Errorf("parseCompositionSearch(status=draft) = %v, want a validation error", err)
+	}
+}
+
+func TestParseMedicationRequestSearch(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    models.MedicationRequestFilter
+		wantErr error
+	}{
+		{query: "", want: models.MedicationRequestFilter{}},
+		{query: "subject=Patient/" + patientID, want: models.MedicationRequestFilter{PatientID: patientID}},
+		{query: "requester=" + practitionerID + "&status=stopped", want: models.MedicationRequestFilter{RequesterID: practitionerID, Status: "stopped"}},
+		{query: "code=amox500", want: models.MedicationRequestFilter{MedicationCode: "AMOX500"}},
+		{query: "code=" + url.QueryEscape(systemMedication+"|AMOX500"), want: models.MedicationRequestFilter{MedicationCode: "AMOX500"}},
+		{query: "code=" + url.QueryEscape(systemATC+"|J01CA04"), wantErr: errNoMatch},
+		{query: "encounter=e1", wantErr: errNoMatch},
+	}
+
+	for _, tt := range tests {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseMedicationRequestSearch(query)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("parseMedicationRequestSearch(%q) = %+v, %v, want %+v, %v", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, err := parseMedicationRequestSearch(url.Values{"status": {"on-hold"}}); err == nil || errors.Is(err, errNoMatch) {
+		t.Errorf("parseMedicationRequestSearch(status=on-hold) = %v, want a validation error", err)
+	}
+}
+
+func TestParsePractitionerSearch(t *testing.T) {
+	filter, err := parsePractitionerSearch(url.Values{"active": {"false"}})
+	if err != nil || filter.Active == nil || *filter.Active {
+		t.Errorf("parsePractitionerSearch(active=false) = %+v, %v, want inactive", filter, err)
+	}
+
+	if filter, err := parsePractitionerSearch(url.Values{}); err != nil || filter.Active != nil {
+		t.Errorf("parsePractitionerSearch() = %+v, %v, want no filter", filter, err)
+	}
+
+	if _, err := parsePractitionerSearch(url.Values{"active": {"maybe"}}); err == nil {
+		t.Error("parsePractitionerSearch(active=maybe) = nil, want an error")
+	}
+
+	filter, err = parsePractitionerSearch(url.Values{"identifier": {"urn:hr:staff|1042"}})
+	if err != nil || filter.Identifier == nil || filter.Identifier.Value != "1042" {
+		t.Errorf("parsePractitionerSearch(identifier) = %+v, %v, want identifier 1042", filter, err)
+	}
+}
+
+func TestParseIdentifierParam(t *testing.T) {
+	system := "urn:reception:visit"
+	empty := ""
+
+	tests := []struct {
+		value   string
+		want    models.IdentifierFilter
+		wantErr bool
+	}{
+		{value: "42", want: models.IdentifierFilter{Value: "42"}},
+		{value: system + "|42", want: models.IdentifierFilter{System: &system, Value: "42"}},
+		{value: "|42", want: models.IdentifierFilter{System: &empty, Value: "42"}},
+		{value: system + "|", want: models.IdentifierFilter{System: &system}},
+		{value: "|", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseIdentifierParam(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseIdentifierParam(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got.Value != tt.want.Value || (got.System == nil) != (tt.want.System == nil) ||
+			(got.System != nil && *got.System != *tt.want.System) {
+			t.Errorf("parseIdentifierParam(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParsePractitionerRoleSearch(t *testing.T) {
+	filter, err := parsePractitionerRoleSearch(url.Values{
+		"practitioner": {"Practitioner/" + practitionerID},
+		"organization": {organizationID},
+		"location":     {"Location/" + locationID},
+		"active":       {"true"},
+		"role":         {systemPractitionerRole + "|nurse"},
+		"specialty":    {"Cardiology"},
+	})
+	if err != nil {
+		t.Fatalf("parsePractitionerRoleSearch() = %v", err)
+	}
+	if filter.PractitionerID != practitionerID || filter.OrganizationID != organizationID || filter.LocationID != locationID || filter.Active == nil || !*filter.Active || filter.Role != "nurse" || filter.Specialty != "Cardiology" {
+		t.Errorf("parsePractitionerRoleSearch() = %+v", filter)
+	}
+
+	tests := []struct {
+		query   url.Values
+		wantErr error
+	}{
+		{query: url.Values{"role": {"http://snomed.info/sct|nurse"}}, wantErr: errNoMatch},
+		{query: url.Values{"practitioner": {"d1"}}, wantErr: errNoMatch},
+		{query: url.Values{"role": {"surgeon"}}},
+		{query: url.Values{"active": {"yes"}}},
+	}
+
+	for _, tt := range tests {
+		_, err := parsePractitionerRoleSearch(tt.query)
+		if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+			t.Errorf("parsePractitionerRoleSearch(%v) = %v, want an error", tt.query, err)
+		}
+	}
+}
+
+func TestParseOrganizationSearch(t *testing.T) {
+	filter, err := parseOrganizationSearch(url.Values{
+		"name":   {"Card"},
+		"type":   {systemOrganizationType + "|dept"},
+		"partof": {"Organization/" + organizationID},
+		"active": {"true"},
+	})
+	if err != nil {
+		t.Fatalf("parseOrganizationSearch() = %v", err)
+	}
+	if filter.Name != "Card" || filter.Type != models.OrganizationTypeDepartment || filter.PartOf != organizationID || filter.Active == nil || !*filter.Active {
+		t.Errorf("parseOrganizationSearch() = %+v", filter)
+	}
+
+	tests := []struct {
+		query   url.Values
+		wantErr error
+	}{
+		{query: url.Values{"type": {"http://snomed.info/sct|dept"}}, wantErr: errNoMatch},
+		{query: url.Values{"partof": {"o1"}}, wantErr: errNoMatch},
+		{query: url.Values{"type": {"team"}}},
+		{query: url.Values{"active": {"yes"}}},
+	}
+
+	for _, tt := range tests {
+		_, err := parseOrganizationSearch(tt.query)
+		if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+			t.Errorf("parseOrganizationSearch(%v) = %v, want an error", tt.query, err)
+		}
+	}
+}
+
+func TestParseLocationSearch(t *testing.T) {
+	filter, err := parseLocationSearch(url.Values{
+		"name":         {"Ward"},
+		"status":       {"suspended"},
+		"type":         {"wa"},
+		"organization": {organizationID},
+		"partof":       {"Location/" + locationID},
+	})
+	if err != nil {
+		t.Fatalf("parseLocationSearch() = %v", err)
+	}
+	want := models.LocationFilter{
+		Name:           "Ward",
+		Status:         models.LocationStatusSuspended,
+		PhysicalType:   models.LocationTypeWard,
+		OrganizationID: organizationID,
+		PartOf:         locationID,
+	}
+	if filter != want {
+		t.Errorf("parseLocationSearch() = %+v, want %+v", filter, want)
+	}
+
+	for _, query := range []string{"H", systemBedStatus + "|H", "|H"} {
+		filter, err := parseLocationSearch(url.Values{"operational-status": {query}})
+		if err != nil || filter.BedStatus != models.BedStatusCleaning {
+			t.Errorf("parseLocationSearch(operational-status=%s) = %+v, %v, want beds needing cleaning", query, filter, err)
+		}
+	}
+
+	tests := []struct {
+		query   url.Values
+		wantErr error
+	}{
+		{query: url.Values{"type": {"http://snomed.info/sct|wa"}}, wantErr: errNoMatch},
+		{query: url.Values{"partof": {"Organization/" + organizationID}}, wantErr: errNoMatch},
+		{query: url.Values{"operational-status": {"http://snomed.info/sct|U"}}, wantErr: errNoMatch},
+		{query: url.Values{"type": {"cabinet"}}},
+		{query: url.Values{"status": {"closed"}}},
+		{query: url.Values{"operational-status": {"free"}}},
+	}
+
+	for _, tt := range tests {
+		_, err := parseLocationSearch(tt.query)
+		if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+			t.Errorf("parseLocationSearch(%v) = %v, want an error", tt.query, err)
+		}
+	}
+}
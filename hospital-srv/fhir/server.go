@@ -1,8 +1,12 @@
 package fhir
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
 	"hospital-srv/services"
 	"io"
 	"log"
@@ -10,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	cspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/capability_statement_go_proto"
 	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
 	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -17,16 +22,35 @@ import (
 )
 
 type FHIRServer struct {
+	patientService      *services.PatientService
 	practitionerService *services.PractitionerService
 	encounterService    *services.EncounterService
-	notificationClient  *NotificationClient
+	transactionService  *services.TransactionService
+	subscriptionService *services.SubscriptionService
+	schedulingService   *services.SchedulingService
+	calendarService     *services.CalendarService
+	conditionService    *services.ConditionService
+	noteService         *services.ClinicalNoteService
+	medicationService   *services.MedicationService
+	organizationService *services.OrganizationService
+	exportService       *services.ExportService
+	capabilityStatement *cspb.CapabilityStatement
 }
 
-func NewFHIRServer(practitionerService *services.PractitionerService, encounterService *services.EncounterService, notificationClient *NotificationClient) *FHIRServer {
+func NewFHIRServer(patientService *services.PatientService, practitionerService *services.PractitionerService, encounterService *services.EncounterService, transactionService *services.TransactionService, subscriptionService *services.SubscriptionService, schedulingService *services.SchedulingService, calendarService *services.CalendarService, conditionService *services.ConditionService, noteService *services.ClinicalNoteService, medicationService *services.MedicationService, organizationService *services.OrganizationService, exportService *services.ExportService) *FHIRServer {
 	return &FHIRServer{
+		patientService:      patientService,
 		practitionerService: practitionerService,
 		encounterService:    encounterService,
-		notificationClient:  notificationClient,
+		transactionService:  transactionService,
+		subscriptionService: subscriptionService,
+		schedulingService:   schedulingService,
+		calendarService:     calendarService,
+		conditionService:    conditionService,
+		noteService:         noteService,
+		medicationService:   medicationService,
+		organizationService: organizationService,
+		exportService:       exportService,
 	}
 }
 
@@ -58,8 +82,30 @@ func extractEncounterID(resourceMap map[string]interface{}) string {
 	return val
 }
 
+func (s *FHIRServer) GetPatient(c *gin.Context) {
+	id := c.Param("id")
+
+	patient, err := s.patientService.GetPatientByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Patient not found"})
+		return
+	}
+
+	writeVersionedResource(c, versionedResource{
+		resource:  PatientToFHIR(*patient),
+		versionID: patient.VersionID,
+		updatedAt: patient.UpdatedAt,
+	})
+}
+
 func (s *FHIRServer) GetPractitioners(c *gin.Context) {
-	practitioners, err := s.practitionerService.GetAllPractitioners()
+	filter, err := parsePractitionerSearch(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	practitioners, err := s.practitionerService.SearchPractitioners(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -96,14 +142,11 @@ func (s *FHIRServer) GetPractitioner(c *gin.Context) {
 		return
 	}
 
-	fhirResource := PractitionerToFHIR(*practitioner)
-	resourceMap, err := protoToMap(fhirResource)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert practitioner"})
-		return
-	}
-
-	c.JSON(http.StatusOK, resourceMap)
+	writeVersionedResource(c, versionedResource{
+		resource:  PractitionerToFHIR(*practitioner),
+		versionID: practitioner.VersionID,
+		updatedAt: practitioner.UpdatedAt,
+	})
 }
 
 func (s *FHIRServer) CreatePractitioner(c *gin.Context) {
@@ -121,13 +164,32 @@ func (s *FHIRServer) CreatePractitioner(c *gin.Context) {
 		return
 	}
 
-	practitioner, err := FHIRToPractitioner(&fhirPractitioner)
+	if s.ifNoneExist(c, "Practitioner", writePractitionerMatch) {
+		return
+	}
+
+	s.createPractitioner(c, &fhirPractitioner)
+}
+
+func (s *FHIRServer) createPractitioner(c *gin.Context, fhirPractitioner *practpb.Practitioner) {
+	if !s.validate(c, "Practitioner", fhirPractitioner) {
+		return
+	}
+
+	practitioner, err := FHIRToPractitioner(fhirPractitioner)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	id, err := s.practitionerService.CreatePractitioner(practitioner)
+	if errors.Is(err, repository.ErrDuplicateIdentifier) {
+		// A concurrent create with the same criteria may have won the race.
+		if !s.ifNoneExist(c, "Practitioner", writePractitionerMatch) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		}
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -149,6 +211,7 @@ func (s *FHIRServer) CreatePractitioner(c *gin.Context) {
 	jsonBytes, _ := json.Marshal(resourceMap)
 	log.Printf("Sending FHIR Practitioner response: %s", strings.ReplaceAll(string(jsonBytes), "\n", " "))
 
+	setVersionHeaders(c, createdPractitioner.VersionID, createdPractitioner.UpdatedAt)
 	c.JSON(http.StatusCreated, resourceMap)
 }
 
@@ -167,13 +230,40 @@ func (s *FHIRServer) CreateEncounter(c *gin.Context) {
 		return
 	}
 
-	encounter, err := FHIRToEncounter(&fhirEncounter)
+	if s.ifNoneExist(c, "Encounter", writeEncounterMatch) {
+		return
+	}
+
+	s.createEncounter(c, &fhirEncounter)
+}
+
+func (s *FHIRServer) createEncounter(c *gin.Context, fhirEncounter *encpb.Encounter) {
+	if !s.validate(c, "Encounter", fhirEncounter) {
+		return
+	}
+
+	encounter, err := FHIRToEncounter(fhirEncounter)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	id, err := s.encounterService.CreateEncounter(encounter)
+	id, err := s.encounterService.CreateEncounter(encounter, requestActor(c))
+	if errors.Is(err, repository.ErrDuplicateIdentifier) {
+		// A concurrent create with the same criteria may have won the race.
+		if !s.ifNoneExist(c, "Encounter", writeEncounterMatch) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if errors.Is(err, services.ErrInvalidStatusTransition) || errors.Is(err, services.ErrOutsideWorkingHours) || errors.Is(err, services.ErrInactivePractitioner) || errors.Is(err, services.ErrInactiveLocation) || errors.Is(err, services.ErrReferenceNotFound) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidBedAssignment) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -199,44 +289,100 @@ func (s *FHIRServer) CreateEncounter(c *gin.Context) {
 
 	log.Printf("Created FHIR Encounter with ID: %s", encounterID)
 
-	go func() {
-		if err := s.notificationClient.NotifyEncounterCreated(resourceMap); err != nil {
-			log.Printf("Failed to send encounter_created notification: %v", err)
-		}
-	}()
-
+	setVersionHeaders(c, createdEncounter.VersionID, createdEncounter.UpdatedAt)
 	c.JSON(http.StatusCreated, gin.H{
 		"id": encounterID,
 	})
 }
 
 func (s *FHIRServer) GetEncounters(c *gin.Context) {
-	encounters, err := s.encounterService.GetAllEncounters()
+	query := c.Request.URL.Query()
+
+	includes, err := parseIncludes(query, "_include", searchIncludes["Encounter"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := parseEncounterSearch(query)
+	if errors.Is(err, errNoMatch) {
+		newSearchset().write(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	encounters, err := s.encounterService.SearchEncounters(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var entries []map[string]interface{}
+	bundle := newSearchset()
 	for _, e := range encounters {
-		fhirResource := EncounterToFHIR(e)
-		resourceMap, err := protoToMap(fhirResource)
-		if err != nil {
-			log.Printf("Failed to convert encounter to map: %v", err)
-			continue
+		bundle.addMatch("Encounter", e.ID, EncounterToFHIR(e))
+	}
+
+	// The joined patient and practitioner rows are already loaded, so
+	// including them costs no extra queries.
+	for _, e := range encounters {
+		if includes["Encounter:subject"] {
+			bundle.addInclude("Patient", e.Patient.ID, PatientToFHIR(e.Patient))
+		}
+		if includes["Encounter:participant"] {
+			bundle.addInclude("Practitioner", e.Practitioner.ID, PractitionerToFHIR(e.Practitioner))
 		}
+	}
 
-		entry := map[string]interface{}{
-			"resource": resourceMap,
+	bundle.write(c)
+}
+
+func (s *FHIRServer) GetPatients(c *gin.Context) {
+	query := c.Request.URL.Query()
+
+	revIncludes, err := parseIncludes(query, "_revinclude", searchRevIncludes["Patient"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := parsePatientSearch(query)
+	if errors.Is(err, errNoMatch) {
+		newSearchset().write(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	patients, err := s.patientService.SearchPatients(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	bundle := newSearchset()
+	patientIDs := make([]string, 0, len(patients))
+	for _, p := range patients {
+		bundle.addMatch("Patient", p.ID, PatientToFHIR(p))
+		patientIDs = append(patientIDs, p.ID)
+	}
+
+	if revIncludes["Encounter:subject"] && len(patientIDs) > 0 {
+		encounters, err := s.encounterService.SearchEncounters(models.EncounterFilter{PatientIDs: patientIDs})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, e := range encounters {
+			bundle.addInclude("Encounter", e.ID, EncounterToFHIR(e))
 		}
-		entries = append(entries, entry)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"resourceType": "Bundle",
-		"type":         "searchset",
-		"entry":        entries,
-	})
+	bundle.write(c)
 }
 
 func (s *FHIRServer) GetEncounter(c *gin.Context) {
@@ -248,47 +394,221 @@ func (s *FHIRServer) GetEncounter(c *gin.Context) {
 		return
 	}
 
-	fhirResource := EncounterToFHIR(*encounter)
-	resourceMap, err := protoToMap(fhirResource)
+	writeVersionedResource(c, versionedResource{
+		resource:  EncounterToFHIR(*encounter),
+		versionID: encounter.VersionID,
+		updatedAt: encounter.UpdatedAt,
+	})
+}
+
+func (s *FHIRServer) UpdatePractitioner(c *gin.Context) {
+	id := c.Param("id")
+
+	expectedVersion, err := parseIfMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert encounter"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, resourceMap)
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	var fhirPractitioner practpb.Practitioner
+	if err := protojson.Unmarshal(body, &fhirPractitioner); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Practitioner format"})
+		return
+	}
+
+	if fhirPractitioner.Id != nil && fhirPractitioner.Id.Value != id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Resource id does not match URL"})
+		return
+	}
+
+	if !s.validate(c, "Practitioner", &fhirPractitioner) {
+		return
+	}
+
+	practitioner, err := FHIRToPractitioner(&fhirPractitioner)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	practitioner.ID = id
+
+	if err := s.practitionerService.UpdatePractitioner(practitioner, expectedVersion); err != nil {
+		writeUpdateError(c, "Practitioner", err)
+		return
+	}
+
+	updatedPractitioner, err := s.practitionerService.GetPractitionerByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeVersionedResource(c, versionedResource{
+		resource:  PractitionerToFHIR(*updatedPractitioner),
+		versionID: updatedPractitioner.VersionID,
+		updatedAt: updatedPractitioner.UpdatedAt,
+	})
 }
 
-func (s *FHIRServer) UpdateEncounterStatus(c *gin.Context) {
+func (s *FHIRServer) UpdateEncounter(c *gin.Context) {
 	id := c.Param("id")
 
-	var req struct {
-		Status string `json:"status" binding:"required"`
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
 		return
 	}
 
-	if err := s.encounterService.UpdateEncounterStatus(id, req.Status); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	log.Printf("Received FHIR Encounter update: %s", strings.ReplaceAll(string(body), "\n", " "))
+
+	var fhirEncounter encpb.Encounter
+	if err := protojson.Unmarshal(body, &fhirEncounter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Encounter format"})
 		return
 	}
 
-	updatedEncounter, err := s.encounterService.GetEncounterByID(id)
-	if err == nil {
-		fhirResource := EncounterToFHIR(*updatedEncounter)
-		jsonBytes, _ := protojson.Marshal(fhirResource)
+	if fhirEncounter.Id != nil && fhirEncounter.Id.Value != id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Resource id does not match URL"})
+		return
+	}
+
+	s.saveEncounter(c, id, &fhirEncounter, expectedVersion)
+}
+
+func (s *FHIRServer) PatchEncounter(c *gin.Context) {
+	id := c.Param("id")
+
+	expectedVersion, err := parseIfMatch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	log.Printf("Received FHIR Encounter patch (%s): %s", c.ContentType(), strings.ReplaceAll(string(body), "\n", " "))
+
+	current, err := s.encounterService.GetEncounterByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Encounter not found"})
+		return
+	}
+
+	fhirEncounter := EncounterToFHIR(*current)
+	if err := applyPatch(c.ContentType(), fhirEncounter, "Encounter", body); err != nil {
+		if errors.Is(err, errUnsupportedPatchFormat) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	if fhirEncounter.Id == nil || fhirEncounter.Id.Value != id {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Patch must not change the resource id"})
+		return
+	}
 
-		var resourceMap map[string]interface{}
-		_ = json.Unmarshal(jsonBytes, &resourceMap)
+	// The patch was computed against the version just read, so guard the write
+	// with it even when the client did not send If-Match.
+	if expectedVersion == 0 {
+		expectedVersion = current.VersionID
+	}
 
-		go func() {
-			if err := s.notificationClient.NotifyEncounterStatusUpdated(resourceMap); err != nil {
-				log.Printf("Failed to send encounter_status_updated notification: %v", err)
-			}
-		}()
+	s.saveEncounter(c, id, fhirEncounter, expectedVersion)
+}
+
+func (s *FHIRServer) saveEncounter(c *gin.Context, id string, fhirEncounter *encpb.Encounter, expectedVersion int) {
+	if !s.validate(c, "Encounter", fhirEncounter) {
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully"})
+	encounter, err := FHIRToEncounter(fhirEncounter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	encounter.ID = id
+
+	if err := s.encounterService.UpdateEncounter(encounter, expectedVersion, requestActor(c)); err != nil {
+		writeUpdateError(c, "Encounter", err)
+		return
+	}
+
+	updatedEncounter, err := s.encounterService.GetEncounterByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resourceMap, err := protoToMap(EncounterToFHIR(*updatedEncounter))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert encounter"})
+		return
+	}
+
+	setVersionHeaders(c, updatedEncounter.VersionID, updatedEncounter.UpdatedAt)
+	c.JSON(http.StatusOK, resourceMap)
+}
+
+// headerActor lets clients name who is making a change, e.g.
+// "Practitioner/123" or "reception/jdoe". It is recorded in the encounter
+// status history.
+const headerActor = "X-HIS-Actor"
+
+func requestActor(c *gin.Context) string {
+	return c.GetHeader(headerActor)
+}
+
+func writeUpdateError(c *gin.Context, resourceType string, err error) {
+	status, message := updateErrorStatus(resourceType, err)
+	c.JSON(status, gin.H{"error": message})
+}
+
+func updateErrorStatus(resourceType string, err error) (int, string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, fmt.Sprintf("%s not found", resourceType)
+	case errors.Is(err, repository.ErrVersionConflict):
+		return http.StatusPreconditionFailed, fmt.Sprintf("%s has been modified since the given version", resourceType)
+	case errors.Is(err, repository.ErrConflictingPrescription),
+		errors.Is(err, repository.ErrDuplicateIdentifier),
+		errors.Is(err, services.ErrInvalidBedAssignment):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, services.ErrInvalidStatusTransition),
+		errors.Is(err, services.ErrUnknownCode),
+		errors.Is(err, services.ErrInvalidCondition),
+		errors.Is(err, services.ErrInvalidNoteStatus),
+		errors.Is(err, services.ErrInvalidClinicalNote),
+		errors.Is(err, services.ErrUnknownMedication),
+		errors.Is(err, services.ErrInvalidPrescriptionTransition),
+		errors.Is(err, services.ErrInvalidMedicationRequest),
+		errors.Is(err, services.ErrInactivePractitioner),
+		errors.Is(err, services.ErrOutsideWorkingHours),
+		errors.Is(err, services.ErrInvalidPractitionerRole),
+		errors.Is(err, services.ErrInvalidOrganization),
+		errors.Is(err, services.ErrInvalidLocation),
+		errors.Is(err, services.ErrInactiveLocation),
+		errors.Is(err, services.ErrInvalidBedTransition),
+		errors.Is(err, services.ErrReferenceNotFound):
+		return http.StatusUnprocessableEntity, err.Error()
+	default:
+		return http.StatusInternalServerError, err.Error()
+	}
 }
@@ -0,0 +1,192 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	subpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/subscription_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// parseSubscriptionCriteria turns criteria such as
+// "Encounter?practitioner=Practitioner/123" into an encounter filter.
+// Encounter is the only resource type notifications are sent for.
+func parseSubscriptionCriteria(criteria string) (models.EncounterFilter, error) {
+	resourceType, rawQuery, _ := strings.Cut(criteria, "?")
+	if resourceType != "Encounter" {
+		return models.EncounterFilter{}, fmt.Errorf("unsupported criteria resource type: %s", resourceType)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return models.EncounterFilter{}, fmt.Errorf("invalid criteria: %w", err)
+	}
+
+	return parseEncounterSearch(query)
+}
+
+func encounterMatches(filter models.EncounterFilter, e models.EncounterWithDetails) bool {
+	if filter.PatientID != "" && filter.PatientID != e.PatientID {
+		return false
+	}
+	if filter.PractitionerID != "" && filter.PractitionerID != e.PractitionerID {
+		return false
+	}
+	if filter.LocationID != "" && (e.LocationID == nil || filter.LocationID != *e.LocationID) {
+		return false
+	}
+	if filter.Status != "" && filter.Status != e.Status {
+		return false
+	}
+	if filter.StartFrom != nil && e.StartTime.Before(*filter.StartFrom) {
+		return false
+	}
+	if filter.StartBefore != nil && !e.StartTime.Before(*filter.StartBefore) {
+		return false
+	}
+	if filter.Identifier != nil && !identifierMatches(*filter.Identifier, e.Identifiers) {
+		return false
+	}
+	return true
+}
+
+// identifierMatches reports whether one of identifiers matches filter, the
+// way the identifier search does.
+func identifierMatches(filter models.IdentifierFilter, identifiers []models.Identifier) bool {
+	for _, identifier := range identifiers {
+		if filter.System != nil && *filter.System != identifier.System {
+			continue
+		}
+		if filter.Value != "" && filter.Value != identifier.Value {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (s *FHIRServer) CreateSubscription(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	log.Printf("Received FHIR Subscription: %s", strings.ReplaceAll(string(body), "\n", " "))
+
+	var fhirSubscription subpb.Subscription
+	if err := protojson.Unmarshal(body, &fhirSubscription); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid FHIR Subscription format"})
+		return
+	}
+
+	subscription, err := FHIRToSubscription(&fhirSubscription)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := parseSubscriptionCriteria(subscription.Criteria); err != nil {
+		if errors.Is(err, errNoMatch) {
+			err = fmt.Errorf("criteria can never match: %s", subscription.Criteria)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if endpoint, err := url.Parse(subscription.Endpoint); err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Subscription channel endpoint must be an http(s) URL"})
+		return
+	}
+
+	id, err := s.subscriptionService.CreateSubscription(subscription)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.subscriptionService.GetSubscriptionByID(id)
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+
+	resourceMap, err := protoToMap(SubscriptionToFHIR(*created))
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+
+	log.Printf("Created FHIR Subscription %s: criteria=%s, endpoint=%s", id, created.Criteria, created.Endpoint)
+
+	c.Header("Location", fmt.Sprintf("Subscription/%s", id))
+	c.JSON(http.StatusCreated, resourceMap)
+}
+
+func (s *FHIRServer) GetSubscriptions(c *gin.Context) {
+	subscriptions, err := s.subscriptionService.SearchSubscriptions(parseSubscriptionSearch(c.Request.URL.Query()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries []map[string]interface{}
+	for _, sub := range subscriptions {
+		resourceMap, err := protoToMap(SubscriptionToFHIR(sub))
+		if err != nil {
+			log.Printf("Failed to convert subscription to map: %v", err)
+			continue
+		}
+
+		entries = append(entries, map[string]interface{}{
+			"resource": resourceMap,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"resourceType": "Bundle",
+		"type":         "searchset",
+		"total":        len(entries),
+		"entry":        entries,
+	})
+}
+
+func (s *FHIRServer) GetSubscription(c *gin.Context) {
+	subscription, err := s.subscriptionService.GetSubscriptionByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	resourceMap, err := protoToMap(SubscriptionToFHIR(*subscription))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert subscription"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resourceMap)
+}
+
+func (s *FHIRServer) DeleteSubscription(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, err := s.subscriptionService.GetSubscriptionByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	if err := s.subscriptionService.DeleteSubscription(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Deleted FHIR Subscription %s", id)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package fhir
+
+import (
+	"errors"
+	"hospital-srv/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	patientID           = "0b6f3c1e-5a7d-4d7e-9c1a-2f4b8e6d1a01"
+	otherPatientID      = "0b6f3c1e-5a7d-4d7e-9c1a-2f4b8e6d1a02"
+	practitionerID      = "7c2e9a4b-1d3f-4b6a-8e5c-9a1b2c3d4e01"
+	otherPractitionerID = "7c2e9a4b-1d3f-4b6a-8e5c-9a1b2c3d4e02"
+	organizationID      = "9e4b1a2c-7d3f-4c5e-8a6b-0c1d2e3f4a01"
+	locationID          = "6a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c01"
+)
+
+func TestParseSubscriptionCriteria(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		criteria string
+		want     models.EncounterFilter
+		wantErr  bool
+	}{
+		{name: "all encounters", criteria: "Encounter"},
+		{name: "empty query", criteria: "Encounter?"},
+		{name: "patient reference", criteria: "Encounter?patient=Patient/" + patientID, want: models.EncounterFilter{PatientID: patientID}},
+		{name: "subject id", criteria: "Encounter?subject=" + patientID, want: models.EncounterFilter{PatientID: patientID}},
+		{name: "participant", criteria: "Encounter?participant=Practitioner/" + practitionerID, want: models.EncounterFilter{PractitionerID: practitionerID}},
+		{name: "finished status", criteria: "Encounter?status=finished", want: models.EncounterFilter{Status: "completed"}},
+		{name: "date", criteria: "Encounter?date=ge2024-01-01", want: models.EncounterFilter{StartFrom: &from}},
+		{
+			name:     "several parameters",
+			criteria: "Encounter?patient=" + patientID + "&practitioner=" + practitionerID + "&status=in-progress",
+			want:     models.EncounterFilter{PatientID: patientID, PractitionerID: practitionerID, Status: "in-progress"},
+		},
+		{name: "other resource type", criteria: "Patient?name=Ivan", wantErr: true},
+		{name: "unknown status", criteria: "Encounter?status=done", wantErr: true},
+		{name: "invalid query", criteria: "Encounter?patient=%zz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSubscriptionCriteria(tt.criteria)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSubscriptionCriteria(%q) = %+v, want an error", tt.criteria, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSubscriptionCriteria(%q) = %v", tt.criteria, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSubscriptionCriteria(%q) = %+v, want %+v", tt.criteria, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSubscriptionCriteriaMalformedID(t *testing.T) {
+	if _, err := parseSubscriptionCriteria("Encounter?patient=Patient/p1"); !errors.Is(err, errNoMatch) {
+		t.Errorf("parseSubscriptionCriteria() = %v, want %v", err, errNoMatch)
+	}
+}
+
+func TestEncounterMatches(t *testing.T) {
+	encounter := models.EncounterWithDetails{Encounter: models.Encounter{
+		ID:             "e1",
+		PatientID:      patientID,
+		PractitionerID: practitionerID,
+		Status:         "in-progress",
+		StartTime:      time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC),
+	}}
+	located := encounter
+	location := locationID
+	located.LocationID = &location
+	identified := encounter
+	identified.Identifiers = []models.Identifier{{System: "urn:his:visit", Value: "V-1001"}, {Value: "local-7"}}
+
+	tests := []struct {
+		name      string
+		criteria  string
+		encounter models.EncounterWithDetails
+		want      bool
+	}{
+		{name: "no criteria", criteria: "Encounter", encounter: encounter, want: true},
+		{name: "patient", criteria: "Encounter?patient=" + patientID, encounter: encounter, want: true},
+		{name: "other patient", criteria: "Encounter?patient=" + otherPatientID, encounter: encounter, want: false},
+		{name: "practitioner", criteria: "Encounter?practitioner=" + practitionerID, encounter: encounter, want: true},
+		{name: "other practitioner", criteria: "Encounter?practitioner=" + otherPractitionerID, encounter: encounter, want: false},
+		{name: "location", criteria: "Encounter?location=" + locationID, encounter: located, want: true},
+		{name: "other location", criteria: "Encounter?location=6a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c02", encounter: located, want: false},
+		{name: "no location", criteria: "Encounter?location=" + locationID, encounter: encounter, want: false},
+		{name: "identifier", criteria: "Encounter?identifier=urn:his:visit|V-1001", encounter: identified, want: true},
+		{name: "identifier value only", criteria: "Encounter?identifier=V-1001", encounter: identified, want: true},
+		{name: "identifier without system", criteria: "Encounter?identifier=|local-7", encounter: identified, want: true},
+		{name: "identifier of another system", criteria: "Encounter?identifier=urn:other|V-1001", encounter: identified, want: false},
+		{name: "other identifier", criteria: "Encounter?identifier=urn:his:visit|V-1002", encounter: identified, want: false},
+		{name: "no identifiers", criteria: "Encounter?identifier=urn:his:visit|V-1001", encounter: encounter, want: false},
+		{name: "status", criteria: "Encounter?status=in-progress", encounter: encounter, want: true},
+		{name: "other status", criteria: "Encounter?status=finished", encounter: encounter, want: false},
+		{name: "started on the day", criteria: "Encounter?date=2024-03-10", encounter: encounter, want: true},
+		{name: "started before the range", criteria: "Encounter?date=ge2024-03-11", encounter: encounter, want: false},
+		{name: "started after the range", criteria: "Encounter?date=lt2024-03-10", encounter: encounter, want: false},
+		{
+			name:      "all criteria match",
+			criteria:  "Encounter?patient=" + patientID + "&practitioner=" + practitionerID + "&status=in-progress",
+			encounter: encounter,
+			want:      true,
+		},
+		{
+			name:      "one criterion fails",
+			criteria:  "Encounter?patient=" + patientID + "&practitioner=" + otherPractitionerID,
+			encounter: encounter,
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parseSubscriptionCriteria(tt.criteria)
+			if err != nil {
+				t.Fatalf("parseSubscriptionCriteria(%q) = %v", tt.criteria, err)
+			}
+			if got := encounterMatches(filter, tt.encounter); got != tt.want {
+				t.Errorf("encounterMatches(%q) = %v, want %v", tt.criteria, got, tt.want)
+			}
+		})
+	}
+}
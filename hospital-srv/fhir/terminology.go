@@ -0,0 +1,85 @@
+package fhir
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	vspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/value_set_go_proto"
+)
+
+const (
+	defaultExpandCount = 20
+	maxExpandCount     = 100
+)
+
+// ExpandValueSet implements ValueSet/$expand for the local ICD-10 code
+// table and medication dictionary, so clients can look up diagnosis and
+// medication codes. url picks the code system and defaults to ICD-10.
+// filter matches code prefixes and display text; count limits the result to
+// at most 100 codes.
+func (s *FHIRServer) ExpandValueSet(c *gin.Context) {
+	valueSetURL := c.DefaultQuery("url", systemICD10)
+	if valueSetURL != systemICD10 && valueSetURL != systemMedication {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unknown value set: %s", valueSetURL)})
+		return
+	}
+
+	count := defaultExpandCount
+	if value := c.Query("count"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid count: %s", value)})
+			return
+		}
+		count = min(n, maxExpandCount)
+	}
+
+	var name string
+	var contains []*vspb.ValueSet_Expansion_Contains
+	switch valueSetURL {
+	case systemICD10:
+		codes, err := s.conditionService.SearchCodes(c.Query("filter"), count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		name = "ICD10"
+		for _, code := range codes {
+			contains = append(contains, expansionCode(systemICD10, code.Code, code.Display))
+		}
+	case systemMedication:
+		medications, err := s.medicationService.SearchMedications(c.Query("filter"), count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		name = "Medications"
+		for _, medication := range medications {
+			contains = append(contains, expansionCode(systemMedication, medication.Code, medication.Display))
+		}
+	}
+
+	writeResource(c, &vspb.ValueSet{
+		Url:    &dtpb.Uri{Value: valueSetURL},
+		Name:   &dtpb.String{Value: name},
+		Status: &vspb.ValueSet_StatusCode{Value: codespb.PublicationStatusCode_ACTIVE},
+		Expansion: &vspb.ValueSet_Expansion{
+			Timestamp: toDateTime(time.Now()),
+			Total:     &dtpb.Integer{Value: int32(len(contains))},
+			Contains:  contains,
+		},
+	})
+}
+
+func expansionCode(system string, code string, display string) *vspb.ValueSet_Expansion_Contains {
+	return &vspb.ValueSet_Expansion_Contains{
+		System:  &dtpb.Uri{Value: system},
+		Code:    &dtpb.Code{Value: code},
+		Display: &dtpb.String{Value: display},
+	}
+}
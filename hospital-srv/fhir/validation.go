@@ -0,0 +1,536 @@
+package fhir
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	paramspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
+	patpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// validationIssue is one finding of the validator, reported as an
+// OperationOutcome issue. code is from the FHIR IssueType value set and
+// expression is the FHIRPath of the offending element.
+type validationIssue struct {
+	severity    string
+	code        string
+	expression  string
+	diagnostics string
+}
+
+const (
+	severityError       = "error"
+	severityWarning     = "warning"
+	severityInformation = "information"
+)
+
+// elementBinding restricts the codes used in a coded element. Codings from
+// other systems are left alone; an empty system applies to code elements,
+// which carry no system.
+type elementBinding struct {
+	path   string
+	system string
+	codes  map[string]bool
+}
+
+// referenceRule requires a reference element to point to an existing
+// resource of targetType.
+type referenceRule struct {
+	path       string
+	targetType string
+}
+
+// constraint is a local StructureDefinition-style invariant. key names it in
+// the diagnostics, expression is the element it is reported on and check
+// reports whether a resource satisfies it.
+type constraint struct {
+	key        string
+	severity   string
+	expression string
+	human      string
+	check      func(resource proto.Message) bool
+}
+
+// profile lists the rules a resource type is validated against before it
+// is stored. Paths are dotted FHIR element names relative to the resource.
+type profile struct {
+	newResource func() proto.Message
+	required    []string
+	bindings    []elementBinding
+	references  []referenceRule
+	constraints []constraint
+}
+
+var profiles = map[string]profile{
+	"Encounter": {
+		newResource: func() proto.Message { return &encpb.Encounter{} },
+		required:    []string{"status", "subject", "participant.individual"},
+		bindings: []elementBinding{
+			{path: "status", codes: encounterStatusSet()},
+			{path: "class", system: systemActCode, codes: displayCodes(encounterClassDisplays)},
+			{path: "priority", system: systemActPriority, codes: displayCodes(encounterPriorityDisplays)},
+		},
+		references: []referenceRule{
+			{path: "subject", targetType: "Patient"},
+			{path: "participant.individual", targetType: "Practitioner"},
+			{path: "location.location", targetType: "Location"},
+		},
+		constraints: []constraint{
+			{
+				key:        "his-enc-1",
+				severity:   severityError,
+				expression: "Encounter.period",
+				human:      "period.end must not be before period.start",
+				check: func(resource proto.Message) bool {
+					period := resource.(*encpb.Encounter).Period
+					return period == nil || period.Start == nil || period.End == nil || period.End.ValueUs >= period.Start.ValueUs
+				},
+			},
+			{
+				key:        "his-enc-2",
+				severity:   severityError,
+				expression: "Encounter.reasonCode",
+				human:      "ICD-10 reason codes must be well-formed",
+				check: func(resource proto.Message) bool {
+					for _, reason := range resource.(*encpb.Encounter).ReasonCode {
+						if code, ok := conceptCode(reason, systemICD10); ok && !icd10Pattern.MatchString(strings.ToUpper(code)) {
+							return false
+						}
+					}
+					return true
+				},
+			},
+			{
+				key:        "his-enc-3",
+				severity:   severityWarning,
+				expression: "Encounter.participant",
+				human:      "only the first participant is recorded",
+				check: func(resource proto.Message) bool {
+					return len(resource.(*encpb.Encounter).Participant) <= 1
+				},
+			},
+			{
+				key:        "his-enc-4",
+				severity:   severityError,
+				expression: "Encounter.identifier",
+				human:      "identifiers must have a value",
+				check: func(resource proto.Message) bool {
+					return identifiersHaveValues(resource.(*encpb.Encounter).Identifier)
+				},
+			},
+		},
+	},
+	"Patient": {
+		newResource: func() proto.Message { return &patpb.Patient{} },
+		required:    []string{"name.family", "name.given", "birthDate"},
+		constraints: []constraint{
+			{
+				key:        "his-pat-1",
+				severity:   severityError,
+				expression: "Patient.birthDate",
+				human:      "birthDate must not be in the future",
+				check: func(resource proto.Message) bool {
+					birthDate := resource.(*patpb.Patient).BirthDate
+					return birthDate == nil || birthDate.ValueUs <= time.Now().UnixMicro()
+				},
+			},
+		},
+	},
+	"Practitioner": {
+		newResource: func() proto.Message { return &practpb.Practitioner{} },
+		required:    []string{"name.family", "name.given", "qualification.code.text"},
+		constraints: []constraint{
+			{
+				key:        "his-prac-1",
+				severity:   severityError,
+				expression: "Practitioner.identifier",
+				human:      "identifiers must have a value",
+				check: func(resource proto.Message) bool {
+					return identifiersHaveValues(resource.(*practpb.Practitioner).Identifier)
+				},
+			},
+		},
+	},
+}
+
+func identifiersHaveValues(identifiers []*dtpb.Identifier) bool {
+	for _, identifier := range identifiers {
+		if identifier.Value == nil || identifier.Value.Value == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// referenceLookup returns sql.ErrNoRows when resourceType/id does not exist.
+type referenceLookup func(resourceType string, id string) error
+
+// validateResource checks resource against the profile of its type.
+func validateResource(resourceType string, resource proto.Message, lookup referenceLookup) []validationIssue {
+	p, ok := profiles[resourceType]
+	if !ok {
+		return []validationIssue{{severity: severityError, code: "not-supported", expression: resourceType, diagnostics: fmt.Sprintf("no profile for resource type %s", resourceType)}}
+	}
+
+	var issues []validationIssue
+	msg := resource.ProtoReflect()
+
+	for _, path := range p.required {
+		if len(presentElements(msg, path)) == 0 {
+			issues = append(issues, validationIssue{
+				severity:    severityError,
+				code:        "required",
+				expression:  resourceType + "." + path,
+				diagnostics: fmt.Sprintf("%s.%s is required", resourceType, path),
+			})
+		}
+	}
+
+	for _, b := range p.bindings {
+		for _, element := range presentElements(msg, b.path) {
+			for _, c := range elementCodings(element) {
+				if c.system != b.system || b.codes[c.code] {
+					continue
+				}
+				issues = append(issues, validationIssue{
+					severity:    severityError,
+					code:        "code-invalid",
+					expression:  resourceType + "." + b.path,
+					diagnostics: fmt.Sprintf("unsupported code %q for %s.%s", c.code, resourceType, b.path),
+				})
+			}
+		}
+	}
+
+	for _, r := range p.references {
+		for _, element := range presentElements(msg, r.path) {
+			if issue, ok := checkReference(resourceType+"."+r.path, element, r.targetType, lookup); !ok {
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	for _, c := range p.constraints {
+		if !c.check(resource) {
+			issues = append(issues, validationIssue{
+				severity:    c.severity,
+				code:        "invariant",
+				expression:  c.expression,
+				diagnostics: fmt.Sprintf("%s: %s", c.key, c.human),
+			})
+		}
+	}
+
+	return issues
+}
+
+func checkReference(expression string, element protoreflect.Message, targetType string, lookup referenceLookup) (validationIssue, bool) {
+	ref, _ := element.Interface().(*dtpb.Reference)
+	id, ok := referencedID(ref, targetType)
+	if !ok {
+		return validationIssue{
+			severity:    severityError,
+			code:        "invalid",
+			expression:  expression,
+			diagnostics: fmt.Sprintf("%s must reference a %s", expression, targetType),
+		}, false
+	}
+
+	var err error
+	if idPattern.MatchString(id) {
+		err = lookup(targetType, id)
+	} else {
+		err = sql.ErrNoRows
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return validationIssue{
+			severity:    severityError,
+			code:        "not-found",
+			expression:  expression,
+			diagnostics: fmt.Sprintf("%s/%s does not exist", targetType, id),
+		}, false
+	case err != nil:
+		return validationIssue{
+			severity:    severityError,
+			code:        "exception",
+			expression:  expression,
+			diagnostics: fmt.Sprintf("failed to resolve %s/%s: %v", targetType, id, err),
+		}, false
+	}
+	return validationIssue{}, true
+}
+
+// presentElements returns the elements at path, flattening repeated
+// elements along the way. Primitives with an empty value count as absent.
+func presentElements(msg protoreflect.Message, path string) []protoreflect.Message {
+	current := []protoreflect.Message{msg}
+	for _, name := range strings.Split(path, ".") {
+		var next []protoreflect.Message
+		for _, m := range current {
+			field := m.Descriptor().Fields().ByJSONName(name)
+			if field == nil || field.Message() == nil || !m.Has(field) {
+				continue
+			}
+			if field.IsList() {
+				list := m.Get(field).List()
+				for i := 0; i < list.Len(); i++ {
+					next = append(next, list.Get(i).Message())
+				}
+				continue
+			}
+			next = append(next, m.Get(field).Message())
+		}
+		current = next
+	}
+
+	present := current[:0]
+	for _, m := range current {
+		if value := m.Descriptor().Fields().ByName("value"); value != nil && value.Kind() == protoreflect.StringKind && m.Get(value).String() == "" {
+			continue
+		}
+		present = append(present, m)
+	}
+	return present
+}
+
+type elementCoding struct {
+	system string
+	code   string
+}
+
+// elementCodings returns the codings of a Coding, a CodeableConcept or a
+// code element; code elements have no system.
+func elementCodings(element protoreflect.Message) []elementCoding {
+	switch v := element.Interface().(type) {
+	case *dtpb.Coding:
+		return []elementCoding{codingOf(v)}
+	case *dtpb.CodeableConcept:
+		codings := make([]elementCoding, 0, len(v.Coding))
+		for _, c := range v.Coding {
+			codings = append(codings, codingOf(c))
+		}
+		return codings
+	}
+
+	value := element.Descriptor().Fields().ByName("value")
+	if value == nil || value.Kind() != protoreflect.EnumKind {
+		return nil
+	}
+	enum := value.Enum().Values().ByNumber(element.Get(value).Enum())
+	if enum == nil {
+		return nil
+	}
+	return []elementCoding{{code: enumCode(enum.Name())}}
+}
+
+func codingOf(c *dtpb.Coding) elementCoding {
+	var coding elementCoding
+	if c.System != nil {
+		coding.system = c.System.Value
+	}
+	if c.Code != nil {
+		coding.code = c.Code.Value
+	}
+	return coding
+}
+
+// enumCode turns a proto enum name such as IN_PROGRESS into its FHIR code.
+func enumCode(name protoreflect.Name) string {
+	return strings.ToLower(strings.ReplaceAll(string(name), "_", "-"))
+}
+
+func displayCodes(displays map[string]string) map[string]bool {
+	codes := make(map[string]bool, len(displays))
+	for code := range displays {
+		codes[code] = true
+	}
+	return codes
+}
+
+func encounterStatusSet() map[string]bool {
+	codes := make(map[string]bool, len(encounterStatusCodes))
+	for _, status := range encounterStatusCodes {
+		codes[enumCode(status.Descriptor().Values().ByNumber(status.Number()).Name())] = true
+	}
+	return codes
+}
+
+func hasErrors(issues []validationIssue) bool {
+	for _, issue := range issues {
+		if issue.severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+// issuesMessage joins the diagnostics of the error issues for responses
+// that carry a single message.
+func issuesMessage(issues []validationIssue) string {
+	var messages []string
+	for _, issue := range issues {
+		if issue.severity == severityError {
+			messages = append(messages, issue.diagnostics)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+func operationOutcome(issues []validationIssue) map[string]interface{} {
+	entries := make([]map[string]interface{}, 0, len(issues))
+	for _, issue := range issues {
+		entry := map[string]interface{}{
+			"severity":    issue.severity,
+			"code":        issue.code,
+			"diagnostics": issue.diagnostics,
+		}
+		if issue.expression != "" {
+			entry["expression"] = []string{issue.expression}
+		}
+		entries = append(entries, entry)
+	}
+
+	return map[string]interface{}{
+		"resourceType": "OperationOutcome",
+		"issue":        entries,
+	}
+}
+
+// lookupReference resolves references against the committed data.
+func (s *FHIRServer) lookupReference(resourceType string, id string) error {
+	var err error
+	switch resourceType {
+	case "Patient":
+		_, err = s.patientService.GetPatientByID(id)
+	case "Practitioner":
+		_, err = s.practitionerService.GetPractitionerByID(id)
+	case "Location":
+		_, err = s.organizationService.GetLocationByID(id)
+	case "Organization":
+		_, err = s.organizationService.GetOrganizationByID(id)
+	default:
+		err = fmt.Errorf("cannot resolve references to %s", resourceType)
+	}
+	return err
+}
+
+// validate checks resource and writes a 422 OperationOutcome when it has
+// errors. It reports whether the request may go ahead.
+func (s *FHIRServer) validate(c *gin.Context, resourceType string, resource proto.Message) bool {
+	issues := validateResource(resourceType, resource, s.lookupReference)
+	if hasErrors(issues) {
+		c.JSON(http.StatusUnprocessableEntity, operationOutcome(issues))
+		return false
+	}
+	return true
+}
+
+// Validate implements $validate for the profiled resource types. The body
+// is the resource itself or a Parameters resource with a "resource"
+// parameter. The outcome is always returned with 200; only a request that
+// cannot be read at all is rejected.
+func (s *FHIRServer) Validate(c *gin.Context) {
+	resourceType := strings.SplitN(strings.TrimPrefix(c.FullPath(), fhirBasePath+"/"), "/", 2)[0]
+	p, ok := profiles[resourceType]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("$validate is not supported for %s", resourceType)})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+		return
+	}
+
+	resource, err := validateParameter(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var issues []validationIssue
+	if bodyType, rest, err := splitResourceType(resource); err == nil {
+		if bodyType != resourceType {
+			issues = append(issues, validationIssue{severity: severityError, code: "invalid", expression: resourceType, diagnostics: fmt.Sprintf("expected a %s, got a %s", resourceType, bodyType)})
+		}
+		resource = rest
+	}
+
+	msg := p.newResource()
+	if err := protojson.Unmarshal(resource, msg); err != nil {
+		issues = append(issues, validationIssue{severity: severityError, code: "structure", expression: resourceType, diagnostics: fmt.Sprintf("Invalid FHIR %s format: %v", resourceType, err)})
+	} else {
+		issues = append(issues, validateResource(resourceType, msg, s.lookupReference)...)
+	}
+
+	if len(issues) == 0 {
+		issues = append(issues, validationIssue{severity: severityInformation, code: "informational", diagnostics: "All OK"})
+	}
+	c.JSON(http.StatusOK, operationOutcome(issues))
+}
+
+// validateParameter returns the resource to validate from a $validate
+// body, unwrapping a Parameters resource.
+func validateParameter(body []byte) (json.RawMessage, error) {
+	var parameters struct {
+		ResourceType string `json:"resourceType"`
+		Parameter    []struct {
+			Name     string          `json:"name"`
+			Resource json.RawMessage `json:"resource"`
+		} `json:"parameter"`
+	}
+	if err := json.Unmarshal(body, &parameters); err != nil {
+		return protojsonParameter(body)
+	}
+	if parameters.ResourceType != "Parameters" {
+		return body, nil
+	}
+
+	for _, p := range parameters.Parameter {
+		if p.Name == "resource" && len(p.Resource) > 0 {
+			return p.Resource, nil
+		}
+	}
+	return nil, errors.New("Parameters must have a resource parameter")
+}
+
+// protojsonParameter returns the resource parameter of a Parameters
+// resource in protojson, the form of Parameters sent as FHIR XML.
+func protojsonParameter(body []byte) (json.RawMessage, error) {
+	var parameters paramspb.Parameters
+	if err := protojson.Unmarshal(body, &parameters); err != nil {
+		return nil, errors.New("body must be a JSON resource")
+	}
+
+	for _, p := range parameters.GetParameter() {
+		if p.GetName().GetValue() != "resource" || p.GetResource() == nil {
+			continue
+		}
+		resource, err := unpackResource(p.GetResource())
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource parameter: %v", err)
+		}
+		resourceMap, err := protoToMap(resource.Interface())
+		if err != nil {
+			return nil, err
+		}
+		resourceMap["resourceType"] = string(resource.Descriptor().Name())
+		return json.Marshal(resourceMap)
+	}
+	return nil, errors.New("Parameters must have a resource parameter")
+}
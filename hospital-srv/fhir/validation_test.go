@@ -0,0 +1,218 @@
+package fhir
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
+	patpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/patient_go_proto"
+)
+
+// knownReferences resolves only the test patient and practitioner.
+func knownReferences(resourceType string, id string) error {
+	if (resourceType == "Patient" && id == patientID) || (resourceType == "Practitioner" && id == practitionerID) {
+		return nil
+	}
+	return sql.ErrNoRows
+}
+
+func validEncounter() *encpb.Encounter {
+	start := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+	return &encpb.Encounter{
+		Status:      &encpb.Encounter_StatusCode{Value: codespb.EncounterStatusCode_PLANNED},
+		ClassValue:  coding(systemActCode, "AMB", ""),
+		Subject:     reference("Patient", patientID),
+		Participant: []*encpb.Encounter_Participant{{Individual: reference("Practitioner", practitionerID)}},
+		Period: &dtpb.Period{
+			Start: &dtpb.DateTime{ValueUs: start.UnixMicro(), Precision: dtpb.DateTime_SECOND},
+			End:   &dtpb.DateTime{ValueUs: start.Add(30 * time.Minute).UnixMicro(), Precision: dtpb.DateTime_SECOND},
+		},
+	}
+}
+
+func TestValidateEncounter(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(e *encpb.Encounter)
+		wantCode   string
+		wantErrors bool
+	}{
+		{name: "valid", modify: func(e *encpb.Encounter) {}},
+		{name: "no status", modify: func(e *encpb.Encounter) { e.Status = nil }, wantCode: "required", wantErrors: true},
+		{name: "no subject", modify: func(e *encpb.Encounter) { e.Subject = nil }, wantCode: "required", wantErrors: true},
+		{
+			name:       "unsupported class",
+			modify:     func(e *encpb.Encounter) { e.ClassValue = coding(systemActCode, "FLD", "") },
+			wantCode:   "code-invalid",
+			wantErrors: true,
+		},
+		{
+			name:   "class from another system",
+			modify: func(e *encpb.Encounter) { e.ClassValue = coding("http://example.org/class", "FLD", "") },
+		},
+		{
+			name:       "subject is not a Patient",
+			modify:     func(e *encpb.Encounter) { e.Subject = reference("Practitioner", practitionerID) },
+			wantCode:   "invalid",
+			wantErrors: true,
+		},
+		{
+			name:       "unknown patient",
+			modify:     func(e *encpb.Encounter) { e.Subject = reference("Patient", otherPatientID) },
+			wantCode:   "not-found",
+			wantErrors: true,
+		},
+		{
+			name:       "malformed id",
+			modify:     func(e *encpb.Encounter) { e.Subject = reference("Patient", "p1") },
+			wantCode:   "not-found",
+			wantErrors: true,
+		},
+		{
+			name:       "period ends before it starts",
+			modify:     func(e *encpb.Encounter) { e.Period.End.ValueUs = e.Period.Start.ValueUs - 1 },
+			wantCode:   "invariant",
+			wantErrors: true,
+		},
+		{
+			name: "invalid ICD-10 reason",
+			modify: func(e *encpb.Encounter) {
+				e.ReasonCode = []*dtpb.CodeableConcept{{Coding: []*dtpb.Coding{coding(systemICD10, "chest pain", "")}}}
+			},
+			wantCode:   "invariant",
+			wantErrors: true,
+		},
+		{
+			name: "identifier without a value",
+			modify: func(e *encpb.Encounter) {
+				e.Identifier = []*dtpb.Identifier{{System: &dtpb.Uri{Value: "urn:reception:visit"}}}
+			},
+			wantCode:   "invariant",
+			wantErrors: true,
+		},
+		{
+			name: "second participant",
+			modify: func(e *encpb.Encounter) {
+				e.Participant = append(e.Participant, &encpb.Encounter_Participant{Individual: reference("Practitioner", practitionerID)})
+			},
+			wantCode: "invariant",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encounter := validEncounter()
+			tt.modify(encounter)
+
+			issues := validateResource("Encounter", encounter, knownReferences)
+			if got := hasErrors(issues); got != tt.wantErrors {
+				t.Fatalf("hasErrors() = %v, want %v: %+v", got, tt.wantErrors, issues)
+			}
+			if tt.wantCode == "" {
+				if len(issues) != 0 {
+					t.Errorf("issues = %+v, want none", issues)
+				}
+				return
+			}
+			if len(issues) != 1 || issues[0].code != tt.wantCode {
+				t.Errorf("issues = %+v, want one %s issue", issues, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestValidatePatient(t *testing.T) {
+	patient := &patpb.Patient{
+		Name: []*dtpb.HumanName{{
+			Family: &dtpb.String{Value: "Ivanov"},
+			Given:  []*dtpb.String{{Value: "Ivan"}},
+		}},
+		BirthDate: &dtpb.Date{ValueUs: time.Now().Add(24 * time.Hour).UnixMicro(), Precision: dtpb.Date_DAY},
+	}
+
+	issues := validateResource("Patient", patient, knownReferences)
+	if len(issues) != 1 || issues[0].diagnostics != "his-pat-1: birthDate must not be in the future" {
+		t.Errorf("issues = %+v, want his-pat-1", issues)
+	}
+
+	patient.Name[0].Family = &dtpb.String{}
+	patient.BirthDate = nil
+	issues = validateResource("Patient", patient, knownReferences)
+	want := "Patient.name.family is required; Patient.birthDate is required"
+	if got := issuesMessage(issues); got != want {
+		t.Errorf("issuesMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateUnsupportedType(t *testing.T) {
+	issues := validateResource("Condition", validEncounter(), knownReferences)
+	if len(issues) != 1 || issues[0].code != "not-supported" {
+		t.Errorf("issues = %+v, want not-supported", issues)
+	}
+}
+
+func TestCheckReferenceLookupFailure(t *testing.T) {
+	lookup := func(string, string) error { return errors.New("connection refused") }
+
+	issue, ok := checkReference("Encounter.subject", reference("Patient", patientID).ProtoReflect(), "Patient", lookup)
+	if ok || issue.code != "exception" {
+		t.Errorf("checkReference() = %+v, %v, want an exception issue", issue, ok)
+	}
+}
+
+func TestOperationOutcome(t *testing.T) {
+	outcome := operationOutcome([]validationIssue{
+		{severity: severityError, code: "required", expression: "Encounter.status", diagnostics: "Encounter.status is required"},
+		{severity: severityInformation, code: "informational", diagnostics: "All OK"},
+	})
+
+	if outcome["resourceType"] != "OperationOutcome" {
+		t.Errorf("resourceType = %v, want OperationOutcome", outcome["resourceType"])
+	}
+	issues := outcome["issue"].([]map[string]interface{})
+	if len(issues) != 2 {
+		t.Fatalf("got %d issues, want 2", len(issues))
+	}
+	if expression, ok := issues[0]["expression"].([]string); !ok || len(expression) != 1 || expression[0] != "Encounter.status" {
+		t.Errorf("expression = %v, want [Encounter.status]", issues[0]["expression"])
+	}
+	if _, ok := issues[1]["expression"]; ok {
+		t.Errorf("issue without expression has one: %v", issues[1])
+	}
+}
+
+func TestValidateParameter(t *testing.T) {
+	resource := `{"resourceType":"Patient","birthDate":{"valueUs":"0"}}`
+
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{name: "bare resource", body: resource, want: resource},
+		{
+			name: "Parameters",
+			body: `{"resourceType":"Parameters","parameter":[{"name":"mode","valueCode":"create"},{"name":"resource","resource":` + resource + `}]}`,
+			want: resource,
+		},
+		{name: "Parameters without a resource", body: `{"resourceType":"Parameters","parameter":[]}`, wantErr: true},
+		{name: "not JSON", body: `Patient`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := validateParameter([]byte(tt.body))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateParameter() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if strings.TrimSpace(string(got)) != tt.want {
+			t.Errorf("%s: validateParameter() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
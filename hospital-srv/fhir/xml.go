@@ -0,0 +1,762 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	annotationspb "github.com/google/fhir/go/proto/google/fhir/proto/annotations_go_proto"
+	bcrpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/bundle_and_contained_resource_go_proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// FHIR XML is read and written by walking the descriptors of the google/fhir
+// protos, the same way protojson walks them for JSON. Elements are named
+// after the JSON names of the fields, which are the FHIR element names.
+
+const (
+	fhirNamespace  = "http://hl7.org/fhir"
+	xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+
+	choiceOneof    = "choice"
+	referenceOneof = "reference"
+	resourceOneof  = "oneof_resource"
+)
+
+const (
+	extensionMessage = protoreflect.FullName("google.fhir.r4.core.Extension")
+	referenceMessage = protoreflect.FullName("google.fhir.r4.core.Reference")
+	xhtmlMessage     = protoreflect.FullName("google.fhir.r4.core.Xhtml")
+)
+
+// resourceFields maps each resource type to its field in ContainedResource,
+// which has one for every resource of FHIR R4.
+var resourceFields = func() map[string]protoreflect.FieldDescriptor {
+	oneof := (&bcrpb.ContainedResource{}).ProtoReflect().Descriptor().Oneofs().ByName(resourceOneof)
+	fields := make(map[string]protoreflect.FieldDescriptor, oneof.Fields().Len())
+	for i := 0; i < oneof.Fields().Len(); i++ {
+		fd := oneof.Fields().Get(i)
+		fields[string(fd.Message().Name())] = fd
+	}
+	return fields
+}()
+
+// newResource returns an empty resource of resourceType.
+func newResource(resourceType string) (protoreflect.Message, error) {
+	fd, ok := resourceFields[resourceType]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource type %q", resourceType)
+	}
+	return (&bcrpb.ContainedResource{}).ProtoReflect().NewField(fd).Message(), nil
+}
+
+func isResource(md protoreflect.MessageDescriptor) bool {
+	fd, ok := resourceFields[string(md.Name())]
+	return ok && fd.Message().FullName() == md.FullName()
+}
+
+// containedResource returns the resource held by a ContainedResource.
+func containedResource(contained protoreflect.Message) (protoreflect.Message, error) {
+	fd := contained.WhichOneof(contained.Descriptor().Oneofs().ByName(resourceOneof))
+	if fd == nil {
+		return nil, errors.New("contained resource is empty")
+	}
+	return contained.Get(fd).Message(), nil
+}
+
+// unpackResource returns the resource packed into an Any, either directly
+// or inside a ContainedResource.
+func unpackResource(packed *anypb.Any) (protoreflect.Message, error) {
+	msg, err := packed.UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+	if contained, ok := msg.(*bcrpb.ContainedResource); ok {
+		return containedResource(contained.ProtoReflect())
+	}
+	if !isResource(msg.ProtoReflect().Descriptor()) {
+		return nil, fmt.Errorf("%s is not a resource", msg.ProtoReflect().Descriptor().Name())
+	}
+	return msg.ProtoReflect(), nil
+}
+
+func isChoice(md protoreflect.MessageDescriptor) bool {
+	return md.Oneofs().ByName(choiceOneof) != nil
+}
+
+// isPrimitive reports whether md is a FHIR primitive type, which is
+// written as a value attribute.
+func isPrimitive(md protoreflect.MessageDescriptor) bool {
+	if md.Fields().ByName("value_us") != nil {
+		return true
+	}
+	value := md.Fields().ByName("value")
+	return value != nil && value.Kind() != protoreflect.MessageKind
+}
+
+// isAttribute reports whether fd of md is written as an XML attribute
+// rather than a child element: the id of anything but a resource and the
+// url of an extension.
+func isAttribute(md protoreflect.MessageDescriptor, fd protoreflect.FieldDescriptor) bool {
+	switch fd.Name() {
+	case "id":
+		return !isResource(md)
+	case "url":
+		return md.FullName() == extensionMessage
+	}
+	return false
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// enumValueCode returns the FHIR code of an enum value.
+func enumValueCode(v protoreflect.EnumValueDescriptor) string {
+	if code, ok := proto.GetExtension(v.Options(), annotationspb.E_FhirOriginalCode).(string); ok && code != "" {
+		return code
+	}
+	return enumCode(v.Name())
+}
+
+func enumValueByCode(ed protoreflect.EnumDescriptor, code string) (protoreflect.EnumValueDescriptor, bool) {
+	values := ed.Values()
+	for i := 0; i < values.Len(); i++ {
+		if v := values.Get(i); v.Number() != 0 && enumValueCode(v) == code {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// marshalXML writes resource as a FHIR XML document.
+func marshalXML(resource proto.Message) ([]byte, error) {
+	w := &xmlWriter{}
+	w.WriteString(xml.Header)
+	if err := w.resource(resource.ProtoReflect(), true); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+type xmlWriter struct {
+	bytes.Buffer
+}
+
+func (w *xmlWriter) attr(name string, value string) {
+	w.WriteString(" " + name + `="`)
+	xml.EscapeText(w, []byte(value))
+	w.WriteByte('"')
+}
+
+func (w *xmlWriter) resource(m protoreflect.Message, root bool) error {
+	name := string(m.Descriptor().Name())
+	w.WriteString("<" + name)
+	if root {
+		w.attr("xmlns", fhirNamespace)
+	}
+	w.WriteString(">")
+	if err := w.fields(m); err != nil {
+		return err
+	}
+	w.WriteString("</" + name + ">")
+	return nil
+}
+
+// fields writes the child elements of m in the order of its descriptor,
+// which is the order FHIR defines.
+func (w *xmlWriter) fields(m protoreflect.Message) error {
+	md := m.Descriptor()
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if err := w.field(m, fields.Get(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *xmlWriter) field(m protoreflect.Message, fd protoreflect.FieldDescriptor) error {
+	if isAttribute(m.Descriptor(), fd) || !m.Has(fd) {
+		return nil
+	}
+	if fd.Kind() != protoreflect.MessageKind {
+		return fmt.Errorf("unexpected field %s", fd.FullName())
+	}
+
+	if !fd.IsList() {
+		return w.element(fd.JSONName(), m.Get(fd).Message())
+	}
+	list := m.Get(fd).List()
+	for i := 0; i < list.Len(); i++ {
+		if err := w.element(fd.JSONName(), list.Get(i).Message()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *xmlWriter) element(name string, m protoreflect.Message) error {
+	md := m.Descriptor()
+	switch {
+	case md.FullName() == xhtmlMessage:
+		w.xhtml(m.Get(md.Fields().ByName("value")).String())
+		return nil
+	case md.FullName() == referenceMessage:
+		return w.reference(name, m)
+	case isChoice(md):
+		fd := m.WhichOneof(md.Oneofs().ByName(choiceOneof))
+		if fd == nil {
+			return nil
+		}
+		return w.element(name+upperFirst(fd.JSONName()), m.Get(fd).Message())
+	case md.Oneofs().ByName(resourceOneof) != nil:
+		resource, err := containedResource(m)
+		if err != nil {
+			return err
+		}
+		w.WriteString("<" + name + ">")
+		if err := w.resource(resource, false); err != nil {
+			return err
+		}
+		w.WriteString("</" + name + ">")
+		return nil
+	case md.FullName() == (&anypb.Any{}).ProtoReflect().Descriptor().FullName():
+		resource, err := unpackResource(m.Interface().(*anypb.Any))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		w.WriteString("<" + name + ">")
+		if err := w.resource(resource, false); err != nil {
+			return err
+		}
+		w.WriteString("</" + name + ">")
+		return nil
+	}
+
+	w.WriteString("<" + name)
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if isAttribute(md, fd) && m.Has(fd) {
+			w.attr(fd.JSONName(), m.Get(fd).Message().Get(fd.Message().Fields().ByName("value")).String())
+		}
+	}
+
+	children := &xmlWriter{}
+	if isPrimitive(md) {
+		value, ok, err := primitiveValue(m)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		if ok {
+			w.attr("value", value)
+		}
+		if extension := fields.ByName("extension"); extension != nil {
+			if err := children.field(m, extension); err != nil {
+				return err
+			}
+		}
+	} else if err := children.fields(m); err != nil {
+		return err
+	}
+
+	if children.Len() == 0 {
+		w.WriteString("/>")
+		return nil
+	}
+	w.WriteString(">")
+	w.Write(children.Bytes())
+	w.WriteString("</" + name + ">")
+	return nil
+}
+
+// xhtml writes the div of a narrative, which is kept as XHTML markup.
+func (w *xmlWriter) xhtml(div string) {
+	if start, _, ok := strings.Cut(div, ">"); ok && strings.HasPrefix(start, "<div") && !strings.Contains(start, "xmlns") {
+		div = `<div xmlns="` + xhtmlNamespace + `"` + strings.TrimPrefix(div, "<div")
+	}
+	w.WriteString(div)
+}
+
+// reference writes a Reference with the reference element referenceValue
+// gives.
+func (w *xmlWriter) reference(name string, m protoreflect.Message) error {
+	md := m.Descriptor()
+	fields := md.Fields()
+
+	w.WriteString("<" + name)
+	if id := fields.ByName("id"); m.Has(id) {
+		w.attr("id", m.Get(id).Message().Get(id.Message().Fields().ByName("value")).String())
+	}
+	w.WriteString(">")
+
+	if err := w.field(m, fields.ByName("extension")); err != nil {
+		return err
+	}
+
+	if value, ok := referenceValue(m); ok {
+		w.WriteString("<reference")
+		w.attr("value", value)
+		w.WriteString("/>")
+	}
+
+	oneof := md.Oneofs().ByName(referenceOneof)
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Name() == "id" || fd.Name() == "extension" || fd.ContainingOneof() == oneof {
+			continue
+		}
+		if err := w.field(m, fd); err != nil {
+			return err
+		}
+	}
+
+	w.WriteString("</" + name + ">")
+	return nil
+}
+
+// referenceValue returns the reference element of a Reference, which is
+// held by one of the typed fields of its oneof, e.g. patient_id for
+// "Patient/123". It reports false when the Reference has none.
+func referenceValue(m protoreflect.Message) (string, bool) {
+	fd := m.WhichOneof(m.Descriptor().Oneofs().ByName(referenceOneof))
+	if fd == nil {
+		return "", false
+	}
+
+	target := m.Get(fd).Message()
+	value := target.Get(target.Descriptor().Fields().ByName("value")).String()
+	switch fd.Name() {
+	case "uri":
+	case "fragment":
+		value = "#" + value
+	default:
+		referenced, _ := proto.GetExtension(fd.Options(), annotationspb.E_ReferencedFhirType).(string)
+		value = referenced + "/" + value
+		if history := target.Descriptor().Fields().ByName("history"); history != nil && target.Has(history) {
+			value += "/_history/" + target.Get(history).Message().Get(history.Message().Fields().ByName("value")).String()
+		}
+	}
+	return value, true
+}
+
+// primitiveValue returns the value attribute of a primitive, or false when
+// it has none.
+func primitiveValue(m protoreflect.Message) (string, bool, error) {
+	md := m.Descriptor()
+	if md.Fields().ByName("value_us") != nil {
+		value, err := formatTemporal(m)
+		return value, err == nil, err
+	}
+
+	fd := md.Fields().ByName("value")
+	v := m.Get(fd)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return v.String(), v.String() != "", nil
+	case protoreflect.BoolKind:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes()), len(v.Bytes()) > 0, nil
+	case protoreflect.EnumKind:
+		if v.Enum() == 0 {
+			return "", false, nil
+		}
+		ev := fd.Enum().Values().ByNumber(v.Enum())
+		if ev == nil {
+			return "", false, fmt.Errorf("unknown code %d", v.Enum())
+		}
+		return enumValueCode(ev), true, nil
+	}
+	return "", false, fmt.Errorf("unsupported value of %s", md.Name())
+}
+
+func precisionName(m protoreflect.Message) string {
+	fd := m.Descriptor().Fields().ByName("precision")
+	if fd == nil {
+		return ""
+	}
+	if v := fd.Enum().Values().ByNumber(m.Get(fd).Enum()); v != nil {
+		return string(v.Name())
+	}
+	return ""
+}
+
+func fractionLayout(precision string) string {
+	switch precision {
+	case "MILLISECOND":
+		return ".000"
+	case "MICROSECOND":
+		return ".000000"
+	}
+	return ""
+}
+
+// zoneLocation returns the location of a timezone as stored in the date
+// protos: an IANA name such as "UTC" or an offset such as "+03:00".
+func zoneLocation(timezone string) *time.Location {
+	switch timezone {
+	case "", "Z", "UTC":
+		return time.UTC
+	}
+	if t, err := time.Parse("-07:00", timezone); err == nil {
+		_, offset := t.Zone()
+		return time.FixedZone(timezone, offset)
+	}
+	if loc, err := time.LoadLocation(timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// formatTemporal formats a date, dateTime, instant or time to the
+// precision it was recorded with.
+func formatTemporal(m protoreflect.Message) (string, error) {
+	md := m.Descriptor()
+	us := m.Get(md.Fields().ByName("value_us")).Int()
+	precision := precisionName(m)
+
+	if md.Name() == "Time" {
+		return time.UnixMicro(us).UTC().Format("15:04:05" + fractionLayout(precision)), nil
+	}
+
+	loc := time.UTC
+	if fd := md.Fields().ByName("timezone"); fd != nil {
+		loc = zoneLocation(m.Get(fd).String())
+	}
+	t := time.UnixMicro(us).In(loc)
+
+	switch precision {
+	case "YEAR":
+		return t.Format("2006"), nil
+	case "MONTH":
+		return t.Format("2006-01"), nil
+	case "DAY":
+		return t.Format("2006-01-02"), nil
+	}
+	if md.Name() == "Date" {
+		return t.Format("2006-01-02"), nil
+	}
+	return t.Format("2006-01-02T15:04:05" + fractionLayout(precision) + "Z07:00"), nil
+}
+
+// parseTemporal sets a date, dateTime, instant or time from its FHIR
+// string form, keeping the precision and timezone it was given with.
+func parseTemporal(m protoreflect.Message, value string) error {
+	md := m.Descriptor()
+
+	var t time.Time
+	var precision, timezone string
+	var err error
+	switch {
+	case md.Name() == "Time":
+		t, err = time.Parse("15:04:05.999999", value)
+		t = time.Date(1970, 1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		precision = fractionPrecision(value)
+	case len(value) == 4:
+		t, err = time.Parse("2006", value)
+		precision, timezone = "YEAR", "UTC"
+	case len(value) == 7:
+		t, err = time.Parse("2006-01", value)
+		precision, timezone = "MONTH", "UTC"
+	case len(value) == 10:
+		t, err = time.Parse("2006-01-02", value)
+		precision, timezone = "DAY", "UTC"
+	default:
+		t, err = time.Parse(time.RFC3339Nano, value)
+		precision = fractionPrecision(value)
+		timezone = "UTC"
+		if !strings.HasSuffix(value, "Z") {
+			timezone = value[len(value)-len("-07:00"):]
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", strings.ToLower(string(md.Name())), value)
+	}
+
+	fields := md.Fields()
+	m.Set(fields.ByName("value_us"), protoreflect.ValueOfInt64(t.UnixMicro()))
+	if fd := fields.ByName("timezone"); fd != nil && timezone != "" {
+		m.Set(fd, protoreflect.ValueOfString(timezone))
+	}
+	if fd := fields.ByName("precision"); fd != nil {
+		v := fd.Enum().Values().ByName(protoreflect.Name(precision))
+		if v == nil {
+			return fmt.Errorf("invalid %s %q", strings.ToLower(string(md.Name())), value)
+		}
+		m.Set(fd, protoreflect.ValueOfEnum(v.Number()))
+	}
+	return nil
+}
+
+func fractionPrecision(value string) string {
+	_, fraction, ok := strings.Cut(value, ".")
+	if !ok {
+		return "SECOND"
+	}
+	digits := len(fraction) - len(strings.TrimLeft(fraction, "0123456789"))
+	if digits <= 3 {
+		return "MILLISECOND"
+	}
+	return "MICROSECOND"
+}
+
+// xmlElement is an element of a FHIR XML document. Attributes other than
+// value are kept as child elements, so that the id of a datatype and the
+// url of an extension are read like any other element. Resources already
+// decoded from protojson are carried in resource.
+type xmlElement struct {
+	name     string
+	value    string
+	div      string
+	children []*xmlElement
+	resource protoreflect.Message
+}
+
+// parseXML reads a FHIR XML document into its root element.
+func parseXML(data []byte) (*xmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var root *xmlElement
+	var stack []*xmlElement
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space != "" && t.Name.Space != fhirNamespace && t.Name.Space != xhtmlNamespace {
+				return nil, fmt.Errorf("element %s is not in the FHIR namespace", t.Name.Local)
+			}
+
+			if t.Name.Local == "div" && len(stack) > 0 {
+				if err := decoder.Skip(); err != nil {
+					return nil, err
+				}
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, &xmlElement{name: "div", div: string(data[offset:decoder.InputOffset()])})
+				continue
+			}
+
+			e := &xmlElement{name: t.Name.Local}
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns":
+				case attr.Name.Local == "value":
+					e.value = attr.Value
+				default:
+					e.children = append(e.children, &xmlElement{name: attr.Name.Local, value: attr.Value})
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root != nil {
+				return nil, errors.New("document has more than one root element")
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			root = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("document is empty")
+	}
+	return root, nil
+}
+
+// unmarshalResource decodes the resource in e, named after its type.
+func unmarshalResource(e *xmlElement) (protoreflect.Message, error) {
+	if e.resource != nil {
+		return e.resource, nil
+	}
+	m, err := newResource(e.name)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeFields(m, e); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fieldForElement returns the field of md an element is read into. For a
+// choice element such as valueString the choice type is returned as well.
+func fieldForElement(md protoreflect.MessageDescriptor, name string) (protoreflect.FieldDescriptor, protoreflect.FieldDescriptor) {
+	fields := md.Fields()
+	if fd := fields.ByJSONName(name); fd != nil {
+		return fd, nil
+	}
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Kind() != protoreflect.MessageKind || !isChoice(fd.Message()) {
+			continue
+		}
+		suffix, ok := strings.CutPrefix(name, fd.JSONName())
+		if !ok {
+			continue
+		}
+		choices := fd.Message().Oneofs().ByName(choiceOneof).Fields()
+		for j := 0; j < choices.Len(); j++ {
+			if upperFirst(choices.Get(j).JSONName()) == suffix {
+				return fd, choices.Get(j)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// decodeFields reads the child elements of e into m.
+func decodeFields(m protoreflect.Message, e *xmlElement) error {
+	md := m.Descriptor()
+	for _, child := range e.children {
+		fd, choice := fieldForElement(md, child.name)
+		if fd == nil || fd.Kind() != protoreflect.MessageKind {
+			return fmt.Errorf("unknown element %s in %s", child.name, md.Name())
+		}
+
+		var target protoreflect.Message
+		if fd.IsList() {
+			list := m.Mutable(fd).List()
+			v := list.NewElement()
+			list.Append(v)
+			target = v.Message()
+		} else {
+			if m.Has(fd) {
+				return fmt.Errorf("element %s repeated in %s", child.name, md.Name())
+			}
+			target = m.Mutable(fd).Message()
+		}
+		if choice != nil {
+			target = target.Mutable(choice).Message()
+		}
+
+		if err := decodeElement(target, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeElement(m protoreflect.Message, e *xmlElement) error {
+	md := m.Descriptor()
+	switch {
+	case md.FullName() == xhtmlMessage:
+		div := e.div
+		if div == "" {
+			div = e.value
+		}
+		m.Set(md.Fields().ByName("value"), protoreflect.ValueOfString(div))
+		return nil
+	case md.Oneofs().ByName(resourceOneof) != nil:
+		return decodeContained(m, e)
+	case md.FullName() == (&anypb.Any{}).ProtoReflect().Descriptor().FullName():
+		contained := &bcrpb.ContainedResource{}
+		if err := decodeContained(contained.ProtoReflect(), e); err != nil {
+			return err
+		}
+		packed, err := anypb.New(contained)
+		if err != nil {
+			return err
+		}
+		proto.Merge(m.Interface(), packed)
+		return nil
+	case isPrimitive(md):
+		if e.value != "" {
+			if err := parsePrimitive(m, e.value); err != nil {
+				return fmt.Errorf("invalid %s: %w", e.name, err)
+			}
+		}
+	}
+	return decodeFields(m, e)
+}
+
+// decodeContained reads the single resource element inside e into a
+// ContainedResource.
+func decodeContained(m protoreflect.Message, e *xmlElement) error {
+	resourceElement := e
+	if e.resource == nil {
+		if len(e.children) != 1 {
+			return fmt.Errorf("%s must hold exactly one resource", e.name)
+		}
+		resourceElement = e.children[0]
+	}
+
+	resource, err := unmarshalResource(resourceElement)
+	if err != nil {
+		return err
+	}
+	fd := resourceFields[string(resource.Descriptor().Name())]
+	m.Set(fd, protoreflect.ValueOfMessage(resource))
+	return nil
+}
+
+func parsePrimitive(m protoreflect.Message, value string) error {
+	md := m.Descriptor()
+	if md.Fields().ByName("value_us") != nil {
+		return parseTemporal(m, value)
+	}
+
+	fd := md.Fields().ByName("value")
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		m.Set(fd, protoreflect.ValueOfString(value))
+	case protoreflect.BoolKind:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		m.Set(fd, protoreflect.ValueOfBool(value == "true"))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		i, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		m.Set(fd, protoreflect.ValueOfInt32(int32(i)))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		i, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%q is not an unsigned integer", value)
+		}
+		m.Set(fd, protoreflect.ValueOfUint32(uint32(i)))
+	case protoreflect.BytesKind:
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return fmt.Errorf("%q is not base64", value)
+		}
+		m.Set(fd, protoreflect.ValueOfBytes(data))
+	case protoreflect.EnumKind:
+		v, ok := enumValueByCode(fd.Enum(), value)
+		if !ok {
+			return fmt.Errorf("unknown code %q", value)
+		}
+		m.Set(fd, protoreflect.ValueOfEnum(v.Number()))
+	default:
+		return fmt.Errorf("unsupported value of %s", md.Name())
+	}
+	return nil
+}
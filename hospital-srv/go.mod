@@ -10,6 +10,7 @@ require (
 	github.com/gorilla/websocket v1.5.3
 	github.com/lib/pq v1.10.9
 	google.golang.org/protobuf v1.36.9
+	signature v0.0.0
 )
 
 require (
@@ -49,3 +50,5 @@ require (
 	golang.org/x/text v0.27.0 // indirect
 	golang.org/x/tools v0.34.0 // indirect
 )
+
+replace signature => ../signature
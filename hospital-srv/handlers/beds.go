@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"hospital-srv/models"
+	"hospital-srv/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headerActor names who made a change, as with the FHIR API.
+const headerActor = "X-HIS-Actor"
+
+type BedHandler struct {
+	service *services.BedService
+}
+
+func NewBedHandler(service *services.BedService) *BedHandler {
+	return &BedHandler{service: service}
+}
+
+func bedErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, services.ErrReferenceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidBedAssignment):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidBedTransition),
+		errors.Is(err, services.ErrInactiveLocation):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetBeds lists the beds for the ward board, optionally narrowed to a
+// department, a ward or a bed status.
+func (h *BedHandler) GetBeds(c *gin.Context) {
+	beds, err := h.service.SearchBeds(models.BedFilter{
+		DepartmentID: c.Query("department"),
+		WardID:       c.Query("ward"),
+		Status:       c.Query("status"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, beds)
+}
+
+func (h *BedHandler) GetBed(c *gin.Context) {
+	bed, err := h.service.GetBed(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "bed not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, bed)
+}
+
+// GetOccupancy counts, per ward, the active beds that are free, occupied,
+// being cleaned or blocked.
+func (h *BedHandler) GetOccupancy(c *gin.Context) {
+	occupancy, err := h.service.GetWardOccupancy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, occupancy)
+}
+
+// SetStatus marks a bed free, being cleaned or blocked.
+func (h *BedHandler) SetStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.service.SetBedStatus(id, req.Status); err != nil {
+		c.JSON(bedErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetBed(c)
+}
+
+// Assign puts the patient of an admitted encounter in the bed.
+func (h *BedHandler) Assign(c *gin.Context) {
+	var req struct {
+		EncounterID string `json:"encounter_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.AssignBed(c.Param("id"), req.EncounterID, c.GetHeader(headerActor)); err != nil {
+		c.JSON(bedErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetBed(c)
+}
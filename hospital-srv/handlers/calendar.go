@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"hospital-srv/models"
+	"hospital-srv/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CalendarHandler struct {
+	service *services.CalendarService
+}
+
+func NewCalendarHandler(service *services.CalendarService) *CalendarHandler {
+	return &CalendarHandler{service: service}
+}
+
+func calendarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrReferenceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidCalendar):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GetCalendar returns the practitioner's weekly pattern and upcoming
+// exceptions.
+func (h *CalendarHandler) GetCalendar(c *gin.Context) {
+	calendar, err := h.service.GetCalendar(c.Param("id"))
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, calendar)
+}
+
+// SetWeeklyPattern replaces the practitioner's weekly working hours and
+// breaks.
+func (h *CalendarHandler) SetWeeklyPattern(c *gin.Context) {
+	var req struct {
+		Hours  []models.WeeklyInterval `json:"hours"`
+		Breaks []models.WeeklyInterval `json:"breaks"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.service.SetWeeklyPattern(id, req.Hours, req.Breaks); err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	calendar, err := h.service.GetCalendar(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, calendar)
+}
+
+func (h *CalendarHandler) AddException(c *gin.Context) {
+	var exception models.WorkingException
+	if err := c.ShouldBindJSON(&exception); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exception.PractitionerID = c.Param("id")
+	id, err := h.service.AddException(exception)
+	if err != nil {
+		c.JSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.service.GetException(id)
+	if err != nil {
+		c.JSON(http.StatusCreated, gin.H{"id": id})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+func (h *CalendarHandler) DeleteException(c *gin.Context) {
+	exception, err := h.service.GetException(c.Param("exceptionId"))
+	if err != nil || exception.PractitionerID != c.Param("id") {
+		if err == nil || errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "exception not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.DeleteException(exception.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "exception deleted successfully"})
+}
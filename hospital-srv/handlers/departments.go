@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"hospital-srv/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DepartmentHandler struct {
+	service *services.OrganizationService
+}
+
+func NewDepartmentHandler(service *services.OrganizationService) *DepartmentHandler {
+	return &DepartmentHandler{service: service}
+}
+
+// GetOccupancy lists, per active department, its staff, its beds and how
+// many of them are occupied, and the patients currently in it.
+func (h *DepartmentHandler) GetOccupancy(c *gin.Context) {
+	occupancy, err := h.service.GetDepartmentOccupancy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, occupancy)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"hospital-srv/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationHandler struct {
+	service *services.NotificationService
+}
+
+func NewNotificationHandler(service *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{service: service}
+}
+
+// GetFailedNotifications lists dead-lettered subscriber notifications.
+func (h *NotificationHandler) GetFailedNotifications(c *gin.Context) {
+	notifications, err := h.service.GetFailedNotifications()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+func (h *NotificationHandler) ResendNotification(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := h.service.ResendNotifications([]string{id}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "failed notification not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requeued": 1})
+}
+
+func (h *NotificationHandler) ResendFailedNotifications(c *gin.Context) {
+	count, err := h.service.ResendNotifications(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requeued": count})
+}
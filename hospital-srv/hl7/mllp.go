@@ -63,7 +63,7 @@ func (ml *MLLPListener) handleConnection(conn net.Conn) {
 	reader := bufio.NewReader(conn)
 
 	for {
-		message, err := ml.readMLLPMessage(reader)
+		message, err := readMLLPMessage(reader)
 		if err != nil {
 			if err != io.EOF {
 				log.Printf("Error reading MLLP message: %v", err)
@@ -73,14 +73,14 @@ func (ml *MLLPListener) handleConnection(conn net.Conn) {
 
 		ack := ml.handler(message)
 
-		if err := ml.writeMLLPMessage(conn, ack); err != nil {
+		if err := writeMLLPMessage(conn, ack); err != nil {
 			log.Printf("Error sending ACK: %v", err)
 			return
 		}
 	}
 }
 
-func (ml *MLLPListener) readMLLPMessage(reader *bufio.Reader) ([]byte, error) {
+func readMLLPMessage(reader *bufio.Reader) ([]byte, error) {
 	startByte, err := reader.ReadByte()
 	if err != nil {
 		return nil, err
@@ -114,7 +114,7 @@ func (ml *MLLPListener) readMLLPMessage(reader *bufio.Reader) ([]byte, error) {
 	return message, nil
 }
 
-func (ml *MLLPListener) writeMLLPMessage(conn net.Conn, message []byte) error {
+func writeMLLPMessage(conn io.Writer, message []byte) error {
 	frame := make([]byte, 0, len(message)+3)
 	frame = append(frame, MLLP_START)
 	frame = append(frame, message...)
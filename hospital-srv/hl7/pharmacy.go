@@ -0,0 +1,350 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"hospital-srv/services"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pharmacyDispatchInterval  = time.Second
+	pharmacyBatchSize         = 20
+	pharmacyLease             = 5 * time.Minute
+	pharmacyTimeout           = 30 * time.Second
+	maxPharmacyAttempts       = 8
+	initialPharmacyRetryDelay = 5 * time.Second
+	maxPharmacyRetryDelay     = time.Hour
+	hl7TimestampFormat        = "20060102150405"
+)
+
+// errOrderRejected is returned when the pharmacy answers an order with an
+// error or reject ACK. Such orders are not sent again.
+var errOrderRejected = errors.New("order rejected by pharmacy")
+
+// hl7Escaper escapes the HL7 delimiters in free text. Line breaks become
+// spaces, as they would end the segment.
+var hl7Escaper = strings.NewReplacer(
+	`\`, `\E\`,
+	"|", `\F\`,
+	"^", `\S\`,
+	"&", `\T\`,
+	"~", `\R\`,
+	"\r\n", " ",
+	"\r", " ",
+	"\n", " ",
+)
+
+// PharmacyClient sends prescriptions to the pharmacy as RDE^O11 orders over
+// MLLP/TLS. Orders are queued in the pharmacy outbox and sent by Run, so an
+// unreachable pharmacy never holds up a prescription and no order is lost
+// on a restart. With no address configured orders are only logged.
+type PharmacyClient struct {
+	orderService *services.PharmacyOrderService
+	address      string
+	tlsConfig    *tls.Config
+}
+
+// NewPharmacyClient creates a client for the pharmacy MLLP endpoint at
+// address, verifying its certificate against the CA bundle at caPath.
+func NewPharmacyClient(orderService *services.PharmacyOrderService, address string, caPath string) (*PharmacyClient, error) {
+	client := &PharmacyClient{
+		orderService: orderService,
+		address:      address,
+	}
+	if address == "" {
+		return client, nil
+	}
+
+	caCert, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to append CA certificate")
+	}
+
+	client.tlsConfig = &tls.Config{
+		RootCAs:    certPool,
+		MinVersion: tls.VersionTLS12,
+	}
+	return client, nil
+}
+
+// EnqueuePrescription implements services.PharmacyNotifier by writing an
+// RDE^O11 order for the prescription to the outbox, using the caller's
+// transaction.
+func (c *PharmacyClient) EnqueuePrescription(tx *repository.Repository, eventType string, request models.MedicationRequest, patient models.Patient, requester models.Practitioner) error {
+	message := BuildRDE(eventType, request, patient, requester, time.Now())
+
+	if c.address == "" {
+		log.Printf("Pharmacy interface disabled, not sending: %s", strings.ReplaceAll(string(message), "\r", "|"))
+		return nil
+	}
+
+	if err := tx.EnqueuePharmacyOrder(request.ID, eventType, message); err != nil {
+		return fmt.Errorf("failed to enqueue pharmacy order: %w", err)
+	}
+	return nil
+}
+
+// Run sends due orders from the outbox until ctx is cancelled.
+func (c *PharmacyClient) Run(ctx context.Context) {
+	if c.address == "" {
+		return
+	}
+
+	ticker := time.NewTicker(pharmacyDispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.dispatchDue()
+		}
+	}
+}
+
+// dispatchDue sends the due orders one at a time, oldest first, so that the
+// pharmacy sees the orders of a prescription in sequence.
+func (c *PharmacyClient) dispatchDue() {
+	orders, err := c.orderService.ClaimDuePharmacyOrders(pharmacyBatchSize, pharmacyLease)
+	if err != nil {
+		log.Printf("Failed to claim due pharmacy orders: %v", err)
+		return
+	}
+
+	for _, order := range orders {
+		c.deliver(order)
+	}
+}
+
+func (c *PharmacyClient) deliver(order models.PharmacyOrder) {
+	err := c.send(order.Message)
+	if err == nil {
+		log.Printf("Sent pharmacy order for prescription %s", order.MedicationRequestID)
+		if err := c.orderService.MarkPharmacyOrderSent(order.ID); err != nil {
+			log.Printf("Failed to mark pharmacy order %s sent: %v", order.ID, err)
+		}
+		return
+	}
+
+	nextAttempt := nextPharmacyAttempt(order.Attempts, err, time.Now())
+	if nextAttempt == nil {
+		log.Printf("Pharmacy order for prescription %s dead-lettered after %d attempts: %v", order.MedicationRequestID, order.Attempts, err)
+	} else {
+		log.Printf("Failed to send pharmacy order for prescription %s (attempt %d), retrying at %s: %v", order.MedicationRequestID, order.Attempts, nextAttempt.Format(time.RFC3339), err)
+	}
+
+	if err := c.orderService.MarkPharmacyOrderFailed(order.ID, err.Error(), nextAttempt); err != nil {
+		log.Printf("Failed to record failed pharmacy order %s: %v", order.ID, err)
+	}
+}
+
+// nextPharmacyAttempt returns when to retry an order after its attempts-th
+// attempt failed with sendErr, doubling the wait each time up to
+// maxPharmacyRetryDelay. It returns nil for an order the pharmacy rejected
+// or one whose attempts are used up.
+func nextPharmacyAttempt(attempts int, sendErr error, now time.Time) *time.Time {
+	if errors.Is(sendErr, errOrderRejected) || attempts >= maxPharmacyAttempts {
+		return nil
+	}
+
+	delay := initialPharmacyRetryDelay << (attempts - 1)
+	if delay > maxPharmacyRetryDelay || delay <= 0 {
+		delay = maxPharmacyRetryDelay
+	}
+	next := now.Add(delay)
+	return &next
+}
+
+func (c *PharmacyClient) send(message []byte) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: pharmacyTimeout}, "tcp", c.address, c.tlsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(pharmacyTimeout)); err != nil {
+		return err
+	}
+
+	if err := writeMLLPMessage(conn, message); err != nil {
+		return fmt.Errorf("failed to send order: %w", err)
+	}
+
+	ack, err := readMLLPMessage(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("failed to read ACK: %w", err)
+	}
+
+	for _, segment := range strings.Split(string(ack), "\r") {
+		fields := strings.Split(segment, "|")
+		if fields[0] != "MSA" || len(fields) < 2 {
+			continue
+		}
+		if fields[1] == "AA" || fields[1] == "CA" {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", errOrderRejected, strings.ReplaceAll(segment, "\r", "|"))
+	}
+	return fmt.Errorf("%w: ACK without MSA segment", errOrderRejected)
+}
+
+// BuildRDE builds an RDE^O11 pharmacy order for a prescription. A new
+// prescription is sent as a new order (NW), a stopped one as discontinued
+// (DC), a completed one as a status change (SC) and any other change as a
+// change of order (XO).
+func BuildRDE(eventType string, request models.MedicationRequest, patient models.Patient, requester models.Practitioner, now time.Time) []byte {
+	control, status := orderControl(eventType, request.Status)
+
+	provider := strings.Join([]string{
+		requester.ID,
+		hl7Escaper.Replace(requester.LastName),
+		hl7Escaper.Replace(requester.FirstName),
+	}, "^")
+
+	patientName := hl7Escaper.Replace(patient.LastName) + "^" + hl7Escaper.Replace(patient.FirstName)
+	if patient.MiddleName != nil {
+		patientName += "^" + hl7Escaper.Replace(*patient.MiddleName)
+	}
+
+	dateOfBirth := ""
+	if len(patient.DateOfBirth) >= 10 {
+		if dob, err := time.Parse("2006-01-02", patient.DateOfBirth[:10]); err == nil {
+			dateOfBirth = dob.Format("20060102")
+		}
+	}
+
+	encounterID := ""
+	if request.EncounterID != nil {
+		encounterID = *request.EncounterID
+	}
+
+	note := ""
+	if request.Note != nil {
+		note = hl7Escaper.Replace(*request.Note)
+	}
+
+	duration, end := "", ""
+	if request.Duration != nil && request.DurationUnit != nil {
+		duration = formatDecimal(*request.Duration) + "^" + *request.DurationUnit
+		end = treatmentEnd(request.AuthoredOn, *request.Duration, *request.DurationUnit).Format(hl7TimestampFormat)
+	}
+
+	timestamp := now.Format(hl7TimestampFormat)
+	segments := []string{
+		fmt.Sprintf("MSH|^~\\&|HIS|HOSPITAL|PHARMACY|HOSPITAL|%s||RDE^O11^RDE_O11|%s|P|2.5",
+			timestamp, strconv.FormatInt(now.UnixNano(), 36)),
+		fmt.Sprintf("PID|||%s^^^HIS^MR||%s||%s|%s",
+			patient.ID, patientName, dateOfBirth, administrativeSex(patient.Gender)),
+		fmt.Sprintf("PV1||O|||||%s||||||||||||%s", provider, encounterID),
+		fmt.Sprintf("ORC|%s|%s^HIS|||%s||||%s|||%s",
+			control, request.ID, status, request.AuthoredOn.Format(hl7TimestampFormat), provider),
+		fmt.Sprintf("RXE||%s^%s^L|%s||%s|%s|%s",
+			request.Medication.Code, hl7Escaper.Replace(request.Medication.Display),
+			formatDecimal(request.DoseValue), hl7Escaper.Replace(request.DoseUnit), hl7Escaper.Replace(request.Medication.Form), note),
+		fmt.Sprintf("TQ1|1||%s|||%s|%s|%s",
+			repeatPattern(request.Frequency, request.Period, request.PeriodUnit), duration, request.AuthoredOn.Format(hl7TimestampFormat), end),
+	}
+
+	return []byte(strings.Join(segments, "\r"))
+}
+
+// orderControl returns the ORC-1 order control and ORC-5 order status codes
+// for a prescription event.
+func orderControl(eventType string, status string) (string, string) {
+	switch {
+	case eventType == services.PrescriptionEventCreated:
+		return "NW", "IP"
+	case status == models.MedicationRequestStatusStopped:
+		return "DC", "DC"
+	case status == models.MedicationRequestStatusCompleted:
+		return "SC", "CM"
+	default:
+		return "XO", "IP"
+	}
+}
+
+// repeatPattern expresses frequency doses per period as an HL7 repeat
+// pattern, e.g. BID for twice a day or Q8H for every 8 hours. It returns ""
+// for a schedule no pattern fits; RXE still carries the dose.
+func repeatPattern(frequency int, period float64, unit string) string {
+	if period == 1 && unit == models.TimeUnitDay {
+		switch frequency {
+		case 1:
+			return "Q1D"
+		case 2:
+			return "BID"
+		case 3:
+			return "TID"
+		case 4:
+			return "QID"
+		default:
+			return fmt.Sprintf("%dID", frequency)
+		}
+	}
+
+	if frequency == 1 && period == float64(int(period)) {
+		switch unit {
+		case models.TimeUnitHour:
+			return fmt.Sprintf("Q%dH", int(period))
+		case models.TimeUnitDay:
+			return fmt.Sprintf("Q%dD", int(period))
+		case models.TimeUnitWeek:
+			return fmt.Sprintf("Q%dW", int(period))
+		}
+	}
+
+	hoursPerUnit := map[string]float64{models.TimeUnitHour: 1, models.TimeUnitDay: 24, models.TimeUnitWeek: 168}
+	hours := period * hoursPerUnit[unit] / float64(frequency)
+	if hours >= 1 && hours == float64(int(hours)) {
+		return fmt.Sprintf("Q%dH", int(hours))
+	}
+	return ""
+}
+
+// treatmentEnd adds a treatment duration to its start.
+func treatmentEnd(start time.Time, duration float64, unit string) time.Time {
+	switch unit {
+	case models.TimeUnitWeek:
+		return start.Add(time.Duration(duration * 7 * 24 * float64(time.Hour)))
+	case models.TimeUnitMonth:
+		months := int(duration)
+		return start.AddDate(0, months, 0).Add(time.Duration((duration - float64(months)) * 30 * 24 * float64(time.Hour)))
+	default:
+		return start.Add(time.Duration(duration * 24 * float64(time.Hour)))
+	}
+}
+
+func administrativeSex(gender string) string {
+	switch strings.ToLower(gender) {
+	case "male":
+		return "M"
+	case "female":
+		return "F"
+	case "other":
+		return "O"
+	default:
+		return "U"
+	}
+}
+
+func formatDecimal(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
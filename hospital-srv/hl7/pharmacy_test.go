@@ -0,0 +1,169 @@
+package hl7
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/services"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildRDE(t *testing.T) {
+	middleName := "Petrovich"
+	encounterID := "e1"
+	note := "after meals | with water\nno alcohol"
+	duration := 5.0
+	durationUnit := models.TimeUnitDay
+	authoredOn := time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC)
+	now := time.Date(2024, 3, 10, 9, 31, 0, 0, time.UTC)
+
+	request := models.MedicationRequest{
+		ID:          "mr1",
+		PatientID:   "p1",
+		EncounterID: &encounterID,
+		RequesterID: "d1",
+		Medication: models.Medication{
+			Code:    "AMOX500",
+			Display: "Amoxicillin 500 mg",
+			Form:    "capsule",
+		},
+		Status:       models.MedicationRequestStatusActive,
+		DoseValue:    500,
+		DoseUnit:     "mg",
+		Frequency:    3,
+		Period:       1,
+		PeriodUnit:   models.TimeUnitDay,
+		Duration:     &duration,
+		DurationUnit: &durationUnit,
+		Note:         &note,
+		AuthoredOn:   authoredOn,
+	}
+	patient := models.Patient{ID: "p1", FirstName: "Ivan", LastName: "Ivanov", MiddleName: &middleName, DateOfBirth: "1980-05-17T00:00:00Z", Gender: "male"}
+	requester := models.Practitioner{ID: "d1", FirstName: "Anna", LastName: "Smirnova"}
+
+	segments := strings.Split(string(BuildRDE(services.PrescriptionEventCreated, request, patient, requester, now)), "\r")
+	if len(segments) != 6 {
+		t.Fatalf("got %d segments, want MSH, PID, PV1, ORC, RXE and TQ1", len(segments))
+	}
+
+	if !strings.HasPrefix(segments[0], `MSH|^~\&|HIS|HOSPITAL|PHARMACY|HOSPITAL|20240310093100||RDE^O11^RDE_O11|`) {
+		t.Errorf("MSH = %q", segments[0])
+	}
+	wants := []string{
+		"PID|||p1^^^HIS^MR||Ivanov^Ivan^Petrovich||19800517|M",
+		"PV1||O|||||d1^Smirnova^Anna||||||||||||e1",
+		"ORC|NW|mr1^HIS|||IP||||20240310093000|||d1^Smirnova^Anna",
+		`RXE||AMOX500^Amoxicillin 500 mg^L|500||mg|capsule|after meals \F\ with water no alcohol`,
+		"TQ1|1||TID|||5^d|20240310093000|20240315093000",
+	}
+	for i, want := range wants {
+		if segments[i+1] != want {
+			t.Errorf("segment %d = %q, want %q", i+1, segments[i+1], want)
+		}
+	}
+}
+
+func TestOrderControl(t *testing.T) {
+	tests := []struct {
+		eventType   string
+		status      string
+		wantControl string
+		wantStatus  string
+	}{
+		{services.PrescriptionEventCreated, models.MedicationRequestStatusActive, "NW", "IP"},
+		{services.PrescriptionEventUpdated, models.MedicationRequestStatusActive, "XO", "IP"},
+		{services.PrescriptionEventUpdated, models.MedicationRequestStatusStopped, "DC", "DC"},
+		{services.PrescriptionEventUpdated, models.MedicationRequestStatusCompleted, "SC", "CM"},
+	}
+
+	for _, tt := range tests {
+		control, status := orderControl(tt.eventType, tt.status)
+		if control != tt.wantControl || status != tt.wantStatus {
+			t.Errorf("orderControl(%q, %q) = %s, %s, want %s, %s", tt.eventType, tt.status, control, status, tt.wantControl, tt.wantStatus)
+		}
+	}
+}
+
+func TestRepeatPattern(t *testing.T) {
+	tests := []struct {
+		frequency int
+		period    float64
+		unit      string
+		want      string
+	}{
+		{1, 1, models.TimeUnitDay, "Q1D"},
+		{2, 1, models.TimeUnitDay, "BID"},
+		{3, 1, models.TimeUnitDay, "TID"},
+		{4, 1, models.TimeUnitDay, "QID"},
+		{5, 1, models.TimeUnitDay, "5ID"},
+		{1, 8, models.TimeUnitHour, "Q8H"},
+		{1, 2, models.TimeUnitDay, "Q2D"},
+		{1, 1, models.TimeUnitWeek, "Q1W"},
+		{2, 1, models.TimeUnitWeek, "Q84H"},
+		{3, 2, models.TimeUnitHour, ""},
+		{1, 1.5, models.TimeUnitDay, "Q36H"},
+	}
+
+	for _, tt := range tests {
+		if got := repeatPattern(tt.frequency, tt.period, tt.unit); got != tt.want {
+			t.Errorf("repeatPattern(%d, %v, %s) = %q, want %q", tt.frequency, tt.period, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestTreatmentEnd(t *testing.T) {
+	start := time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		duration float64
+		unit     string
+		want     time.Time
+	}{
+		{5, models.TimeUnitDay, time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)},
+		{0.5, models.TimeUnitDay, time.Date(2024, 1, 10, 21, 0, 0, 0, time.UTC)},
+		{2, models.TimeUnitWeek, time.Date(2024, 1, 24, 9, 0, 0, 0, time.UTC)},
+		{1, models.TimeUnitMonth, time.Date(2024, 2, 10, 9, 0, 0, 0, time.UTC)},
+		{1.5, models.TimeUnitMonth, time.Date(2024, 2, 25, 9, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		if got := treatmentEnd(start, tt.duration, tt.unit); !got.Equal(tt.want) {
+			t.Errorf("treatmentEnd(%v %s) = %v, want %v", tt.duration, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestNextPharmacyAttempt(t *testing.T) {
+	now := time.Date(2024, 3, 10, 9, 30, 0, 0, time.UTC)
+	unreachable := errors.New("failed to connect: connection refused")
+	rejected := fmt.Errorf("%w: MSA|AE|1", errOrderRejected)
+
+	tests := []struct {
+		attempts int
+		err      error
+		want     time.Duration
+		dead     bool
+	}{
+		{attempts: 1, err: unreachable, want: 5 * time.Second},
+		{attempts: 2, err: unreachable, want: 10 * time.Second},
+		{attempts: 4, err: unreachable, want: 40 * time.Second},
+		{attempts: maxPharmacyAttempts - 1, err: unreachable, want: 5 * time.Second << (maxPharmacyAttempts - 2)},
+		{attempts: maxPharmacyAttempts, err: unreachable, dead: true},
+		{attempts: 1, err: rejected, dead: true},
+	}
+
+	for _, tt := range tests {
+		got := nextPharmacyAttempt(tt.attempts, tt.err, now)
+		if tt.dead {
+			if got != nil {
+				t.Errorf("nextPharmacyAttempt(%d, %v) = %v, want nil", tt.attempts, tt.err, got)
+			}
+			continue
+		}
+		if got == nil || !got.Equal(now.Add(tt.want)) {
+			t.Errorf("nextPharmacyAttempt(%d, %v) = %v, want %v", tt.attempts, tt.err, got, now.Add(tt.want))
+		}
+	}
+}
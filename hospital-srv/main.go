@@ -18,11 +18,17 @@ import (
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
 	cfg := config.Load()
 
+	clinicLocation, err := time.LoadLocation(cfg.ClinicTimezone)
+	if err != nil {
+		log.Fatalf("Invalid clinic time zone %q: %v", cfg.ClinicTimezone, err)
+	}
+
 	db, err := database.Setup(cfg)
 	if err != nil {
 		log.Fatalf("Failed to setup database: %v", err)
@@ -33,16 +39,65 @@ func main() {
 	go hub.Run()
 
 	repo := repository.New(db)
+	subscriptionService := services.NewSubscriptionService(repo)
+	notificationService := services.NewNotificationService(repo)
+
+	notificationClient, err := fhir.NewNotificationClient(subscriptionService, notificationService, cfg.NotificationCAPath, cfg.NotificationSecret)
+	if err != nil {
+		log.Fatalf("Failed to create notification client: %v", err)
+	}
+
+	dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+	defer stopDispatch()
+	go notificationClient.Run(dispatchCtx)
+
 	patientService := services.New(repo, hub)
 	practitionerService := services.NewPractitionerService(repo)
-	encounterService := services.NewEncounterService(repo, hub)
+	calendarService := services.NewCalendarService(repo, clinicLocation)
+	encounterService := services.NewEncounterService(repo, hub, notificationClient, calendarService)
+	transactionService := services.NewTransactionService(repo, hub, notificationClient, calendarService)
+	schedulingService := services.NewSchedulingService(repo, hub, notificationClient)
+	conditionService := services.NewConditionService(repo)
+	noteService := services.NewClinicalNoteService(repo)
+	organizationService := services.NewOrganizationService(repo, hub)
+	exportService := services.NewExportService(repo, fhir.NewResourceExporter(patientService, practitionerService, encounterService), cfg.ExportPath)
+	bedService := services.NewBedService(repo, hub, notificationClient, calendarService)
+
+	pharmacyOrderService := services.NewPharmacyOrderService(repo)
+	pharmacyClient, err := hl7.NewPharmacyClient(pharmacyOrderService, cfg.PharmacyAddress, cfg.PharmacyCAPath)
+	if err != nil {
+		log.Fatalf("Failed to create pharmacy client: %v", err)
+	}
+	go pharmacyClient.Run(dispatchCtx)
+
+	medicationService := services.NewMedicationService(repo, pharmacyClient)
+
+	if n, err := conditionService.LoadICD10Codes(cfg.ICD10CodesPath); err != nil {
+		log.Printf("Failed to load ICD-10 codes from %s: %v", cfg.ICD10CodesPath, err)
+	} else {
+		log.Printf("Loaded %d ICD-10 codes from %s", n, cfg.ICD10CodesPath)
+	}
+
+	if n, err := medicationService.LoadMedications(cfg.MedicationsPath); err != nil {
+		log.Printf("Failed to load medications from %s: %v", cfg.MedicationsPath, err)
+	} else {
+		log.Printf("Loaded %d medications from %s", n, cfg.MedicationsPath)
+	}
 
-	notificationClient := fhir.NewNotificationClient(cfg.DoctorAPIURL, cfg.ReceptionAPIURL)
+	if n, err := exportService.FailUnfinishedExports(); err != nil {
+		log.Printf("Failed to clean up unfinished exports: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted exports as failed", n)
+	}
 
 	patientHandler := handlers.New(patientService)
-	fhirServer := fhir.NewFHIRServer(practitionerService, encounterService, notificationClient)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	calendarHandler := handlers.NewCalendarHandler(calendarService)
+	departmentHandler := handlers.NewDepartmentHandler(organizationService)
+	bedHandler := handlers.NewBedHandler(bedService)
+	fhirServer := fhir.NewFHIRServer(patientService, practitionerService, encounterService, transactionService, subscriptionService, schedulingService, calendarService, conditionService, noteService, medicationService, organizationService, exportService)
 
-	r := router.Setup(patientHandler, hub, fhirServer)
+	r := router.Setup(patientHandler, notificationHandler, calendarHandler, departmentHandler, bedHandler, hub, fhirServer)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.ServerPort,
@@ -0,0 +1,16 @@
+ALTER TABLE patients ADD COLUMN IF NOT EXISTS version_id INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE practitioners ADD COLUMN IF NOT EXISTS version_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE practitioners ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW();
+
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS version_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS resource_history (
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id UUID NOT NULL,
+    version_id INTEGER NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    snapshot JSONB NOT NULL,
+    PRIMARY KEY (resource_type, resource_id, version_id)
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    reason TEXT NOT NULL,
+    criteria TEXT NOT NULL,
+    channel_type VARCHAR(20) NOT NULL DEFAULT 'rest-hook',
+    endpoint TEXT NOT NULL,
+    payload VARCHAR(100),
+    headers TEXT[] NOT NULL DEFAULT '{}',
+    error TEXT,
+    end_time TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_status ON subscriptions(status);
+CREATE INDEX IF NOT EXISTS idx_subscription_endpoint ON subscriptions(endpoint);
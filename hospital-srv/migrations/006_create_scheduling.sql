@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS schedules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    practitioner_id UUID NOT NULL REFERENCES practitioners(id) ON DELETE CASCADE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    planning_start TIMESTAMP,
+    planning_end TIMESTAMP,
+    comment TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_practitioner ON schedules(practitioner_id);
+
+CREATE TABLE IF NOT EXISTS slots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    schedule_id UUID NOT NULL REFERENCES schedules(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'free',
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    comment TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    CHECK (end_time > start_time),
+    UNIQUE (schedule_id, start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_slot_start_time ON slots(start_time);
+
+CREATE TABLE IF NOT EXISTS appointments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    slot_id UUID NOT NULL REFERENCES slots(id) ON DELETE CASCADE,
+    patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+    practitioner_id UUID NOT NULL REFERENCES practitioners(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'booked',
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_patient ON appointments(patient_id);
+CREATE INDEX IF NOT EXISTS idx_appointment_practitioner ON appointments(practitioner_id);
+
+-- A slot can hold at most one appointment that is still going ahead.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appointment_active_slot ON appointments(slot_id)
+    WHERE status NOT IN ('cancelled', 'noshow');
+
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS appointment_id UUID REFERENCES appointments(id) ON DELETE SET NULL;
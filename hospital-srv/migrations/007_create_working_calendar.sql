@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS working_hours (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    practitioner_id UUID NOT NULL REFERENCES practitioners(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    CHECK (end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_working_hours_practitioner ON working_hours(practitioner_id, weekday);
+
+CREATE TABLE IF NOT EXISTS working_breaks (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    practitioner_id UUID NOT NULL REFERENCES practitioners(id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    CHECK (end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_working_breaks_practitioner ON working_breaks(practitioner_id, weekday);
+
+CREATE TABLE IF NOT EXISTS working_exceptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    practitioner_id UUID NOT NULL REFERENCES practitioners(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CHECK (end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_working_exceptions_practitioner ON working_exceptions(practitioner_id, start_time);
@@ -0,0 +1,17 @@
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS end_time TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS encounter_status_history (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    encounter_id UUID NOT NULL REFERENCES encounters(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL,
+    actor TEXT,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_encounter_status_history_encounter ON encounter_status_history(encounter_id, changed_at);
+
+-- Encounters created before the history existed start it with their current status.
+INSERT INTO encounter_status_history (encounter_id, status, changed_at)
+SELECT e.id, e.status, COALESCE(e.created_at, NOW())
+FROM encounters e
+WHERE NOT EXISTS (SELECT 1 FROM encounter_status_history h WHERE h.encounter_id = e.id);
@@ -0,0 +1,6 @@
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS class VARCHAR(10) NOT NULL DEFAULT 'AMB';
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS type TEXT;
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS service_type TEXT;
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS priority VARCHAR(10);
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS reason_text TEXT;
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS reason_code VARCHAR(10);
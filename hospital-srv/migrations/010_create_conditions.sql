@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS icd10_codes (
+    code VARCHAR(10) PRIMARY KEY,
+    display TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS conditions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+    encounter_id UUID REFERENCES encounters(id) ON DELETE CASCADE,
+    recorder_id UUID REFERENCES practitioners(id) ON DELETE SET NULL,
+    code VARCHAR(10) NOT NULL REFERENCES icd10_codes(code),
+    clinical_status VARCHAR(20) NOT NULL DEFAULT 'active',
+    verification_status VARCHAR(20) NOT NULL DEFAULT 'provisional',
+    note TEXT,
+    onset_time TIMESTAMP,
+    abatement_time TIMESTAMP,
+    version_id INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_condition_patient ON conditions(patient_id);
+CREATE INDEX IF NOT EXISTS idx_condition_encounter ON conditions(encounter_id);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS clinical_notes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    encounter_id UUID NOT NULL REFERENCES encounters(id) ON DELETE CASCADE,
+    patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES practitioners(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'preliminary',
+    title TEXT NOT NULL,
+    complaints TEXT,
+    anamnesis TEXT,
+    examination TEXT,
+    plan TEXT,
+    signed_at TIMESTAMP,
+    version_id INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_clinical_note_encounter ON clinical_notes(encounter_id);
+CREATE INDEX IF NOT EXISTS idx_clinical_note_patient ON clinical_notes(patient_id);
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS medications (
+    code VARCHAR(20) PRIMARY KEY,
+    display TEXT NOT NULL,
+    atc_code VARCHAR(10) NOT NULL,
+    form VARCHAR(50) NOT NULL,
+    strength VARCHAR(50) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS medication_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    patient_id UUID NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+    encounter_id UUID REFERENCES encounters(id) ON DELETE CASCADE,
+    requester_id UUID NOT NULL REFERENCES practitioners(id),
+    medication_code VARCHAR(20) NOT NULL REFERENCES medications(code),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    dose_value NUMERIC(10, 3) NOT NULL,
+    dose_unit VARCHAR(20) NOT NULL,
+    frequency INTEGER NOT NULL,
+    period NUMERIC(6, 2) NOT NULL,
+    period_unit VARCHAR(5) NOT NULL,
+    duration NUMERIC(6, 2),
+    duration_unit VARCHAR(5),
+    note TEXT,
+    authored_on TIMESTAMP NOT NULL DEFAULT NOW(),
+    version_id INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_medication_request_patient ON medication_requests(patient_id, status);
+CREATE INDEX IF NOT EXISTS idx_medication_request_encounter ON medication_requests(encounter_id);
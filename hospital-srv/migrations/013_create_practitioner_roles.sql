@@ -0,0 +1,22 @@
+ALTER TABLE practitioners ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Practitioners are deactivated rather than deleted, so deleting one must
+-- never take their encounters with it.
+ALTER TABLE encounters DROP CONSTRAINT IF EXISTS encounters_practitioner_id_fkey;
+ALTER TABLE encounters ADD CONSTRAINT encounters_practitioner_id_fkey
+    FOREIGN KEY (practitioner_id) REFERENCES practitioners(id) ON DELETE RESTRICT;
+
+CREATE TABLE IF NOT EXISTS practitioner_roles (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    practitioner_id UUID NOT NULL REFERENCES practitioners(id) ON DELETE CASCADE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    role VARCHAR(20) NOT NULL,
+    department VARCHAR(100),
+    specialties TEXT[] NOT NULL DEFAULT '{}',
+    locations TEXT[] NOT NULL DEFAULT '{}',
+    version_id INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_practitioner_role_practitioner ON practitioner_roles(practitioner_id);
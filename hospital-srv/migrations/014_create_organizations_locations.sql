@@ -0,0 +1,67 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    type VARCHAR(10) NOT NULL DEFAULT 'dept',
+    name VARCHAR(200) NOT NULL,
+    part_of UUID REFERENCES organizations(id) ON DELETE RESTRICT,
+    version_id INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_part_of ON organizations(part_of);
+
+CREATE TABLE IF NOT EXISTS locations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    name VARCHAR(200) NOT NULL,
+    physical_type VARCHAR(10) NOT NULL DEFAULT 'ro',
+    organization_id UUID REFERENCES organizations(id) ON DELETE RESTRICT,
+    part_of UUID REFERENCES locations(id) ON DELETE RESTRICT,
+    version_id INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_location_organization ON locations(organization_id);
+CREATE INDEX IF NOT EXISTS idx_location_part_of ON locations(part_of);
+
+ALTER TABLE encounters ADD COLUMN IF NOT EXISTS location_id UUID REFERENCES locations(id) ON DELETE RESTRICT;
+CREATE INDEX IF NOT EXISTS idx_encounter_location ON encounters(location_id);
+
+ALTER TABLE practitioner_roles ADD COLUMN IF NOT EXISTS organization_id UUID REFERENCES organizations(id) ON DELETE RESTRICT;
+ALTER TABLE practitioner_roles ADD COLUMN IF NOT EXISTS location_ids UUID[] NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS idx_practitioner_role_organization ON practitioner_roles(organization_id);
+
+-- Roles used to name their department and locations. Turn each distinct
+-- name into an Organization or Location and point the roles at it.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'practitioner_roles' AND column_name = 'department'
+    ) THEN
+        INSERT INTO organizations (name)
+        SELECT DISTINCT department FROM practitioner_roles
+        WHERE department IS NOT NULL
+          AND department NOT IN (SELECT name FROM organizations);
+
+        UPDATE practitioner_roles pr SET organization_id = o.id
+        FROM organizations o
+        WHERE o.name = pr.department AND pr.organization_id IS NULL;
+
+        INSERT INTO locations (name)
+        SELECT DISTINCT l FROM practitioner_roles, unnest(locations) l
+        WHERE l NOT IN (SELECT name FROM locations);
+
+        UPDATE practitioner_roles pr SET location_ids = ARRAY(
+            SELECT DISTINCT ON (l) loc.id
+            FROM unnest(pr.locations) l
+            JOIN locations loc ON loc.name = l
+            ORDER BY l, loc.created_at
+        );
+
+        ALTER TABLE practitioner_roles DROP COLUMN department;
+        ALTER TABLE practitioner_roles DROP COLUMN locations;
+    END IF;
+END $$;
@@ -0,0 +1,13 @@
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS bed_status VARCHAR(20);
+
+-- Beds start out free; a bed with a current encounter in it is occupied.
+UPDATE locations l SET bed_status = CASE
+    WHEN EXISTS (
+        SELECT 1 FROM encounters e
+        WHERE e.location_id = l.id AND e.status IN ('arrived', 'in-progress')
+    ) THEN 'occupied'
+    ELSE 'free'
+END
+WHERE l.physical_type = 'bd' AND l.bed_status IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_location_bed_status ON locations(bed_status) WHERE bed_status IS NOT NULL;
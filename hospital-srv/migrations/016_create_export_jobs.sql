@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    status VARCHAR(20) NOT NULL DEFAULT 'in-progress',
+    types TEXT[] NOT NULL,
+    since TIMESTAMP,
+    request TEXT NOT NULL,
+    transaction_time TIMESTAMP NOT NULL,
+    output JSONB NOT NULL DEFAULT '[]',
+    error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    completed_at TIMESTAMP
+);
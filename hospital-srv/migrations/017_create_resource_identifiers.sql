@@ -0,0 +1,12 @@
+-- Business identifiers assigned by clients, such as a visit number. The
+-- primary key lets a system and value identify at most one resource of a
+-- type, which makes conditional creates safe to retry.
+CREATE TABLE IF NOT EXISTS resource_identifiers (
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id UUID NOT NULL,
+    system TEXT NOT NULL DEFAULT '',
+    value TEXT NOT NULL,
+    PRIMARY KEY (resource_type, system, value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_resource_identifiers_resource ON resource_identifiers(resource_type, resource_id);
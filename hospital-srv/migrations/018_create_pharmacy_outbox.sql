@@ -0,0 +1,17 @@
+-- RDE^O11 orders waiting to be sent to the pharmacy. Rows are written in the
+-- transaction that changes the prescription, so an order is queued if and
+-- only if the change is committed.
+CREATE TABLE IF NOT EXISTS pharmacy_outbox (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    medication_request_id UUID NOT NULL REFERENCES medication_requests(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL,
+    message TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pharmacy_outbox_due ON pharmacy_outbox(status, next_attempt_at);
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// A preliminary note is a draft its author may still edit. Signing makes it
+// final; a signed note can only be changed by amending it.
+const (
+	ClinicalNoteStatusPreliminary    = "preliminary"
+	ClinicalNoteStatusFinal          = "final"
+	ClinicalNoteStatusAmended        = "amended"
+	ClinicalNoteStatusEnteredInError = "entered-in-error"
+)
+
+// ClinicalNote is a doctor's visit note for an encounter, split into the
+// sections of a structured examination record.
+type ClinicalNote struct {
+	ID          string     `json:"id"`
+	EncounterID string     `json:"encounter_id"`
+	PatientID   string     `json:"patient_id"`
+	AuthorID    string     `json:"author_id"`
+	Status      string     `json:"status"`
+	Title       string     `json:"title"`
+	Complaints  *string    `json:"complaints"`
+	Anamnesis   *string    `json:"anamnesis"`
+	Examination *string    `json:"examination"`
+	Plan        *string    `json:"plan"`
+	SignedAt    *time.Time `json:"signed_at"`
+	VersionID   int        `json:"version_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type ClinicalNoteFilter struct {
+	PatientID   string
+	EncounterID string
+	AuthorID    string
+	Status      string
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+const (
+	ConditionClinicalStatusActive     = "active"
+	ConditionClinicalStatusRecurrence = "recurrence"
+	ConditionClinicalStatusRelapse    = "relapse"
+	ConditionClinicalStatusInactive   = "inactive"
+	ConditionClinicalStatusRemission  = "remission"
+	ConditionClinicalStatusResolved   = "resolved"
+)
+
+// A confirmed condition is a final diagnosis; provisional and differential
+// ones are working diagnoses.
+const (
+	ConditionVerificationProvisional    = "provisional"
+	ConditionVerificationDifferential   = "differential"
+	ConditionVerificationConfirmed      = "confirmed"
+	ConditionVerificationRefuted        = "refuted"
+	ConditionVerificationEnteredInError = "entered-in-error"
+)
+
+// Condition is a diagnosis of a patient, usually made during an encounter.
+// Code is an ICD-10 code from the local code table.
+type Condition struct {
+	ID                 string     `json:"id"`
+	PatientID          string     `json:"patient_id"`
+	EncounterID        *string    `json:"encounter_id"`
+	RecorderID         *string    `json:"recorder_id"`
+	Code               string     `json:"code"`
+	CodeDisplay        string     `json:"code_display"`
+	ClinicalStatus     string     `json:"clinical_status"`
+	VerificationStatus string     `json:"verification_status"`
+	Note               *string    `json:"note"`
+	OnsetTime          *time.Time `json:"onset_time"`
+	AbatementTime      *time.Time `json:"abatement_time"`
+	VersionID          int        `json:"version_id"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+type ConditionFilter struct {
+	PatientID          string
+	EncounterID        string
+	ClinicalStatus     string
+	VerificationStatus string
+	Code               string
+}
+
+// ICD10Code is an entry of the local ICD-10 code table.
+type ICD10Code struct {
+	Code    string `json:"code"`
+	Display string `json:"display"`
+}
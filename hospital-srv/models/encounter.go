@@ -2,17 +2,76 @@ package models
 
 import "time"
 
+const (
+	EncounterStatusPlanned    = "planned"
+	EncounterStatusArrived    = "arrived"
+	EncounterStatusInProgress = "in-progress"
+	EncounterStatusCompleted  = "completed"
+	EncounterStatusCancelled  = "cancelled"
+)
+
+// Encounter classes are HL7 v3 ActCode values.
+const (
+	EncounterClassAmbulatory = "AMB"
+	EncounterClassEmergency  = "EMER"
+	EncounterClassHomeHealth = "HH"
+	EncounterClassInpatient  = "IMP"
+	EncounterClassVirtual    = "VR"
+)
+
+// Encounter priorities are HL7 v3 ActPriority values.
+const (
+	EncounterPriorityRoutine   = "R"
+	EncounterPriorityUrgent    = "UR"
+	EncounterPriorityEmergency = "EM"
+	EncounterPriorityElective  = "EL"
+)
+
 type Encounter struct {
-	ID             string    `json:"id"`
-	PatientID      string    `json:"patient_id"`
-	PractitionerID string    `json:"practitioner_id"`
-	Status         string    `json:"status"`
-	StartTime      time.Time `json:"start_time"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID             string       `json:"id"`
+	PatientID      string       `json:"patient_id"`
+	PractitionerID string       `json:"practitioner_id"`
+	Status         string       `json:"status"`
+	Class          string       `json:"class"`
+	Type           *string      `json:"type"`
+	ServiceType    *string      `json:"service_type"`
+	Priority       *string      `json:"priority"`
+	ReasonText     *string      `json:"reason_text"`
+	ReasonCode     *string      `json:"reason_code"`
+	StartTime      time.Time    `json:"start_time"`
+	EndTime        *time.Time   `json:"end_time"`
+	AppointmentID  *string      `json:"appointment_id"`
+	LocationID     *string      `json:"location_id"`
+	Identifiers    []Identifier `json:"identifiers"`
+	VersionID      int          `json:"version_id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// EncounterStatusChange records that an encounter entered a status, when,
+// and who made the change.
+type EncounterStatusChange struct {
+	Status    string    `json:"status"`
+	Actor     *string   `json:"actor"`
+	ChangedAt time.Time `json:"changed_at"`
 }
 
 type EncounterWithDetails struct {
 	Encounter
-	Patient      Patient      `json:"patient"`
-	Practitioner Practitioner `json:"practitioner"`
+	Patient       Patient                 `json:"patient"`
+	Practitioner  Practitioner            `json:"practitioner"`
+	LocationName  *string                 `json:"location_name"`
+	StatusHistory []EncounterStatusChange `json:"status_history"`
+}
+
+type EncounterFilter struct {
+	PatientID      string
+	PatientIDs     []string
+	PractitionerID string
+	LocationID     string
+	Status         string
+	StartFrom      *time.Time
+	StartBefore    *time.Time
+	UpdatedSince   *time.Time
+	Identifier     *IdentifierFilter
 }
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const (
+	ExportStatusInProgress = "in-progress"
+	ExportStatusCompleted  = "completed"
+	ExportStatusFailed     = "failed"
+)
+
+// ExportJob is a bulk data export of the resource types in Types changed
+// since Since, or all of them when Since is nil. Request is the kick-off
+// URL, and TransactionTime when the export started.
+type ExportJob struct {
+	ID              string       `json:"id"`
+	Status          string       `json:"status"`
+	Types           []string     `json:"types"`
+	Since           *time.Time   `json:"since"`
+	Request         string       `json:"request"`
+	TransactionTime time.Time    `json:"transaction_time"`
+	Output          []ExportFile `json:"output"`
+	Error           *string      `json:"error"`
+	CreatedAt       time.Time    `json:"created_at"`
+	CompletedAt     *time.Time   `json:"completed_at"`
+}
+
+// ExportFile is an NDJSON file of an export holding Count resources of
+// one type.
+type ExportFile struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
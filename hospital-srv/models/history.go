@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ResourceTypePatient           = "Patient"
+	ResourceTypePractitioner      = "Practitioner"
+	ResourceTypeEncounter         = "Encounter"
+	ResourceTypeCondition         = "Condition"
+	ResourceTypeComposition       = "Composition"
+	ResourceTypeMedicationRequest = "MedicationRequest"
+	ResourceTypePractitionerRole  = "PractitionerRole"
+	ResourceTypeOrganization      = "Organization"
+	ResourceTypeLocation          = "Location"
+)
+
+type ResourceVersion struct {
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	VersionID    int             `json:"version_id"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Snapshot     json.RawMessage `json:"snapshot"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// Identifier is a business identifier a client assigns to a resource, such
+// as a visit number. A system and value identify at most one resource of a
+// type; System is empty for identifiers without one.
+type Identifier struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+// IdentifierFilter matches resources by identifier. A nil System matches
+// any system and an empty Value any value.
+type IdentifierFilter struct {
+	System *string
+	Value  string
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+const (
+	MedicationRequestStatusActive    = "active"
+	MedicationRequestStatusStopped   = "stopped"
+	MedicationRequestStatusCompleted = "completed"
+)
+
+// Units of the dosing period and of the treatment duration, as UCUM codes.
+const (
+	TimeUnitHour  = "h"
+	TimeUnitDay   = "d"
+	TimeUnitWeek  = "wk"
+	TimeUnitMonth = "mo"
+)
+
+// Medication is an entry of the local medication dictionary. Products with
+// the same ATC code contain the same drug.
+type Medication struct {
+	Code     string `json:"code"`
+	Display  string `json:"display"`
+	ATCCode  string `json:"atc_code"`
+	Form     string `json:"form"`
+	Strength string `json:"strength"`
+}
+
+// MedicationRequest is a prescription: a dose of a medication taken
+// Frequency times per Period, for an optional Duration.
+type MedicationRequest struct {
+	ID           string     `json:"id"`
+	PatientID    string     `json:"patient_id"`
+	EncounterID  *string    `json:"encounter_id"`
+	RequesterID  string     `json:"requester_id"`
+	Medication   Medication `json:"medication"`
+	Status       string     `json:"status"`
+	DoseValue    float64    `json:"dose_value"`
+	DoseUnit     string     `json:"dose_unit"`
+	Frequency    int        `json:"frequency"`
+	Period       float64    `json:"period"`
+	PeriodUnit   string     `json:"period_unit"`
+	Duration     *float64   `json:"duration"`
+	DurationUnit *string    `json:"duration_unit"`
+	Note         *string    `json:"note"`
+	AuthoredOn   time.Time  `json:"authored_on"`
+	VersionID    int        `json:"version_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type MedicationRequestFilter struct {
+	PatientID      string
+	EncounterID    string
+	RequesterID    string
+	Status         string
+	MedicationCode string
+}
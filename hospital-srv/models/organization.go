@@ -0,0 +1,134 @@
+package models
+
+import "time"
+
+// Organization types are codes from
+// http://terminology.hl7.org/CodeSystem/organization-type.
+const (
+	OrganizationTypeProvider   = "prov"
+	OrganizationTypeDepartment = "dept"
+)
+
+// Organization is the hospital or one of its departments. Departments may
+// be nested under the hospital or under other departments.
+type Organization struct {
+	ID        string    `json:"id"`
+	Active    bool      `json:"active"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	PartOf    *string   `json:"part_of"`
+	VersionID int       `json:"version_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OrganizationFilter struct {
+	Name   string
+	Type   string
+	PartOf string
+	Active *bool
+}
+
+const (
+	LocationStatusActive    = "active"
+	LocationStatusSuspended = "suspended"
+	LocationStatusInactive  = "inactive"
+)
+
+// Location physical types are codes from
+// http://terminology.hl7.org/CodeSystem/location-physical-type. A cabinet
+// is a room.
+const (
+	LocationTypeBuilding = "bu"
+	LocationTypeWing     = "wi"
+	LocationTypeLevel    = "lvl"
+	LocationTypeWard     = "wa"
+	LocationTypeRoom     = "ro"
+	LocationTypeBed      = "bd"
+)
+
+// Bed statuses. A bed is occupied while an arrived or in-progress encounter
+// takes place in it and needs cleaning once that encounter leaves it.
+const (
+	BedStatusFree     = "free"
+	BedStatusOccupied = "occupied"
+	BedStatusCleaning = "cleaning"
+	BedStatusBlocked  = "blocked"
+)
+
+// Location is a place care is given, e.g. a ward, a room in it or a bed in
+// the room. A location without a managing organization belongs to the
+// department of the location it is part of. Only beds have a bed status.
+type Location struct {
+	ID             string    `json:"id"`
+	Status         string    `json:"status"`
+	Name           string    `json:"name"`
+	PhysicalType   string    `json:"physical_type"`
+	OrganizationID *string   `json:"organization_id"`
+	PartOf         *string   `json:"part_of"`
+	BedStatus      *string   `json:"bed_status"`
+	VersionID      int       `json:"version_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type LocationFilter struct {
+	Name           string
+	Status         string
+	PhysicalType   string
+	OrganizationID string
+	PartOf         string
+	BedStatus      string
+}
+
+// DepartmentOccupancy summarises the current use of a department. Beds and
+// patients are counted over the locations the department manages, including
+// locations nested in them that have no department of their own.
+type DepartmentOccupancy struct {
+	OrganizationID string  `json:"organization_id"`
+	Name           string  `json:"name"`
+	PartOf         *string `json:"part_of"`
+	Practitioners  int     `json:"practitioners"`
+	Beds           int     `json:"beds"`
+	OccupiedBeds   int     `json:"occupied_beds"`
+	Patients       int     `json:"patients"`
+}
+
+// Bed is a bed as shown on the ward board: its status, the ward it is in,
+// its department and the patient currently in it, if any.
+type Bed struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Status         string    `json:"status"`
+	LocationStatus string    `json:"location_status"`
+	PartOf         *string   `json:"part_of"`
+	PartOfName     *string   `json:"part_of_name"`
+	WardID         *string   `json:"ward_id"`
+	WardName       *string   `json:"ward_name"`
+	DepartmentID   *string   `json:"department_id"`
+	DepartmentName *string   `json:"department_name"`
+	EncounterID    *string   `json:"encounter_id"`
+	PatientID      *string   `json:"patient_id"`
+	PatientName    *string   `json:"patient_name"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type BedFilter struct {
+	DepartmentID string
+	WardID       string
+	Status       string
+}
+
+// WardOccupancy counts the active beds of a ward by status. Beds that are
+// not in any ward are counted under a ward without an ID.
+type WardOccupancy struct {
+	WardID         *string `json:"ward_id"`
+	Name           *string `json:"name"`
+	DepartmentID   *string `json:"department_id"`
+	DepartmentName *string `json:"department_name"`
+	Beds           int     `json:"beds"`
+	Free           int     `json:"free"`
+	Occupied       int     `json:"occupied"`
+	Cleaning       int     `json:"cleaning"`
+	Blocked        int     `json:"blocked"`
+}
@@ -9,6 +9,12 @@ type Patient struct {
 	MiddleName  *string   `json:"middle_name"`
 	DateOfBirth string    `json:"date_of_birth"`
 	Gender      string    `json:"gender"`
+	VersionID   int       `json:"version_id"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+type PatientFilter struct {
+	IDs          []string
+	UpdatedSince *time.Time
+}
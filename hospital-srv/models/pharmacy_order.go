@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	PharmacyOrderStatusPending = "pending"
+	PharmacyOrderStatusSent    = "sent"
+	PharmacyOrderStatusDead    = "dead"
+)
+
+// PharmacyOrder is an HL7 order for a prescription waiting in the pharmacy
+// outbox.
+type PharmacyOrder struct {
+	ID                  string     `json:"id"`
+	MedicationRequestID string     `json:"medication_request_id"`
+	EventType           string     `json:"event_type"`
+	Message             []byte     `json:"message"`
+	Status              string     `json:"status"`
+	Attempts            int        `json:"attempts"`
+	NextAttemptAt       time.Time  `json:"next_attempt_at"`
+	LastError           *string    `json:"last_error"`
+	CreatedAt           time.Time  `json:"created_at"`
+	SentAt              *time.Time `json:"sent_at"`
+}
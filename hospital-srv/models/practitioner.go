@@ -1,12 +1,75 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// Practitioner is a member of staff. A practitioner who leaves is
+// deactivated rather than deleted, so their encounters stay intact.
 type Practitioner struct {
+	ID             string       `json:"id"`
+	FirstName      string       `json:"first_name"`
+	LastName       string       `json:"last_name"`
+	MiddleName     *string      `json:"middle_name"`
+	Specialization string       `json:"specialization"`
+	Active         bool         `json:"active"`
+	Identifiers    []Identifier `json:"identifiers"`
+	VersionID      int          `json:"version_id"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// UnmarshalJSON defaults Active to true, which versions archived before
+// practitioners could be deactivated leave out.
+func (p *Practitioner) UnmarshalJSON(data []byte) error {
+	type practitioner Practitioner
+	v := practitioner{Active: true}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*p = Practitioner(v)
+	return nil
+}
+
+type PractitionerFilter struct {
+	Active       *bool
+	UpdatedSince *time.Time
+	Identifier   *IdentifierFilter
+}
+
+// Codes of the roles a practitioner can hold, from
+// http://terminology.hl7.org/CodeSystem/practitioner-role.
+const (
+	PractitionerRoleDoctor     = "doctor"
+	PractitionerRoleNurse      = "nurse"
+	PractitionerRolePharmacist = "pharmacist"
+	PractitionerRoleResearcher = "researcher"
+	PractitionerRoleTeacher    = "teacher"
+	PractitionerRoleICT        = "ict"
+)
+
+// PractitionerRole is a position a practitioner holds: a role in a
+// department, with the specialties practised and the locations worked at
+// in it. A practitioner may hold several.
+type PractitionerRole struct {
 	ID             string    `json:"id"`
-	FirstName      string    `json:"first_name"`
-	LastName       string    `json:"last_name"`
-	MiddleName     *string   `json:"middle_name"`
-	Specialization string    `json:"specialization"`
+	PractitionerID string    `json:"practitioner_id"`
+	Active         bool      `json:"active"`
+	Role           string    `json:"role"`
+	OrganizationID *string   `json:"organization_id"`
+	Specialties    []string  `json:"specialties"`
+	LocationIDs    []string  `json:"location_ids"`
+	VersionID      int       `json:"version_id"`
 	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type PractitionerRoleFilter struct {
+	PractitionerID string
+	OrganizationID string
+	LocationID     string
+	Active         *bool
+	Role           string
+	Specialty      string
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPractitionerUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{data: `{"id":"d1","first_name":"Anna"}`, want: true},
+		{data: `{"id":"d1","active":true}`, want: true},
+		{data: `{"id":"d1","active":false}`, want: false},
+	}
+
+	for _, tt := range tests {
+		var p Practitioner
+		if err := json.Unmarshal([]byte(tt.data), &p); err != nil {
+			t.Fatalf("json.Unmarshal(%s) = %v", tt.data, err)
+		}
+		if p.ID != "d1" || p.Active != tt.want {
+			t.Errorf("json.Unmarshal(%s) = %+v, want active %v", tt.data, p, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+const (
+	SlotStatusFree            = "free"
+	SlotStatusBusy            = "busy"
+	SlotStatusBusyUnavailable = "busy-unavailable"
+)
+
+const (
+	AppointmentStatusBooked    = "booked"
+	AppointmentStatusArrived   = "arrived"
+	AppointmentStatusFulfilled = "fulfilled"
+	AppointmentStatusCancelled = "cancelled"
+	AppointmentStatusNoShow    = "noshow"
+)
+
+type Schedule struct {
+	ID             string     `json:"id"`
+	PractitionerID string     `json:"practitioner_id"`
+	Active         bool       `json:"active"`
+	PlanningStart  *time.Time `json:"planning_start"`
+	PlanningEnd    *time.Time `json:"planning_end"`
+	Comment        *string    `json:"comment"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type ScheduleFilter struct {
+	PractitionerID string
+	Active         *bool
+}
+
+type Slot struct {
+	ID         string    `json:"id"`
+	ScheduleID string    `json:"schedule_id"`
+	Status     string    `json:"status"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	Comment    *string   `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type SlotFilter struct {
+	ScheduleIDs    []string
+	PractitionerID string
+	Status         string
+	StartFrom      *time.Time
+	StartBefore    *time.Time
+}
+
+type Appointment struct {
+	ID             string    `json:"id"`
+	SlotID         string    `json:"slot_id"`
+	PatientID      string    `json:"patient_id"`
+	PractitionerID string    `json:"practitioner_id"`
+	Status         string    `json:"status"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	Description    *string   `json:"description"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type AppointmentFilter struct {
+	PatientID      string
+	PractitionerID string
+	Status         string
+	StartFrom      *time.Time
+	StartBefore    *time.Time
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const (
+	SubscriptionStatusRequested = "requested"
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusError     = "error"
+	SubscriptionStatusOff       = "off"
+)
+
+const SubscriptionChannelRestHook = "rest-hook"
+
+type Subscription struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason"`
+	Criteria    string     `json:"criteria"`
+	ChannelType string     `json:"channel_type"`
+	Endpoint    string     `json:"endpoint"`
+	Payload     *string    `json:"payload"`
+	Headers     []string   `json:"headers"`
+	Error       *string    `json:"error"`
+	End         *time.Time `json:"end"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type SubscriptionFilter struct {
+	Endpoint string
+	Criteria string
+	Status   string
+}
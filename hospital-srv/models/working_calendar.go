@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	WorkingExceptionVacation  = "vacation"
+	WorkingExceptionSickLeave = "sick-leave"
+	WorkingExceptionOther     = "other"
+)
+
+// WeeklyInterval is a recurring interval of one weekday, such as Monday
+// 08:00-16:00 working hours or a Monday 12:00-12:30 break. Start and end
+// are wall-clock times ("15:04") in the clinic time zone.
+type WeeklyInterval struct {
+	ID             string `json:"id"`
+	PractitionerID string `json:"practitioner_id"`
+	Weekday        int    `json:"weekday"` // 0 is Sunday, as in time.Weekday
+	StartTime      string `json:"start_time"`
+	EndTime        string `json:"end_time"`
+}
+
+// WorkingException takes a practitioner off work for a period, e.g. a
+// vacation or a sick day.
+type WorkingException struct {
+	ID             string    `json:"id"`
+	PractitionerID string    `json:"practitioner_id"`
+	Kind           string    `json:"kind"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	Reason         *string   `json:"reason"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// WorkingCalendar is everything that determines when a practitioner works.
+type WorkingCalendar struct {
+	Hours      []WeeklyInterval   `json:"hours"`
+	Breaks     []WeeklyInterval   `json:"breaks"`
+	Exceptions []WorkingException `json:"exceptions"`
+}
+
+type TimeInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
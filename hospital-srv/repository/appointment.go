@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"hospital-srv/models"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func (r *Repository) selectAppointments() sq.SelectBuilder {
+	return r.sq.Select("id", "slot_id", "patient_id", "practitioner_id", "status", "start_time", "end_time", "description", "created_at", "updated_at").
+		From("appointments")
+}
+
+func scanAppointment(row rowScanner) (models.Appointment, error) {
+	var a models.Appointment
+	err := row.Scan(&a.ID, &a.SlotID, &a.PatientID, &a.PractitionerID, &a.Status, &a.StartTime, &a.EndTime, &a.Description, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+func (r *Repository) CreateAppointment(a models.Appointment) (string, error) {
+	query := r.sq.Insert("appointments").
+		Columns("slot_id", "patient_id", "practitioner_id", "status", "start_time", "end_time", "description").
+		Values(a.SlotID, a.PatientID, a.PractitionerID, a.Status, a.StartTime, a.EndTime, a.Description).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetAppointmentByID(id string) (*models.Appointment, error) {
+	query := r.selectAppointments().Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	a, err := scanAppointment(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (r *Repository) GetAppointmentForUpdate(id string) (*models.Appointment, error) {
+	query := r.selectAppointments().Where(sq.Eq{"id": id}).Suffix("FOR UPDATE")
+
+	sqlRaw, args, _ := query.ToSql()
+	a, err := scanAppointment(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// HasOverlappingAppointment reports whether the practitioner has an
+// appointment that is still going ahead and covers part of start to end.
+func (r *Repository) HasOverlappingAppointment(practitionerID string, start time.Time, end time.Time) (bool, error) {
+	query := r.sq.Select("1").
+		From("appointments").
+		Where(sq.Eq{"practitioner_id": practitionerID}).
+		Where(sq.NotEq{"status": []string{models.AppointmentStatusCancelled, models.AppointmentStatusNoShow}}).
+		Where(sq.Lt{"start_time": end}).
+		Where(sq.Gt{"end_time": start}).
+		Prefix("SELECT EXISTS (").
+		Suffix(")")
+
+	sqlRaw, args, _ := query.ToSql()
+	var exists bool
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&exists)
+	return exists, err
+}
+
+func (r *Repository) SearchAppointments(filter models.AppointmentFilter) ([]models.Appointment, error) {
+	query := r.selectAppointments().OrderBy("start_time")
+
+	if filter.PatientID != "" {
+		query = query.Where(sq.Eq{"patient_id": filter.PatientID})
+	}
+	if filter.PractitionerID != "" {
+		query = query.Where(sq.Eq{"practitioner_id": filter.PractitionerID})
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"status": filter.Status})
+	}
+	if filter.StartFrom != nil {
+		query = query.Where(sq.GtOrEq{"start_time": *filter.StartFrom})
+	}
+	if filter.StartBefore != nil {
+		query = query.Where(sq.Lt{"start_time": *filter.StartBefore})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var appointments []models.Appointment
+	for rows.Next() {
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return nil, err
+		}
+		appointments = append(appointments, a)
+	}
+
+	return appointments, rows.Err()
+}
+
+func (r *Repository) SetAppointmentStatus(id string, status string) error {
+	query := r.sq.Update("appointments").
+		Set("status", status).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+// selectBeds reads beds for the ward board. The ward of a bed is the
+// nearest location of type ward it is part of, and its patient the one of
+// the arrived or in-progress encounter taking place in it.
+func (r *Repository) selectBeds() sq.SelectBuilder {
+	ctes := `WITH RECURSIVE ` + locationDepartments + `,
+	bed_ancestors AS (
+		SELECT id AS bed_id, part_of AS ancestor_id FROM locations WHERE physical_type = ?
+		UNION
+		SELECT a.bed_id, l.part_of FROM bed_ancestors a
+		JOIN locations l ON l.id = a.ancestor_id
+		WHERE l.physical_type <> ?
+	),
+	bed_wards AS (
+		SELECT a.bed_id, w.id, w.name FROM bed_ancestors a
+		JOIN locations w ON w.id = a.ancestor_id
+		WHERE w.physical_type = ?
+	)`
+
+	currentStatuses := []string{models.EncounterStatusArrived, models.EncounterStatusInProgress}
+	return r.sq.Select("b.id", "b.name", "b.bed_status", "b.status", "b.part_of", "p.name", "w.id", "w.name",
+		"o.id", "o.name", "e.id", "e.patient_id", "pat.first_name || ' ' || pat.last_name", "b.updated_at").
+		Prefix(ctes, models.LocationTypeBed, models.LocationTypeWard, models.LocationTypeWard).
+		From("locations b").
+		LeftJoin("locations p ON p.id = b.part_of").
+		LeftJoin("bed_wards w ON w.bed_id = b.id").
+		LeftJoin("location_departments d ON d.id = b.id").
+		LeftJoin("organizations o ON o.id = d.department_id").
+		LeftJoin(`LATERAL (
+			SELECT id, patient_id FROM encounters
+			WHERE location_id = b.id AND status = ANY(?)
+			ORDER BY start_time DESC LIMIT 1
+		) e ON TRUE`, pq.Array(currentStatuses)).
+		LeftJoin("patients pat ON pat.id = e.patient_id").
+		Where(sq.Eq{"b.physical_type": models.LocationTypeBed})
+}
+
+func scanBed(row rowScanner) (models.Bed, error) {
+	var b models.Bed
+	err := row.Scan(&b.ID, &b.Name, &b.Status, &b.LocationStatus, &b.PartOf, &b.PartOfName, &b.WardID, &b.WardName,
+		&b.DepartmentID, &b.DepartmentName, &b.EncounterID, &b.PatientID, &b.PatientName, &b.UpdatedAt)
+	return b, err
+}
+
+func (r *Repository) GetBed(id string) (*models.Bed, error) {
+	sqlRaw, args, _ := r.selectBeds().Where(sq.Eq{"b.id": id}).ToSql()
+
+	b, err := scanBed(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// SearchBeds returns the beds matching filter, ordered by ward, the
+// location they are part of and name.
+func (r *Repository) SearchBeds(filter models.BedFilter) ([]models.Bed, error) {
+	query := r.selectBeds().OrderBy("w.name ASC NULLS LAST", "p.name ASC NULLS LAST", "b.name ASC")
+
+	if filter.DepartmentID != "" {
+		query = query.Where(sq.Eq{"d.department_id": filter.DepartmentID})
+	}
+	if filter.WardID != "" {
+		query = query.Where(sq.Eq{"w.id": filter.WardID})
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"b.bed_status": filter.Status})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	beds := []models.Bed{}
+	for rows.Next() {
+		b, err := scanBed(rows)
+		if err != nil {
+			return nil, err
+		}
+		beds = append(beds, b)
+	}
+
+	return beds, rows.Err()
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func (r *Repository) selectClinicalNotes() sq.SelectBuilder {
+	return r.sq.Select(
+		"id", "encounter_id", "patient_id", "author_id", "status", "title", "complaints", "anamnesis", "examination", "plan",
+		"signed_at", "version_id", "created_at", "updated_at",
+	).From("clinical_notes")
+}
+
+func scanClinicalNote(row rowScanner) (models.ClinicalNote, error) {
+	var n models.ClinicalNote
+	err := row.Scan(
+		&n.ID, &n.EncounterID, &n.PatientID, &n.AuthorID, &n.Status, &n.Title, &n.Complaints, &n.Anamnesis, &n.Examination, &n.Plan,
+		&n.SignedAt, &n.VersionID, &n.CreatedAt, &n.UpdatedAt,
+	)
+	return n, err
+}
+
+func (r *Repository) CreateClinicalNote(n models.ClinicalNote) (string, error) {
+	query := r.sq.Insert("clinical_notes").
+		Columns("encounter_id", "patient_id", "author_id", "status", "title", "complaints", "anamnesis", "examination", "plan", "signed_at").
+		Values(n.EncounterID, n.PatientID, n.AuthorID, n.Status, n.Title, n.Complaints, n.Anamnesis, n.Examination, n.Plan, n.SignedAt).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetClinicalNoteByID(id string) (*models.ClinicalNote, error) {
+	sqlRaw, args, _ := r.selectClinicalNotes().Where(sq.Eq{"id": id}).ToSql()
+
+	n, err := scanClinicalNote(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (r *Repository) getClinicalNoteForUpdate(id string) (*models.ClinicalNote, error) {
+	sqlRaw, args, _ := r.selectClinicalNotes().Where(sq.Eq{"id": id}).Suffix("FOR UPDATE").ToSql()
+
+	n, err := scanClinicalNote(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (r *Repository) SearchClinicalNotes(filter models.ClinicalNoteFilter) ([]models.ClinicalNote, error) {
+	query := r.selectClinicalNotes().OrderBy("created_at DESC")
+
+	if filter.PatientID != "" {
+		query = query.Where(sq.Eq{"patient_id": filter.PatientID})
+	}
+	if filter.EncounterID != "" {
+		query = query.Where(sq.Eq{"encounter_id": filter.EncounterID})
+	}
+	if filter.AuthorID != "" {
+		query = query.Where(sq.Eq{"author_id": filter.AuthorID})
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"status": filter.Status})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []models.ClinicalNote
+	for rows.Next() {
+		n, err := scanClinicalNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+
+	return notes, rows.Err()
+}
+
+// UpdateClinicalNote archives the current version and saves n. If
+// expectedVersion is non-zero and does not match the stored version,
+// ErrVersionConflict is returned.
+func (r *Repository) UpdateClinicalNote(n models.ClinicalNote, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.getClinicalNoteForUpdate(n.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypeComposition, n.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("clinical_notes").
+			Set("status", n.Status).
+			Set("title", n.Title).
+			Set("complaints", n.Complaints).
+			Set("anamnesis", n.Anamnesis).
+			Set("examination", n.Examination).
+			Set("plan", n.Plan).
+			Set("signed_at", n.SignedAt).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": n.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		_, err = tx.db.Exec(sqlRaw, args...)
+		return err
+	})
+}
+
+func (r *Repository) GetClinicalNoteHistory(id string) ([]models.ClinicalNote, error) {
+	current, err := r.GetClinicalNoteByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.ClinicalNote](r, models.ResourceTypeComposition, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.ClinicalNote{*current}, archived...), nil
+}
+
+func (r *Repository) GetClinicalNoteVersion(id string, versionID int) (*models.ClinicalNote, error) {
+	current, err := r.GetClinicalNoteByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.ClinicalNote](r, models.ResourceTypeComposition, id, versionID)
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"hospital-srv/models"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func (r *Repository) selectConditions() sq.SelectBuilder {
+	return r.sq.Select(
+		"c.id", "c.patient_id", "c.encounter_id", "c.recorder_id", "c.code", "i.display", "c.clinical_status", "c.verification_status",
+		"c.note", "c.onset_time", "c.abatement_time", "c.version_id", "c.created_at", "c.updated_at",
+	).
+		From("conditions c").
+		Join("icd10_codes i ON c.code = i.code")
+}
+
+func scanCondition(row rowScanner) (models.Condition, error) {
+	var c models.Condition
+	err := row.Scan(
+		&c.ID, &c.PatientID, &c.EncounterID, &c.RecorderID, &c.Code, &c.CodeDisplay, &c.ClinicalStatus, &c.VerificationStatus,
+		&c.Note, &c.OnsetTime, &c.AbatementTime, &c.VersionID, &c.CreatedAt, &c.UpdatedAt,
+	)
+	return c, err
+}
+
+func (r *Repository) CreateCondition(c models.Condition) (string, error) {
+	query := r.sq.Insert("conditions").
+		Columns("patient_id", "encounter_id", "recorder_id", "code", "clinical_status", "verification_status", "note", "onset_time", "abatement_time").
+		Values(c.PatientID, c.EncounterID, c.RecorderID, c.Code, c.ClinicalStatus, c.VerificationStatus, c.Note, c.OnsetTime, c.AbatementTime).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetConditionByID(id string) (*models.Condition, error) {
+	sqlRaw, args, _ := r.selectConditions().Where(sq.Eq{"c.id": id}).ToSql()
+
+	c, err := scanCondition(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *Repository) getConditionForUpdate(id string) (*models.Condition, error) {
+	sqlRaw, args, _ := r.selectConditions().Where(sq.Eq{"c.id": id}).Suffix("FOR UPDATE OF c").ToSql()
+
+	c, err := scanCondition(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *Repository) SearchConditions(filter models.ConditionFilter) ([]models.Condition, error) {
+	query := r.selectConditions().OrderBy("c.created_at DESC")
+
+	if filter.PatientID != "" {
+		query = query.Where(sq.Eq{"c.patient_id": filter.PatientID})
+	}
+	if filter.EncounterID != "" {
+		query = query.Where(sq.Eq{"c.encounter_id": filter.EncounterID})
+	}
+	if filter.ClinicalStatus != "" {
+		query = query.Where(sq.Eq{"c.clinical_status": filter.ClinicalStatus})
+	}
+	if filter.VerificationStatus != "" {
+		query = query.Where(sq.Eq{"c.verification_status": filter.VerificationStatus})
+	}
+	if filter.Code != "" {
+		query = query.Where(sq.Eq{"c.code": filter.Code})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conditions []models.Condition
+	for rows.Next() {
+		c, err := scanCondition(rows)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+
+	return conditions, rows.Err()
+}
+
+// UpdateCondition archives the current version and saves c. If
+// expectedVersion is non-zero and does not match the stored version,
+// ErrVersionConflict is returned.
+func (r *Repository) UpdateCondition(c models.Condition, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.getConditionForUpdate(c.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypeCondition, c.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("conditions").
+			Set("patient_id", c.PatientID).
+			Set("encounter_id", c.EncounterID).
+			Set("recorder_id", c.RecorderID).
+			Set("code", c.Code).
+			Set("clinical_status", c.ClinicalStatus).
+			Set("verification_status", c.VerificationStatus).
+			Set("note", c.Note).
+			Set("onset_time", c.OnsetTime).
+			Set("abatement_time", c.AbatementTime).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": c.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		_, err = tx.db.Exec(sqlRaw, args...)
+		return err
+	})
+}
+
+func (r *Repository) GetConditionHistory(id string) ([]models.Condition, error) {
+	current, err := r.GetConditionByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.Condition](r, models.ResourceTypeCondition, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.Condition{*current}, archived...), nil
+}
+
+func (r *Repository) GetConditionVersion(id string, versionID int) (*models.Condition, error) {
+	current, err := r.GetConditionByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.Condition](r, models.ResourceTypeCondition, id, versionID)
+}
+
+func (r *Repository) GetICD10Code(code string) (*models.ICD10Code, error) {
+	query := r.sq.Select("code", "display").
+		From("icd10_codes").
+		Where(sq.Eq{"code": code})
+
+	sqlRaw, args, _ := query.ToSql()
+
+	var c models.ICD10Code
+	if err := r.db.QueryRow(sqlRaw, args...).Scan(&c.Code, &c.Display); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchICD10Codes returns up to limit codes whose code starts with text or
+// whose display contains it, ignoring case.
+func (r *Repository) SearchICD10Codes(text string, limit int) ([]models.ICD10Code, error) {
+	pattern := likeEscaper.Replace(text)
+	query := r.sq.Select("code", "display").
+		From("icd10_codes").
+		Where(sq.Or{
+			sq.ILike{"code": pattern + "%"},
+			sq.ILike{"display": "%" + pattern + "%"},
+		}).
+		OrderBy("code").
+		Limit(uint64(limit))
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []models.ICD10Code
+	for rows.Next() {
+		var c models.ICD10Code
+		if err := rows.Scan(&c.Code, &c.Display); err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+	}
+
+	return codes, rows.Err()
+}
+
+// UpsertICD10Codes adds the codes to the code table, replacing the display
+// of codes already present.
+func (r *Repository) UpsertICD10Codes(codes []models.ICD10Code) error {
+	const batchSize = 1000
+
+	return r.WithTx(func(tx *Repository) error {
+		for start := 0; start < len(codes); start += batchSize {
+			query := tx.sq.Insert("icd10_codes").
+				Columns("code", "display").
+				Suffix("ON CONFLICT (code) DO UPDATE SET display = EXCLUDED.display")
+			for _, c := range codes[start:min(start+batchSize, len(codes))] {
+				query = query.Values(c.Code, c.Display)
+			}
+
+			sqlRaw, args, _ := query.ToSql()
+			if _, err := tx.db.Exec(sqlRaw, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,33 +1,104 @@
 package repository
 
 import (
+	"encoding/json"
 	"hospital-srv/models"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
-func (r *Repository) CreateEncounter(encounter models.Encounter) (string, error) {
-	query := r.sq.Insert("encounters").
-		Columns("patient_id", "practitioner_id", "status", "start_time").
-		Values(encounter.PatientID, encounter.PractitionerID, encounter.Status, encounter.StartTime).
-		Suffix("RETURNING id")
-
-	sqlRaw, args, _ := query.ToSql()
-	var id string
-	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
-	return id, err
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (r *Repository) GetAllEncounters() ([]models.EncounterWithDetails, error) {
-	query := r.sq.Select(
-		"e.id", "e.patient_id", "e.practitioner_id", "e.status", "e.start_time", "e.created_at",
-		"pat.id", "pat.first_name", "pat.last_name", "pat.middle_name", "pat.date_of_birth", "pat.gender", "pat.created_at", "pat.updated_at",
-		"pr.id", "pr.first_name", "pr.last_name", "pr.middle_name", "pr.specialization", "pr.created_at",
+func (r *Repository) selectEncounters() sq.SelectBuilder {
+	return r.sq.Select(
+		"e.id", "e.patient_id", "e.practitioner_id", "e.status", "e.class", "e.type", "e.service_type", "e.priority", "e.reason_text", "e.reason_code", "e.start_time", "e.end_time", "e.appointment_id", "e.location_id", identifiersColumn(models.ResourceTypeEncounter, "e.id"), "e.version_id", "e.created_at", "e.updated_at",
+		"pat.id", "pat.first_name", "pat.last_name", "pat.middle_name", "pat.date_of_birth", "pat.gender", "pat.version_id", "pat.created_at", "pat.updated_at",
+		"pr.id", "pr.first_name", "pr.last_name", "pr.middle_name", "pr.specialization", "pr.active", identifiersColumn(models.ResourceTypePractitioner, "pr.id"), "pr.version_id", "pr.created_at", "pr.updated_at",
+		"loc.name",
 	).
 		From("encounters e").
 		Join("patients pat ON e.patient_id = pat.id").
 		Join("practitioners pr ON e.practitioner_id = pr.id").
-		OrderBy("e.start_time DESC")
+		LeftJoin("locations loc ON e.location_id = loc.id")
+}
+
+func scanEncounter(row rowScanner) (models.EncounterWithDetails, error) {
+	var e models.EncounterWithDetails
+	var identifiers, practitionerIdentifiers []byte
+	err := row.Scan(
+		&e.ID, &e.PatientID, &e.PractitionerID, &e.Status, &e.Class, &e.Type, &e.ServiceType, &e.Priority, &e.ReasonText, &e.ReasonCode, &e.StartTime, &e.EndTime, &e.AppointmentID, &e.LocationID, &identifiers, &e.VersionID, &e.CreatedAt, &e.UpdatedAt,
+		&e.Patient.ID, &e.Patient.FirstName, &e.Patient.LastName, &e.Patient.MiddleName, &e.Patient.DateOfBirth, &e.Patient.Gender, &e.Patient.VersionID, &e.Patient.CreatedAt, &e.Patient.UpdatedAt,
+		&e.Practitioner.ID, &e.Practitioner.FirstName, &e.Practitioner.LastName, &e.Practitioner.MiddleName, &e.Practitioner.Specialization, &e.Practitioner.Active, &practitionerIdentifiers, &e.Practitioner.VersionID, &e.Practitioner.CreatedAt, &e.Practitioner.UpdatedAt,
+		&e.LocationName,
+	)
+	if err != nil {
+		return e, err
+	}
+
+	if err := json.Unmarshal(identifiers, &e.Identifiers); err != nil {
+		return e, err
+	}
+	err = json.Unmarshal(practitionerIdentifiers, &e.Practitioner.Identifiers)
+	return e, err
+}
+
+// CreateEncounter saves the encounter with its identifiers, returning
+// ErrDuplicateIdentifier when one is taken.
+func (r *Repository) CreateEncounter(encounter models.Encounter) (string, error) {
+	var id string
+	err := r.WithTx(func(tx *Repository) error {
+		query := tx.sq.Insert("encounters").
+			Columns("patient_id", "practitioner_id", "status", "class", "type", "service_type", "priority", "reason_text", "reason_code", "start_time", "end_time", "appointment_id", "location_id").
+			Values(encounter.PatientID, encounter.PractitionerID, encounter.Status, encounter.Class, encounter.Type, encounter.ServiceType, encounter.Priority, encounter.ReasonText, encounter.ReasonCode, encounter.StartTime, encounter.EndTime, encounter.AppointmentID, encounter.LocationID).
+			Suffix("RETURNING id")
+
+		sqlRaw, args, _ := query.ToSql()
+		if err := tx.db.QueryRow(sqlRaw, args...).Scan(&id); err != nil {
+			return err
+		}
+
+		return tx.setIdentifiers(models.ResourceTypeEncounter, id, encounter.Identifiers)
+	})
+	return id, err
+}
+
+func (r *Repository) GetAllEncounters() ([]models.EncounterWithDetails, error) {
+	return r.SearchEncounters(models.EncounterFilter{})
+}
+
+func (r *Repository) SearchEncounters(filter models.EncounterFilter) ([]models.EncounterWithDetails, error) {
+	query := r.selectEncounters().OrderBy("e.start_time DESC")
+
+	if filter.PatientID != "" {
+		query = query.Where(sq.Eq{"e.patient_id": filter.PatientID})
+	}
+	if len(filter.PatientIDs) > 0 {
+		query = query.Where(sq.Eq{"e.patient_id": filter.PatientIDs})
+	}
+	if filter.PractitionerID != "" {
+		query = query.Where(sq.Eq{"e.practitioner_id": filter.PractitionerID})
+	}
+	if filter.LocationID != "" {
+		query = query.Where(sq.Eq{"e.location_id": filter.LocationID})
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"e.status": filter.Status})
+	}
+	if filter.StartFrom != nil {
+		query = query.Where(sq.GtOrEq{"e.start_time": *filter.StartFrom})
+	}
+	if filter.StartBefore != nil {
+		query = query.Where(sq.Lt{"e.start_time": *filter.StartBefore})
+	}
+	if filter.UpdatedSince != nil {
+		query = query.Where(sq.GtOrEq{"e.updated_at": *filter.UpdatedSince})
+	}
+	if filter.Identifier != nil {
+		query = query.Where(identifierMatch(models.ResourceTypeEncounter, "e.id", *filter.Identifier))
+	}
 
 	sqlRaw, args, _ := query.ToSql()
 	rows, err := r.db.Query(sqlRaw, args...)
@@ -38,54 +109,248 @@ func (r *Repository) GetAllEncounters() ([]models.EncounterWithDetails, error) {
 
 	var encounters []models.EncounterWithDetails
 	for rows.Next() {
-		var e models.EncounterWithDetails
-		err := rows.Scan(
-			&e.ID, &e.PatientID, &e.PractitionerID, &e.Status, &e.StartTime, &e.CreatedAt,
-			&e.Patient.ID, &e.Patient.FirstName, &e.Patient.LastName, &e.Patient.MiddleName, &e.Patient.DateOfBirth, &e.Patient.Gender, &e.Patient.CreatedAt, &e.Patient.UpdatedAt,
-			&e.Practitioner.ID, &e.Practitioner.FirstName, &e.Practitioner.LastName, &e.Practitioner.MiddleName, &e.Practitioner.Specialization, &e.Practitioner.CreatedAt,
-		)
+		e, err := scanEncounter(rows)
 		if err != nil {
 			return nil, err
 		}
 		encounters = append(encounters, e)
 	}
+	rows.Close()
+
+	if err := r.loadStatusHistory(encounters); err != nil {
+		return nil, err
+	}
 
 	return encounters, nil
 }
 
 func (r *Repository) GetEncounterByID(id string) (*models.EncounterWithDetails, error) {
-	query := r.sq.Select(
-		"e.id", "e.patient_id", "e.practitioner_id", "e.status", "e.start_time", "e.created_at",
-		"pat.id", "pat.first_name", "pat.last_name", "pat.middle_name", "pat.date_of_birth", "pat.gender", "pat.created_at", "pat.updated_at",
-		"pr.id", "pr.first_name", "pr.last_name", "pr.middle_name", "pr.specialization", "pr.created_at",
-	).
-		From("encounters e").
-		Join("patients pat ON e.patient_id = pat.id").
-		Join("practitioners pr ON e.practitioner_id = pr.id").
-		Where(sq.Eq{"e.id": id})
+	query := r.selectEncounters().Where(sq.Eq{"e.id": id})
 
 	sqlRaw, args, _ := query.ToSql()
-	row := r.db.QueryRow(sqlRaw, args...)
+	e, err := scanEncounter(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
 
-	var e models.EncounterWithDetails
-	err := row.Scan(
-		&e.ID, &e.PatientID, &e.PractitionerID, &e.Status, &e.StartTime, &e.CreatedAt,
-		&e.Patient.ID, &e.Patient.FirstName, &e.Patient.LastName, &e.Patient.MiddleName, &e.Patient.DateOfBirth, &e.Patient.Gender, &e.Patient.CreatedAt, &e.Patient.UpdatedAt,
-		&e.Practitioner.ID, &e.Practitioner.FirstName, &e.Practitioner.LastName, &e.Practitioner.MiddleName, &e.Practitioner.Specialization, &e.Practitioner.CreatedAt,
-	)
+	encounters := []models.EncounterWithDetails{e}
+	if err := r.loadStatusHistory(encounters); err != nil {
+		return nil, err
+	}
+
+	return &encounters[0], nil
+}
+
+// GetEncounterForUpdate reads the encounter and locks its row until the
+// surrounding transaction ends.
+func (r *Repository) GetEncounterForUpdate(id string) (*models.EncounterWithDetails, error) {
+	query := r.selectEncounters().Where(sq.Eq{"e.id": id}).Suffix("FOR UPDATE OF e")
+
+	sqlRaw, args, _ := query.ToSql()
+	e, err := scanEncounter(r.db.QueryRow(sqlRaw, args...))
 	if err != nil {
 		return nil, err
 	}
 
-	return &e, nil
+	encounters := []models.EncounterWithDetails{e}
+	if err := r.loadStatusHistory(encounters); err != nil {
+		return nil, err
+	}
+
+	return &encounters[0], nil
 }
 
-func (r *Repository) UpdateEncounterStatus(id string, status string) error {
-	query := r.sq.Update("encounters").
-		Set("status", status).
-		Where(sq.Eq{"id": id})
+// SearchOverlappingEncounters returns the practitioner's encounters that
+// are not cancelled and cover part of start to end, earliest first.
+// Encounters without an end are taken to last visitLength.
+func (r *Repository) SearchOverlappingEncounters(practitionerID string, start time.Time, end time.Time, visitLength time.Duration) ([]models.EncounterWithDetails, error) {
+	query := r.selectEncounters().
+		Where(encounterOverlaps(practitionerID, start, end, visitLength)).
+		OrderBy("e.start_time")
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var encounters []models.EncounterWithDetails
+	for rows.Next() {
+		e, err := scanEncounter(rows)
+		if err != nil {
+			return nil, err
+		}
+		encounters = append(encounters, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := r.loadStatusHistory(encounters); err != nil {
+		return nil, err
+	}
+
+	return encounters, nil
+}
+
+// HasOverlappingEncounter reports whether the practitioner has an encounter
+// that is not cancelled and covers part of start to end. Encounters without
+// an end are taken to last visitLength.
+func (r *Repository) HasOverlappingEncounter(practitionerID string, start time.Time, end time.Time, visitLength time.Duration) (bool, error) {
+	query := r.sq.Select("1").
+		From("encounters e").
+		Where(encounterOverlaps(practitionerID, start, end, visitLength)).
+		Prefix("SELECT EXISTS (").
+		Suffix(")")
+
+	sqlRaw, args, _ := query.ToSql()
+	var exists bool
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&exists)
+	return exists, err
+}
+
+// encounterOverlaps matches the encounters e of the practitioner that are
+// not cancelled and cover part of start to end.
+func encounterOverlaps(practitionerID string, start time.Time, end time.Time, visitLength time.Duration) sq.Sqlizer {
+	return sq.And{
+		sq.Eq{"e.practitioner_id": practitionerID},
+		sq.NotEq{"e.status": models.EncounterStatusCancelled},
+		sq.Lt{"e.start_time": end},
+		sq.Or{
+			sq.Gt{"e.end_time": start},
+			sq.And{sq.Eq{"e.end_time": nil}, sq.Gt{"e.start_time": start.Add(-visitLength)}},
+		},
+	}
+}
+
+// loadStatusHistory fills in StatusHistory, oldest change first, for all
+// encounters with one query.
+func (r *Repository) loadStatusHistory(encounters []models.EncounterWithDetails) error {
+	if len(encounters) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(encounters))
+	ids := make([]string, 0, len(encounters))
+	for i, e := range encounters {
+		index[e.ID] = i
+		ids = append(ids, e.ID)
+	}
+
+	query := r.sq.Select("encounter_id", "status", "actor", "changed_at").
+		From("encounter_status_history").
+		Where(sq.Eq{"encounter_id": ids}).
+		OrderBy("changed_at", "id")
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var encounterID string
+		var change models.EncounterStatusChange
+		if err := rows.Scan(&encounterID, &change.Status, &change.Actor, &change.ChangedAt); err != nil {
+			return err
+		}
+		i := index[encounterID]
+		encounters[i].StatusHistory = append(encounters[i].StatusHistory, change)
+	}
+
+	return rows.Err()
+}
+
+// AddEncounterStatusChange appends the encounter's new status to its status
+// history. An empty actor is stored as unknown.
+func (r *Repository) AddEncounterStatusChange(encounterID string, status string, actor string) error {
+	var actorValue *string
+	if actor != "" {
+		actorValue = &actor
+	}
+
+	query := r.sq.Insert("encounter_status_history").
+		Columns("encounter_id", "status", "actor").
+		Values(encounterID, status, actorValue)
 
 	sqlRaw, args, _ := query.ToSql()
 	_, err := r.db.Exec(sqlRaw, args...)
 	return err
 }
+
+// UpdateEncounter archives the current version and bumps version_id.
+// A non-zero expectedVersion must match the stored version or
+// ErrVersionConflict is returned. Identifiers are replaced unless nil.
+func (r *Repository) UpdateEncounter(encounter models.Encounter, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.GetEncounterForUpdate(encounter.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypeEncounter, encounter.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("encounters").
+			Set("patient_id", encounter.PatientID).
+			Set("practitioner_id", encounter.PractitionerID).
+			Set("status", encounter.Status).
+			Set("class", encounter.Class).
+			Set("type", encounter.Type).
+			Set("service_type", encounter.ServiceType).
+			Set("priority", encounter.Priority).
+			Set("reason_text", encounter.ReasonText).
+			Set("reason_code", encounter.ReasonCode).
+			Set("start_time", encounter.StartTime).
+			Set("end_time", encounter.EndTime).
+			Set("location_id", encounter.LocationID).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": encounter.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		if _, err := tx.db.Exec(sqlRaw, args...); err != nil {
+			return err
+		}
+
+		if encounter.Identifiers == nil {
+			return nil
+		}
+		return tx.setIdentifiers(models.ResourceTypeEncounter, encounter.ID, encounter.Identifiers)
+	})
+}
+
+func (r *Repository) GetEncounterHistory(id string) ([]models.EncounterWithDetails, error) {
+	current, err := r.GetEncounterByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.EncounterWithDetails](r, models.ResourceTypeEncounter, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.EncounterWithDetails{*current}, archived...), nil
+}
+
+func (r *Repository) GetEncounterVersion(id string, versionID int) (*models.EncounterWithDetails, error) {
+	current, err := r.GetEncounterByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.EncounterWithDetails](r, models.ResourceTypeEncounter, id, versionID)
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"encoding/json"
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+func (r *Repository) CreateExportJob(job models.ExportJob) (string, error) {
+	query := r.sq.Insert("export_jobs").
+		Columns("status", "types", "since", "request", "transaction_time").
+		Values(job.Status, pq.Array(job.Types), job.Since, job.Request, job.TransactionTime).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetExportJob(id string) (*models.ExportJob, error) {
+	query := r.sq.Select("id", "status", "types", "since", "request", "transaction_time", "output", "error", "created_at", "completed_at").
+		From("export_jobs").
+		Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	var job models.ExportJob
+	var output []byte
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&job.ID, &job.Status, pq.Array(&job.Types), &job.Since, &job.Request,
+		&job.TransactionTime, &output, &job.Error, &job.CreatedAt, &job.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(output, &job.Output); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CompleteExportJob records the files written by an export still in
+// progress.
+func (r *Repository) CompleteExportJob(id string, output []models.ExportFile) error {
+	payload, err := json.Marshal(output)
+	if err != nil {
+		return err
+	}
+
+	query := r.sq.Update("export_jobs").
+		Set("status", models.ExportStatusCompleted).
+		Set("output", payload).
+		Set("completed_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id, "status": models.ExportStatusInProgress})
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err = r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+// FailExportJob records why an export still in progress failed.
+func (r *Repository) FailExportJob(id string, message string) error {
+	_, err := r.failExportJobs(sq.Eq{"id": id}, message)
+	return err
+}
+
+// FailUnfinishedExportJobs fails every export still in progress, e.g.
+// after a restart interrupted them, and returns how many there were.
+func (r *Repository) FailUnfinishedExportJobs(message string) (int64, error) {
+	return r.failExportJobs(nil, message)
+}
+
+func (r *Repository) failExportJobs(where sq.Sqlizer, message string) (int64, error) {
+	query := r.sq.Update("export_jobs").
+		Set("status", models.ExportStatusFailed).
+		Set("error", message).
+		Set("completed_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"status": models.ExportStatusInProgress})
+
+	if where != nil {
+		query = query.Where(where)
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	result, err := r.db.Exec(sqlRaw, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *Repository) DeleteExportJob(id string) error {
+	sqlRaw, args, _ := r.sq.Delete("export_jobs").Where(sq.Eq{"id": id}).ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
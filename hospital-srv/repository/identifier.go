@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+// ErrDuplicateIdentifier is returned when an identifier is already assigned
+// to another resource of the same type.
+var ErrDuplicateIdentifier = errors.New("identifier is already assigned to another resource")
+
+// identifiersColumn selects the identifiers of the resourceType row whose id
+// is in idColumn as a JSON array.
+func identifiersColumn(resourceType string, idColumn string) string {
+	return fmt.Sprintf(`COALESCE((SELECT json_agg(json_build_object('system', ri.system, 'value', ri.value) ORDER BY ri.system, ri.value)
+		FROM resource_identifiers ri WHERE ri.resource_type = '%s' AND ri.resource_id = %s), '[]')`, resourceType, idColumn)
+}
+
+// identifierMatch matches the resourceType rows whose id is in idColumn and
+// that have an identifier matching filter.
+func identifierMatch(resourceType string, idColumn string, filter models.IdentifierFilter) sq.Sqlizer {
+	query := sq.Select("1").
+		From("resource_identifiers ri").
+		Where(sq.Eq{"ri.resource_type": resourceType}).
+		Where("ri.resource_id = " + idColumn)
+	if filter.System != nil {
+		query = query.Where(sq.Eq{"ri.system": *filter.System})
+	}
+	if filter.Value != "" {
+		query = query.Where(sq.Eq{"ri.value": filter.Value})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	return sq.Expr("EXISTS ("+sqlRaw+")", args...)
+}
+
+// setIdentifiers replaces the identifiers of a resource. Repeated
+// identifiers are stored once.
+func (r *Repository) setIdentifiers(resourceType string, id string, identifiers []models.Identifier) error {
+	deleteQuery := r.sq.Delete("resource_identifiers").
+		Where(sq.Eq{"resource_type": resourceType, "resource_id": id})
+
+	sqlRaw, args, _ := deleteQuery.ToSql()
+	if _, err := r.db.Exec(sqlRaw, args...); err != nil {
+		return err
+	}
+
+	if len(identifiers) == 0 {
+		return nil
+	}
+
+	insertQuery := r.sq.Insert("resource_identifiers").
+		Columns("resource_type", "resource_id", "system", "value")
+	seen := map[models.Identifier]bool{}
+	for _, identifier := range identifiers {
+		if seen[identifier] {
+			continue
+		}
+		seen[identifier] = true
+		insertQuery = insertQuery.Values(resourceType, id, identifier.System, identifier.Value)
+	}
+
+	sqlRaw, args, _ = insertQuery.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicateIdentifier
+	}
+	return err
+}
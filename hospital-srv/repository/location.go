@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func (r *Repository) selectLocations() sq.SelectBuilder {
+	return r.sq.Select("id", "status", "name", "physical_type", "organization_id", "part_of", "bed_status", "version_id", "created_at", "updated_at").
+		From("locations")
+}
+
+func scanLocation(row rowScanner) (models.Location, error) {
+	var l models.Location
+	err := row.Scan(&l.ID, &l.Status, &l.Name, &l.PhysicalType, &l.OrganizationID, &l.PartOf, &l.BedStatus, &l.VersionID, &l.CreatedAt, &l.UpdatedAt)
+	return l, err
+}
+
+func (r *Repository) CreateLocation(l models.Location) (string, error) {
+	query := r.sq.Insert("locations").
+		Columns("status", "name", "physical_type", "organization_id", "part_of", "bed_status").
+		Values(l.Status, l.Name, l.PhysicalType, l.OrganizationID, l.PartOf, l.BedStatus).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetLocationByID(id string) (*models.Location, error) {
+	sqlRaw, args, _ := r.selectLocations().Where(sq.Eq{"id": id}).ToSql()
+
+	l, err := scanLocation(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetLocationForUpdate reads the location and locks its row until the
+// surrounding transaction ends.
+func (r *Repository) GetLocationForUpdate(id string) (*models.Location, error) {
+	sqlRaw, args, _ := r.selectLocations().Where(sq.Eq{"id": id}).Suffix("FOR UPDATE").ToSql()
+
+	l, err := scanLocation(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// SearchLocations returns the locations matching filter. Name matches the
+// start of the name, ignoring case.
+func (r *Repository) SearchLocations(filter models.LocationFilter) ([]models.Location, error) {
+	query := r.selectLocations().OrderBy("name ASC")
+
+	if filter.Name != "" {
+		query = query.Where(sq.ILike{"name": likeEscaper.Replace(filter.Name) + "%"})
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"status": filter.Status})
+	}
+	if filter.PhysicalType != "" {
+		query = query.Where(sq.Eq{"physical_type": filter.PhysicalType})
+	}
+	if filter.OrganizationID != "" {
+		query = query.Where(sq.Eq{"organization_id": filter.OrganizationID})
+	}
+	if filter.PartOf != "" {
+		query = query.Where(sq.Eq{"part_of": filter.PartOf})
+	}
+	if filter.BedStatus != "" {
+		query = query.Where(sq.Eq{"bed_status": filter.BedStatus})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []models.Location
+	for rows.Next() {
+		l, err := scanLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+
+	return locations, rows.Err()
+}
+
+// IsLocationAncestor reports whether ancestorID is id itself or one of the
+// locations it is part of, directly or indirectly.
+func (r *Repository) IsLocationAncestor(ancestorID string, id string) (bool, error) {
+	return r.isAncestor("locations", ancestorID, id)
+}
+
+// UpdateLocation archives the current version and saves l. If
+// expectedVersion is non-zero and does not match the stored version,
+// ErrVersionConflict is returned.
+func (r *Repository) UpdateLocation(l models.Location, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.GetLocationForUpdate(l.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypeLocation, l.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("locations").
+			Set("status", l.Status).
+			Set("name", l.Name).
+			Set("physical_type", l.PhysicalType).
+			Set("organization_id", l.OrganizationID).
+			Set("part_of", l.PartOf).
+			Set("bed_status", l.BedStatus).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": l.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		_, err = tx.db.Exec(sqlRaw, args...)
+		return err
+	})
+}
+
+func (r *Repository) GetLocationHistory(id string) ([]models.Location, error) {
+	current, err := r.GetLocationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.Location](r, models.ResourceTypeLocation, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.Location{*current}, archived...), nil
+}
+
+func (r *Repository) GetLocationVersion(id string, versionID int) (*models.Location, error) {
+	current, err := r.GetLocationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.Location](r, models.ResourceTypeLocation, id, versionID)
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// ErrConflictingPrescription is returned when a new prescription is made for
+// a drug the patient already has an active prescription for.
+var ErrConflictingPrescription = errors.New("patient already has an active prescription for this drug")
+
+func (r *Repository) selectMedicationRequests() sq.SelectBuilder {
+	return r.sq.Select(
+		"mr.id", "mr.patient_id", "mr.encounter_id", "mr.requester_id",
+		"m.code", "m.display", "m.atc_code", "m.form", "m.strength",
+		"mr.status", "mr.dose_value", "mr.dose_unit", "mr.frequency", "mr.period", "mr.period_unit", "mr.duration", "mr.duration_unit",
+		"mr.note", "mr.authored_on", "mr.version_id", "mr.created_at", "mr.updated_at",
+	).
+		From("medication_requests mr").
+		Join("medications m ON mr.medication_code = m.code")
+}
+
+func scanMedicationRequest(row rowScanner) (models.MedicationRequest, error) {
+	var mr models.MedicationRequest
+	err := row.Scan(
+		&mr.ID, &mr.PatientID, &mr.EncounterID, &mr.RequesterID,
+		&mr.Medication.Code, &mr.Medication.Display, &mr.Medication.ATCCode, &mr.Medication.Form, &mr.Medication.Strength,
+		&mr.Status, &mr.DoseValue, &mr.DoseUnit, &mr.Frequency, &mr.Period, &mr.PeriodUnit, &mr.Duration, &mr.DurationUnit,
+		&mr.Note, &mr.AuthoredOn, &mr.VersionID, &mr.CreatedAt, &mr.UpdatedAt,
+	)
+	return mr, err
+}
+
+// CreateMedicationRequest saves a prescription, or returns
+// ErrConflictingPrescription when the patient already has an active
+// prescription for a medication with the same ATC code. The patient row is
+// locked so that concurrent prescriptions are checked one after another.
+func (r *Repository) CreateMedicationRequest(mr models.MedicationRequest) (string, error) {
+	var id string
+	err := r.WithTx(func(tx *Repository) error {
+		lock := tx.sq.Select("id").From("patients").Where(sq.Eq{"id": mr.PatientID}).Suffix("FOR UPDATE")
+		sqlRaw, args, _ := lock.ToSql()
+		if err := tx.db.QueryRow(sqlRaw, args...).Scan(new(string)); err != nil {
+			return err
+		}
+
+		conflict := tx.sq.Select("mr.id").
+			From("medication_requests mr").
+			Join("medications m ON mr.medication_code = m.code").
+			Where(sq.Eq{"mr.patient_id": mr.PatientID, "mr.status": models.MedicationRequestStatusActive, "m.atc_code": mr.Medication.ATCCode}).
+			Limit(1)
+
+		sqlRaw, args, _ = conflict.ToSql()
+		var conflictID string
+		err := tx.db.QueryRow(sqlRaw, args...).Scan(&conflictID)
+		if err == nil {
+			return fmt.Errorf("%w: MedicationRequest/%s", ErrConflictingPrescription, conflictID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		query := tx.sq.Insert("medication_requests").
+			Columns("patient_id", "encounter_id", "requester_id", "medication_code", "status", "dose_value", "dose_unit",
+				"frequency", "period", "period_unit", "duration", "duration_unit", "note").
+			Values(mr.PatientID, mr.EncounterID, mr.RequesterID, mr.Medication.Code, mr.Status, mr.DoseValue, mr.DoseUnit,
+				mr.Frequency, mr.Period, mr.PeriodUnit, mr.Duration, mr.DurationUnit, mr.Note).
+			Suffix("RETURNING id")
+
+		sqlRaw, args, _ = query.ToSql()
+		return tx.db.QueryRow(sqlRaw, args...).Scan(&id)
+	})
+	return id, err
+}
+
+func (r *Repository) GetMedicationRequestByID(id string) (*models.MedicationRequest, error) {
+	sqlRaw, args, _ := r.selectMedicationRequests().Where(sq.Eq{"mr.id": id}).ToSql()
+
+	mr, err := scanMedicationRequest(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+func (r *Repository) getMedicationRequestForUpdate(id string) (*models.MedicationRequest, error) {
+	sqlRaw, args, _ := r.selectMedicationRequests().Where(sq.Eq{"mr.id": id}).Suffix("FOR UPDATE OF mr").ToSql()
+
+	mr, err := scanMedicationRequest(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &mr, nil
+}
+
+func (r *Repository) SearchMedicationRequests(filter models.MedicationRequestFilter) ([]models.MedicationRequest, error) {
+	query := r.selectMedicationRequests().OrderBy("mr.authored_on DESC")
+
+	if filter.PatientID != "" {
+		query = query.Where(sq.Eq{"mr.patient_id": filter.PatientID})
+	}
+	if filter.EncounterID != "" {
+		query = query.Where(sq.Eq{"mr.encounter_id": filter.EncounterID})
+	}
+	if filter.RequesterID != "" {
+		query = query.Where(sq.Eq{"mr.requester_id": filter.RequesterID})
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"mr.status": filter.Status})
+	}
+	if filter.MedicationCode != "" {
+		query = query.Where(sq.Eq{"mr.medication_code": filter.MedicationCode})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []models.MedicationRequest
+	for rows.Next() {
+		mr, err := scanMedicationRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, mr)
+	}
+
+	return requests, rows.Err()
+}
+
+// UpdateMedicationRequest archives the current version and saves the status,
+// dosage and note of mr. If expectedVersion is non-zero and does not match
+// the stored version, ErrVersionConflict is returned.
+func (r *Repository) UpdateMedicationRequest(mr models.MedicationRequest, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.getMedicationRequestForUpdate(mr.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypeMedicationRequest, mr.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("medication_requests").
+			Set("status", mr.Status).
+			Set("dose_value", mr.DoseValue).
+			Set("dose_unit", mr.DoseUnit).
+			Set("frequency", mr.Frequency).
+			Set("period", mr.Period).
+			Set("period_unit", mr.PeriodUnit).
+			Set("duration", mr.Duration).
+			Set("duration_unit", mr.DurationUnit).
+			Set("note", mr.Note).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": mr.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		_, err = tx.db.Exec(sqlRaw, args...)
+		return err
+	})
+}
+
+func (r *Repository) GetMedicationRequestHistory(id string) ([]models.MedicationRequest, error) {
+	current, err := r.GetMedicationRequestByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.MedicationRequest](r, models.ResourceTypeMedicationRequest, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.MedicationRequest{*current}, archived...), nil
+}
+
+func (r *Repository) GetMedicationRequestVersion(id string, versionID int) (*models.MedicationRequest, error) {
+	current, err := r.GetMedicationRequestByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.MedicationRequest](r, models.ResourceTypeMedicationRequest, id, versionID)
+}
+
+func (r *Repository) GetMedication(code string) (*models.Medication, error) {
+	query := r.sq.Select("code", "display", "atc_code", "form", "strength").
+		From("medications").
+		Where(sq.Eq{"code": code})
+
+	sqlRaw, args, _ := query.ToSql()
+
+	var m models.Medication
+	if err := r.db.QueryRow(sqlRaw, args...).Scan(&m.Code, &m.Display, &m.ATCCode, &m.Form, &m.Strength); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SearchMedications returns up to limit medications whose code or ATC code
+// starts with text or whose display contains it, ignoring case.
+func (r *Repository) SearchMedications(text string, limit int) ([]models.Medication, error) {
+	pattern := likeEscaper.Replace(text)
+	query := r.sq.Select("code", "display", "atc_code", "form", "strength").
+		From("medications").
+		Where(sq.Or{
+			sq.ILike{"code": pattern + "%"},
+			sq.ILike{"atc_code": pattern + "%"},
+			sq.ILike{"display": "%" + pattern + "%"},
+		}).
+		OrderBy("display").
+		Limit(uint64(limit))
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var medications []models.Medication
+	for rows.Next() {
+		var m models.Medication
+		if err := rows.Scan(&m.Code, &m.Display, &m.ATCCode, &m.Form, &m.Strength); err != nil {
+			return nil, err
+		}
+		medications = append(medications, m)
+	}
+
+	return medications, rows.Err()
+}
+
+// UpsertMedications adds the medications to the dictionary, replacing the
+// details of medications already present.
+func (r *Repository) UpsertMedications(medications []models.Medication) error {
+	const batchSize = 1000
+
+	return r.WithTx(func(tx *Repository) error {
+		for start := 0; start < len(medications); start += batchSize {
+			query := tx.sq.Insert("medications").
+				Columns("code", "display", "atc_code", "form", "strength").
+				Suffix("ON CONFLICT (code) DO UPDATE SET display = EXCLUDED.display, atc_code = EXCLUDED.atc_code, form = EXCLUDED.form, strength = EXCLUDED.strength")
+			for _, m := range medications[start:min(start+batchSize, len(medications))] {
+				query = query.Values(m.Code, m.Display, m.ATCCode, m.Form, m.Strength)
+			}
+
+			sqlRaw, args, _ := query.ToSql()
+			if _, err := tx.db.Exec(sqlRaw, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"database/sql"
+	"hospital-srv/models"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var notificationColumns = []string{"id", "subscription_id", "event_type", "payload", "status", "attempts", "next_attempt_at", "last_error", "created_at", "delivered_at"}
+
+func scanNotification(row rowScanner) (models.Notification, error) {
+	var n models.Notification
+	err := row.Scan(&n.ID, &n.SubscriptionID, &n.EventType, &n.Payload, &n.Status, &n.Attempts, &n.NextAttemptAt, &n.LastError, &n.CreatedAt, &n.DeliveredAt)
+	return n, err
+}
+
+func (r *Repository) queryNotifications(sqlRaw string, args ...interface{}) ([]models.Notification, error) {
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []models.Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (r *Repository) EnqueueNotification(subscriptionID string, eventType string, payload []byte) error {
+	query := r.sq.Insert("notification_outbox").
+		Columns("subscription_id", "event_type", "payload").
+		Values(subscriptionID, eventType, payload)
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+// ClaimDueNotifications picks up to limit pending notifications whose next
+// attempt is due and pushes their next attempt past lease, so concurrent
+// dispatchers never send the same notification twice.
+func (r *Repository) ClaimDueNotifications(limit int, lease time.Duration) ([]models.Notification, error) {
+	// The subquery keeps the default "?" placeholders; the outer builder
+	// numbers them when the statement is rendered.
+	due := sq.Select("id").
+		From("notification_outbox").
+		Where(sq.Eq{"status": models.NotificationStatusPending}).
+		Where(sq.Expr("next_attempt_at <= NOW()")).
+		OrderBy("next_attempt_at").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	query := r.sq.Update("notification_outbox").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("next_attempt_at", sq.Expr("NOW() + make_interval(secs => ?)", lease.Seconds())).
+		Where(sq.Expr("id IN (?)", due)).
+		Suffix("RETURNING " + strings.Join(notificationColumns, ", "))
+
+	sqlRaw, args, _ := query.ToSql()
+	return r.queryNotifications(sqlRaw, args...)
+}
+
+func (r *Repository) MarkNotificationDelivered(id string) error {
+	query := r.sq.Update("notification_outbox").
+		Set("status", models.NotificationStatusDelivered).
+		Set("last_error", nil).
+		Set("delivered_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+// MarkNotificationFailed records a failed attempt. The notification is
+// retried at nextAttempt, or dead-lettered when nextAttempt is nil.
+func (r *Repository) MarkNotificationFailed(id string, deliveryError string, nextAttempt *time.Time) error {
+	query := r.sq.Update("notification_outbox").
+		Set("last_error", deliveryError).
+		Where(sq.Eq{"id": id})
+
+	if nextAttempt != nil {
+		query = query.Set("next_attempt_at", *nextAttempt)
+	} else {
+		query = query.Set("status", models.NotificationStatusDead)
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+func (r *Repository) GetNotificationsByStatus(status string) ([]models.Notification, error) {
+	query := r.sq.Select(notificationColumns...).
+		From("notification_outbox").
+		Where(sq.Eq{"status": status}).
+		OrderBy("created_at DESC")
+
+	sqlRaw, args, _ := query.ToSql()
+	return r.queryNotifications(sqlRaw, args...)
+}
+
+// ResendNotifications moves dead-lettered notifications back to the queue
+// with a fresh attempt budget. With no ids every dead notification is
+// requeued. It returns the number of notifications requeued.
+func (r *Repository) ResendNotifications(ids []string) (int64, error) {
+	query := r.sq.Update("notification_outbox").
+		Set("status", models.NotificationStatusPending).
+		Set("attempts", 0).
+		Set("next_attempt_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"status": models.NotificationStatusDead})
+
+	if len(ids) > 0 {
+		query = query.Where(sq.Eq{"id": ids})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	result, err := r.db.Exec(sqlRaw, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	if err == nil && count == 0 && len(ids) == 1 {
+		return 0, sql.ErrNoRows
+	}
+	return count, err
+}
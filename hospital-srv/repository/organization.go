@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+func (r *Repository) selectOrganizations() sq.SelectBuilder {
+	return r.sq.Select("id", "active", "type", "name", "part_of", "version_id", "created_at", "updated_at").
+		From("organizations")
+}
+
+func scanOrganization(row rowScanner) (models.Organization, error) {
+	var o models.Organization
+	err := row.Scan(&o.ID, &o.Active, &o.Type, &o.Name, &o.PartOf, &o.VersionID, &o.CreatedAt, &o.UpdatedAt)
+	return o, err
+}
+
+func (r *Repository) CreateOrganization(o models.Organization) (string, error) {
+	query := r.sq.Insert("organizations").
+		Columns("active", "type", "name", "part_of").
+		Values(o.Active, o.Type, o.Name, o.PartOf).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetOrganizationByID(id string) (*models.Organization, error) {
+	sqlRaw, args, _ := r.selectOrganizations().Where(sq.Eq{"id": id}).ToSql()
+
+	o, err := scanOrganization(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *Repository) getOrganizationForUpdate(id string) (*models.Organization, error) {
+	sqlRaw, args, _ := r.selectOrganizations().Where(sq.Eq{"id": id}).Suffix("FOR UPDATE").ToSql()
+
+	o, err := scanOrganization(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// SearchOrganizations returns the organizations matching filter. Name
+// matches the start of the name, ignoring case.
+func (r *Repository) SearchOrganizations(filter models.OrganizationFilter) ([]models.Organization, error) {
+	query := r.selectOrganizations().OrderBy("name ASC")
+
+	if filter.Name != "" {
+		query = query.Where(sq.ILike{"name": likeEscaper.Replace(filter.Name) + "%"})
+	}
+	if filter.Type != "" {
+		query = query.Where(sq.Eq{"type": filter.Type})
+	}
+	if filter.PartOf != "" {
+		query = query.Where(sq.Eq{"part_of": filter.PartOf})
+	}
+	if filter.Active != nil {
+		query = query.Where(sq.Eq{"active": *filter.Active})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var organizations []models.Organization
+	for rows.Next() {
+		o, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, o)
+	}
+
+	return organizations, rows.Err()
+}
+
+// IsOrganizationAncestor reports whether ancestorID is id itself or one of
+// the organizations it is part of, directly or indirectly.
+func (r *Repository) IsOrganizationAncestor(ancestorID string, id string) (bool, error) {
+	return r.isAncestor("organizations", ancestorID, id)
+}
+
+// isAncestor walks the part_of chain of table upwards from id.
+func (r *Repository) isAncestor(table string, ancestorID string, id string) (bool, error) {
+	query := `WITH RECURSIVE ancestors AS (
+		SELECT id, part_of FROM ` + table + ` WHERE id = $1
+		UNION
+		SELECT t.id, t.part_of FROM ` + table + ` t JOIN ancestors a ON t.id = a.part_of
+	)
+	SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`
+
+	var found bool
+	err := r.db.QueryRow(query, id, ancestorID).Scan(&found)
+	return found, err
+}
+
+// UpdateOrganization archives the current version and saves o. If
+// expectedVersion is non-zero and does not match the stored version,
+// ErrVersionConflict is returned.
+func (r *Repository) UpdateOrganization(o models.Organization, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.getOrganizationForUpdate(o.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypeOrganization, o.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("organizations").
+			Set("active", o.Active).
+			Set("type", o.Type).
+			Set("name", o.Name).
+			Set("part_of", o.PartOf).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": o.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		_, err = tx.db.Exec(sqlRaw, args...)
+		return err
+	})
+}
+
+func (r *Repository) GetOrganizationHistory(id string) ([]models.Organization, error) {
+	current, err := r.GetOrganizationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.Organization](r, models.ResourceTypeOrganization, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.Organization{*current}, archived...), nil
+}
+
+func (r *Repository) GetOrganizationVersion(id string, versionID int) (*models.Organization, error) {
+	current, err := r.GetOrganizationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.Organization](r, models.ResourceTypeOrganization, id, versionID)
+}
+
+// locationDepartments is a recursive CTE pairing each location with its
+// department: its managing organization or, without one, the department of
+// the nearest location it is part of that has one.
+const locationDepartments = `location_departments AS (
+		SELECT id, organization_id AS department_id FROM locations WHERE organization_id IS NOT NULL
+		UNION
+		SELECT l.id, d.department_id FROM locations l
+		JOIN location_departments d ON l.part_of = d.id
+		WHERE l.organization_id IS NULL
+	)`
+
+// GetDepartmentOccupancy summarises each active organization, counting
+// the locations of its department as given by locationDepartments.
+func (r *Repository) GetDepartmentOccupancy() ([]models.DepartmentOccupancy, error) {
+	query := `WITH RECURSIVE ` + locationDepartments + `,
+	current_encounters AS (
+		SELECT e.location_id, e.patient_id FROM encounters e
+		WHERE e.location_id IS NOT NULL AND e.status = ANY($1)
+	)
+	SELECT o.id, o.name, o.part_of,
+		(SELECT COUNT(DISTINCT pr.practitioner_id) FROM practitioner_roles pr
+			JOIN practitioners p ON p.id = pr.practitioner_id
+			WHERE pr.organization_id = o.id AND pr.active AND p.active),
+		(SELECT COUNT(*) FROM location_departments d
+			JOIN locations l ON l.id = d.id
+			WHERE d.department_id = o.id AND l.physical_type = $2 AND l.status = $3),
+		(SELECT COUNT(*) FROM location_departments d
+			JOIN locations l ON l.id = d.id
+			WHERE d.department_id = o.id AND l.physical_type = $2 AND l.status = $3 AND l.bed_status = $4),
+		(SELECT COUNT(DISTINCT e.patient_id) FROM current_encounters e
+			JOIN location_departments d ON d.id = e.location_id
+			WHERE d.department_id = o.id)
+	FROM organizations o
+	WHERE o.active
+	ORDER BY o.name`
+
+	currentStatuses := []string{models.EncounterStatusArrived, models.EncounterStatusInProgress}
+	rows, err := r.db.Query(query, pq.Array(currentStatuses), models.LocationTypeBed, models.LocationStatusActive, models.BedStatusOccupied)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occupancy := []models.DepartmentOccupancy{}
+	for rows.Next() {
+		var d models.DepartmentOccupancy
+		if err := rows.Scan(&d.OrganizationID, &d.Name, &d.PartOf, &d.Practitioners, &d.Beds, &d.OccupiedBeds, &d.Patients); err != nil {
+			return nil, err
+		}
+		occupancy = append(occupancy, d)
+	}
+
+	return occupancy, rows.Err()
+}
@@ -19,10 +19,21 @@ func (r *Repository) CreatePatient(patient models.Patient) (string, error) {
 }
 
 func (r *Repository) GetAllPatients() ([]models.Patient, error) {
-	query := r.sq.Select("id", "first_name", "last_name", "middle_name", "date_of_birth", "gender", "created_at", "updated_at").
+	return r.SearchPatients(models.PatientFilter{})
+}
+
+func (r *Repository) SearchPatients(filter models.PatientFilter) ([]models.Patient, error) {
+	query := r.sq.Select("id", "first_name", "last_name", "middle_name", "date_of_birth", "gender", "version_id", "created_at", "updated_at").
 		From("patients").
 		OrderBy("created_at DESC")
 
+	if len(filter.IDs) > 0 {
+		query = query.Where(sq.Eq{"id": filter.IDs})
+	}
+	if filter.UpdatedSince != nil {
+		query = query.Where(sq.GtOrEq{"updated_at": *filter.UpdatedSince})
+	}
+
 	sqlRaw, args, _ := query.ToSql()
 	rows, err := r.db.Query(sqlRaw, args...)
 	if err != nil {
@@ -33,7 +44,7 @@ func (r *Repository) GetAllPatients() ([]models.Patient, error) {
 	var patients []models.Patient
 	for rows.Next() {
 		var p models.Patient
-		err := rows.Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.DateOfBirth, &p.Gender, &p.CreatedAt, &p.UpdatedAt)
+		err := rows.Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.DateOfBirth, &p.Gender, &p.VersionID, &p.CreatedAt, &p.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -44,7 +55,7 @@ func (r *Repository) GetAllPatients() ([]models.Patient, error) {
 }
 
 func (r *Repository) GetPatientByID(id string) (*models.Patient, error) {
-	query := r.sq.Select("id", "first_name", "last_name", "middle_name", "date_of_birth", "gender", "created_at", "updated_at").
+	query := r.sq.Select("id", "first_name", "last_name", "middle_name", "date_of_birth", "gender", "version_id", "created_at", "updated_at").
 		From("patients").
 		Where(sq.Eq{"id": id})
 
@@ -52,7 +63,7 @@ func (r *Repository) GetPatientByID(id string) (*models.Patient, error) {
 	row := r.db.QueryRow(sqlRaw, args...)
 
 	var p models.Patient
-	err := row.Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.DateOfBirth, &p.Gender, &p.CreatedAt, &p.UpdatedAt)
+	err := row.Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.DateOfBirth, &p.Gender, &p.VersionID, &p.CreatedAt, &p.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -60,6 +71,26 @@ func (r *Repository) GetPatientByID(id string) (*models.Patient, error) {
 	return &p, nil
 }
 
+// FindPatientByDemographics returns the oldest patient with the given
+// names, ignoring case, and date of birth, or sql.ErrNoRows.
+func (r *Repository) FindPatientByDemographics(firstName string, lastName string, dateOfBirth string) (*models.Patient, error) {
+	query := r.sq.Select("id", "first_name", "last_name", "middle_name", "date_of_birth", "gender", "version_id", "created_at", "updated_at").
+		From("patients").
+		Where(sq.Expr("LOWER(first_name) = LOWER(?)", firstName)).
+		Where(sq.Expr("LOWER(last_name) = LOWER(?)", lastName)).
+		Where(sq.Eq{"date_of_birth": dateOfBirth}).
+		OrderBy("created_at ASC").
+		Limit(1)
+
+	sqlRaw, args, _ := query.ToSql()
+	var p models.Patient
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.DateOfBirth, &p.Gender, &p.VersionID, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
 func (r *Repository) DeletePatient(id string) error {
 	query := r.sq.Delete("patients").Where(sq.Eq{"id": id})
 	sqlRaw, args, _ := query.ToSql()
@@ -73,3 +104,30 @@ func (r *Repository) DeletePatients(ids []string) error {
 	_, err := r.db.Exec(sqlRaw, args...)
 	return err
 }
+
+func (r *Repository) GetPatientHistory(id string) ([]models.Patient, error) {
+	current, err := r.GetPatientByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.Patient](r, models.ResourceTypePatient, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.Patient{*current}, archived...), nil
+}
+
+func (r *Repository) GetPatientVersion(id string, versionID int) (*models.Patient, error) {
+	current, err := r.GetPatientByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.Patient](r, models.ResourceTypePatient, id, versionID)
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"hospital-srv/models"
+	"slices"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var pharmacyOrderColumns = []string{"id", "medication_request_id", "event_type", "message", "status", "attempts", "next_attempt_at", "last_error", "created_at", "sent_at"}
+
+func (r *Repository) EnqueuePharmacyOrder(requestID string, eventType string, message []byte) error {
+	query := r.sq.Insert("pharmacy_outbox").
+		Columns("medication_request_id", "event_type", "message").
+		Values(requestID, eventType, string(message))
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+// ClaimDuePharmacyOrders picks up to limit pending orders whose next attempt
+// is due, oldest first, and pushes their next attempt past lease, so
+// concurrent senders never send the same order twice.
+func (r *Repository) ClaimDuePharmacyOrders(limit int, lease time.Duration) ([]models.PharmacyOrder, error) {
+	// The subquery keeps the default "?" placeholders; the outer builder
+	// numbers them when the statement is rendered.
+	due := sq.Select("id").
+		From("pharmacy_outbox").
+		Where(sq.Eq{"status": models.PharmacyOrderStatusPending}).
+		Where(sq.Expr("next_attempt_at <= NOW()")).
+		OrderBy("created_at").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	query := r.sq.Update("pharmacy_outbox").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("next_attempt_at", sq.Expr("NOW() + make_interval(secs => ?)", lease.Seconds())).
+		Where(sq.Expr("id IN (?)", due)).
+		Suffix("RETURNING " + strings.Join(pharmacyOrderColumns, ", "))
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.PharmacyOrder
+	for rows.Next() {
+		var o models.PharmacyOrder
+		if err := rows.Scan(&o.ID, &o.MedicationRequestID, &o.EventType, &o.Message, &o.Status, &o.Attempts, &o.NextAttemptAt, &o.LastError, &o.CreatedAt, &o.SentAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not follow the subquery's order, and orders for the
+	// same prescription must reach the pharmacy in sequence.
+	slices.SortFunc(orders, func(a, b models.PharmacyOrder) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return orders, nil
+}
+
+func (r *Repository) MarkPharmacyOrderSent(id string) error {
+	query := r.sq.Update("pharmacy_outbox").
+		Set("status", models.PharmacyOrderStatusSent).
+		Set("last_error", nil).
+		Set("sent_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+// MarkPharmacyOrderFailed records a failed attempt. The order is retried at
+// nextAttempt, or dead-lettered when nextAttempt is nil.
+func (r *Repository) MarkPharmacyOrderFailed(id string, sendError string, nextAttempt *time.Time) error {
+	query := r.sq.Update("pharmacy_outbox").
+		Set("last_error", sendError).
+		Where(sq.Eq{"id": id})
+
+	if nextAttempt != nil {
+		query = query.Set("next_attempt_at", *nextAttempt)
+	} else {
+		query = query.Set("status", models.PharmacyOrderStatusDead)
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
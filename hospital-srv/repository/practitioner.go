@@ -1,15 +1,40 @@
 package repository
 
 import (
+	"encoding/json"
 	"hospital-srv/models"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
-func (r *Repository) GetAllPractitioners() ([]models.Practitioner, error) {
-	query := r.sq.Select("id", "first_name", "last_name", "middle_name", "specialization", "created_at").
-		From("practitioners").
-		OrderBy("last_name ASC")
+func (r *Repository) selectPractitioners() sq.SelectBuilder {
+	return r.sq.Select("id", "first_name", "last_name", "middle_name", "specialization", "active", identifiersColumn(models.ResourceTypePractitioner, "practitioners.id"), "version_id", "created_at", "updated_at").
+		From("practitioners")
+}
+
+func scanPractitioner(row rowScanner) (models.Practitioner, error) {
+	var p models.Practitioner
+	var identifiers []byte
+	if err := row.Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.Specialization, &p.Active, &identifiers, &p.VersionID, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return p, err
+	}
+
+	err := json.Unmarshal(identifiers, &p.Identifiers)
+	return p, err
+}
+
+func (r *Repository) SearchPractitioners(filter models.PractitionerFilter) ([]models.Practitioner, error) {
+	query := r.selectPractitioners().OrderBy("last_name ASC")
+
+	if filter.Active != nil {
+		query = query.Where(sq.Eq{"active": *filter.Active})
+	}
+	if filter.UpdatedSince != nil {
+		query = query.Where(sq.GtOrEq{"updated_at": *filter.UpdatedSince})
+	}
+	if filter.Identifier != nil {
+		query = query.Where(identifierMatch(models.ResourceTypePractitioner, "practitioners.id", *filter.Identifier))
+	}
 
 	sqlRaw, args, _ := query.ToSql()
 	rows, err := r.db.Query(sqlRaw, args...)
@@ -20,27 +45,21 @@ func (r *Repository) GetAllPractitioners() ([]models.Practitioner, error) {
 
 	var practitioners []models.Practitioner
 	for rows.Next() {
-		var p models.Practitioner
-		err := rows.Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.Specialization, &p.CreatedAt)
+		p, err := scanPractitioner(rows)
 		if err != nil {
 			return nil, err
 		}
 		practitioners = append(practitioners, p)
 	}
 
-	return practitioners, nil
+	return practitioners, rows.Err()
 }
 
 func (r *Repository) GetPractitionerByID(id string) (*models.Practitioner, error) {
-	query := r.sq.Select("id", "first_name", "last_name", "middle_name", "specialization", "created_at").
-		From("practitioners").
-		Where(sq.Eq{"id": id})
+	query := r.selectPractitioners().Where(sq.Eq{"id": id})
 
 	sqlRaw, args, _ := query.ToSql()
-	row := r.db.QueryRow(sqlRaw, args...)
-
-	var p models.Practitioner
-	err := row.Scan(&p.ID, &p.FirstName, &p.LastName, &p.MiddleName, &p.Specialization, &p.CreatedAt)
+	p, err := scanPractitioner(r.db.QueryRow(sqlRaw, args...))
 	if err != nil {
 		return nil, err
 	}
@@ -48,14 +67,135 @@ func (r *Repository) GetPractitionerByID(id string) (*models.Practitioner, error
 	return &p, nil
 }
 
-func (r *Repository) CreatePractitioner(p models.Practitioner) (string, error) {
-	query := r.sq.Insert("practitioners").
-		Columns("first_name", "last_name", "middle_name", "specialization").
-		Values(p.FirstName, p.LastName, p.MiddleName, p.Specialization).
-		Suffix("RETURNING id")
+// FindPractitionerByName returns the oldest practitioner with the given
+// names and specialization, ignoring case, or sql.ErrNoRows.
+func (r *Repository) FindPractitionerByName(firstName string, lastName string, specialization string) (*models.Practitioner, error) {
+	query := r.selectPractitioners().
+		Where(sq.Expr("LOWER(first_name) = LOWER(?)", firstName)).
+		Where(sq.Expr("LOWER(last_name) = LOWER(?)", lastName)).
+		Where(sq.Expr("LOWER(specialization) = LOWER(?)", specialization)).
+		OrderBy("created_at ASC").
+		Limit(1)
 
 	sqlRaw, args, _ := query.ToSql()
+	p, err := scanPractitioner(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// CreatePractitioner saves the practitioner with their identifiers,
+// returning ErrDuplicateIdentifier when one is taken.
+func (r *Repository) CreatePractitioner(p models.Practitioner) (string, error) {
 	var id string
-	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	err := r.WithTx(func(tx *Repository) error {
+		query := tx.sq.Insert("practitioners").
+			Columns("first_name", "last_name", "middle_name", "specialization", "active").
+			Values(p.FirstName, p.LastName, p.MiddleName, p.Specialization, p.Active).
+			Suffix("RETURNING id")
+
+		sqlRaw, args, _ := query.ToSql()
+		if err := tx.db.QueryRow(sqlRaw, args...).Scan(&id); err != nil {
+			return err
+		}
+
+		return tx.setIdentifiers(models.ResourceTypePractitioner, id, p.Identifiers)
+	})
 	return id, err
 }
+
+func (r *Repository) getPractitionerForUpdate(id string) (*models.Practitioner, error) {
+	query := r.selectPractitioners().
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE")
+
+	sqlRaw, args, _ := query.ToSql()
+	p, err := scanPractitioner(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// LockPractitioner locks the practitioner row until the surrounding
+// transaction ends, so that slots and bookings of one practitioner are
+// checked for overlaps one transaction at a time. The lock does not block
+// rows that merely reference the practitioner.
+func (r *Repository) LockPractitioner(id string) error {
+	query := r.sq.Select("id").
+		From("practitioners").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR NO KEY UPDATE")
+
+	sqlRaw, args, _ := query.ToSql()
+	return r.db.QueryRow(sqlRaw, args...).Scan(&id)
+}
+
+// UpdatePractitioner archives the current version and bumps version_id.
+// Identifiers are replaced unless nil.
+func (r *Repository) UpdatePractitioner(p models.Practitioner, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.getPractitionerForUpdate(p.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypePractitioner, p.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("practitioners").
+			Set("first_name", p.FirstName).
+			Set("last_name", p.LastName).
+			Set("middle_name", p.MiddleName).
+			Set("specialization", p.Specialization).
+			Set("active", p.Active).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": p.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		if _, err := tx.db.Exec(sqlRaw, args...); err != nil {
+			return err
+		}
+
+		if p.Identifiers == nil {
+			return nil
+		}
+		return tx.setIdentifiers(models.ResourceTypePractitioner, p.ID, p.Identifiers)
+	})
+}
+
+func (r *Repository) GetPractitionerHistory(id string) ([]models.Practitioner, error) {
+	current, err := r.GetPractitionerByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.Practitioner](r, models.ResourceTypePractitioner, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.Practitioner{*current}, archived...), nil
+}
+
+func (r *Repository) GetPractitionerVersion(id string, versionID int) (*models.Practitioner, error) {
+	current, err := r.GetPractitionerByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.Practitioner](r, models.ResourceTypePractitioner, id, versionID)
+}
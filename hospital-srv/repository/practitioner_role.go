@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+func (r *Repository) selectPractitionerRoles() sq.SelectBuilder {
+	return r.sq.Select(
+		"id", "practitioner_id", "active", "role", "organization_id", "specialties", "location_ids", "version_id", "created_at", "updated_at",
+	).From("practitioner_roles")
+}
+
+func scanPractitionerRole(row rowScanner) (models.PractitionerRole, error) {
+	var pr models.PractitionerRole
+	err := row.Scan(
+		&pr.ID, &pr.PractitionerID, &pr.Active, &pr.Role, &pr.OrganizationID, pq.Array(&pr.Specialties), pq.Array(&pr.LocationIDs),
+		&pr.VersionID, &pr.CreatedAt, &pr.UpdatedAt,
+	)
+	return pr, err
+}
+
+func (r *Repository) CreatePractitionerRole(pr models.PractitionerRole) (string, error) {
+	query := r.sq.Insert("practitioner_roles").
+		Columns("practitioner_id", "active", "role", "organization_id", "specialties", "location_ids").
+		Values(pr.PractitionerID, pr.Active, pr.Role, pr.OrganizationID, pq.Array(pr.Specialties), pq.Array(pr.LocationIDs)).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetPractitionerRoleByID(id string) (*models.PractitionerRole, error) {
+	sqlRaw, args, _ := r.selectPractitionerRoles().Where(sq.Eq{"id": id}).ToSql()
+
+	pr, err := scanPractitionerRole(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (r *Repository) getPractitionerRoleForUpdate(id string) (*models.PractitionerRole, error) {
+	sqlRaw, args, _ := r.selectPractitionerRoles().Where(sq.Eq{"id": id}).Suffix("FOR UPDATE").ToSql()
+
+	pr, err := scanPractitionerRole(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+// SearchPractitionerRoles returns the roles matching filter. Specialty
+// matches any of a role's specialties, ignoring case.
+func (r *Repository) SearchPractitionerRoles(filter models.PractitionerRoleFilter) ([]models.PractitionerRole, error) {
+	query := r.selectPractitionerRoles().OrderBy("created_at ASC")
+
+	if filter.PractitionerID != "" {
+		query = query.Where(sq.Eq{"practitioner_id": filter.PractitionerID})
+	}
+	if filter.OrganizationID != "" {
+		query = query.Where(sq.Eq{"organization_id": filter.OrganizationID})
+	}
+	if filter.LocationID != "" {
+		query = query.Where("? = ANY(location_ids)", filter.LocationID)
+	}
+	if filter.Active != nil {
+		query = query.Where(sq.Eq{"active": *filter.Active})
+	}
+	if filter.Role != "" {
+		query = query.Where(sq.Eq{"role": filter.Role})
+	}
+	if filter.Specialty != "" {
+		query = query.Where("EXISTS (SELECT 1 FROM unnest(specialties) s WHERE lower(s) = lower(?))", filter.Specialty)
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.PractitionerRole
+	for rows.Next() {
+		pr, err := scanPractitionerRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, pr)
+	}
+
+	return roles, rows.Err()
+}
+
+// UpdatePractitionerRole archives the current version and saves pr. If
+// expectedVersion is non-zero and does not match the stored version,
+// ErrVersionConflict is returned.
+func (r *Repository) UpdatePractitionerRole(pr models.PractitionerRole, expectedVersion int) error {
+	return r.WithTx(func(tx *Repository) error {
+		current, err := tx.getPractitionerRoleForUpdate(pr.ID)
+		if err != nil {
+			return err
+		}
+
+		if expectedVersion != 0 && current.VersionID != expectedVersion {
+			return ErrVersionConflict
+		}
+
+		if err := tx.archiveVersion(models.ResourceTypePractitionerRole, pr.ID, current.VersionID, current.UpdatedAt, current); err != nil {
+			return err
+		}
+
+		query := tx.sq.Update("practitioner_roles").
+			Set("active", pr.Active).
+			Set("role", pr.Role).
+			Set("organization_id", pr.OrganizationID).
+			Set("specialties", pq.Array(pr.Specialties)).
+			Set("location_ids", pq.Array(pr.LocationIDs)).
+			Set("version_id", sq.Expr("version_id + 1")).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": pr.ID})
+
+		sqlRaw, args, _ := query.ToSql()
+		_, err = tx.db.Exec(sqlRaw, args...)
+		return err
+	})
+}
+
+func (r *Repository) GetPractitionerRoleHistory(id string) ([]models.PractitionerRole, error) {
+	current, err := r.GetPractitionerRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := loadHistory[models.PractitionerRole](r, models.ResourceTypePractitionerRole, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]models.PractitionerRole{*current}, archived...), nil
+}
+
+func (r *Repository) GetPractitionerRoleVersion(id string, versionID int) (*models.PractitionerRole, error) {
+	current, err := r.GetPractitionerRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.VersionID == versionID {
+		return current, nil
+	}
+
+	return loadVersion[models.PractitionerRole](r, models.ResourceTypePractitionerRole, id, versionID)
+}
@@ -2,18 +2,143 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"hospital-srv/models"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
+var ErrVersionConflict = errors.New("resource version conflict")
+
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type Repository struct {
-	db *sql.DB
-	sq sq.StatementBuilderType
+	conn *sql.DB
+	db   querier
+	sq   sq.StatementBuilderType
 }
 
 func New(db *sql.DB) *Repository {
 	return &Repository{
-		db: db,
-		sq: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+		conn: db,
+		db:   db,
+		sq:   sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// WithTx runs fn against a repository bound to a single database transaction.
+// Calls made on a repository that is already inside a transaction join it.
+func (r *Repository) WithTx(fn func(tx *Repository) error) error {
+	if r.conn == nil {
+		return fn(r)
 	}
+
+	tx, err := r.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&Repository{db: tx, sq: r.sq}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) archiveVersion(resourceType string, id string, versionID int, updatedAt time.Time, snapshot interface{}) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	query := r.sq.Insert("resource_history").
+		Columns("resource_type", "resource_id", "version_id", "updated_at", "snapshot").
+		Values(resourceType, id, versionID, updatedAt, data).
+		Suffix("ON CONFLICT DO NOTHING")
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err = r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+func (r *Repository) getArchivedVersions(resourceType string, id string) ([]models.ResourceVersion, error) {
+	query := r.sq.Select("resource_type", "resource_id", "version_id", "updated_at", "snapshot").
+		From("resource_history").
+		Where(sq.Eq{"resource_type": resourceType, "resource_id": id}).
+		OrderBy("version_id DESC")
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.ResourceVersion
+	for rows.Next() {
+		var v models.ResourceVersion
+		if err := rows.Scan(&v.ResourceType, &v.ResourceID, &v.VersionID, &v.UpdatedAt, &v.Snapshot); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (r *Repository) getArchivedVersion(resourceType string, id string, versionID int) (*models.ResourceVersion, error) {
+	query := r.sq.Select("resource_type", "resource_id", "version_id", "updated_at", "snapshot").
+		From("resource_history").
+		Where(sq.Eq{"resource_type": resourceType, "resource_id": id, "version_id": versionID})
+
+	sqlRaw, args, _ := query.ToSql()
+	row := r.db.QueryRow(sqlRaw, args...)
+
+	var v models.ResourceVersion
+	if err := row.Scan(&v.ResourceType, &v.ResourceID, &v.VersionID, &v.UpdatedAt, &v.Snapshot); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// loadHistory returns the archived snapshots of a resource decoded into T,
+// newest first. The live row is not included.
+func loadHistory[T any](r *Repository, resourceType string, id string) ([]T, error) {
+	archived, err := r.getArchivedVersions(resourceType, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]T, 0, len(archived))
+	for _, v := range archived {
+		var item T
+		if err := json.Unmarshal(v.Snapshot, &item); err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+func loadVersion[T any](r *Repository, resourceType string, id string, versionID int) (*T, error) {
+	v, err := r.getArchivedVersion(resourceType, id, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var item T
+	if err := json.Unmarshal(v.Snapshot, &item); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
 }
@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"errors"
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// ErrSlotOverlap is returned when a new slot overlaps an existing slot of
+// the same practitioner, in any of their schedules.
+var ErrSlotOverlap = errors.New("slot overlaps an existing slot")
+
+func (r *Repository) selectSchedules() sq.SelectBuilder {
+	return r.sq.Select("id", "practitioner_id", "active", "planning_start", "planning_end", "comment", "created_at", "updated_at").
+		From("schedules")
+}
+
+func scanSchedule(row rowScanner) (models.Schedule, error) {
+	var s models.Schedule
+	err := row.Scan(&s.ID, &s.PractitionerID, &s.Active, &s.PlanningStart, &s.PlanningEnd, &s.Comment, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+func (r *Repository) CreateSchedule(s models.Schedule) (string, error) {
+	query := r.sq.Insert("schedules").
+		Columns("practitioner_id", "active", "planning_start", "planning_end", "comment").
+		Values(s.PractitionerID, s.Active, s.PlanningStart, s.PlanningEnd, s.Comment).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetScheduleByID(id string) (*models.Schedule, error) {
+	query := r.selectSchedules().Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	s, err := scanSchedule(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// getScheduleForUpdate locks the schedule row so that slots are added to it
+// one transaction at a time.
+func (r *Repository) getScheduleForUpdate(id string) (*models.Schedule, error) {
+	query := r.selectSchedules().Where(sq.Eq{"id": id}).Suffix("FOR UPDATE")
+
+	sqlRaw, args, _ := query.ToSql()
+	s, err := scanSchedule(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *Repository) SearchSchedules(filter models.ScheduleFilter) ([]models.Schedule, error) {
+	query := r.selectSchedules().OrderBy("created_at")
+
+	if filter.PractitionerID != "" {
+		query = query.Where(sq.Eq{"practitioner_id": filter.PractitionerID})
+	}
+	if filter.Active != nil {
+		query = query.Where(sq.Eq{"active": *filter.Active})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []models.Schedule
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, rows.Err()
+}
+
+func (r *Repository) selectSlots() sq.SelectBuilder {
+	return r.sq.Select("id", "schedule_id", "status", "start_time", "end_time", "comment", "created_at", "updated_at").
+		From("slots")
+}
+
+func scanSlot(row rowScanner) (models.Slot, error) {
+	var s models.Slot
+	err := row.Scan(&s.ID, &s.ScheduleID, &s.Status, &s.StartTime, &s.EndTime, &s.Comment, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+// CreateSlot adds a slot to its schedule, or returns ErrSlotOverlap when one
+// of the practitioner's schedules already has a slot covering part of the
+// same time.
+func (r *Repository) CreateSlot(s models.Slot) (string, error) {
+	var id string
+	err := r.WithTx(func(tx *Repository) error {
+		schedule, err := tx.getScheduleForUpdate(s.ScheduleID)
+		if err != nil {
+			return err
+		}
+		if err := tx.LockPractitioner(schedule.PractitionerID); err != nil {
+			return err
+		}
+
+		schedules := sq.Select("id").From("schedules").Where(sq.Eq{"practitioner_id": schedule.PractitionerID})
+		overlap := tx.sq.Select("1").
+			From("slots").
+			Where(sq.Expr("schedule_id IN (?)", schedules)).
+			Where(sq.Lt{"start_time": s.EndTime}).
+			Where(sq.Gt{"end_time": s.StartTime}).
+			Prefix("SELECT EXISTS (").
+			Suffix(")")
+
+		sqlRaw, args, _ := overlap.ToSql()
+		var exists bool
+		if err := tx.db.QueryRow(sqlRaw, args...).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrSlotOverlap
+		}
+
+		query := tx.sq.Insert("slots").
+			Columns("schedule_id", "status", "start_time", "end_time", "comment").
+			Values(s.ScheduleID, s.Status, s.StartTime, s.EndTime, s.Comment).
+			Suffix("RETURNING id")
+
+		sqlRaw, args, _ = query.ToSql()
+		return tx.db.QueryRow(sqlRaw, args...).Scan(&id)
+	})
+	return id, err
+}
+
+func (r *Repository) GetSlotByID(id string) (*models.Slot, error) {
+	query := r.selectSlots().Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	s, err := scanSlot(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// GetSlotForUpdate locks the slot until the surrounding transaction ends,
+// so concurrent bookings of the same slot are serialised.
+func (r *Repository) GetSlotForUpdate(id string) (*models.Slot, error) {
+	query := r.selectSlots().Where(sq.Eq{"id": id}).Suffix("FOR UPDATE")
+
+	sqlRaw, args, _ := query.ToSql()
+	s, err := scanSlot(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *Repository) SearchSlots(filter models.SlotFilter) ([]models.Slot, error) {
+	query := r.selectSlots().OrderBy("start_time")
+
+	if len(filter.ScheduleIDs) > 0 {
+		query = query.Where(sq.Eq{"schedule_id": filter.ScheduleIDs})
+	}
+	if filter.PractitionerID != "" {
+		schedules := sq.Select("id").From("schedules").Where(sq.Eq{"practitioner_id": filter.PractitionerID})
+		query = query.Where(sq.Expr("schedule_id IN (?)", schedules))
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"status": filter.Status})
+	}
+	if filter.StartFrom != nil {
+		query = query.Where(sq.GtOrEq{"start_time": *filter.StartFrom})
+	}
+	if filter.StartBefore != nil {
+		query = query.Where(sq.Lt{"start_time": *filter.StartBefore})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var slots []models.Slot
+	for rows.Next() {
+		s, err := scanSlot(rows)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, s)
+	}
+
+	return slots, rows.Err()
+}
+
+func (r *Repository) SetSlotStatus(id string, status string) error {
+	query := r.sq.Update("slots").
+		Set("status", status).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
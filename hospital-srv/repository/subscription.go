@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"hospital-srv/models"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+)
+
+func (r *Repository) selectSubscriptions() sq.SelectBuilder {
+	return r.sq.Select("id", "status", "reason", "criteria", "channel_type", "endpoint", "payload", "headers", "error", "end_time", "created_at", "updated_at").
+		From("subscriptions")
+}
+
+func scanSubscription(row rowScanner) (models.Subscription, error) {
+	var s models.Subscription
+	err := row.Scan(&s.ID, &s.Status, &s.Reason, &s.Criteria, &s.ChannelType, &s.Endpoint, &s.Payload, pq.Array(&s.Headers), &s.Error, &s.End, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+func (r *Repository) CreateSubscription(s models.Subscription) (string, error) {
+	query := r.sq.Insert("subscriptions").
+		Columns("status", "reason", "criteria", "channel_type", "endpoint", "payload", "headers", "end_time").
+		Values(s.Status, s.Reason, s.Criteria, s.ChannelType, s.Endpoint, s.Payload, pq.Array(s.Headers), s.End).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetSubscriptionByID(id string) (*models.Subscription, error) {
+	query := r.selectSubscriptions().Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	s, err := scanSubscription(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *Repository) SearchSubscriptions(filter models.SubscriptionFilter) ([]models.Subscription, error) {
+	query := r.selectSubscriptions().OrderBy("created_at")
+
+	if filter.Endpoint != "" {
+		query = query.Where(sq.Eq{"endpoint": filter.Endpoint})
+	}
+	if filter.Criteria != "" {
+		query = query.Where(sq.Eq{"criteria": filter.Criteria})
+	}
+	if filter.Status != "" {
+		query = query.Where(sq.Eq{"status": filter.Status})
+	}
+
+	return r.querySubscriptions(query)
+}
+
+// GetActiveSubscriptions returns subscriptions that should currently
+// receive notifications for the given resource type.
+func (r *Repository) GetActiveSubscriptions(resourceType string) ([]models.Subscription, error) {
+	query := r.selectSubscriptions().
+		Where(sq.Eq{"status": []string{models.SubscriptionStatusActive, models.SubscriptionStatusError}}).
+		Where(sq.Or{sq.Eq{"criteria": resourceType}, sq.Like{"criteria": resourceType + "?%"}}).
+		Where(sq.Or{sq.Eq{"end_time": nil}, sq.Expr("end_time > NOW()")})
+
+	return r.querySubscriptions(query)
+}
+
+func (r *Repository) querySubscriptions(query sq.SelectBuilder) ([]models.Subscription, error) {
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []models.Subscription
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+
+	return subscriptions, nil
+}
+
+// SetSubscriptionError records the outcome of the last delivery attempt.
+// A nil deliveryError marks the subscription healthy again.
+func (r *Repository) SetSubscriptionError(id string, deliveryError *string) error {
+	status := models.SubscriptionStatusActive
+	if deliveryError != nil {
+		status = models.SubscriptionStatusError
+	}
+
+	query := r.sq.Update("subscriptions").
+		Set("status", status).
+		Set("error", deliveryError).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id}).
+		Where(sq.NotEq{"status": models.SubscriptionStatusOff})
+
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+func (r *Repository) DeleteSubscription(id string) error {
+	query := r.sq.Delete("subscriptions").Where(sq.Eq{"id": id})
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
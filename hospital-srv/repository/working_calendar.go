@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"hospital-srv/models"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Weekly working hours and breaks share a layout and live in these tables.
+const (
+	workingHoursTable  = "working_hours"
+	workingBreaksTable = "working_breaks"
+)
+
+func (r *Repository) getWeeklyIntervals(table string, practitionerID string) ([]models.WeeklyInterval, error) {
+	query := r.sq.Select("id", "practitioner_id", "weekday", "to_char(start_time, 'HH24:MI')", "to_char(end_time, 'HH24:MI')").
+		From(table).
+		Where(sq.Eq{"practitioner_id": practitionerID}).
+		OrderBy("weekday", "start_time")
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var intervals []models.WeeklyInterval
+	for rows.Next() {
+		var i models.WeeklyInterval
+		if err := rows.Scan(&i.ID, &i.PractitionerID, &i.Weekday, &i.StartTime, &i.EndTime); err != nil {
+			return nil, err
+		}
+		intervals = append(intervals, i)
+	}
+
+	return intervals, rows.Err()
+}
+
+func (r *Repository) replaceWeeklyIntervals(table string, practitionerID string, intervals []models.WeeklyInterval) error {
+	sqlRaw, args, _ := r.sq.Delete(table).Where(sq.Eq{"practitioner_id": practitionerID}).ToSql()
+	if _, err := r.db.Exec(sqlRaw, args...); err != nil {
+		return err
+	}
+
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	query := r.sq.Insert(table).Columns("practitioner_id", "weekday", "start_time", "end_time")
+	for _, i := range intervals {
+		query = query.Values(practitionerID, i.Weekday, i.StartTime, i.EndTime)
+	}
+
+	sqlRaw, args, _ = query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
+
+func (r *Repository) GetWorkingHours(practitionerID string) ([]models.WeeklyInterval, error) {
+	return r.getWeeklyIntervals(workingHoursTable, practitionerID)
+}
+
+func (r *Repository) GetWorkingBreaks(practitionerID string) ([]models.WeeklyInterval, error) {
+	return r.getWeeklyIntervals(workingBreaksTable, practitionerID)
+}
+
+// ReplaceWeeklyPattern replaces the practitioner's weekly working hours and
+// breaks as a whole.
+func (r *Repository) ReplaceWeeklyPattern(practitionerID string, hours []models.WeeklyInterval, breaks []models.WeeklyInterval) error {
+	return r.WithTx(func(tx *Repository) error {
+		if err := tx.replaceWeeklyIntervals(workingHoursTable, practitionerID, hours); err != nil {
+			return err
+		}
+		return tx.replaceWeeklyIntervals(workingBreaksTable, practitionerID, breaks)
+	})
+}
+
+func (r *Repository) selectWorkingExceptions() sq.SelectBuilder {
+	return r.sq.Select("id", "practitioner_id", "kind", "start_time", "end_time", "reason", "created_at").
+		From("working_exceptions")
+}
+
+func scanWorkingException(row rowScanner) (models.WorkingException, error) {
+	var e models.WorkingException
+	err := row.Scan(&e.ID, &e.PractitionerID, &e.Kind, &e.StartTime, &e.EndTime, &e.Reason, &e.CreatedAt)
+	return e, err
+}
+
+func (r *Repository) CreateWorkingException(e models.WorkingException) (string, error) {
+	query := r.sq.Insert("working_exceptions").
+		Columns("practitioner_id", "kind", "start_time", "end_time", "reason").
+		Values(e.PractitionerID, e.Kind, e.StartTime, e.EndTime, e.Reason).
+		Suffix("RETURNING id")
+
+	sqlRaw, args, _ := query.ToSql()
+	var id string
+	err := r.db.QueryRow(sqlRaw, args...).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetWorkingExceptionByID(id string) (*models.WorkingException, error) {
+	query := r.selectWorkingExceptions().Where(sq.Eq{"id": id})
+
+	sqlRaw, args, _ := query.ToSql()
+	e, err := scanWorkingException(r.db.QueryRow(sqlRaw, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// GetWorkingExceptions returns the practitioner's exceptions overlapping
+// [from, to). A nil bound leaves that side open.
+func (r *Repository) GetWorkingExceptions(practitionerID string, from *time.Time, to *time.Time) ([]models.WorkingException, error) {
+	query := r.selectWorkingExceptions().
+		Where(sq.Eq{"practitioner_id": practitionerID}).
+		OrderBy("start_time")
+
+	if from != nil {
+		query = query.Where(sq.Gt{"end_time": *from})
+	}
+	if to != nil {
+		query = query.Where(sq.Lt{"start_time": *to})
+	}
+
+	sqlRaw, args, _ := query.ToSql()
+	rows, err := r.db.Query(sqlRaw, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exceptions []models.WorkingException
+	for rows.Next() {
+		e, err := scanWorkingException(rows)
+		if err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, e)
+	}
+
+	return exceptions, rows.Err()
+}
+
+func (r *Repository) DeleteWorkingException(id string) error {
+	query := r.sq.Delete("working_exceptions").Where(sq.Eq{"id": id})
+	sqlRaw, args, _ := query.ToSql()
+	_, err := r.db.Exec(sqlRaw, args...)
+	return err
+}
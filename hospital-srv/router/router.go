@@ -8,14 +8,15 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func Setup(patientHandler *handlers.PatientHandler, hub *websocket.Hub, fhirServer *fhir.FHIRServer) *gin.Engine {
+func Setup(patientHandler *handlers.PatientHandler, notificationHandler *handlers.NotificationHandler, calendarHandler *handlers.CalendarHandler, departmentHandler *handlers.DepartmentHandler, bedHandler *handlers.BedHandler, hub *websocket.Hub, fhirServer *fhir.FHIRServer) *gin.Engine {
 	router := gin.Default()
 
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, X-HIS-Actor")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -39,18 +40,120 @@ func Setup(patientHandler *handlers.PatientHandler, hub *websocket.Hub, fhirServ
 			patients.POST("/batch-delete", patientHandler.BatchDeletePatients)
 			patients.DELETE("/:id", patientHandler.DeletePatient)
 		}
+
+		calendars := api.Group("/practitioners/:id/calendar")
+		{
+			calendars.GET("", calendarHandler.GetCalendar)
+			calendars.PUT("/weekly", calendarHandler.SetWeeklyPattern)
+			calendars.POST("/exceptions", calendarHandler.AddException)
+			calendars.DELETE("/exceptions/:exceptionId", calendarHandler.DeleteException)
+		}
+
+		api.GET("/departments/occupancy", departmentHandler.GetOccupancy)
+
+		beds := api.Group("/beds")
+		{
+			beds.GET("", bedHandler.GetBeds)
+			beds.GET("/occupancy", bedHandler.GetOccupancy)
+			beds.GET("/:id", bedHandler.GetBed)
+			beds.PUT("/:id/status", bedHandler.SetStatus)
+			beds.POST("/:id/assign", bedHandler.Assign)
+		}
+
+		notifications := api.Group("/admin/notifications")
+		{
+			notifications.GET("/failed", notificationHandler.GetFailedNotifications)
+			notifications.POST("/resend", notificationHandler.ResendFailedNotifications)
+			notifications.POST("/:id/resend", notificationHandler.ResendNotification)
+		}
 	}
 
-	fhirRoutes := router.Group("/fhir")
+	fhirRoutes := router.Group("/fhir", fhir.NegotiateFormat)
 	{
+		fhirRoutes.GET("/metadata", fhirServer.Metadata)
+		fhirRoutes.POST("", fhirServer.ProcessBundle)
+		fhirRoutes.GET("/$export", fhirServer.Export)
+		fhirRoutes.POST("/$import", fhirServer.Import)
+		fhirRoutes.GET("/bulkstatus/:id", fhirServer.ExportStatus)
+		fhirRoutes.DELETE("/bulkstatus/:id", fhirServer.DeleteExport)
+		fhirRoutes.GET("/bulkfiles/:id/:file", fhirServer.ExportFile)
+		fhirRoutes.GET("/Patient", fhirServer.GetPatients)
+		fhirRoutes.GET("/Patient/:id", fhirServer.GetPatient)
+		fhirRoutes.GET("/Patient/:id/_history", fhirServer.GetPatientHistory)
+		fhirRoutes.GET("/Patient/:id/_history/:vid", fhirServer.GetPatientVersion)
+		fhirRoutes.GET("/Patient/:id/$everything", fhirServer.PatientEverything)
+		fhirRoutes.POST("/Patient/$validate", fhirServer.Validate)
 		fhirRoutes.GET("/Practitioner", fhirServer.GetPractitioners)
 		fhirRoutes.GET("/Practitioner/:id", fhirServer.GetPractitioner)
+		fhirRoutes.GET("/Practitioner/:id/_history", fhirServer.GetPractitionerHistory)
+		fhirRoutes.GET("/Practitioner/:id/_history/:vid", fhirServer.GetPractitionerVersion)
+		fhirRoutes.GET("/Practitioner/:id/$availability", fhirServer.PractitionerAvailability)
 		fhirRoutes.POST("/Practitioner", fhirServer.CreatePractitioner)
+		fhirRoutes.PUT("/Practitioner/:id", fhirServer.UpdatePractitioner)
+		fhirRoutes.POST("/Practitioner/$validate", fhirServer.Validate)
+		fhirRoutes.POST("/PractitionerRole", fhirServer.CreatePractitionerRole)
+		fhirRoutes.GET("/PractitionerRole", fhirServer.GetPractitionerRoles)
+		fhirRoutes.GET("/PractitionerRole/:id", fhirServer.GetPractitionerRole)
+		fhirRoutes.GET("/PractitionerRole/:id/_history", fhirServer.GetPractitionerRoleHistory)
+		fhirRoutes.GET("/PractitionerRole/:id/_history/:vid", fhirServer.GetPractitionerRoleVersion)
+		fhirRoutes.PUT("/PractitionerRole/:id", fhirServer.UpdatePractitionerRole)
+		fhirRoutes.POST("/Organization", fhirServer.CreateOrganization)
+		fhirRoutes.GET("/Organization", fhirServer.GetOrganizations)
+		fhirRoutes.GET("/Organization/:id", fhirServer.GetOrganization)
+		fhirRoutes.GET("/Organization/:id/_history", fhirServer.GetOrganizationHistory)
+		fhirRoutes.GET("/Organization/:id/_history/:vid", fhirServer.GetOrganizationVersion)
+		fhirRoutes.PUT("/Organization/:id", fhirServer.UpdateOrganization)
+		fhirRoutes.POST("/Location", fhirServer.CreateLocation)
+		fhirRoutes.GET("/Location", fhirServer.GetLocations)
+		fhirRoutes.GET("/Location/:id", fhirServer.GetLocation)
+		fhirRoutes.GET("/Location/:id/_history", fhirServer.GetLocationHistory)
+		fhirRoutes.GET("/Location/:id/_history/:vid", fhirServer.GetLocationVersion)
+		fhirRoutes.PUT("/Location/:id", fhirServer.UpdateLocation)
 		fhirRoutes.POST("/Encounter", fhirServer.CreateEncounter)
 		fhirRoutes.GET("/Encounter", fhirServer.GetEncounters)
 		fhirRoutes.GET("/Encounter/:id", fhirServer.GetEncounter)
-		fhirRoutes.PATCH("/Encounter/:id", fhirServer.UpdateEncounterStatus)
+		fhirRoutes.GET("/Encounter/:id/_history", fhirServer.GetEncounterHistory)
+		fhirRoutes.GET("/Encounter/:id/_history/:vid", fhirServer.GetEncounterVersion)
+		fhirRoutes.PUT("/Encounter", fhirServer.ConditionalUpdateEncounter)
+		fhirRoutes.PUT("/Encounter/:id", fhirServer.UpdateEncounter)
+		fhirRoutes.PATCH("/Encounter/:id", fhirServer.PatchEncounter)
+		fhirRoutes.POST("/Encounter/$validate", fhirServer.Validate)
+		fhirRoutes.POST("/Condition", fhirServer.CreateCondition)
+		fhirRoutes.GET("/Condition", fhirServer.GetConditions)
+		fhirRoutes.GET("/Condition/:id", fhirServer.GetCondition)
+		fhirRoutes.GET("/Condition/:id/_history", fhirServer.GetConditionHistory)
+		fhirRoutes.GET("/Condition/:id/_history/:vid", fhirServer.GetConditionVersion)
+		fhirRoutes.PUT("/Condition/:id", fhirServer.UpdateCondition)
+		fhirRoutes.POST("/Composition", fhirServer.CreateComposition)
+		fhirRoutes.GET("/Composition", fhirServer.GetCompositions)
+		fhirRoutes.GET("/Composition/:id", fhirServer.GetComposition)
+		fhirRoutes.GET("/Composition/:id/_history", fhirServer.GetCompositionHistory)
+		fhirRoutes.GET("/Composition/:id/_history/:vid", fhirServer.GetCompositionVersion)
+		fhirRoutes.PUT("/Composition/:id", fhirServer.UpdateComposition)
+		fhirRoutes.POST("/MedicationRequest", fhirServer.CreateMedicationRequest)
+		fhirRoutes.GET("/MedicationRequest", fhirServer.GetMedicationRequests)
+		fhirRoutes.GET("/MedicationRequest/:id", fhirServer.GetMedicationRequest)
+		fhirRoutes.GET("/MedicationRequest/:id/_history", fhirServer.GetMedicationRequestHistory)
+		fhirRoutes.GET("/MedicationRequest/:id/_history/:vid", fhirServer.GetMedicationRequestVersion)
+		fhirRoutes.PUT("/MedicationRequest/:id", fhirServer.UpdateMedicationRequest)
+		fhirRoutes.GET("/ValueSet/$expand", fhirServer.ExpandValueSet)
+		fhirRoutes.POST("/Schedule", fhirServer.CreateSchedule)
+		fhirRoutes.GET("/Schedule", fhirServer.GetSchedules)
+		fhirRoutes.GET("/Schedule/:id", fhirServer.GetSchedule)
+		fhirRoutes.POST("/Slot", fhirServer.CreateSlot)
+		fhirRoutes.GET("/Slot", fhirServer.GetSlots)
+		fhirRoutes.GET("/Slot/:id", fhirServer.GetSlot)
+		fhirRoutes.POST("/Appointment", fhirServer.CreateAppointment)
+		fhirRoutes.GET("/Appointment", fhirServer.GetAppointments)
+		fhirRoutes.GET("/Appointment/:id", fhirServer.GetAppointment)
+		fhirRoutes.PATCH("/Appointment/:id", fhirServer.PatchAppointment)
+		fhirRoutes.POST("/Subscription", fhirServer.CreateSubscription)
+		fhirRoutes.GET("/Subscription", fhirServer.GetSubscriptions)
+		fhirRoutes.GET("/Subscription/:id", fhirServer.GetSubscription)
+		fhirRoutes.DELETE("/Subscription/:id", fhirServer.DeleteSubscription)
 	}
 
+	fhirServer.SetRoutes(router.Routes())
+
 	return router
 }
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"hospital-srv/websocket"
+	"log"
+	"slices"
+)
+
+var (
+	// ErrInvalidBedAssignment is returned when a patient is put in a bed
+	// that is not free, or in a location that is not a bed.
+	ErrInvalidBedAssignment = errors.New("bed assignment not allowed")
+
+	// ErrInvalidBedTransition is returned for a bed status change that
+	// cannot be made by hand, e.g. freeing an occupied bed.
+	ErrInvalidBedTransition = errors.New("bed status change not allowed")
+)
+
+// bedTransitions lists, per status, the statuses staff may move a bed to.
+// Beds only become occupied, and stop being so, as encounters move in and
+// out of them.
+var bedTransitions = map[string][]string{
+	models.BedStatusFree:     {models.BedStatusCleaning, models.BedStatusBlocked},
+	models.BedStatusCleaning: {models.BedStatusFree, models.BedStatusBlocked},
+	models.BedStatusBlocked:  {models.BedStatusFree, models.BedStatusCleaning},
+}
+
+func checkBedTransition(from string, to string) error {
+	if !slices.Contains(bedTransitions[from], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidBedTransition, from, to)
+	}
+	return nil
+}
+
+type BedService struct {
+	repo     *repository.Repository
+	hub      *websocket.Hub
+	notifier EncounterNotifier
+	calendar *CalendarService
+}
+
+func NewBedService(repo *repository.Repository, hub *websocket.Hub, notifier EncounterNotifier, calendar *CalendarService) *BedService {
+	return &BedService{
+		repo:     repo,
+		hub:      hub,
+		notifier: notifier,
+		calendar: calendar,
+	}
+}
+
+func (s *BedService) GetBed(id string) (*models.Bed, error) {
+	return s.repo.GetBed(id)
+}
+
+func (s *BedService) SearchBeds(filter models.BedFilter) ([]models.Bed, error) {
+	return s.repo.SearchBeds(filter)
+}
+
+// GetWardOccupancy counts the active beds of each ward by status, in the
+// order of the ward board.
+func (s *BedService) GetWardOccupancy() ([]models.WardOccupancy, error) {
+	beds, err := s.repo.SearchBeds(models.BedFilter{})
+	if err != nil {
+		return nil, err
+	}
+	return wardOccupancy(beds), nil
+}
+
+func wardOccupancy(beds []models.Bed) []models.WardOccupancy {
+	occupancy := []models.WardOccupancy{}
+	wards := map[string]int{}
+	for _, bed := range beds {
+		if bed.LocationStatus != models.LocationStatusActive {
+			continue
+		}
+
+		var key string
+		if bed.WardID != nil {
+			key = *bed.WardID
+		}
+		i, ok := wards[key]
+		if !ok {
+			i = len(occupancy)
+			wards[key] = i
+			occupancy = append(occupancy, models.WardOccupancy{
+				WardID:         bed.WardID,
+				Name:           bed.WardName,
+				DepartmentID:   bed.DepartmentID,
+				DepartmentName: bed.DepartmentName,
+			})
+		}
+
+		ward := &occupancy[i]
+		ward.Beds++
+		switch bed.Status {
+		case models.BedStatusFree:
+			ward.Free++
+		case models.BedStatusOccupied:
+			ward.Occupied++
+		case models.BedStatusCleaning:
+			ward.Cleaning++
+		case models.BedStatusBlocked:
+			ward.Blocked++
+		}
+	}
+
+	return occupancy
+}
+
+// SetBedStatus moves a bed to status by hand, following bedTransitions.
+func (s *BedService) SetBedStatus(id string, status string) error {
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		bed, err := tx.GetLocationForUpdate(id)
+		if err != nil {
+			return err
+		}
+		if bed.PhysicalType != models.LocationTypeBed || bed.BedStatus == nil {
+			return fmt.Errorf("%w: Location/%s is not a bed", ErrInvalidBedTransition, id)
+		}
+		if err := checkBedTransition(*bed.BedStatus, status); err != nil {
+			return err
+		}
+
+		return setBedStatus(tx, bed, status)
+	})
+	if err != nil {
+		return err
+	}
+
+	broadcastBeds(s.repo, s.hub, []string{id})
+	return nil
+}
+
+// AssignBed admits the patient of an arrived or in-progress encounter to
+// a free bed, moving them out of the bed they were in, if any. actor is
+// recorded as the author of the encounter update.
+func (s *BedService) AssignBed(bedID string, encounterID string, actor string) error {
+	var changed []string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		bed, err := tx.GetLocationByID(bedID)
+		if err != nil {
+			return referenceError("Location", bedID, err)
+		}
+		if bed.PhysicalType != models.LocationTypeBed {
+			return fmt.Errorf("%w: Location/%s is not a bed", ErrInvalidBedAssignment, bedID)
+		}
+
+		encounter, err := tx.GetEncounterByID(encounterID)
+		if err != nil {
+			return referenceError("Encounter", encounterID, err)
+		}
+		if !occupiesLocation(encounter.Encounter) {
+			return fmt.Errorf("%w: Encounter/%s is %s", ErrInvalidBedAssignment, encounterID, encounter.Status)
+		}
+
+		update := encounter.Encounter
+		update.LocationID = &bedID
+		changed, err = updateEncounter(tx, s.notifier, s.calendar, update, 0, actor)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	broadcastBeds(s.repo, s.hub, changed)
+	return nil
+}
+
+// occupiesLocation reports whether the patient of encounter is currently
+// in its location.
+func occupiesLocation(encounter models.Encounter) bool {
+	return encounter.Status == models.EncounterStatusArrived || encounter.Status == models.EncounterStatusInProgress
+}
+
+// moveBeds keeps bed statuses in step with an encounter changing from
+// previous, nil for a new encounter, to current. The bed the patient takes
+// must be free and active and becomes occupied; the bed they leave needs
+// cleaning. The IDs of the beds changed are returned.
+func moveBeds(tx *repository.Repository, previous *models.Encounter, current models.Encounter) ([]string, error) {
+	left, err := occupiedBed(tx, previous)
+	if err != nil {
+		return nil, err
+	}
+	taken, err := occupiedBed(tx, &current)
+	if err != nil {
+		return nil, err
+	}
+	if left != nil && taken != nil && left.ID == taken.ID {
+		return nil, nil
+	}
+
+	var changed []string
+	if left != nil {
+		if err := setBedStatus(tx, left, models.BedStatusCleaning); err != nil {
+			return nil, err
+		}
+		changed = append(changed, left.ID)
+	}
+
+	if taken != nil {
+		if taken.Status != models.LocationStatusActive {
+			return nil, fmt.Errorf("%w: Location/%s is %s", ErrInactiveLocation, taken.ID, taken.Status)
+		}
+		if *taken.BedStatus != models.BedStatusFree {
+			return nil, fmt.Errorf("%w: Location/%s is %s", ErrInvalidBedAssignment, taken.ID, *taken.BedStatus)
+		}
+		if err := setBedStatus(tx, taken, models.BedStatusOccupied); err != nil {
+			return nil, err
+		}
+		changed = append(changed, taken.ID)
+	}
+
+	return changed, nil
+}
+
+// occupiedBed returns the bed the patient of encounter is in, locked for
+// update, or nil when they are not in a bed.
+func occupiedBed(tx *repository.Repository, encounter *models.Encounter) (*models.Location, error) {
+	if encounter == nil || encounter.LocationID == nil || !occupiesLocation(*encounter) {
+		return nil, nil
+	}
+
+	location, err := tx.GetLocationForUpdate(*encounter.LocationID)
+	if err != nil {
+		return nil, referenceError("Location", *encounter.LocationID, err)
+	}
+	if location.PhysicalType != models.LocationTypeBed || location.BedStatus == nil {
+		return nil, nil
+	}
+	return location, nil
+}
+
+func setBedStatus(tx *repository.Repository, bed *models.Location, status string) error {
+	bed.BedStatus = &status
+	return tx.UpdateLocation(*bed, 0)
+}
+
+// broadcastBeds sends the current state of each bed to websocket clients.
+// It is called after commit; a bed that cannot be read is logged and
+// skipped.
+func broadcastBeds(repo *repository.Repository, hub *websocket.Hub, ids []string) {
+	for _, id := range ids {
+		bed, err := repo.GetBed(id)
+		if err != nil {
+			log.Printf("Failed to load bed %s for broadcast: %v", id, err)
+			continue
+		}
+		hub.BroadcastBedUpdated(bed)
+	}
+}
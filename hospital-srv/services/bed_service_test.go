@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"hospital-srv/models"
+	"reflect"
+	"testing"
+)
+
+func TestCheckBedTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want error
+	}{
+		{models.BedStatusFree, models.BedStatusCleaning, nil},
+		{models.BedStatusFree, models.BedStatusBlocked, nil},
+		{models.BedStatusCleaning, models.BedStatusFree, nil},
+		{models.BedStatusBlocked, models.BedStatusCleaning, nil},
+		{models.BedStatusFree, models.BedStatusOccupied, ErrInvalidBedTransition},
+		{models.BedStatusOccupied, models.BedStatusFree, ErrInvalidBedTransition},
+		{models.BedStatusOccupied, models.BedStatusCleaning, ErrInvalidBedTransition},
+		{models.BedStatusFree, models.BedStatusFree, ErrInvalidBedTransition},
+		{models.BedStatusFree, "reserved", ErrInvalidBedTransition},
+	}
+
+	for _, tt := range tests {
+		if err := checkBedTransition(tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("checkBedTransition(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+}
+
+func TestOccupiesLocation(t *testing.T) {
+	tests := map[string]bool{
+		models.EncounterStatusPlanned:    false,
+		models.EncounterStatusArrived:    true,
+		models.EncounterStatusInProgress: true,
+		models.EncounterStatusCompleted:  false,
+		models.EncounterStatusCancelled:  false,
+	}
+
+	for status, want := range tests {
+		if got := occupiesLocation(models.Encounter{Status: status}); got != want {
+			t.Errorf("occupiesLocation(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestWardOccupancy(t *testing.T) {
+	ward1, ward2 := "w1", "w2"
+	name1, name2 := "Ward 1", "Ward 2"
+	bed := func(wardID *string, wardName *string, status string, locationStatus string) models.Bed {
+		return models.Bed{WardID: wardID, WardName: wardName, Status: status, LocationStatus: locationStatus}
+	}
+
+	got := wardOccupancy([]models.Bed{
+		bed(&ward1, &name1, models.BedStatusFree, models.LocationStatusActive),
+		bed(&ward2, &name2, models.BedStatusOccupied, models.LocationStatusActive),
+		bed(&ward1, &name1, models.BedStatusOccupied, models.LocationStatusActive),
+		bed(&ward1, &name1, models.BedStatusCleaning, models.LocationStatusActive),
+		bed(&ward1, &name1, models.BedStatusBlocked, models.LocationStatusActive),
+		bed(&ward1, &name1, models.BedStatusFree, models.LocationStatusInactive),
+		bed(nil, nil, models.BedStatusFree, models.LocationStatusActive),
+	})
+
+	want := []models.WardOccupancy{
+		{WardID: &ward1, Name: &name1, Beds: 4, Free: 1, Occupied: 1, Cleaning: 1, Blocked: 1},
+		{WardID: &ward2, Name: &name2, Beds: 1, Occupied: 1},
+		{Beds: 1, Free: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wardOccupancy() = %+v, want %+v", got, want)
+	}
+
+	if got := wardOccupancy(nil); got == nil || len(got) != 0 {
+		t.Errorf("wardOccupancy(nil) = %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"time"
+)
+
+var (
+	// ErrInvalidCalendar is returned for working hours, breaks or exceptions
+	// that cannot be saved, e.g. an interval that ends before it starts.
+	ErrInvalidCalendar = errors.New("invalid working calendar")
+
+	// ErrOutsideWorkingHours is returned when an encounter would start while
+	// the practitioner is not working.
+	ErrOutsideWorkingHours = errors.New("outside the practitioner's working hours")
+)
+
+// defaultVisitLength is how long an encounter without an end time keeps the
+// practitioner busy.
+const defaultVisitLength = 30 * time.Minute
+
+// MaxAvailabilityRange bounds the period a single availability query may
+// cover.
+const MaxAvailabilityRange = 31 * 24 * time.Hour
+
+var workingExceptionKinds = map[string]bool{
+	models.WorkingExceptionVacation:  true,
+	models.WorkingExceptionSickLeave: true,
+	models.WorkingExceptionOther:     true,
+}
+
+// CalendarService manages when practitioners work: a weekly pattern of
+// working hours and breaks, plus dated exceptions such as vacations. Weekly
+// times are wall-clock times in the clinic time zone.
+type CalendarService struct {
+	repo     *repository.Repository
+	location *time.Location
+}
+
+func NewCalendarService(repo *repository.Repository, location *time.Location) *CalendarService {
+	return &CalendarService{
+		repo:     repo,
+		location: location,
+	}
+}
+
+// GetCalendar returns the weekly pattern and the exceptions that have not
+// ended yet.
+func (s *CalendarService) GetCalendar(practitionerID string) (*models.WorkingCalendar, error) {
+	if _, err := s.repo.GetPractitionerByID(practitionerID); err != nil {
+		return nil, referenceError("Practitioner", practitionerID, err)
+	}
+
+	hours, err := s.repo.GetWorkingHours(practitionerID)
+	if err != nil {
+		return nil, err
+	}
+
+	breaks, err := s.repo.GetWorkingBreaks(practitionerID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	exceptions, err := s.repo.GetWorkingExceptions(practitionerID, &now, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WorkingCalendar{Hours: hours, Breaks: breaks, Exceptions: exceptions}, nil
+}
+
+// SetWeeklyPattern replaces the practitioner's weekly working hours and
+// breaks. Working hours of the same weekday may not overlap.
+func (s *CalendarService) SetWeeklyPattern(practitionerID string, hours []models.WeeklyInterval, breaks []models.WeeklyInterval) error {
+	if _, err := s.repo.GetPractitionerByID(practitionerID); err != nil {
+		return referenceError("Practitioner", practitionerID, err)
+	}
+
+	for _, intervals := range [][]models.WeeklyInterval{hours, breaks} {
+		for i := range intervals {
+			if err := normalizeWeeklyInterval(&intervals[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, a := range hours {
+		for _, b := range hours[i+1:] {
+			if a.Weekday == b.Weekday && a.StartTime < b.EndTime && b.StartTime < a.EndTime {
+				return fmt.Errorf("%w: working hours %s-%s and %s-%s overlap", ErrInvalidCalendar, a.StartTime, a.EndTime, b.StartTime, b.EndTime)
+			}
+		}
+	}
+
+	return s.repo.ReplaceWeeklyPattern(practitionerID, hours, breaks)
+}
+
+// normalizeWeeklyInterval validates the interval and rewrites its times as
+// zero-padded "15:04", so that they compare correctly as strings.
+func normalizeWeeklyInterval(i *models.WeeklyInterval) error {
+	if i.Weekday < 0 || i.Weekday > 6 {
+		return fmt.Errorf("%w: weekday must be between 0 (Sunday) and 6 (Saturday)", ErrInvalidCalendar)
+	}
+
+	start, err := time.Parse("15:04", i.StartTime)
+	if err != nil {
+		return fmt.Errorf("%w: invalid start time %q", ErrInvalidCalendar, i.StartTime)
+	}
+	end, err := time.Parse("15:04", i.EndTime)
+	if err != nil {
+		return fmt.Errorf("%w: invalid end time %q", ErrInvalidCalendar, i.EndTime)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("%w: %s-%s ends before it starts", ErrInvalidCalendar, i.StartTime, i.EndTime)
+	}
+
+	i.StartTime = start.Format("15:04")
+	i.EndTime = end.Format("15:04")
+	return nil
+}
+
+func (s *CalendarService) AddException(exception models.WorkingException) (string, error) {
+	if _, err := s.repo.GetPractitionerByID(exception.PractitionerID); err != nil {
+		return "", referenceError("Practitioner", exception.PractitionerID, err)
+	}
+
+	if !workingExceptionKinds[exception.Kind] {
+		return "", fmt.Errorf("%w: unknown exception kind %q", ErrInvalidCalendar, exception.Kind)
+	}
+	if !exception.EndTime.After(exception.StartTime) {
+		return "", fmt.Errorf("%w: exception ends before it starts", ErrInvalidCalendar)
+	}
+
+	exception.StartTime = exception.StartTime.UTC()
+	exception.EndTime = exception.EndTime.UTC()
+
+	return s.repo.CreateWorkingException(exception)
+}
+
+func (s *CalendarService) GetException(id string) (*models.WorkingException, error) {
+	return s.repo.GetWorkingExceptionByID(id)
+}
+
+func (s *CalendarService) DeleteException(id string) error {
+	return s.repo.DeleteWorkingException(id)
+}
+
+// GetAvailability returns the practitioner's free time in [from, to): the
+// working hours minus breaks, exceptions, encounters and booked
+// appointments.
+func (s *CalendarService) GetAvailability(practitionerID string, from time.Time, to time.Time) ([]models.TimeInterval, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: end must be after start", ErrInvalidCalendar)
+	}
+	if to.Sub(from) > MaxAvailabilityRange {
+		return nil, fmt.Errorf("%w: availability can be requested for at most %d days", ErrInvalidCalendar, int(MaxAvailabilityRange.Hours()/24))
+	}
+
+	if _, err := s.repo.GetPractitionerByID(practitionerID); err != nil {
+		return nil, referenceError("Practitioner", practitionerID, err)
+	}
+
+	free, _, err := s.loadWorkingTime(s.repo, practitionerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	encounters, err := s.repo.SearchOverlappingEncounters(practitionerID, from, to, defaultVisitLength)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range encounters {
+		free = subtractInterval(free, encounterPeriod(e.Encounter))
+	}
+
+	// Appointments are shorter than a day, so one day of lookback finds
+	// every appointment still running at from.
+	appointmentFrom := from.AddDate(0, 0, -1)
+	appointments, err := s.repo.SearchAppointments(models.AppointmentFilter{
+		PractitionerID: practitionerID,
+		StartFrom:      &appointmentFrom,
+		StartBefore:    &to,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range appointments {
+		if a.Status == models.AppointmentStatusBooked || a.Status == models.AppointmentStatusArrived {
+			free = subtractInterval(free, models.TimeInterval{Start: a.StartTime, End: a.EndTime})
+		}
+	}
+
+	return free, nil
+}
+
+// checkWorkingHours returns ErrOutsideWorkingHours unless the practitioner
+// works at start. Practitioners without any weekly working hours are not
+// restricted, so that calendars can be introduced one practitioner at a
+// time.
+func (s *CalendarService) checkWorkingHours(tx *repository.Repository, practitionerID string, start time.Time) error {
+	working, configured, err := s.loadWorkingTime(tx, practitionerID, start, start.Add(time.Minute))
+	if err != nil {
+		return err
+	}
+	if configured && len(working) == 0 {
+		return fmt.Errorf("%w: %s", ErrOutsideWorkingHours, start.In(s.location).Format("Mon 2006-01-02 15:04 MST"))
+	}
+	return nil
+}
+
+// loadWorkingTime returns the intervals within [from, to) the practitioner
+// works. configured reports whether the practitioner has weekly hours at
+// all.
+func (s *CalendarService) loadWorkingTime(repo *repository.Repository, practitionerID string, from time.Time, to time.Time) (working []models.TimeInterval, configured bool, err error) {
+	hours, err := repo.GetWorkingHours(practitionerID)
+	if err != nil || len(hours) == 0 {
+		return nil, false, err
+	}
+
+	breaks, err := repo.GetWorkingBreaks(practitionerID)
+	if err != nil {
+		return nil, true, err
+	}
+
+	exceptions, err := repo.GetWorkingExceptions(practitionerID, &from, &to)
+	if err != nil {
+		return nil, true, err
+	}
+
+	calendar := models.WorkingCalendar{Hours: hours, Breaks: breaks, Exceptions: exceptions}
+	return s.workingTime(calendar, from, to), true, nil
+}
+
+// workingTime expands the weekly pattern of calendar into the intervals
+// within [from, to) the practitioner works, leaving out breaks and
+// exceptions.
+func (s *CalendarService) workingTime(calendar models.WorkingCalendar, from time.Time, to time.Time) []models.TimeInterval {
+	var working []models.TimeInterval
+
+	local := from.In(s.location)
+	for day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.location); day.Before(to); day = day.AddDate(0, 0, 1) {
+		var daily []models.TimeInterval
+		for _, h := range calendar.Hours {
+			if h.Weekday == int(day.Weekday()) {
+				daily = append(daily, s.onDay(day, h))
+			}
+		}
+		for _, b := range calendar.Breaks {
+			if b.Weekday == int(day.Weekday()) {
+				daily = subtractInterval(daily, s.onDay(day, b))
+			}
+		}
+		working = append(working, daily...)
+	}
+
+	for _, e := range calendar.Exceptions {
+		working = subtractInterval(working, models.TimeInterval{Start: e.StartTime, End: e.EndTime})
+	}
+
+	working = subtractInterval(working, models.TimeInterval{Start: time.Time{}, End: from})
+	working = subtractInterval(working, models.TimeInterval{Start: to, End: to.AddDate(0, 0, 1)})
+
+	return working
+}
+
+// onDay places a weekly interval on the given local midnight.
+func (s *CalendarService) onDay(day time.Time, i models.WeeklyInterval) models.TimeInterval {
+	start, _ := time.Parse("15:04", i.StartTime)
+	end, _ := time.Parse("15:04", i.EndTime)
+	return models.TimeInterval{
+		Start: time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, s.location),
+		End:   time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, s.location),
+	}
+}
+
+// encounterPeriod returns when the encounter keeps its practitioner busy:
+// until its end time, or for defaultVisitLength when it has none.
+func encounterPeriod(e models.Encounter) models.TimeInterval {
+	if e.EndTime != nil {
+		return models.TimeInterval{Start: e.StartTime, End: *e.EndTime}
+	}
+	return models.TimeInterval{Start: e.StartTime, End: e.StartTime.Add(defaultVisitLength)}
+}
+
+// subtractInterval removes cut from each of the intervals, splitting those
+// it falls in the middle of.
+func subtractInterval(intervals []models.TimeInterval, cut models.TimeInterval) []models.TimeInterval {
+	var result []models.TimeInterval
+	for _, i := range intervals {
+		if !cut.Start.Before(i.End) || !cut.End.After(i.Start) {
+			result = append(result, i)
+			continue
+		}
+		if cut.Start.After(i.Start) {
+			result = append(result, models.TimeInterval{Start: i.Start, End: cut.Start})
+		}
+		if cut.End.Before(i.End) {
+			result = append(result, models.TimeInterval{Start: cut.End, End: i.End})
+		}
+	}
+	return result
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"hospital-srv/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func at(hour int, minute int) time.Time {
+	return time.Date(2024, 3, 11, hour, minute, 0, 0, time.UTC)
+}
+
+func interval(start time.Time, end time.Time) models.TimeInterval {
+	return models.TimeInterval{Start: start, End: end}
+}
+
+func TestSubtractInterval(t *testing.T) {
+	day := interval(at(9, 0), at(17, 0))
+
+	tests := []struct {
+		name      string
+		intervals []models.TimeInterval
+		cut       models.TimeInterval
+		want      []models.TimeInterval
+	}{
+		{name: "before", intervals: []models.TimeInterval{day}, cut: interval(at(7, 0), at(8, 0)), want: []models.TimeInterval{day}},
+		{name: "touching the start", intervals: []models.TimeInterval{day}, cut: interval(at(8, 0), at(9, 0)), want: []models.TimeInterval{day}},
+		{name: "touching the end", intervals: []models.TimeInterval{day}, cut: interval(at(17, 0), at(18, 0)), want: []models.TimeInterval{day}},
+		{name: "middle", intervals: []models.TimeInterval{day}, cut: interval(at(12, 0), at(13, 0)), want: []models.TimeInterval{interval(at(9, 0), at(12, 0)), interval(at(13, 0), at(17, 0))}},
+		{name: "start", intervals: []models.TimeInterval{day}, cut: interval(at(8, 0), at(10, 0)), want: []models.TimeInterval{interval(at(10, 0), at(17, 0))}},
+		{name: "end", intervals: []models.TimeInterval{day}, cut: interval(at(16, 0), at(18, 0)), want: []models.TimeInterval{interval(at(9, 0), at(16, 0))}},
+		{name: "whole", intervals: []models.TimeInterval{day}, cut: interval(at(9, 0), at(17, 0)), want: nil},
+		{name: "covering", intervals: []models.TimeInterval{day}, cut: interval(at(0, 0), at(23, 0)), want: nil},
+		{
+			name:      "across several",
+			intervals: []models.TimeInterval{interval(at(9, 0), at(12, 0)), interval(at(13, 0), at(17, 0))},
+			cut:       interval(at(11, 0), at(14, 0)),
+			want:      []models.TimeInterval{interval(at(9, 0), at(11, 0)), interval(at(14, 0), at(17, 0))},
+		},
+		{name: "nothing", intervals: nil, cut: interval(at(9, 0), at(10, 0)), want: nil},
+	}
+
+	for _, tt := range tests {
+		if got := subtractInterval(tt.intervals, tt.cut); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: subtractInterval() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncounterPeriod(t *testing.T) {
+	end := at(11, 30)
+
+	tests := []struct {
+		name      string
+		encounter models.Encounter
+		want      models.TimeInterval
+	}{
+		{name: "with end time", encounter: models.Encounter{StartTime: at(9, 0), EndTime: &end}, want: interval(at(9, 0), at(11, 30))},
+		{name: "without end time", encounter: models.Encounter{StartTime: at(9, 0)}, want: interval(at(9, 0), at(9, 30))},
+	}
+
+	for _, tt := range tests {
+		if got := encounterPeriod(tt.encounter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: encounterPeriod() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeWeeklyInterval(t *testing.T) {
+	i := models.WeeklyInterval{Weekday: 1, StartTime: "8:00", EndTime: "16:30"}
+	if err := normalizeWeeklyInterval(&i); err != nil {
+		t.Fatalf("normalizeWeeklyInterval() = %v", err)
+	}
+	if i.StartTime != "08:00" || i.EndTime != "16:30" {
+		t.Errorf("normalized = %s-%s, want 08:00-16:30", i.StartTime, i.EndTime)
+	}
+
+	for _, invalid := range []models.WeeklyInterval{
+		{Weekday: 7, StartTime: "08:00", EndTime: "16:00"},
+		{Weekday: -1, StartTime: "08:00", EndTime: "16:00"},
+		{Weekday: 1, StartTime: "8am", EndTime: "16:00"},
+		{Weekday: 1, StartTime: "08:00", EndTime: "25:00"},
+		{Weekday: 1, StartTime: "16:00", EndTime: "08:00"},
+		{Weekday: 1, StartTime: "08:00", EndTime: "08:00"},
+	} {
+		if err := normalizeWeeklyInterval(&invalid); !errors.Is(err, ErrInvalidCalendar) {
+			t.Errorf("normalizeWeeklyInterval(%+v) = %v, want %v", invalid, err, ErrInvalidCalendar)
+		}
+	}
+}
+
+func TestWorkingTime(t *testing.T) {
+	clinic := time.FixedZone("MSK", 3*60*60)
+	s := &CalendarService{location: clinic}
+	local := func(day int, hour int, minute int) time.Time {
+		// March 11, 2024 is a Monday.
+		return time.Date(2024, 3, day, hour, minute, 0, 0, clinic)
+	}
+
+	calendar := models.WorkingCalendar{
+		Hours: []models.WeeklyInterval{
+			{Weekday: int(time.Monday), StartTime: "09:00", EndTime: "17:00"},
+			{Weekday: int(time.Tuesday), StartTime: "09:00", EndTime: "13:00"},
+			{Weekday: int(time.Tuesday), StartTime: "18:00", EndTime: "20:00"},
+		},
+		Breaks: []models.WeeklyInterval{
+			{Weekday: int(time.Monday), StartTime: "12:00", EndTime: "12:30"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		calendar models.WorkingCalendar
+		from, to time.Time
+		want     []models.TimeInterval
+	}{
+		{
+			name:     "working week",
+			calendar: calendar,
+			from:     local(11, 0, 0),
+			to:       local(18, 0, 0),
+			want: []models.TimeInterval{
+				interval(local(11, 9, 0), local(11, 12, 0)),
+				interval(local(11, 12, 30), local(11, 17, 0)),
+				interval(local(12, 9, 0), local(12, 13, 0)),
+				interval(local(12, 18, 0), local(12, 20, 0)),
+			},
+		},
+		{
+			name:     "clipped to the range",
+			calendar: calendar,
+			from:     local(11, 10, 0),
+			to:       local(11, 15, 0),
+			want: []models.TimeInterval{
+				interval(local(11, 10, 0), local(11, 12, 0)),
+				interval(local(11, 12, 30), local(11, 15, 0)),
+			},
+		},
+		{
+			name:     "range given in UTC",
+			calendar: calendar,
+			from:     local(11, 0, 0).UTC(),
+			to:       local(12, 0, 0).UTC(),
+			want: []models.TimeInterval{
+				interval(local(11, 9, 0), local(11, 12, 0)),
+				interval(local(11, 12, 30), local(11, 17, 0)),
+			},
+		},
+		{
+			name: "vacation",
+			calendar: models.WorkingCalendar{
+				Hours:  calendar.Hours,
+				Breaks: calendar.Breaks,
+				Exceptions: []models.WorkingException{
+					{Kind: models.WorkingExceptionVacation, StartTime: local(11, 0, 0), EndTime: local(12, 0, 0)},
+					{Kind: models.WorkingExceptionOther, StartTime: local(12, 19, 0), EndTime: local(12, 21, 0)},
+				},
+			},
+			from: local(11, 0, 0),
+			to:   local(13, 0, 0),
+			want: []models.TimeInterval{
+				interval(local(12, 9, 0), local(12, 13, 0)),
+				interval(local(12, 18, 0), local(12, 19, 0)),
+			},
+		},
+		{
+			name:     "day off",
+			calendar: calendar,
+			from:     local(16, 0, 0),
+			to:       local(18, 0, 0),
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got := s.workingTime(tt.calendar, tt.from, tt.to)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: workingTime() = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Start.Equal(tt.want[i].Start) || !got[i].End.Equal(tt.want[i].End) {
+				t.Errorf("%s: workingTime() = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"slices"
+	"time"
+)
+
+var (
+	// ErrInvalidNoteStatus is returned for a clinical note status change the
+	// workflow does not allow, e.g. editing a signed note without amending it.
+	ErrInvalidNoteStatus = errors.New("clinical note status change not allowed")
+
+	// ErrInvalidClinicalNote is returned for a note whose references do not
+	// fit together, e.g. one written for an encounter of another patient.
+	ErrInvalidClinicalNote = errors.New("invalid clinical note")
+)
+
+// noteTransitions lists, per status, the statuses a clinical note may move
+// to next. Drafts may be edited freely; signed notes may only be amended.
+var noteTransitions = map[string][]string{
+	models.ClinicalNoteStatusPreliminary: {models.ClinicalNoteStatusPreliminary, models.ClinicalNoteStatusFinal, models.ClinicalNoteStatusEnteredInError},
+	models.ClinicalNoteStatusFinal:       {models.ClinicalNoteStatusAmended, models.ClinicalNoteStatusEnteredInError},
+	models.ClinicalNoteStatusAmended:     {models.ClinicalNoteStatusAmended, models.ClinicalNoteStatusEnteredInError},
+}
+
+func checkNoteTransition(from string, to string) error {
+	if !slices.Contains(noteTransitions[from], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidNoteStatus, from, to)
+	}
+	return nil
+}
+
+// ClinicalNoteService manages doctors' visit notes.
+type ClinicalNoteService struct {
+	repo *repository.Repository
+}
+
+func NewClinicalNoteService(repo *repository.Repository) *ClinicalNoteService {
+	return &ClinicalNoteService{repo: repo}
+}
+
+// CreateClinicalNote saves a new note, either as a draft or already signed.
+func (s *ClinicalNoteService) CreateClinicalNote(note models.ClinicalNote) (string, error) {
+	if note.Status != models.ClinicalNoteStatusPreliminary && note.Status != models.ClinicalNoteStatusFinal {
+		return "", fmt.Errorf("%w: a new note must be preliminary or final, not %s", ErrInvalidNoteStatus, note.Status)
+	}
+
+	var id string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkClinicalNote(tx, &note); err != nil {
+			return err
+		}
+
+		note.SignedAt = nil
+		if note.Status == models.ClinicalNoteStatusFinal {
+			now := time.Now()
+			note.SignedAt = &now
+		}
+
+		var err error
+		id, err = tx.CreateClinicalNote(note)
+		return err
+	})
+	return id, err
+}
+
+// UpdateClinicalNote saves a changed note. The status must follow
+// noteTransitions: signing a draft or amending a signed note records the
+// current time as the signing time, and the previous version stays in the
+// note's history. If expectedVersion is non-zero it must match the stored
+// version.
+func (s *ClinicalNoteService) UpdateClinicalNote(note models.ClinicalNote, expectedVersion int) error {
+	return s.repo.WithTx(func(tx *repository.Repository) error {
+		current, err := tx.GetClinicalNoteByID(note.ID)
+		if err != nil {
+			return err
+		}
+
+		if note.EncounterID != current.EncounterID || note.AuthorID != current.AuthorID {
+			return fmt.Errorf("%w: the encounter and author of a note cannot change", ErrInvalidClinicalNote)
+		}
+
+		if err := checkNoteTransition(current.Status, note.Status); err != nil {
+			return err
+		}
+
+		if err := checkClinicalNote(tx, &note); err != nil {
+			return err
+		}
+
+		switch note.Status {
+		case models.ClinicalNoteStatusFinal, models.ClinicalNoteStatusAmended:
+			now := time.Now()
+			note.SignedAt = &now
+		case models.ClinicalNoteStatusPreliminary:
+			note.SignedAt = nil
+		default:
+			note.SignedAt = current.SignedAt
+		}
+
+		return tx.UpdateClinicalNote(note, expectedVersion)
+	})
+}
+
+func checkClinicalNote(tx *repository.Repository, note *models.ClinicalNote) error {
+	encounter, err := tx.GetEncounterByID(note.EncounterID)
+	if err != nil {
+		return referenceError("Encounter", note.EncounterID, err)
+	}
+	if note.PatientID != "" && note.PatientID != encounter.PatientID {
+		return fmt.Errorf("%w: Encounter/%s belongs to another patient", ErrInvalidClinicalNote, encounter.ID)
+	}
+	note.PatientID = encounter.PatientID
+
+	if _, err := tx.GetPractitionerByID(note.AuthorID); err != nil {
+		return referenceError("Practitioner", note.AuthorID, err)
+	}
+
+	return nil
+}
+
+func (s *ClinicalNoteService) GetClinicalNoteByID(id string) (*models.ClinicalNote, error) {
+	return s.repo.GetClinicalNoteByID(id)
+}
+
+func (s *ClinicalNoteService) SearchClinicalNotes(filter models.ClinicalNoteFilter) ([]models.ClinicalNote, error) {
+	return s.repo.SearchClinicalNotes(filter)
+}
+
+func (s *ClinicalNoteService) GetClinicalNoteHistory(id string) ([]models.ClinicalNote, error) {
+	return s.repo.GetClinicalNoteHistory(id)
+}
+
+func (s *ClinicalNoteService) GetClinicalNoteVersion(id string, versionID int) (*models.ClinicalNote, error) {
+	return s.repo.GetClinicalNoteVersion(id, versionID)
+}
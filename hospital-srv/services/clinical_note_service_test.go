@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+	"hospital-srv/models"
+	"testing"
+)
+
+func TestCheckNoteTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want error
+	}{
+		{models.ClinicalNoteStatusPreliminary, models.ClinicalNoteStatusPreliminary, nil},
+		{models.ClinicalNoteStatusPreliminary, models.ClinicalNoteStatusFinal, nil},
+		{models.ClinicalNoteStatusPreliminary, models.ClinicalNoteStatusEnteredInError, nil},
+		{models.ClinicalNoteStatusPreliminary, models.ClinicalNoteStatusAmended, ErrInvalidNoteStatus},
+		{models.ClinicalNoteStatusFinal, models.ClinicalNoteStatusAmended, nil},
+		{models.ClinicalNoteStatusFinal, models.ClinicalNoteStatusEnteredInError, nil},
+		{models.ClinicalNoteStatusFinal, models.ClinicalNoteStatusFinal, ErrInvalidNoteStatus},
+		{models.ClinicalNoteStatusFinal, models.ClinicalNoteStatusPreliminary, ErrInvalidNoteStatus},
+		{models.ClinicalNoteStatusAmended, models.ClinicalNoteStatusAmended, nil},
+		{models.ClinicalNoteStatusAmended, models.ClinicalNoteStatusFinal, ErrInvalidNoteStatus},
+		{models.ClinicalNoteStatusEnteredInError, models.ClinicalNoteStatusPreliminary, ErrInvalidNoteStatus},
+		{models.ClinicalNoteStatusPreliminary, "unknown", ErrInvalidNoteStatus},
+	}
+
+	for _, tt := range tests {
+		if err := checkNoteTransition(tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("checkNoteTransition(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownCode is returned for a diagnosis code that is missing from
+	// the local ICD-10 code table.
+	ErrUnknownCode = errors.New("unknown ICD-10 code")
+
+	// ErrInvalidCondition is returned for a condition recorded in an
+	// encounter of another patient.
+	ErrInvalidCondition = errors.New("invalid condition")
+)
+
+// abatedStatuses are the clinical statuses of a condition that is no longer
+// active; only these may carry an abatement time.
+var abatedStatuses = map[string]bool{
+	models.ConditionClinicalStatusInactive:  true,
+	models.ConditionClinicalStatusRemission: true,
+	models.ConditionClinicalStatusResolved:  true,
+}
+
+// ConditionService manages diagnoses and the ICD-10 code table they are
+// coded with.
+type ConditionService struct {
+	repo *repository.Repository
+}
+
+func NewConditionService(repo *repository.Repository) *ConditionService {
+	return &ConditionService{repo: repo}
+}
+
+// CreateCondition records a diagnosis. Resolving it without an abatement
+// time resolves it now.
+func (s *ConditionService) CreateCondition(condition models.Condition) (string, error) {
+	var id string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkCondition(tx, &condition); err != nil {
+			return err
+		}
+
+		var err error
+		id, err = tx.CreateCondition(condition)
+		return err
+	})
+	return id, err
+}
+
+// UpdateCondition saves a changed diagnosis, checked like a new one. If
+// expectedVersion is non-zero it must match the stored version.
+func (s *ConditionService) UpdateCondition(condition models.Condition, expectedVersion int) error {
+	return s.repo.WithTx(func(tx *repository.Repository) error {
+		if _, err := tx.GetConditionByID(condition.ID); err != nil {
+			return err
+		}
+
+		if err := checkCondition(tx, &condition); err != nil {
+			return err
+		}
+
+		return tx.UpdateCondition(condition, expectedVersion)
+	})
+}
+
+func checkCondition(tx *repository.Repository, condition *models.Condition) error {
+	if _, err := tx.GetPatientByID(condition.PatientID); err != nil {
+		return referenceError("Patient", condition.PatientID, err)
+	}
+
+	if condition.EncounterID != nil {
+		encounter, err := tx.GetEncounterByID(*condition.EncounterID)
+		if err != nil {
+			return referenceError("Encounter", *condition.EncounterID, err)
+		}
+		if encounter.PatientID != condition.PatientID {
+			return fmt.Errorf("%w: Encounter/%s belongs to another patient", ErrInvalidCondition, encounter.ID)
+		}
+	}
+
+	if condition.RecorderID != nil {
+		if _, err := tx.GetPractitionerByID(*condition.RecorderID); err != nil {
+			return referenceError("Practitioner", *condition.RecorderID, err)
+		}
+	}
+
+	if _, err := tx.GetICD10Code(condition.Code); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrUnknownCode, condition.Code)
+		}
+		return err
+	}
+
+	if !abatedStatuses[condition.ClinicalStatus] {
+		condition.AbatementTime = nil
+	} else if condition.ClinicalStatus == models.ConditionClinicalStatusResolved && condition.AbatementTime == nil {
+		now := time.Now()
+		condition.AbatementTime = &now
+	}
+
+	return nil
+}
+
+func (s *ConditionService) GetConditionByID(id string) (*models.Condition, error) {
+	return s.repo.GetConditionByID(id)
+}
+
+func (s *ConditionService) SearchConditions(filter models.ConditionFilter) ([]models.Condition, error) {
+	return s.repo.SearchConditions(filter)
+}
+
+func (s *ConditionService) GetConditionHistory(id string) ([]models.Condition, error) {
+	return s.repo.GetConditionHistory(id)
+}
+
+func (s *ConditionService) GetConditionVersion(id string, versionID int) (*models.Condition, error) {
+	return s.repo.GetConditionVersion(id, versionID)
+}
+
+// SearchCodes looks up ICD-10 codes by code prefix or display text.
+func (s *ConditionService) SearchCodes(text string, limit int) ([]models.ICD10Code, error) {
+	return s.repo.SearchICD10Codes(text, limit)
+}
+
+// LoadICD10Codes loads the code table from a CSV file of code,display
+// rows, adding new codes and updating known ones. Lines starting with #
+// are ignored. It returns the number of codes read.
+func (s *ConditionService) LoadICD10Codes(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+
+	var codes []models.ICD10Code
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		codes = append(codes, models.ICD10Code{
+			Code:    strings.ToUpper(strings.TrimSpace(record[0])),
+			Display: strings.TrimSpace(record[1]),
+		})
+	}
+
+	if err := s.repo.UpsertICD10Codes(codes); err != nil {
+		return 0, err
+	}
+	return len(codes), nil
+}
@@ -1,47 +1,236 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"hospital-srv/models"
 	"hospital-srv/repository"
 	"hospital-srv/websocket"
+	"slices"
+	"time"
 )
 
+// ErrInvalidStatusTransition is returned for an encounter status change the
+// workflow does not allow, e.g. reopening a completed encounter.
+var ErrInvalidStatusTransition = errors.New("encounter status change not allowed")
+
+// encounterTransitions lists, per status, the statuses an encounter may
+// move to next. Completed and cancelled encounters are final.
+var encounterTransitions = map[string][]string{
+	models.EncounterStatusPlanned:    {models.EncounterStatusArrived, models.EncounterStatusInProgress, models.EncounterStatusCancelled},
+	models.EncounterStatusArrived:    {models.EncounterStatusInProgress, models.EncounterStatusCancelled},
+	models.EncounterStatusInProgress: {models.EncounterStatusCompleted},
+}
+
+// initialEncounterStatuses lists the statuses a new encounter may start in.
+// Completed and cancelled are only reached through a status change.
+var initialEncounterStatuses = []string{models.EncounterStatusPlanned, models.EncounterStatusArrived, models.EncounterStatusInProgress}
+
+// checkInitialStatus returns ErrInvalidStatusTransition unless a new
+// encounter may start in status.
+func checkInitialStatus(status string) error {
+	if !slices.Contains(initialEncounterStatuses, status) {
+		return fmt.Errorf("%w: new encounter cannot be %s", ErrInvalidStatusTransition, status)
+	}
+	return nil
+}
+
+// checkStatusTransition returns ErrInvalidStatusTransition unless
+// encounterTransitions lets an encounter move from one status to the other.
+func checkStatusTransition(from string, to string) error {
+	if !slices.Contains(encounterTransitions[from], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, from, to)
+	}
+	return nil
+}
+
 type EncounterService struct {
-	repo *repository.Repository
-	hub  *websocket.Hub
+	repo     *repository.Repository
+	hub      *websocket.Hub
+	notifier EncounterNotifier
+	calendar *CalendarService
 }
 
-func NewEncounterService(repo *repository.Repository, hub *websocket.Hub) *EncounterService {
+func NewEncounterService(repo *repository.Repository, hub *websocket.Hub, notifier EncounterNotifier, calendar *CalendarService) *EncounterService {
 	return &EncounterService{
-		repo: repo,
-		hub:  hub,
+		repo:     repo,
+		hub:      hub,
+		notifier: notifier,
+		calendar: calendar,
 	}
 }
 
-func (s *EncounterService) CreateEncounter(encounter models.Encounter) (string, error) {
-	id, err := s.repo.CreateEncounter(encounter)
+// CreateEncounter creates the encounter, or returns ErrInactivePractitioner
+// for a deactivated practitioner and ErrOutsideWorkingHours when the
+// practitioner does not work at its start time. actor is recorded as the
+// author of the initial status.
+func (s *EncounterService) CreateEncounter(encounter models.Encounter, actor string) (string, error) {
+	var createdEncounter *models.EncounterWithDetails
+	var beds []string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkActivePractitioner(tx, encounter.PractitionerID); err != nil {
+			return err
+		}
+		if err := s.calendar.checkWorkingHours(tx, encounter.PractitionerID, encounter.StartTime); err != nil {
+			return err
+		}
+
+		var err error
+		createdEncounter, beds, err = createEncounter(tx, s.notifier, encounter, actor)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
 
-	createdEncounter, err := s.repo.GetEncounterByID(id)
+	s.hub.BroadcastEncounterCreated(createdEncounter)
+	broadcastBeds(s.repo, s.hub, beds)
+
+	return createdEncounter.ID, nil
+}
+
+// createEncounter saves the encounter and queues encounter_created. It must
+// start in one of initialEncounterStatuses. Its location, if any, must be in
+// active use; a bed the patient is put in must be free. The IDs of the beds
+// whose status changed are returned.
+func createEncounter(tx *repository.Repository, notifier EncounterNotifier, encounter models.Encounter, actor string) (*models.EncounterWithDetails, []string, error) {
+	if err := checkInitialStatus(encounter.Status); err != nil {
+		return nil, nil, err
+	}
+
+	if encounter.LocationID != nil {
+		if err := checkActiveLocation(tx, *encounter.LocationID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	beds, err := moveBeds(tx, nil, encounter)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	s.hub.BroadcastEncounterCreated(createdEncounter)
+	id, err := tx.CreateEncounter(encounter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.AddEncounterStatusChange(id, encounter.Status, actor); err != nil {
+		return nil, nil, err
+	}
 
-	return id, nil
+	created, err := tx.GetEncounterByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := notifier.EnqueueEncounterEvent(tx, EventEncounterCreated, *created); err != nil {
+		return nil, nil, err
+	}
+
+	return created, beds, nil
+}
+
+// updateEncounter saves the encounter and queues encounter_status_updated
+// when the status changed, encounter_updated otherwise. A status change must
+// follow encounterTransitions; it is recorded in the status history, and
+// completing the encounter sets its end time. An encounter can only be moved
+// to a location in active use, to a bed only when it is free, and to another
+// start time or practitioner only within working hours. The IDs of the beds
+// whose status changed are returned.
+func updateEncounter(tx *repository.Repository, notifier EncounterNotifier, calendar *CalendarService, encounter models.Encounter, expectedVersion int, actor string) ([]string, error) {
+	previous, err := tx.GetEncounterForUpdate(encounter.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if encounter.PractitionerID != previous.PractitionerID || !encounter.StartTime.Equal(previous.StartTime) {
+		if err := calendar.checkWorkingHours(tx, encounter.PractitionerID, encounter.StartTime); err != nil {
+			return nil, err
+		}
+	}
+
+	if encounter.LocationID != nil && (previous.LocationID == nil || *previous.LocationID != *encounter.LocationID) {
+		if err := checkActiveLocation(tx, *encounter.LocationID); err != nil {
+			return nil, err
+		}
+	}
+
+	if previous.Status != encounter.Status {
+		if err := checkStatusTransition(previous.Status, encounter.Status); err != nil {
+			return nil, err
+		}
+
+		if encounter.Status == models.EncounterStatusCompleted && encounter.EndTime == nil {
+			now := time.Now()
+			encounter.EndTime = &now
+		}
+	}
+
+	// The status change is recorded after the update has archived the
+	// previous version, so that version's history snapshot ends before it.
+	if err := tx.UpdateEncounter(encounter, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if previous.Status != encounter.Status {
+		if err := tx.AddEncounterStatusChange(encounter.ID, encounter.Status, actor); err != nil {
+			return nil, err
+		}
+	}
+
+	beds, err := moveBeds(tx, &previous.Encounter, encounter)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := tx.GetEncounterByID(encounter.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	eventType := EventEncounterUpdated
+	if previous.Status != updated.Status {
+		eventType = EventEncounterStatusUpdated
+	}
+
+	if err := notifier.EnqueueEncounterEvent(tx, eventType, *updated); err != nil {
+		return nil, err
+	}
+
+	return beds, nil
 }
 
 func (s *EncounterService) GetAllEncounters() ([]models.EncounterWithDetails, error) {
 	return s.repo.GetAllEncounters()
 }
 
+func (s *EncounterService) SearchEncounters(filter models.EncounterFilter) ([]models.EncounterWithDetails, error) {
+	return s.repo.SearchEncounters(filter)
+}
+
 func (s *EncounterService) GetEncounterByID(id string) (*models.EncounterWithDetails, error) {
 	return s.repo.GetEncounterByID(id)
 }
 
-func (s *EncounterService) UpdateEncounterStatus(id string, status string) error {
-	return s.repo.UpdateEncounterStatus(id, status)
+func (s *EncounterService) UpdateEncounter(encounter models.Encounter, expectedVersion int, actor string) error {
+	var beds []string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		var err error
+		beds, err = updateEncounter(tx, s.notifier, s.calendar, encounter, expectedVersion, actor)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	broadcastBeds(s.repo, s.hub, beds)
+	return nil
+}
+
+func (s *EncounterService) GetEncounterHistory(id string) ([]models.EncounterWithDetails, error) {
+	return s.repo.GetEncounterHistory(id)
+}
+
+func (s *EncounterService) GetEncounterVersion(id string, versionID int) (*models.EncounterWithDetails, error) {
+	return s.repo.GetEncounterVersion(id, versionID)
 }
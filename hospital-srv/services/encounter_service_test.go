@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"hospital-srv/models"
+	"testing"
+)
+
+func TestCheckStatusTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want error
+	}{
+		{models.EncounterStatusPlanned, models.EncounterStatusArrived, nil},
+		{models.EncounterStatusPlanned, models.EncounterStatusInProgress, nil},
+		{models.EncounterStatusPlanned, models.EncounterStatusCancelled, nil},
+		{models.EncounterStatusPlanned, models.EncounterStatusCompleted, ErrInvalidStatusTransition},
+		{models.EncounterStatusArrived, models.EncounterStatusInProgress, nil},
+		{models.EncounterStatusArrived, models.EncounterStatusCancelled, nil},
+		{models.EncounterStatusArrived, models.EncounterStatusPlanned, ErrInvalidStatusTransition},
+		{models.EncounterStatusArrived, models.EncounterStatusCompleted, ErrInvalidStatusTransition},
+		{models.EncounterStatusInProgress, models.EncounterStatusCompleted, nil},
+		{models.EncounterStatusInProgress, models.EncounterStatusCancelled, ErrInvalidStatusTransition},
+		{models.EncounterStatusInProgress, models.EncounterStatusArrived, ErrInvalidStatusTransition},
+		{models.EncounterStatusCompleted, models.EncounterStatusInProgress, ErrInvalidStatusTransition},
+		{models.EncounterStatusCompleted, models.EncounterStatusCancelled, ErrInvalidStatusTransition},
+		{models.EncounterStatusCancelled, models.EncounterStatusPlanned, ErrInvalidStatusTransition},
+		{models.EncounterStatusCancelled, models.EncounterStatusInProgress, ErrInvalidStatusTransition},
+		{models.EncounterStatusPlanned, "unknown", ErrInvalidStatusTransition},
+		{"unknown", models.EncounterStatusPlanned, ErrInvalidStatusTransition},
+	}
+
+	for _, tt := range tests {
+		if err := checkStatusTransition(tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("checkStatusTransition(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+}
+
+func TestCheckInitialStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   error
+	}{
+		{models.EncounterStatusPlanned, nil},
+		{models.EncounterStatusArrived, nil},
+		{models.EncounterStatusInProgress, nil},
+		{models.EncounterStatusCompleted, ErrInvalidStatusTransition},
+		{models.EncounterStatusCancelled, ErrInvalidStatusTransition},
+		{"unknown", ErrInvalidStatusTransition},
+	}
+
+	for _, tt := range tests {
+		if err := checkInitialStatus(tt.status); !errors.Is(err, tt.want) {
+			t.Errorf("checkInitialStatus(%q) = %v, want %v", tt.status, err, tt.want)
+		}
+	}
+}
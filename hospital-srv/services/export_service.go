@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ResourceExporter writes resources for a bulk data export.
+type ResourceExporter interface {
+	// ExportResources writes the resources of resourceType changed since
+	// since, or all of them when since is nil, to w as NDJSON and returns
+	// how many it wrote.
+	ExportResources(resourceType string, since *time.Time, w io.Writer) (int, error)
+}
+
+// ExportService runs bulk data exports in the background, writing one
+// NDJSON file per resource type under dir/<job id>.
+type ExportService struct {
+	repo     *repository.Repository
+	exporter ResourceExporter
+	dir      string
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+func NewExportService(repo *repository.Repository, exporter ResourceExporter, dir string) *ExportService {
+	return &ExportService{
+		repo:     repo,
+		exporter: exporter,
+		dir:      dir,
+		running:  map[string]context.CancelFunc{},
+	}
+}
+
+// FailUnfinishedExports fails the exports a previous run of the server left
+// in progress, returning how many there were.
+func (s *ExportService) FailUnfinishedExports() (int64, error) {
+	return s.repo.FailUnfinishedExportJobs("export interrupted by a server restart")
+}
+
+// StartExport records an export of types and starts it in the background.
+// request is the kick-off URL reported in the manifest.
+func (s *ExportService) StartExport(types []string, since *time.Time, request string) (string, error) {
+	job := models.ExportJob{
+		Status:          models.ExportStatusInProgress,
+		Types:           types,
+		Since:           since,
+		Request:         request,
+		TransactionTime: time.Now().UTC(),
+	}
+
+	id, err := s.repo.CreateExportJob(job)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.running[id] = cancel
+	s.mu.Unlock()
+
+	go s.run(ctx, id, job)
+
+	return id, nil
+}
+
+func (s *ExportService) run(ctx context.Context, id string, job models.ExportJob) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, id)
+		s.mu.Unlock()
+	}()
+
+	output, err := s.writeFiles(ctx, id, job)
+	if ctx.Err() != nil {
+		os.RemoveAll(s.jobDir(id))
+		return
+	}
+	if err != nil {
+		log.Printf("Export %s failed: %v", id, err)
+		os.RemoveAll(s.jobDir(id))
+		if err := s.repo.FailExportJob(id, err.Error()); err != nil {
+			log.Printf("Failed to record failure of export %s: %v", id, err)
+		}
+		return
+	}
+
+	if err := s.repo.CompleteExportJob(id, output); err != nil {
+		log.Printf("Failed to record completion of export %s: %v", id, err)
+		return
+	}
+	log.Printf("Export %s completed with %d files", id, len(output))
+}
+
+// writeFiles writes one file per resource type, leaving out types with no
+// resources to export.
+func (s *ExportService) writeFiles(ctx context.Context, id string, job models.ExportJob) ([]models.ExportFile, error) {
+	dir := s.jobDir(id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	output := []models.ExportFile{}
+	for _, resourceType := range job.Types {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		name := resourceType + ".ndjson"
+		count, err := s.writeFile(filepath.Join(dir, name), resourceType, job.Since)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", resourceType, err)
+		}
+		if count == 0 {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		output = append(output, models.ExportFile{Type: resourceType, Name: name, Count: count})
+	}
+
+	return output, nil
+}
+
+func (s *ExportService) writeFile(path string, resourceType string, since *time.Time) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := s.exporter.ExportResources(resourceType, since, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return count, err
+}
+
+func (s *ExportService) jobDir(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *ExportService) GetExportJob(id string) (*models.ExportJob, error) {
+	return s.repo.GetExportJob(id)
+}
+
+// ExportFilePath returns where the file name of a completed export is
+// stored, or sql.ErrNoRows when the export has no such file.
+func (s *ExportService) ExportFilePath(id string, name string) (string, error) {
+	job, err := s.repo.GetExportJob(id)
+	if err != nil {
+		return "", err
+	}
+
+	found := slices.ContainsFunc(job.Output, func(f models.ExportFile) bool { return f.Name == name })
+	if job.Status != models.ExportStatusCompleted || !found {
+		return "", sql.ErrNoRows
+	}
+	return filepath.Join(s.jobDir(id), name), nil
+}
+
+// DeleteExport cancels the export if it is still running and removes it
+// together with its files.
+func (s *ExportService) DeleteExport(id string) error {
+	if _, err := s.repo.GetExportJob(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if cancel, ok := s.running[id]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+
+	if err := s.repo.DeleteExportJob(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(s.jobDir(id))
+}
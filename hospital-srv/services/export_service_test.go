@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeExporter writes count[resourceType] lines for each type, failing for
+// the types in fail.
+type fakeExporter struct {
+	count map[string]int
+	fail  map[string]bool
+}
+
+func (e fakeExporter) ExportResources(resourceType string, since *time.Time, w io.Writer) (int, error) {
+	if e.fail[resourceType] {
+		return 0, errors.New("database unavailable")
+	}
+	for i := 0; i < e.count[resourceType]; i++ {
+		fmt.Fprintf(w, "{\"resourceType\":%q}\n", resourceType)
+	}
+	return e.count[resourceType], nil
+}
+
+func TestWriteFiles(t *testing.T) {
+	s := NewExportService(nil, fakeExporter{count: map[string]int{"Patient": 2, "Encounter": 3}}, t.TempDir())
+	job := models.ExportJob{Types: []string{"Patient", "Practitioner", "Encounter"}}
+
+	output, err := s.writeFiles(context.Background(), "job1", job)
+	if err != nil {
+		t.Fatalf("writeFiles() = %v", err)
+	}
+
+	want := []models.ExportFile{
+		{Type: "Patient", Name: "Patient.ndjson", Count: 2},
+		{Type: "Encounter", Name: "Encounter.ndjson", Count: 3},
+	}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("writeFiles() = %+v, want %+v", output, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.jobDir("job1"), "Practitioner.ndjson")); !os.IsNotExist(err) {
+		t.Errorf("file of an empty type: %v, want it removed", err)
+	}
+	data, err := os.ReadFile(filepath.Join(s.jobDir("job1"), "Encounter.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "{\"resourceType\":\"Encounter\"}\n{\"resourceType\":\"Encounter\"}\n{\"resourceType\":\"Encounter\"}\n" {
+		t.Errorf("Encounter.ndjson = %q", got)
+	}
+}
+
+func TestWriteFilesFailure(t *testing.T) {
+	s := NewExportService(nil, fakeExporter{fail: map[string]bool{"Practitioner": true}}, t.TempDir())
+	job := models.ExportJob{Types: []string{"Patient", "Practitioner", "Encounter"}}
+
+	if _, err := s.writeFiles(context.Background(), "job1", job); err == nil {
+		t.Error("writeFiles() = nil, want the exporter's error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.writeFiles(ctx, "job2", job); !errors.Is(err, context.Canceled) {
+		t.Errorf("writeFiles() of a cancelled export = %v, want %v", err, context.Canceled)
+	}
+}
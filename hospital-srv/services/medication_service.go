@@ -0,0 +1,235 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrUnknownMedication is returned for a prescription of a medication
+	// missing from the local medication dictionary.
+	ErrUnknownMedication = errors.New("unknown medication")
+
+	// ErrInvalidPrescriptionTransition is returned for a prescription status
+	// change the workflow does not allow, e.g. restarting a stopped one.
+	ErrInvalidPrescriptionTransition = errors.New("prescription status change not allowed")
+
+	// ErrInvalidMedicationRequest is returned for a prescription whose
+	// references do not fit together, e.g. one made in an encounter of
+	// another patient.
+	ErrInvalidMedicationRequest = errors.New("invalid medication request")
+)
+
+// prescriptionTransitions lists, per status, the statuses a prescription may
+// move to next. Stopped and completed prescriptions are final.
+var prescriptionTransitions = map[string][]string{
+	models.MedicationRequestStatusActive: {models.MedicationRequestStatusActive, models.MedicationRequestStatusStopped, models.MedicationRequestStatusCompleted},
+}
+
+func checkPrescriptionTransition(from string, to string) error {
+	if !slices.Contains(prescriptionTransitions[from], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidPrescriptionTransition, from, to)
+	}
+	return nil
+}
+
+const (
+	PrescriptionEventCreated = "created"
+	PrescriptionEventUpdated = "updated"
+)
+
+// PharmacyNotifier queues orders for the pharmacy with the event that
+// caused them. It is called with the repository of the transaction changing
+// the prescription, so the order is stored if and only if the change is
+// committed.
+type PharmacyNotifier interface {
+	EnqueuePrescription(tx *repository.Repository, eventType string, request models.MedicationRequest, patient models.Patient, requester models.Practitioner) error
+}
+
+// MedicationService manages prescriptions and the medication dictionary they
+// are made from.
+type MedicationService struct {
+	repo     *repository.Repository
+	pharmacy PharmacyNotifier
+}
+
+func NewMedicationService(repo *repository.Repository, pharmacy PharmacyNotifier) *MedicationService {
+	return &MedicationService{
+		repo:     repo,
+		pharmacy: pharmacy,
+	}
+}
+
+// CreateMedicationRequest records a new active prescription, or returns
+// repository.ErrConflictingPrescription when the patient already has an
+// active prescription for the same drug.
+func (s *MedicationService) CreateMedicationRequest(request models.MedicationRequest) (string, error) {
+	if request.Status != models.MedicationRequestStatusActive {
+		return "", fmt.Errorf("%w: a new prescription must be active, not %s", ErrInvalidPrescriptionTransition, request.Status)
+	}
+
+	var id string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkMedicationRequest(tx, &request); err != nil {
+			return err
+		}
+
+		var err error
+		id, err = tx.CreateMedicationRequest(request)
+		if err != nil {
+			return err
+		}
+
+		return s.enqueuePharmacyOrder(tx, PrescriptionEventCreated, id)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// UpdateMedicationRequest changes the dosage, note or status of a
+// prescription. The status must follow prescriptionTransitions. If
+// expectedVersion is non-zero it must match the stored version.
+func (s *MedicationService) UpdateMedicationRequest(request models.MedicationRequest, expectedVersion int) error {
+	return s.repo.WithTx(func(tx *repository.Repository) error {
+		current, err := tx.GetMedicationRequestByID(request.ID)
+		if err != nil {
+			return err
+		}
+
+		if request.PatientID != current.PatientID || request.Medication.Code != current.Medication.Code {
+			return fmt.Errorf("%w: the patient and medication of a prescription cannot change", ErrInvalidMedicationRequest)
+		}
+
+		if err := checkPrescriptionTransition(current.Status, request.Status); err != nil {
+			return err
+		}
+
+		if err := tx.UpdateMedicationRequest(request, expectedVersion); err != nil {
+			return err
+		}
+
+		return s.enqueuePharmacyOrder(tx, PrescriptionEventUpdated, request.ID)
+	})
+}
+
+func checkMedicationRequest(tx *repository.Repository, request *models.MedicationRequest) error {
+	if _, err := tx.GetPatientByID(request.PatientID); err != nil {
+		return referenceError("Patient", request.PatientID, err)
+	}
+
+	if request.EncounterID != nil {
+		encounter, err := tx.GetEncounterByID(*request.EncounterID)
+		if err != nil {
+			return referenceError("Encounter", *request.EncounterID, err)
+		}
+		if encounter.PatientID != request.PatientID {
+			return fmt.Errorf("%w: Encounter/%s belongs to another patient", ErrInvalidMedicationRequest, encounter.ID)
+		}
+	}
+
+	if _, err := tx.GetPractitionerByID(request.RequesterID); err != nil {
+		return referenceError("Practitioner", request.RequesterID, err)
+	}
+
+	medication, err := tx.GetMedication(request.Medication.Code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrUnknownMedication, request.Medication.Code)
+		}
+		return err
+	}
+	request.Medication = *medication
+
+	return nil
+}
+
+// enqueuePharmacyOrder queues the prescription as saved by tx for the
+// pharmacy.
+func (s *MedicationService) enqueuePharmacyOrder(tx *repository.Repository, eventType string, id string) error {
+	request, err := tx.GetMedicationRequestByID(id)
+	if err != nil {
+		return err
+	}
+	patient, err := tx.GetPatientByID(request.PatientID)
+	if err != nil {
+		return err
+	}
+	requester, err := tx.GetPractitionerByID(request.RequesterID)
+	if err != nil {
+		return err
+	}
+
+	return s.pharmacy.EnqueuePrescription(tx, eventType, *request, *patient, *requester)
+}
+
+func (s *MedicationService) GetMedicationRequestByID(id string) (*models.MedicationRequest, error) {
+	return s.repo.GetMedicationRequestByID(id)
+}
+
+func (s *MedicationService) SearchMedicationRequests(filter models.MedicationRequestFilter) ([]models.MedicationRequest, error) {
+	return s.repo.SearchMedicationRequests(filter)
+}
+
+func (s *MedicationService) GetMedicationRequestHistory(id string) ([]models.MedicationRequest, error) {
+	return s.repo.GetMedicationRequestHistory(id)
+}
+
+func (s *MedicationService) GetMedicationRequestVersion(id string, versionID int) (*models.MedicationRequest, error) {
+	return s.repo.GetMedicationRequestVersion(id, versionID)
+}
+
+// SearchMedications looks up medications by code, ATC code or name.
+func (s *MedicationService) SearchMedications(text string, limit int) ([]models.Medication, error) {
+	return s.repo.SearchMedications(text, limit)
+}
+
+// LoadMedications loads the medication dictionary from a CSV file of
+// code,display,atc_code,form,strength rows, adding new medications and
+// updating known ones. Lines starting with # are ignored. It returns the
+// number of medications read.
+func (s *MedicationService) LoadMedications(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 5
+
+	var medications []models.Medication
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		medications = append(medications, models.Medication{
+			Code:     strings.ToUpper(strings.TrimSpace(record[0])),
+			Display:  strings.TrimSpace(record[1]),
+			ATCCode:  strings.ToUpper(strings.TrimSpace(record[2])),
+			Form:     strings.TrimSpace(record[3]),
+			Strength: strings.TrimSpace(record[4]),
+		})
+	}
+
+	if err := s.repo.UpsertMedications(medications); err != nil {
+		return 0, err
+	}
+	return len(medications), nil
+}
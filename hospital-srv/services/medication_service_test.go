@@ -0,0 +1,29 @@
+package services
+
+import (
+	"errors"
+	"hospital-srv/models"
+	"testing"
+)
+
+func TestCheckPrescriptionTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want error
+	}{
+		{models.MedicationRequestStatusActive, models.MedicationRequestStatusActive, nil},
+		{models.MedicationRequestStatusActive, models.MedicationRequestStatusStopped, nil},
+		{models.MedicationRequestStatusActive, models.MedicationRequestStatusCompleted, nil},
+		{models.MedicationRequestStatusStopped, models.MedicationRequestStatusActive, ErrInvalidPrescriptionTransition},
+		{models.MedicationRequestStatusStopped, models.MedicationRequestStatusStopped, ErrInvalidPrescriptionTransition},
+		{models.MedicationRequestStatusCompleted, models.MedicationRequestStatusActive, ErrInvalidPrescriptionTransition},
+		{models.MedicationRequestStatusActive, "on-hold", ErrInvalidPrescriptionTransition},
+	}
+
+	for _, tt := range tests {
+		if err := checkPrescriptionTransition(tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("checkPrescriptionTransition(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+}
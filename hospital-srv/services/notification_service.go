@@ -0,0 +1,50 @@
+package services
+
+import (
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"time"
+)
+
+const (
+	EventEncounterCreated       = "encounter_created"
+	EventEncounterStatusUpdated = "encounter_status_updated"
+	EventEncounterUpdated       = "encounter_updated"
+)
+
+// EncounterNotifier queues subscriber notifications for an encounter change.
+// It is called with the repository of the transaction making the change, so
+// the notifications are stored if and only if the change is committed.
+type EncounterNotifier interface {
+	EnqueueEncounterEvent(tx *repository.Repository, eventType string, encounter models.EncounterWithDetails) error
+}
+
+type NotificationService struct {
+	repo *repository.Repository
+}
+
+func NewNotificationService(repo *repository.Repository) *NotificationService {
+	return &NotificationService{
+		repo: repo,
+	}
+}
+
+func (s *NotificationService) ClaimDueNotifications(limit int, lease time.Duration) ([]models.Notification, error) {
+	return s.repo.ClaimDueNotifications(limit, lease)
+}
+
+func (s *NotificationService) MarkNotificationDelivered(id string) error {
+	return s.repo.MarkNotificationDelivered(id)
+}
+
+func (s *NotificationService) MarkNotificationFailed(id string, deliveryError string, nextAttempt *time.Time) error {
+	return s.repo.MarkNotificationFailed(id, deliveryError, nextAttempt)
+}
+
+func (s *NotificationService) GetFailedNotifications() ([]models.Notification, error) {
+	return s.repo.GetNotificationsByStatus(models.NotificationStatusDead)
+}
+
+func (s *NotificationService) ResendNotifications(ids []string) (int64, error) {
+	return s.repo.ResendNotifications(ids)
+}
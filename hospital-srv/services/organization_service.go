@@ -0,0 +1,244 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"hospital-srv/websocket"
+)
+
+var (
+	// ErrInvalidOrganization is returned for an organization that would be
+	// part of itself.
+	ErrInvalidOrganization = errors.New("invalid organization")
+
+	// ErrInvalidLocation is returned for a location that would be part of
+	// itself or of a bed.
+	ErrInvalidLocation = errors.New("invalid location")
+
+	// ErrInactiveLocation is returned when an encounter is placed in a
+	// location that is suspended or no longer in use.
+	ErrInactiveLocation = errors.New("location is not active")
+)
+
+type OrganizationService struct {
+	repo *repository.Repository
+	hub  *websocket.Hub
+}
+
+func NewOrganizationService(repo *repository.Repository, hub *websocket.Hub) *OrganizationService {
+	return &OrganizationService{
+		repo: repo,
+		hub:  hub,
+	}
+}
+
+func (s *OrganizationService) CreateOrganization(o models.Organization) (string, error) {
+	var id string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkOrganizationParent(tx, o); err != nil {
+			return err
+		}
+
+		var err error
+		id, err = tx.CreateOrganization(o)
+		return err
+	})
+	return id, err
+}
+
+func (s *OrganizationService) UpdateOrganization(o models.Organization, expectedVersion int) error {
+	return s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkOrganizationParent(tx, o); err != nil {
+			return err
+		}
+		return tx.UpdateOrganization(o, expectedVersion)
+	})
+}
+
+// checkOrganizationParent returns ErrReferenceNotFound for an unknown
+// parent organization and ErrInvalidOrganization when o would end up part
+// of itself.
+func checkOrganizationParent(tx *repository.Repository, o models.Organization) error {
+	if o.PartOf == nil {
+		return nil
+	}
+	if _, err := tx.GetOrganizationByID(*o.PartOf); err != nil {
+		return referenceError("Organization", *o.PartOf, err)
+	}
+	if o.ID == "" {
+		return nil
+	}
+
+	cycle, err := tx.IsOrganizationAncestor(o.ID, *o.PartOf)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return fmt.Errorf("%w: an organization cannot be part of itself", ErrInvalidOrganization)
+	}
+	return nil
+}
+
+func (s *OrganizationService) GetOrganizationByID(id string) (*models.Organization, error) {
+	return s.repo.GetOrganizationByID(id)
+}
+
+func (s *OrganizationService) SearchOrganizations(filter models.OrganizationFilter) ([]models.Organization, error) {
+	return s.repo.SearchOrganizations(filter)
+}
+
+func (s *OrganizationService) GetOrganizationHistory(id string) ([]models.Organization, error) {
+	return s.repo.GetOrganizationHistory(id)
+}
+
+func (s *OrganizationService) GetOrganizationVersion(id string, versionID int) (*models.Organization, error) {
+	return s.repo.GetOrganizationVersion(id, versionID)
+}
+
+// CreateLocation saves l. A new bed is free.
+func (s *OrganizationService) CreateLocation(l models.Location) (string, error) {
+	l.BedStatus = nil
+	if l.PhysicalType == models.LocationTypeBed {
+		free := models.BedStatusFree
+		l.BedStatus = &free
+	}
+
+	var id string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkLocationReferences(tx, l); err != nil {
+			return err
+		}
+
+		var err error
+		id, err = tx.CreateLocation(l)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if l.BedStatus != nil {
+		broadcastBeds(s.repo, s.hub, []string{id})
+	}
+	return id, nil
+}
+
+// UpdateLocation saves l, keeping the status of a bed. A location other
+// locations are part of cannot become a bed, and an occupied bed must stay
+// an active bed.
+func (s *OrganizationService) UpdateLocation(l models.Location, expectedVersion int) error {
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		current, err := tx.GetLocationForUpdate(l.ID)
+		if err != nil {
+			return err
+		}
+
+		l.BedStatus = current.BedStatus
+		if current.BedStatus != nil && *current.BedStatus == models.BedStatusOccupied &&
+			(l.PhysicalType != models.LocationTypeBed || l.Status != models.LocationStatusActive) {
+			return fmt.Errorf("%w: an occupied bed must stay an active bed", ErrInvalidLocation)
+		}
+		if l.PhysicalType != models.LocationTypeBed {
+			l.BedStatus = nil
+		} else if l.BedStatus == nil {
+			free := models.BedStatusFree
+			l.BedStatus = &free
+		}
+
+		if err := checkLocationReferences(tx, l); err != nil {
+			return err
+		}
+
+		if l.PhysicalType == models.LocationTypeBed {
+			children, err := tx.SearchLocations(models.LocationFilter{PartOf: l.ID})
+			if err != nil {
+				return err
+			}
+			if len(children) > 0 {
+				return fmt.Errorf("%w: a location with locations inside it cannot be a bed", ErrInvalidLocation)
+			}
+		}
+
+		return tx.UpdateLocation(l, expectedVersion)
+	})
+	if err != nil {
+		return err
+	}
+
+	if l.BedStatus != nil {
+		broadcastBeds(s.repo, s.hub, []string{l.ID})
+	}
+	return nil
+}
+
+// checkLocationReferences returns ErrReferenceNotFound for an unknown
+// managing organization or parent location, and ErrInvalidLocation when l
+// would be part of a bed or of itself.
+func checkLocationReferences(tx *repository.Repository, l models.Location) error {
+	if l.OrganizationID != nil {
+		if _, err := tx.GetOrganizationByID(*l.OrganizationID); err != nil {
+			return referenceError("Organization", *l.OrganizationID, err)
+		}
+	}
+
+	if l.PartOf == nil {
+		return nil
+	}
+
+	parent, err := tx.GetLocationByID(*l.PartOf)
+	if err != nil {
+		return referenceError("Location", *l.PartOf, err)
+	}
+	if parent.PhysicalType == models.LocationTypeBed {
+		return fmt.Errorf("%w: a location cannot be part of a bed", ErrInvalidLocation)
+	}
+	if l.ID == "" {
+		return nil
+	}
+
+	cycle, err := tx.IsLocationAncestor(l.ID, *l.PartOf)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return fmt.Errorf("%w: a location cannot be part of itself", ErrInvalidLocation)
+	}
+	return nil
+}
+
+// checkActiveLocation returns ErrReferenceNotFound for an unknown location
+// and ErrInactiveLocation for one that is not in active use.
+func checkActiveLocation(tx *repository.Repository, id string) error {
+	location, err := tx.GetLocationByID(id)
+	if err != nil {
+		return referenceError("Location", id, err)
+	}
+	if location.Status != models.LocationStatusActive {
+		return fmt.Errorf("%w: Location/%s is %s", ErrInactiveLocation, id, location.Status)
+	}
+	return nil
+}
+
+func (s *OrganizationService) GetLocationByID(id string) (*models.Location, error) {
+	return s.repo.GetLocationByID(id)
+}
+
+func (s *OrganizationService) SearchLocations(filter models.LocationFilter) ([]models.Location, error) {
+	return s.repo.SearchLocations(filter)
+}
+
+func (s *OrganizationService) GetLocationHistory(id string) ([]models.Location, error) {
+	return s.repo.GetLocationHistory(id)
+}
+
+func (s *OrganizationService) GetLocationVersion(id string, versionID int) (*models.Location, error) {
+	return s.repo.GetLocationVersion(id, versionID)
+}
+
+// GetDepartmentOccupancy returns, for each active department, its staff,
+// beds and the patients currently in it.
+func (s *OrganizationService) GetDepartmentOccupancy() ([]models.DepartmentOccupancy, error) {
+	return s.repo.GetDepartmentOccupancy()
+}
@@ -38,10 +38,26 @@ func (s *PatientService) GetAllPatients() ([]models.Patient, error) {
 	return s.repo.GetAllPatients()
 }
 
+func (s *PatientService) SearchPatients(filter models.PatientFilter) ([]models.Patient, error) {
+	return s.repo.SearchPatients(filter)
+}
+
+func (s *PatientService) FindPatientByDemographics(firstName string, lastName string, dateOfBirth string) (*models.Patient, error) {
+	return s.repo.FindPatientByDemographics(firstName, lastName, dateOfBirth)
+}
+
 func (s *PatientService) GetPatientByID(id string) (*models.Patient, error) {
 	return s.repo.GetPatientByID(id)
 }
 
+func (s *PatientService) GetPatientHistory(id string) ([]models.Patient, error) {
+	return s.repo.GetPatientHistory(id)
+}
+
+func (s *PatientService) GetPatientVersion(id string, versionID int) (*models.Patient, error) {
+	return s.repo.GetPatientVersion(id, versionID)
+}
+
 func (s *PatientService) DeletePatient(id string) error {
 	if err := s.repo.DeletePatient(id); err != nil {
 		return err
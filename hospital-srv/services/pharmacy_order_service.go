@@ -0,0 +1,31 @@
+package services
+
+import (
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"time"
+)
+
+// PharmacyOrderService gives the pharmacy interface access to the orders
+// queued in the pharmacy outbox.
+type PharmacyOrderService struct {
+	repo *repository.Repository
+}
+
+func NewPharmacyOrderService(repo *repository.Repository) *PharmacyOrderService {
+	return &PharmacyOrderService{
+		repo: repo,
+	}
+}
+
+func (s *PharmacyOrderService) ClaimDuePharmacyOrders(limit int, lease time.Duration) ([]models.PharmacyOrder, error) {
+	return s.repo.ClaimDuePharmacyOrders(limit, lease)
+}
+
+func (s *PharmacyOrderService) MarkPharmacyOrderSent(id string) error {
+	return s.repo.MarkPharmacyOrderSent(id)
+}
+
+func (s *PharmacyOrderService) MarkPharmacyOrderFailed(id string, sendError string, nextAttempt *time.Time) error {
+	return s.repo.MarkPharmacyOrderFailed(id, sendError, nextAttempt)
+}
@@ -1,10 +1,23 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"hospital-srv/models"
 	"hospital-srv/repository"
 )
 
+var (
+	// ErrInactivePractitioner is returned when new work is assigned to a
+	// practitioner who has been deactivated.
+	ErrInactivePractitioner = errors.New("practitioner is inactive")
+
+	// ErrInvalidPractitionerRole is returned for a role change that would
+	// move the role to another practitioner, or for an active role in an
+	// inactive department.
+	ErrInvalidPractitionerRole = errors.New("invalid practitioner role")
+)
+
 type PractitionerService struct {
 	repo *repository.Repository
 }
@@ -15,14 +28,159 @@ func NewPractitionerService(repo *repository.Repository) *PractitionerService {
 	}
 }
 
-func (s *PractitionerService) GetAllPractitioners() ([]models.Practitioner, error) {
-	return s.repo.GetAllPractitioners()
+func (s *PractitionerService) SearchPractitioners(filter models.PractitionerFilter) ([]models.Practitioner, error) {
+	return s.repo.SearchPractitioners(filter)
 }
 
 func (s *PractitionerService) GetPractitionerByID(id string) (*models.Practitioner, error) {
 	return s.repo.GetPractitionerByID(id)
 }
 
+func (s *PractitionerService) FindPractitionerByName(firstName string, lastName string, specialization string) (*models.Practitioner, error) {
+	return s.repo.FindPractitionerByName(firstName, lastName, specialization)
+}
+
 func (s *PractitionerService) CreatePractitioner(p models.Practitioner) (string, error) {
 	return s.repo.CreatePractitioner(p)
 }
+
+// UpdatePractitioner saves p. Deactivating a practitioner also deactivates
+// their roles; their encounters are kept.
+func (s *PractitionerService) UpdatePractitioner(p models.Practitioner, expectedVersion int) error {
+	return s.repo.WithTx(func(tx *repository.Repository) error {
+		return updatePractitioner(tx, p, expectedVersion)
+	})
+}
+
+func updatePractitioner(tx *repository.Repository, p models.Practitioner, expectedVersion int) error {
+	if err := tx.UpdatePractitioner(p, expectedVersion); err != nil {
+		return err
+	}
+	if p.Active {
+		return nil
+	}
+
+	active := true
+	roles, err := tx.SearchPractitionerRoles(models.PractitionerRoleFilter{PractitionerID: p.ID, Active: &active})
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		role.Active = false
+		if err := tx.UpdatePractitionerRole(role, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkActivePractitioner returns ErrReferenceNotFound for an unknown
+// practitioner and ErrInactivePractitioner for a deactivated one.
+func checkActivePractitioner(tx *repository.Repository, id string) error {
+	practitioner, err := tx.GetPractitionerByID(id)
+	if err != nil {
+		return referenceError("Practitioner", id, err)
+	}
+	if !practitioner.Active {
+		return fmt.Errorf("%w: Practitioner/%s", ErrInactivePractitioner, id)
+	}
+	return nil
+}
+
+func (s *PractitionerService) GetPractitionerHistory(id string) ([]models.Practitioner, error) {
+	return s.repo.GetPractitionerHistory(id)
+}
+
+func (s *PractitionerService) GetPractitionerVersion(id string, versionID int) (*models.Practitioner, error) {
+	return s.repo.GetPractitionerVersion(id, versionID)
+}
+
+// CreatePractitionerRole records a role. Only an active practitioner can
+// take on an active role, and only in an active department.
+func (s *PractitionerService) CreatePractitionerRole(role models.PractitionerRole) (string, error) {
+	var id string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		if err := checkRolePractitioner(tx, role); err != nil {
+			return err
+		}
+		if err := checkRoleDepartment(tx, role); err != nil {
+			return err
+		}
+
+		var err error
+		id, err = tx.CreatePractitionerRole(role)
+		return err
+	})
+	return id, err
+}
+
+// UpdatePractitionerRole changes a role. The practitioner holding it cannot
+// change, and it can only be reactivated while the practitioner is active.
+func (s *PractitionerService) UpdatePractitionerRole(role models.PractitionerRole, expectedVersion int) error {
+	return s.repo.WithTx(func(tx *repository.Repository) error {
+		current, err := tx.GetPractitionerRoleByID(role.ID)
+		if err != nil {
+			return err
+		}
+		if role.PractitionerID != current.PractitionerID {
+			return fmt.Errorf("%w: the practitioner of a role cannot change", ErrInvalidPractitionerRole)
+		}
+
+		if err := checkRolePractitioner(tx, role); err != nil {
+			return err
+		}
+		if err := checkRoleDepartment(tx, role); err != nil {
+			return err
+		}
+
+		return tx.UpdatePractitionerRole(role, expectedVersion)
+	})
+}
+
+func checkRolePractitioner(tx *repository.Repository, role models.PractitionerRole) error {
+	if role.Active {
+		return checkActivePractitioner(tx, role.PractitionerID)
+	}
+	if _, err := tx.GetPractitionerByID(role.PractitionerID); err != nil {
+		return referenceError("Practitioner", role.PractitionerID, err)
+	}
+	return nil
+}
+
+// checkRoleDepartment returns ErrReferenceNotFound for an unknown department
+// or location of a role, and ErrInvalidPractitionerRole for an active role in
+// a department that is no longer active.
+func checkRoleDepartment(tx *repository.Repository, role models.PractitionerRole) error {
+	if role.OrganizationID != nil {
+		department, err := tx.GetOrganizationByID(*role.OrganizationID)
+		if err != nil {
+			return referenceError("Organization", *role.OrganizationID, err)
+		}
+		if role.Active && !department.Active {
+			return fmt.Errorf("%w: Organization/%s is inactive", ErrInvalidPractitionerRole, department.ID)
+		}
+	}
+
+	for _, locationID := range role.LocationIDs {
+		if _, err := tx.GetLocationByID(locationID); err != nil {
+			return referenceError("Location", locationID, err)
+		}
+	}
+	return nil
+}
+
+func (s *PractitionerService) GetPractitionerRoleByID(id string) (*models.PractitionerRole, error) {
+	return s.repo.GetPractitionerRoleByID(id)
+}
+
+func (s *PractitionerService) SearchPractitionerRoles(filter models.PractitionerRoleFilter) ([]models.PractitionerRole, error) {
+	return s.repo.SearchPractitionerRoles(filter)
+}
+
+func (s *PractitionerService) GetPractitionerRoleHistory(id string) ([]models.PractitionerRole, error) {
+	return s.repo.GetPractitionerRoleHistory(id)
+}
+
+func (s *PractitionerService) GetPractitionerRoleVersion(id string, versionID int) (*models.PractitionerRole, error) {
+	return s.repo.GetPractitionerRoleVersion(id, versionID)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"hospital-srv/websocket"
+	"slices"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrReferenceNotFound is returned when a resource refers to a schedule,
+	// slot, patient or practitioner that does not exist.
+	ErrReferenceNotFound = errors.New("referenced resource not found")
+
+	// ErrInvalidSlot is returned for a slot that is empty or lies outside
+	// its schedule's planning horizon.
+	ErrInvalidSlot = errors.New("invalid slot")
+
+	// ErrSlotUnavailable is returned when booking a slot that is not free.
+	ErrSlotUnavailable = errors.New("slot is not available")
+
+	// ErrInvalidAppointmentTransition is returned for a status change the
+	// appointment workflow does not allow, e.g. cancelling a fulfilled visit.
+	ErrInvalidAppointmentTransition = errors.New("appointment status change not allowed")
+)
+
+// appointmentTransitions lists, per status, the statuses an appointment may
+// move to next.
+var appointmentTransitions = map[string][]string{
+	models.AppointmentStatusBooked:  {models.AppointmentStatusArrived, models.AppointmentStatusCancelled, models.AppointmentStatusNoShow},
+	models.AppointmentStatusArrived: {models.AppointmentStatusFulfilled},
+}
+
+func checkAppointmentTransition(from string, to string) error {
+	if !slices.Contains(appointmentTransitions[from], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidAppointmentTransition, from, to)
+	}
+	return nil
+}
+
+// SchedulingService manages practitioner schedules, their bookable slots
+// and the appointments booked into them.
+type SchedulingService struct {
+	repo     *repository.Repository
+	hub      *websocket.Hub
+	notifier EncounterNotifier
+}
+
+func NewSchedulingService(repo *repository.Repository, hub *websocket.Hub, notifier EncounterNotifier) *SchedulingService {
+	return &SchedulingService{
+		repo:     repo,
+		hub:      hub,
+		notifier: notifier,
+	}
+}
+
+func referenceError(resourceType string, id string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s/%s", ErrReferenceNotFound, resourceType, id)
+	}
+	return err
+}
+
+func (s *SchedulingService) CreateSchedule(schedule models.Schedule) (string, error) {
+	if err := checkActivePractitioner(s.repo, schedule.PractitionerID); err != nil {
+		return "", err
+	}
+	return s.repo.CreateSchedule(schedule)
+}
+
+func (s *SchedulingService) GetScheduleByID(id string) (*models.Schedule, error) {
+	return s.repo.GetScheduleByID(id)
+}
+
+func (s *SchedulingService) SearchSchedules(filter models.ScheduleFilter) ([]models.Schedule, error) {
+	return s.repo.SearchSchedules(filter)
+}
+
+// CreateSlot adds a slot to a schedule. Slots of one practitioner never
+// overlap, even across schedules; repository.ErrSlotOverlap is returned
+// otherwise.
+func (s *SchedulingService) CreateSlot(slot models.Slot) (string, error) {
+	if !slot.EndTime.After(slot.StartTime) {
+		return "", fmt.Errorf("%w: end must be after start", ErrInvalidSlot)
+	}
+
+	schedule, err := s.repo.GetScheduleByID(slot.ScheduleID)
+	if err != nil {
+		return "", referenceError("Schedule", slot.ScheduleID, err)
+	}
+	if schedule.PlanningStart != nil && slot.StartTime.Before(*schedule.PlanningStart) ||
+		schedule.PlanningEnd != nil && slot.EndTime.After(*schedule.PlanningEnd) {
+		return "", fmt.Errorf("%w: outside the schedule planning horizon", ErrInvalidSlot)
+	}
+
+	return s.repo.CreateSlot(slot)
+}
+
+func (s *SchedulingService) GetSlotByID(id string) (*models.Slot, error) {
+	return s.repo.GetSlotByID(id)
+}
+
+func (s *SchedulingService) SearchSlots(filter models.SlotFilter) ([]models.Slot, error) {
+	return s.repo.SearchSlots(filter)
+}
+
+// BookAppointment books the slot for the patient. The slot and its
+// practitioner are locked for the duration of the booking and the slot is
+// marked busy, so neither two bookings of the same slot nor overlapping
+// bookings of the same practitioner can both succeed; ErrSlotUnavailable is
+// returned to the loser. It is also returned when the practitioner has an
+// encounter during the slot.
+func (s *SchedulingService) BookAppointment(appointment models.Appointment) (string, error) {
+	var id string
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		slot, err := tx.GetSlotForUpdate(appointment.SlotID)
+		if err != nil {
+			return referenceError("Slot", appointment.SlotID, err)
+		}
+		if slot.Status != models.SlotStatusFree {
+			return ErrSlotUnavailable
+		}
+
+		schedule, err := tx.GetScheduleByID(slot.ScheduleID)
+		if err != nil {
+			return err
+		}
+		if !schedule.Active {
+			return ErrSlotUnavailable
+		}
+		if err := checkActivePractitioner(tx, schedule.PractitionerID); err != nil {
+			return err
+		}
+
+		if err := tx.LockPractitioner(schedule.PractitionerID); err != nil {
+			return err
+		}
+		overlap, err := tx.HasOverlappingAppointment(schedule.PractitionerID, slot.StartTime, slot.EndTime)
+		if err != nil {
+			return err
+		}
+		if !overlap {
+			overlap, err = tx.HasOverlappingEncounter(schedule.PractitionerID, slot.StartTime, slot.EndTime, defaultVisitLength)
+			if err != nil {
+				return err
+			}
+		}
+		if overlap {
+			return ErrSlotUnavailable
+		}
+
+		if _, err := tx.GetPatientByID(appointment.PatientID); err != nil {
+			return referenceError("Patient", appointment.PatientID, err)
+		}
+
+		appointment.PractitionerID = schedule.PractitionerID
+		appointment.StartTime = slot.StartTime
+		appointment.EndTime = slot.EndTime
+		appointment.Status = models.AppointmentStatusBooked
+
+		id, err = tx.CreateAppointment(appointment)
+		if err != nil {
+			return err
+		}
+
+		return tx.SetSlotStatus(slot.ID, models.SlotStatusBusy)
+	})
+
+	// The unique index on active appointments per slot backs up the row lock.
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return "", ErrSlotUnavailable
+	}
+
+	return id, err
+}
+
+func (s *SchedulingService) GetAppointmentByID(id string) (*models.Appointment, error) {
+	return s.repo.GetAppointmentByID(id)
+}
+
+func (s *SchedulingService) SearchAppointments(filter models.AppointmentFilter) ([]models.Appointment, error) {
+	return s.repo.SearchAppointments(filter)
+}
+
+// UpdateAppointmentStatus moves the appointment along its workflow.
+// Arrival creates the encounter for the visit, whose id is returned;
+// cancelling frees the slot for another booking.
+func (s *SchedulingService) UpdateAppointmentStatus(id string, status string, actor string) (string, error) {
+	var encounter *models.EncounterWithDetails
+	err := s.repo.WithTx(func(tx *repository.Repository) error {
+		appointment, err := tx.GetAppointmentForUpdate(id)
+		if err != nil {
+			return err
+		}
+
+		if appointment.Status == status {
+			return nil
+		}
+		if err := checkAppointmentTransition(appointment.Status, status); err != nil {
+			return err
+		}
+
+		if err := tx.SetAppointmentStatus(id, status); err != nil {
+			return err
+		}
+
+		switch status {
+		case models.AppointmentStatusCancelled:
+			return tx.SetSlotStatus(appointment.SlotID, models.SlotStatusFree)
+		case models.AppointmentStatusArrived:
+			// A checked-in patient is not in a bed yet, so no bed changes.
+			encounter, _, err = createEncounter(tx, s.notifier, models.Encounter{
+				PatientID:      appointment.PatientID,
+				PractitionerID: appointment.PractitionerID,
+				Status:         models.EncounterStatusArrived,
+				Class:          models.EncounterClassAmbulatory,
+				StartTime:      appointment.StartTime,
+				AppointmentID:  &appointment.ID,
+			}, actor)
+			return err
+		}
+
+		return nil
+	})
+	if err != nil || encounter == nil {
+		return "", err
+	}
+
+	s.hub.BroadcastEncounterCreated(encounter)
+
+	return encounter.ID, nil
+}
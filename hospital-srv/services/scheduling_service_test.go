@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+	"hospital-srv/models"
+	"testing"
+)
+
+func TestCheckAppointmentTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want error
+	}{
+		{models.AppointmentStatusBooked, models.AppointmentStatusArrived, nil},
+		{models.AppointmentStatusBooked, models.AppointmentStatusCancelled, nil},
+		{models.AppointmentStatusBooked, models.AppointmentStatusNoShow, nil},
+		{models.AppointmentStatusBooked, models.AppointmentStatusFulfilled, ErrInvalidAppointmentTransition},
+		{models.AppointmentStatusArrived, models.AppointmentStatusFulfilled, nil},
+		{models.AppointmentStatusArrived, models.AppointmentStatusCancelled, ErrInvalidAppointmentTransition},
+		{models.AppointmentStatusArrived, models.AppointmentStatusBooked, ErrInvalidAppointmentTransition},
+		{models.AppointmentStatusFulfilled, models.AppointmentStatusCancelled, ErrInvalidAppointmentTransition},
+		{models.AppointmentStatusCancelled, models.AppointmentStatusBooked, ErrInvalidAppointmentTransition},
+		{models.AppointmentStatusNoShow, models.AppointmentStatusArrived, ErrInvalidAppointmentTransition},
+		{models.AppointmentStatusBooked, "unknown", ErrInvalidAppointmentTransition},
+	}
+
+	for _, tt := range tests {
+		if err := checkAppointmentTransition(tt.from, tt.to); !errors.Is(err, tt.want) {
+			t.Errorf("checkAppointmentTransition(%q, %q) = %v, want %v", tt.from, tt.to, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"hospital-srv/models"
+	"hospital-srv/repository"
+)
+
+type SubscriptionService struct {
+	repo *repository.Repository
+}
+
+func NewSubscriptionService(repo *repository.Repository) *SubscriptionService {
+	return &SubscriptionService{
+		repo: repo,
+	}
+}
+
+func (s *SubscriptionService) CreateSubscription(subscription models.Subscription) (string, error) {
+	return s.repo.CreateSubscription(subscription)
+}
+
+func (s *SubscriptionService) GetSubscriptionByID(id string) (*models.Subscription, error) {
+	return s.repo.GetSubscriptionByID(id)
+}
+
+func (s *SubscriptionService) SearchSubscriptions(filter models.SubscriptionFilter) ([]models.Subscription, error) {
+	return s.repo.SearchSubscriptions(filter)
+}
+
+func (s *SubscriptionService) GetActiveSubscriptions(resourceType string) ([]models.Subscription, error) {
+	return s.repo.GetActiveSubscriptions(resourceType)
+}
+
+func (s *SubscriptionService) SetSubscriptionError(id string, deliveryError *string) error {
+	return s.repo.SetSubscriptionError(id, deliveryError)
+}
+
+func (s *SubscriptionService) DeleteSubscription(id string) error {
+	return s.repo.DeleteSubscription(id)
+}
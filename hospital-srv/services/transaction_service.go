@@ -0,0 +1,116 @@
+package services
+
+import (
+	"hospital-srv/models"
+	"hospital-srv/repository"
+	"hospital-srv/websocket"
+)
+
+// TransactionService runs a group of reads and writes against a single
+// database transaction, as required by FHIR transaction Bundles.
+type TransactionService struct {
+	repo     *repository.Repository
+	hub      *websocket.Hub
+	notifier EncounterNotifier
+	calendar *CalendarService
+}
+
+func NewTransactionService(repo *repository.Repository, hub *websocket.Hub, notifier EncounterNotifier, calendar *CalendarService) *TransactionService {
+	return &TransactionService{
+		repo:     repo,
+		hub:      hub,
+		notifier: notifier,
+		calendar: calendar,
+	}
+}
+
+// Transaction exposes the operations allowed inside TransactionService.Run.
+type Transaction struct {
+	repo              *repository.Repository
+	notifier          EncounterNotifier
+	calendar          *CalendarService
+	actor             string
+	createdEncounters []*models.EncounterWithDetails
+	changedBeds       []string
+}
+
+// Run calls fn inside a database transaction. Nothing is committed if fn
+// returns an error; websocket broadcasts are sent only after commit. actor
+// is recorded as the author of encounter status changes.
+func (s *TransactionService) Run(actor string, fn func(tx *Transaction) error) error {
+	var created []*models.EncounterWithDetails
+	var beds []string
+	err := s.repo.WithTx(func(r *repository.Repository) error {
+		tx := &Transaction{repo: r, notifier: s.notifier, calendar: s.calendar, actor: actor}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		created = tx.createdEncounters
+		beds = tx.changedBeds
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, encounter := range created {
+		s.hub.BroadcastEncounterCreated(encounter)
+	}
+	broadcastBeds(s.repo, s.hub, beds)
+
+	return nil
+}
+
+func (t *Transaction) GetPatientByID(id string) (*models.Patient, error) {
+	return t.repo.GetPatientByID(id)
+}
+
+func (t *Transaction) GetPractitionerByID(id string) (*models.Practitioner, error) {
+	return t.repo.GetPractitionerByID(id)
+}
+
+func (t *Transaction) SearchPractitioners(filter models.PractitionerFilter) ([]models.Practitioner, error) {
+	return t.repo.SearchPractitioners(filter)
+}
+
+func (t *Transaction) CreatePractitioner(p models.Practitioner) (string, error) {
+	return t.repo.CreatePractitioner(p)
+}
+
+func (t *Transaction) UpdatePractitioner(p models.Practitioner, expectedVersion int) error {
+	return updatePractitioner(t.repo, p, expectedVersion)
+}
+
+func (t *Transaction) GetEncounterByID(id string) (*models.EncounterWithDetails, error) {
+	return t.repo.GetEncounterByID(id)
+}
+
+func (t *Transaction) SearchEncounters(filter models.EncounterFilter) ([]models.EncounterWithDetails, error) {
+	return t.repo.SearchEncounters(filter)
+}
+
+func (t *Transaction) CreateEncounter(encounter models.Encounter) (string, error) {
+	if err := checkActivePractitioner(t.repo, encounter.PractitionerID); err != nil {
+		return "", err
+	}
+	if err := t.calendar.checkWorkingHours(t.repo, encounter.PractitionerID, encounter.StartTime); err != nil {
+		return "", err
+	}
+
+	created, beds, err := createEncounter(t.repo, t.notifier, encounter, t.actor)
+	if err != nil {
+		return "", err
+	}
+	t.createdEncounters = append(t.createdEncounters, created)
+	t.changedBeds = append(t.changedBeds, beds...)
+	return created.ID, nil
+}
+
+func (t *Transaction) UpdateEncounter(encounter models.Encounter, expectedVersion int) error {
+	beds, err := updateEncounter(t.repo, t.notifier, t.calendar, encounter, expectedVersion, t.actor)
+	if err != nil {
+		return err
+	}
+	t.changedBeds = append(t.changedBeds, beds...)
+	return nil
+}
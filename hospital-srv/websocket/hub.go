@@ -9,6 +9,7 @@ const (
 	MessageTypePatientCreated   = "patient_created"
 	MessageTypePatientDeleted   = "patient_deleted"
 	MessageTypeEncounterCreated = "encounter_created"
+	MessageTypeBedUpdated       = "bed_updated"
 )
 
 type Message struct {
@@ -87,3 +88,10 @@ func (h *Hub) BroadcastEncounterCreated(encounter interface{}) {
 		Data: encounter,
 	}
 }
+
+func (h *Hub) BroadcastBedUpdated(bed interface{}) {
+	h.broadcast <- Message{
+		Type: MessageTypeBedUpdated,
+		Data: bed,
+	}
+}
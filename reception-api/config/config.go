@@ -5,38 +5,44 @@ import (
 )
 
 type Config struct {
-	ServerPort       string
-	ACKListenerPort  string
-	DBHost           string
-	DBPort           string
-	DBUser           string
-	DBPassword       string
-	DBName           string
-	JWTSecret        string
-	JWTAccessExpiry  string
-	JWTRefreshExpiry string
-	HISAddress       string
-	HISHTTPAddress   string
-	TLSCertPath      string
-	TLSKeyPath       string
+	ServerPort           string
+	ACKListenerPort      string
+	DBHost               string
+	DBPort               string
+	DBUser               string
+	DBPassword           string
+	DBName               string
+	JWTSecret            string
+	JWTAccessExpiry      string
+	JWTRefreshExpiry     string
+	HISAddress           string
+	HISHTTPAddress       string
+	TLSCertPath          string
+	TLSKeyPath           string
+	PublicURL            string
+	SubscriptionCriteria string
+	NotificationSecret   string
 }
 
 func Load() *Config {
 	return &Config{
-		ServerPort:       getEnv("RECEPTION_API_PORT", "8080"),
-		ACKListenerPort:  getEnv("ACK_LISTENER_PORT", "2576"),
-		DBHost:           getEnv("RECEPTION_DB_HOST", "localhost"),
-		DBPort:           getEnv("RECEPTION_DB_PORT", "5432"),
-		DBUser:           getEnv("RECEPTION_DB_USER", "reception_user"),
-		DBPassword:       getEnv("RECEPTION_DB_PASSWORD", "reception_password"),
-		DBName:           getEnv("RECEPTION_DB_NAME", "reception_db"),
-		JWTSecret:        getEnv("JWT_SECRET", "default-secret-key-to-change"),
-		JWTAccessExpiry:  getEnv("JWT_ACCESS_TOKEN_DURATION", "15m"),
-		JWTRefreshExpiry: getEnv("JWT_REFRESH_TOKEN_DURATION", "168h"),
-		HISAddress:       getEnv("HIS_MLLP_ADDRESS", "localhost:2575"),
-		HISHTTPAddress:   getEnv("HIS_HTTP_ADDRESS", "localhost:9090"),
-		TLSCertPath:      getEnv("TLS_CERT_PATH", "../certs/server.crt"),
-		TLSKeyPath:       getEnv("TLS_KEY_PATH", "../certs/server.key"),
+		ServerPort:           getEnv("RECEPTION_API_PORT", "8080"),
+		ACKListenerPort:      getEnv("ACK_LISTENER_PORT", "2576"),
+		DBHost:               getEnv("RECEPTION_DB_HOST", "localhost"),
+		DBPort:               getEnv("RECEPTION_DB_PORT", "5432"),
+		DBUser:               getEnv("RECEPTION_DB_USER", "reception_user"),
+		DBPassword:           getEnv("RECEPTION_DB_PASSWORD", "reception_password"),
+		DBName:               getEnv("RECEPTION_DB_NAME", "reception_db"),
+		JWTSecret:            getEnv("JWT_SECRET", "default-secret-key-to-change"),
+		JWTAccessExpiry:      getEnv("JWT_ACCESS_TOKEN_DURATION", "15m"),
+		JWTRefreshExpiry:     getEnv("JWT_REFRESH_TOKEN_DURATION", "168h"),
+		HISAddress:           getEnv("HIS_MLLP_ADDRESS", "localhost:2575"),
+		HISHTTPAddress:       getEnv("HIS_HTTP_ADDRESS", "localhost:9090"),
+		TLSCertPath:          getEnv("TLS_CERT_PATH", "../certs/server.crt"),
+		TLSKeyPath:           getEnv("TLS_KEY_PATH", "../certs/server.key"),
+		PublicURL:            getEnv("RECEPTION_API_PUBLIC_URL", "https://reception-api:8080"),
+		SubscriptionCriteria: getEnv("FHIR_SUBSCRIPTION_CRITERIA", "Encounter"),
+		NotificationSecret:   getEnv("NOTIFICATION_SIGNING_SECRET", "default-notification-secret-to-change"),
 	}
 }
 
@@ -1,273 +1,375 @@
 package fhir
 
 import (
-	"bytes"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"os"
+	"net/url"
 	"reception-api/models"
 	"strings"
 	"time"
 
+	fhirclient "fhir-client"
+
 	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
 	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
 	encpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/encounter_go_proto"
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/types/known/timestamppb"
+	locpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/location_go_proto"
+	practpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/practitioner_go_proto"
+	subpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/subscription_go_proto"
+	"google.golang.org/protobuf/proto"
 )
 
+// ErrVersionConflict is returned when HIS rejects an update because the resource version has changed.
+var ErrVersionConflict = fhirclient.ErrVersionConflict
+
+// ErrNotFound is returned when HIS does not know the requested resource.
+var ErrNotFound = fhirclient.ErrNotFound
+
+// ErrStatusTransition is returned when HIS refuses an encounter status change its workflow does not allow,
+// e.g. reopening a completed encounter.
+var ErrStatusTransition = fhirclient.ErrStatusTransition
+
+var encounterStatusCodes = map[string]codespb.EncounterStatusCode_Value{
+	"planned":     codespb.EncounterStatusCode_PLANNED,
+	"arrived":     codespb.EncounterStatusCode_ARRIVED,
+	"in-progress": codespb.EncounterStatusCode_IN_PROGRESS,
+	"completed":   codespb.EncounterStatusCode_FINISHED,
+	"cancelled":   codespb.EncounterStatusCode_CANCELLED,
+}
+
 // FHIRClient provides communication with FHIR server.
 type FHIRClient struct {
-	baseURL    string
-	httpClient *http.Client
+	client *fhirclient.Client
 }
 
-// NewFHIRClient creates a new FHIR client with TLS configuration.
+// NewFHIRClient creates a new FHIR client for the HIS at baseURL, trusting the certificate at certPath.
 func NewFHIRClient(baseURL string, certPath string) (*FHIRClient, error) {
-	cert, err := os.ReadFile(certPath)
+	client, err := fhirclient.New(fhirclient.Config{
+		BaseURL:  baseURL + "/fhir",
+		CertPath: certPath,
+		Timeout:  30 * time.Second,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read certificate: %w", err)
+		return nil, err
 	}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(cert) {
-		return nil, fmt.Errorf("failed to append certificate")
-	}
+	return &FHIRClient{client: client}, nil
+}
 
-	tlsConfig := &tls.Config{
-		RootCAs: certPool,
-	}
+const (
+	systemActCode     = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	systemActPriority = "http://terminology.hl7.org/CodeSystem/v3-ActPriority"
+	systemICD10       = "http://hl7.org/fhir/sid/icd-10"
+	systemVisit       = "urn:reception:visit"
+)
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
-	}
+// EncounterDetails classifies a new encounter: its class (AMB, EMER, HH, IMP or VR), type, service type,
+// priority (R, UR, EM or EL), the reason for the visit as free text and ICD-10 code, and the HIS Location it
+// takes place in. Empty fields are left out; HIS treats an encounter without a class as ambulatory.
+type EncounterDetails struct {
+	Class       string
+	Type        string
+	ServiceType string
+	Priority    string
+	ReasonText  string
+	ReasonCode  string
+	LocationID  string
+}
 
-	return &FHIRClient{
-		baseURL:    baseURL,
-		httpClient: httpClient,
-	}, nil
+// visitID identifies a visit by who is booked with whom and when, so a create that is retried after a
+// network error finds the encounter the first attempt made instead of booking the visit twice.
+func visitID(patientID string, practitionerID string, startTime time.Time) string {
+	return fmt.Sprintf("%s/%s/%s", patientID, practitionerID, startTime.UTC().Format(time.RFC3339))
 }
 
-func (c *FHIRClient) CreateEncounter(patientID string, practitionerID string, startTime time.Time) (string, error) {
-	startTimestamp := timestamppb.New(startTime)
+// visitCriteria finds the planned encounter of a visit. A visit cancelled and booked again gets a new
+// encounter rather than the cancelled one.
+func visitCriteria(patientID string, practitionerID string, startTime time.Time) string {
+	return url.Values{
+		"identifier": {systemVisit + "|" + visitID(patientID, practitionerID, startTime)},
+		"status":     {"planned"},
+	}.Encode()
+}
 
+func newPlannedEncounter(patientID string, practitionerID string, startTime time.Time, details EncounterDetails) *encpb.Encounter {
 	encounter := &encpb.Encounter{
+		Identifier: []*dtpb.Identifier{{
+			System: &dtpb.Uri{Value: systemVisit},
+			Value:  &dtpb.String{Value: visitID(patientID, practitionerID, startTime)},
+		}},
 		Status: &encpb.Encounter_StatusCode{
 			Value: codespb.EncounterStatusCode_PLANNED,
 		},
-		Subject: &dtpb.Reference{
-			Reference: &dtpb.Reference_Uri{
-				Uri: &dtpb.String{Value: fmt.Sprintf("Patient/%s", patientID)},
-			},
-		},
+		Subject: fhirclient.Reference("Patient", patientID),
 		Participant: []*encpb.Encounter_Participant{
-			{
-				Individual: &dtpb.Reference{
-					Reference: &dtpb.Reference_Uri{
-						Uri: &dtpb.String{Value: fmt.Sprintf("Practitioner/%s", practitionerID)},
-					},
-				},
-			},
+			{Individual: fhirclient.Reference("Practitioner", practitionerID)},
 		},
 		Period: &dtpb.Period{
-			Start: &dtpb.DateTime{
-				ValueUs:   startTimestamp.AsTime().UnixMicro(),
-				Precision: dtpb.DateTime_SECOND,
-			},
+			Start: fhirclient.NewDateTime(startTime),
 		},
 	}
 
-	jsonBytes, err := protojson.Marshal(encounter)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal encounter: %w", err)
+	if details.Class != "" {
+		encounter.ClassValue = fhirclient.NewCoding(systemActCode, details.Class)
+	}
+	if details.Type != "" {
+		encounter.Type = []*dtpb.CodeableConcept{{Text: &dtpb.String{Value: details.Type}}}
+	}
+	if details.ServiceType != "" {
+		encounter.ServiceType = &dtpb.CodeableConcept{Text: &dtpb.String{Value: details.ServiceType}}
+	}
+	if details.Priority != "" {
+		encounter.Priority = fhirclient.NewConcept(systemActPriority, details.Priority)
+	}
+	if details.ReasonText != "" || details.ReasonCode != "" {
+		reason := &dtpb.CodeableConcept{}
+		if details.ReasonText != "" {
+			reason.Text = &dtpb.String{Value: details.ReasonText}
+		}
+		if details.ReasonCode != "" {
+			reason.Coding = []*dtpb.Coding{fhirclient.NewCoding(systemICD10, details.ReasonCode)}
+		}
+		encounter.ReasonCode = []*dtpb.CodeableConcept{reason}
+	}
+	if details.LocationID != "" {
+		encounter.Location = []*encpb.Encounter_Location{
+			{Location: fhirclient.Reference("Location", details.LocationID)},
+		}
 	}
 
-	log.Printf("Sending FHIR Encounter to HIS: %s", strings.ReplaceAll(string(jsonBytes), "\n", " "))
+	return encounter
+}
 
-	url := fmt.Sprintf("%s/fhir/Encounter", c.baseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
+func (c *FHIRClient) CreateEncounter(ctx context.Context, patientID string, practitionerID string, startTime time.Time, details EncounterDetails, actor string) (string, error) {
+	encounter := newPlannedEncounter(patientID, practitionerID, startTime, details)
 
-	req.Header.Set("Content-Type", "application/json")
+	log.Printf("Sending FHIR Encounter to HIS: %s", strings.ReplaceAll(logResource(encounter), "\n", " "))
 
-	resp, err := c.httpClient.Do(req)
+	result, err := c.client.Create(ctx, "Encounter", encounter, nil,
+		fhirclient.IfNoneExist(visitCriteria(patientID, practitionerID, startTime)),
+		fhirclient.Actor(actor))
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+	if result.ID == "" {
+		return "", fmt.Errorf("no id in response")
 	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("HIS returned status %d: %s", resp.StatusCode, string(respBody))
+	log.Printf("Created encounter with ID: %s", result.ID)
+
+	return result.ID, nil
+}
+
+// CreateEncounters creates one planned encounter per start time in a single
+// FHIR transaction, so either all of them are scheduled or none are.
+func (c *FHIRClient) CreateEncounters(ctx context.Context, patientID string, practitionerID string, startTimes []time.Time, details EncounterDetails, actor string) ([]string, error) {
+	transaction := fhirclient.NewTransaction()
+	for _, startTime := range startTimes {
+		encounter := newPlannedEncounter(patientID, practitionerID, startTime, details)
+		if err := transaction.AddConditionalCreate("Encounter", encounter, visitCriteria(patientID, practitionerID, startTime)); err != nil {
+			return nil, err
+		}
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	log.Printf("Sending FHIR transaction to HIS: %d encounters for patient %s", len(startTimes), patientID)
+
+	response, err := c.client.Transaction(ctx, transaction, fhirclient.Actor(actor))
+	if err != nil {
+		return nil, err
 	}
 
-	encounterID, ok := result["id"].(string)
-	if !ok {
-		return "", fmt.Errorf("no id in response")
+	ids := make([]string, 0, len(response.Entry))
+	for _, entry := range response.Entry {
+		if entry.ResourceType() != "Encounter" || entry.ID() == "" {
+			return nil, fmt.Errorf("no encounter location in transaction response")
+		}
+		ids = append(ids, entry.ID())
 	}
 
-	log.Printf("Created encounter with ID: %s", encounterID)
+	log.Printf("Created %d encounters in one transaction", len(ids))
 
-	return encounterID, nil
+	return ids, nil
 }
 
-func (c *FHIRClient) GetPractitioners() ([]models.PractitionerDTO, error) {
-	url := fmt.Sprintf("%s/fhir/Practitioner", c.baseURL)
-	req, err := http.NewRequest("GET", url, nil)
+// RegisterSubscription makes sure HIS has a rest-hook Subscription with the given criteria that delivers
+// to endpoint, creating one if none exists yet. The subscription id is returned.
+func (c *FHIRClient) RegisterSubscription(ctx context.Context, criteria string, endpoint string) (string, error) {
+	bundle, err := c.client.SearchAll(ctx, "Subscription", url.Values{"url": {endpoint}, "criteria": {criteria}})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	for _, entry := range bundle.Entry {
+		var existing subpb.Subscription
+		if err := entry.Decode(&existing); err != nil {
+			continue
+		}
+		if existing.GetStatus().GetValue() != codespb.SubscriptionStatusCode_OFF && existing.GetId() != nil {
+			return existing.GetId().GetValue(), nil
+		}
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	subscription := &subpb.Subscription{
+		Status:   &subpb.Subscription_StatusCode{Value: codespb.SubscriptionStatusCode_REQUESTED},
+		Reason:   &dtpb.String{Value: "Reception encounter updates"},
+		Criteria: &dtpb.String{Value: criteria},
+		Channel: &subpb.Subscription_Channel{
+			Type:     &subpb.Subscription_Channel_TypeCode{Value: codespb.SubscriptionChannelTypeCode_REST_HOOK},
+			Endpoint: &dtpb.Url{Value: endpoint},
+			Payload:  &subpb.Subscription_Channel_PayloadCode{Value: "application/json"},
+		},
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HIS returned status %d: %s", resp.StatusCode, string(respBody))
+	var created subpb.Subscription
+	if _, err := c.client.Create(ctx, "Subscription", subscription, &created); err != nil {
+		return "", err
 	}
 
-	var bundle map[string]interface{}
-	if err := json.Unmarshal(respBody, &bundle); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
+	return created.GetId().GetValue(), nil
+}
 
-	entries, ok := bundle["entry"].([]interface{})
-	if !ok {
-		return []models.PractitionerDTO{}, nil
+// GetPractitioners returns the active practitioners, those patients can still be booked with. Deactivated
+// practitioners remain in the encounters they took part in.
+func (c *FHIRClient) GetPractitioners(ctx context.Context) ([]models.PractitionerDTO, error) {
+	bundle, err := c.client.SearchAll(ctx, "Practitioner", url.Values{"active": {"true"}})
+	if err != nil {
+		return nil, err
 	}
 
-	var practitioners []models.PractitionerDTO
-	for _, entry := range entries {
-		entryMap, ok := entry.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		resource, ok := entryMap["resource"].(map[string]interface{})
-		if !ok {
+	practitioners := []models.PractitionerDTO{}
+	for _, entry := range bundle.Matches() {
+		var practitioner practpb.Practitioner
+		if err := entry.Decode(&practitioner); err != nil {
+			log.Printf("Failed to parse FHIR Practitioner: %v", err)
 			continue
 		}
 
-		dto, err := MapFHIRToPractitionerDTO(resource)
-		if err != nil {
-			log.Printf("Failed to map FHIR Practitioner to DTO: %v", err)
-			continue
-		}
-
-		practitioners = append(practitioners, *dto)
+		practitioners = append(practitioners, *MapFHIRToPractitionerDTO(&practitioner))
 	}
 
 	return practitioners, nil
 }
 
-func (c *FHIRClient) UpdateEncounterStatus(encounterID string, status string) error {
-	reqBody := map[string]string{
-		"status": status,
-	}
-
-	jsonBytes, err := json.Marshal(reqBody)
+// GetLocations returns the locations in active use, for placing encounters. Suspended and retired locations
+// are left out.
+func (c *FHIRClient) GetLocations(ctx context.Context) ([]models.LocationDTO, error) {
+	bundle, err := c.client.SearchAll(ctx, "Location", url.Values{"status": {"active"}})
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/fhir/Encounter/%s", c.baseURL, encounterID)
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(jsonBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	locations := []models.LocationDTO{}
+	for _, entry := range bundle.Matches() {
+		var location locpb.Location
+		if err := entry.Decode(&location); err != nil {
+			log.Printf("Failed to parse FHIR Location: %v", err)
+			continue
+		}
+
+		locations = append(locations, models.LocationDTO{
+			ID:     location.GetId().GetValue(),
+			Name:   location.GetName().GetValue(),
+			Type:   fhirclient.ConceptCode(location.GetPhysicalType()),
+			PartOf: fhirclient.ReferenceID(location.GetPartOf()),
+		})
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return locations, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// UpdateEncounterStatus changes the encounter status in HIS. When version is set it is sent as If-Match and
+// ErrVersionConflict is returned if the encounter has changed since. actor is recorded by HIS in the
+// encounter status history. The new version id is returned on success.
+func (c *FHIRClient) UpdateEncounterStatus(ctx context.Context, encounterID string, status string, version string, actor string) (string, error) {
+	result, err := c.client.UpdateEncounterStatus(ctx, encounterID, status, fhirclient.IfMatch(version), fhirclient.Actor(actor))
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HIS returned status %d: %s", resp.StatusCode, string(respBody))
-	}
+	return result.VersionID, nil
+}
 
-	return nil
+// EncounterUpdate holds the encounter fields reception is allowed to change. Empty fields are left as is.
+type EncounterUpdate struct {
+	PractitionerID string
+	StartTime      *time.Time
+	Status         string
 }
 
-func (c *FHIRClient) GetEncounters() ([]models.EncounterDTO, error) {
-	url := fmt.Sprintf("%s/fhir/Encounter", c.baseURL)
-	req, err := http.NewRequest("GET", url, nil)
+// UpdateEncounter reads the encounter from HIS, applies the update and writes the full resource back with PUT.
+// Without an explicit version the write is guarded by the version that was read.
+func (c *FHIRClient) UpdateEncounter(ctx context.Context, encounterID string, update EncounterUpdate, version string, actor string) (string, error) {
+	var encounter encpb.Encounter
+	read, err := c.client.Read(ctx, "Encounter", encounterID, &encounter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if version == "" {
+		version = read.VersionID
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+	if update.PractitionerID != "" {
+		encounter.Participant = []*encpb.Encounter_Participant{
+			{Individual: fhirclient.Reference("Practitioner", update.PractitionerID)},
+		}
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HIS returned status %d: %s", resp.StatusCode, string(respBody))
+	if update.StartTime != nil {
+		if encounter.Period == nil {
+			encounter.Period = &dtpb.Period{}
+		}
+		encounter.Period.Start = fhirclient.NewDateTime(*update.StartTime)
 	}
 
-	var bundle map[string]interface{}
-	if err := json.Unmarshal(respBody, &bundle); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if update.Status != "" {
+		code, ok := encounterStatusCodes[update.Status]
+		if !ok {
+			return "", fmt.Errorf("unknown encounter status: %s", update.Status)
+		}
+		encounter.Status = &encpb.Encounter_StatusCode{Value: code}
 	}
 
-	entries, ok := bundle["entry"].([]interface{})
-	if !ok {
-		return []models.EncounterDTO{}, nil
+	log.Printf("Sending FHIR Encounter update to HIS: %s", strings.ReplaceAll(logResource(&encounter), "\n", " "))
+
+	result, err := c.client.Update(ctx, "Encounter", encounterID, &encounter, nil, fhirclient.IfMatch(version), fhirclient.Actor(actor))
+	if err != nil {
+		return "", rejected(err, ErrStatusTransition)
 	}
 
-	var encounters []models.EncounterDTO
-	for _, entry := range entries {
-		entryMap, ok := entry.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		resource, ok := entryMap["resource"].(map[string]interface{})
-		if !ok {
-			continue
-		}
+	return result.VersionID, nil
+}
+
+// GetEncounters returns all encounters, with the patient and practitioner details HIS includes for them.
+func (c *FHIRClient) GetEncounters(ctx context.Context) ([]models.EncounterDTO, error) {
+	bundle, err := c.client.SearchAll(ctx, "Encounter", url.Values{"_include": {"Encounter:subject", "Encounter:participant"}})
+	if err != nil {
+		return nil, err
+	}
 
-		dto, err := MapFHIRToEncounterDTO(resource)
-		if err != nil {
-			log.Printf("Failed to map FHIR to DTO: %v", err)
+	included := fhirclient.Index(bundle.Entry)
+
+	encounters := []models.EncounterDTO{}
+	for _, entry := range bundle.Matches() {
+		var encounter encpb.Encounter
+		if err := entry.Decode(&encounter); err != nil {
+			log.Printf("Failed to parse FHIR Encounter: %v", err)
 			continue
 		}
 
-		encounters = append(encounters, *dto)
+		encounters = append(encounters, *fhirclient.SummarizeEncounter(&encounter, included))
 	}
 
 	return encounters, nil
 }
+
+// logResource renders a resource for the log.
+func logResource(resource proto.Message) string {
+	jsonBytes, err := fhirclient.Marshal(resource)
+	if err != nil {
+		return err.Error()
+	}
+	return string(jsonBytes)
+}
@@ -0,0 +1,145 @@
+package fhir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"reception-api/models"
+	"strings"
+	"time"
+
+	fhirclient "fhir-client"
+
+	codespb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/codes_go_proto"
+	dtpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/datatypes_go_proto"
+	apptpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/appointment_go_proto"
+	paramspb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/parameters_go_proto"
+	slotpb "github.com/google/fhir/go/proto/google/fhir/proto/r4/core/resources/slot_go_proto"
+)
+
+var (
+	// ErrSlotUnavailable is returned when HIS refuses a booking because the slot was taken in the meantime.
+	ErrSlotUnavailable = errors.New("slot is no longer available")
+
+	// ErrAppointmentTransition is returned when HIS refuses an appointment status change, e.g. arriving for a
+	// cancelled appointment.
+	ErrAppointmentTransition = errors.New("appointment status change not allowed")
+)
+
+// FindFreeSlots returns the practitioner's free slots starting in [from, to), ordered by start time.
+func (c *FHIRClient) FindFreeSlots(ctx context.Context, practitionerID string, from time.Time, to time.Time) ([]models.SlotDTO, error) {
+	query := url.Values{
+		"schedule.actor": {fmt.Sprintf("Practitioner/%s", practitionerID)},
+		"status":         {"free"},
+		"start":          {"ge" + from.UTC().Format(time.RFC3339), "lt" + to.UTC().Format(time.RFC3339)},
+	}
+	bundle, err := c.client.SearchAll(ctx, "Slot", query)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []models.SlotDTO{}
+	for _, entry := range bundle.Matches() {
+		var slot slotpb.Slot
+		if err := entry.Decode(&slot); err != nil {
+			log.Printf("Failed to parse FHIR Slot: %v", err)
+			continue
+		}
+
+		slots = append(slots, models.SlotDTO{
+			ID:             slot.GetId().GetValue(),
+			PractitionerID: practitionerID,
+			Start:          time.UnixMicro(slot.GetStart().GetValueUs()).UTC().Format(time.RFC3339),
+			End:            time.UnixMicro(slot.GetEnd().GetValueUs()).UTC().Format(time.RFC3339),
+		})
+	}
+
+	return slots, nil
+}
+
+// BookAppointment books the slot for the patient and returns the appointment id. ErrSlotUnavailable is
+// returned when someone else booked the slot first.
+func (c *FHIRClient) BookAppointment(ctx context.Context, patientID string, slotID string, description string) (string, error) {
+	appointment := &apptpb.Appointment{
+		Status: &apptpb.Appointment_StatusCode{Value: codespb.AppointmentStatusCode_BOOKED},
+		Slot:   []*dtpb.Reference{fhirclient.Reference("Slot", slotID)},
+		Participant: []*apptpb.Appointment_Participant{
+			{
+				Actor:  fhirclient.Reference("Patient", patientID),
+				Status: &apptpb.Appointment_Participant_StatusCode{Value: codespb.ParticipationStatusCode_ACCEPTED},
+			},
+		},
+	}
+	if description != "" {
+		appointment.Description = &dtpb.String{Value: description}
+	}
+
+	log.Printf("Sending FHIR Appointment to HIS: %s", strings.ReplaceAll(logResource(appointment), "\n", " "))
+
+	var created apptpb.Appointment
+	result, err := c.client.Create(ctx, "Appointment", appointment, &created)
+	if errors.Is(err, fhirclient.ErrConflict) {
+		return "", ErrSlotUnavailable
+	}
+	if err != nil {
+		return "", err
+	}
+
+	id := created.GetId().GetValue()
+	if id == "" {
+		id = result.ID
+	}
+
+	log.Printf("Booked appointment with ID: %s", id)
+
+	return id, nil
+}
+
+// UpdateAppointmentStatus changes the appointment status in HIS with a FHIRPath Patch. When the patient
+// arrives HIS opens an encounter for the visit, whose id is returned; it is empty for other statuses.
+func (c *FHIRClient) UpdateAppointmentStatus(ctx context.Context, appointmentID string, status string, actor string) (string, error) {
+	patch := fhirclient.NewPatch(
+		fhirclient.PatchOperation("replace", "Appointment.status", fhirclient.CodeValue(status)),
+	)
+
+	result, err := c.client.Patch(ctx, "Appointment", appointmentID, patch, nil, fhirclient.Actor(actor))
+	if errors.Is(err, fhirclient.ErrConflict) || errors.Is(err, fhirclient.ErrInvalid) {
+		return "", fmt.Errorf("%w: %v", ErrAppointmentTransition, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, encounterID := fhirclient.SplitReference(result.Header.Get("Encounter-Location"))
+	return encounterID, nil
+}
+
+// GetPractitionerAvailability returns the periods in [from, to) in which the practitioner works and has nothing
+// booked, as computed by HIS from the working calendar, encounters and appointments.
+func (c *FHIRClient) GetPractitionerAvailability(ctx context.Context, practitionerID string, from time.Time, to time.Time) ([]models.AvailabilityDTO, error) {
+	query := url.Values{
+		"start": {from.UTC().Format(time.RFC3339)},
+		"end":   {to.UTC().Format(time.RFC3339)},
+	}
+
+	var params paramspb.Parameters
+	if _, err := c.client.Operation(ctx, fmt.Sprintf("Practitioner/%s/$availability", url.PathEscape(practitionerID)), query, &params); err != nil {
+		return nil, err
+	}
+
+	availability := []models.AvailabilityDTO{}
+	for _, p := range params.GetParameter() {
+		period := p.GetValue().GetPeriod()
+		if p.GetName().GetValue() != "free" || period == nil {
+			continue
+		}
+		availability = append(availability, models.AvailabilityDTO{
+			Start: time.UnixMicro(period.GetStart().GetValueUs()).UTC().Format(time.RFC3339),
+			End:   time.UnixMicro(period.GetEnd().GetValueUs()).UTC().Format(time.RFC3339),
+		})
+	}
+
+	return availability, nil
+}
@@ -3,6 +3,7 @@ module reception-api
 go 1.24.3
 
 require (
+	fhir-client v0.0.0
 	github.com/Masterminds/squirrel v1.5.4
 	github.com/gin-gonic/gin v1.11.0
 	github.com/golang-jwt/jwt/v5 v5.3.0
@@ -13,6 +14,7 @@ require (
 	github.com/lib/pq v1.10.9
 	golang.org/x/crypto v0.40.0
 	google.golang.org/protobuf v1.36.9
+	signature v0.0.0
 )
 
 require (
@@ -51,3 +53,7 @@ require (
 	golang.org/x/text v0.27.0 // indirect
 	golang.org/x/tools v0.34.0 // indirect
 )
+
+replace signature => ../signature
+
+replace fhir-client => ../fhir-client
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"reception-api/fhir"
+	"reception-api/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AppointmentHandler struct {
+	appointmentService *services.AppointmentService
+}
+
+func NewAppointmentHandler(appointmentService *services.AppointmentService) *AppointmentHandler {
+	return &AppointmentHandler{appointmentService: appointmentService}
+}
+
+// parseTimeWindow reads the from and to query parameters as RFC 3339 timestamps. The window defaults to the
+// seven days starting now.
+func parseTimeWindow(c *gin.Context) (time.Time, time.Time, error) {
+	from := time.Now()
+	if value := c.Query("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, from, errors.New("invalid from timestamp")
+		}
+		from = t
+	}
+
+	to := from.AddDate(0, 0, 7)
+	if value := c.Query("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, errors.New("invalid to timestamp")
+		}
+		to = t
+	}
+
+	return from, to, nil
+}
+
+// GetFreeSlots lists free slots of a practitioner in the from/to window.
+func (h *AppointmentHandler) GetFreeSlots(c *gin.Context) {
+	practitionerID := c.Query("practitioner_id")
+	if practitionerID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "practitioner_id is required"})
+		return
+	}
+
+	from, to, err := parseTimeWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slots, err := h.appointmentService.FindFreeSlots(c.Request.Context(), practitionerID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, slots)
+}
+
+func (h *AppointmentHandler) BookAppointment(c *gin.Context) {
+	var req services.BookAppointmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	appointmentID, err := h.appointmentService.BookAppointment(c.Request.Context(), req)
+	if err != nil {
+		if errors.Is(err, fhir.ErrSlotUnavailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id": appointmentID,
+	})
+}
+
+func (h *AppointmentHandler) MarkArrived(c *gin.Context) {
+	encounterID, err := h.appointmentService.MarkArrived(c.Request.Context(), c.Param("id"), requestActor(c))
+	if err != nil {
+		if errors.Is(err, fhir.ErrAppointmentTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Patient checked in", "encounterId": encounterID})
+}
+
+func (h *AppointmentHandler) CancelAppointment(c *gin.Context) {
+	if err := h.appointmentService.CancelAppointment(c.Request.Context(), c.Param("id"), requestActor(c)); err != nil {
+		if errors.Is(err, fhir.ErrAppointmentTransition) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Appointment cancelled"})
+}
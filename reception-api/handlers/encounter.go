@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"reception-api/fhir"
 	"reception-api/services"
 
+	fhirclient "fhir-client"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,6 +19,11 @@ func NewEncounterHandler(encounterService *services.EncounterService) *Encounter
 	return &EncounterHandler{encounterService: encounterService}
 }
 
+// requestActor names the logged-in receptionist for the HIS encounter status history.
+func requestActor(c *gin.Context) string {
+	return "reception/" + c.GetString("username")
+}
+
 func (h *EncounterHandler) CreateEncounter(c *gin.Context) {
 	var req services.CreateEncounterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -22,7 +31,7 @@ func (h *EncounterHandler) CreateEncounter(c *gin.Context) {
 		return
 	}
 
-	encounterID, err := h.encounterService.CreateEncounter(req)
+	encounterID, err := h.encounterService.CreateEncounter(c.Request.Context(), req, requestActor(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -33,6 +42,24 @@ func (h *EncounterHandler) CreateEncounter(c *gin.Context) {
 	})
 }
 
+func (h *EncounterHandler) CreateEncounterSeries(c *gin.Context) {
+	var req services.CreateEncounterSeriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	encounterIDs, err := h.encounterService.CreateEncounterSeries(c.Request.Context(), req, requestActor(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ids": encounterIDs,
+	})
+}
+
 func (h *EncounterHandler) UpdateEncounterStatus(c *gin.Context) {
 	encounterID := c.Param("id")
 
@@ -45,16 +72,55 @@ func (h *EncounterHandler) UpdateEncounterStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.encounterService.UpdateEncounterStatus(encounterID, req.Status); err != nil {
+	version := fhirclient.VersionFromETag(c.GetHeader("If-Match"))
+
+	newVersion, err := h.encounterService.UpdateEncounterStatus(c.Request.Context(), encounterID, req.Status, version, requestActor(c))
+	if err != nil {
+		if errors.Is(err, fhir.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, fhir.ErrStatusTransition) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully", "versionId": newVersion})
+}
+
+func (h *EncounterHandler) UpdateEncounter(c *gin.Context) {
+	encounterID := c.Param("id")
+
+	var req services.UpdateEncounterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version := fhirclient.VersionFromETag(c.GetHeader("If-Match"))
+
+	newVersion, err := h.encounterService.UpdateEncounter(c.Request.Context(), encounterID, req, version, requestActor(c))
+	if err != nil {
+		if errors.Is(err, fhir.ErrVersionConflict) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, fhir.ErrStatusTransition) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Status updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Encounter updated successfully", "versionId": newVersion})
 }
 
 func (h *EncounterHandler) GetAllEncounters(c *gin.Context) {
-	encounters, err := h.encounterService.GetAllEncounters()
+	encounters, err := h.encounterService.GetAllEncounters(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
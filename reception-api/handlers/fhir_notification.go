@@ -5,21 +5,25 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"reception-api/fhir"
 	"reception-api/websocket"
+	"signature"
+
+	fhirclient "fhir-client"
 
 	"github.com/gin-gonic/gin"
 )
 
 // FHIRNotificationHandler handles FHIR notifications from HIS.
 type FHIRNotificationHandler struct {
-	hub *websocket.Hub
+	hub      *websocket.Hub
+	verifier *signature.Verifier
 }
 
 // NewFHIRNotificationHandler creates a new FHIR notification handler.
-func NewFHIRNotificationHandler(hub *websocket.Hub) *FHIRNotificationHandler {
+func NewFHIRNotificationHandler(hub *websocket.Hub, verifier *signature.Verifier) *FHIRNotificationHandler {
 	return &FHIRNotificationHandler{
-		hub: hub,
+		hub:      hub,
+		verifier: verifier,
 	}
 }
 
@@ -32,22 +36,31 @@ func (h *FHIRNotificationHandler) HandleEncounterNotification(c *gin.Context) {
 		return
 	}
 
-	var notification map[string]interface{}
+	if err := h.verifier.Verify(c.Request.Header, body); err != nil {
+		log.Printf("Rejected notification: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var notification struct {
+		Type     string                   `json:"type"`
+		Data     json.RawMessage          `json:"data"`
+		Included []fhirclient.BundleEntry `json:"included"`
+	}
 	if err := json.Unmarshal(body, &notification); err != nil {
 		log.Printf("Failed to unmarshal notification: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification format"})
 		return
 	}
 
-	eventType, ok := notification["type"].(string)
-	if !ok {
+	eventType := notification.Type
+	if eventType == "" {
 		log.Printf("Notification missing type field")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing notification type"})
 		return
 	}
 
-	encounterData, ok := notification["data"]
-	if !ok {
+	if notification.Data == nil {
 		log.Printf("Notification missing data field")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing notification data"})
 		return
@@ -55,18 +68,21 @@ func (h *FHIRNotificationHandler) HandleEncounterNotification(c *gin.Context) {
 
 	log.Printf("Received FHIR notification: type=%s", eventType)
 
-	dto, err := fhir.MapFHIRToEncounterDTO(encounterData)
+	encounter, err := fhirclient.ParseEncounter(notification.Data)
 	if err != nil {
 		log.Printf("Error mapping FHIR to DTO: %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to map FHIR data"})
 		return
 	}
+	dto := fhirclient.SummarizeEncounter(encounter, fhirclient.Index(notification.Included))
 
 	switch eventType {
 	case "encounter_created":
 		h.hub.BroadcastEncounterCreated(dto)
 	case "encounter_status_updated":
 		h.hub.BroadcastEncounterStatusUpdated(dto)
+	case "encounter_updated":
+		h.hub.BroadcastEncounterUpdated(dto)
 	default:
 		log.Printf("Unknown notification type: %s", eventType)
 	}
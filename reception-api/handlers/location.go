@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"reception-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LocationHandler struct {
+	locationService *services.LocationService
+}
+
+func NewLocationHandler(locationService *services.LocationService) *LocationHandler {
+	return &LocationHandler{locationService: locationService}
+}
+
+// GetAllLocations lists the wards, rooms and beds encounters can be placed in.
+func (h *LocationHandler) GetAllLocations(c *gin.Context) {
+	locations, err := h.locationService.GetAllLocations(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, locations)
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"reception-api/fhir"
 	"reception-api/services"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +18,7 @@ func NewPractitionerHandler(practitionerService *services.PractitionerService) *
 }
 
 func (h *PractitionerHandler) GetAllPractitioners(c *gin.Context) {
-	practitioners, err := h.practitionerService.GetAllPractitioners()
+	practitioners, err := h.practitionerService.GetAllPractitioners(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -24,3 +26,24 @@ func (h *PractitionerHandler) GetAllPractitioners(c *gin.Context) {
 
 	c.JSON(http.StatusOK, practitioners)
 }
+
+// GetAvailability returns the practitioner's free periods in the from/to window.
+func (h *PractitionerHandler) GetAvailability(c *gin.Context) {
+	from, to, err := parseTimeWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	availability, err := h.practitionerService.GetAvailability(c.Request.Context(), c.Param("id"), from, to)
+	if err != nil {
+		if errors.Is(err, fhir.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Practitioner not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, availability)
+}
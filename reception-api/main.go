@@ -16,6 +16,7 @@ import (
 	"reception-api/router"
 	"reception-api/services"
 	"reception-api/websocket"
+	"signature"
 	"syscall"
 	"time"
 )
@@ -54,18 +55,24 @@ func main() {
 		log.Fatalf("Failed to create FHIR client: %v", err)
 	}
 
+	go registerSubscription(fhirClient, cfg.SubscriptionCriteria, cfg.PublicURL+"/fhir/notifications/encounter")
+
 	authService := services.NewAuthService(repo, jwtService)
 	patientService := services.NewPatientService(repo, hub, mllpClient)
 	encounterService := services.NewEncounterService(repo, fhirClient)
 	practitionerService := services.NewPractitionerService(fhirClient)
+	locationService := services.NewLocationService(fhirClient)
+	appointmentService := services.NewAppointmentService(repo, fhirClient)
 
 	authHandler := handlers.NewAuthHandler(authService)
 	patientHandler := handlers.NewPatientHandler(patientService)
 	encounterHandler := handlers.NewEncounterHandler(encounterService)
 	practitionerHandler := handlers.NewPractitionerHandler(practitionerService)
-	fhirNotificationHandler := handlers.NewFHIRNotificationHandler(hub)
+	locationHandler := handlers.NewLocationHandler(locationService)
+	appointmentHandler := handlers.NewAppointmentHandler(appointmentService)
+	fhirNotificationHandler := handlers.NewFHIRNotificationHandler(hub, signature.NewVerifier(cfg.NotificationSecret, 5*time.Minute))
 
-	r := router.Setup(authHandler, patientHandler, encounterHandler, practitionerHandler, fhirNotificationHandler, jwtService, hub)
+	r := router.Setup(authHandler, patientHandler, encounterHandler, practitionerHandler, locationHandler, appointmentHandler, fhirNotificationHandler, jwtService, hub)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.ServerPort,
@@ -94,3 +101,21 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// registerSubscription keeps retrying until HIS accepts the subscription, since HIS may still be starting.
+func registerSubscription(fhirClient *fhir.FHIRClient, criteria string, endpoint string) {
+	delay := time.Second
+	for {
+		id, err := fhirClient.RegisterSubscription(context.Background(), criteria, endpoint)
+		if err == nil {
+			log.Printf("Registered FHIR subscription %s: criteria=%s, endpoint=%s", id, criteria, endpoint)
+			return
+		}
+
+		log.Printf("Failed to register FHIR subscription, retrying in %s: %v", delay, err)
+		time.Sleep(delay)
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
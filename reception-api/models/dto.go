@@ -1,17 +1,9 @@
 package models
 
+import fhirclient "fhir-client"
+
 // EncounterDTO represents encounter data for client applications.
-type EncounterDTO struct {
-	ID                         string `json:"id"`
-	PatientID                  string `json:"patientId"`
-	PatientName                string `json:"patientName"`
-	PatientGender              string `json:"patientGender"`
-	PractitionerID             string `json:"practitionerId"`
-	PractitionerName           string `json:"practitionerName"`
-	PractitionerSpecialization string `json:"practitionerSpecialization"`
-	Status                     string `json:"status"`
-	CreatedAt                  string `json:"createdAt"`
-}
+type EncounterDTO = fhirclient.EncounterSummary
 
 // PractitionerDTO represents practitioner data for client applications.
 type PractitionerDTO struct {
@@ -21,3 +13,25 @@ type PractitionerDTO struct {
 	LastName       string `json:"lastName"`
 	Specialization string `json:"specialization"`
 }
+
+// LocationDTO represents a ward, room or bed encounters can take place in.
+type LocationDTO struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	PartOf string `json:"partOf,omitempty"`
+}
+
+// SlotDTO represents a bookable appointment slot for client applications.
+type SlotDTO struct {
+	ID             string `json:"id"`
+	PractitionerID string `json:"practitionerId"`
+	Start          string `json:"start"`
+	End            string `json:"end"`
+}
+
+// AvailabilityDTO is a period in which a practitioner is free to see patients.
+type AvailabilityDTO struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
@@ -8,13 +8,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func Setup(authHandler *handlers.AuthHandler, patientHandler *handlers.PatientHandler, encounterHandler *handlers.EncounterHandler, practitionerHandler *handlers.PractitionerHandler, fhirNotificationHandler *handlers.FHIRNotificationHandler, jwtService *middleware.JWTService, hub *websocket.Hub) *gin.Engine {
+func Setup(authHandler *handlers.AuthHandler, patientHandler *handlers.PatientHandler, encounterHandler *handlers.EncounterHandler, practitionerHandler *handlers.PractitionerHandler, locationHandler *handlers.LocationHandler, appointmentHandler *handlers.AppointmentHandler, fhirNotificationHandler *handlers.FHIRNotificationHandler, jwtService *middleware.JWTService, hub *websocket.Hub) *gin.Engine {
 	router := gin.Default()
 
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		if c.Request.Method == "OPTIONS" {
@@ -58,6 +58,8 @@ func Setup(authHandler *handlers.AuthHandler, patientHandler *handlers.PatientHa
 		{
 			encounters.GET("", encounterHandler.GetAllEncounters)
 			encounters.POST("", encounterHandler.CreateEncounter)
+			encounters.POST("/series", encounterHandler.CreateEncounterSeries)
+			encounters.PUT("/:id", encounterHandler.UpdateEncounter)
 			encounters.PATCH("/:id", encounterHandler.UpdateEncounterStatus)
 		}
 
@@ -65,6 +67,27 @@ func Setup(authHandler *handlers.AuthHandler, patientHandler *handlers.PatientHa
 		practitioners.Use(middleware.AuthMiddleware(jwtService))
 		{
 			practitioners.GET("", practitionerHandler.GetAllPractitioners)
+			practitioners.GET("/:id/availability", practitionerHandler.GetAvailability)
+		}
+
+		locations := api.Group("/locations")
+		locations.Use(middleware.AuthMiddleware(jwtService))
+		{
+			locations.GET("", locationHandler.GetAllLocations)
+		}
+
+		slots := api.Group("/slots")
+		slots.Use(middleware.AuthMiddleware(jwtService))
+		{
+			slots.GET("", appointmentHandler.GetFreeSlots)
+		}
+
+		appointments := api.Group("/appointments")
+		appointments.Use(middleware.AuthMiddleware(jwtService))
+		{
+			appointments.POST("", appointmentHandler.BookAppointment)
+			appointments.POST("/:id/arrive", appointmentHandler.MarkArrived)
+			appointments.POST("/:id/cancel", appointmentHandler.CancelAppointment)
 		}
 	}
 
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reception-api/database"
+	"reception-api/fhir"
+	"reception-api/models"
+	"time"
+)
+
+type AppointmentService struct {
+	repo       *database.Repository
+	fhirClient *fhir.FHIRClient
+}
+
+func NewAppointmentService(repo *database.Repository, fhirClient *fhir.FHIRClient) *AppointmentService {
+	return &AppointmentService{
+		repo:       repo,
+		fhirClient: fhirClient,
+	}
+}
+
+// FindFreeSlots lists the practitioner's free slots in [from, to).
+func (s *AppointmentService) FindFreeSlots(ctx context.Context, practitionerID string, from time.Time, to time.Time) ([]models.SlotDTO, error) {
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	return s.fhirClient.FindFreeSlots(ctx, practitionerID, from, to)
+}
+
+type BookAppointmentRequest struct {
+	PatientID   int    `json:"patient_id" binding:"required"`
+	SlotID      string `json:"slot_id" binding:"required"`
+	Description string `json:"description"`
+}
+
+func (s *AppointmentService) BookAppointment(ctx context.Context, req BookAppointmentRequest) (string, error) {
+	patient, err := s.repo.GetPatientByID(req.PatientID)
+	if err != nil {
+		return "", errors.New("patient not found")
+	}
+
+	if patient.HISPatientID == nil || *patient.HISPatientID == "" {
+		return "", errors.New("patient does not have HIS Patient ID yet")
+	}
+
+	return s.fhirClient.BookAppointment(ctx, *patient.HISPatientID, req.SlotID, req.Description)
+}
+
+// MarkArrived checks the patient in for the appointment and returns the id of the encounter HIS opened.
+func (s *AppointmentService) MarkArrived(ctx context.Context, appointmentID string, actor string) (string, error) {
+	return s.fhirClient.UpdateAppointmentStatus(ctx, appointmentID, "arrived", actor)
+}
+
+// CancelAppointment cancels the appointment, which frees its slot for another booking.
+func (s *AppointmentService) CancelAppointment(ctx context.Context, appointmentID string, actor string) error {
+	_, err := s.fhirClient.UpdateAppointmentStatus(ctx, appointmentID, "cancelled", actor)
+	return err
+}
@@ -1,11 +1,13 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reception-api/database"
 	"reception-api/fhir"
 	"reception-api/models"
+	"strings"
 	"time"
 )
 
@@ -29,13 +31,39 @@ func NewEncounterService(repo *database.Repository, fhirClient *fhir.FHIRClient)
 	}
 }
 
+// EncounterClassification is the optional classification of a new encounter. Class and priority are HL7 v3
+// codes; the reason is free text and/or an ICD-10 code such as "J06.9". LocationID is the HIS Location, e.g.
+// the cabinet, the encounter takes place in.
+type EncounterClassification struct {
+	Class       string `json:"class" binding:"omitempty,oneof=AMB EMER HH IMP VR"`
+	Type        string `json:"type"`
+	ServiceType string `json:"service_type"`
+	Priority    string `json:"priority" binding:"omitempty,oneof=R UR EM EL"`
+	ReasonText  string `json:"reason_text"`
+	ReasonCode  string `json:"reason_code"`
+	LocationID  string `json:"location_id"`
+}
+
+func (c EncounterClassification) details() fhir.EncounterDetails {
+	return fhir.EncounterDetails{
+		Class:       c.Class,
+		Type:        c.Type,
+		ServiceType: c.ServiceType,
+		Priority:    c.Priority,
+		ReasonText:  c.ReasonText,
+		ReasonCode:  strings.ToUpper(c.ReasonCode),
+		LocationID:  c.LocationID,
+	}
+}
+
 type CreateEncounterRequest struct {
 	PatientID      int       `json:"patient_id" binding:"required"`
 	PractitionerID string    `json:"practitioner_id" binding:"required"`
 	StartTime      time.Time `json:"start_time" binding:"required"`
+	EncounterClassification
 }
 
-func (s *EncounterService) CreateEncounter(req CreateEncounterRequest) (string, error) {
+func (s *EncounterService) CreateEncounter(ctx context.Context, req CreateEncounterRequest, actor string) (string, error) {
 	patient, err := s.repo.GetPatientByID(req.PatientID)
 	if err != nil {
 		return "", errors.New("patient not found")
@@ -45,7 +73,7 @@ func (s *EncounterService) CreateEncounter(req CreateEncounterRequest) (string,
 		return "", errors.New("patient does not have HIS Patient ID yet")
 	}
 
-	encounterID, err := s.fhirClient.CreateEncounter(*patient.HISPatientID, req.PractitionerID, req.StartTime)
+	encounterID, err := s.fhirClient.CreateEncounter(ctx, *patient.HISPatientID, req.PractitionerID, req.StartTime, req.details(), actor)
 	if err != nil {
 		return "", err
 	}
@@ -53,13 +81,53 @@ func (s *EncounterService) CreateEncounter(req CreateEncounterRequest) (string,
 	return encounterID, nil
 }
 
-func (s *EncounterService) UpdateEncounterStatus(encounterID string, status string) error {
+type CreateEncounterSeriesRequest struct {
+	PatientID      int         `json:"patient_id" binding:"required"`
+	PractitionerID string      `json:"practitioner_id" binding:"required"`
+	StartTimes     []time.Time `json:"start_times" binding:"required,min=1"`
+	EncounterClassification
+}
+
+// CreateEncounterSeries schedules several visits at once. HIS creates them
+// atomically, so a failure never leaves a partial schedule behind.
+func (s *EncounterService) CreateEncounterSeries(ctx context.Context, req CreateEncounterSeriesRequest, actor string) ([]string, error) {
+	patient, err := s.repo.GetPatientByID(req.PatientID)
+	if err != nil {
+		return nil, errors.New("patient not found")
+	}
+
+	if patient.HISPatientID == nil || *patient.HISPatientID == "" {
+		return nil, errors.New("patient does not have HIS Patient ID yet")
+	}
+
+	return s.fhirClient.CreateEncounters(ctx, *patient.HISPatientID, req.PractitionerID, req.StartTimes, req.details(), actor)
+}
+
+func (s *EncounterService) UpdateEncounterStatus(ctx context.Context, encounterID string, status string, version string, actor string) (string, error) {
 	if !validEncounterStatuses[status] {
-		return fmt.Errorf("invalid encounter status: %s (valid statuses: planned, arrived, in-progress, completed, cancelled)", status)
+		return "", fmt.Errorf("invalid encounter status: %s (valid statuses: planned, arrived, in-progress, completed, cancelled)", status)
 	}
-	return s.fhirClient.UpdateEncounterStatus(encounterID, status)
+	return s.fhirClient.UpdateEncounterStatus(ctx, encounterID, status, version, actor)
+}
+
+type UpdateEncounterRequest struct {
+	PractitionerID string     `json:"practitioner_id"`
+	StartTime      *time.Time `json:"start_time"`
+	Status         string     `json:"status"`
+}
+
+func (s *EncounterService) UpdateEncounter(ctx context.Context, encounterID string, req UpdateEncounterRequest, version string, actor string) (string, error) {
+	if req.Status != "" && !validEncounterStatuses[req.Status] {
+		return "", fmt.Errorf("invalid encounter status: %s (valid statuses: planned, arrived, in-progress, completed, cancelled)", req.Status)
+	}
+
+	return s.fhirClient.UpdateEncounter(ctx, encounterID, fhir.EncounterUpdate{
+		PractitionerID: req.PractitionerID,
+		StartTime:      req.StartTime,
+		Status:         req.Status,
+	}, version, actor)
 }
 
-func (s *EncounterService) GetAllEncounters() ([]models.EncounterDTO, error) {
-	return s.fhirClient.GetEncounters()
+func (s *EncounterService) GetAllEncounters(ctx context.Context) ([]models.EncounterDTO, error) {
+	return s.fhirClient.GetEncounters(ctx)
 }
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"reception-api/fhir"
+	"reception-api/models"
+)
+
+type LocationService struct {
+	fhirClient *fhir.FHIRClient
+}
+
+func NewLocationService(fhirClient *fhir.FHIRClient) *LocationService {
+	return &LocationService{
+		fhirClient: fhirClient,
+	}
+}
+
+func (s *LocationService) GetAllLocations(ctx context.Context) ([]models.LocationDTO, error) {
+	return s.fhirClient.GetLocations(ctx)
+}
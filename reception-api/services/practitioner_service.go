@@ -1,8 +1,11 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"reception-api/fhir"
 	"reception-api/models"
+	"time"
 )
 
 type PractitionerService struct {
@@ -15,6 +18,14 @@ func NewPractitionerService(fhirClient *fhir.FHIRClient) *PractitionerService {
 	}
 }
 
-func (s *PractitionerService) GetAllPractitioners() ([]models.PractitionerDTO, error) {
-	return s.fhirClient.GetPractitioners()
+func (s *PractitionerService) GetAllPractitioners(ctx context.Context) ([]models.PractitionerDTO, error) {
+	return s.fhirClient.GetPractitioners(ctx)
+}
+
+// GetAvailability lists the periods in [from, to) in which the practitioner is free, for the practitioner picker.
+func (s *PractitionerService) GetAvailability(ctx context.Context, practitionerID string, from time.Time, to time.Time) ([]models.AvailabilityDTO, error) {
+	if !to.After(from) {
+		return nil, errors.New("to must be after from")
+	}
+	return s.fhirClient.GetPractitionerAvailability(ctx, practitionerID, from, to)
 }
@@ -11,6 +11,7 @@ const (
 	MessageTypePatientHISIDUpdate     = "patient_his_id_update"
 	MessageTypeEncounterCreated       = "encounter_created"
 	MessageTypeEncounterStatusUpdated = "encounter_status_updated"
+	MessageTypeEncounterUpdated       = "encounter_updated"
 
 	BroadcastBufferSize = 256
 )
@@ -108,3 +109,10 @@ func (h *Hub) BroadcastEncounterStatusUpdated(encounterData interface{}) {
 		Data: encounterData,
 	}
 }
+
+func (h *Hub) BroadcastEncounterUpdated(encounterData interface{}) {
+	h.broadcast <- Message{
+		Type: MessageTypeEncounterUpdated,
+		Data: encounterData,
+	}
+}
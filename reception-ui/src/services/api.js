@@ -126,13 +126,18 @@ export async function getPractitioners() {
   return request('/practitioners');
 }
 
-export async function createEncounter(patientId, practitionerId, startTime) {
+export async function getLocations() {
+  return request('/locations');
+}
+
+export async function createEncounter(patientId, practitionerId, startTime, details = {}) {
   return request('/encounters', {
     method: 'POST',
     body: JSON.stringify({
       patient_id: patientId,
       practitioner_id: practitionerId,
       start_time: startTime,
+      ...details,
     }),
   });
 }
@@ -141,9 +146,18 @@ export async function getEncounters() {
   return request('/encounters');
 }
 
-export async function updateEncounterStatus(encounterId, status) {
+export async function updateEncounter(encounterId, changes, versionId) {
+  return request(`/encounters/${encounterId}`, {
+    method: 'PUT',
+    headers: versionId ? { 'If-Match': `W/"${versionId}"` } : {},
+    body: JSON.stringify(changes),
+  });
+}
+
+export async function updateEncounterStatus(encounterId, status, versionId) {
   return request(`/encounters/${encounterId}`, {
     method: 'PATCH',
+    headers: versionId ? { 'If-Match': `W/"${versionId}"` } : {},
     body: JSON.stringify({ status }),
   });
 }
@@ -0,0 +1,153 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signedHeader(secret string, sentAt time.Time, nonce string, body []byte) http.Header {
+	timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+
+	header := http.Header{}
+	header.Set(HeaderSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	header.Set(HeaderSignatureTimestamp, timestamp)
+	header.Set(HeaderSignatureNonce, nonce)
+	return header
+}
+
+func TestSignatureVerifierVerify(t *testing.T) {
+	body := []byte(`{"type":"encounter_created"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		header func() http.Header
+		body   []byte
+		want   error
+	}{
+		{
+			name:   "valid",
+			header: func() http.Header { return signedHeader("secret", now, "n1", body) },
+			body:   body,
+		},
+		{
+			name:   "unsigned",
+			header: func() http.Header { return http.Header{} },
+			body:   body,
+			want:   ErrMissingSignature,
+		},
+		{
+			name: "missing nonce",
+			header: func() http.Header {
+				header := signedHeader("secret", now, "n2", body)
+				header.Del(HeaderSignatureNonce)
+				return header
+			},
+			body: body,
+			want: ErrMissingSignature,
+		},
+		{
+			name:   "wrong secret",
+			header: func() http.Header { return signedHeader("other", now, "n3", body) },
+			body:   body,
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "changed body",
+			header: func() http.Header { return signedHeader("secret", now, "n4", body) },
+			body:   []byte(`{"type":"encounter_updated"}`),
+			want:   ErrInvalidSignature,
+		},
+		{
+			name: "malformed signature",
+			header: func() http.Header {
+				header := signedHeader("secret", now, "n5", body)
+				header.Set(HeaderSignature, "sha256=zz")
+				return header
+			},
+			body: body,
+			want: ErrInvalidSignature,
+		},
+		{
+			name:   "too old",
+			header: func() http.Header { return signedHeader("secret", now.Add(-10*time.Minute), "n6", body) },
+			body:   body,
+			want:   ErrStaleTimestamp,
+		},
+		{
+			name:   "in the future",
+			header: func() http.Header { return signedHeader("secret", now.Add(10*time.Minute), "n7", body) },
+			body:   body,
+			want:   ErrStaleTimestamp,
+		},
+		{
+			name: "malformed timestamp",
+			header: func() http.Header {
+				header := signedHeader("secret", now, "n8", body)
+				header.Set(HeaderSignatureTimestamp, "yesterday")
+				return header
+			},
+			body: body,
+			want: ErrStaleTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewVerifier("secret", 5*time.Minute)
+			if err := verifier.Verify(tt.header(), tt.body); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifierRejectsReplayedNonce(t *testing.T) {
+	body := []byte(`{}`)
+	verifier := NewVerifier("secret", 5*time.Minute)
+	header := signedHeader("secret", time.Now(), "nonce", body)
+
+	if err := verifier.Verify(header, body); err != nil {
+		t.Fatalf("first Verify() = %v, want nil", err)
+	}
+	if err := verifier.Verify(header, body); !errors.Is(err, ErrReplayedNonce) {
+		t.Errorf("second Verify() = %v, want %v", err, ErrReplayedNonce)
+	}
+}
+
+func TestSignatureVerifierKeepsNonceOfForgedRequest(t *testing.T) {
+	body := []byte(`{}`)
+	verifier := NewVerifier("secret", 5*time.Minute)
+	now := time.Now()
+
+	if err := verifier.Verify(signedHeader("other", now, "nonce", body), body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("forged Verify() = %v, want %v", err, ErrInvalidSignature)
+	}
+	if err := verifier.Verify(signedHeader("secret", now, "nonce", body), body); err != nil {
+		t.Errorf("genuine Verify() = %v, want nil", err)
+	}
+}
+
+func TestSignVerifies(t *testing.T) {
+	body := []byte(`{"type":"encounter_created"}`)
+	header := http.Header{}
+	if err := Sign(header, []byte("secret"), body); err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+
+	if err := NewVerifier("secret", 5*time.Minute).Verify(header, body); err != nil {
+		t.Errorf("Verify() of a signed notification = %v, want nil", err)
+	}
+	if err := NewVerifier("other", 5*time.Minute).Verify(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with another secret = %v, want %v", err, ErrInvalidSignature)
+	}
+}